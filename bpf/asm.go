@@ -17,7 +17,7 @@ func Assemble(insts []Instruction) ([]RawInstruction, error) {
 	for i, inst := range insts {
 		ret[i], err = inst.Assemble()
 		if err != nil {
-			return nil, fmt.Errorf("assembling instruction %d: %s", i+1, err)
+			return nil, fmt.Errorf("assembling instruction %d: %w", i+1, err)
 		}
 	}
 	return ret, nil
@@ -29,13 +29,22 @@ func Assemble(insts []Instruction) ([]RawInstruction, error) {
 // unchanged to the output. The allDecoded value reports whether insts
 // contains no RawInstructions.
 func Disassemble(raw []RawInstruction) (insts []Instruction, allDecoded bool) {
+	insts, unrecognized := DisassembleAll(raw)
+	return insts, len(unrecognized) == 0
+}
+
+// DisassembleAll is like Disassemble, but instead of a single bool it
+// returns the indices in raw of the instructions that were not
+// recognized and were passed through unchanged as RawInstructions.
+// The indices are in increasing order; unrecognized is empty if the
+// whole program was decoded.
+func DisassembleAll(raw []RawInstruction) (insts []Instruction, unrecognized []int) {
 	insts = make([]Instruction, len(raw))
-	allDecoded = true
 	for i, r := range raw {
 		insts[i] = r.Disassemble()
 		if _, ok := insts[i].(RawInstruction); ok {
-			allDecoded = false
+			unrecognized = append(unrecognized, i)
 		}
 	}
-	return insts, allDecoded
+	return insts, unrecognized
 }
@@ -0,0 +1,214 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bpfgen generates Go source for BPF programs built with
+// package bpf.
+package bpfgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+
+	"golang.org/x/net/bpf"
+)
+
+// Generate writes to w a Go source file in package pkg declaring
+// the variable varName, of type []bpf.Instruction, holding insns as
+// struct literals. This lets a fixed filter be checked into source
+// control instead of being assembled or parsed at run time, for
+// example:
+//
+//	// Code generated by bpfgen.Generate. DO NOT EDIT.
+//
+//	package filters
+//
+//	import "golang.org/x/net/bpf"
+//
+//	var ipv4 = []bpf.Instruction{
+//		bpf.LoadAbsolute{Off: 12, Size: 2},
+//		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x800, SkipTrue: 0, SkipFalse: 1},
+//		bpf.RetConstant{Val: 0xffff},
+//		bpf.RetConstant{Val: 0x0},
+//	}
+//
+// Registers, ALU operations, jump conditions and extensions are
+// written using package bpf's named constants where one exists. The
+// output is formatted as by gofmt.
+//
+// Generate returns an error if pkg or varName is not a valid Go
+// identifier, or if insns contains an instruction of a type not
+// defined by package bpf.
+func Generate(w io.Writer, pkg, varName string, insns []bpf.Instruction) error {
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("invalid package name %q", pkg)
+	}
+	if !token.IsIdentifier(varName) {
+		return fmt.Errorf("invalid variable name %q", varName)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by bpfgen.Generate. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	fmt.Fprintf(&b, "import \"golang.org/x/net/bpf\"\n\n")
+	fmt.Fprintf(&b, "var %s = []bpf.Instruction{\n", varName)
+	for i, ins := range insns {
+		lit, err := goLiteral(ins)
+		if err != nil {
+			return fmt.Errorf("instruction %d: %v", i+1, err)
+		}
+		fmt.Fprintf(&b, "\t%s,\n", lit)
+	}
+	fmt.Fprintf(&b, "}\n")
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// goLiteral returns the Go struct literal for ins.
+func goLiteral(ins bpf.Instruction) (string, error) {
+	switch ins := ins.(type) {
+	case bpf.RawInstruction:
+		return fmt.Sprintf("bpf.RawInstruction{Op: %#x, Jt: %d, Jf: %d, K: %#x}", ins.Op, ins.Jt, ins.Jf, ins.K), nil
+	case bpf.LoadConstant:
+		return fmt.Sprintf("bpf.LoadConstant{Dst: %s, Val: %#x}", goRegister(ins.Dst), ins.Val), nil
+	case bpf.LoadScratch:
+		return fmt.Sprintf("bpf.LoadScratch{Dst: %s, N: %d}", goRegister(ins.Dst), ins.N), nil
+	case bpf.LoadAbsolute:
+		return fmt.Sprintf("bpf.LoadAbsolute{Off: %d, Size: %d}", ins.Off, ins.Size), nil
+	case bpf.LoadIndirect:
+		return fmt.Sprintf("bpf.LoadIndirect{Off: %d, Size: %d}", ins.Off, ins.Size), nil
+	case bpf.LoadMemShift:
+		return fmt.Sprintf("bpf.LoadMemShift{Off: %d}", ins.Off), nil
+	case bpf.LoadExtension:
+		return fmt.Sprintf("bpf.LoadExtension{Num: %s}", goExtension(ins.Num)), nil
+	case bpf.StoreScratch:
+		return fmt.Sprintf("bpf.StoreScratch{Src: %s, N: %d}", goRegister(ins.Src), ins.N), nil
+	case bpf.ALUOpConstant:
+		return fmt.Sprintf("bpf.ALUOpConstant{Op: %s, Val: %#x}", goALUOp(ins.Op), ins.Val), nil
+	case bpf.ALUOpX:
+		return fmt.Sprintf("bpf.ALUOpX{Op: %s}", goALUOp(ins.Op)), nil
+	case bpf.NegateA:
+		return "bpf.NegateA{}", nil
+	case bpf.Jump:
+		return fmt.Sprintf("bpf.Jump{Skip: %d}", ins.Skip), nil
+	case bpf.JumpIf:
+		return fmt.Sprintf("bpf.JumpIf{Cond: %s, Val: %#x, SkipTrue: %d, SkipFalse: %d}", goJumpTest(ins.Cond), ins.Val, ins.SkipTrue, ins.SkipFalse), nil
+	case bpf.JumpIfX:
+		return fmt.Sprintf("bpf.JumpIfX{Cond: %s, SkipTrue: %d, SkipFalse: %d}", goJumpTest(ins.Cond), ins.SkipTrue, ins.SkipFalse), nil
+	case bpf.RetA:
+		return "bpf.RetA{}", nil
+	case bpf.RetConstant:
+		return fmt.Sprintf("bpf.RetConstant{Val: %#x}", ins.Val), nil
+	case bpf.TXA:
+		return "bpf.TXA{}", nil
+	case bpf.TAX:
+		return "bpf.TAX{}", nil
+	case bpf.Accept:
+		return fmt.Sprintf("bpf.Accept{Val: %#x}", ins.Val), nil
+	case bpf.Reject:
+		return "bpf.Reject{}", nil
+	}
+	return "", fmt.Errorf("unsupported instruction type %T", ins)
+}
+
+func goRegister(r bpf.Register) string {
+	switch r {
+	case bpf.RegA:
+		return "bpf.RegA"
+	case bpf.RegX:
+		return "bpf.RegX"
+	}
+	return fmt.Sprintf("bpf.Register(%d)", r)
+}
+
+func goALUOp(op bpf.ALUOp) string {
+	switch op {
+	case bpf.ALUOpAdd:
+		return "bpf.ALUOpAdd"
+	case bpf.ALUOpSub:
+		return "bpf.ALUOpSub"
+	case bpf.ALUOpMul:
+		return "bpf.ALUOpMul"
+	case bpf.ALUOpDiv:
+		return "bpf.ALUOpDiv"
+	case bpf.ALUOpOr:
+		return "bpf.ALUOpOr"
+	case bpf.ALUOpAnd:
+		return "bpf.ALUOpAnd"
+	case bpf.ALUOpShiftLeft:
+		return "bpf.ALUOpShiftLeft"
+	case bpf.ALUOpShiftRight:
+		return "bpf.ALUOpShiftRight"
+	case bpf.ALUOpMod:
+		return "bpf.ALUOpMod"
+	case bpf.ALUOpXor:
+		return "bpf.ALUOpXor"
+	}
+	return fmt.Sprintf("bpf.ALUOp(%#x)", uint16(op))
+}
+
+func goJumpTest(cond bpf.JumpTest) string {
+	switch cond {
+	case bpf.JumpEqual:
+		return "bpf.JumpEqual"
+	case bpf.JumpNotEqual:
+		return "bpf.JumpNotEqual"
+	case bpf.JumpGreaterThan:
+		return "bpf.JumpGreaterThan"
+	case bpf.JumpLessThan:
+		return "bpf.JumpLessThan"
+	case bpf.JumpGreaterOrEqual:
+		return "bpf.JumpGreaterOrEqual"
+	case bpf.JumpLessOrEqual:
+		return "bpf.JumpLessOrEqual"
+	case bpf.JumpBitsSet:
+		return "bpf.JumpBitsSet"
+	case bpf.JumpBitsNotSet:
+		return "bpf.JumpBitsNotSet"
+	}
+	return fmt.Sprintf("bpf.JumpTest(%d)", cond)
+}
+
+func goExtension(ext bpf.Extension) string {
+	switch ext {
+	case bpf.ExtLen:
+		return "bpf.ExtLen"
+	case bpf.ExtProto:
+		return "bpf.ExtProto"
+	case bpf.ExtType:
+		return "bpf.ExtType"
+	case bpf.ExtPayloadOffset:
+		return "bpf.ExtPayloadOffset"
+	case bpf.ExtInterfaceIndex:
+		return "bpf.ExtInterfaceIndex"
+	case bpf.ExtNetlinkAttr:
+		return "bpf.ExtNetlinkAttr"
+	case bpf.ExtNetlinkAttrNested:
+		return "bpf.ExtNetlinkAttrNested"
+	case bpf.ExtMark:
+		return "bpf.ExtMark"
+	case bpf.ExtQueue:
+		return "bpf.ExtQueue"
+	case bpf.ExtLinkLayerType:
+		return "bpf.ExtLinkLayerType"
+	case bpf.ExtRXHash:
+		return "bpf.ExtRXHash"
+	case bpf.ExtCPUID:
+		return "bpf.ExtCPUID"
+	case bpf.ExtVLANTag:
+		return "bpf.ExtVLANTag"
+	case bpf.ExtVLANTagPresent:
+		return "bpf.ExtVLANTagPresent"
+	case bpf.ExtVLANProto:
+		return "bpf.ExtVLANProto"
+	case bpf.ExtRand:
+		return "bpf.ExtRand"
+	}
+	return fmt.Sprintf("bpf.Extension(%d)", ext)
+}
@@ -0,0 +1,225 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpfgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestGenerate(t *testing.T) {
+	prog := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: 12, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x800, SkipTrue: 0, SkipFalse: 2},
+		bpf.LoadExtension{Num: bpf.ExtVLANTagPresent},
+		bpf.RetConstant{Val: 0xffff},
+		bpf.RetConstant{Val: 0},
+	}
+	want := `// Code generated by bpfgen.Generate. DO NOT EDIT.
+
+package filters
+
+import "golang.org/x/net/bpf"
+
+var ipv4 = []bpf.Instruction{
+	bpf.LoadAbsolute{Off: 12, Size: 2},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x800, SkipTrue: 0, SkipFalse: 2},
+	bpf.LoadExtension{Num: bpf.ExtVLANTagPresent},
+	bpf.RetConstant{Val: 0xffff},
+	bpf.RetConstant{Val: 0x0},
+}
+`
+	var b bytes.Buffer
+	if err := Generate(&b, "filters", "ipv4", prog); err != nil {
+		t.Fatalf("Generate() = %v", err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("Generate() wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGenerateAllInstructions(t *testing.T) {
+	insns := []bpf.Instruction{
+		bpf.RawInstruction{Op: 0x07, Jt: 1, Jf: 2, K: 3},
+		bpf.LoadConstant{Dst: bpf.RegA, Val: 42},
+		bpf.LoadConstant{Dst: bpf.RegX, Val: 42},
+		bpf.LoadScratch{Dst: bpf.RegA, N: 3},
+		bpf.LoadAbsolute{Off: 42, Size: 4},
+		bpf.LoadIndirect{Off: 42, Size: 2},
+		bpf.LoadMemShift{Off: 42},
+		bpf.LoadExtension{Num: bpf.ExtLen},
+		bpf.LoadExtension{Num: bpf.ExtRand},
+		bpf.LoadExtension{Num: bpf.Extension(100)},
+		bpf.StoreScratch{Src: bpf.RegX, N: 3},
+		bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 42},
+		bpf.ALUOpConstant{Op: bpf.ALUOpXor, Val: 42},
+		bpf.ALUOpX{Op: bpf.ALUOpShiftRight},
+		bpf.NegateA{},
+		bpf.Jump{Skip: 17},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 42, SkipTrue: 15, SkipFalse: 16},
+		bpf.JumpIf{Cond: bpf.JumpBitsNotSet, Val: 42, SkipTrue: 9},
+		bpf.JumpIfX{Cond: bpf.JumpGreaterOrEqual, SkipTrue: 3, SkipFalse: 4},
+		bpf.TAX{},
+		bpf.TXA{},
+		bpf.RetA{},
+		bpf.RetConstant{Val: 42},
+		bpf.Accept{Val: 42},
+		bpf.Reject{},
+	}
+	var b bytes.Buffer
+	if err := Generate(&b, "bpf_test", "prog", insns); err != nil {
+		t.Fatalf("Generate() = %v", err)
+	}
+	src := b.Bytes()
+	formatted, err := format.Source(src)
+	if err != nil {
+		t.Fatalf("format.Source() = %v", err)
+	}
+	if !bytes.Equal(formatted, src) {
+		t.Errorf("Generate() output is not gofmt-clean")
+	}
+	got := evalGenerated(t, src)
+	if !reflect.DeepEqual(got, insns) {
+		t.Errorf("generated program differs from input:\ngot  %#v\nwant %#v", got, insns)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, tt := range []struct {
+		pkg, name string
+		insns     []bpf.Instruction
+	}{
+		{"1pkg", "prog", nil},
+		{"pkg", "my-prog", nil},
+		{"pkg", "prog", []bpf.Instruction{invalidInstruction{}}},
+	} {
+		var b bytes.Buffer
+		if err := Generate(&b, tt.pkg, tt.name, tt.insns); err == nil {
+			t.Errorf("Generate(%q, %q, %v) succeeded, want error", tt.pkg, tt.name, tt.insns)
+		}
+	}
+}
+
+// goGenConstants maps the qualified names used by Generate to their
+// values.
+var goGenConstants = map[string]interface{}{
+	"bpf.RegA": bpf.RegA, "bpf.RegX": bpf.RegX,
+
+	"bpf.ALUOpAdd": bpf.ALUOpAdd, "bpf.ALUOpSub": bpf.ALUOpSub, "bpf.ALUOpMul": bpf.ALUOpMul,
+	"bpf.ALUOpDiv": bpf.ALUOpDiv, "bpf.ALUOpOr": bpf.ALUOpOr, "bpf.ALUOpAnd": bpf.ALUOpAnd,
+	"bpf.ALUOpShiftLeft": bpf.ALUOpShiftLeft, "bpf.ALUOpShiftRight": bpf.ALUOpShiftRight,
+	"bpf.ALUOpMod": bpf.ALUOpMod, "bpf.ALUOpXor": bpf.ALUOpXor,
+
+	"bpf.JumpEqual": bpf.JumpEqual, "bpf.JumpNotEqual": bpf.JumpNotEqual,
+	"bpf.JumpGreaterThan": bpf.JumpGreaterThan, "bpf.JumpLessThan": bpf.JumpLessThan,
+	"bpf.JumpGreaterOrEqual": bpf.JumpGreaterOrEqual, "bpf.JumpLessOrEqual": bpf.JumpLessOrEqual,
+	"bpf.JumpBitsSet": bpf.JumpBitsSet, "bpf.JumpBitsNotSet": bpf.JumpBitsNotSet,
+
+	"bpf.ExtLen": bpf.ExtLen, "bpf.ExtProto": bpf.ExtProto, "bpf.ExtType": bpf.ExtType,
+	"bpf.ExtPayloadOffset": bpf.ExtPayloadOffset, "bpf.ExtInterfaceIndex": bpf.ExtInterfaceIndex,
+	"bpf.ExtNetlinkAttr": bpf.ExtNetlinkAttr, "bpf.ExtNetlinkAttrNested": bpf.ExtNetlinkAttrNested,
+	"bpf.ExtMark": bpf.ExtMark, "bpf.ExtQueue": bpf.ExtQueue, "bpf.ExtLinkLayerType": bpf.ExtLinkLayerType,
+	"bpf.ExtRXHash": bpf.ExtRXHash, "bpf.ExtCPUID": bpf.ExtCPUID, "bpf.ExtVLANTag": bpf.ExtVLANTag,
+	"bpf.ExtVLANTagPresent": bpf.ExtVLANTagPresent, "bpf.ExtVLANProto": bpf.ExtVLANProto,
+	"bpf.ExtRand": bpf.ExtRand,
+}
+
+// goGenTypes maps the instruction type names used by Generate to
+// their types.
+var goGenTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, ins := range []bpf.Instruction{
+		bpf.RawInstruction{}, bpf.LoadConstant{}, bpf.LoadScratch{}, bpf.LoadAbsolute{},
+		bpf.LoadIndirect{}, bpf.LoadMemShift{}, bpf.LoadExtension{}, bpf.StoreScratch{},
+		bpf.ALUOpConstant{}, bpf.ALUOpX{}, bpf.NegateA{}, bpf.Jump{}, bpf.JumpIf{}, bpf.JumpIfX{},
+		bpf.RetA{}, bpf.RetConstant{}, bpf.TXA{}, bpf.TAX{}, bpf.Accept{}, bpf.Reject{},
+	} {
+		typ := reflect.TypeOf(ins)
+		goGenTypes["bpf."+typ.Name()] = typ
+	}
+}
+
+// evalGenerated evaluates the composite literals of the program
+// declared by src, a file written by Generate.
+func evalGenerated(t *testing.T, src []byte) []bpf.Instruction {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "prog.go", src, 0)
+	if err != nil {
+		t.Fatalf("parsing generated source: %v", err)
+	}
+	lit := f.Decls[1].(*ast.GenDecl).Specs[0].(*ast.ValueSpec).Values[0].(*ast.CompositeLit)
+	var insns []bpf.Instruction
+	for _, elt := range lit.Elts {
+		cl := elt.(*ast.CompositeLit)
+		typ, ok := goGenTypes[exprString(cl.Type)]
+		if !ok {
+			t.Fatalf("unknown instruction type %s", exprString(cl.Type))
+		}
+		v := reflect.New(typ).Elem()
+		for _, e := range cl.Elts {
+			kv := e.(*ast.KeyValueExpr)
+			field := v.FieldByName(kv.Key.(*ast.Ident).Name)
+			field.Set(evalGenerated1(t, kv.Value, field.Type()))
+		}
+		insns = append(insns, v.Interface().(bpf.Instruction))
+	}
+	return insns
+}
+
+// evalGenerated1 evaluates x, a constant expression of type typ.
+func evalGenerated1(t *testing.T, x ast.Expr, typ reflect.Type) reflect.Value {
+	t.Helper()
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		n, err := strconv.ParseUint(x.Value, 0, 64)
+		if err != nil {
+			t.Fatalf("bad literal %s", x.Value)
+		}
+		v := reflect.New(typ).Elem()
+		if typ.Kind() == reflect.Int {
+			v.SetInt(int64(n))
+		} else {
+			v.SetUint(n)
+		}
+		return v
+	case *ast.SelectorExpr:
+		c, ok := goGenConstants[exprString(x)]
+		if !ok {
+			t.Fatalf("unknown constant %s", exprString(x))
+		}
+		return reflect.ValueOf(c)
+	case *ast.CallExpr:
+		return evalGenerated1(t, x.Args[0], typ)
+	}
+	t.Fatalf("unexpected expression %T", x)
+	return reflect.Value{}
+}
+
+func exprString(x ast.Expr) string {
+	var b strings.Builder
+	if sel, ok := x.(*ast.SelectorExpr); ok {
+		b.WriteString(sel.X.(*ast.Ident).Name)
+		b.WriteString(".")
+		b.WriteString(sel.Sel.Name)
+	}
+	return b.String()
+}
+
+type invalidInstruction struct{}
+
+func (invalidInstruction) Assemble() (bpf.RawInstruction, error) {
+	return bpf.RawInstruction{}, fmt.Errorf("invalid instruction")
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Accept marks a point where a program fragment passed to Concat
+// accepts the packet.
+//
+// When the fragment is followed by another, Accept continues with the
+// first instruction of the next fragment. In the last fragment it
+// exits the program, returning Val.
+//
+// Accept is a placeholder: it cannot be assembled, and is replaced by
+// Concat.
+type Accept struct {
+	Val uint32
+}
+
+// Assemble implements the Instruction Assemble method. It always
+// returns an error, since Accept must be resolved by Concat.
+func (a Accept) Assemble() (RawInstruction, error) {
+	return RawInstruction{}, errors.New("Accept placeholder must be resolved by Concat")
+}
+
+// String returns a description of the placeholder.
+func (a Accept) String() string {
+	return fmt.Sprintf("accept #%d", a.Val)
+}
+
+// Reject marks a point where a program fragment passed to Concat
+// rejects the packet. It exits the program, returning zero.
+//
+// Reject is a placeholder: it cannot be assembled, and is replaced by
+// Concat.
+type Reject struct{}
+
+// Assemble implements the Instruction Assemble method. It always
+// returns an error, since Reject must be resolved by Concat.
+func (a Reject) Assemble() (RawInstruction, error) {
+	return RawInstruction{}, errors.New("Reject placeholder must be resolved by Concat")
+}
+
+// String returns a description of the placeholder.
+func (a Reject) String() string {
+	return "reject"
+}
+
+// Fragment turns a complete program into a fragment suitable for
+// Concat, by rewriting each RetConstant into an exit point: a
+// RetConstant returning zero becomes Reject, and any other becomes an
+// Accept returning the same value. RetA is left unchanged, since
+// whether it accepts the packet is only known at run time.
+//
+// The returned slice is a copy; prog is not modified.
+func Fragment(prog []Instruction) []Instruction {
+	frag := make([]Instruction, len(prog))
+	for i, ins := range prog {
+		if ret, ok := ins.(RetConstant); ok {
+			if ret.Val == 0 {
+				ins = Reject{}
+			} else {
+				ins = Accept{Val: ret.Val}
+			}
+		}
+		frag[i] = ins
+	}
+	return frag
+}
+
+// Concat joins program fragments into a single program, so that a
+// packet is accepted only if every fragment accepts it in turn.
+//
+// The fragments are laid out one after another. Jumps within a
+// fragment keep their targets; a jump may not leave its fragment,
+// except that a fragment other than the last may jump to its end.
+// Execution that reaches the end of a fragment continues with the
+// next one. The Accept and Reject placeholders, which fragments use to
+// exit early, are replaced: Accept by a jump to the start of the next
+// fragment, or by a RetConstant in the last fragment, and Reject by a
+// RetConstant returning zero.
+//
+// Concat returns an error if a jump leaves its fragment or if the
+// resulting program fails Validate.
+func Concat(progs ...[]Instruction) ([]Instruction, error) {
+	if len(progs) == 0 {
+		return nil, errors.New("one or more fragments must be specified")
+	}
+	var out []Instruction
+	for n, frag := range progs {
+		last := n == len(progs)-1
+		end := len(frag)
+		if !last {
+			// The end of the fragment is the start of the next one.
+			end++
+		}
+		for i, ins := range frag {
+			if err := checkJump(ins, end-(i+1)); err != nil {
+				return nil, fmt.Errorf("fragment %d, instruction %d (%v): jump leaves fragment", n, i, ins)
+			}
+			switch ins := ins.(type) {
+			case Accept:
+				if last {
+					out = append(out, RetConstant{Val: ins.Val})
+				} else {
+					out = append(out, Jump{Skip: uint32(len(frag) - (i + 1))})
+				}
+			case Reject:
+				out = append(out, RetConstant{Val: 0})
+			default:
+				out = append(out, ins)
+			}
+		}
+	}
+	if err := Validate(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestConcat(t *testing.T) {
+	isIPv4 := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: 12, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0800, SkipFalse: 1},
+		bpf.Accept{},
+		bpf.Reject{},
+	}
+	isTCP := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: 23, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: 6, SkipTrue: 1},
+		// Falls through to the next fragment.
+		bpf.Jump{Skip: 1},
+		bpf.Reject{},
+	}
+	// A complete program, turned into a fragment.
+	dstPort80 := bpf.Fragment([]bpf.Instruction{
+		bpf.LoadMemShift{Off: 14},
+		bpf.LoadIndirect{Off: 16, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 80, SkipFalse: 1},
+		bpf.RetConstant{Val: 0xffff},
+		bpf.RetConstant{Val: 0},
+	})
+
+	prog, err := bpf.Concat(isIPv4, isTCP, dstPort80)
+	if err != nil {
+		t.Fatalf("Concat: %v", err)
+	}
+	want := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: 12, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0800, SkipFalse: 1},
+		bpf.Jump{Skip: 1},
+		bpf.RetConstant{Val: 0},
+		bpf.LoadAbsolute{Off: 23, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: 6, SkipTrue: 1},
+		bpf.Jump{Skip: 1},
+		bpf.RetConstant{Val: 0},
+		bpf.LoadMemShift{Off: 14},
+		bpf.LoadIndirect{Off: 16, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 80, SkipFalse: 1},
+		bpf.RetConstant{Val: 0xffff},
+		bpf.RetConstant{Val: 0},
+	}
+	if !reflect.DeepEqual(prog, want) {
+		t.Fatalf("Concat:\ngot:  %v\nwant: %v", prog, want)
+	}
+
+	vm, err := bpf.NewVM(prog)
+	if err != nil {
+		t.Fatalf("NewVM: %v", err)
+	}
+	packet := func(etherType uint16, proto byte, port uint16) []byte {
+		p := make([]byte, 14+20+4)
+		p[12], p[13] = byte(etherType>>8), byte(etherType)
+		p[14] = 0x45
+		p[23] = proto
+		p[36], p[37] = byte(port>>8), byte(port)
+		return p
+	}
+	for _, tt := range []struct {
+		name string
+		pkt  []byte
+		want int
+	}{
+		{"tcp/80", packet(0x0800, 6, 80), 0xffff},
+		{"tcp/443", packet(0x0800, 6, 443), 0},
+		{"udp/80", packet(0x0800, 17, 80), 0},
+		{"arp", packet(0x0806, 6, 80), 0},
+	} {
+		got, err := vm.Run(tt.pkt)
+		if err != nil {
+			t.Fatalf("%s: Run: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: Run = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConcatErrors(t *testing.T) {
+	if _, err := bpf.Concat([]bpf.Instruction{
+		bpf.Jump{Skip: 1},
+	}, []bpf.Instruction{
+		bpf.RetA{},
+		bpf.RetA{},
+	}); err == nil {
+		t.Errorf("Concat with a jump leaving its fragment succeeded, want error")
+	}
+	if _, err := bpf.Concat([]bpf.Instruction{bpf.LoadConstant{Val: 1}}); err == nil {
+		t.Errorf("Concat with no final return succeeded, want error")
+	}
+	if _, err := bpf.Concat(); err == nil {
+		t.Errorf("Concat with no fragments succeeded, want error")
+	}
+	if _, err := bpf.Assemble([]bpf.Instruction{bpf.Accept{}}); err == nil {
+		t.Errorf("Assemble of Accept placeholder succeeded, want error")
+	}
+	if _, err := bpf.Assemble([]bpf.Instruction{bpf.Reject{}}); err == nil {
+		t.Errorf("Assemble of Reject placeholder succeeded, want error")
+	}
+}
@@ -17,6 +17,10 @@ const (
 )
 
 // An ALUOp is an arithmetic or logic operation.
+//
+// When used with ALUOpX, ALUOpShiftLeft and ALUOpShiftRight shift by
+// the low 5 bits of X (X & 31), matching the kernel; shifting by 33
+// shifts by 1.
 type ALUOp uint16
 
 // ALU binary operation types.
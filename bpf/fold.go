@@ -0,0 +1,145 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+// FoldConstants returns a copy of insns with simple constant
+// computations on the A register evaluated ahead of time:
+//
+//   - An ALUOpConstant that leaves A unchanged, such as "add #0",
+//     "mul #1" or "and #0xffffffff", is removed.
+//   - A LoadConstant into A followed by an ALUOpConstant is replaced
+//     by a single LoadConstant of the computed value. Chains of such
+//     operations collapse into one LoadConstant.
+//
+// An instruction that is the target of a jump is never removed or
+// folded into its predecessor, since A may hold a different value when
+// it is reached by the jump. The skip counts of jumps are adjusted to
+// account for removed instructions.
+//
+// Operations the kernel rejects, such as division by zero or shifts
+// by 32 or more, are left untouched. If insns contains a RawInstruction,
+// whose effect on control flow is unknown, or a jump past the end of the
+// program, insns is returned unchanged.
+func FoldConstants(insns []Instruction) []Instruction {
+	n := len(insns)
+	out := make([]Instruction, n)
+	copy(out, insns)
+
+	// Find every instruction that can be reached by a jump.
+	target := make([]bool, n)
+	mark := func(i int, skip int) bool {
+		t := i + 1 + skip
+		if t >= n {
+			return false
+		}
+		target[t] = true
+		return true
+	}
+	for i, ins := range insns {
+		ok := true
+		switch ins := ins.(type) {
+		case RawInstruction:
+			ok = false
+		case Jump:
+			ok = int64(ins.Skip) < int64(n) && mark(i, int(ins.Skip))
+		case JumpIf:
+			ok = mark(i, int(ins.SkipTrue)) && mark(i, int(ins.SkipFalse))
+		case JumpIfX:
+			ok = mark(i, int(ins.SkipTrue)) && mark(i, int(ins.SkipFalse))
+		}
+		if !ok {
+			return out
+		}
+	}
+
+	drop := make([]bool, n)
+	for i := range out {
+		a, ok := out[i].(ALUOpConstant)
+		if !ok || target[i] {
+			continue
+		}
+		if isIdentityALUOp(a) {
+			drop[i] = true
+			continue
+		}
+		if !canFoldALUOp(a) {
+			continue
+		}
+		// Everything between prev and i has been dropped and none
+		// of it, nor i, is a jump target, so i always runs right
+		// after prev.
+		prev := i - 1
+		for prev >= 0 && drop[prev] {
+			prev--
+		}
+		if prev < 0 {
+			continue
+		}
+		if lc, ok := out[prev].(LoadConstant); ok && lc.Dst == RegA {
+			out[prev] = LoadConstant{Dst: RegA, Val: aluOpCommon(a.Op, lc.Val, a.Val)}
+			drop[i] = true
+		}
+	}
+
+	// Compact the program, mapping old indices to new ones so that
+	// jumps can be retargeted.
+	newIndex := make([]int, n)
+	folded := make([]Instruction, 0, n)
+	for i, ins := range out {
+		newIndex[i] = len(folded)
+		if !drop[i] {
+			folded = append(folded, ins)
+		}
+	}
+	skip := func(i int, skip int) int {
+		return newIndex[i+1+skip] - newIndex[i] - 1
+	}
+	for i, ins := range out {
+		if drop[i] {
+			continue
+		}
+		j := newIndex[i]
+		switch ins := ins.(type) {
+		case Jump:
+			folded[j] = Jump{Skip: uint32(skip(i, int(ins.Skip)))}
+		case JumpIf:
+			ins.SkipTrue = uint8(skip(i, int(ins.SkipTrue)))
+			ins.SkipFalse = uint8(skip(i, int(ins.SkipFalse)))
+			folded[j] = ins
+		case JumpIfX:
+			ins.SkipTrue = uint8(skip(i, int(ins.SkipTrue)))
+			ins.SkipFalse = uint8(skip(i, int(ins.SkipFalse)))
+			folded[j] = ins
+		}
+	}
+	return folded
+}
+
+// isIdentityALUOp reports whether a leaves the A register unchanged.
+func isIdentityALUOp(a ALUOpConstant) bool {
+	switch a.Op {
+	case ALUOpAdd, ALUOpSub, ALUOpOr, ALUOpXor, ALUOpShiftLeft, ALUOpShiftRight:
+		return a.Val == 0
+	case ALUOpMul, ALUOpDiv:
+		return a.Val == 1
+	case ALUOpAnd:
+		return a.Val == 0xffffffff
+	}
+	return false
+}
+
+// canFoldALUOp reports whether a can be evaluated ahead of time with
+// the same result the kernel would compute.
+func canFoldALUOp(a ALUOpConstant) bool {
+	switch a.Op {
+	case ALUOpAdd, ALUOpSub, ALUOpMul, ALUOpOr, ALUOpAnd, ALUOpXor:
+		return true
+	case ALUOpDiv, ALUOpMod:
+		return a.Val != 0
+	case ALUOpShiftLeft, ALUOpShiftRight:
+		return a.Val < 32
+	}
+	return false
+}
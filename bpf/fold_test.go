@@ -0,0 +1,132 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestFoldConstants(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []bpf.Instruction
+		want []bpf.Instruction
+	}{
+		{
+			name: "identities",
+			in: []bpf.Instruction{
+				bpf.LoadAbsolute{Off: 0, Size: 4},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 0},
+				bpf.ALUOpConstant{Op: bpf.ALUOpSub, Val: 0},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xffffffff},
+				bpf.ALUOpConstant{Op: bpf.ALUOpOr, Val: 0},
+				bpf.ALUOpConstant{Op: bpf.ALUOpShiftLeft, Val: 0},
+				bpf.ALUOpConstant{Op: bpf.ALUOpShiftRight, Val: 0},
+				bpf.ALUOpConstant{Op: bpf.ALUOpMul, Val: 1},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xff},
+				bpf.RetA{},
+			},
+			want: []bpf.Instruction{
+				bpf.LoadAbsolute{Off: 0, Size: 4},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xff},
+				bpf.RetA{},
+			},
+		},
+		{
+			name: "fold chain",
+			in: []bpf.Instruction{
+				bpf.LoadConstant{Dst: bpf.RegA, Val: 3},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 5},
+				bpf.ALUOpConstant{Op: bpf.ALUOpShiftLeft, Val: 4},
+				bpf.ALUOpConstant{Op: bpf.ALUOpSub, Val: 0},
+				bpf.ALUOpConstant{Op: bpf.ALUOpSub, Val: 1},
+				bpf.ALUOpConstant{Op: bpf.ALUOpShiftRight, Val: 1},
+				bpf.ALUOpConstant{Op: bpf.ALUOpOr, Val: 0x100},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0x1f0},
+				bpf.RetA{},
+			},
+			want: []bpf.Instruction{
+				bpf.LoadConstant{Dst: bpf.RegA, Val: (((3+5)<<4-1)>>1 | 0x100) & 0x1f0},
+				bpf.RetA{},
+			},
+		},
+		{
+			name: "no fold into X or unsafe ops",
+			in: []bpf.Instruction{
+				bpf.LoadConstant{Dst: bpf.RegX, Val: 3},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 5},
+				bpf.LoadConstant{Dst: bpf.RegA, Val: 3},
+				bpf.ALUOpConstant{Op: bpf.ALUOpDiv, Val: 0},
+				bpf.ALUOpConstant{Op: bpf.ALUOpShiftLeft, Val: 32},
+				bpf.RetA{},
+			},
+			want: []bpf.Instruction{
+				bpf.LoadConstant{Dst: bpf.RegX, Val: 3},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 5},
+				bpf.LoadConstant{Dst: bpf.RegA, Val: 3},
+				bpf.ALUOpConstant{Op: bpf.ALUOpDiv, Val: 0},
+				bpf.ALUOpConstant{Op: bpf.ALUOpShiftLeft, Val: 32},
+				bpf.RetA{},
+			},
+		},
+		{
+			name: "jump targets",
+			in: []bpf.Instruction{
+				bpf.LoadAbsolute{Off: 0, Size: 1},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 1, SkipTrue: 2},
+				bpf.LoadConstant{Dst: bpf.RegA, Val: 10},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 0},
+				// Reached by the jump above; A is not known here.
+				bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 1},
+				bpf.ALUOpConstant{Op: bpf.ALUOpXor, Val: 0},
+				bpf.Jump{Skip: 2},
+				bpf.ALUOpConstant{Op: bpf.ALUOpMul, Val: 1},
+				bpf.RetConstant{Val: 0},
+				// Reached by the Jump; kept even though it is an identity.
+				bpf.ALUOpConstant{Op: bpf.ALUOpOr, Val: 0},
+				bpf.RetA{},
+			},
+			want: []bpf.Instruction{
+				bpf.LoadAbsolute{Off: 0, Size: 1},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 1, SkipTrue: 1},
+				bpf.LoadConstant{Dst: bpf.RegA, Val: 10},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 1},
+				bpf.Jump{Skip: 1},
+				bpf.RetConstant{Val: 0},
+				bpf.ALUOpConstant{Op: bpf.ALUOpOr, Val: 0},
+				bpf.RetA{},
+			},
+		},
+		{
+			name: "raw instruction",
+			in: []bpf.Instruction{
+				bpf.LoadConstant{Dst: bpf.RegA, Val: 3},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 5},
+				bpf.RawInstruction{Op: 0xffff},
+				bpf.RetA{},
+			},
+			want: []bpf.Instruction{
+				bpf.LoadConstant{Dst: bpf.RegA, Val: 3},
+				bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 5},
+				bpf.RawInstruction{Op: 0xffff},
+				bpf.RetA{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bpf.FoldConstants(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("FoldConstants:\ngot:  %v\nwant: %v", got, tt.want)
+			}
+			if err := bpf.Validate(got); err != nil {
+				t.Errorf("folded program is invalid: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+
+package bpf_test
+
+import (
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add([]byte{0x28, 0, 0, 0, 0x0c, 0, 0, 0, 0x15, 0, 1, 2, 0, 8, 0, 0})
+	f.Add([]byte{0x06, 0, 0, 0, 0xff, 0xff, 0, 0})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		b = b[:len(b)/8*8]
+		if err := bpf.RoundTrip(b); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+import (
+	"fmt"
+	"io"
+)
+
+// DumpImage writes insns to w in the format of libpcap's bpf_image,
+// one instruction per line, as printed by "tcpdump -d". For example:
+//
+//	(000) ldh      [12]
+//	(001) jeq      #0x800           jt 2	jf 3
+//	(002) ret      #262144
+//	(003) ret      #0
+//
+// The output matches libpcap byte for byte, including its mnemonics,
+// its padding (with trailing spaces after instructions that have no
+// operand), the tab separating the targets of conditional jumps, and
+// its printing of some unsigned operands as signed decimal numbers.
+// Jump targets are absolute instruction indices.
+//
+// Instructions are printed as assembled, so JumpIf conditions that
+// classic BPF lacks appear as the equivalent libpcap jumps with their
+// targets swapped, and extensions appear as absolute loads at offsets
+// in the negative extension region, as libpcap prints them on
+// systems other than Linux. Opcodes that libpcap does not know are
+// printed as "unimp".
+//
+// DumpImage returns an error if any instruction fails to assemble.
+func DumpImage(w io.Writer, insns []Instruction) error {
+	for i, ins := range insns {
+		ri, err := ins.Assemble()
+		if err != nil {
+			return fmt.Errorf("assembling instruction %d: %v", i+1, err)
+		}
+		if _, err := io.WriteString(w, imageLine(i, ri)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// imageLine formats ri, the instruction at index n, as bpf_image does.
+func imageLine(n int, ri RawInstruction) string {
+	k := ri.K
+	var op, operand string
+	switch ri.Op {
+	default:
+		op, operand = "unimp", fmt.Sprintf("0x%x", ri.Op)
+
+	case opClsReturn | opRetSrcConstant:
+		op, operand = "ret", fmt.Sprintf("#%d", int32(k))
+	case opClsReturn | opRetSrcA:
+		op = "ret"
+
+	case opClsLoadA | opLoadWidth4 | opAddrModeAbsolute:
+		op, operand = "ld", fmt.Sprintf("[%d]", int32(k))
+	case opClsLoadA | opLoadWidth2 | opAddrModeAbsolute:
+		op, operand = "ldh", fmt.Sprintf("[%d]", int32(k))
+	case opClsLoadA | opLoadWidth1 | opAddrModeAbsolute:
+		op, operand = "ldb", fmt.Sprintf("[%d]", int32(k))
+	case opClsLoadA | opLoadWidth4 | opAddrModePacketLen:
+		op, operand = "ld", "#pktlen"
+	case opClsLoadA | opLoadWidth4 | opAddrModeIndirect:
+		op, operand = "ld", fmt.Sprintf("[x + %d]", int32(k))
+	case opClsLoadA | opLoadWidth2 | opAddrModeIndirect:
+		op, operand = "ldh", fmt.Sprintf("[x + %d]", int32(k))
+	case opClsLoadA | opLoadWidth1 | opAddrModeIndirect:
+		op, operand = "ldb", fmt.Sprintf("[x + %d]", int32(k))
+	case opClsLoadA | opAddrModeImmediate:
+		op, operand = "ld", fmt.Sprintf("#0x%x", k)
+	case opClsLoadX | opAddrModeImmediate:
+		op, operand = "ldx", fmt.Sprintf("#0x%x", k)
+	case opClsLoadX | opLoadWidth1 | opAddrModeMemShift:
+		op, operand = "ldxb", fmt.Sprintf("4*([%d]&0xf)", int32(k))
+	case opClsLoadA | opAddrModeScratch:
+		op, operand = "ld", fmt.Sprintf("M[%d]", int32(k))
+	case opClsLoadX | opAddrModeScratch:
+		op, operand = "ldx", fmt.Sprintf("M[%d]", int32(k))
+	case opClsStoreA:
+		op, operand = "st", fmt.Sprintf("M[%d]", int32(k))
+	case opClsStoreX:
+		op, operand = "stx", fmt.Sprintf("M[%d]", int32(k))
+
+	case opClsJump | uint16(opJumpAlways):
+		op, operand = "ja", fmt.Sprintf("%d", n+1+int(int32(k)))
+	case opClsJump | uint16(opJumpGT) | uint16(opOperandConstant):
+		op, operand = "jgt", fmt.Sprintf("#0x%x", k)
+	case opClsJump | uint16(opJumpGE) | uint16(opOperandConstant):
+		op, operand = "jge", fmt.Sprintf("#0x%x", k)
+	case opClsJump | uint16(opJumpEqual) | uint16(opOperandConstant):
+		op, operand = "jeq", fmt.Sprintf("#0x%x", k)
+	case opClsJump | uint16(opJumpSet) | uint16(opOperandConstant):
+		op, operand = "jset", fmt.Sprintf("#0x%x", k)
+	case opClsJump | uint16(opJumpGT) | uint16(opOperandX):
+		op, operand = "jgt", "x"
+	case opClsJump | uint16(opJumpGE) | uint16(opOperandX):
+		op, operand = "jge", "x"
+	case opClsJump | uint16(opJumpEqual) | uint16(opOperandX):
+		op, operand = "jeq", "x"
+	case opClsJump | uint16(opJumpSet) | uint16(opOperandX):
+		op, operand = "jset", "x"
+
+	case opClsALU | uint16(ALUOpAdd) | uint16(opOperandX):
+		op, operand = "add", "x"
+	case opClsALU | uint16(ALUOpSub) | uint16(opOperandX):
+		op, operand = "sub", "x"
+	case opClsALU | uint16(ALUOpMul) | uint16(opOperandX):
+		op, operand = "mul", "x"
+	case opClsALU | uint16(ALUOpDiv) | uint16(opOperandX):
+		op, operand = "div", "x"
+	case opClsALU | uint16(ALUOpMod) | uint16(opOperandX):
+		op, operand = "mod", "x"
+	case opClsALU | uint16(ALUOpAnd) | uint16(opOperandX):
+		op, operand = "and", "x"
+	case opClsALU | uint16(ALUOpOr) | uint16(opOperandX):
+		op, operand = "or", "x"
+	case opClsALU | uint16(ALUOpXor) | uint16(opOperandX):
+		op, operand = "xor", "x"
+	case opClsALU | uint16(ALUOpShiftLeft) | uint16(opOperandX):
+		op, operand = "lsh", "x"
+	case opClsALU | uint16(ALUOpShiftRight) | uint16(opOperandX):
+		op, operand = "rsh", "x"
+	case opClsALU | uint16(ALUOpAdd) | uint16(opOperandConstant):
+		op, operand = "add", fmt.Sprintf("#%d", int32(k))
+	case opClsALU | uint16(ALUOpSub) | uint16(opOperandConstant):
+		op, operand = "sub", fmt.Sprintf("#%d", int32(k))
+	case opClsALU | uint16(ALUOpMul) | uint16(opOperandConstant):
+		op, operand = "mul", fmt.Sprintf("#%d", int32(k))
+	case opClsALU | uint16(ALUOpDiv) | uint16(opOperandConstant):
+		op, operand = "div", fmt.Sprintf("#%d", int32(k))
+	case opClsALU | uint16(ALUOpMod) | uint16(opOperandConstant):
+		op, operand = "mod", fmt.Sprintf("#%d", int32(k))
+	case opClsALU | uint16(ALUOpAnd) | uint16(opOperandConstant):
+		op, operand = "and", fmt.Sprintf("#0x%x", k)
+	case opClsALU | uint16(ALUOpOr) | uint16(opOperandConstant):
+		op, operand = "or", fmt.Sprintf("#0x%x", k)
+	case opClsALU | uint16(ALUOpXor) | uint16(opOperandConstant):
+		op, operand = "xor", fmt.Sprintf("#0x%x", k)
+	case opClsALU | uint16(ALUOpShiftLeft) | uint16(opOperandConstant):
+		op, operand = "lsh", fmt.Sprintf("#%d", int32(k))
+	case opClsALU | uint16(ALUOpShiftRight) | uint16(opOperandConstant):
+		op, operand = "rsh", fmt.Sprintf("#%d", int32(k))
+	case opClsALU | uint16(aluOpNeg):
+		op = "neg"
+	case opClsMisc | opMiscTAX:
+		op = "tax"
+	case opClsMisc | opMiscTXA:
+		op = "txa"
+	}
+	if ri.Op&opMaskCls == opClsJump && ri.Op&opMaskOperator != uint16(opJumpAlways) {
+		return fmt.Sprintf("(%03d) %-8s %-16s jt %d\tjf %d", n, op, operand, n+1+int(ri.Jt), n+1+int(ri.Jf))
+	}
+	return fmt.Sprintf("(%03d) %-8s %s", n, op, operand)
+}
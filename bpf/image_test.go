@@ -0,0 +1,97 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf_test
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestDumpImage(t *testing.T) {
+	// The output of "tcpdump -d tcp".
+	prog := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: 12, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x86dd, SkipFalse: 5},
+		bpf.LoadAbsolute{Off: 20, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x6, SkipTrue: 6},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x2c, SkipFalse: 6},
+		bpf.LoadAbsolute{Off: 54, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x6, SkipTrue: 3, SkipFalse: 4},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x800, SkipFalse: 3},
+		bpf.LoadAbsolute{Off: 23, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x6, SkipFalse: 1},
+		bpf.RetConstant{Val: 262144},
+		bpf.RetConstant{Val: 0},
+	}
+	want := `(000) ldh      [12]
+(001) jeq      #0x86dd          jt 2	jf 7
+(002) ldb      [20]
+(003) jeq      #0x6             jt 10	jf 4
+(004) jeq      #0x2c            jt 5	jf 11
+(005) ldb      [54]
+(006) jeq      #0x6             jt 10	jf 11
+(007) jeq      #0x800           jt 8	jf 11
+(008) ldb      [23]
+(009) jeq      #0x6             jt 10	jf 11
+(010) ret      #262144
+(011) ret      #0
+`
+	var b strings.Builder
+	if err := bpf.DumpImage(&b, prog); err != nil {
+		t.Fatalf("DumpImage() = %v", err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("DumpImage() wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDumpImageInstructions(t *testing.T) {
+	tests := []struct {
+		ins  bpf.Instruction
+		want string
+	}{
+		{bpf.LoadConstant{Dst: bpf.RegA, Val: 42}, "ld       #0x2a"},
+		{bpf.LoadConstant{Dst: bpf.RegX, Val: 42}, "ldx      #0x2a"},
+		{bpf.LoadScratch{Dst: bpf.RegA, N: 3}, "ld       M[3]"},
+		{bpf.LoadScratch{Dst: bpf.RegX, N: 3}, "ldx      M[3]"},
+		{bpf.LoadAbsolute{Off: 42, Size: 4}, "ld       [42]"},
+		{bpf.LoadIndirect{Off: 14, Size: 2}, "ldh      [x + 14]"},
+		{bpf.LoadMemShift{Off: 14}, "ldxb     4*([14]&0xf)"},
+		{bpf.LoadExtension{Num: bpf.ExtLen}, "ld       #pktlen"},
+		{bpf.LoadExtension{Num: bpf.ExtVLANTag}, "ld       [-4052]"},
+		{bpf.StoreScratch{Src: bpf.RegA, N: 3}, "st       M[3]"},
+		{bpf.StoreScratch{Src: bpf.RegX, N: 3}, "stx      M[3]"},
+		{bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 42}, "add      #42"},
+		{bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0x1fff}, "and      #0x1fff"},
+		{bpf.ALUOpConstant{Op: bpf.ALUOpShiftRight, Val: 4}, "rsh      #4"},
+		{bpf.ALUOpX{Op: bpf.ALUOpXor}, "xor      x"},
+		{bpf.NegateA{}, "neg      "},
+		{bpf.Jump{Skip: 10}, "ja       11"},
+		{bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: 0x1fff, SkipTrue: 2}, "jset     #0x1fff          jt 3\tjf 1"},
+		{bpf.JumpIf{Cond: bpf.JumpLessThan, Val: 8, SkipTrue: 2}, "jge      #0x8             jt 1\tjf 3"},
+		{bpf.JumpIfX{Cond: bpf.JumpGreaterThan, SkipTrue: 1}, "jgt      x                jt 2\tjf 1"},
+		{bpf.RetA{}, "ret      "},
+		{bpf.RetConstant{Val: 0xffffffff}, "ret      #-1"},
+		{bpf.TAX{}, "tax      "},
+		{bpf.TXA{}, "txa      "},
+		{bpf.RawInstruction{Op: 0xff}, "unimp    0xff"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := bpf.DumpImage(&b, []bpf.Instruction{tt.ins}); err != nil {
+			t.Errorf("DumpImage(%#v) = %v", tt.ins, err)
+			continue
+		}
+		if got, want := b.String(), "(000) "+tt.want+"\n"; got != want {
+			t.Errorf("DumpImage(%#v) wrote %q, want %q", tt.ins, got, want)
+		}
+	}
+
+	if err := bpf.DumpImage(&strings.Builder{}, []bpf.Instruction{bpf.LoadAbsolute{Size: 3}}); err == nil {
+		t.Errorf("DumpImage() of invalid instruction succeeded, want error")
+	}
+}
@@ -4,7 +4,38 @@
 
 package bpf
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the Assemble methods of instructions with invalid
+// fields. They are wrapped with details of the offending value; use
+// errors.Is to test for them.
+var (
+	// ErrInvalidLoadSize is returned for a load whose Size is not
+	// 1, 2 or 4 bytes.
+	ErrInvalidLoadSize = errors.New("invalid load byte length")
+	// ErrInvalidRegister is returned for a register other than
+	// RegA and RegX.
+	ErrInvalidRegister = errors.New("invalid register")
+	// ErrInvalidScratchSlot is returned for a scratch slot outside
+	// 0-15.
+	ErrInvalidScratchSlot = errors.New("invalid scratch slot")
+)
+
+// A registerError reports an invalid register, naming the role it was
+// used in.
+type registerError struct {
+	role string // "source" or "target"
+	reg  Register
+}
+
+func (e *registerError) Error() string {
+	return fmt.Sprintf("invalid %s register %v", e.role, e.reg)
+}
+
+func (e *registerError) Is(target error) bool { return target == ErrInvalidRegister }
 
 // An Instruction is one instruction executed by the BPF virtual
 // machine.
@@ -57,8 +88,12 @@ func (ri RawInstruction) Disassemble() Instruction {
 			}
 			return LoadScratch{Dst: reg, N: int(ri.K)}
 		case opAddrModeAbsolute:
-			if ri.K > extOffset+0xffffffff {
-				return LoadExtension{Num: Extension(-extOffset + ri.K)}
+			if isExtensionK(ri.K) {
+				ext, ok := extensionFromK(ri.K)
+				if !ok || sz != 4 {
+					return ri
+				}
+				return LoadExtension{Num: ext}
 			}
 			return LoadAbsolute{Size: sz, Off: ri.K}
 		case opAddrModeIndirect:
@@ -213,7 +248,7 @@ type LoadScratch struct {
 // Assemble implements the Instruction Assemble method.
 func (a LoadScratch) Assemble() (RawInstruction, error) {
 	if a.N < 0 || a.N > 15 {
-		return RawInstruction{}, fmt.Errorf("invalid scratch slot %d", a.N)
+		return RawInstruction{}, fmt.Errorf("%w %d", ErrInvalidScratchSlot, a.N)
 	}
 	return assembleLoad(a.Dst, 4, opAddrModeScratch, uint32(a.N))
 }
@@ -250,8 +285,8 @@ func (a LoadAbsolute) String() string {
 	case 2: // half word
 		return fmt.Sprintf("ldh [%d]", a.Off)
 	case 4: // word
-		if a.Off > extOffset+0xffffffff {
-			return LoadExtension{Num: Extension(a.Off + 0x1000)}.String()
+		if isExtensionK(a.Off) {
+			return LoadExtension{Num: Extension(a.Off - extRegionStart)}.String()
 		}
 		return fmt.Sprintf("ld [%d]", a.Off)
 	default:
@@ -316,7 +351,51 @@ func (a LoadExtension) Assemble() (RawInstruction, error) {
 	if a.Num == ExtLen {
 		return assembleLoad(RegA, 4, opAddrModePacketLen, 0)
 	}
-	return assembleLoad(RegA, 4, opAddrModeAbsolute, uint32(extOffset+a.Num))
+	k, ok := extensionToK(a.Num)
+	if !ok {
+		return RawInstruction{}, fmt.Errorf("invalid extension %d", a.Num)
+	}
+	return assembleLoad(RegA, 4, opAddrModeAbsolute, k)
+}
+
+// extRegionStart is the first K value of an absolute load that
+// invokes an extension rather than reading the packet. It is the
+// unsigned representation of extOffset (SKF_AD_OFF in the Linux
+// kernel).
+const extRegionStart = uint32(1<<32 + extOffset)
+
+// isExtensionK reports whether k, the offset of an absolute load,
+// falls in the region reserved for extensions.
+func isExtensionK(k uint32) bool {
+	return k >= extRegionStart
+}
+
+// extensionToK returns the offset of the absolute load that invokes
+// ext, and reports whether ext can be encoded in the extension region
+// at all.
+func extensionToK(ext Extension) (uint32, bool) {
+	if ext < 0 || ext >= -extOffset {
+		return 0, false
+	}
+	return extRegionStart + uint32(ext), true
+}
+
+// extensionFromK returns the Extension invoked by an absolute load of
+// offset k, and reports whether k is an extension known to this
+// package.
+func extensionFromK(k uint32) (Extension, bool) {
+	if !isExtensionK(k) {
+		return 0, false
+	}
+	switch ext := Extension(k - extRegionStart); ext {
+	case ExtProto, ExtType, ExtPayloadOffset, ExtInterfaceIndex,
+		ExtNetlinkAttr, ExtNetlinkAttrNested, ExtMark, ExtQueue,
+		ExtLinkLayerType, ExtRXHash, ExtCPUID, ExtVLANTag,
+		ExtVLANTagPresent, ExtVLANProto, ExtRand:
+		return ext, true
+	default:
+		return 0, false
+	}
 }
 
 // String returns the instruction in assembler notation.
@@ -368,7 +447,7 @@ type StoreScratch struct {
 // Assemble implements the Instruction Assemble method.
 func (a StoreScratch) Assemble() (RawInstruction, error) {
 	if a.N < 0 || a.N > 15 {
-		return RawInstruction{}, fmt.Errorf("invalid scratch slot %d", a.N)
+		return RawInstruction{}, fmt.Errorf("%w %d", ErrInvalidScratchSlot, a.N)
 	}
 	var op uint16
 	switch a.Src {
@@ -377,7 +456,7 @@ func (a StoreScratch) Assemble() (RawInstruction, error) {
 	case RegX:
 		op = opClsStoreX
 	default:
-		return RawInstruction{}, fmt.Errorf("invalid source register %v", a.Src)
+		return RawInstruction{}, &registerError{"source", a.Src}
 	}
 
 	return RawInstruction{
@@ -707,7 +786,7 @@ func assembleLoad(dst Register, loadSize int, mode uint16, k uint32) (RawInstruc
 	case RegX:
 		cls = opClsLoadX
 	default:
-		return RawInstruction{}, fmt.Errorf("invalid target register %v", dst)
+		return RawInstruction{}, &registerError{"target", dst}
 	}
 	switch loadSize {
 	case 1:
@@ -717,7 +796,7 @@ func assembleLoad(dst Register, loadSize int, mode uint16, k uint32) (RawInstruc
 	case 4:
 		sz = opLoadWidth4
 	default:
-		return RawInstruction{}, fmt.Errorf("invalid load byte length %d", sz)
+		return RawInstruction{}, fmt.Errorf("%w %d", ErrInvalidLoadSize, loadSize)
 	}
 	return RawInstruction{
 		Op: cls | sz | mode,
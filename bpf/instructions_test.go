@@ -5,6 +5,7 @@
 package bpf
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"reflect"
@@ -182,6 +183,36 @@ func TestAsmDisasm(t *testing.T) {
 	}
 }
 
+func TestDisassembleAll(t *testing.T) {
+	raw := []RawInstruction{
+		{Op: opClsLoadA | opLoadWidth2 | opAddrModeAbsolute, K: 12},
+		{Op: 0xffff},
+		{Op: opClsReturn | opRetSrcConstant, K: 0},
+		{Op: 0xfffe, K: 42},
+	}
+	got, unrecognized := DisassembleAll(raw)
+	if want := []int{1, 3}; !reflect.DeepEqual(unrecognized, want) {
+		t.Errorf("DisassembleAll unrecognized = %v, want %v", unrecognized, want)
+	}
+	want := []Instruction{
+		LoadAbsolute{Off: 12, Size: 2},
+		raw[1],
+		RetConstant{Val: 0},
+		raw[3],
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DisassembleAll = %#v, want %#v", got, want)
+	}
+
+	prog, err := Assemble(allInstructions)
+	if err != nil {
+		t.Fatalf("assembly of allInstructions program failed: %s", err)
+	}
+	if _, unrecognized := DisassembleAll(prog); len(unrecognized) != 0 {
+		t.Errorf("DisassembleAll(Assemble(allInstructions)) unrecognized = %v, want none", unrecognized)
+	}
+}
+
 type InvalidInstruction struct{}
 
 func (a InvalidInstruction) Assemble() (RawInstruction, error) {
@@ -591,3 +622,110 @@ func TestString(t *testing.T) {
 		}
 	}
 }
+
+var allExtensions = []Extension{
+	ExtLen,
+	ExtProto,
+	ExtType,
+	ExtPayloadOffset,
+	ExtInterfaceIndex,
+	ExtNetlinkAttr,
+	ExtNetlinkAttrNested,
+	ExtMark,
+	ExtQueue,
+	ExtLinkLayerType,
+	ExtRXHash,
+	ExtCPUID,
+	ExtVLANTag,
+	ExtVLANTagPresent,
+	ExtVLANProto,
+	ExtRand,
+}
+
+// Check that every known Extension survives Assemble -> Disassemble.
+func TestExtensionAsmDisasm(t *testing.T) {
+	for _, ext := range allExtensions {
+		ins := LoadExtension{Num: ext}
+		raw, err := ins.Assemble()
+		if err != nil {
+			t.Errorf("%v.Assemble() failed: %v", ins, err)
+			continue
+		}
+		if got := raw.Disassemble(); got != ins {
+			t.Errorf("Disassemble(%#v) = %#v, want %#v", raw, got, ins)
+		}
+	}
+}
+
+// Check that the whole SKF_AD_OFF region decodes to either a known
+// extension or the unrecognized RawInstruction.
+func TestExtensionRegion(t *testing.T) {
+	known := map[uint32]Extension{}
+	for _, ext := range allExtensions {
+		if ext == ExtLen {
+			continue
+		}
+		known[0xfffff000+uint32(ext)] = ext
+	}
+
+	if got := (RawInstruction{Op: opClsLoadA | opLoadWidth4 | opAddrModeAbsolute, K: 0xffffefff}).Disassemble(); got != (LoadAbsolute{Off: 0xffffefff, Size: 4}) {
+		t.Errorf("K just below the extension region decoded as %#v, want LoadAbsolute", got)
+	}
+	for k := uint64(0xfffff000); k <= 0xffffffff; k++ {
+		for _, sz := range []uint16{opLoadWidth1, opLoadWidth2, opLoadWidth4} {
+			raw := RawInstruction{Op: opClsLoadA | sz | opAddrModeAbsolute, K: uint32(k)}
+			got := raw.Disassemble()
+			ext, ok := known[uint32(k)]
+			if ok && sz == opLoadWidth4 {
+				if want := (LoadExtension{Num: ext}); got != want {
+					t.Errorf("Disassemble(%#v) = %#v, want %#v", raw, got, want)
+				}
+				continue
+			}
+			if got != raw {
+				t.Errorf("Disassemble(%#v) = %#v, want unrecognized RawInstruction", raw, got)
+			}
+		}
+	}
+}
+
+func TestExtensionAssembleInvalid(t *testing.T) {
+	for _, ext := range []Extension{-1, 0x1000, 0x7fffffff} {
+		if raw, err := (LoadExtension{Num: ext}).Assemble(); err == nil {
+			t.Errorf("LoadExtension{Num: %d}.Assemble() = %#v, want error", ext, raw)
+		}
+	}
+}
+
+func TestAssembleSentinelErrors(t *testing.T) {
+	tests := []struct {
+		ins  Instruction
+		want error
+	}{
+		{LoadAbsolute{Off: 0, Size: 3}, ErrInvalidLoadSize},
+		{LoadIndirect{Off: 0, Size: 8}, ErrInvalidLoadSize},
+		{LoadConstant{Dst: 2}, ErrInvalidRegister},
+		{LoadScratch{Dst: 2, N: 0}, ErrInvalidRegister},
+		{StoreScratch{Src: 2, N: 0}, ErrInvalidRegister},
+		{LoadScratch{Dst: RegA, N: 16}, ErrInvalidScratchSlot},
+		{StoreScratch{Src: RegX, N: -1}, ErrInvalidScratchSlot},
+	}
+	sentinels := []error{ErrInvalidLoadSize, ErrInvalidRegister, ErrInvalidScratchSlot}
+	for _, tt := range tests {
+		_, err := Assemble([]Instruction{tt.ins, RetA{}})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Assemble(%#v) = %v; want an error wrapping %q", tt.ins, err, tt.want)
+		}
+		for _, s := range sentinels {
+			if s != tt.want && errors.Is(err, s) {
+				t.Errorf("Assemble(%#v) = %v; unexpectedly wraps %q", tt.ins, err, s)
+			}
+		}
+	}
+
+	// The error reports the offending size.
+	_, err := Assemble([]Instruction{LoadAbsolute{Off: 0, Size: 3}, RetA{}})
+	if err == nil || !strings.HasSuffix(err.Error(), " 3") {
+		t.Errorf("Assemble with load size 3 = %v; want an error reporting size 3", err)
+	}
+}
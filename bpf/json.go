@@ -0,0 +1,185 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// rawInstructionJSON is the JSON form of a RawInstruction. All fields
+// are hex-encoded strings, so that opcodes read the same way as in
+// kernel headers and bpf_asm output.
+type rawInstructionJSON struct {
+	Op string
+	Jt string
+	Jf string
+	K  string
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (ri RawInstruction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rawInstructionJSON{
+		Op: fmt.Sprintf("0x%04x", ri.Op),
+		Jt: fmt.Sprintf("0x%02x", ri.Jt),
+		Jf: fmt.Sprintf("0x%02x", ri.Jf),
+		K:  fmt.Sprintf("0x%08x", ri.K),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (ri *RawInstruction) UnmarshalJSON(b []byte) error {
+	var j rawInstructionJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	op, err := parseHexField("Op", j.Op, 16)
+	if err != nil {
+		return err
+	}
+	jt, err := parseHexField("Jt", j.Jt, 8)
+	if err != nil {
+		return err
+	}
+	jf, err := parseHexField("Jf", j.Jf, 8)
+	if err != nil {
+		return err
+	}
+	k, err := parseHexField("K", j.K, 32)
+	if err != nil {
+		return err
+	}
+	*ri = RawInstruction{Op: uint16(op), Jt: uint8(jt), Jf: uint8(jf), K: uint32(k)}
+	return nil
+}
+
+func parseHexField(name, s string, bits int) (uint64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("bpf: missing RawInstruction field %s", name)
+	}
+	v, err := strconv.ParseUint(s, 0, bits)
+	if err != nil {
+		return 0, fmt.Errorf("bpf: invalid RawInstruction field %s: %v", name, err)
+	}
+	return v, nil
+}
+
+// instructionTypes maps the type names recorded in the JSON form of a
+// TaggedInstruction to the Instruction types defined by this package.
+var instructionTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, ins := range []Instruction{
+		RawInstruction{},
+		LoadConstant{},
+		LoadScratch{},
+		LoadAbsolute{},
+		LoadIndirect{},
+		LoadMemShift{},
+		LoadExtension{},
+		StoreScratch{},
+		ALUOpConstant{},
+		ALUOpX{},
+		NegateA{},
+		Jump{},
+		JumpIf{},
+		JumpIfX{},
+		RetA{},
+		RetConstant{},
+		TXA{},
+		TAX{},
+		Accept{},
+		Reject{},
+	} {
+		t := reflect.TypeOf(ins)
+		instructionTypes[t.Name()] = t
+	}
+}
+
+// A TaggedInstruction wraps an Instruction so that it can be marshaled
+// to and from JSON.
+//
+// The JSON form records the name of the concrete Instruction type
+// alongside its fields, for example:
+//
+//	{"Type":"LoadAbsolute","Fields":{"Off":12,"Size":2}}
+//
+// Only the Instruction types defined by this package can be
+// marshaled; unmarshaling an unknown type name is an error.
+type TaggedInstruction struct {
+	Instruction
+}
+
+type taggedInstructionJSON struct {
+	Type   string
+	Fields json.RawMessage
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (ti TaggedInstruction) MarshalJSON() ([]byte, error) {
+	if ti.Instruction == nil {
+		return nil, errors.New("bpf: cannot marshal nil Instruction")
+	}
+	t := reflect.TypeOf(ti.Instruction)
+	if instructionTypes[t.Name()] != t {
+		return nil, fmt.Errorf("bpf: cannot marshal unknown Instruction type %T", ti.Instruction)
+	}
+	fields, err := json.Marshal(ti.Instruction)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(taggedInstructionJSON{Type: t.Name(), Fields: fields})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (ti *TaggedInstruction) UnmarshalJSON(b []byte) error {
+	var j taggedInstructionJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	t, ok := instructionTypes[j.Type]
+	if !ok {
+		return fmt.Errorf("bpf: cannot unmarshal unknown Instruction type %q", j.Type)
+	}
+	v := reflect.New(t)
+	if len(j.Fields) > 0 {
+		d := json.NewDecoder(bytes.NewReader(j.Fields))
+		d.DisallowUnknownFields()
+		if err := d.Decode(v.Interface()); err != nil {
+			return fmt.Errorf("bpf: unmarshaling %s: %v", j.Type, err)
+		}
+	}
+	ti.Instruction = v.Elem().Interface().(Instruction)
+	return nil
+}
+
+// MarshalInstructionsJSON returns the JSON encoding of insts as an
+// array of TaggedInstructions.
+func MarshalInstructionsJSON(insts []Instruction) ([]byte, error) {
+	tagged := make([]TaggedInstruction, len(insts))
+	for i, ins := range insts {
+		tagged[i] = TaggedInstruction{ins}
+	}
+	return json.Marshal(tagged)
+}
+
+// UnmarshalInstructionsJSON parses a JSON array of TaggedInstructions,
+// as produced by MarshalInstructionsJSON, and returns the program it
+// describes.
+func UnmarshalInstructionsJSON(b []byte) ([]Instruction, error) {
+	var tagged []TaggedInstruction
+	if err := json.Unmarshal(b, &tagged); err != nil {
+		return nil, err
+	}
+	insts := make([]Instruction, len(tagged))
+	for i, ti := range tagged {
+		insts[i] = ti.Instruction
+	}
+	return insts, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRawInstructionJSON(t *testing.T) {
+	ri := RawInstruction{Op: 0x15, Jt: 1, Jf: 2, K: 0x0806}
+	b, err := json.Marshal(ri)
+	if err != nil {
+		t.Fatalf("Marshal(%#v): %v", ri, err)
+	}
+	if want := `{"Op":"0x0015","Jt":"0x01","Jf":"0x02","K":"0x00000806"}`; string(b) != want {
+		t.Errorf("Marshal(%#v) = %s, want %s", ri, b, want)
+	}
+
+	var got RawInstruction
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", b, err)
+	}
+	if got != ri {
+		t.Errorf("Unmarshal(%s) = %#v, want %#v", b, got, ri)
+	}
+
+	for _, bad := range []string{
+		`{"Op":"0x10000","Jt":"0x00","Jf":"0x00","K":"0x00"}`,
+		`{"Op":"0x00","Jt":"zz","Jf":"0x00","K":"0x00"}`,
+		`{"Op":"0x00","Jt":"0x00","Jf":"0x00"}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &got); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestInstructionsJSONRoundTrip(t *testing.T) {
+	prog := append([]Instruction{RawInstruction{Op: 0xffff, K: 42}}, allInstructions...)
+	// Concat placeholders, which cannot be assembled, round-trip too.
+	prog = append(prog, Accept{Val: 7}, Reject{})
+	b, err := MarshalInstructionsJSON(prog)
+	if err != nil {
+		t.Fatalf("MarshalInstructionsJSON: %v", err)
+	}
+	got, err := UnmarshalInstructionsJSON(b)
+	if err != nil {
+		t.Fatalf("UnmarshalInstructionsJSON: %v", err)
+	}
+	if !reflect.DeepEqual(got, prog) {
+		t.Errorf("program mutated by JSON round trip:")
+		for i := range got {
+			if !reflect.DeepEqual(got[i], prog[i]) {
+				t.Logf("  insn %d, want: %#v, got: %#v", i+1, prog[i], got[i])
+			}
+		}
+	}
+}
+
+func TestTaggedInstructionJSON(t *testing.T) {
+	b, err := json.Marshal(TaggedInstruction{LoadAbsolute{Off: 12, Size: 2}})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if want := `{"Type":"LoadAbsolute","Fields":{"Off":12,"Size":2}}`; string(b) != want {
+		t.Errorf("Marshal = %s, want %s", b, want)
+	}
+
+	for _, bad := range []string{
+		`{"Type":"LoadSomething","Fields":{}}`,
+		`{"Type":"","Fields":{}}`,
+		`{"Type":"LoadAbsolute","Fields":{"Offset":12}}`,
+	} {
+		var ti TaggedInstruction
+		if err := json.Unmarshal([]byte(bad), &ti); err == nil {
+			t.Errorf("Unmarshal(%s) = %#v, want error", bad, ti.Instruction)
+		}
+	}
+
+	if _, err := json.Marshal(TaggedInstruction{InvalidInstruction{}}); err == nil {
+		t.Errorf("Marshal of unknown Instruction type succeeded, want error")
+	}
+	if _, err := json.Marshal(TaggedInstruction{}); err == nil {
+		t.Errorf("Marshal of nil Instruction succeeded, want error")
+	}
+}
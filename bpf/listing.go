@@ -0,0 +1,206 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DumpListing writes an annotated listing of insns to w, one
+// instruction per line. Each line holds the instruction's index, its
+// assembler notation and a comment describing what it does, for
+// example:
+//
+//	(000) ldh [12]                    ; load 2 bytes at offset 12 (EtherType)
+//	(001) jeq #0x800   jt 2  jf 5     ; if A == 0x800 goto 2 else goto 5
+//
+// Unlike the String methods of the jump instructions, which print
+// relative skip counts, the listing resolves jump targets to absolute
+// instruction indices.
+//
+// Comments naming well-known packet fields assume the program runs on
+// Ethernet frames. The exact layout of the listing may change.
+func DumpListing(w io.Writer, insns []Instruction) error {
+	for i, ins := range insns {
+		text, comment := listInstruction(i, ins)
+		if _, err := fmt.Fprintf(w, "(%03d) %-27s ; %s\n", i, text, comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listInstruction returns the assembler text and comment for ins,
+// which is at index i of its program.
+func listInstruction(i int, ins Instruction) (text, comment string) {
+	target := func(skip uint32) int { return i + 1 + int(skip) }
+
+	switch ins := ins.(type) {
+	case LoadConstant:
+		return instructionString(ins), fmt.Sprintf("%s = %#x", registerName(ins.Dst), ins.Val)
+	case LoadScratch:
+		return instructionString(ins), fmt.Sprintf("%s = M[%d]", registerName(ins.Dst), ins.N)
+	case LoadAbsolute:
+		if ins.Size == 4 && isExtensionK(ins.Off) {
+			return instructionString(ins), "load extension " + extensionName(Extension(ins.Off-extRegionStart))
+		}
+		comment = fmt.Sprintf("load %s at offset %d", byteCount(ins.Size), ins.Off)
+		if f, ok := ethernetFields[packetField{ins.Off, ins.Size}]; ok {
+			comment += " (" + f + ")"
+		}
+		return instructionString(ins), comment
+	case LoadIndirect:
+		return instructionString(ins), fmt.Sprintf("load %s at offset X+%d", byteCount(ins.Size), ins.Off)
+	case LoadMemShift:
+		return instructionString(ins), fmt.Sprintf("X = 4*(byte at offset %d & 0xf)", ins.Off)
+	case LoadExtension:
+		return instructionString(ins), "load extension " + extensionName(ins.Num)
+	case StoreScratch:
+		return instructionString(ins), fmt.Sprintf("M[%d] = %s", ins.N, registerName(ins.Src))
+	case ALUOpConstant:
+		return instructionString(ins), fmt.Sprintf("A = A %s %#x", aluOpSymbol(ins.Op), ins.Val)
+	case ALUOpX:
+		return instructionString(ins), fmt.Sprintf("A = A %s X", aluOpSymbol(ins.Op))
+	case NegateA:
+		return instructionString(ins), "A = -A"
+	case Jump:
+		t := target(ins.Skip)
+		return fmt.Sprintf("ja %d", t), fmt.Sprintf("goto %d", t)
+	case JumpIf:
+		operand := fmt.Sprintf("%#x", ins.Val)
+		return listJump(ins.Cond, "#"+operand, operand, target(uint32(ins.SkipTrue)), target(uint32(ins.SkipFalse)))
+	case JumpIfX:
+		return listJump(ins.Cond, "x", "X", target(uint32(ins.SkipTrue)), target(uint32(ins.SkipFalse)))
+	case RetA:
+		return instructionString(ins), "return A"
+	case RetConstant:
+		if ins.Val == 0 {
+			return instructionString(ins), "return 0 (drop packet)"
+		}
+		return instructionString(ins), fmt.Sprintf("return %d", ins.Val)
+	case TXA:
+		return instructionString(ins), "A = X"
+	case TAX:
+		return instructionString(ins), "X = A"
+	case RawInstruction:
+		return fmt.Sprintf("op %#04x jt %d jf %d k %#x", ins.Op, ins.Jt, ins.Jf, ins.K), "unrecognized instruction"
+	}
+	return instructionString(ins), "unknown instruction"
+}
+
+// listJump returns the listing text and comment of a conditional jump.
+func listJump(cond JumpTest, asmOperand, operand string, jt, jf int) (text, comment string) {
+	var mnemonic, test string
+	switch cond {
+	case JumpEqual:
+		mnemonic, test = "jeq", "A == "+operand
+	case JumpNotEqual:
+		mnemonic, test = "jneq", "A != "+operand
+	case JumpGreaterThan:
+		mnemonic, test = "jgt", "A > "+operand
+	case JumpLessThan:
+		mnemonic, test = "jlt", "A < "+operand
+	case JumpGreaterOrEqual:
+		mnemonic, test = "jge", "A >= "+operand
+	case JumpLessOrEqual:
+		mnemonic, test = "jle", "A <= "+operand
+	case JumpBitsSet:
+		mnemonic, test = "jset", "A & "+operand+" != 0"
+	case JumpBitsNotSet:
+		mnemonic, test = "jnset", "A & "+operand+" == 0"
+	default:
+		return fmt.Sprintf("unknown JumpTest %#v", cond), "unknown instruction"
+	}
+	text = fmt.Sprintf("%-12s jt %-2d jf %d", mnemonic+" "+asmOperand, jt, jf)
+	if jt == jf {
+		return text, fmt.Sprintf("goto %d", jt)
+	}
+	return text, fmt.Sprintf("if %s goto %d else goto %d", test, jt, jf)
+}
+
+// instructionString returns the assembler notation of ins.
+func instructionString(ins Instruction) string {
+	if s, ok := ins.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%#v", ins)
+}
+
+func byteCount(n int) string {
+	if n == 1 {
+		return "1 byte"
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+func registerName(r Register) string {
+	switch r {
+	case RegA:
+		return "A"
+	case RegX:
+		return "X"
+	}
+	return fmt.Sprintf("register(%d)", r)
+}
+
+// extensionName returns the name of e as used by bpf_asm, such as
+// "len" for ExtLen.
+func extensionName(e Extension) string {
+	s := LoadExtension{Num: e}.String()
+	if name := strings.TrimPrefix(s, "ld #"); name != s {
+		return name
+	}
+	return fmt.Sprintf("%d", e)
+}
+
+func aluOpSymbol(op ALUOp) string {
+	switch op {
+	case ALUOpAdd:
+		return "+"
+	case ALUOpSub:
+		return "-"
+	case ALUOpMul:
+		return "*"
+	case ALUOpDiv:
+		return "/"
+	case ALUOpOr:
+		return "|"
+	case ALUOpAnd:
+		return "&"
+	case ALUOpShiftLeft:
+		return "<<"
+	case ALUOpShiftRight:
+		return ">>"
+	case ALUOpMod:
+		return "%"
+	case ALUOpXor:
+		return "^"
+	}
+	return fmt.Sprintf("<unknown ALUOp %#x>", uint16(op))
+}
+
+// A packetField is a load of Size bytes at offset Off.
+type packetField struct {
+	Off  uint32
+	Size int
+}
+
+// ethernetFields names the fields read by common absolute loads on an
+// untagged Ethernet frame carrying IPv4 or IPv6.
+var ethernetFields = map[packetField]string{
+	{0, 4}:  "destination MAC, first 4 bytes",
+	{6, 4}:  "source MAC, first 4 bytes",
+	{12, 2}: "EtherType",
+	{14, 1}: "IP version and IPv4 header length",
+	{16, 2}: "IPv4 total length",
+	{18, 2}: "IPv6 payload length",
+	{20, 1}: "IPv6 next header",
+	{20, 2}: "IPv4 flags and fragment offset",
+	{23, 1}: "IPv4 protocol",
+	{26, 4}: "IPv4 source address",
+	{30, 4}: "IPv4 destination address",
+}
@@ -0,0 +1,49 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf_test
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestDumpListing(t *testing.T) {
+	prog := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: 12, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x800, SkipFalse: 3},
+		bpf.LoadAbsolute{Off: 23, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: 6, SkipTrue: 1},
+		bpf.Jump{Skip: 1},
+		bpf.RetConstant{Val: 0},
+		bpf.LoadMemShift{Off: 14},
+		bpf.LoadIndirect{Off: 16, Size: 2},
+		bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xff},
+		bpf.JumpIfX{Cond: bpf.JumpGreaterThan, SkipTrue: 1},
+		bpf.LoadExtension{Num: bpf.ExtLen},
+		bpf.RetA{},
+	}
+	want := `(000) ldh [12]                    ; load 2 bytes at offset 12 (EtherType)
+(001) jeq #0x800   jt 2  jf 5     ; if A == 0x800 goto 2 else goto 5
+(002) ldb [23]                    ; load 1 byte at offset 23 (IPv4 protocol)
+(003) jneq #0x6    jt 5  jf 4     ; if A != 0x6 goto 5 else goto 4
+(004) ja 6                        ; goto 6
+(005) ret #0                      ; return 0 (drop packet)
+(006) ldx 4*([14]&0xf)            ; X = 4*(byte at offset 14 & 0xf)
+(007) ldh [x + 16]                ; load 2 bytes at offset X+16
+(008) and #255                    ; A = A & 0xff
+(009) jgt x        jt 11 jf 10    ; if A > X goto 11 else goto 10
+(010) ld #len                     ; load extension len
+(011) ret a                       ; return A
+`
+	var buf bytes.Buffer
+	if err := bpf.DumpListing(&buf, prog); err != nil {
+		t.Fatalf("DumpListing: %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("DumpListing output:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+// MatchField16 returns the instructions that load the 16-bit field at
+// offset off of the packet and compare it with value. The comparison
+// skips skipTrue instructions if the field equals value, and skipFalse
+// instructions otherwise, counting from the instruction after it.
+//
+// BPF loads multi-byte fields in network (big-endian) byte order, so
+// value is the logical value of the field, not its wire bytes: for
+// example, MatchField16(12, 0x0800, 0, 1) matches the EtherType of an
+// IPv4 packet, stored as the bytes 0x08, 0x00. Callers must not
+// byte-swap value for their host.
+func MatchField16(off uint32, value uint16, skipTrue, skipFalse uint8) []Instruction {
+	return []Instruction{
+		LoadAbsolute{Off: off, Size: 2},
+		JumpIf{Cond: JumpEqual, Val: uint32(value), SkipTrue: skipTrue, SkipFalse: skipFalse},
+	}
+}
+
+// MatchField32 is like MatchField16, but for a 32-bit field.
+func MatchField32(off uint32, value uint32, skipTrue, skipFalse uint8) []Instruction {
+	return []Instruction{
+		LoadAbsolute{Off: off, Size: 4},
+		JumpIf{Cond: JumpEqual, Val: value, SkipTrue: skipTrue, SkipFalse: skipFalse},
+	}
+}
+
+// MatchIndirectField16 is like MatchField16, but the offset of the
+// field is X+off, as for LoadIndirect. It is used for fields after a
+// header of variable length, whose length has been loaded into X.
+func MatchIndirectField16(off uint32, value uint16, skipTrue, skipFalse uint8) []Instruction {
+	return []Instruction{
+		LoadIndirect{Off: off, Size: 2},
+		JumpIf{Cond: JumpEqual, Val: uint32(value), SkipTrue: skipTrue, SkipFalse: skipFalse},
+	}
+}
+
+// MatchIndirectField32 is like MatchField32, but the offset of the
+// field is X+off, as for LoadIndirect.
+func MatchIndirectField32(off uint32, value uint32, skipTrue, skipFalse uint8) []Instruction {
+	return []Instruction{
+		LoadIndirect{Off: off, Size: 4},
+		JumpIf{Cond: JumpEqual, Val: value, SkipTrue: skipTrue, SkipFalse: skipFalse},
+	}
+}
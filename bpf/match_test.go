@@ -0,0 +1,88 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf_test
+
+import (
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestMatchField(t *testing.T) {
+	// An Ethernet header carrying an IPv4 packet whose header has
+	// options, followed by the start of a TCP header.
+	ipv4 := []byte{
+		0x00, 0x00, 0x5e, 0x00, 0x53, 0x01, // destination
+		0x00, 0x00, 0x5e, 0x00, 0x53, 0x02, // source
+		0x08, 0x00, // EtherType
+		0x46, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00, 0x40, 0x06, 0x00, 0x00,
+		0xc0, 0x00, 0x02, 0x01, // source address
+		0xc6, 0x33, 0x64, 0x02, // destination address
+		0x01, 0x01, 0x01, 0x00, // options
+		0xd4, 0x31, 0x01, 0xbb, // TCP source and destination ports
+	}
+	ipv6 := append([]byte(nil), ipv4...)
+	ipv6[12], ipv6[13] = 0x86, 0xdd
+
+	tests := []struct {
+		name   string
+		prog   []bpf.Instruction
+		packet []byte
+		want   bool
+	}{
+		{"ethertype", bpf.MatchField16(12, 0x0800, 0, 1), ipv4, true},
+		{"ethertype mismatch", bpf.MatchField16(12, 0x0800, 0, 1), ipv6, false},
+		{"byte-swapped ethertype", bpf.MatchField16(12, 0x0008, 0, 1), ipv4, false},
+		{"address", bpf.MatchField32(30, 0xc6336402, 0, 1), ipv4, true},
+		{"address mismatch", bpf.MatchField32(30, 0xc0000201, 0, 1), ipv4, false},
+		{"inverted skips", bpf.MatchField16(12, 0x0800, 1, 0), ipv4, false},
+		{
+			"port after options",
+			append([]bpf.Instruction{bpf.LoadMemShift{Off: 14}}, bpf.MatchIndirectField16(16, 443, 0, 1)...),
+			ipv4,
+			true,
+		},
+		{
+			"ports after options",
+			append([]bpf.Instruction{bpf.LoadMemShift{Off: 14}}, bpf.MatchIndirectField32(14, 0xd43101bb, 0, 1)...),
+			ipv4,
+			true,
+		},
+		{
+			"port mismatch",
+			append([]bpf.Instruction{bpf.LoadMemShift{Off: 14}}, bpf.MatchIndirectField16(16, 0xbb01, 0, 1)...),
+			ipv4,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		prog := append(tt.prog, bpf.RetConstant{Val: 1}, bpf.RetConstant{Val: 0})
+		vm, err := bpf.NewVM(prog)
+		if err != nil {
+			t.Fatalf("%s: NewVM() = %v", tt.name, err)
+		}
+		n, err := vm.Run(tt.packet)
+		if err != nil {
+			t.Fatalf("%s: Run() = %v", tt.name, err)
+		}
+		if got := n != 0; got != tt.want {
+			t.Errorf("%s: matched = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchFieldInstructions(t *testing.T) {
+	prog, err := bpf.Assemble(bpf.MatchField16(12, 0x86dd, 2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bpf.RawInstruction{
+		{Op: 0x28, K: 12},                       // ldh [12]
+		{Op: 0x15, Jt: 2, Jf: 3, K: 0x000086dd}, // jeq #0x86dd
+	}
+	if len(prog) != len(want) || prog[0] != want[0] || prog[1] != want[1] {
+		t.Errorf("MatchField16() assembles to %#v, want %#v", prog, want)
+	}
+}
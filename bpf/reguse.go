@@ -0,0 +1,127 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A RegSet is a set of storage locations of the BPF virtual machine:
+// the A and X registers and the 16 scratch memory slots. Sets are
+// combined with the usual bitwise operators, for example
+// RegSetA|RegSetScratch(3).
+type RegSet uint32
+
+const (
+	// RegSetA is the set holding only register A.
+	RegSetA RegSet = 1 << iota
+	// RegSetX is the set holding only register X.
+	RegSetX
+
+	regSetScratchShift = iota
+)
+
+// RegSetAll is the set of all registers and scratch slots.
+const RegSetAll = RegSetA | RegSetX | (1<<16-1)<<regSetScratchShift
+
+// RegSetScratch returns the set holding only scratch slot n. It
+// returns the empty set if n is not between 0 and 15.
+func RegSetScratch(n int) RegSet {
+	if n < 0 || n > 15 {
+		return 0
+	}
+	return 1 << (regSetScratchShift + n)
+}
+
+// Contains reports whether s holds every location in t.
+func (s RegSet) Contains(t RegSet) bool {
+	return s&t == t
+}
+
+// String returns the locations in s using assembler notation, for
+// example "{A, X, M[3]}".
+func (s RegSet) String() string {
+	var names []string
+	if s.Contains(RegSetA) {
+		names = append(names, "A")
+	}
+	if s.Contains(RegSetX) {
+		names = append(names, "X")
+	}
+	for n := 0; n < 16; n++ {
+		if s.Contains(RegSetScratch(n)) {
+			names = append(names, fmt.Sprintf("M[%d]", n))
+		}
+	}
+	return "{" + strings.Join(names, ", ") + "}"
+}
+
+// registerSet returns the set holding r, or the empty set if r is not
+// a valid register.
+func registerSet(r Register) RegSet {
+	switch r {
+	case RegA:
+		return RegSetA
+	case RegX:
+		return RegSetX
+	}
+	return 0
+}
+
+// RegUse reports which registers and scratch slots ins reads and
+// which it writes, for data-flow analyses such as finding dead stores.
+// For example, LoadAbsolute writes A, ALUOpX reads A and X and writes
+// A, and StoreScratch reads its source register and writes slot N.
+// Reads of the packet are not reported.
+//
+// A RawInstruction is first decoded with Disassemble. The effect of a
+// RawInstruction that cannot be decoded, or of an Instruction type not
+// defined by this package, is unknown: RegUse conservatively reports
+// that it reads every location and writes none.
+func RegUse(ins Instruction) (reads, writes RegSet) {
+	if ri, ok := ins.(RawInstruction); ok {
+		ins = ri.Disassemble()
+	}
+	switch ins := ins.(type) {
+	case LoadConstant:
+		return 0, registerSet(ins.Dst)
+	case LoadScratch:
+		return RegSetScratch(ins.N), registerSet(ins.Dst)
+	case LoadAbsolute:
+		if ext, ok := extensionFromK(ins.Off); ok && ins.Size == 4 {
+			return RegUse(LoadExtension{Num: ext})
+		}
+		return 0, RegSetA
+	case LoadIndirect:
+		return RegSetX, RegSetA
+	case LoadMemShift:
+		return 0, RegSetX
+	case LoadExtension:
+		switch ins.Num {
+		case ExtNetlinkAttr, ExtNetlinkAttrNested:
+			// Find the attribute of type X at offset A.
+			return RegSetA | RegSetX, RegSetA
+		}
+		return 0, RegSetA
+	case StoreScratch:
+		return registerSet(ins.Src), RegSetScratch(ins.N)
+	case ALUOpConstant, NegateA:
+		return RegSetA, RegSetA
+	case ALUOpX:
+		return RegSetA | RegSetX, RegSetA
+	case Jump, RetConstant, Accept, Reject:
+		return 0, 0
+	case JumpIf, RetA:
+		return RegSetA, 0
+	case JumpIfX:
+		return RegSetA | RegSetX, 0
+	case TXA:
+		return RegSetX, RegSetA
+	case TAX:
+		return RegSetA, RegSetX
+	}
+	return RegSetAll, 0
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf_test
+
+import (
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestRegUse(t *testing.T) {
+	const (
+		A = bpf.RegSetA
+		X = bpf.RegSetX
+	)
+	m := bpf.RegSetScratch
+	tests := []struct {
+		ins           bpf.Instruction
+		reads, writes bpf.RegSet
+	}{
+		{bpf.LoadConstant{Dst: bpf.RegA, Val: 1}, 0, A},
+		{bpf.LoadConstant{Dst: bpf.RegX, Val: 1}, 0, X},
+		{bpf.LoadScratch{Dst: bpf.RegA, N: 3}, m(3), A},
+		{bpf.LoadScratch{Dst: bpf.RegX, N: 15}, m(15), X},
+		{bpf.LoadAbsolute{Off: 12, Size: 2}, 0, A},
+		{bpf.LoadIndirect{Off: 12, Size: 2}, X, A},
+		{bpf.LoadMemShift{Off: 14}, 0, X},
+		{bpf.LoadExtension{Num: bpf.ExtLen}, 0, A},
+		{bpf.LoadExtension{Num: bpf.ExtNetlinkAttr}, A | X, A},
+		{bpf.StoreScratch{Src: bpf.RegA, N: 0}, A, m(0)},
+		{bpf.StoreScratch{Src: bpf.RegX, N: 7}, X, m(7)},
+		{bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 1}, A, A},
+		{bpf.ALUOpX{Op: bpf.ALUOpAdd}, A | X, A},
+		{bpf.NegateA{}, A, A},
+		{bpf.Jump{Skip: 1}, 0, 0},
+		{bpf.JumpIf{Cond: bpf.JumpEqual, Val: 1}, A, 0},
+		{bpf.JumpIfX{Cond: bpf.JumpEqual}, A | X, 0},
+		{bpf.RetA{}, A, 0},
+		{bpf.RetConstant{Val: 1}, 0, 0},
+		{bpf.TXA{}, X, A},
+		{bpf.TAX{}, A, X},
+
+		// Raw instructions are decoded first.
+		{bpf.RawInstruction{Op: 0x07}, A, X}, // tax
+		{bpf.RawInstruction{Op: 0xffff}, bpf.RegSetAll, 0},
+		// Absolute loads in the extension region call the extension.
+		{bpf.LoadAbsolute{Off: 0xfffff00c, Size: 4}, A | X, A},
+		// Invalid scratch slots and registers are not reported.
+		{bpf.StoreScratch{Src: bpf.Register(5), N: 16}, 0, 0},
+	}
+	for _, tt := range tests {
+		reads, writes := bpf.RegUse(tt.ins)
+		if reads != tt.reads || writes != tt.writes {
+			t.Errorf("RegUse(%#v) = %v, %v; want %v, %v", tt.ins, reads, writes, tt.reads, tt.writes)
+		}
+	}
+}
+
+func TestRegSet(t *testing.T) {
+	s := bpf.RegSetA | bpf.RegSetScratch(0) | bpf.RegSetScratch(15)
+	if got, want := s.String(), "{A, M[0], M[15]}"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := bpf.RegSet(0).String(), "{}"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if !s.Contains(bpf.RegSetA | bpf.RegSetScratch(15)) {
+		t.Errorf("%v does not contain {A, M[15]}", s)
+	}
+	if s.Contains(bpf.RegSetX) {
+		t.Errorf("%v contains X", s)
+	}
+	for n := 0; n < 16; n++ {
+		if !bpf.RegSetAll.Contains(bpf.RegSetScratch(n)) {
+			t.Errorf("RegSetAll does not contain M[%d]", n)
+		}
+	}
+	if got, want := bpf.RegSetAll.String(), "{A, X, M[0], M[1], M[2], M[3], M[4], M[5], M[6], M[7], M[8], M[9], M[10], M[11], M[12], M[13], M[14], M[15]}"; got != want {
+		t.Errorf("RegSetAll.String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// rawInstructionSize is the size in bytes of an encoded
+// RawInstruction, matching the kernel's struct sock_filter.
+const rawInstructionSize = 8
+
+// UnmarshalRawInstructions decodes b as a sequence of struct
+// sock_filter records in the given byte order, as stored in memory by
+// a machine of that order. The length of b must be a multiple of 8.
+func UnmarshalRawInstructions(b []byte, order binary.ByteOrder) ([]RawInstruction, error) {
+	if len(b)%rawInstructionSize != 0 {
+		return nil, fmt.Errorf("length %d is not a multiple of %d", len(b), rawInstructionSize)
+	}
+	raw := make([]RawInstruction, 0, len(b)/rawInstructionSize)
+	for ; len(b) > 0; b = b[rawInstructionSize:] {
+		raw = append(raw, RawInstruction{
+			Op: order.Uint16(b[0:2]),
+			Jt: b[2],
+			Jf: b[3],
+			K:  order.Uint32(b[4:8]),
+		})
+	}
+	return raw, nil
+}
+
+// RoundTrip decodes b with UnmarshalRawInstructions in little-endian
+// order, disassembles each instruction and assembles it again, and
+// returns an error describing the first instruction that does not
+// survive the trip. It is intended as a fuzzing target for the
+// encoder and decoder.
+//
+// Several encodings may disassemble to the same Instruction, for
+// instance because the decoder ignores fields an instruction does
+// not use, so the reassembled instruction may legitimately differ
+// from the input. RoundTrip therefore requires only that it
+// disassembles to the same Instruction as the input did. Unrecognized
+// instructions, which pass through Disassemble unchanged, are skipped.
+func RoundTrip(b []byte) error {
+	raw, err := UnmarshalRawInstructions(b, binary.LittleEndian)
+	if err != nil {
+		return err
+	}
+	for i, ri := range raw {
+		ins := ri.Disassemble()
+		if _, ok := ins.(RawInstruction); ok {
+			continue
+		}
+		re, err := ins.Assemble()
+		if err != nil {
+			return fmt.Errorf("instruction %d: %#v disassembles to %#v, which does not assemble: %v", i, ri, ins, err)
+		}
+		if got := re.Disassemble(); got != ins {
+			return fmt.Errorf("instruction %d: %#v disassembles to %#v, which reassembles to %#v, which disassembles to %#v", i, ri, ins, re, got)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalRawInstructions(t *testing.T) {
+	b := []byte{
+		0x28, 0x00, 0x00, 0x00, 0x0c, 0x00, 0x00, 0x00, // ldh [12]
+		0x15, 0x00, 0x01, 0x02, 0x00, 0x08, 0x00, 0x00, // jeq #0x800, 1, 2
+	}
+	want := []RawInstruction{
+		{Op: 0x28, K: 12},
+		{Op: 0x15, Jt: 1, Jf: 2, K: 0x800},
+	}
+	got, err := UnmarshalRawInstructions(b, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("UnmarshalRawInstructions: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UnmarshalRawInstructions = %v, want %v", got, want)
+	}
+	if _, err := UnmarshalRawInstructions(b[:7], binary.LittleEndian); err == nil {
+		t.Errorf("UnmarshalRawInstructions of a partial record succeeded, want error")
+	}
+}
+
+// TestRoundTripAllOps runs RoundTrip on every opcode, with field
+// values chosen to reach each decoding path.
+func TestRoundTripAllOps(t *testing.T) {
+	ks := []uint32{0, 1, 15, 16, 0xff, 0xfffff000, 0xfffff004, 0xffffffff}
+	jumps := [][2]uint8{{0, 0}, {0, 1}, {1, 0}, {3, 7}}
+	b := make([]byte, 8)
+	for op := 0; op <= 0xffff; op++ {
+		for _, k := range ks {
+			for _, j := range jumps {
+				binary.LittleEndian.PutUint16(b[0:], uint16(op))
+				b[2], b[3] = j[0], j[1]
+				binary.LittleEndian.PutUint32(b[4:], k)
+				if err := RoundTrip(b); err != nil {
+					t.Fatalf("RoundTrip(%x): %v", b, err)
+				}
+			}
+		}
+	}
+}
+
+func TestRoundTripProgram(t *testing.T) {
+	raw, err := Assemble(allInstructions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b []byte
+	for _, ri := range raw {
+		var rec [8]byte
+		binary.LittleEndian.PutUint16(rec[0:], ri.Op)
+		rec[2], rec[3] = ri.Jt, ri.Jf
+		binary.LittleEndian.PutUint32(rec[4:], ri.K)
+		b = append(b, rec[:]...)
+	}
+	if err := RoundTrip(b); err != nil {
+		t.Errorf("RoundTrip: %v", err)
+	}
+	if err := RoundTrip(b[:len(b)-1]); err == nil {
+		t.Errorf("RoundTrip of a truncated program succeeded, want error")
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Seccomp filter return actions, as defined in linux/seccomp.h. A
+// seccomp filter returns one of these, combined with 16 bits of
+// action-specific data; see RetSeccomp.
+const (
+	SeccompRetKillProcess uint32 = 0x80000000 // kill the process
+	SeccompRetKillThread  uint32 = 0x00000000 // kill the thread
+	SeccompRetKill               = SeccompRetKillThread
+	SeccompRetTrap        uint32 = 0x00030000 // disallow and force a SIGSYS
+	SeccompRetErrno       uint32 = 0x00050000 // return the data as an errno
+	SeccompRetUserNotif   uint32 = 0x7fc00000 // notify a userspace supervisor
+	SeccompRetTrace       uint32 = 0x7ff00000 // pass to a tracer or disallow
+	SeccompRetLog         uint32 = 0x7ffc0000 // allow after logging
+	SeccompRetAllow       uint32 = 0x7fff0000 // allow
+
+	// SeccompRetActionFull masks the action bits of a return value.
+	SeccompRetActionFull uint32 = 0xffff0000
+	// SeccompRetData masks the data bits of a return value.
+	SeccompRetData uint32 = 0x0000ffff
+)
+
+// Offsets of the fields of struct seccomp_data, the input of a
+// seccomp filter. The fields are in the byte order of the machine
+// running the filter.
+const (
+	SeccompDataNr                 = 0  // system call number, 32 bits
+	SeccompDataArch               = 4  // AUDIT_ARCH_* value, 32 bits
+	SeccompDataInstructionPointer = 8  // 64 bits
+	SeccompDataArgs               = 16 // six system call arguments, 64 bits each
+)
+
+// RetSeccomp returns the instruction that ends a seccomp filter with
+// action, one of the SeccompRet constants, and data, such as the errno
+// returned with SeccompRetErrno.
+func RetSeccomp(action uint32, data uint16) Instruction {
+	return RetConstant{Val: action&SeccompRetActionFull | uint32(data)}
+}
+
+// LoadSeccompNr returns the instruction loading the system call
+// number of seccomp_data into register A.
+func LoadSeccompNr() Instruction {
+	return LoadAbsolute{Off: SeccompDataNr, Size: 4}
+}
+
+// LoadSeccompArch returns the instruction loading the AUDIT_ARCH_*
+// architecture of seccomp_data into register A.
+func LoadSeccompArch() Instruction {
+	return LoadAbsolute{Off: SeccompDataArch, Size: 4}
+}
+
+// LoadSeccompArg returns the instruction loading one 32-bit half of
+// system call argument n, counting from zero, into register A. BPF
+// loads are 32 bits wide, so a 64-bit argument is compared one half at
+// a time. order is the byte order of the machine running the filter,
+// which decides where each half is stored.
+//
+// LoadSeccompArg panics if n is not between 0 and 5.
+func LoadSeccompArg(n int, high bool, order binary.ByteOrder) Instruction {
+	if n < 0 || n > 5 {
+		panic(fmt.Sprintf("bpf: seccomp argument %d out of range", n))
+	}
+	off := uint32(SeccompDataArgs + 8*n)
+	if high != isBigEndian(order) {
+		off += 4
+	}
+	return LoadAbsolute{Off: off, Size: 4}
+}
+
+// isBigEndian reports whether order stores the most significant byte
+// first. It looks at what order does rather than comparing it to
+// binary.BigEndian, so that other implementations work too.
+func isBigEndian(order binary.ByteOrder) bool {
+	var b [2]byte
+	order.PutUint16(b[:], 0x0102)
+	return b[0] == 0x01
+}
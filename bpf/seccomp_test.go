@@ -0,0 +1,133 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestRetSeccomp(t *testing.T) {
+	tests := []struct {
+		action uint32
+		data   uint16
+		want   uint32
+	}{
+		{bpf.SeccompRetAllow, 0, 0x7fff0000},
+		{bpf.SeccompRetErrno, 1, 0x00050001},
+		{bpf.SeccompRetTrace, 0xffff, 0x7ff0ffff},
+		{bpf.SeccompRetKillProcess, 0, 0x80000000},
+		// Stray data bits in the action are ignored.
+		{bpf.SeccompRetErrno | 0x1234, 13, 0x0005000d},
+	}
+	for _, tt := range tests {
+		got := bpf.RetSeccomp(tt.action, tt.data)
+		if want := (bpf.RetConstant{Val: tt.want}); got != want {
+			t.Errorf("RetSeccomp(%#x, %d) = %v, want %v", tt.action, tt.data, got, want)
+		}
+	}
+}
+
+// otherByteOrder is a binary.ByteOrder other than those of the
+// encoding/binary package, behaving as the one it wraps.
+type otherByteOrder struct {
+	binary.ByteOrder
+}
+
+func TestLoadSeccompArg(t *testing.T) {
+	tests := []struct {
+		n     int
+		high  bool
+		order binary.ByteOrder
+		off   uint32
+	}{
+		{0, false, binary.LittleEndian, 16},
+		{0, true, binary.LittleEndian, 20},
+		{0, false, binary.BigEndian, 20},
+		{0, true, binary.BigEndian, 16},
+		{5, false, binary.LittleEndian, 56},
+		{5, true, binary.BigEndian, 56},
+		{1, false, otherByteOrder{binary.BigEndian}, 28},
+		{1, true, otherByteOrder{binary.BigEndian}, 24},
+		{1, true, otherByteOrder{binary.LittleEndian}, 28},
+	}
+	for _, tt := range tests {
+		got := bpf.LoadSeccompArg(tt.n, tt.high, tt.order)
+		if want := (bpf.LoadAbsolute{Off: tt.off, Size: 4}); got != want {
+			t.Errorf("LoadSeccompArg(%d, %v, %v) = %v, want %v", tt.n, tt.high, tt.order, got, want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("LoadSeccompArg(6, ...) did not panic")
+		}
+	}()
+	bpf.LoadSeccompArg(6, false, binary.LittleEndian)
+}
+
+func TestSeccompFilter(t *testing.T) {
+	const (
+		archX86_64 = 0xc000003e
+		sysWrite   = 1
+		sysOpen    = 2
+		ePerm      = 1
+	)
+	// Allow write(2) on file descriptors 1 and 2, fail open(2) with
+	// EPERM, and kill on anything else or a foreign architecture.
+	//
+	// The VM loads big-endian words, so the filter is built for a
+	// big-endian machine.
+	filter := []bpf.Instruction{
+		bpf.LoadSeccompArch(),
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: archX86_64, SkipFalse: 9},
+		bpf.LoadSeccompNr(),
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: sysOpen, SkipFalse: 1},
+		bpf.RetSeccomp(bpf.SeccompRetErrno, ePerm),
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: sysWrite, SkipFalse: 5},
+		bpf.LoadSeccompArg(0, true, binary.BigEndian),
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0, SkipFalse: 3},
+		bpf.LoadSeccompArg(0, false, binary.BigEndian),
+		bpf.JumpIf{Cond: bpf.JumpGreaterOrEqual, Val: 3, SkipTrue: 1},
+		bpf.RetSeccomp(bpf.SeccompRetAllow, 0),
+		bpf.RetSeccomp(bpf.SeccompRetKillProcess, 0),
+	}
+	vm, err := bpf.NewVM(filter)
+	if err != nil {
+		t.Fatalf("NewVM: %v", err)
+	}
+
+	data := func(arch, nr uint32, arg0 uint64) []byte {
+		b := make([]byte, bpf.SeccompDataArgs+6*8)
+		binary.BigEndian.PutUint32(b[bpf.SeccompDataNr:], nr)
+		binary.BigEndian.PutUint32(b[bpf.SeccompDataArch:], arch)
+		binary.BigEndian.PutUint64(b[bpf.SeccompDataArgs:], arg0)
+		return b
+	}
+	tests := []struct {
+		name string
+		in   []byte
+		want uint32
+	}{
+		{"write stdout", data(archX86_64, sysWrite, 1), bpf.SeccompRetAllow},
+		{"write stderr", data(archX86_64, sysWrite, 2), bpf.SeccompRetAllow},
+		{"write fd 3", data(archX86_64, sysWrite, 3), bpf.SeccompRetKillProcess},
+		{"write high fd", data(archX86_64, sysWrite, 1<<32|1), bpf.SeccompRetKillProcess},
+		{"open", data(archX86_64, sysOpen, 0), bpf.SeccompRetErrno | ePerm},
+		{"other syscall", data(archX86_64, 60, 0), bpf.SeccompRetKillProcess},
+		{"other arch", data(0x40000003, sysWrite, 1), bpf.SeccompRetKillProcess},
+	}
+	for _, tt := range tests {
+		got, err := vm.Run(tt.in)
+		if err != nil {
+			t.Fatalf("%s: Run: %v", tt.name, err)
+		}
+		if uint32(got) != tt.want {
+			t.Errorf("%s: Run = %#x, want %#x", tt.name, uint32(got), tt.want)
+		}
+	}
+}
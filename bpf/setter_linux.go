@@ -0,0 +1,42 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package bpf
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// SetFilterFD attaches filter to the socket referred to by fd using the
+// SO_ATTACH_FILTER socket option, replacing any filter already attached.
+//
+// It is useful for sockets that are not wrapped in a type implementing
+// Setter, such as raw packet sockets opened directly with socket(2).
+// On platforms other than Linux it always returns an error.
+func SetFilterFD(fd int, filter []RawInstruction) error {
+	if len(filter) == 0 {
+		return errors.New("bpf: cannot attach an empty filter")
+	}
+	if len(filter) > 0xffff {
+		return errors.New("bpf: filter too long")
+	}
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: (*unix.SockFilter)(unsafe.Pointer(&filter[0])),
+	}
+	return unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &prog)
+}
+
+// RemoveFilterFD detaches the filter attached to the socket referred to
+// by fd using the SO_DETACH_FILTER socket option.
+// On platforms other than Linux it always returns an error.
+func RemoveFilterFD(fd int) error {
+	return unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_DETACH_FILTER, 0)
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package bpf_test
+
+import (
+	"testing"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+func TestSetFilterFD(t *testing.T) {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Skipf("socket: %v", err)
+	}
+	defer unix.Close(fd)
+
+	filter, err := bpf.Assemble([]bpf.Instruction{
+		bpf.RetConstant{Val: 0},
+	})
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+	if err := bpf.SetFilterFD(fd, filter); err != nil {
+		t.Fatalf("SetFilterFD: %v", err)
+	}
+	if err := bpf.RemoveFilterFD(fd); err != nil {
+		t.Fatalf("RemoveFilterFD: %v", err)
+	}
+	// Nothing is attached any more.
+	if err := bpf.RemoveFilterFD(fd); err == nil {
+		t.Errorf("second RemoveFilterFD succeeded, want error")
+	}
+	if err := bpf.SetFilterFD(fd, nil); err == nil {
+		t.Errorf("SetFilterFD with empty filter succeeded, want error")
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package bpf
+
+import (
+	"errors"
+	"runtime"
+)
+
+var errFilterFDNotImplemented = errors.New("bpf: socket filters not implemented on " + runtime.GOOS + "/" + runtime.GOARCH)
+
+// SetFilterFD attaches filter to the socket referred to by fd using the
+// SO_ATTACH_FILTER socket option, replacing any filter already attached.
+//
+// It is useful for sockets that are not wrapped in a type implementing
+// Setter, such as raw packet sockets opened directly with socket(2).
+// On platforms other than Linux it always returns an error.
+func SetFilterFD(fd int, filter []RawInstruction) error {
+	return errFilterFDNotImplemented
+}
+
+// RemoveFilterFD detaches the filter attached to the socket referred to
+// by fd using the SO_DETACH_FILTER socket option.
+// On platforms other than Linux it always returns an error.
+func RemoveFilterFD(fd int) error {
+	return errFilterFDNotImplemented
+}
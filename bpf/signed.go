@@ -0,0 +1,40 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+// signBias maps signed 32-bit integers onto unsigned ones while
+// preserving their order: x ^ signBias, taken as unsigned, orders the
+// same way as x taken as signed.
+const signBias = 0x80000000
+
+// SignedJumpIf returns a sequence of instructions that compares A
+// with val as signed 32-bit integers and then skips SkipTrue or
+// SkipFalse instructions, like a JumpIf with the same arguments placed
+// at the end of the sequence.
+//
+// Classic BPF only has unsigned comparisons, so for every cond except
+// JumpBitsSet and JumpBitsNotSet, which do not depend on signedness,
+// the sequence is two instructions long:
+//
+//	ALUOpConstant{Op: ALUOpXor, Val: 0x80000000}
+//	JumpIf{Cond: cond, Val: uint32(val) ^ 0x80000000, ...}
+//
+// The first flips the sign bit of A, which turns signed order into
+// unsigned order. A is left modified: after the sequence it holds the
+// original A XOR 0x80000000, so reload it or flip it back with another
+// XOR before using it again. For the bit tests, SignedJumpIf returns a
+// single JumpIf and leaves A unchanged.
+func SignedJumpIf(cond JumpTest, val int32, skipTrue, skipFalse uint8) []Instruction {
+	switch cond {
+	case JumpBitsSet, JumpBitsNotSet:
+		return []Instruction{
+			JumpIf{Cond: cond, Val: uint32(val), SkipTrue: skipTrue, SkipFalse: skipFalse},
+		}
+	}
+	return []Instruction{
+		ALUOpConstant{Op: ALUOpXor, Val: signBias},
+		JumpIf{Cond: cond, Val: uint32(val) ^ signBias, SkipTrue: skipTrue, SkipFalse: skipFalse},
+	}
+}
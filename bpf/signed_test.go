@@ -0,0 +1,55 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf_test
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestSignedJumpIf(t *testing.T) {
+	conds := []struct {
+		cond bpf.JumpTest
+		fn   func(a, v int32) bool
+	}{
+		{bpf.JumpEqual, func(a, v int32) bool { return a == v }},
+		{bpf.JumpNotEqual, func(a, v int32) bool { return a != v }},
+		{bpf.JumpGreaterThan, func(a, v int32) bool { return a > v }},
+		{bpf.JumpLessThan, func(a, v int32) bool { return a < v }},
+		{bpf.JumpGreaterOrEqual, func(a, v int32) bool { return a >= v }},
+		{bpf.JumpLessOrEqual, func(a, v int32) bool { return a <= v }},
+		{bpf.JumpBitsSet, func(a, v int32) bool { return a&v != 0 }},
+		{bpf.JumpBitsNotSet, func(a, v int32) bool { return a&v == 0 }},
+	}
+	values := []int32{math.MinInt32, math.MinInt32 + 1, -2, -1, 0, 1, 2, math.MaxInt32 - 1, math.MaxInt32}
+	for _, c := range conds {
+		for _, v := range values {
+			prog := []bpf.Instruction{bpf.LoadAbsolute{Off: 0, Size: 4}}
+			prog = append(prog, bpf.SignedJumpIf(c.cond, v, 1, 0)...)
+			prog = append(prog,
+				bpf.RetConstant{Val: 1}, // false
+				bpf.RetConstant{Val: 2}, // true
+			)
+			vm, err := bpf.NewVM(prog)
+			if err != nil {
+				t.Fatalf("NewVM: %v", err)
+			}
+			for _, a := range values {
+				in := make([]byte, 4)
+				binary.BigEndian.PutUint32(in, uint32(a))
+				got, err := vm.Run(in)
+				if err != nil {
+					t.Fatalf("Run: %v", err)
+				}
+				if want := c.fn(a, v); (got == 2) != want {
+					t.Errorf("A = %d, JumpTest %d, Val = %d: got %v, want %v", a, c.cond, v, got == 2, want)
+				}
+			}
+		}
+	}
+}
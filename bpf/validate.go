@@ -0,0 +1,153 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validate checks that insts is a well-formed BPF program: it must
+// contain at least one instruction, end with RetA or RetConstant, and
+// every Jump, JumpIf and JumpIfX must land on an instruction within
+// the program. Running off the end of a program is rejected by the
+// kernel's verifier, so a program that fails Validate cannot be
+// attached to a socket.
+//
+// The returned error names the index of the offending instruction.
+func Validate(insts []Instruction) error {
+	if len(insts) == 0 {
+		return errors.New("one or more Instructions must be specified")
+	}
+	for i, ins := range insts {
+		if err := checkJump(ins, len(insts)-(i+1)); err != nil {
+			return fmt.Errorf("instruction %d (%v): %v", i, ins, err)
+		}
+	}
+	switch insts[len(insts)-1].(type) {
+	case RetA, RetConstant:
+	default:
+		return errors.New("BPF program must end with RetA or RetConstant")
+	}
+	return nil
+}
+
+// checkJump returns an error if ins is a jump that skips past the
+// remaining instructions of a program. remaining is the number of
+// instructions following ins.
+func checkJump(ins Instruction, remaining int) error {
+	switch ins := ins.(type) {
+	case Jump:
+		if remaining <= int(ins.Skip) {
+			return fmt.Errorf("cannot jump %d instructions; jumping past program bounds", ins.Skip)
+		}
+	case JumpIf:
+		return checkConditionalJump(ins.SkipTrue, ins.SkipFalse, remaining)
+	case JumpIfX:
+		return checkConditionalJump(ins.SkipTrue, ins.SkipFalse, remaining)
+	}
+	return nil
+}
+
+func checkConditionalJump(skipTrue, skipFalse uint8, remaining int) error {
+	if remaining <= int(skipTrue) {
+		return fmt.Errorf("cannot jump %d instructions in true case; jumping past program bounds", skipTrue)
+	}
+	if remaining <= int(skipFalse) {
+		return fmt.Errorf("cannot jump %d instructions in false case; jumping past program bounds", skipFalse)
+	}
+	return nil
+}
+
+// A Warning describes a suspicious, but not invalid, instruction of a
+// program.
+type Warning struct {
+	Index int    // index of the instruction in the program
+	Msg   string // description of the problem
+}
+
+// String returns the warning in the format of the errors returned by
+// Validate.
+func (w Warning) String() string {
+	return fmt.Sprintf("instruction %d: %s", w.Index, w.Msg)
+}
+
+// ValidateWithWarnings is like Validate, but additionally returns
+// warnings about instructions that are valid but probably mistaken.
+// Warnings are only reported for programs that pass Validate.
+//
+// ValidateWithWarnings currently warns about every LoadScratch that
+// can be reached along some path of the program on which its scratch
+// slot was not written by a preceding StoreScratch. The kernel
+// initializes scratch memory to zero, so such a load is allowed, but
+// it usually reveals a bug in the code that generated the program.
+// Instructions that cannot be reached are not checked.
+func ValidateWithWarnings(insts []Instruction) ([]Warning, error) {
+	if err := Validate(insts); err != nil {
+		return nil, err
+	}
+	return checkScratchReads(insts), nil
+}
+
+// checkScratchReads returns a warning for each LoadScratch in insts
+// that may read a scratch slot before it is written.
+//
+// Jumps only go forward, so a single pass in program order visits
+// every instruction after all of its predecessors. written[i] holds
+// the scratch slots written on every path reaching instruction i.
+func checkScratchReads(insts []Instruction) []Warning {
+	const scratch = RegSetAll &^ (RegSetA | RegSetX)
+	n := len(insts)
+	written := make([]RegSet, n)
+	reached := make([]bool, n)
+	reached[0] = true
+	reach := func(i int, w RegSet) {
+		if i < 0 || i >= n {
+			return
+		}
+		if reached[i] {
+			written[i] &= w
+		} else {
+			reached[i] = true
+			written[i] = w
+		}
+	}
+
+	var warnings []Warning
+	for i, ins := range insts {
+		if !reached[i] {
+			continue
+		}
+		if ri, ok := ins.(RawInstruction); ok {
+			ins = ri.Disassemble()
+		}
+		if ls, ok := ins.(LoadScratch); ok {
+			if slot := RegSetScratch(ls.N); !written[i].Contains(slot) {
+				warnings = append(warnings, Warning{
+					Index: i,
+					Msg:   fmt.Sprintf("scratch slot %d may be read before it is written", ls.N),
+				})
+			}
+		}
+		_, writes := RegUse(ins)
+		out := written[i] | writes&scratch
+		switch ins := ins.(type) {
+		case Jump:
+			reach(i+1+int(ins.Skip), out)
+		case JumpIf:
+			reach(i+1+int(ins.SkipTrue), out)
+			reach(i+1+int(ins.SkipFalse), out)
+		case JumpIfX:
+			reach(i+1+int(ins.SkipTrue), out)
+			reach(i+1+int(ins.SkipFalse), out)
+		case RetA, RetConstant, Accept, Reject:
+			// The program exits; nothing after it is reached
+			// along this path.
+		default:
+			reach(i+1, out)
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,204 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		insts []bpf.Instruction
+		err   string
+	}{
+		{
+			name: "ok",
+			insts: []bpf.Instruction{
+				bpf.LoadAbsolute{Off: 12, Size: 2},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0806, SkipTrue: 1},
+				bpf.RetConstant{Val: 0},
+				bpf.RetConstant{Val: 4096},
+			},
+			err: "<nil>",
+		},
+		{
+			name: "empty",
+			err:  "one or more Instructions must be specified",
+		},
+		{
+			name: "no return",
+			insts: []bpf.Instruction{
+				bpf.LoadConstant{Dst: bpf.RegA, Val: 1},
+			},
+			err: "BPF program must end with RetA or RetConstant",
+		},
+		{
+			name: "JumpIf true past end",
+			insts: []bpf.Instruction{
+				bpf.LoadAbsolute{Off: 12, Size: 2},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0806, SkipTrue: 2},
+				bpf.RetConstant{Val: 0},
+				bpf.RetConstant{Val: 4096},
+			},
+			err: "instruction 1 (jeq #2054,2): cannot jump 2 instructions in true case; jumping past program bounds",
+		},
+		{
+			name: "JumpIf false past end",
+			insts: []bpf.Instruction{
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 1, SkipFalse: 1},
+				bpf.RetA{},
+			},
+			err: "instruction 0 (jneq #1,1): cannot jump 1 instructions in false case; jumping past program bounds",
+		},
+		{
+			name: "JumpIfX past end",
+			insts: []bpf.Instruction{
+				bpf.JumpIfX{Cond: bpf.JumpGreaterThan, SkipTrue: 1, SkipFalse: 5},
+				bpf.RetA{},
+				bpf.RetA{},
+			},
+			err: "instruction 0 (jgt x,1,5): cannot jump 5 instructions in false case; jumping past program bounds",
+		},
+		{
+			name: "Jump past end",
+			insts: []bpf.Instruction{
+				bpf.LoadConstant{Dst: bpf.RegA, Val: 1},
+				bpf.Jump{Skip: 1},
+				bpf.RetA{},
+			},
+			err: "instruction 1 (ja 1): cannot jump 1 instructions; jumping past program bounds",
+		},
+		{
+			name: "Jump onto last instruction",
+			insts: []bpf.Instruction{
+				bpf.Jump{Skip: 1},
+				bpf.RetConstant{Val: 0},
+				bpf.RetA{},
+			},
+			err: "<nil>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errStr(bpf.Validate(tt.insts)); got != tt.err {
+				t.Errorf("Validate() = %q, want %q", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateWithWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		insts    []bpf.Instruction
+		warnings []bpf.Warning
+	}{
+		{
+			name: "written before read",
+			insts: []bpf.Instruction{
+				bpf.StoreScratch{Src: bpf.RegA, N: 2},
+				bpf.LoadScratch{Dst: bpf.RegX, N: 2},
+				bpf.RetA{},
+			},
+		},
+		{
+			name: "never written",
+			insts: []bpf.Instruction{
+				bpf.StoreScratch{Src: bpf.RegA, N: 1},
+				bpf.LoadScratch{Dst: bpf.RegA, N: 2},
+				bpf.RetA{},
+			},
+			warnings: []bpf.Warning{{Index: 1, Msg: "scratch slot 2 may be read before it is written"}},
+		},
+		{
+			name: "written on one path only",
+			insts: []bpf.Instruction{
+				bpf.LoadAbsolute{Off: 12, Size: 2},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x800, SkipFalse: 1},
+				bpf.StoreScratch{Src: bpf.RegA, N: 0},
+				bpf.LoadScratch{Dst: bpf.RegA, N: 0},
+				bpf.RetA{},
+			},
+			warnings: []bpf.Warning{{Index: 3, Msg: "scratch slot 0 may be read before it is written"}},
+		},
+		{
+			name: "written on both paths",
+			insts: []bpf.Instruction{
+				bpf.LoadAbsolute{Off: 12, Size: 2},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x800, SkipFalse: 2},
+				bpf.StoreScratch{Src: bpf.RegA, N: 0},
+				bpf.Jump{Skip: 1},
+				bpf.StoreScratch{Src: bpf.RegX, N: 0},
+				bpf.LoadScratch{Dst: bpf.RegA, N: 0},
+				bpf.RetA{},
+			},
+		},
+		{
+			name: "raw instructions",
+			insts: []bpf.Instruction{
+				bpf.RawInstruction{Op: 0x02, K: 5}, // st M[5]
+				bpf.RawInstruction{Op: 0x61, K: 5}, // ldx M[5]
+				bpf.RawInstruction{Op: 0x60, K: 6}, // ld M[6]
+				bpf.RetA{},
+			},
+			warnings: []bpf.Warning{{Index: 2, Msg: "scratch slot 6 may be read before it is written"}},
+		},
+		{
+			name: "unreachable",
+			insts: []bpf.Instruction{
+				bpf.RetConstant{Val: 0},
+				bpf.LoadScratch{Dst: bpf.RegA, N: 0},
+				bpf.RetA{},
+			},
+		},
+		{
+			name: "read only after return",
+			insts: []bpf.Instruction{
+				bpf.LoadAbsolute{Off: 12, Size: 2},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x800, SkipFalse: 2},
+				bpf.StoreScratch{Src: bpf.RegA, N: 0},
+				bpf.Jump{Skip: 1},
+				bpf.RawInstruction{Op: 0x16}, // ret a
+				bpf.LoadScratch{Dst: bpf.RegA, N: 0},
+				bpf.RetA{},
+			},
+		},
+		{
+			name: "read only after reject",
+			insts: []bpf.Instruction{
+				bpf.LoadAbsolute{Off: 12, Size: 2},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x800, SkipTrue: 1},
+				bpf.Reject{},
+				bpf.StoreScratch{Src: bpf.RegA, N: 0},
+				bpf.Accept{Val: 0xffff},
+				bpf.LoadScratch{Dst: bpf.RegA, N: 1},
+				bpf.RetA{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := bpf.ValidateWithWarnings(tt.insts)
+			if err != nil {
+				t.Fatalf("ValidateWithWarnings() = %v", err)
+			}
+			if !reflect.DeepEqual(warnings, tt.warnings) {
+				t.Errorf("ValidateWithWarnings() = %v, want %v", warnings, tt.warnings)
+			}
+		})
+	}
+
+	if _, err := bpf.ValidateWithWarnings(nil); err == nil {
+		t.Errorf("ValidateWithWarnings(nil) succeeded, want error")
+	}
+	w := bpf.Warning{Index: 3, Msg: "scratch slot 0 may be read before it is written"}
+	if got, want := w.String(), "instruction 3: scratch slot 0 may be read before it is written"; got != want {
+		t.Errorf("Warning.String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf
+
+// EtherTypes of the VLAN tags recognized by LoadVLANOffset.
+const (
+	etherTypeVLAN     = 0x8100 // IEEE 802.1Q
+	etherTypeVLANQinQ = 0x88a8 // IEEE 802.1ad service tag
+)
+
+// LoadVLANOffset returns instructions that set register X to the size
+// of the VLAN tags in an Ethernet frame: 0 for an untagged frame, 4
+// for a frame with an IEEE 802.1Q (0x8100) or 802.1ad (0x88a8) tag,
+// and 8 for a frame with an 802.1ad or 802.1Q tag followed by an
+// 802.1Q tag ("Q-in-Q"). Indirect loads relative to the untagged
+// layout then find the same fields in tagged frames: for example,
+// LoadIndirect{Off: 12, Size: 2} loads the inner EtherType, and
+// LoadIndirect{Off: 14 + 9, Size: 1} the protocol of an IPv4 packet.
+// The instructions overwrite register A. Like any load, they reject
+// the packet if it is too short to hold the EtherTypes they read.
+//
+// Only tags that are present in the packet data are counted. On
+// Linux, a tag is often stripped from the data by the network card or
+// the kernel, and reported by the ExtVLANTagPresent and ExtVLANTag
+// extensions instead; the data then has the untagged layout, and X
+// counts only the tags that remain, as is needed to find the fields
+// that follow them.
+func LoadVLANOffset() []Instruction {
+	return []Instruction{
+		LoadAbsolute{Off: 12, Size: 2},
+		JumpIf{Cond: JumpEqual, Val: etherTypeVLAN, SkipTrue: 3},
+		JumpIf{Cond: JumpEqual, Val: etherTypeVLANQinQ, SkipTrue: 2},
+		// Untagged.
+		LoadConstant{Dst: RegX, Val: 0},
+		Jump{Skip: 5},
+		// Tagged: look for a second tag.
+		LoadAbsolute{Off: 16, Size: 2},
+		JumpIf{Cond: JumpEqual, Val: etherTypeVLAN, SkipFalse: 2},
+		LoadConstant{Dst: RegX, Val: 8},
+		Jump{Skip: 1},
+		LoadConstant{Dst: RegX, Val: 4},
+	}
+}
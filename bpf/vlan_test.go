@@ -0,0 +1,74 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bpf_test
+
+import (
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestLoadVLANOffset(t *testing.T) {
+	// The filter accepts IPv4 packets carrying UDP, tagged or not, and
+	// returns the offset of their IPv4 header.
+	filter := append(bpf.LoadVLANOffset(),
+		bpf.LoadIndirect{Off: 12, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0800, SkipFalse: 5},
+		bpf.LoadIndirect{Off: 14 + 9, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 17, SkipFalse: 3},
+		bpf.TXA{},
+		bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 14},
+		bpf.RetA{},
+		bpf.RetConstant{Val: 0},
+	)
+	vm, err := bpf.NewVM(filter)
+	if err != nil {
+		t.Fatalf("failed to load BPF program: %v", err)
+	}
+
+	macs := []byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+	}
+	ipv4 := func(proto byte) []byte {
+		h := make([]byte, 20)
+		h[0] = 0x45
+		h[9] = proto
+		return h
+	}
+	frame := func(tags []byte, etherType uint16, payload []byte) []byte {
+		f := append(append([]byte{}, macs...), tags...)
+		f = append(f, byte(etherType>>8), byte(etherType))
+		return append(f, payload...)
+	}
+	tag := func(tpid uint16, vid byte) []byte {
+		return []byte{byte(tpid >> 8), byte(tpid), 0x00, vid}
+	}
+
+	tests := []struct {
+		name string
+		in   []byte
+		want int
+	}{
+		{"untagged UDP", frame(nil, 0x0800, ipv4(17)), 14},
+		{"802.1Q UDP", frame(tag(0x8100, 10), 0x0800, ipv4(17)), 18},
+		{"802.1ad UDP", frame(tag(0x88a8, 10), 0x0800, ipv4(17)), 18},
+		{"Q-in-Q UDP", frame(append(tag(0x88a8, 10), tag(0x8100, 20)...), 0x0800, ipv4(17)), 22},
+		{"untagged TCP", frame(nil, 0x0800, ipv4(6)), 0},
+		{"802.1Q TCP", frame(tag(0x8100, 10), 0x0800, ipv4(6)), 0},
+		{"802.1Q ARP", frame(tag(0x8100, 10), 0x0806, make([]byte, 28)), 0},
+		{"untagged ARP", frame(nil, 0x0806, make([]byte, 28)), 0},
+		{"truncated tag", append(append([]byte{}, macs...), 0x81, 0x00, 0x00), 0},
+	}
+	for _, tt := range tests {
+		got, err := vm.Run(tt.in)
+		if err != nil {
+			t.Fatalf("%s: unexpected error while running program: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: Run = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -21,27 +21,11 @@ func NewVM(filter []Instruction) (*VM, error) {
 	}
 
 	for i, ins := range filter {
-		check := len(filter) - (i + 1)
-		switch ins := ins.(type) {
 		// Check for out-of-bounds jumps in instructions
-		case Jump:
-			if check <= int(ins.Skip) {
-				return nil, fmt.Errorf("cannot jump %d instructions; jumping past program bounds", ins.Skip)
-			}
-		case JumpIf:
-			if check <= int(ins.SkipTrue) {
-				return nil, fmt.Errorf("cannot jump %d instructions in true case; jumping past program bounds", ins.SkipTrue)
-			}
-			if check <= int(ins.SkipFalse) {
-				return nil, fmt.Errorf("cannot jump %d instructions in false case; jumping past program bounds", ins.SkipFalse)
-			}
-		case JumpIfX:
-			if check <= int(ins.SkipTrue) {
-				return nil, fmt.Errorf("cannot jump %d instructions in true case; jumping past program bounds", ins.SkipTrue)
-			}
-			if check <= int(ins.SkipFalse) {
-				return nil, fmt.Errorf("cannot jump %d instructions in false case; jumping past program bounds", ins.SkipFalse)
-			}
+		if err := checkJump(ins, len(filter)-(i+1)); err != nil {
+			return nil, err
+		}
+		switch ins := ins.(type) {
 		// Check for division or modulus by zero
 		case ALUOpConstant:
 			if ins.Val != 0 {
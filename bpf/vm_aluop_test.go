@@ -335,6 +335,55 @@ func TestVMALUOpShiftRight(t *testing.T) {
 	}
 }
 
+func TestVMALUOpShiftX(t *testing.T) {
+	// The output includes the 8 byte UDP header, so shift into values
+	// large enough to tell apart.
+	tests := []struct {
+		name string
+		op   bpf.ALUOp
+		in   byte
+		want int
+	}{
+		{"left", bpf.ALUOpShiftLeft, 0x20, 0x40 - 8},
+		{"right", bpf.ALUOpShiftRight, 0x80, 0x40 - 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm, done, err := testVM(t, []bpf.Instruction{
+				bpf.LoadAbsolute{
+					Off:  8,
+					Size: 1,
+				},
+				// Shift amounts are masked to 5 bits, so this
+				// shifts by 1.
+				bpf.LoadConstant{
+					Dst: bpf.RegX,
+					Val: 33,
+				},
+				bpf.ALUOpX{
+					Op: tt.op,
+				},
+				bpf.RetA{},
+			})
+			if err != nil {
+				t.Fatalf("failed to load BPF program: %v", err)
+			}
+			defer done()
+
+			in := make([]byte, 0x100)
+			in[8] = tt.in
+			out, err := vm.Run(in)
+			if err != nil {
+				t.Fatalf("unexpected error while running program: %v", err)
+			}
+			if want, got := tt.want, out; want != got {
+				t.Fatalf("unexpected number of output bytes:\n- want: %d\n-  got: %d",
+					want, got)
+			}
+		})
+	}
+}
+
 func TestVMALUOpMod(t *testing.T) {
 	vm, done, err := testVM(t, []bpf.Instruction{
 		bpf.LoadAbsolute{
@@ -23,6 +23,12 @@ func aluOpX(ins ALUOpX, regA uint32, regX uint32) (uint32, bool) {
 		}
 	}
 
+	// Shifting by X uses only its low 5 bits, as the OS BPF VM does
+	switch ins.Op {
+	case ALUOpShiftLeft, ALUOpShiftRight:
+		regX &= 31
+	}
+
 	return aluOpCommon(ins.Op, regA, regX), true
 }
 
@@ -79,7 +79,7 @@ func TestVMLoadAbsoluteBadInstructionSize(t *testing.T) {
 		},
 		bpf.RetA{},
 	})
-	if errStr(err) != "assembling instruction 1: invalid load byte length 0" {
+	if errStr(err) != "assembling instruction 1: invalid load byte length 5" {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
@@ -23,16 +23,27 @@ type Type uint16
 
 const (
 	// ResourceHeader.Type and Question.Type
-	TypeA     Type = 1
-	TypeNS    Type = 2
-	TypeCNAME Type = 5
-	TypeSOA   Type = 6
-	TypePTR   Type = 12
-	TypeMX    Type = 15
-	TypeTXT   Type = 16
-	TypeAAAA  Type = 28
-	TypeSRV   Type = 33
-	TypeOPT   Type = 41
+	TypeA        Type = 1
+	TypeNS       Type = 2
+	TypeCNAME    Type = 5
+	TypeSOA      Type = 6
+	TypePTR      Type = 12
+	TypeMX       Type = 15
+	TypeTXT      Type = 16
+	TypeRP       Type = 17
+	TypeAFSDB    Type = 18
+	TypeAAAA     Type = 28
+	TypeSRV      Type = 33
+	TypeOPT      Type = 41
+	TypeAPL      Type = 42
+	TypeIPSECKEY Type = 45
+	TypeHIP      Type = 55
+	TypeCSYNC    Type = 62
+	TypeZONEMD   Type = 63
+
+	// Legacy DNSSEC types, superseded by RRSIG and DNSKEY.
+	TypeSIG Type = 24
+	TypeKEY Type = 25
 
 	// Question.Type
 	TypeWKS   Type = 11
@@ -43,21 +54,30 @@ const (
 )
 
 var typeNames = map[Type]string{
-	TypeA:     "TypeA",
-	TypeNS:    "TypeNS",
-	TypeCNAME: "TypeCNAME",
-	TypeSOA:   "TypeSOA",
-	TypePTR:   "TypePTR",
-	TypeMX:    "TypeMX",
-	TypeTXT:   "TypeTXT",
-	TypeAAAA:  "TypeAAAA",
-	TypeSRV:   "TypeSRV",
-	TypeOPT:   "TypeOPT",
-	TypeWKS:   "TypeWKS",
-	TypeHINFO: "TypeHINFO",
-	TypeMINFO: "TypeMINFO",
-	TypeAXFR:  "TypeAXFR",
-	TypeALL:   "TypeALL",
+	TypeA:        "TypeA",
+	TypeNS:       "TypeNS",
+	TypeCNAME:    "TypeCNAME",
+	TypeSOA:      "TypeSOA",
+	TypePTR:      "TypePTR",
+	TypeMX:       "TypeMX",
+	TypeTXT:      "TypeTXT",
+	TypeRP:       "TypeRP",
+	TypeAFSDB:    "TypeAFSDB",
+	TypeAAAA:     "TypeAAAA",
+	TypeSRV:      "TypeSRV",
+	TypeOPT:      "TypeOPT",
+	TypeAPL:      "TypeAPL",
+	TypeIPSECKEY: "TypeIPSECKEY",
+	TypeHIP:      "TypeHIP",
+	TypeCSYNC:    "TypeCSYNC",
+	TypeZONEMD:   "TypeZONEMD",
+	TypeSIG:      "TypeSIG",
+	TypeKEY:      "TypeKEY",
+	TypeWKS:      "TypeWKS",
+	TypeHINFO:    "TypeHINFO",
+	TypeMINFO:    "TypeMINFO",
+	TypeAXFR:     "TypeAXFR",
+	TypeALL:      "TypeALL",
 }
 
 // String implements fmt.Stringer.String.
@@ -76,6 +96,15 @@ func (t Type) GoString() string {
 	return printUint16(uint16(t))
 }
 
+// mnemonic returns the presentation format of t, as used in zone files,
+// falling back to the generic form of RFC 3597, section 5.
+func (t Type) mnemonic() string {
+	if n, ok := typeNames[t]; ok {
+		return n[len("Type"):]
+	}
+	return "TYPE" + printUint16(uint16(t))
+}
+
 // A Class is a type of network.
 type Class uint16
 
@@ -86,8 +115,10 @@ const (
 	ClassCHAOS  Class = 3
 	ClassHESIOD Class = 4
 
-	// Question.Class
-	ClassANY Class = 255
+	// Question.Class, and ResourceHeader.Class in dynamic updates
+	// (RFC 2136)
+	ClassNONE Class = 254
+	ClassANY  Class = 255
 )
 
 var classNames = map[Class]string{
@@ -95,6 +126,7 @@ var classNames = map[Class]string{
 	ClassCSNET:  "ClassCSNET",
 	ClassCHAOS:  "ClassCHAOS",
 	ClassHESIOD: "ClassHESIOD",
+	ClassNONE:   "ClassNONE",
 	ClassANY:    "ClassANY",
 }
 
@@ -114,6 +146,39 @@ func (c Class) GoString() string {
 	return printUint16(uint16(c))
 }
 
+var classMnemonics = map[Class]string{
+	ClassINET:   "IN",
+	ClassCSNET:  "CS",
+	ClassCHAOS:  "CH",
+	ClassHESIOD: "HS",
+	ClassNONE:   "NONE",
+	ClassANY:    "ANY",
+}
+
+// mnemonic returns the presentation format of c, as used in zone files,
+// falling back to the generic form of RFC 3597, section 5.
+func (c Class) mnemonic() string {
+	if n, ok := classMnemonics[c]; ok {
+		return n
+	}
+	return "CLASS" + printUint16(uint16(c))
+}
+
+// Known reports whether c is one of the classes defined by this
+// package.
+func (c Class) Known() bool {
+	_, ok := classNames[c]
+	return ok
+}
+
+// IsMeta reports whether c is a query class, NONE or ANY, that does
+// not name a network. Such classes are only valid in questions, and in
+// the prerequisite and update sections of dynamic updates (RFC 2136);
+// records stored in a zone never have them.
+func (c Class) IsMeta() bool {
+	return c == ClassNONE || c == ClassANY
+}
+
 // An OpCode is a DNS operation code.
 type OpCode uint16
 
@@ -122,6 +187,22 @@ func (o OpCode) GoString() string {
 	return printUint16(uint16(o))
 }
 
+var opCodeMnemonics = map[OpCode]string{
+	0: "QUERY",
+	1: "IQUERY",
+	2: "STATUS",
+	4: "NOTIFY",
+	5: "UPDATE",
+}
+
+// mnemonic returns the name used for o by tools such as dig.
+func (o OpCode) mnemonic() string {
+	if n, ok := opCodeMnemonics[o]; ok {
+		return n
+	}
+	return "OPCODE" + printUint16(uint16(o))
+}
+
 // An RCode is a DNS response status code.
 type RCode uint16
 
@@ -160,6 +241,23 @@ func (r RCode) GoString() string {
 	return printUint16(uint16(r))
 }
 
+var rCodeMnemonics = map[RCode]string{
+	RCodeSuccess:        "NOERROR",
+	RCodeFormatError:    "FORMERR",
+	RCodeServerFailure:  "SERVFAIL",
+	RCodeNameError:      "NXDOMAIN",
+	RCodeNotImplemented: "NOTIMP",
+	RCodeRefused:        "REFUSED",
+}
+
+// mnemonic returns the name used for r by tools such as dig.
+func (r RCode) mnemonic() string {
+	if n, ok := rCodeMnemonics[r]; ok {
+		return n
+	}
+	return "RCODE" + printUint16(uint16(r))
+}
+
 func printPaddedUint8(i uint8) string {
 	b := byte(i)
 	return string([]byte{
@@ -245,6 +343,166 @@ func printBool(b bool) string {
 	return "false"
 }
 
+func printHex(b []byte) string {
+	buf := make([]byte, 0, 2*len(b))
+	for _, c := range b {
+		buf = append(buf, hexDigits[c>>4], hexDigits[c&0xf])
+	}
+	return string(buf)
+}
+
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// printBase64 returns b in padded standard base64, as used for keys
+// and signatures in presentation format.
+func printBase64(b []byte) string {
+	buf := make([]byte, 0, (len(b)+2)/3*4)
+	for ; len(b) >= 3; b = b[3:] {
+		v := uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		buf = append(buf, base64Digits[v>>18&0x3f], base64Digits[v>>12&0x3f], base64Digits[v>>6&0x3f], base64Digits[v&0x3f])
+	}
+	switch len(b) {
+	case 1:
+		v := uint(b[0]) << 16
+		buf = append(buf, base64Digits[v>>18&0x3f], base64Digits[v>>12&0x3f], '=', '=')
+	case 2:
+		v := uint(b[0])<<16 | uint(b[1])<<8
+		buf = append(buf, base64Digits[v>>18&0x3f], base64Digits[v>>12&0x3f], base64Digits[v>>6&0x3f], '=')
+	}
+	return string(buf)
+}
+
+// printTimestamp returns a DNSSEC signature timestamp, in seconds since
+// the Unix epoch, in the YYYYMMDDHHmmSS presentation format of RFC 4034,
+// section 3.2.
+func printTimestamp(t uint32) string {
+	days, secs := int(t/86400), int(t%86400)
+
+	// Convert the days since 1970-01-01 to a date of the proleptic
+	// Gregorian calendar, counting years from March so that leap days
+	// end them. See http://howardhinnant.github.io/date_algorithms.html.
+	z := days + 719468 // days since 0000-03-01
+	era := z / 146097
+	doe := z - era*146097                                  // [0, 146096]
+	yoe := (doe - doe/1460 + doe/36524 - doe/146096) / 365 // [0, 399]
+	doy := doe - (365*yoe + yoe/4 - yoe/100)               // [0, 365]
+	mp := (5*doy + 2) / 153                                // [0, 11], from March
+	year := yoe + era*400
+	day := doy - (153*mp+2)/5 + 1
+	month := mp + 3
+	if month > 12 {
+		month -= 12
+		year++
+	}
+
+	buf := make([]byte, 0, 14)
+	buf = appendPaddedInt(buf, year, 4)
+	buf = appendPaddedInt(buf, month, 2)
+	buf = appendPaddedInt(buf, day, 2)
+	buf = appendPaddedInt(buf, secs/3600, 2)
+	buf = appendPaddedInt(buf, secs/60%60, 2)
+	buf = appendPaddedInt(buf, secs%60, 2)
+	return string(buf)
+}
+
+// appendPaddedInt appends the decimal digits of v, which must not be
+// negative, to buf, with leading zeros up to width digits.
+func appendPaddedInt(buf []byte, v, width int) []byte {
+	var digits [20]byte
+	i := len(digits)
+	for v > 0 || i > len(digits)-width {
+		i--
+		digits[i] = byte(v%10) + '0'
+		v /= 10
+	}
+	return append(buf, digits[i:]...)
+}
+
+func printIPv4(a []byte) string {
+	buf := make([]byte, 0, 15)
+	for i, b := range a {
+		if i > 0 {
+			buf = append(buf, '.')
+		}
+		buf = printUint8Bytes(buf, b)
+	}
+	return string(buf)
+}
+
+// printIPv6 returns the textual representation of a recommended by RFC 5952.
+func printIPv6(a [16]byte) string {
+	// IPv4-mapped addresses are printed with a dotted-quad suffix.
+	if a[10] == 0xff && a[11] == 0xff && string(a[:10]) == string(make([]byte, 10)) {
+		return "::ffff:" + printIPv4(a[12:])
+	}
+
+	// Find the longest run of (at least two) zero groups.
+	e0, e1 := -1, -1
+	for i := 0; i < 16; i += 2 {
+		j := i
+		for j < 16 && a[j] == 0 && a[j+1] == 0 {
+			j += 2
+		}
+		if j-i > 2 && j-i > e1-e0 {
+			e0, e1 = i, j
+			i = j
+		}
+	}
+
+	buf := make([]byte, 0, 39)
+	for i := 0; i < 16; i += 2 {
+		if i == e0 {
+			buf = append(buf, ':', ':')
+			i = e1
+			if i >= 16 {
+				break
+			}
+		} else if i > 0 {
+			buf = append(buf, ':')
+		}
+		v := uint16(a[i])<<8 | uint16(a[i+1])
+		started := false
+		for shift := 12; shift >= 0; shift -= 4 {
+			d := (v >> uint(shift)) & 0xf
+			if d != 0 || started || shift == 0 {
+				buf = append(buf, hexDigits[d])
+				started = true
+			}
+		}
+	}
+	return string(buf)
+}
+
+// printCharacterString returns s as a quoted character-string in the
+// presentation format of RFC 1035, section 5.1.
+func printCharacterString(s string) string {
+	buf := make([]byte, 0, len(s)+2)
+	buf = append(buf, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c < ' ' || c > '~':
+			buf = append(buf, '\\')
+			buf = append(buf, printPaddedUint8(c)...)
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return string(append(buf, '"'))
+}
+
+// printUnknownRData returns data in the generic presentation format
+// for resource data described by RFC 3597, section 5.
+func printUnknownRData(data []byte) string {
+	s := `\# ` + printUint16(uint16(len(data)))
+	if len(data) > 0 {
+		s += " " + printHex(data)
+	}
+	return s
+}
+
 var (
 	// ErrNotStarted indicates that the prerequisite information isn't
 	// available yet because the previous records haven't been appropriately
@@ -255,6 +513,37 @@ var (
 	// parsed or finished.
 	ErrSectionDone = errors.New("parsing/packing of this section has completed")
 
+	// ErrIDMismatch indicates that a response's ID differs from the ID of
+	// the query it was matched against.
+	ErrIDMismatch = errors.New("response ID does not match query ID")
+
+	// ErrNotResponse indicates that a message matched against a query
+	// does not have the QR (response) bit set.
+	ErrNotResponse = errors.New("message is not a response")
+
+	// ErrQuestionMismatch indicates that a response's Questions differ
+	// from the Questions of the query it was matched against.
+	ErrQuestionMismatch = errors.New("response question does not match query question")
+
+	// ErrTrailingData indicates that a message has data after the end
+	// of its last section. It is only reported by Parsers configured
+	// with SetRejectTrailingData.
+	ErrTrailingData = errors.New("message has data after its last section")
+
+	// ErrCompressedRData indicates that a name in the resource data of
+	// a record is compressed although its type does not allow it. It
+	// is always reported for SRV records, and for the other types not
+	// defined in RFC 1035 by Parsers configured with
+	// SetStrictCompression. It is wrapped in the error returned, so
+	// use errors.Is to check for it.
+	ErrCompressedRData = errors.New("compressed name in resource data")
+
+	// ErrPointerOutOfRange indicates that a compression pointer in a
+	// name points past the end of the message, as in truncated or
+	// malicious messages. The error returned, which wraps it, gives
+	// the offset pointed to; use errors.Is to check for it.
+	ErrPointerOutOfRange = errors.New("compression pointer out of range")
+
 	errBaseLen            = errors.New("insufficient data for base length type")
 	errCalcLen            = errors.New("insufficient data for calculated length type")
 	errReserved           = errors.New("segment prefix is reserved")
@@ -269,9 +558,15 @@ var (
 	errTooManyAnswers     = errors.New("too many Answers to pack (>65535)")
 	errTooManyAuthorities = errors.New("too many Authorities to pack (>65535)")
 	errTooManyAdditionals = errors.New("too many Additionals to pack (>65535)")
+	errNoSIG0             = errors.New("message does not end with a SIG(0) record")
 	errNonCanonicalName   = errors.New("name is not in canonical format (it must end with a .)")
 	errStringTooLong      = errors.New("character string exceeds maximum length (255)")
-	errCompressedSRV      = errors.New("compressed name in SRV resource data")
+	errTypeBitmap         = errors.New("invalid type bitmap")
+	errAPLDataTooLong     = errors.New("APL address family data exceeds maximum length (127)")
+	errHITTooLong         = errors.New("HIP host identity tag exceeds maximum length (255)")
+	errHIPKeyTooLong      = errors.New("HIP public key exceeds maximum length (65535)")
+	errZONEMDDigestLen    = errors.New("ZONEMD digest length does not match hash algorithm")
+	errIPSECKEYGateway    = errors.New("unknown IPSECKEY gateway type")
 )
 
 // Internal constants.
@@ -308,6 +603,11 @@ func (e *nestedError) Error() string {
 	return e.s + ": " + e.err.Error()
 }
 
+// Unwrap returns the nested error.
+func (e *nestedError) Unwrap() error {
+	return e.err
+}
+
 // Header is a representation of a DNS message header.
 type Header struct {
 	ID                 uint16
@@ -387,6 +687,7 @@ const (
 	headerBitTC = 1 << 9  // truncated
 	headerBitRD = 1 << 8  // recursion desired
 	headerBitRA = 1 << 7  // recursion available
+	headerBitZ  = 1 << 6  // reserved, must be zero
 	headerBitAD = 1 << 5  // authentic data
 	headerBitCD = 1 << 4  // checking disabled
 )
@@ -485,6 +786,19 @@ func (r *Resource) GoString() string {
 		"}"
 }
 
+// String returns r in presentation format, as used in zone files and by
+// tools such as dig.
+func (r *Resource) String() string {
+	s := r.Header.Name.String() + "\t" +
+		printUint32(r.Header.TTL) + "\t" +
+		r.Header.Class.mnemonic() + "\t" +
+		r.Header.Type.mnemonic()
+	if r.Body != nil {
+		s += "\t" + r.Body.String()
+	}
+	return s
+}
+
 // A ResourceBody is a DNS resource record minus the header.
 type ResourceBody interface {
 	// pack packs a Resource except for its header.
@@ -496,6 +810,10 @@ type ResourceBody interface {
 
 	// GoString implements fmt.GoStringer.GoString.
 	GoString() string
+
+	// String returns the resource data in presentation format, as used
+	// in zone files and by tools such as dig.
+	String() string
 }
 
 // pack appends the wire format of the Resource to msg.
@@ -541,12 +859,18 @@ type Parser struct {
 	index          int
 	resHeaderValid bool
 	resHeader      ResourceHeader
+
+	rejectTrailingData bool
+	strictCompression  bool
 }
 
 // Start parses the header and enables the parsing of Questions.
 func (p *Parser) Start(msg []byte) (Header, error) {
 	if p.msg != nil {
-		*p = Parser{}
+		*p = Parser{
+			rejectTrailingData: p.rejectTrailingData,
+			strictCompression:  p.strictCompression,
+		}
 	}
 	p.msg = msg
 	var err error
@@ -557,6 +881,57 @@ func (p *Parser) Start(msg []byte) (Header, error) {
 	return p.header.header(), nil
 }
 
+// ReservedZ reports whether the reserved Z bit of the header of the
+// message being parsed is set.
+//
+// RFC 1035 requires the Z bit to be zero in all queries and responses,
+// and Header ignores it, but it is preserved here so that received
+// messages can be checked for conformance. It returns false if Start
+// has not been called.
+func (p *Parser) ReservedZ() bool {
+	return p.header.bits&headerBitZ != 0
+}
+
+// SetRejectTrailingData sets whether the Parser rejects messages with
+// data after the end of their last section.
+//
+// By default, such data, which some middleboxes append to valid
+// messages, is ignored, and is available from TrailingData. If reject
+// is true and data remains, the methods that would report the end of
+// the Additionals section with ErrSectionDone return ErrTrailingData
+// instead, as do AllAdditionals and SkipAllAdditionals. The setting
+// applies to every message parsed, including those passed to later
+// calls to Start.
+func (p *Parser) SetRejectTrailingData(reject bool) {
+	p.rejectTrailingData = reject
+}
+
+// TrailingData returns the data following the last section of the
+// message, or nil if there is none. It also returns nil until all of
+// the message's sections have been parsed or skipped.
+func (p *Parser) TrailingData() []byte {
+	if p.section != sectionDone || p.off == len(p.msg) {
+		return nil
+	}
+	return p.msg[p.off:]
+}
+
+// SetStrictCompression sets whether the Parser rejects compressed names
+// in the resource data of records whose type does not allow it.
+//
+// RFC 3597, section 4, only allows compression in the resource data of
+// the types defined in RFC 1035, such as NS, CNAME, SOA, PTR and MX.
+// By default, compressed names are also accepted, for robustness, in
+// the other types that carry names, such as RP, AFSDB, SIG and HIP.
+// If strict is true, unpacking such a record fails with an error
+// wrapping ErrCompressedRData instead. Compressed names in SRV records
+// are always rejected, and the names of questions and resource headers
+// may always be compressed. The setting applies to every message
+// parsed, including those passed to later calls to Start.
+func (p *Parser) SetStrictCompression(strict bool) {
+	p.strictCompression = strict
+}
+
 func (p *Parser) checkAdvance(sec section) error {
 	if p.section < sec {
 		return ErrNotStarted
@@ -566,6 +941,9 @@ func (p *Parser) checkAdvance(sec section) error {
 	}
 	p.resHeaderValid = false
 	if p.index == int(p.header.count(sec)) {
+		if sec == sectionAdditionals && p.rejectTrailingData && p.off != len(p.msg) {
+			return ErrTrailingData
+		}
 		p.index = 0
 		p.section++
 		return ErrSectionDone
@@ -581,7 +959,7 @@ func (p *Parser) resource(sec section) (Resource, error) {
 		return r, err
 	}
 	p.resHeaderValid = false
-	r.Body, p.off, err = unpackResourceBody(p.msg, p.off, r.Header)
+	r.Body, p.off, err = unpackResourceBody(p.msg, p.off, r.Header, !p.strictCompression)
 	if err != nil {
 		return Resource{}, &nestedError{"unpacking " + sectionNames[sec], err}
 	}
@@ -1035,6 +1413,208 @@ func (p *Parser) OPTResource() (OPTResource, error) {
 	return r, nil
 }
 
+// OPTOptions skips a single OPTResource and returns an iterator over its
+// options, which, unlike OPTResource, builds no slice of options and
+// does not copy their data. It suits callers looking for a single
+// option, such as the DNS cookie.
+//
+// One of the XXXHeader methods must have been called before calling this
+// method.
+func (p *Parser) OPTOptions() (OptionIterator, error) {
+	if !p.resHeaderValid || p.resHeader.Type != TypeOPT {
+		return OptionIterator{}, ErrNotStarted
+	}
+	end := p.off + int(p.resHeader.Length)
+	if end > len(p.msg) {
+		return OptionIterator{}, errResourceLen
+	}
+	it := OptionIterator{rdata: p.msg[p.off:end]}
+	p.off = end
+	p.resHeaderValid = false
+	p.index++
+	return it, nil
+}
+
+// KEYResource parses a single KEYResource.
+//
+// One of the XXXHeader methods must have been called before calling this
+// method.
+func (p *Parser) KEYResource() (KEYResource, error) {
+	if !p.resHeaderValid || p.resHeader.Type != TypeKEY {
+		return KEYResource{}, ErrNotStarted
+	}
+	r, err := unpackKEYResource(p.msg, p.off, p.resHeader.Length)
+	if err != nil {
+		return KEYResource{}, err
+	}
+	p.off += int(p.resHeader.Length)
+	p.resHeaderValid = false
+	p.index++
+	return r, nil
+}
+
+// APLResource parses a single APLResource.
+//
+// One of the XXXHeader methods must have been called before calling this
+// method.
+func (p *Parser) APLResource() (APLResource, error) {
+	if !p.resHeaderValid || p.resHeader.Type != TypeAPL {
+		return APLResource{}, ErrNotStarted
+	}
+	r, err := unpackAPLResource(p.msg, p.off, p.resHeader.Length)
+	if err != nil {
+		return APLResource{}, err
+	}
+	p.off += int(p.resHeader.Length)
+	p.resHeaderValid = false
+	p.index++
+	return r, nil
+}
+
+// HIPResource parses a single HIPResource.
+//
+// One of the XXXHeader methods must have been called before calling this
+// method.
+func (p *Parser) HIPResource() (HIPResource, error) {
+	if !p.resHeaderValid || p.resHeader.Type != TypeHIP {
+		return HIPResource{}, ErrNotStarted
+	}
+	r, err := unpackHIPResource(p.msg, p.off, p.resHeader.Length, !p.strictCompression)
+	if err != nil {
+		return HIPResource{}, err
+	}
+	p.off += int(p.resHeader.Length)
+	p.resHeaderValid = false
+	p.index++
+	return r, nil
+}
+
+// ZONEMDResource parses a single ZONEMDResource.
+//
+// One of the XXXHeader methods must have been called before calling this
+// method.
+func (p *Parser) ZONEMDResource() (ZONEMDResource, error) {
+	if !p.resHeaderValid || p.resHeader.Type != TypeZONEMD {
+		return ZONEMDResource{}, ErrNotStarted
+	}
+	r, err := unpackZONEMDResource(p.msg, p.off, p.resHeader.Length)
+	if err != nil {
+		return ZONEMDResource{}, err
+	}
+	p.off += int(p.resHeader.Length)
+	p.resHeaderValid = false
+	p.index++
+	return r, nil
+}
+
+// WKSResource parses a single WKSResource.
+//
+// One of the XXXHeader methods must have been called before calling this
+// method.
+func (p *Parser) WKSResource() (WKSResource, error) {
+	if !p.resHeaderValid || p.resHeader.Type != TypeWKS {
+		return WKSResource{}, ErrNotStarted
+	}
+	r, err := unpackWKSResource(p.msg, p.off, p.resHeader.Length)
+	if err != nil {
+		return WKSResource{}, err
+	}
+	p.off += int(p.resHeader.Length)
+	p.resHeaderValid = false
+	p.index++
+	return r, nil
+}
+
+// RPResource parses a single RPResource.
+//
+// One of the XXXHeader methods must have been called before calling this
+// method.
+func (p *Parser) RPResource() (RPResource, error) {
+	if !p.resHeaderValid || p.resHeader.Type != TypeRP {
+		return RPResource{}, ErrNotStarted
+	}
+	r, err := unpackRPResource(p.msg, p.off, !p.strictCompression)
+	if err != nil {
+		return RPResource{}, err
+	}
+	p.off += int(p.resHeader.Length)
+	p.resHeaderValid = false
+	p.index++
+	return r, nil
+}
+
+// AFSDBResource parses a single AFSDBResource.
+//
+// One of the XXXHeader methods must have been called before calling this
+// method.
+func (p *Parser) AFSDBResource() (AFSDBResource, error) {
+	if !p.resHeaderValid || p.resHeader.Type != TypeAFSDB {
+		return AFSDBResource{}, ErrNotStarted
+	}
+	r, err := unpackAFSDBResource(p.msg, p.off, !p.strictCompression)
+	if err != nil {
+		return AFSDBResource{}, err
+	}
+	p.off += int(p.resHeader.Length)
+	p.resHeaderValid = false
+	p.index++
+	return r, nil
+}
+
+// IPSECKEYResource parses a single IPSECKEYResource.
+//
+// One of the XXXHeader methods must have been called before calling this
+// method.
+func (p *Parser) IPSECKEYResource() (IPSECKEYResource, error) {
+	if !p.resHeaderValid || p.resHeader.Type != TypeIPSECKEY {
+		return IPSECKEYResource{}, ErrNotStarted
+	}
+	r, err := unpackIPSECKEYResource(p.msg, p.off, p.resHeader.Length)
+	if err != nil {
+		return IPSECKEYResource{}, err
+	}
+	p.off += int(p.resHeader.Length)
+	p.resHeaderValid = false
+	p.index++
+	return r, nil
+}
+
+// CSYNCResource parses a single CSYNCResource.
+//
+// One of the XXXHeader methods must have been called before calling this
+// method.
+func (p *Parser) CSYNCResource() (CSYNCResource, error) {
+	if !p.resHeaderValid || p.resHeader.Type != TypeCSYNC {
+		return CSYNCResource{}, ErrNotStarted
+	}
+	r, err := unpackCSYNCResource(p.msg, p.off, p.resHeader.Length)
+	if err != nil {
+		return CSYNCResource{}, err
+	}
+	p.off += int(p.resHeader.Length)
+	p.resHeaderValid = false
+	p.index++
+	return r, nil
+}
+
+// SIGResource parses a single SIGResource.
+//
+// One of the XXXHeader methods must have been called before calling this
+// method.
+func (p *Parser) SIGResource() (SIGResource, error) {
+	if !p.resHeaderValid || p.resHeader.Type != TypeSIG {
+		return SIGResource{}, ErrNotStarted
+	}
+	r, err := unpackSIGResource(p.msg, p.off, p.resHeader.Length, !p.strictCompression)
+	if err != nil {
+		return SIGResource{}, err
+	}
+	p.off += int(p.resHeader.Length)
+	p.resHeaderValid = false
+	p.index++
+	return r, nil
+}
+
 // UnknownResource parses a single UnknownResource.
 //
 // One of the XXXHeader methods must have been called before calling this
@@ -1182,35 +1762,175 @@ func (m *Message) GoString() string {
 	return s + "}}"
 }
 
-// A Builder allows incrementally packing a DNS message.
-//
-// Example usage:
+// DigString returns a human-readable rendering of m in the style of the
+// dig command-line tool: a header block followed by the QUESTION, ANSWER,
+// AUTHORITY and ADDITIONAL sections with each Resource in presentation
+// format. An OPT Resource, if present, is rendered as a pseudo-section.
 //
-//	buf := make([]byte, 2, 514)
-//	b := NewBuilder(buf, Header{...})
-//	b.EnableCompression()
-//	// Optionally start a section and add things to that section.
-//	// Repeat adding sections as necessary.
-//	buf, err := b.Finish()
-//	// If err is nil, buf[2:] will contain the built bytes.
-type Builder struct {
-	// msg is the storage for the message being built.
-	msg []byte
+// The output is intended for diagnostics only and its exact layout may
+// change.
+func (m *Message) DigString() string {
+	var opt *Resource
+	for i := range m.Additionals {
+		if m.Additionals[i].Header.Type == TypeOPT {
+			opt = &m.Additionals[i]
+			break
+		}
+	}
 
-	// section keeps track of the current section being built.
-	section section
+	rcode := m.RCode
+	if opt != nil {
+		rcode = opt.Header.ExtendedRCode(rcode)
+	}
+	s := ";; ->>HEADER<<- opcode: " + m.OpCode.mnemonic() +
+		", status: " + rcode.mnemonic() +
+		", id: " + printUint16(m.ID) + "\n"
 
-	// header keeps track of what should go in the header when Finish is
-	// called.
-	header header
+	s += ";; flags:"
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{m.Response, "qr"},
+		{m.Authoritative, "aa"},
+		{m.Truncated, "tc"},
+		{m.RecursionDesired, "rd"},
+		{m.RecursionAvailable, "ra"},
+		{m.AuthenticData, "ad"},
+		{m.CheckingDisabled, "cd"},
+	} {
+		if f.set {
+			s += " " + f.name
+		}
+	}
+	s += "; QUERY: " + printUint16(uint16(len(m.Questions))) +
+		", ANSWER: " + printUint16(uint16(len(m.Answers))) +
+		", AUTHORITY: " + printUint16(uint16(len(m.Authorities))) +
+		", ADDITIONAL: " + printUint16(uint16(len(m.Additionals))) + "\n"
 
-	// start is the starting index of the bytes allocated in msg for header.
-	start int
+	if opt != nil {
+		s += "\n;; OPT PSEUDOSECTION:\n; EDNS: version: " +
+			printUint32(opt.Header.TTL&ednsVersionMask>>16) + ", flags:"
+		if opt.Header.DNSSECAllowed() {
+			s += " do"
+		}
+		s += "; udp: " + printUint16(uint16(opt.Header.Class)) + "\n"
+		if body, ok := opt.Body.(*OPTResource); ok {
+			for _, o := range body.Options {
+				s += "; OPT=" + printUint16(o.Code) + ": " + printHex(o.Data) + "\n"
+			}
+		}
+	}
 
-	// compression is a mapping from name suffixes to their starting index
-	// in msg.
-	compression map[string]int
-}
+	if len(m.Questions) > 0 {
+		s += "\n;; QUESTION SECTION:\n"
+		for _, q := range m.Questions {
+			s += ";" + q.Name.String() + "\t\t" + q.Class.mnemonic() + "\t" + q.Type.mnemonic() + "\n"
+		}
+	}
+	for _, sec := range []struct {
+		name string
+		rs   []Resource
+	}{
+		{"ANSWER", m.Answers},
+		{"AUTHORITY", m.Authorities},
+		{"ADDITIONAL", m.Additionals},
+	} {
+		first := true
+		for i := range sec.rs {
+			if &sec.rs[i] == opt {
+				continue
+			}
+			if first {
+				s += "\n;; " + sec.name + " SECTION:\n"
+				first = false
+			}
+			s += sec.rs[i].String() + "\n"
+		}
+	}
+	return s
+}
+
+// MatchQuery reports whether response is an answer to query, returning
+// nil if it is. It performs the checks a resolver needs before trusting
+// a response received over an unauthenticated transport such as UDP:
+//
+//   - the IDs must be equal, or ErrIDMismatch is returned;
+//   - response must have the QR bit set, or ErrNotResponse is returned;
+//   - both messages must carry the same Questions, comparing names
+//     case-insensitively, or ErrQuestionMismatch is returned.
+//
+// Checking that the response came from the address the query was sent
+// to is the caller's responsibility.
+func MatchQuery(query, response *Message) error {
+	if query.ID != response.ID {
+		return ErrIDMismatch
+	}
+	if !response.Response {
+		return ErrNotResponse
+	}
+	if len(query.Questions) != len(response.Questions) {
+		return ErrQuestionMismatch
+	}
+	for i := range query.Questions {
+		q, r := &query.Questions[i], &response.Questions[i]
+		if q.Type != r.Type || q.Class != r.Class || !equalNameFold(&q.Name, &r.Name) {
+			return ErrQuestionMismatch
+		}
+	}
+	return nil
+}
+
+// equalNameFold reports whether a and b are equal under ASCII case
+// folding, as DNS name comparisons require (RFC 4343).
+func equalNameFold(a, b *Name) bool {
+	if a.Length != b.Length {
+		return false
+	}
+	for i := 0; i < int(a.Length); i++ {
+		x, y := a.Data[i], b.Data[i]
+		if 'A' <= x && x <= 'Z' {
+			x += 'a' - 'A'
+		}
+		if 'A' <= y && y <= 'Z' {
+			y += 'a' - 'A'
+		}
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// A Builder allows incrementally packing a DNS message.
+//
+// Example usage:
+//
+//	buf := make([]byte, 2, 514)
+//	b := NewBuilder(buf, Header{...})
+//	b.EnableCompression()
+//	// Optionally start a section and add things to that section.
+//	// Repeat adding sections as necessary.
+//	buf, err := b.Finish()
+//	// If err is nil, buf[2:] will contain the built bytes.
+type Builder struct {
+	// msg is the storage for the message being built.
+	msg []byte
+
+	// section keeps track of the current section being built.
+	section section
+
+	// header keeps track of what should go in the header when Finish is
+	// called.
+	header header
+
+	// start is the starting index of the bytes allocated in msg for header.
+	start int
+
+	// compression is a mapping from name suffixes to their starting index
+	// in msg.
+	compression map[string]int
+}
 
 // NewBuilder creates a new builder with compression disabled.
 //
@@ -1234,6 +1954,20 @@ func NewBuilder(buf []byte, h Header) Builder {
 	return b
 }
 
+// SetReservedZ sets or clears the reserved Z bit in the header of the
+// message being built.
+//
+// RFC 1035 requires the Z bit to be zero, which is the default. Setting
+// it is only useful for building deliberately non-conforming messages,
+// for example to test how a peer handles them.
+func (b *Builder) SetReservedZ(z bool) {
+	if z {
+		b.header.bits |= headerBitZ
+	} else {
+		b.header.bits &^= headerBitZ
+	}
+}
+
 // EnableCompression enables compression in the Builder.
 //
 // Leaving compression disabled avoids compression related allocations, but can
@@ -1588,8 +2322,8 @@ func (b *Builder) OPTResource(h ResourceHeader, r OPTResource) error {
 	return nil
 }
 
-// UnknownResource adds a single UnknownResource.
-func (b *Builder) UnknownResource(h ResourceHeader, r UnknownResource) error {
+// KEYResource adds a single KEYResource.
+func (b *Builder) KEYResource(h ResourceHeader, r KEYResource) error {
 	if err := b.checkResourceSection(); err != nil {
 		return err
 	}
@@ -1600,7 +2334,7 @@ func (b *Builder) UnknownResource(h ResourceHeader, r UnknownResource) error {
 	}
 	preLen := len(msg)
 	if msg, err = r.pack(msg, b.compression, b.start); err != nil {
-		return &nestedError{"UnknownResource body", err}
+		return &nestedError{"KEYResource body", err}
 	}
 	if err := h.fixLen(msg, lenOff, preLen); err != nil {
 		return err
@@ -1612,269 +2346,521 @@ func (b *Builder) UnknownResource(h ResourceHeader, r UnknownResource) error {
 	return nil
 }
 
-// Finish ends message building and generates a binary message.
-func (b *Builder) Finish() ([]byte, error) {
-	if b.section < sectionHeader {
-		return nil, ErrNotStarted
+// APLResource adds a single APLResource.
+func (b *Builder) APLResource(h ResourceHeader, r APLResource) error {
+	if err := b.checkResourceSection(); err != nil {
+		return err
 	}
-	b.section = sectionDone
-	// Space for the header was allocated in NewBuilder.
-	b.header.pack(b.msg[b.start:b.start])
-	return b.msg, nil
-}
-
-// A ResourceHeader is the header of a DNS resource record. There are
-// many types of DNS resource records, but they all share the same header.
-type ResourceHeader struct {
-	// Name is the domain name for which this resource record pertains.
-	Name Name
-
-	// Type is the type of DNS resource record.
-	//
-	// This field will be set automatically during packing.
-	Type Type
-
-	// Class is the class of network to which this DNS resource record
-	// pertains.
-	Class Class
-
-	// TTL is the length of time (measured in seconds) which this resource
-	// record is valid for (time to live). All Resources in a set should
-	// have the same TTL (RFC 2181 Section 5.2).
-	TTL uint32
-
-	// Length is the length of data in the resource record after the header.
-	//
-	// This field will be set automatically during packing.
-	Length uint16
-}
-
-// GoString implements fmt.GoStringer.GoString.
-func (h *ResourceHeader) GoString() string {
-	return "dnsmessage.ResourceHeader{" +
-		"Name: " + h.Name.GoString() + ", " +
-		"Type: " + h.Type.GoString() + ", " +
-		"Class: " + h.Class.GoString() + ", " +
-		"TTL: " + printUint32(h.TTL) + ", " +
-		"Length: " + printUint16(h.Length) + "}"
-}
-
-// pack appends the wire format of the ResourceHeader to oldMsg.
-//
-// lenOff is the offset in msg where the Length field was packed.
-func (h *ResourceHeader) pack(oldMsg []byte, compression map[string]int, compressionOff int) (msg []byte, lenOff int, err error) {
-	msg = oldMsg
-	if msg, err = h.Name.pack(msg, compression, compressionOff); err != nil {
-		return oldMsg, 0, &nestedError{"Name", err}
+	h.Type = r.realType()
+	msg, lenOff, err := h.pack(b.msg, b.compression, b.start)
+	if err != nil {
+		return &nestedError{"ResourceHeader", err}
 	}
-	msg = packType(msg, h.Type)
-	msg = packClass(msg, h.Class)
-	msg = packUint32(msg, h.TTL)
-	lenOff = len(msg)
-	msg = packUint16(msg, h.Length)
-	return msg, lenOff, nil
+	preLen := len(msg)
+	if msg, err = r.pack(msg, b.compression, b.start); err != nil {
+		return &nestedError{"APLResource body", err}
+	}
+	if err := h.fixLen(msg, lenOff, preLen); err != nil {
+		return err
+	}
+	if err := b.incrementSectionCount(); err != nil {
+		return err
+	}
+	b.msg = msg
+	return nil
 }
 
-func (h *ResourceHeader) unpack(msg []byte, off int) (int, error) {
-	newOff := off
-	var err error
-	if newOff, err = h.Name.unpack(msg, newOff); err != nil {
-		return off, &nestedError{"Name", err}
-	}
-	if h.Type, newOff, err = unpackType(msg, newOff); err != nil {
-		return off, &nestedError{"Type", err}
+// HIPResource adds a single HIPResource.
+func (b *Builder) HIPResource(h ResourceHeader, r HIPResource) error {
+	if err := b.checkResourceSection(); err != nil {
+		return err
 	}
-	if h.Class, newOff, err = unpackClass(msg, newOff); err != nil {
-		return off, &nestedError{"Class", err}
+	h.Type = r.realType()
+	msg, lenOff, err := h.pack(b.msg, b.compression, b.start)
+	if err != nil {
+		return &nestedError{"ResourceHeader", err}
 	}
-	if h.TTL, newOff, err = unpackUint32(msg, newOff); err != nil {
-		return off, &nestedError{"TTL", err}
+	preLen := len(msg)
+	if msg, err = r.pack(msg, b.compression, b.start); err != nil {
+		return &nestedError{"HIPResource body", err}
 	}
-	if h.Length, newOff, err = unpackUint16(msg, newOff); err != nil {
-		return off, &nestedError{"Length", err}
+	if err := h.fixLen(msg, lenOff, preLen); err != nil {
+		return err
 	}
-	return newOff, nil
-}
-
-// fixLen updates a packed ResourceHeader to include the length of the
-// ResourceBody.
-//
-// lenOff is the offset of the ResourceHeader.Length field in msg.
-//
-// preLen is the length that msg was before the ResourceBody was packed.
-func (h *ResourceHeader) fixLen(msg []byte, lenOff int, preLen int) error {
-	conLen := len(msg) - preLen
-	if conLen > int(^uint16(0)) {
-		return errResTooLong
+	if err := b.incrementSectionCount(); err != nil {
+		return err
 	}
-
-	// Fill in the length now that we know how long the content is.
-	packUint16(msg[lenOff:lenOff], uint16(conLen))
-	h.Length = uint16(conLen)
-
+	b.msg = msg
 	return nil
 }
 
-// EDNS(0) wire constants.
-const (
-	edns0Version = 0
-
-	edns0DNSSECOK     = 0x00008000
-	ednsVersionMask   = 0x00ff0000
-	edns0DNSSECOKMask = 0x00ff8000
-)
-
-// SetEDNS0 configures h for EDNS(0).
-//
-// The provided extRCode must be an extended RCode.
-func (h *ResourceHeader) SetEDNS0(udpPayloadLen int, extRCode RCode, dnssecOK bool) error {
-	h.Name = Name{Data: [nameLen]byte{'.'}, Length: 1} // RFC 6891 section 6.1.2
-	h.Type = TypeOPT
-	h.Class = Class(udpPayloadLen)
-	h.TTL = uint32(extRCode) >> 4 << 24
-	if dnssecOK {
-		h.TTL |= edns0DNSSECOK
+// ZONEMDResource adds a single ZONEMDResource.
+func (b *Builder) ZONEMDResource(h ResourceHeader, r ZONEMDResource) error {
+	if err := b.checkResourceSection(); err != nil {
+		return err
+	}
+	h.Type = r.realType()
+	msg, lenOff, err := h.pack(b.msg, b.compression, b.start)
+	if err != nil {
+		return &nestedError{"ResourceHeader", err}
+	}
+	preLen := len(msg)
+	if msg, err = r.pack(msg, b.compression, b.start); err != nil {
+		return &nestedError{"ZONEMDResource body", err}
+	}
+	if err := h.fixLen(msg, lenOff, preLen); err != nil {
+		return err
+	}
+	if err := b.incrementSectionCount(); err != nil {
+		return err
 	}
+	b.msg = msg
 	return nil
 }
 
-// DNSSECAllowed reports whether the DNSSEC OK bit is set.
-func (h *ResourceHeader) DNSSECAllowed() bool {
-	return h.TTL&edns0DNSSECOKMask == edns0DNSSECOK // RFC 6891 section 6.1.3
-}
-
-// ExtendedRCode returns an extended RCode.
-//
-// The provided rcode must be the RCode in DNS message header.
-func (h *ResourceHeader) ExtendedRCode(rcode RCode) RCode {
-	if h.TTL&ednsVersionMask == edns0Version { // RFC 6891 section 6.1.3
-		return RCode(h.TTL>>24<<4) | rcode
+// WKSResource adds a single WKSResource.
+func (b *Builder) WKSResource(h ResourceHeader, r WKSResource) error {
+	if err := b.checkResourceSection(); err != nil {
+		return err
 	}
-	return rcode
-}
-
-func skipResource(msg []byte, off int) (int, error) {
-	newOff, err := skipName(msg, off)
+	h.Type = r.realType()
+	msg, lenOff, err := h.pack(b.msg, b.compression, b.start)
 	if err != nil {
-		return off, &nestedError{"Name", err}
-	}
-	if newOff, err = skipType(msg, newOff); err != nil {
-		return off, &nestedError{"Type", err}
+		return &nestedError{"ResourceHeader", err}
 	}
-	if newOff, err = skipClass(msg, newOff); err != nil {
-		return off, &nestedError{"Class", err}
+	preLen := len(msg)
+	if msg, err = r.pack(msg, b.compression, b.start); err != nil {
+		return &nestedError{"WKSResource body", err}
 	}
-	if newOff, err = skipUint32(msg, newOff); err != nil {
-		return off, &nestedError{"TTL", err}
+	if err := h.fixLen(msg, lenOff, preLen); err != nil {
+		return err
 	}
-	length, newOff, err := unpackUint16(msg, newOff)
-	if err != nil {
-		return off, &nestedError{"Length", err}
+	if err := b.incrementSectionCount(); err != nil {
+		return err
 	}
-	if newOff += int(length); newOff > len(msg) {
-		return off, errResourceLen
-	}
-	return newOff, nil
+	b.msg = msg
+	return nil
 }
 
-// packUint16 appends the wire format of field to msg.
-func packUint16(msg []byte, field uint16) []byte {
-	return append(msg, byte(field>>8), byte(field))
+// RPResource adds a single RPResource.
+func (b *Builder) RPResource(h ResourceHeader, r RPResource) error {
+	if err := b.checkResourceSection(); err != nil {
+		return err
+	}
+	h.Type = r.realType()
+	msg, lenOff, err := h.pack(b.msg, b.compression, b.start)
+	if err != nil {
+		return &nestedError{"ResourceHeader", err}
+	}
+	preLen := len(msg)
+	if msg, err = r.pack(msg, b.compression, b.start); err != nil {
+		return &nestedError{"RPResource body", err}
+	}
+	if err := h.fixLen(msg, lenOff, preLen); err != nil {
+		return err
+	}
+	if err := b.incrementSectionCount(); err != nil {
+		return err
+	}
+	b.msg = msg
+	return nil
 }
 
-func unpackUint16(msg []byte, off int) (uint16, int, error) {
-	if off+uint16Len > len(msg) {
-		return 0, off, errBaseLen
+// AFSDBResource adds a single AFSDBResource.
+func (b *Builder) AFSDBResource(h ResourceHeader, r AFSDBResource) error {
+	if err := b.checkResourceSection(); err != nil {
+		return err
 	}
-	return uint16(msg[off])<<8 | uint16(msg[off+1]), off + uint16Len, nil
+	h.Type = r.realType()
+	msg, lenOff, err := h.pack(b.msg, b.compression, b.start)
+	if err != nil {
+		return &nestedError{"ResourceHeader", err}
+	}
+	preLen := len(msg)
+	if msg, err = r.pack(msg, b.compression, b.start); err != nil {
+		return &nestedError{"AFSDBResource body", err}
+	}
+	if err := h.fixLen(msg, lenOff, preLen); err != nil {
+		return err
+	}
+	if err := b.incrementSectionCount(); err != nil {
+		return err
+	}
+	b.msg = msg
+	return nil
 }
 
-func skipUint16(msg []byte, off int) (int, error) {
-	if off+uint16Len > len(msg) {
-		return off, errBaseLen
+// IPSECKEYResource adds a single IPSECKEYResource.
+func (b *Builder) IPSECKEYResource(h ResourceHeader, r IPSECKEYResource) error {
+	if err := b.checkResourceSection(); err != nil {
+		return err
 	}
-	return off + uint16Len, nil
+	h.Type = r.realType()
+	msg, lenOff, err := h.pack(b.msg, b.compression, b.start)
+	if err != nil {
+		return &nestedError{"ResourceHeader", err}
+	}
+	preLen := len(msg)
+	if msg, err = r.pack(msg, b.compression, b.start); err != nil {
+		return &nestedError{"IPSECKEYResource body", err}
+	}
+	if err := h.fixLen(msg, lenOff, preLen); err != nil {
+		return err
+	}
+	if err := b.incrementSectionCount(); err != nil {
+		return err
+	}
+	b.msg = msg
+	return nil
 }
 
-// packType appends the wire format of field to msg.
-func packType(msg []byte, field Type) []byte {
-	return packUint16(msg, uint16(field))
+// CSYNCResource adds a single CSYNCResource.
+func (b *Builder) CSYNCResource(h ResourceHeader, r CSYNCResource) error {
+	if err := b.checkResourceSection(); err != nil {
+		return err
+	}
+	h.Type = r.realType()
+	msg, lenOff, err := h.pack(b.msg, b.compression, b.start)
+	if err != nil {
+		return &nestedError{"ResourceHeader", err}
+	}
+	preLen := len(msg)
+	if msg, err = r.pack(msg, b.compression, b.start); err != nil {
+		return &nestedError{"CSYNCResource body", err}
+	}
+	if err := h.fixLen(msg, lenOff, preLen); err != nil {
+		return err
+	}
+	if err := b.incrementSectionCount(); err != nil {
+		return err
+	}
+	b.msg = msg
+	return nil
 }
 
-func unpackType(msg []byte, off int) (Type, int, error) {
-	t, o, err := unpackUint16(msg, off)
-	return Type(t), o, err
+// SIGResource adds a single SIGResource.
+func (b *Builder) SIGResource(h ResourceHeader, r SIGResource) error {
+	if err := b.checkResourceSection(); err != nil {
+		return err
+	}
+	h.Type = r.realType()
+	msg, lenOff, err := h.pack(b.msg, b.compression, b.start)
+	if err != nil {
+		return &nestedError{"ResourceHeader", err}
+	}
+	preLen := len(msg)
+	if msg, err = r.pack(msg, b.compression, b.start); err != nil {
+		return &nestedError{"SIGResource body", err}
+	}
+	if err := h.fixLen(msg, lenOff, preLen); err != nil {
+		return err
+	}
+	if err := b.incrementSectionCount(); err != nil {
+		return err
+	}
+	b.msg = msg
+	return nil
 }
 
-func skipType(msg []byte, off int) (int, error) {
-	return skipUint16(msg, off)
+// UnknownResource adds a single UnknownResource.
+func (b *Builder) UnknownResource(h ResourceHeader, r UnknownResource) error {
+	if err := b.checkResourceSection(); err != nil {
+		return err
+	}
+	h.Type = r.realType()
+	msg, lenOff, err := h.pack(b.msg, b.compression, b.start)
+	if err != nil {
+		return &nestedError{"ResourceHeader", err}
+	}
+	preLen := len(msg)
+	if msg, err = r.pack(msg, b.compression, b.start); err != nil {
+		return &nestedError{"UnknownResource body", err}
+	}
+	if err := h.fixLen(msg, lenOff, preLen); err != nil {
+		return err
+	}
+	if err := b.incrementSectionCount(); err != nil {
+		return err
+	}
+	b.msg = msg
+	return nil
 }
 
-// packClass appends the wire format of field to msg.
-func packClass(msg []byte, field Class) []byte {
-	return packUint16(msg, uint16(field))
+// Finish ends message building and generates a binary message.
+func (b *Builder) Finish() ([]byte, error) {
+	if b.section < sectionHeader {
+		return nil, ErrNotStarted
+	}
+	b.section = sectionDone
+	// Space for the header was allocated in NewBuilder.
+	b.header.pack(b.msg[b.start:b.start])
+	return b.msg, nil
 }
 
-func unpackClass(msg []byte, off int) (Class, int, error) {
-	c, o, err := unpackUint16(msg, off)
-	return Class(c), o, err
-}
+// A ResourceHeader is the header of a DNS resource record. There are
+// many types of DNS resource records, but they all share the same header.
+type ResourceHeader struct {
+	// Name is the domain name for which this resource record pertains.
+	Name Name
 
-func skipClass(msg []byte, off int) (int, error) {
-	return skipUint16(msg, off)
-}
+	// Type is the type of DNS resource record.
+	//
+	// This field will be set automatically during packing.
+	Type Type
 
-// packUint32 appends the wire format of field to msg.
-func packUint32(msg []byte, field uint32) []byte {
-	return append(
-		msg,
-		byte(field>>24),
-		byte(field>>16),
-		byte(field>>8),
-		byte(field),
-	)
-}
+	// Class is the class of network to which this DNS resource record
+	// pertains.
+	Class Class
 
-func unpackUint32(msg []byte, off int) (uint32, int, error) {
-	if off+uint32Len > len(msg) {
-		return 0, off, errBaseLen
-	}
-	v := uint32(msg[off])<<24 | uint32(msg[off+1])<<16 | uint32(msg[off+2])<<8 | uint32(msg[off+3])
-	return v, off + uint32Len, nil
+	// TTL is the length of time (measured in seconds) which this resource
+	// record is valid for (time to live). All Resources in a set should
+	// have the same TTL (RFC 2181 Section 5.2).
+	TTL uint32
+
+	// Length is the length of data in the resource record after the header.
+	//
+	// This field will be set automatically during packing.
+	Length uint16
 }
 
-func skipUint32(msg []byte, off int) (int, error) {
-	if off+uint32Len > len(msg) {
-		return off, errBaseLen
-	}
-	return off + uint32Len, nil
+// GoString implements fmt.GoStringer.GoString.
+func (h *ResourceHeader) GoString() string {
+	return "dnsmessage.ResourceHeader{" +
+		"Name: " + h.Name.GoString() + ", " +
+		"Type: " + h.Type.GoString() + ", " +
+		"Class: " + h.Class.GoString() + ", " +
+		"TTL: " + printUint32(h.TTL) + ", " +
+		"Length: " + printUint16(h.Length) + "}"
 }
 
-// packText appends the wire format of field to msg.
-func packText(msg []byte, field string) ([]byte, error) {
-	l := len(field)
-	if l > 255 {
-		return nil, errStringTooLong
+// pack appends the wire format of the ResourceHeader to oldMsg.
+//
+// lenOff is the offset in msg where the Length field was packed.
+func (h *ResourceHeader) pack(oldMsg []byte, compression map[string]int, compressionOff int) (msg []byte, lenOff int, err error) {
+	msg = oldMsg
+	if msg, err = h.Name.pack(msg, compression, compressionOff); err != nil {
+		return oldMsg, 0, &nestedError{"Name", err}
 	}
-	msg = append(msg, byte(l))
-	msg = append(msg, field...)
-
-	return msg, nil
+	msg = packType(msg, h.Type)
+	msg = packClass(msg, h.Class)
+	msg = packUint32(msg, h.TTL)
+	lenOff = len(msg)
+	msg = packUint16(msg, h.Length)
+	return msg, lenOff, nil
 }
 
-func unpackText(msg []byte, off int) (string, int, error) {
-	if off >= len(msg) {
-		return "", off, errBaseLen
+func (h *ResourceHeader) unpack(msg []byte, off int) (int, error) {
+	newOff := off
+	var err error
+	if newOff, err = h.Name.unpack(msg, newOff); err != nil {
+		return off, &nestedError{"Name", err}
 	}
-	beginOff := off + 1
-	endOff := beginOff + int(msg[off])
-	if endOff > len(msg) {
-		return "", off, errCalcLen
+	if h.Type, newOff, err = unpackType(msg, newOff); err != nil {
+		return off, &nestedError{"Type", err}
 	}
-	return string(msg[beginOff:endOff]), endOff, nil
+	if h.Class, newOff, err = unpackClass(msg, newOff); err != nil {
+		return off, &nestedError{"Class", err}
+	}
+	if h.TTL, newOff, err = unpackUint32(msg, newOff); err != nil {
+		return off, &nestedError{"TTL", err}
+	}
+	if h.Length, newOff, err = unpackUint16(msg, newOff); err != nil {
+		return off, &nestedError{"Length", err}
+	}
+	return newOff, nil
 }
 
-// packBytes appends the wire format of field to msg.
+// fixLen updates a packed ResourceHeader to include the length of the
+// ResourceBody.
+//
+// lenOff is the offset of the ResourceHeader.Length field in msg.
+//
+// preLen is the length that msg was before the ResourceBody was packed.
+func (h *ResourceHeader) fixLen(msg []byte, lenOff int, preLen int) error {
+	conLen := len(msg) - preLen
+	if conLen > int(^uint16(0)) {
+		return errResTooLong
+	}
+
+	// Fill in the length now that we know how long the content is.
+	packUint16(msg[lenOff:lenOff], uint16(conLen))
+	h.Length = uint16(conLen)
+
+	return nil
+}
+
+// EDNS(0) wire constants.
+const (
+	edns0Version = 0
+
+	edns0DNSSECOK     = 0x00008000
+	ednsVersionMask   = 0x00ff0000
+	edns0DNSSECOKMask = 0x00ff8000
+)
+
+// SetEDNS0 configures h for EDNS(0).
+//
+// The provided extRCode must be an extended RCode.
+func (h *ResourceHeader) SetEDNS0(udpPayloadLen int, extRCode RCode, dnssecOK bool) error {
+	h.Name = Name{Data: [nameLen]byte{'.'}, Length: 1} // RFC 6891 section 6.1.2
+	h.Type = TypeOPT
+	h.Class = Class(udpPayloadLen)
+	h.TTL = uint32(extRCode) >> 4 << 24
+	if dnssecOK {
+		h.TTL |= edns0DNSSECOK
+	}
+	return nil
+}
+
+// DNSSECAllowed reports whether the DNSSEC OK bit is set.
+func (h *ResourceHeader) DNSSECAllowed() bool {
+	return h.TTL&edns0DNSSECOKMask == edns0DNSSECOK // RFC 6891 section 6.1.3
+}
+
+// ExtendedRCode returns an extended RCode.
+//
+// The provided rcode must be the RCode in DNS message header.
+func (h *ResourceHeader) ExtendedRCode(rcode RCode) RCode {
+	if h.TTL&ednsVersionMask == edns0Version { // RFC 6891 section 6.1.3
+		return RCode(h.TTL>>24<<4) | rcode
+	}
+	return rcode
+}
+
+func skipResource(msg []byte, off int) (int, error) {
+	newOff, err := skipName(msg, off)
+	if err != nil {
+		return off, &nestedError{"Name", err}
+	}
+	if newOff, err = skipType(msg, newOff); err != nil {
+		return off, &nestedError{"Type", err}
+	}
+	if newOff, err = skipClass(msg, newOff); err != nil {
+		return off, &nestedError{"Class", err}
+	}
+	if newOff, err = skipUint32(msg, newOff); err != nil {
+		return off, &nestedError{"TTL", err}
+	}
+	length, newOff, err := unpackUint16(msg, newOff)
+	if err != nil {
+		return off, &nestedError{"Length", err}
+	}
+	if newOff += int(length); newOff > len(msg) {
+		return off, errResourceLen
+	}
+	return newOff, nil
+}
+
+// packUint8 appends the wire format of field to msg.
+func packUint8(msg []byte, field uint8) []byte {
+	return append(msg, field)
+}
+
+func unpackUint8(msg []byte, off int) (uint8, int, error) {
+	if off >= len(msg) {
+		return 0, off, errBaseLen
+	}
+	return msg[off], off + 1, nil
+}
+
+// packUint16 appends the wire format of field to msg.
+func packUint16(msg []byte, field uint16) []byte {
+	return append(msg, byte(field>>8), byte(field))
+}
+
+func unpackUint16(msg []byte, off int) (uint16, int, error) {
+	if off+uint16Len > len(msg) {
+		return 0, off, errBaseLen
+	}
+	return uint16(msg[off])<<8 | uint16(msg[off+1]), off + uint16Len, nil
+}
+
+func skipUint16(msg []byte, off int) (int, error) {
+	if off+uint16Len > len(msg) {
+		return off, errBaseLen
+	}
+	return off + uint16Len, nil
+}
+
+// packType appends the wire format of field to msg.
+func packType(msg []byte, field Type) []byte {
+	return packUint16(msg, uint16(field))
+}
+
+func unpackType(msg []byte, off int) (Type, int, error) {
+	t, o, err := unpackUint16(msg, off)
+	return Type(t), o, err
+}
+
+func skipType(msg []byte, off int) (int, error) {
+	return skipUint16(msg, off)
+}
+
+// packClass appends the wire format of field to msg.
+func packClass(msg []byte, field Class) []byte {
+	return packUint16(msg, uint16(field))
+}
+
+func unpackClass(msg []byte, off int) (Class, int, error) {
+	c, o, err := unpackUint16(msg, off)
+	return Class(c), o, err
+}
+
+func skipClass(msg []byte, off int) (int, error) {
+	return skipUint16(msg, off)
+}
+
+// packUint32 appends the wire format of field to msg.
+func packUint32(msg []byte, field uint32) []byte {
+	return append(
+		msg,
+		byte(field>>24),
+		byte(field>>16),
+		byte(field>>8),
+		byte(field),
+	)
+}
+
+func unpackUint32(msg []byte, off int) (uint32, int, error) {
+	if off+uint32Len > len(msg) {
+		return 0, off, errBaseLen
+	}
+	v := uint32(msg[off])<<24 | uint32(msg[off+1])<<16 | uint32(msg[off+2])<<8 | uint32(msg[off+3])
+	return v, off + uint32Len, nil
+}
+
+func skipUint32(msg []byte, off int) (int, error) {
+	if off+uint32Len > len(msg) {
+		return off, errBaseLen
+	}
+	return off + uint32Len, nil
+}
+
+// packText appends the wire format of field to msg.
+func packText(msg []byte, field string) ([]byte, error) {
+	l := len(field)
+	if l > 255 {
+		return nil, errStringTooLong
+	}
+	msg = append(msg, byte(l))
+	msg = append(msg, field...)
+
+	return msg, nil
+}
+
+func unpackText(msg []byte, off int) (string, int, error) {
+	if off >= len(msg) {
+		return "", off, errBaseLen
+	}
+	beginOff := off + 1
+	endOff := beginOff + int(msg[off])
+	if endOff > len(msg) {
+		return "", off, errCalcLen
+	}
+	return string(msg[beginOff:endOff]), endOff, nil
+}
+
+// packBytes appends the wire format of field to msg.
 func packBytes(msg []byte, field []byte) []byte {
 	return append(msg, field...)
 }
@@ -2034,7 +3020,7 @@ Loop:
 			currOff = endOff
 		case 0xC0: // Pointer
 			if !allowCompression {
-				return off, errCompressedSRV
+				return off, ErrCompressedRData
 			}
 			if currOff >= len(msg) {
 				return off, errInvalidPtr
@@ -2049,6 +3035,11 @@ Loop:
 				return off, errTooManyPtr
 			}
 			currOff = (c^0xC0)<<8 | int(c1)
+			if currOff >= len(msg) {
+				s := "pointer to offset " + printUint32(uint32(currOff)) +
+					" in message of length " + printUint32(uint32(len(msg)))
+				return off, &nestedError{s, ErrPointerOutOfRange}
+			}
 		default:
 			// Prefixes 0x80 and 0x40 are reserved.
 			return off, errReserved
@@ -2133,7 +3124,10 @@ func (q *Question) GoString() string {
 		"Class: " + q.Class.GoString() + "}"
 }
 
-func unpackResourceBody(msg []byte, off int, hdr ResourceHeader) (ResourceBody, int, error) {
+// unpackResourceBody unpacks the resource data described by hdr.
+// allowCompression reports whether compressed names are accepted in
+// the resource data of the types not defined in RFC 1035.
+func unpackResourceBody(msg []byte, off int, hdr ResourceHeader, allowCompression bool) (ResourceBody, int, error) {
 	var (
 		r    ResourceBody
 		err  error
@@ -2190,6 +3184,56 @@ func unpackResourceBody(msg []byte, off int, hdr ResourceHeader) (ResourceBody,
 		rb, err = unpackOPTResource(msg, off, hdr.Length)
 		r = &rb
 		name = "OPT"
+	case TypeKEY:
+		var rb KEYResource
+		rb, err = unpackKEYResource(msg, off, hdr.Length)
+		r = &rb
+		name = "KEY"
+	case TypeSIG:
+		var rb SIGResource
+		rb, err = unpackSIGResource(msg, off, hdr.Length, allowCompression)
+		r = &rb
+		name = "SIG"
+	case TypeAPL:
+		var rb APLResource
+		rb, err = unpackAPLResource(msg, off, hdr.Length)
+		r = &rb
+		name = "APL"
+	case TypeHIP:
+		var rb HIPResource
+		rb, err = unpackHIPResource(msg, off, hdr.Length, allowCompression)
+		r = &rb
+		name = "HIP"
+	case TypeZONEMD:
+		var rb ZONEMDResource
+		rb, err = unpackZONEMDResource(msg, off, hdr.Length)
+		r = &rb
+		name = "ZONEMD"
+	case TypeWKS:
+		var rb WKSResource
+		rb, err = unpackWKSResource(msg, off, hdr.Length)
+		r = &rb
+		name = "WKS"
+	case TypeRP:
+		var rb RPResource
+		rb, err = unpackRPResource(msg, off, allowCompression)
+		r = &rb
+		name = "RP"
+	case TypeAFSDB:
+		var rb AFSDBResource
+		rb, err = unpackAFSDBResource(msg, off, allowCompression)
+		r = &rb
+		name = "AFSDB"
+	case TypeIPSECKEY:
+		var rb IPSECKEYResource
+		rb, err = unpackIPSECKEYResource(msg, off, hdr.Length)
+		r = &rb
+		name = "IPSECKEY"
+	case TypeCSYNC:
+		var rb CSYNCResource
+		rb, err = unpackCSYNCResource(msg, off, hdr.Length)
+		r = &rb
+		name = "CSYNC"
 	default:
 		var rb UnknownResource
 		rb, err = unpackUnknownResource(hdr.Type, msg, off, hdr.Length)
@@ -2197,450 +3241,1719 @@ func unpackResourceBody(msg []byte, off int, hdr ResourceHeader) (ResourceBody,
 		name = "Unknown"
 	}
 	if err != nil {
-		return nil, off, &nestedError{name + " record", err}
+		return nil, off, &nestedError{name + " record", err}
+	}
+	return r, off + int(hdr.Length), nil
+}
+
+// A CNAMEResource is a CNAME Resource record.
+type CNAMEResource struct {
+	CNAME Name
+}
+
+func (r *CNAMEResource) realType() Type {
+	return TypeCNAME
+}
+
+// pack appends the wire format of the CNAMEResource to msg.
+func (r *CNAMEResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	return r.CNAME.pack(msg, compression, compressionOff)
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (r *CNAMEResource) GoString() string {
+	return "dnsmessage.CNAMEResource{CNAME: " + r.CNAME.GoString() + "}"
+}
+
+// String implements ResourceBody.String.
+func (r *CNAMEResource) String() string {
+	return r.CNAME.String()
+}
+
+func unpackCNAMEResource(msg []byte, off int) (CNAMEResource, error) {
+	var cname Name
+	if _, err := cname.unpack(msg, off); err != nil {
+		return CNAMEResource{}, err
+	}
+	return CNAMEResource{cname}, nil
+}
+
+// An MXResource is an MX Resource record.
+type MXResource struct {
+	Pref uint16
+	MX   Name
+}
+
+func (r *MXResource) realType() Type {
+	return TypeMX
+}
+
+// pack appends the wire format of the MXResource to msg.
+func (r *MXResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	oldMsg := msg
+	msg = packUint16(msg, r.Pref)
+	msg, err := r.MX.pack(msg, compression, compressionOff)
+	if err != nil {
+		return oldMsg, &nestedError{"MXResource.MX", err}
+	}
+	return msg, nil
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (r *MXResource) GoString() string {
+	return "dnsmessage.MXResource{" +
+		"Pref: " + printUint16(r.Pref) + ", " +
+		"MX: " + r.MX.GoString() + "}"
+}
+
+// String implements ResourceBody.String.
+func (r *MXResource) String() string {
+	return printUint16(r.Pref) + " " + r.MX.String()
+}
+
+func unpackMXResource(msg []byte, off int) (MXResource, error) {
+	pref, off, err := unpackUint16(msg, off)
+	if err != nil {
+		return MXResource{}, &nestedError{"Pref", err}
+	}
+	var mx Name
+	if _, err := mx.unpack(msg, off); err != nil {
+		return MXResource{}, &nestedError{"MX", err}
+	}
+	return MXResource{pref, mx}, nil
+}
+
+// An NSResource is an NS Resource record.
+type NSResource struct {
+	NS Name
+}
+
+func (r *NSResource) realType() Type {
+	return TypeNS
+}
+
+// pack appends the wire format of the NSResource to msg.
+func (r *NSResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	return r.NS.pack(msg, compression, compressionOff)
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (r *NSResource) GoString() string {
+	return "dnsmessage.NSResource{NS: " + r.NS.GoString() + "}"
+}
+
+// String implements ResourceBody.String.
+func (r *NSResource) String() string {
+	return r.NS.String()
+}
+
+func unpackNSResource(msg []byte, off int) (NSResource, error) {
+	var ns Name
+	if _, err := ns.unpack(msg, off); err != nil {
+		return NSResource{}, err
+	}
+	return NSResource{ns}, nil
+}
+
+// A PTRResource is a PTR Resource record.
+type PTRResource struct {
+	PTR Name
+}
+
+func (r *PTRResource) realType() Type {
+	return TypePTR
+}
+
+// pack appends the wire format of the PTRResource to msg.
+func (r *PTRResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	return r.PTR.pack(msg, compression, compressionOff)
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (r *PTRResource) GoString() string {
+	return "dnsmessage.PTRResource{PTR: " + r.PTR.GoString() + "}"
+}
+
+// String implements ResourceBody.String.
+func (r *PTRResource) String() string {
+	return r.PTR.String()
+}
+
+func unpackPTRResource(msg []byte, off int) (PTRResource, error) {
+	var ptr Name
+	if _, err := ptr.unpack(msg, off); err != nil {
+		return PTRResource{}, err
+	}
+	return PTRResource{ptr}, nil
+}
+
+// An SOAResource is an SOA Resource record.
+type SOAResource struct {
+	NS      Name
+	MBox    Name
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+
+	// MinTTL the is the default TTL of Resources records which did not
+	// contain a TTL value and the TTL of negative responses. (RFC 2308
+	// Section 4)
+	MinTTL uint32
+}
+
+func (r *SOAResource) realType() Type {
+	return TypeSOA
+}
+
+// pack appends the wire format of the SOAResource to msg.
+func (r *SOAResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	oldMsg := msg
+	msg, err := r.NS.pack(msg, compression, compressionOff)
+	if err != nil {
+		return oldMsg, &nestedError{"SOAResource.NS", err}
+	}
+	msg, err = r.MBox.pack(msg, compression, compressionOff)
+	if err != nil {
+		return oldMsg, &nestedError{"SOAResource.MBox", err}
+	}
+	msg = packUint32(msg, r.Serial)
+	msg = packUint32(msg, r.Refresh)
+	msg = packUint32(msg, r.Retry)
+	msg = packUint32(msg, r.Expire)
+	return packUint32(msg, r.MinTTL), nil
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (r *SOAResource) GoString() string {
+	return "dnsmessage.SOAResource{" +
+		"NS: " + r.NS.GoString() + ", " +
+		"MBox: " + r.MBox.GoString() + ", " +
+		"Serial: " + printUint32(r.Serial) + ", " +
+		"Refresh: " + printUint32(r.Refresh) + ", " +
+		"Retry: " + printUint32(r.Retry) + ", " +
+		"Expire: " + printUint32(r.Expire) + ", " +
+		"MinTTL: " + printUint32(r.MinTTL) + "}"
+}
+
+// String implements ResourceBody.String.
+func (r *SOAResource) String() string {
+	return r.NS.String() + " " +
+		r.MBox.String() + " " +
+		printUint32(r.Serial) + " " +
+		printUint32(r.Refresh) + " " +
+		printUint32(r.Retry) + " " +
+		printUint32(r.Expire) + " " +
+		printUint32(r.MinTTL)
+}
+
+func unpackSOAResource(msg []byte, off int) (SOAResource, error) {
+	var ns Name
+	off, err := ns.unpack(msg, off)
+	if err != nil {
+		return SOAResource{}, &nestedError{"NS", err}
+	}
+	var mbox Name
+	if off, err = mbox.unpack(msg, off); err != nil {
+		return SOAResource{}, &nestedError{"MBox", err}
+	}
+	serial, off, err := unpackUint32(msg, off)
+	if err != nil {
+		return SOAResource{}, &nestedError{"Serial", err}
+	}
+	refresh, off, err := unpackUint32(msg, off)
+	if err != nil {
+		return SOAResource{}, &nestedError{"Refresh", err}
+	}
+	retry, off, err := unpackUint32(msg, off)
+	if err != nil {
+		return SOAResource{}, &nestedError{"Retry", err}
+	}
+	expire, off, err := unpackUint32(msg, off)
+	if err != nil {
+		return SOAResource{}, &nestedError{"Expire", err}
+	}
+	minTTL, _, err := unpackUint32(msg, off)
+	if err != nil {
+		return SOAResource{}, &nestedError{"MinTTL", err}
+	}
+	return SOAResource{ns, mbox, serial, refresh, retry, expire, minTTL}, nil
+}
+
+// A TXTResource is a TXT Resource record.
+type TXTResource struct {
+	TXT []string
+}
+
+func (r *TXTResource) realType() Type {
+	return TypeTXT
+}
+
+// pack appends the wire format of the TXTResource to msg.
+func (r *TXTResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	oldMsg := msg
+	for _, s := range r.TXT {
+		var err error
+		msg, err = packText(msg, s)
+		if err != nil {
+			return oldMsg, err
+		}
+	}
+	return msg, nil
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (r *TXTResource) GoString() string {
+	s := "dnsmessage.TXTResource{TXT: []string{"
+	if len(r.TXT) == 0 {
+		return s + "}}"
+	}
+	s += `"` + printString([]byte(r.TXT[0]))
+	for _, t := range r.TXT[1:] {
+		s += `", "` + printString([]byte(t))
+	}
+	return s + `"}}`
+}
+
+// String implements ResourceBody.String.
+func (r *TXTResource) String() string {
+	s := ""
+	for i, t := range r.TXT {
+		if i > 0 {
+			s += " "
+		}
+		s += printCharacterString(t)
+	}
+	return s
+}
+
+func unpackTXTResource(msg []byte, off int, length uint16) (TXTResource, error) {
+	txts := make([]string, 0, 1)
+	for n := uint16(0); n < length; {
+		var t string
+		var err error
+		if t, off, err = unpackText(msg, off); err != nil {
+			return TXTResource{}, &nestedError{"text", err}
+		}
+		// Check if we got too many bytes.
+		if length-n < uint16(len(t))+1 {
+			return TXTResource{}, errCalcLen
+		}
+		n += uint16(len(t)) + 1
+		txts = append(txts, t)
+	}
+	return TXTResource{txts}, nil
+}
+
+// An SRVResource is an SRV Resource record.
+type SRVResource struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   Name // Not compressed as per RFC 2782.
+}
+
+func (r *SRVResource) realType() Type {
+	return TypeSRV
+}
+
+// pack appends the wire format of the SRVResource to msg.
+func (r *SRVResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	oldMsg := msg
+	msg = packUint16(msg, r.Priority)
+	msg = packUint16(msg, r.Weight)
+	msg = packUint16(msg, r.Port)
+	msg, err := r.Target.pack(msg, nil, compressionOff)
+	if err != nil {
+		return oldMsg, &nestedError{"SRVResource.Target", err}
+	}
+	return msg, nil
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (r *SRVResource) GoString() string {
+	return "dnsmessage.SRVResource{" +
+		"Priority: " + printUint16(r.Priority) + ", " +
+		"Weight: " + printUint16(r.Weight) + ", " +
+		"Port: " + printUint16(r.Port) + ", " +
+		"Target: " + r.Target.GoString() + "}"
+}
+
+// String implements ResourceBody.String.
+func (r *SRVResource) String() string {
+	return printUint16(r.Priority) + " " +
+		printUint16(r.Weight) + " " +
+		printUint16(r.Port) + " " +
+		r.Target.String()
+}
+
+func unpackSRVResource(msg []byte, off int) (SRVResource, error) {
+	priority, off, err := unpackUint16(msg, off)
+	if err != nil {
+		return SRVResource{}, &nestedError{"Priority", err}
+	}
+	weight, off, err := unpackUint16(msg, off)
+	if err != nil {
+		return SRVResource{}, &nestedError{"Weight", err}
+	}
+	port, off, err := unpackUint16(msg, off)
+	if err != nil {
+		return SRVResource{}, &nestedError{"Port", err}
+	}
+	var target Name
+	if _, err := target.unpackCompressed(msg, off, false /* allowCompression */); err != nil {
+		return SRVResource{}, &nestedError{"Target", err}
+	}
+	return SRVResource{priority, weight, port, target}, nil
+}
+
+// An AResource is an A Resource record.
+type AResource struct {
+	A [4]byte
+}
+
+func (r *AResource) realType() Type {
+	return TypeA
+}
+
+// pack appends the wire format of the AResource to msg.
+func (r *AResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	return packBytes(msg, r.A[:]), nil
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (r *AResource) GoString() string {
+	return "dnsmessage.AResource{" +
+		"A: [4]byte{" + printByteSlice(r.A[:]) + "}}"
+}
+
+// String implements ResourceBody.String.
+func (r *AResource) String() string {
+	return printIPv4(r.A[:])
+}
+
+func unpackAResource(msg []byte, off int) (AResource, error) {
+	var a [4]byte
+	if _, err := unpackBytes(msg, off, a[:]); err != nil {
+		return AResource{}, err
+	}
+	return AResource{a}, nil
+}
+
+// An AAAAResource is an AAAA Resource record.
+type AAAAResource struct {
+	AAAA [16]byte
+}
+
+func (r *AAAAResource) realType() Type {
+	return TypeAAAA
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (r *AAAAResource) GoString() string {
+	return "dnsmessage.AAAAResource{" +
+		"AAAA: [16]byte{" + printByteSlice(r.AAAA[:]) + "}}"
+}
+
+// String implements ResourceBody.String.
+func (r *AAAAResource) String() string {
+	return printIPv6(r.AAAA)
+}
+
+// pack appends the wire format of the AAAAResource to msg.
+func (r *AAAAResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	return packBytes(msg, r.AAAA[:]), nil
+}
+
+func unpackAAAAResource(msg []byte, off int) (AAAAResource, error) {
+	var aaaa [16]byte
+	if _, err := unpackBytes(msg, off, aaaa[:]); err != nil {
+		return AAAAResource{}, err
+	}
+	return AAAAResource{aaaa}, nil
+}
+
+// An OPTResource is an OPT pseudo Resource record.
+//
+// The pseudo resource record is part of the extension mechanisms for DNS
+// as defined in RFC 6891.
+type OPTResource struct {
+	Options []Option
+}
+
+// An Option represents a DNS message option within OPTResource.
+//
+// The message option is part of the extension mechanisms for DNS as
+// defined in RFC 6891.
+type Option struct {
+	Code uint16 // option code
+	Data []byte
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (o *Option) GoString() string {
+	return "dnsmessage.Option{" +
+		"Code: " + printUint16(o.Code) + ", " +
+		"Data: []byte{" + printByteSlice(o.Data) + "}}"
+}
+
+func (r *OPTResource) realType() Type {
+	return TypeOPT
+}
+
+func (r *OPTResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	for _, opt := range r.Options {
+		msg = packUint16(msg, opt.Code)
+		l := uint16(len(opt.Data))
+		msg = packUint16(msg, l)
+		msg = packBytes(msg, opt.Data)
+	}
+	return msg, nil
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (r *OPTResource) GoString() string {
+	s := "dnsmessage.OPTResource{Options: []dnsmessage.Option{"
+	if len(r.Options) == 0 {
+		return s + "}}"
+	}
+	s += r.Options[0].GoString()
+	for _, o := range r.Options[1:] {
+		s += ", " + o.GoString()
+	}
+	return s + "}}"
+}
+
+// String implements ResourceBody.String.
+//
+// OPT has no presentation format of its own (RFC 6891, section 6.1.1), so
+// the generic form of RFC 3597 is used.
+func (r *OPTResource) String() string {
+	msg, _ := r.pack(nil, nil, 0)
+	return printUnknownRData(msg)
+}
+
+func unpackOPTResource(msg []byte, off int, length uint16) (OPTResource, error) {
+	var opts []Option
+	for oldOff := off; off < oldOff+int(length); {
+		var err error
+		var o Option
+		o.Code, off, err = unpackUint16(msg, off)
+		if err != nil {
+			return OPTResource{}, &nestedError{"Code", err}
+		}
+		var l uint16
+		l, off, err = unpackUint16(msg, off)
+		if err != nil {
+			return OPTResource{}, &nestedError{"Data", err}
+		}
+		o.Data = make([]byte, l)
+		if copy(o.Data, msg[off:]) != int(l) {
+			return OPTResource{}, &nestedError{"Data", errCalcLen}
+		}
+		off += int(l)
+		opts = append(opts, o)
+	}
+	return OPTResource{opts}, nil
+}
+
+// An OptionIterator iterates over the options of an OPT record, in the
+// order in which they appear in the message. It is returned by
+// Parser.OPTOptions.
+type OptionIterator struct {
+	rdata []byte // options not yet returned
+	err   error
+}
+
+// Next returns the next option. It returns false once all options
+// were returned, or if the next one extends beyond the end of the
+// record's data, in which case Err returns the error.
+//
+// The Data of the returned option refers to the message passed to
+// Parser.Start and must not be modified.
+func (it *OptionIterator) Next() (Option, bool) {
+	if len(it.rdata) == 0 || it.err != nil {
+		return Option{}, false
+	}
+	code, off, err := unpackUint16(it.rdata, 0)
+	if err != nil {
+		it.err = &nestedError{"Code", err}
+		return Option{}, false
 	}
-	return r, off + int(hdr.Length), nil
+	l, off, err := unpackUint16(it.rdata, off)
+	if err != nil {
+		it.err = &nestedError{"Data", err}
+		return Option{}, false
+	}
+	end := off + int(l)
+	if end > len(it.rdata) {
+		it.err = &nestedError{"Data", errCalcLen}
+		return Option{}, false
+	}
+	o := Option{Code: code, Data: it.rdata[off:end:end]}
+	it.rdata = it.rdata[end:]
+	return o, true
 }
 
-// A CNAMEResource is a CNAME Resource record.
-type CNAMEResource struct {
-	CNAME Name
+// Err returns the error that stopped Next, if any.
+func (it *OptionIterator) Err() error {
+	return it.err
 }
 
-func (r *CNAMEResource) realType() Type {
-	return TypeCNAME
+// A KEYResource is a KEY Resource record, as defined in RFC 2535,
+// section 3.
+//
+// KEY is a legacy record type. It was superseded by DNSKEY for DNSSEC
+// and is now only used by SIG(0) and TKEY (RFC 3755 and RFC 2931).
+type KEYResource struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
 }
 
-// pack appends the wire format of the CNAMEResource to msg.
-func (r *CNAMEResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
-	return r.CNAME.pack(msg, compression, compressionOff)
+func (r *KEYResource) realType() Type {
+	return TypeKEY
 }
 
-// GoString implements fmt.GoStringer.GoString.
-func (r *CNAMEResource) GoString() string {
-	return "dnsmessage.CNAMEResource{CNAME: " + r.CNAME.GoString() + "}"
+// pack appends the wire format of the KEYResource to msg.
+func (r *KEYResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	msg = packUint16(msg, r.Flags)
+	msg = packUint8(msg, r.Protocol)
+	msg = packUint8(msg, r.Algorithm)
+	return packBytes(msg, r.PublicKey), nil
 }
 
-func unpackCNAMEResource(msg []byte, off int) (CNAMEResource, error) {
-	var cname Name
-	if _, err := cname.unpack(msg, off); err != nil {
-		return CNAMEResource{}, err
-	}
-	return CNAMEResource{cname}, nil
+// GoString implements fmt.GoStringer.GoString.
+func (r *KEYResource) GoString() string {
+	return "dnsmessage.KEYResource{" +
+		"Flags: " + printUint16(r.Flags) + ", " +
+		"Protocol: " + printUint32(uint32(r.Protocol)) + ", " +
+		"Algorithm: " + printUint32(uint32(r.Algorithm)) + ", " +
+		"PublicKey: []byte{" + printByteSlice(r.PublicKey) + "}}"
 }
 
-// An MXResource is an MX Resource record.
-type MXResource struct {
-	Pref uint16
-	MX   Name
+// String implements ResourceBody.String.
+func (r *KEYResource) String() string {
+	return printUint16(r.Flags) + " " +
+		printUint32(uint32(r.Protocol)) + " " +
+		printUint32(uint32(r.Algorithm)) + " " +
+		printBase64(r.PublicKey)
 }
 
-func (r *MXResource) realType() Type {
-	return TypeMX
+func unpackKEYResource(msg []byte, off int, length uint16) (KEYResource, error) {
+	end := off + int(length)
+	flags, off, err := unpackUint16(msg, off)
+	if err != nil {
+		return KEYResource{}, &nestedError{"Flags", err}
+	}
+	protocol, off, err := unpackUint8(msg, off)
+	if err != nil {
+		return KEYResource{}, &nestedError{"Protocol", err}
+	}
+	algorithm, off, err := unpackUint8(msg, off)
+	if err != nil {
+		return KEYResource{}, &nestedError{"Algorithm", err}
+	}
+	if off > end {
+		return KEYResource{}, errCalcLen
+	}
+	key := make([]byte, end-off)
+	if _, err := unpackBytes(msg, off, key); err != nil {
+		return KEYResource{}, &nestedError{"PublicKey", err}
+	}
+	return KEYResource{flags, protocol, algorithm, key}, nil
 }
 
-// pack appends the wire format of the MXResource to msg.
-func (r *MXResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+// A SIGResource is a SIG Resource record, as defined in RFC 2535,
+// section 4.
+//
+// SIG is a legacy record type. It was superseded by RRSIG for DNSSEC
+// and is now only used for transaction signatures (SIG(0), RFC 2931).
+// Expiration and Inception are in seconds since the Unix epoch, using
+// serial number arithmetic (RFC 1982).
+type SIGResource struct {
+	TypeCovered Type
+	Algorithm   uint8
+	Labels      uint8
+	OriginalTTL uint32
+	Expiration  uint32
+	Inception   uint32
+	KeyTag      uint16
+	SignerName  Name // Never compressed when packed; see RFC 3597, section 4.
+	Signature   []byte
+}
+
+func (r *SIGResource) realType() Type {
+	return TypeSIG
+}
+
+// pack appends the wire format of the SIGResource to msg.
+func (r *SIGResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
 	oldMsg := msg
-	msg = packUint16(msg, r.Pref)
-	msg, err := r.MX.pack(msg, compression, compressionOff)
+	msg = packType(msg, r.TypeCovered)
+	msg = packUint8(msg, r.Algorithm)
+	msg = packUint8(msg, r.Labels)
+	msg = packUint32(msg, r.OriginalTTL)
+	msg = packUint32(msg, r.Expiration)
+	msg = packUint32(msg, r.Inception)
+	msg = packUint16(msg, r.KeyTag)
+	msg, err := r.SignerName.pack(msg, nil, compressionOff)
 	if err != nil {
-		return oldMsg, &nestedError{"MXResource.MX", err}
+		return oldMsg, &nestedError{"SIGResource.SignerName", err}
 	}
-	return msg, nil
+	return packBytes(msg, r.Signature), nil
 }
 
 // GoString implements fmt.GoStringer.GoString.
-func (r *MXResource) GoString() string {
-	return "dnsmessage.MXResource{" +
-		"Pref: " + printUint16(r.Pref) + ", " +
-		"MX: " + r.MX.GoString() + "}"
+func (r *SIGResource) GoString() string {
+	return "dnsmessage.SIGResource{" +
+		"TypeCovered: " + r.TypeCovered.GoString() + ", " +
+		"Algorithm: " + printUint32(uint32(r.Algorithm)) + ", " +
+		"Labels: " + printUint32(uint32(r.Labels)) + ", " +
+		"OriginalTTL: " + printUint32(r.OriginalTTL) + ", " +
+		"Expiration: " + printUint32(r.Expiration) + ", " +
+		"Inception: " + printUint32(r.Inception) + ", " +
+		"KeyTag: " + printUint16(r.KeyTag) + ", " +
+		"SignerName: " + r.SignerName.GoString() + ", " +
+		"Signature: []byte{" + printByteSlice(r.Signature) + "}}"
+}
+
+// String implements ResourceBody.String.
+func (r *SIGResource) String() string {
+	return r.TypeCovered.mnemonic() + " " +
+		printUint32(uint32(r.Algorithm)) + " " +
+		printUint32(uint32(r.Labels)) + " " +
+		printUint32(r.OriginalTTL) + " " +
+		printTimestamp(r.Expiration) + " " +
+		printTimestamp(r.Inception) + " " +
+		printUint16(r.KeyTag) + " " +
+		r.SignerName.String() + " " +
+		printBase64(r.Signature)
+}
+
+func unpackSIGResource(msg []byte, off int, length uint16, allowCompression bool) (SIGResource, error) {
+	end := off + int(length)
+	var r SIGResource
+	var err error
+	if r.TypeCovered, off, err = unpackType(msg, off); err != nil {
+		return SIGResource{}, &nestedError{"TypeCovered", err}
+	}
+	if r.Algorithm, off, err = unpackUint8(msg, off); err != nil {
+		return SIGResource{}, &nestedError{"Algorithm", err}
+	}
+	if r.Labels, off, err = unpackUint8(msg, off); err != nil {
+		return SIGResource{}, &nestedError{"Labels", err}
+	}
+	if r.OriginalTTL, off, err = unpackUint32(msg, off); err != nil {
+		return SIGResource{}, &nestedError{"OriginalTTL", err}
+	}
+	if r.Expiration, off, err = unpackUint32(msg, off); err != nil {
+		return SIGResource{}, &nestedError{"Expiration", err}
+	}
+	if r.Inception, off, err = unpackUint32(msg, off); err != nil {
+		return SIGResource{}, &nestedError{"Inception", err}
+	}
+	if r.KeyTag, off, err = unpackUint16(msg, off); err != nil {
+		return SIGResource{}, &nestedError{"KeyTag", err}
+	}
+	// RFC 3597, section 4: receivers should decompress SIG names.
+	if off, err = r.SignerName.unpackCompressed(msg, off, allowCompression); err != nil {
+		return SIGResource{}, &nestedError{"SignerName", err}
+	}
+	if off > end {
+		return SIGResource{}, errCalcLen
+	}
+	r.Signature = make([]byte, end-off)
+	if _, err := unpackBytes(msg, off, r.Signature); err != nil {
+		return SIGResource{}, &nestedError{"Signature", err}
+	}
+	return r, nil
 }
 
-func unpackMXResource(msg []byte, off int) (MXResource, error) {
-	pref, off, err := unpackUint16(msg, off)
+// SIG0SignedData returns the data covered by the signature of sig, a
+// SIG(0) transaction signature, as defined in RFC 2931, section 3.1:
+// the RDATA of sig without its Signature, followed by query, followed
+// by msg.
+//
+// msg is the packed message being signed, without the SIG(0) record.
+// query is nil when signing a request. When signing a response, it is
+// the packed request being answered, including its own SIG(0) record,
+// if any.
+//
+// The returned data is passed to the signature algorithm identified by
+// sig.Algorithm; this package does not implement any of them.
+func SIG0SignedData(sig *SIGResource, query, msg []byte) ([]byte, error) {
+	r := *sig
+	r.Signature = nil
+	b := make([]byte, 0, 18+int(r.SignerName.Length)+len(query)+len(msg))
+	b, err := r.pack(b, nil, 0)
 	if err != nil {
-		return MXResource{}, &nestedError{"Pref", err}
+		return nil, err
 	}
-	var mx Name
-	if _, err := mx.unpack(msg, off); err != nil {
-		return MXResource{}, &nestedError{"MX", err}
+	b = append(b, query...)
+	return append(b, msg...), nil
+}
+
+// AppendSIG0 returns msg, a packed message, with a SIG(0) record
+// appended to its additional section. The signature is computed by
+// calling sign with the data returned by SIG0SignedData, and stored in
+// the record's Signature. query is as described for SIG0SignedData.
+//
+// The record is given the root name, class ANY and a TTL of zero. The
+// TypeCovered, Labels and OriginalTTL fields of sig should be zero.
+//
+// msg is not modified. It must not already contain a SIG(0) record,
+// which must be the last record of a message.
+func AppendSIG0(msg, query []byte, sig SIGResource, sign func(data []byte) ([]byte, error)) ([]byte, error) {
+	if len(msg) < headerLen {
+		return nil, errBaseLen
+	}
+	arcount := uint16(msg[10])<<8 | uint16(msg[11])
+	if arcount == ^uint16(0) {
+		return nil, errTooManyAdditionals
 	}
-	return MXResource{pref, mx}, nil
+	data, err := SIG0SignedData(&sig, query, msg)
+	if err != nil {
+		return nil, err
+	}
+	if sig.Signature, err = sign(data); err != nil {
+		return nil, err
+	}
+	hdr := ResourceHeader{Name: Name{Data: [255]byte{'.'}, Length: 1}, Type: TypeSIG, Class: ClassANY}
+	b := make([]byte, len(msg), len(msg)+len(data)+len(sig.Signature))
+	copy(b, msg)
+	b, lenOff, err := hdr.pack(b, nil, 0)
+	if err != nil {
+		return nil, &nestedError{"ResourceHeader", err}
+	}
+	preLen := len(b)
+	if b, err = sig.pack(b, nil, 0); err != nil {
+		return nil, &nestedError{"SIGResource body", err}
+	}
+	if err := hdr.fixLen(b, lenOff, preLen); err != nil {
+		return nil, err
+	}
+	packUint16(b[10:10], arcount+1)
+	return b, nil
 }
 
-// An NSResource is an NS Resource record.
-type NSResource struct {
-	NS Name
+// SplitSIG0 splits msg, a packed message ending with a SIG(0) record,
+// into the message without that record and the record itself. The
+// returned message has its additional record count decremented, and
+// is the data passed to SIG0SignedData to verify the signature.
+func SplitSIG0(msg []byte) ([]byte, SIGResource, error) {
+	var p Parser
+	if _, err := p.Start(msg); err != nil {
+		return nil, SIGResource{}, err
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, SIGResource{}, err
+	}
+	if err := p.SkipAllAnswers(); err != nil {
+		return nil, SIGResource{}, err
+	}
+	if err := p.SkipAllAuthorities(); err != nil {
+		return nil, SIGResource{}, err
+	}
+	var (
+		off   = -1
+		sig   SIGResource
+		found bool
+	)
+	for {
+		start := p.off
+		h, err := p.AdditionalHeader()
+		if err == ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, SIGResource{}, err
+		}
+		found = false
+		if h.Type == TypeSIG {
+			if sig, err = p.SIGResource(); err != nil {
+				return nil, SIGResource{}, err
+			}
+			found = sig.TypeCovered == 0
+			off = start
+			continue
+		}
+		if err := p.SkipAdditional(); err != nil {
+			return nil, SIGResource{}, err
+		}
+	}
+	if !found {
+		return nil, SIGResource{}, errNoSIG0
+	}
+	b := make([]byte, off)
+	copy(b, msg)
+	packUint16(b[10:10], uint16(p.header.additionals-1))
+	return b, sig, nil
 }
 
-func (r *NSResource) realType() Type {
-	return TypeNS
+// VerifySIG0 verifies the SIG(0) record ending msg, a packed message.
+// It calls verify with the record and the data returned by
+// SIG0SignedData, and returns its error. query is as described for
+// SIG0SignedData.
+//
+// verify is responsible for checking the signature against the public
+// key named by sig.SignerName and sig.KeyTag, and for checking that
+// the current time is between sig.Inception and sig.Expiration.
+func VerifySIG0(msg, query []byte, verify func(sig *SIGResource, data []byte) error) error {
+	unsigned, sig, err := SplitSIG0(msg)
+	if err != nil {
+		return err
+	}
+	data, err := SIG0SignedData(&sig, query, unsigned)
+	if err != nil {
+		return err
+	}
+	return verify(&sig, data)
 }
 
-// pack appends the wire format of the NSResource to msg.
-func (r *NSResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
-	return r.NS.pack(msg, compression, compressionOff)
+// Flags of a CSYNCResource.
+const (
+	// CSYNCFlagImmediate asks the parent to process the record
+	// without waiting for SOASerial to be reached.
+	CSYNCFlagImmediate uint16 = 1 << 0
+	// CSYNCFlagSOAMinimum asks the parent to check that the child's
+	// SOA serial is at least SOASerial before synchronizing.
+	CSYNCFlagSOAMinimum uint16 = 1 << 1
+)
+
+// A CSYNCResource is a CSYNC Resource record, as defined in RFC 7477.
+// It lists the types of the records at the apex of a child zone that
+// its parent should copy.
+type CSYNCResource struct {
+	SOASerial uint32
+	Flags     uint16
+
+	// Types is encoded as a type bitmap, as in NSEC records. When
+	// packed, it is sorted and duplicates are removed; when unpacked,
+	// it is in ascending order.
+	Types []Type
 }
 
-// GoString implements fmt.GoStringer.GoString.
-func (r *NSResource) GoString() string {
-	return "dnsmessage.NSResource{NS: " + r.NS.GoString() + "}"
+func (r *CSYNCResource) realType() Type {
+	return TypeCSYNC
 }
 
-func unpackNSResource(msg []byte, off int) (NSResource, error) {
-	var ns Name
-	if _, err := ns.unpack(msg, off); err != nil {
-		return NSResource{}, err
-	}
-	return NSResource{ns}, nil
+// pack appends the wire format of the CSYNCResource to msg.
+func (r *CSYNCResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	msg = packUint32(msg, r.SOASerial)
+	msg = packUint16(msg, r.Flags)
+	return packTypeBitmap(msg, r.Types), nil
 }
 
-// A PTRResource is a PTR Resource record.
-type PTRResource struct {
-	PTR Name
+// GoString implements fmt.GoStringer.GoString.
+func (r *CSYNCResource) GoString() string {
+	return "dnsmessage.CSYNCResource{" +
+		"SOASerial: " + printUint32(r.SOASerial) + ", " +
+		"Flags: " + printUint16(r.Flags) + ", " +
+		"Types: " + goStringTypes(r.Types) + "}"
 }
 
-func (r *PTRResource) realType() Type {
-	return TypePTR
+// String implements ResourceBody.String.
+func (r *CSYNCResource) String() string {
+	s := printUint32(r.SOASerial) + " " + printUint16(r.Flags)
+	for _, t := range r.Types {
+		s += " " + t.mnemonic()
+	}
+	return s
 }
 
-// pack appends the wire format of the PTRResource to msg.
-func (r *PTRResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
-	return r.PTR.pack(msg, compression, compressionOff)
+func unpackCSYNCResource(msg []byte, off int, length uint16) (CSYNCResource, error) {
+	end := off + int(length)
+	serial, off, err := unpackUint32(msg, off)
+	if err != nil {
+		return CSYNCResource{}, &nestedError{"SOASerial", err}
+	}
+	flags, off, err := unpackUint16(msg, off)
+	if err != nil {
+		return CSYNCResource{}, &nestedError{"Flags", err}
+	}
+	if off > end {
+		return CSYNCResource{}, errCalcLen
+	}
+	types, err := unpackTypeBitmap(msg, off, end)
+	if err != nil {
+		return CSYNCResource{}, &nestedError{"Types", err}
+	}
+	return CSYNCResource{serial, flags, types}, nil
 }
 
-// GoString implements fmt.GoStringer.GoString.
-func (r *PTRResource) GoString() string {
-	return "dnsmessage.PTRResource{PTR: " + r.PTR.GoString() + "}"
+// packTypeBitmap appends types to msg in the type bitmap format of
+// RFC 4034, section 4.1.2, used by NSEC, NSEC3 and CSYNC records. The
+// types need not be sorted or unique.
+func packTypeBitmap(msg []byte, types []Type) []byte {
+	sorted := make([]Type, len(types))
+	copy(sorted, types)
+	// Insertion sort: type lists are short.
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && sorted[j] < sorted[j-1]; j-- {
+			sorted[j], sorted[j-1] = sorted[j-1], sorted[j]
+		}
+	}
+	for i := 0; i < len(sorted); {
+		window := byte(sorted[i] >> 8)
+		var bitmap [32]byte
+		n := 0
+		for ; i < len(sorted) && byte(sorted[i]>>8) == window; i++ {
+			b := byte(sorted[i])
+			bitmap[b/8] |= 0x80 >> (b % 8)
+			n = int(b/8) + 1
+		}
+		msg = append(msg, window, byte(n))
+		msg = append(msg, bitmap[:n]...)
+	}
+	return msg
 }
 
-func unpackPTRResource(msg []byte, off int) (PTRResource, error) {
-	var ptr Name
-	if _, err := ptr.unpack(msg, off); err != nil {
-		return PTRResource{}, err
+// unpackTypeBitmap unpacks the type bitmap in msg[off:end], in the
+// format of RFC 4034, section 4.1.2.
+func unpackTypeBitmap(msg []byte, off, end int) ([]Type, error) {
+	if end > len(msg) {
+		return nil, errResourceLen
 	}
-	return PTRResource{ptr}, nil
+	var types []Type
+	lastWindow := -1
+	for off < end {
+		if off+2 > end {
+			return nil, errTypeBitmap
+		}
+		window, n := int(msg[off]), int(msg[off+1])
+		off += 2
+		if window <= lastWindow || n == 0 || n > 32 || off+n > end {
+			return nil, errTypeBitmap
+		}
+		lastWindow = window
+		for i, b := range msg[off : off+n] {
+			for bit := 0; bit < 8; bit++ {
+				if b&(0x80>>bit) != 0 {
+					types = append(types, Type(window<<8|i*8+bit))
+				}
+			}
+		}
+		off += n
+	}
+	return types, nil
 }
 
-// An SOAResource is an SOA Resource record.
-type SOAResource struct {
-	NS      Name
-	MBox    Name
-	Serial  uint32
-	Refresh uint32
-	Retry   uint32
-	Expire  uint32
+func goStringTypes(types []Type) string {
+	s := "[]dnsmessage.Type{"
+	for i, t := range types {
+		if i > 0 {
+			s += ", "
+		}
+		s += t.GoString()
+	}
+	return s + "}"
+}
 
-	// MinTTL the is the default TTL of Resources records which did not
-	// contain a TTL value and the TTL of negative responses. (RFC 2308
-	// Section 4)
-	MinTTL uint32
+// Address families of an APLPrefix.
+const (
+	APLFamilyIPv4 uint16 = 1
+	APLFamilyIPv6 uint16 = 2
+)
+
+// An APLResource is an APL Resource record, as defined in RFC 3123.
+// It holds a list of address prefixes.
+type APLResource struct {
+	Prefixes []APLPrefix
 }
 
-func (r *SOAResource) realType() Type {
-	return TypeSOA
+// An APLPrefix is an address prefix within an APLResource.
+type APLPrefix struct {
+	Family   uint16 // IANA address family number, such as APLFamilyIPv4
+	Prefix   uint8  // prefix length in bits
+	Negation bool   // whether the prefix is excluded from the list
+
+	// AddressFamilyData is the address, in the format of Family,
+	// without trailing zero bytes. When packed, any trailing zero
+	// bytes are removed; it may then be at most 127 bytes long.
+	AddressFamilyData []byte
 }
 
-// pack appends the wire format of the SOAResource to msg.
-func (r *SOAResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
-	oldMsg := msg
-	msg, err := r.NS.pack(msg, compression, compressionOff)
-	if err != nil {
-		return oldMsg, &nestedError{"SOAResource.NS", err}
-	}
-	msg, err = r.MBox.pack(msg, compression, compressionOff)
-	if err != nil {
-		return oldMsg, &nestedError{"SOAResource.MBox", err}
+// GoString implements fmt.GoStringer.GoString.
+func (a *APLPrefix) GoString() string {
+	return "dnsmessage.APLPrefix{" +
+		"Family: " + printUint16(a.Family) + ", " +
+		"Prefix: " + printUint16(uint16(a.Prefix)) + ", " +
+		"Negation: " + printBool(a.Negation) + ", " +
+		"AddressFamilyData: []byte{" + printByteSlice(a.AddressFamilyData) + "}}"
+}
+
+// String returns a in the presentation format of RFC 3123, section 5,
+// such as "!1:192.168.38.0/28". The address of a family other than
+// APLFamilyIPv4 or APLFamilyIPv6 is printed in hexadecimal.
+func (a *APLPrefix) String() string {
+	var s string
+	if a.Negation {
+		s = "!"
+	}
+	s += printUint16(a.Family) + ":"
+	switch {
+	case a.Family == APLFamilyIPv4 && len(a.AddressFamilyData) <= 4:
+		var ip [4]byte
+		copy(ip[:], a.AddressFamilyData)
+		s += printIPv4(ip[:])
+	case a.Family == APLFamilyIPv6 && len(a.AddressFamilyData) <= 16:
+		var ip [16]byte
+		copy(ip[:], a.AddressFamilyData)
+		s += printIPv6(ip)
+	default:
+		s += printHex(a.AddressFamilyData)
 	}
-	msg = packUint32(msg, r.Serial)
-	msg = packUint32(msg, r.Refresh)
-	msg = packUint32(msg, r.Retry)
-	msg = packUint32(msg, r.Expire)
-	return packUint32(msg, r.MinTTL), nil
+	return s + "/" + printUint16(uint16(a.Prefix))
 }
 
-// GoString implements fmt.GoStringer.GoString.
-func (r *SOAResource) GoString() string {
-	return "dnsmessage.SOAResource{" +
-		"NS: " + r.NS.GoString() + ", " +
-		"MBox: " + r.MBox.GoString() + ", " +
-		"Serial: " + printUint32(r.Serial) + ", " +
-		"Refresh: " + printUint32(r.Refresh) + ", " +
-		"Retry: " + printUint32(r.Retry) + ", " +
-		"Expire: " + printUint32(r.Expire) + ", " +
-		"MinTTL: " + printUint32(r.MinTTL) + "}"
+func (r *APLResource) realType() Type {
+	return TypeAPL
 }
 
-func unpackSOAResource(msg []byte, off int) (SOAResource, error) {
-	var ns Name
-	off, err := ns.unpack(msg, off)
-	if err != nil {
-		return SOAResource{}, &nestedError{"NS", err}
-	}
-	var mbox Name
-	if off, err = mbox.unpack(msg, off); err != nil {
-		return SOAResource{}, &nestedError{"MBox", err}
-	}
-	serial, off, err := unpackUint32(msg, off)
-	if err != nil {
-		return SOAResource{}, &nestedError{"Serial", err}
+// pack appends the wire format of the APLResource to msg.
+func (r *APLResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	for _, a := range r.Prefixes {
+		afd := a.AddressFamilyData
+		for len(afd) > 0 && afd[len(afd)-1] == 0 {
+			afd = afd[:len(afd)-1]
+		}
+		if len(afd) > 0x7f {
+			return nil, errAPLDataTooLong
+		}
+		n := byte(len(afd))
+		if a.Negation {
+			n |= 0x80
+		}
+		msg = packUint16(msg, a.Family)
+		msg = append(msg, a.Prefix, n)
+		msg = packBytes(msg, afd)
 	}
-	refresh, off, err := unpackUint32(msg, off)
-	if err != nil {
-		return SOAResource{}, &nestedError{"Refresh", err}
+	return msg, nil
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (r *APLResource) GoString() string {
+	s := "dnsmessage.APLResource{Prefixes: []dnsmessage.APLPrefix{"
+	for i := range r.Prefixes {
+		if i > 0 {
+			s += ", "
+		}
+		s += r.Prefixes[i].GoString()
 	}
-	retry, off, err := unpackUint32(msg, off)
-	if err != nil {
-		return SOAResource{}, &nestedError{"Retry", err}
+	return s + "}}"
+}
+
+// String implements ResourceBody.String.
+func (r *APLResource) String() string {
+	var s string
+	for i := range r.Prefixes {
+		if i > 0 {
+			s += " "
+		}
+		s += r.Prefixes[i].String()
 	}
-	expire, off, err := unpackUint32(msg, off)
-	if err != nil {
-		return SOAResource{}, &nestedError{"Expire", err}
+	return s
+}
+
+func unpackAPLResource(msg []byte, off int, length uint16) (APLResource, error) {
+	var prefixes []APLPrefix
+	end := off + int(length)
+	for off < end {
+		var err error
+		var a APLPrefix
+		a.Family, off, err = unpackUint16(msg, off)
+		if err != nil {
+			return APLResource{}, &nestedError{"Family", err}
+		}
+		a.Prefix, off, err = unpackUint8(msg, off)
+		if err != nil {
+			return APLResource{}, &nestedError{"Prefix", err}
+		}
+		var n uint8
+		n, off, err = unpackUint8(msg, off)
+		if err != nil {
+			return APLResource{}, &nestedError{"AddressFamilyData", err}
+		}
+		a.Negation = n&0x80 != 0
+		a.AddressFamilyData = make([]byte, n&0x7f)
+		if off+len(a.AddressFamilyData) > end {
+			return APLResource{}, &nestedError{"AddressFamilyData", errCalcLen}
+		}
+		if off, err = unpackBytes(msg, off, a.AddressFamilyData); err != nil {
+			return APLResource{}, &nestedError{"AddressFamilyData", err}
+		}
+		prefixes = append(prefixes, a)
 	}
-	minTTL, _, err := unpackUint32(msg, off)
-	if err != nil {
-		return SOAResource{}, &nestedError{"MinTTL", err}
+	if off != end {
+		return APLResource{}, errCalcLen
 	}
-	return SOAResource{ns, mbox, serial, refresh, retry, expire, minTTL}, nil
+	return APLResource{prefixes}, nil
 }
 
-// A TXTResource is a TXT Resource record.
-type TXTResource struct {
-	TXT []string
+// A HIPResource is a HIP Resource record, as defined in RFC 8005. It
+// holds the Host Identity of a host using the Host Identity Protocol,
+// and the rendezvous servers through which it can be reached.
+type HIPResource struct {
+	// PublicKeyAlgorithm is the IPSECKEY algorithm number of
+	// PublicKey, such as 2 for RSA.
+	PublicKeyAlgorithm uint8
+
+	// HIT is the Host Identity Tag, at most 255 bytes long.
+	HIT []byte
+
+	// PublicKey is the Host Identity, at most 65535 bytes long, in
+	// the format of the IPSECKEY record for PublicKeyAlgorithm.
+	PublicKey []byte
+
+	// RendezvousServers are the names of the host's rendezvous
+	// servers, in order of preference. They are never compressed
+	// when packed.
+	RendezvousServers []Name
 }
 
-func (r *TXTResource) realType() Type {
-	return TypeTXT
+func (r *HIPResource) realType() Type {
+	return TypeHIP
 }
 
-// pack appends the wire format of the TXTResource to msg.
-func (r *TXTResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+// pack appends the wire format of the HIPResource to msg.
+func (r *HIPResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	if len(r.HIT) > 255 {
+		return msg, errHITTooLong
+	}
+	if len(r.PublicKey) > 65535 {
+		return msg, errHIPKeyTooLong
+	}
 	oldMsg := msg
-	for _, s := range r.TXT {
+	msg = append(msg, byte(len(r.HIT)), r.PublicKeyAlgorithm)
+	msg = packUint16(msg, uint16(len(r.PublicKey)))
+	msg = packBytes(msg, r.HIT)
+	msg = packBytes(msg, r.PublicKey)
+	for i := range r.RendezvousServers {
 		var err error
-		msg, err = packText(msg, s)
+		msg, err = r.RendezvousServers[i].pack(msg, nil, compressionOff)
 		if err != nil {
-			return oldMsg, err
+			return oldMsg, &nestedError{"HIPResource.RendezvousServers", err}
 		}
 	}
 	return msg, nil
 }
 
 // GoString implements fmt.GoStringer.GoString.
-func (r *TXTResource) GoString() string {
-	s := "dnsmessage.TXTResource{TXT: []string{"
-	if len(r.TXT) == 0 {
-		return s + "}}"
+func (r *HIPResource) GoString() string {
+	s := "dnsmessage.HIPResource{" +
+		"PublicKeyAlgorithm: " + printUint32(uint32(r.PublicKeyAlgorithm)) + ", " +
+		"HIT: []byte{" + printByteSlice(r.HIT) + "}, " +
+		"PublicKey: []byte{" + printByteSlice(r.PublicKey) + "}, " +
+		"RendezvousServers: []dnsmessage.Name{"
+	for i := range r.RendezvousServers {
+		if i > 0 {
+			s += ", "
+		}
+		s += r.RendezvousServers[i].GoString()
 	}
-	s += `"` + printString([]byte(r.TXT[0]))
-	for _, t := range r.TXT[1:] {
-		s += `", "` + printString([]byte(t))
+	return s + "}}"
+}
+
+// String implements ResourceBody.String.
+func (r *HIPResource) String() string {
+	s := printUint32(uint32(r.PublicKeyAlgorithm)) + " " +
+		printHex(r.HIT) + " " +
+		printBase64(r.PublicKey)
+	for i := range r.RendezvousServers {
+		s += " " + r.RendezvousServers[i].String()
 	}
-	return s + `"}}`
+	return s
 }
 
-func unpackTXTResource(msg []byte, off int, length uint16) (TXTResource, error) {
-	txts := make([]string, 0, 1)
-	for n := uint16(0); n < length; {
-		var t string
-		var err error
-		if t, off, err = unpackText(msg, off); err != nil {
-			return TXTResource{}, &nestedError{"text", err}
-		}
-		// Check if we got too many bytes.
-		if length-n < uint16(len(t))+1 {
-			return TXTResource{}, errCalcLen
+func unpackHIPResource(msg []byte, off int, length uint16, allowCompression bool) (HIPResource, error) {
+	end := off + int(length)
+	hitLen, off, err := unpackUint8(msg, off)
+	if err != nil {
+		return HIPResource{}, &nestedError{"HIT length", err}
+	}
+	alg, off, err := unpackUint8(msg, off)
+	if err != nil {
+		return HIPResource{}, &nestedError{"PublicKeyAlgorithm", err}
+	}
+	pkLen, off, err := unpackUint16(msg, off)
+	if err != nil {
+		return HIPResource{}, &nestedError{"PublicKey length", err}
+	}
+	if off+int(hitLen)+int(pkLen) > end {
+		return HIPResource{}, errCalcLen
+	}
+	hit := make([]byte, hitLen)
+	if off, err = unpackBytes(msg, off, hit); err != nil {
+		return HIPResource{}, &nestedError{"HIT", err}
+	}
+	pk := make([]byte, pkLen)
+	if off, err = unpackBytes(msg, off, pk); err != nil {
+		return HIPResource{}, &nestedError{"PublicKey", err}
+	}
+	var servers []Name
+	for off < end {
+		var n Name
+		if off, err = n.unpackCompressed(msg, off, allowCompression); err != nil {
+			return HIPResource{}, &nestedError{"RendezvousServers", err}
 		}
-		n += uint16(len(t)) + 1
-		txts = append(txts, t)
+		servers = append(servers, n)
 	}
-	return TXTResource{txts}, nil
+	if off != end {
+		return HIPResource{}, errCalcLen
+	}
+	return HIPResource{alg, hit, pk, servers}, nil
 }
 
-// An SRVResource is an SRV Resource record.
-type SRVResource struct {
-	Priority uint16
-	Weight   uint16
-	Port     uint16
-	Target   Name // Not compressed as per RFC 2782.
-}
+// Schemes and hash algorithms of a ZONEMDResource.
+const (
+	// ZONEMDSchemeSimple digests the zone's records in canonical
+	// order, as described in RFC 8976, section 3.3.
+	ZONEMDSchemeSimple uint8 = 1
+
+	// ZONEMDHashSHA384 is SHA-384, with a 48-byte digest.
+	ZONEMDHashSHA384 uint8 = 1
+	// ZONEMDHashSHA512 is SHA-512, with a 64-byte digest.
+	ZONEMDHashSHA512 uint8 = 2
+)
 
-func (r *SRVResource) realType() Type {
-	return TypeSRV
+// A ZONEMDResource is a ZONEMD Resource record, as defined in RFC 8976.
+// It holds a message digest of the contents of the zone at whose apex
+// it appears.
+type ZONEMDResource struct {
+	// Serial is the serial number of the SOA record of the zone
+	// version the digest was computed for.
+	Serial        uint32
+	Scheme        uint8
+	HashAlgorithm uint8
+
+	// Digest is 48 bytes long for ZONEMDHashSHA384 and 64 bytes
+	// for ZONEMDHashSHA512. For other hash algorithms, it is at
+	// least 12 bytes long.
+	Digest []byte
+}
+
+func (r *ZONEMDResource) realType() Type {
+	return TypeZONEMD
+}
+
+// checkDigestLen reports whether the length of r.Digest is valid for
+// r.HashAlgorithm.
+func (r *ZONEMDResource) checkDigestLen() error {
+	var want int
+	switch r.HashAlgorithm {
+	case ZONEMDHashSHA384:
+		want = 48
+	case ZONEMDHashSHA512:
+		want = 64
+	default:
+		if len(r.Digest) < 12 {
+			return errZONEMDDigestLen
+		}
+		return nil
+	}
+	if len(r.Digest) != want {
+		return errZONEMDDigestLen
+	}
+	return nil
 }
 
-// pack appends the wire format of the SRVResource to msg.
-func (r *SRVResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
-	oldMsg := msg
-	msg = packUint16(msg, r.Priority)
-	msg = packUint16(msg, r.Weight)
-	msg = packUint16(msg, r.Port)
-	msg, err := r.Target.pack(msg, nil, compressionOff)
-	if err != nil {
-		return oldMsg, &nestedError{"SRVResource.Target", err}
+// pack appends the wire format of the ZONEMDResource to msg.
+func (r *ZONEMDResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	if err := r.checkDigestLen(); err != nil {
+		return msg, err
 	}
-	return msg, nil
+	msg = packUint32(msg, r.Serial)
+	msg = append(msg, r.Scheme, r.HashAlgorithm)
+	return packBytes(msg, r.Digest), nil
 }
 
 // GoString implements fmt.GoStringer.GoString.
-func (r *SRVResource) GoString() string {
-	return "dnsmessage.SRVResource{" +
-		"Priority: " + printUint16(r.Priority) + ", " +
-		"Weight: " + printUint16(r.Weight) + ", " +
-		"Port: " + printUint16(r.Port) + ", " +
-		"Target: " + r.Target.GoString() + "}"
+func (r *ZONEMDResource) GoString() string {
+	return "dnsmessage.ZONEMDResource{" +
+		"Serial: " + printUint32(r.Serial) + ", " +
+		"Scheme: " + printUint32(uint32(r.Scheme)) + ", " +
+		"HashAlgorithm: " + printUint32(uint32(r.HashAlgorithm)) + ", " +
+		"Digest: []byte{" + printByteSlice(r.Digest) + "}}"
 }
 
-func unpackSRVResource(msg []byte, off int) (SRVResource, error) {
-	priority, off, err := unpackUint16(msg, off)
+// String implements ResourceBody.String.
+func (r *ZONEMDResource) String() string {
+	return printUint32(r.Serial) + " " +
+		printUint32(uint32(r.Scheme)) + " " +
+		printUint32(uint32(r.HashAlgorithm)) + " " +
+		printHex(r.Digest)
+}
+
+func unpackZONEMDResource(msg []byte, off int, length uint16) (ZONEMDResource, error) {
+	end := off + int(length)
+	serial, off, err := unpackUint32(msg, off)
 	if err != nil {
-		return SRVResource{}, &nestedError{"Priority", err}
+		return ZONEMDResource{}, &nestedError{"Serial", err}
 	}
-	weight, off, err := unpackUint16(msg, off)
+	scheme, off, err := unpackUint8(msg, off)
 	if err != nil {
-		return SRVResource{}, &nestedError{"Weight", err}
+		return ZONEMDResource{}, &nestedError{"Scheme", err}
 	}
-	port, off, err := unpackUint16(msg, off)
+	alg, off, err := unpackUint8(msg, off)
 	if err != nil {
-		return SRVResource{}, &nestedError{"Port", err}
+		return ZONEMDResource{}, &nestedError{"HashAlgorithm", err}
 	}
-	var target Name
-	if _, err := target.unpackCompressed(msg, off, false /* allowCompression */); err != nil {
-		return SRVResource{}, &nestedError{"Target", err}
+	if off > end {
+		return ZONEMDResource{}, errCalcLen
 	}
-	return SRVResource{priority, weight, port, target}, nil
+	digest := make([]byte, end-off)
+	if _, err := unpackBytes(msg, off, digest); err != nil {
+		return ZONEMDResource{}, &nestedError{"Digest", err}
+	}
+	r := ZONEMDResource{serial, scheme, alg, digest}
+	if err := r.checkDigestLen(); err != nil {
+		return ZONEMDResource{}, err
+	}
+	return r, nil
 }
 
-// An AResource is an A Resource record.
-type AResource struct {
-	A [4]byte
+// A WKSResource is a WKS (Well Known Services) Resource record, as
+// defined in RFC 1035, section 3.4.2. WKS is obsolete, but such
+// records still appear in some zones.
+type WKSResource struct {
+	Address  [4]byte
+	Protocol uint8 // an IP protocol number, such as 6 for TCP
+
+	// Bitmap has a bit set for each port on which the service is
+	// offered. The most significant bit of the first byte is port 0,
+	// and the least significant bit of the first byte is port 7.
+	Bitmap []byte
 }
 
-func (r *AResource) realType() Type {
-	return TypeA
+func (r *WKSResource) realType() Type {
+	return TypeWKS
 }
 
-// pack appends the wire format of the AResource to msg.
-func (r *AResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
-	return packBytes(msg, r.A[:]), nil
+// pack appends the wire format of the WKSResource to msg.
+func (r *WKSResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	msg = packBytes(msg, r.Address[:])
+	msg = append(msg, r.Protocol)
+	return packBytes(msg, r.Bitmap), nil
 }
 
 // GoString implements fmt.GoStringer.GoString.
-func (r *AResource) GoString() string {
-	return "dnsmessage.AResource{" +
-		"A: [4]byte{" + printByteSlice(r.A[:]) + "}}"
+func (r *WKSResource) GoString() string {
+	return "dnsmessage.WKSResource{" +
+		"Address: [4]byte{" + printByteSlice(r.Address[:]) + "}, " +
+		"Protocol: " + printUint32(uint32(r.Protocol)) + ", " +
+		"Bitmap: []byte{" + printByteSlice(r.Bitmap) + "}}"
+}
+
+// String implements ResourceBody.String. The ports in the bitmap are
+// printed in increasing order.
+func (r *WKSResource) String() string {
+	s := printIPv4(r.Address[:]) + " " + printUint32(uint32(r.Protocol))
+	for i, b := range r.Bitmap {
+		for j := 0; j < 8; j++ {
+			if b&(0x80>>j) != 0 {
+				s += " " + printUint32(uint32(i*8+j))
+			}
+		}
+	}
+	return s
 }
 
-func unpackAResource(msg []byte, off int) (AResource, error) {
-	var a [4]byte
-	if _, err := unpackBytes(msg, off, a[:]); err != nil {
-		return AResource{}, err
+func unpackWKSResource(msg []byte, off int, length uint16) (WKSResource, error) {
+	end := off + int(length)
+	var addr [4]byte
+	off, err := unpackBytes(msg, off, addr[:])
+	if err != nil {
+		return WKSResource{}, &nestedError{"Address", err}
 	}
-	return AResource{a}, nil
+	proto, off, err := unpackUint8(msg, off)
+	if err != nil {
+		return WKSResource{}, &nestedError{"Protocol", err}
+	}
+	if off > end {
+		return WKSResource{}, errCalcLen
+	}
+	bitmap := make([]byte, end-off)
+	if _, err := unpackBytes(msg, off, bitmap); err != nil {
+		return WKSResource{}, &nestedError{"Bitmap", err}
+	}
+	return WKSResource{addr, proto, bitmap}, nil
 }
 
-// An AAAAResource is an AAAA Resource record.
-type AAAAResource struct {
-	AAAA [16]byte
+// An RPResource is an RP (Responsible Person) Resource record, as
+// defined in RFC 1183, section 2.2.
+//
+// As RP is not one of the types defined in RFC 1035, its names are not
+// compressed when packed, but compressed names are accepted when
+// unpacking, following RFC 3597, section 4, unless the Parser is set
+// to reject them with SetStrictCompression.
+type RPResource struct {
+	// Mbox is the mailbox of the responsible person, with the "@"
+	// replaced by a ".", or the root name if there is none.
+	Mbox Name
+
+	// Txt is the name of TXT records with further information, or
+	// the root name if there are none.
+	Txt Name
 }
 
-func (r *AAAAResource) realType() Type {
-	return TypeAAAA
+func (r *RPResource) realType() Type {
+	return TypeRP
+}
+
+// pack appends the wire format of the RPResource to msg.
+func (r *RPResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	oldMsg := msg
+	msg, err := r.Mbox.pack(msg, nil, compressionOff)
+	if err != nil {
+		return oldMsg, &nestedError{"RPResource.Mbox", err}
+	}
+	msg, err = r.Txt.pack(msg, nil, compressionOff)
+	if err != nil {
+		return oldMsg, &nestedError{"RPResource.Txt", err}
+	}
+	return msg, nil
 }
 
 // GoString implements fmt.GoStringer.GoString.
-func (r *AAAAResource) GoString() string {
-	return "dnsmessage.AAAAResource{" +
-		"AAAA: [16]byte{" + printByteSlice(r.AAAA[:]) + "}}"
+func (r *RPResource) GoString() string {
+	return "dnsmessage.RPResource{" +
+		"Mbox: " + r.Mbox.GoString() + ", " +
+		"Txt: " + r.Txt.GoString() + "}"
 }
 
-// pack appends the wire format of the AAAAResource to msg.
-func (r *AAAAResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
-	return packBytes(msg, r.AAAA[:]), nil
+// String implements ResourceBody.String.
+func (r *RPResource) String() string {
+	return r.Mbox.String() + " " + r.Txt.String()
 }
 
-func unpackAAAAResource(msg []byte, off int) (AAAAResource, error) {
-	var aaaa [16]byte
-	if _, err := unpackBytes(msg, off, aaaa[:]); err != nil {
-		return AAAAResource{}, err
+func unpackRPResource(msg []byte, off int, allowCompression bool) (RPResource, error) {
+	var mbox Name
+	off, err := mbox.unpackCompressed(msg, off, allowCompression)
+	if err != nil {
+		return RPResource{}, &nestedError{"Mbox", err}
 	}
-	return AAAAResource{aaaa}, nil
+	var txt Name
+	if _, err := txt.unpackCompressed(msg, off, allowCompression); err != nil {
+		return RPResource{}, &nestedError{"Txt", err}
+	}
+	return RPResource{mbox, txt}, nil
 }
 
-// An OPTResource is an OPT pseudo Resource record.
-//
-// The pseudo resource record is part of the extension mechanisms for DNS
-// as defined in RFC 6891.
-type OPTResource struct {
-	Options []Option
-}
+// Subtypes of an AFSDBResource.
+const (
+	// AFSDBSubtypeAFS is an AFS version 3.0 volume location server.
+	AFSDBSubtypeAFS uint16 = 1
+	// AFSDBSubtypeDCE is a DCE authenticated name server.
+	AFSDBSubtypeDCE uint16 = 2
+)
 
-// An Option represents a DNS message option within OPTResource.
+// An AFSDBResource is an AFSDB Resource record, as defined in RFC 1183,
+// section 1.
 //
-// The message option is part of the extension mechanisms for DNS as
-// defined in RFC 6891.
-type Option struct {
-	Code uint16 // option code
-	Data []byte
-}
-
-// GoString implements fmt.GoStringer.GoString.
-func (o *Option) GoString() string {
-	return "dnsmessage.Option{" +
-		"Code: " + printUint16(o.Code) + ", " +
-		"Data: []byte{" + printByteSlice(o.Data) + "}}"
+// As AFSDB is not one of the types defined in RFC 1035, its name is not
+// compressed when packed, but a compressed name is accepted when
+// unpacking, following RFC 3597, section 4, unless the Parser is set
+// to reject it with SetStrictCompression.
+type AFSDBResource struct {
+	Subtype  uint16
+	Hostname Name
 }
 
-func (r *OPTResource) realType() Type {
-	return TypeOPT
+func (r *AFSDBResource) realType() Type {
+	return TypeAFSDB
 }
 
-func (r *OPTResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
-	for _, opt := range r.Options {
-		msg = packUint16(msg, opt.Code)
-		l := uint16(len(opt.Data))
-		msg = packUint16(msg, l)
-		msg = packBytes(msg, opt.Data)
+// pack appends the wire format of the AFSDBResource to msg.
+func (r *AFSDBResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	oldMsg := msg
+	msg = packUint16(msg, r.Subtype)
+	msg, err := r.Hostname.pack(msg, nil, compressionOff)
+	if err != nil {
+		return oldMsg, &nestedError{"AFSDBResource.Hostname", err}
 	}
 	return msg, nil
 }
 
 // GoString implements fmt.GoStringer.GoString.
-func (r *OPTResource) GoString() string {
-	s := "dnsmessage.OPTResource{Options: []dnsmessage.Option{"
-	if len(r.Options) == 0 {
-		return s + "}}"
+func (r *AFSDBResource) GoString() string {
+	return "dnsmessage.AFSDBResource{" +
+		"Subtype: " + printUint16(r.Subtype) + ", " +
+		"Hostname: " + r.Hostname.GoString() + "}"
+}
+
+// String implements ResourceBody.String.
+func (r *AFSDBResource) String() string {
+	return printUint16(r.Subtype) + " " + r.Hostname.String()
+}
+
+func unpackAFSDBResource(msg []byte, off int, allowCompression bool) (AFSDBResource, error) {
+	subtype, off, err := unpackUint16(msg, off)
+	if err != nil {
+		return AFSDBResource{}, &nestedError{"Subtype", err}
 	}
-	s += r.Options[0].GoString()
-	for _, o := range r.Options[1:] {
-		s += ", " + o.GoString()
+	var hostname Name
+	if _, err := hostname.unpackCompressed(msg, off, allowCompression); err != nil {
+		return AFSDBResource{}, &nestedError{"Hostname", err}
 	}
-	return s + "}}"
+	return AFSDBResource{subtype, hostname}, nil
 }
 
-func unpackOPTResource(msg []byte, off int, length uint16) (OPTResource, error) {
-	var opts []Option
-	for oldOff := off; off < oldOff+int(length); {
+// Gateway types of an IPSECKEYResource.
+const (
+	// IPSECKEYGatewayNone indicates that there is no gateway.
+	IPSECKEYGatewayNone uint8 = 0
+	// IPSECKEYGatewayIPv4 indicates a gateway given by its IPv4 address.
+	IPSECKEYGatewayIPv4 uint8 = 1
+	// IPSECKEYGatewayIPv6 indicates a gateway given by its IPv6 address.
+	IPSECKEYGatewayIPv6 uint8 = 2
+	// IPSECKEYGatewayName indicates a gateway given by its domain name.
+	IPSECKEYGatewayName uint8 = 3
+)
+
+// An IPSECKEYResource is an IPSECKEY Resource record, as defined in
+// RFC 4025. It publishes a public key for establishing IPsec security
+// associations with the owner of the record, for example for
+// opportunistic encryption, and the gateway through which to reach it.
+//
+// Which of the gateway fields is used depends on GatewayType; the
+// others are ignored when packing and left zero when unpacking.
+type IPSECKEYResource struct {
+	// Precedence orders the IPSECKEY records of a name, the lowest
+	// first.
+	Precedence uint8
+
+	// GatewayType is one of the IPSECKEYGateway constants.
+	GatewayType uint8
+
+	// Algorithm is the algorithm of PublicKey, such as 1 for DSA or
+	// 2 for RSA, or 0 if there is no key.
+	Algorithm uint8
+
+	// GatewayIPv4 is the address of the gateway when GatewayType is
+	// IPSECKEYGatewayIPv4.
+	GatewayIPv4 [4]byte
+
+	// GatewayIPv6 is the address of the gateway when GatewayType is
+	// IPSECKEYGatewayIPv6.
+	GatewayIPv6 [16]byte
+
+	// GatewayName is the name of the gateway when GatewayType is
+	// IPSECKEYGatewayName. It is never compressed, and compressed
+	// names are rejected when unpacking, following RFC 4025,
+	// section 2.5.
+	GatewayName Name
+
+	// PublicKey is the public key, in the format of Algorithm.
+	PublicKey []byte
+}
+
+func (r *IPSECKEYResource) realType() Type {
+	return TypeIPSECKEY
+}
+
+// pack appends the wire format of the IPSECKEYResource to msg.
+func (r *IPSECKEYResource) pack(msg []byte, compression map[string]int, compressionOff int) ([]byte, error) {
+	oldMsg := msg
+	msg = append(msg, r.Precedence, r.GatewayType, r.Algorithm)
+	switch r.GatewayType {
+	case IPSECKEYGatewayNone:
+	case IPSECKEYGatewayIPv4:
+		msg = packBytes(msg, r.GatewayIPv4[:])
+	case IPSECKEYGatewayIPv6:
+		msg = packBytes(msg, r.GatewayIPv6[:])
+	case IPSECKEYGatewayName:
 		var err error
-		var o Option
-		o.Code, off, err = unpackUint16(msg, off)
+		msg, err = r.GatewayName.pack(msg, nil, compressionOff)
 		if err != nil {
-			return OPTResource{}, &nestedError{"Code", err}
+			return oldMsg, &nestedError{"IPSECKEYResource.GatewayName", err}
 		}
-		var l uint16
-		l, off, err = unpackUint16(msg, off)
-		if err != nil {
-			return OPTResource{}, &nestedError{"Data", err}
+	default:
+		return oldMsg, errIPSECKEYGateway
+	}
+	return packBytes(msg, r.PublicKey), nil
+}
+
+// GoString implements fmt.GoStringer.GoString.
+func (r *IPSECKEYResource) GoString() string {
+	s := "dnsmessage.IPSECKEYResource{" +
+		"Precedence: " + printUint32(uint32(r.Precedence)) + ", " +
+		"GatewayType: " + printUint32(uint32(r.GatewayType)) + ", " +
+		"Algorithm: " + printUint32(uint32(r.Algorithm)) + ", "
+	switch r.GatewayType {
+	case IPSECKEYGatewayIPv4:
+		s += "GatewayIPv4: [4]byte{" + printByteSlice(r.GatewayIPv4[:]) + "}, "
+	case IPSECKEYGatewayIPv6:
+		s += "GatewayIPv6: [16]byte{" + printByteSlice(r.GatewayIPv6[:]) + "}, "
+	case IPSECKEYGatewayName:
+		s += "GatewayName: " + r.GatewayName.GoString() + ", "
+	}
+	return s + "PublicKey: []byte{" + printByteSlice(r.PublicKey) + "}}"
+}
+
+// String implements ResourceBody.String, in the presentation format of
+// RFC 4025, section 3.
+func (r *IPSECKEYResource) String() string {
+	var gateway string
+	switch r.GatewayType {
+	case IPSECKEYGatewayNone:
+		gateway = "."
+	case IPSECKEYGatewayIPv4:
+		gateway = printIPv4(r.GatewayIPv4[:])
+	case IPSECKEYGatewayIPv6:
+		gateway = printIPv6(r.GatewayIPv6)
+	case IPSECKEYGatewayName:
+		gateway = r.GatewayName.String()
+	}
+	s := printUint32(uint32(r.Precedence)) + " " +
+		printUint32(uint32(r.GatewayType)) + " " +
+		printUint32(uint32(r.Algorithm)) + " " +
+		gateway
+	if len(r.PublicKey) > 0 {
+		s += " " + printBase64(r.PublicKey)
+	}
+	return s
+}
+
+func unpackIPSECKEYResource(msg []byte, off int, length uint16) (IPSECKEYResource, error) {
+	end := off + int(length)
+	var r IPSECKEYResource
+	var err error
+	if r.Precedence, off, err = unpackUint8(msg, off); err != nil {
+		return IPSECKEYResource{}, &nestedError{"Precedence", err}
+	}
+	if r.GatewayType, off, err = unpackUint8(msg, off); err != nil {
+		return IPSECKEYResource{}, &nestedError{"GatewayType", err}
+	}
+	if r.Algorithm, off, err = unpackUint8(msg, off); err != nil {
+		return IPSECKEYResource{}, &nestedError{"Algorithm", err}
+	}
+	switch r.GatewayType {
+	case IPSECKEYGatewayNone:
+	case IPSECKEYGatewayIPv4:
+		if off, err = unpackBytes(msg, off, r.GatewayIPv4[:]); err != nil {
+			return IPSECKEYResource{}, &nestedError{"GatewayIPv4", err}
 		}
-		o.Data = make([]byte, l)
-		if copy(o.Data, msg[off:]) != int(l) {
-			return OPTResource{}, &nestedError{"Data", errCalcLen}
+	case IPSECKEYGatewayIPv6:
+		if off, err = unpackBytes(msg, off, r.GatewayIPv6[:]); err != nil {
+			return IPSECKEYResource{}, &nestedError{"GatewayIPv6", err}
 		}
-		off += int(l)
-		opts = append(opts, o)
+	case IPSECKEYGatewayName:
+		if off, err = r.GatewayName.unpackCompressed(msg, off, false /* allowCompression */); err != nil {
+			return IPSECKEYResource{}, &nestedError{"GatewayName", err}
+		}
+	default:
+		return IPSECKEYResource{}, errIPSECKEYGateway
 	}
-	return OPTResource{opts}, nil
+	if off > end {
+		return IPSECKEYResource{}, errCalcLen
+	}
+	r.PublicKey = make([]byte, end-off)
+	if _, err := unpackBytes(msg, off, r.PublicKey); err != nil {
+		return IPSECKEYResource{}, &nestedError{"PublicKey", err}
+	}
+	return r, nil
 }
 
 // An UnknownResource is a catch-all container for unknown record types.
@@ -2665,6 +4978,11 @@ func (r *UnknownResource) GoString() string {
 		"Data: []byte{" + printByteSlice(r.Data) + "}}"
 }
 
+// String implements ResourceBody.String.
+func (r *UnknownResource) String() string {
+	return printUnknownRData(r.Data)
+}
+
 func unpackUnknownResource(recordType Type, msg []byte, off int, length uint16) (UnknownResource, error) {
 	parsed := UnknownResource{
 		Type: recordType,
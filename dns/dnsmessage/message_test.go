@@ -6,12 +6,17 @@ package dnsmessage
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -150,6 +155,39 @@ func (m *Message) String() string {
 	return s
 }
 
+func TestClassString(t *testing.T) {
+	for _, tt := range []struct {
+		c        Class
+		str      string
+		goStr    string
+		mnemonic string
+		known    bool
+		meta     bool
+	}{
+		{ClassINET, "ClassINET", "dnsmessage.ClassINET", "IN", true, false},
+		{ClassCHAOS, "ClassCHAOS", "dnsmessage.ClassCHAOS", "CH", true, false},
+		{ClassNONE, "ClassNONE", "dnsmessage.ClassNONE", "NONE", true, true},
+		{ClassANY, "ClassANY", "dnsmessage.ClassANY", "ANY", true, true},
+		{Class(42), "42", "42", "CLASS42", false, false},
+	} {
+		if got := tt.c.String(); got != tt.str {
+			t.Errorf("Class(%d).String() = %q, want %q", tt.c, got, tt.str)
+		}
+		if got := tt.c.GoString(); got != tt.goStr {
+			t.Errorf("Class(%d).GoString() = %q, want %q", tt.c, got, tt.goStr)
+		}
+		if got := tt.c.mnemonic(); got != tt.mnemonic {
+			t.Errorf("Class(%d).mnemonic() = %q, want %q", tt.c, got, tt.mnemonic)
+		}
+		if got := tt.c.Known(); got != tt.known {
+			t.Errorf("Class(%d).Known() = %t, want %t", tt.c, got, tt.known)
+		}
+		if got := tt.c.IsMeta(); got != tt.meta {
+			t.Errorf("Class(%d).IsMeta() = %t, want %t", tt.c, got, tt.meta)
+		}
+	}
+}
+
 func TestNameString(t *testing.T) {
 	want := "foo"
 	name := MustNewName(want)
@@ -276,8 +314,46 @@ func TestIncompressibleName(t *testing.T) {
 		t.Fatal("unpacking incompressible name without pointers failed:", err)
 	}
 	var n2 Name
-	if _, err := n2.unpackCompressed(buf, off, false /* allowCompression */); err != errCompressedSRV {
-		t.Errorf("unpacking compressed incompressible name with pointers: got %v, want = %v", err, errCompressedSRV)
+	if _, err := n2.unpackCompressed(buf, off, false /* allowCompression */); err != ErrCompressedRData {
+		t.Errorf("unpacking compressed incompressible name with pointers: got %v, want = %v", err, ErrCompressedRData)
+	}
+}
+
+func TestNamePointerOutOfRange(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		msg  string
+		off  int
+		want string // offset pointed to
+	}{
+		{"pointer to end", "\xc0\x02", 0, "2"},
+		{"pointer to max offset", "\xff\xff", 0, "16383"},
+		{"pointer after label", "\x03foo\xc0\x40", 0, "64"},
+		{"second name", "\x03foo\x00\xc0\x07\xc0\x09", 5, "9"},
+		{"pointer to pointer", "\xc0\x02\xc0\x06", 0, "6"},
+	} {
+		var n Name
+		_, err := n.unpack([]byte(test.msg), test.off)
+		if !errors.Is(err, ErrPointerOutOfRange) {
+			t.Errorf("%s: Name.unpack() = %v, want %v", test.name, err, ErrPointerOutOfRange)
+			continue
+		}
+		if want := "offset " + test.want + " "; !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: Name.unpack() = %v, want error containing %q", test.name, err, want)
+		}
+	}
+
+	// A question whose name is a pointer past the end of a truncated
+	// message.
+	msg := make([]byte, headerLen, headerLen+6)
+	msg[5] = 1 // one question
+	msg = append(msg, 0xc0, 0x20, 0, 1, 0, 1)
+	var p Parser
+	if _, err := p.Start(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Question(); !errors.Is(err, ErrPointerOutOfRange) {
+		t.Errorf("Parser.Question() = %v, want %v", err, ErrPointerOutOfRange)
 	}
 }
 
@@ -331,6 +407,17 @@ func TestResourceNotStarted(t *testing.T) {
 		{"SRVResource", func(p *Parser) error { _, err := p.SRVResource(); return err }},
 		{"AResource", func(p *Parser) error { _, err := p.AResource(); return err }},
 		{"AAAAResource", func(p *Parser) error { _, err := p.AAAAResource(); return err }},
+		{"KEYResource", func(p *Parser) error { _, err := p.KEYResource(); return err }},
+		{"SIGResource", func(p *Parser) error { _, err := p.SIGResource(); return err }},
+		{"APLResource", func(p *Parser) error { _, err := p.APLResource(); return err }},
+		{"HIPResource", func(p *Parser) error { _, err := p.HIPResource(); return err }},
+		{"ZONEMDResource", func(p *Parser) error { _, err := p.ZONEMDResource(); return err }},
+		{"WKSResource", func(p *Parser) error { _, err := p.WKSResource(); return err }},
+		{"RPResource", func(p *Parser) error { _, err := p.RPResource(); return err }},
+		{"AFSDBResource", func(p *Parser) error { _, err := p.AFSDBResource(); return err }},
+		{"IPSECKEYResource", func(p *Parser) error { _, err := p.IPSECKEYResource(); return err }},
+		{"CSYNCResource", func(p *Parser) error { _, err := p.CSYNCResource(); return err }},
+		{"OPTOptions", func(p *Parser) error { _, err := p.OPTOptions(); return err }},
 		{"UnknownResource", func(p *Parser) error { _, err := p.UnknownResource(); return err }},
 	}
 
@@ -588,7 +675,7 @@ func TestVeryLongTxt(t *testing.T) {
 	if err != nil {
 		t.Fatal("ResourceHeader.unpack() =", err)
 	}
-	body, n, err := unpackResourceBody(buf, off, got.Header)
+	body, n, err := unpackResourceBody(buf, off, got.Header, true)
 	if err != nil {
 		t.Fatal("unpackResourceBody() =", err)
 	}
@@ -672,6 +759,16 @@ func TestBuilderResourceError(t *testing.T) {
 		{"AResource", func(b *Builder) error { return b.AResource(ResourceHeader{}, AResource{}) }},
 		{"AAAAResource", func(b *Builder) error { return b.AAAAResource(ResourceHeader{}, AAAAResource{}) }},
 		{"OPTResource", func(b *Builder) error { return b.OPTResource(ResourceHeader{}, OPTResource{}) }},
+		{"KEYResource", func(b *Builder) error { return b.KEYResource(ResourceHeader{}, KEYResource{}) }},
+		{"SIGResource", func(b *Builder) error { return b.SIGResource(ResourceHeader{}, SIGResource{}) }},
+		{"APLResource", func(b *Builder) error { return b.APLResource(ResourceHeader{}, APLResource{}) }},
+		{"HIPResource", func(b *Builder) error { return b.HIPResource(ResourceHeader{}, HIPResource{}) }},
+		{"ZONEMDResource", func(b *Builder) error { return b.ZONEMDResource(ResourceHeader{}, ZONEMDResource{}) }},
+		{"WKSResource", func(b *Builder) error { return b.WKSResource(ResourceHeader{}, WKSResource{}) }},
+		{"RPResource", func(b *Builder) error { return b.RPResource(ResourceHeader{}, RPResource{}) }},
+		{"AFSDBResource", func(b *Builder) error { return b.AFSDBResource(ResourceHeader{}, AFSDBResource{}) }},
+		{"IPSECKEYResource", func(b *Builder) error { return b.IPSECKEYResource(ResourceHeader{}, IPSECKEYResource{}) }},
+		{"CSYNCResource", func(b *Builder) error { return b.CSYNCResource(ResourceHeader{}, CSYNCResource{}) }},
 		{"UnknownResource", func(b *Builder) error { return b.UnknownResource(ResourceHeader{}, UnknownResource{}) }},
 	}
 
@@ -1599,3 +1696,1287 @@ func TestNoFmt(t *testing.T) {
 		}
 	}
 }
+
+func TestDigString(t *testing.T) {
+	name := MustNewName("example.com.")
+	msg := Message{
+		Header: Header{ID: 4660, Response: true, RecursionDesired: true, RecursionAvailable: true},
+		Questions: []Question{
+			{Name: name, Type: TypeA, Class: ClassINET},
+		},
+		Answers: []Resource{
+			{
+				ResourceHeader{Name: name, Type: TypeA, Class: ClassINET, TTL: 300},
+				&AResource{[4]byte{93, 184, 216, 34}},
+			},
+			{
+				ResourceHeader{Name: name, Type: TypeAAAA, Class: ClassINET, TTL: 300},
+				&AAAAResource{[16]byte{0x26, 0x06, 0x28, 0x00, 0x02, 0x20, 0, 1, 0x2, 0x48, 0x18, 0x93, 0x25, 0xc8, 0x19, 0x46}},
+			},
+			{
+				ResourceHeader{Name: name, Type: TypeTXT, Class: ClassINET, TTL: 60},
+				&TXTResource{[]string{`v=spf1 "quoted"`, "tab\there"}},
+			},
+		},
+		Authorities: []Resource{
+			{
+				ResourceHeader{Name: name, Type: TypeSOA, Class: ClassINET, TTL: 3600},
+				&SOAResource{
+					NS:      MustNewName("ns.icann.org."),
+					MBox:    MustNewName("noc.dns.icann.org."),
+					Serial:  2023050101,
+					Refresh: 7200,
+					Retry:   3600,
+					Expire:  1209600,
+					MinTTL:  3600,
+				},
+			},
+		},
+		Additionals: []Resource{
+			{
+				ResourceHeader{Name: MustNewName("mail.example.com."), Type: TypeAAAA, Class: ClassINET, TTL: 30},
+				&AAAAResource{[16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}},
+			},
+			{
+				mustEDNS0ResourceHeader(1232, RCodeSuccess, true),
+				&OPTResource{[]Option{{Code: 10, Data: []byte{0x01, 0x23, 0x45, 0x67}}}},
+			},
+			{
+				ResourceHeader{Name: name, Type: privateUseType, Class: 42, TTL: 1},
+				&UnknownResource{Type: privateUseType, Data: []byte{0xde, 0xad}},
+			},
+		},
+	}
+
+	want := `;; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: 4660
+;; flags: qr rd ra; QUERY: 1, ANSWER: 3, AUTHORITY: 1, ADDITIONAL: 3
+
+;; OPT PSEUDOSECTION:
+; EDNS: version: 0, flags: do; udp: 1232
+; OPT=10: 01234567
+
+;; QUESTION SECTION:
+;example.com.		IN	A
+
+;; ANSWER SECTION:
+example.com.	300	IN	A	93.184.216.34
+example.com.	300	IN	AAAA	2606:2800:220:1:248:1893:25c8:1946
+example.com.	60	IN	TXT	"v=spf1 \"quoted\"" "tab\009here"
+
+;; AUTHORITY SECTION:
+example.com.	3600	IN	SOA	ns.icann.org. noc.dns.icann.org. 2023050101 7200 3600 1209600 3600
+
+;; ADDITIONAL SECTION:
+mail.example.com.	30	IN	AAAA	2001:db8::1
+example.com.	1	CLASS42	TYPE65362	\# 2 dead
+`
+	if got := msg.DigString(); got != want {
+		t.Errorf("got msg.DigString() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPrintIPv6(t *testing.T) {
+	tests := []struct {
+		in   [16]byte
+		want string
+	}{
+		{[16]byte{}, "::"},
+		{[16]byte{15: 1}, "::1"},
+		{[16]byte{0x20, 0x01, 0x0d, 0xb8}, "2001:db8::"},
+		{[16]byte{0x20, 0x01, 0x0d, 0xb8, 7: 1, 15: 1}, "2001:db8:0:1::1"},
+		{[16]byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 1, 0, 0, 0, 0, 0, 1, 0, 0}, "2001:db8:0:1::1:0"},
+		{[16]byte{0, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1}, "1:0:0:1::1"},
+		{[16]byte{10: 0xff, 11: 0xff, 12: 192, 13: 0, 14: 2, 15: 1}, "::ffff:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		if got := printIPv6(tt.in); got != tt.want {
+			t.Errorf("printIPv6(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMatchQuery(t *testing.T) {
+	query := Message{
+		Header: Header{ID: 0x1234, RecursionDesired: true},
+		Questions: []Question{{
+			Name:  MustNewName("www.Example.com."),
+			Type:  TypeA,
+			Class: ClassINET,
+		}},
+	}
+	response := func(f func(*Message)) *Message {
+		m := Message{
+			Header: Header{ID: 0x1234, Response: true, RecursionDesired: true},
+			Questions: []Question{{
+				Name:  MustNewName("WWW.example.COM."),
+				Type:  TypeA,
+				Class: ClassINET,
+			}},
+		}
+		if f != nil {
+			f(&m)
+		}
+		return &m
+	}
+
+	tests := []struct {
+		name string
+		resp *Message
+		want error
+	}{
+		{"match", response(nil), nil},
+		{"id", response(func(m *Message) { m.ID++ }), ErrIDMismatch},
+		{"qr", response(func(m *Message) { m.Response = false }), ErrNotResponse},
+		{"name", response(func(m *Message) { m.Questions[0].Name = MustNewName("www.example.org.") }), ErrQuestionMismatch},
+		{"type", response(func(m *Message) { m.Questions[0].Type = TypeAAAA }), ErrQuestionMismatch},
+		{"class", response(func(m *Message) { m.Questions[0].Class = ClassCHAOS }), ErrQuestionMismatch},
+		{"count", response(func(m *Message) { m.Questions = nil }), ErrQuestionMismatch},
+	}
+	for _, tt := range tests {
+		if got := MatchQuery(&query, tt.resp); got != tt.want {
+			t.Errorf("%s: MatchQuery = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReservedZ(t *testing.T) {
+	for _, z := range []bool{false, true} {
+		b := NewBuilder(nil, Header{ID: 1, RecursionDesired: true, AuthenticData: true, CheckingDisabled: true})
+		b.SetReservedZ(true)
+		b.SetReservedZ(z)
+		msg, err := b.Finish()
+		if err != nil {
+			t.Fatalf("Builder.Finish() = %v", err)
+		}
+		if got := msg[3]&0x40 != 0; got != z {
+			t.Errorf("packed Z bit = %t, want %t", got, z)
+		}
+
+		var p Parser
+		h, err := p.Start(msg)
+		if err != nil {
+			t.Fatalf("Parser.Start() = %v", err)
+		}
+		if got := p.ReservedZ(); got != z {
+			t.Errorf("Parser.ReservedZ() = %t, want %t", got, z)
+		}
+		// The Z bit must not leak into the other flags.
+		want := Header{ID: 1, RecursionDesired: true, AuthenticData: true, CheckingDisabled: true}
+		if h != want {
+			t.Errorf("Parser.Start() = %#v, want %#v", h, want)
+		}
+	}
+}
+
+func TestKEYSIGResource(t *testing.T) {
+	// The example DNSKEY and RRSIG records of RFC 4034, sections 2.3
+	// and 3.3, which share their wire format with KEY and SIG.
+	const (
+		keyB64 = "AQPSKmynfzW4kyBv015MUG2DeIQ3Cbl+BBZH4b/0PY1kxkmvHjcZc8nokfzj31GajIQKY+5CptLr3buXA10hWqTkF7H6RfoRqXQeogmMHfpftf6zMv1LyBUgia7za6ZEzOJBOztyvhjL742iU/TpPSEDhm2SNKLijfUppn1UaNvv4w=="
+		sigB64 = "oJB1W6WNGv+ldvQ3WDG0MQkg5IEhjRip8WTrPYGv07h108dUKGMeDPKijVCHX3DDKdfb+v6oB9wfuh3DTJXUAfI/M0zmO/zz8bW0Rznl8O3tGNazPwQKkRN20XPXV6nwwfoXmJQbsLNrLfkGJ5D6fwFm8nN+6pBzeDQfsS3Ap3o="
+	)
+	pub, err := base64.StdEncoding.DecodeString(keyB64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigB64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := KEYResource{Flags: 256, Protocol: 3, Algorithm: 5, PublicKey: pub}
+	rrsig := SIGResource{
+		TypeCovered: TypeA,
+		Algorithm:   5,
+		Labels:      3,
+		OriginalTTL: 86400,
+		Expiration:  1048354263, // 20030322173103
+		Inception:   1045762263, // 20030220173103
+		KeyTag:      2642,
+		SignerName:  MustNewName("example.com."),
+		Signature:   sig,
+	}
+
+	b := NewBuilder(nil, Header{Response: true})
+	b.EnableCompression()
+	if err := b.StartAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	hdr := ResourceHeader{Name: MustNewName("example.com."), Class: ClassINET, TTL: 86400}
+	if err := b.KEYResource(hdr, key); err != nil {
+		t.Fatalf("Builder.KEYResource() = %v", err)
+	}
+	hdr.Name = MustNewName("host.example.com.")
+	if err := b.SIGResource(hdr, rrsig); err != nil {
+		t.Fatalf("Builder.SIGResource() = %v", err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p Parser
+	if _, err := p.Start(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	gotKey, err := p.KEYResource()
+	if err != nil {
+		t.Fatalf("Parser.KEYResource() = %v", err)
+	}
+	if !reflect.DeepEqual(gotKey, key) {
+		t.Errorf("Parser.KEYResource() = %#v, want %#v", &gotKey, &key)
+	}
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	gotSig, err := p.SIGResource()
+	if err != nil {
+		t.Fatalf("Parser.SIGResource() = %v", err)
+	}
+	if !reflect.DeepEqual(gotSig, rrsig) {
+		t.Errorf("Parser.SIGResource() = %#v, want %#v", &gotSig, &rrsig)
+	}
+
+	var m Message
+	if err := m.Unpack(msg); err != nil {
+		t.Fatalf("Message.Unpack() = %v", err)
+	}
+	if got, want := m.Answers[0].Body.String(), "256 3 5 "+keyB64; got != want {
+		t.Errorf("KEYResource.String() = %q, want %q", got, want)
+	}
+	if got, want := m.Answers[1].Body.String(), "A 5 3 86400 20030322173103 20030220173103 2642 example.com. "+sigB64; got != want {
+		t.Errorf("SIGResource.String() = %q, want %q", got, want)
+	}
+
+	// The public key must not overrun the record.
+	short := KEYResource{Flags: 256}
+	buf, _ := short.pack(nil, nil, 0)
+	if _, err := unpackKEYResource(buf, 0, 3); err == nil {
+		t.Errorf("unpackKEYResource with short length succeeded, want error")
+	}
+}
+
+func TestPrintTimestamp(t *testing.T) {
+	for _, ts := range []uint32{
+		0, 1, 59, 86399, 86400,
+		951782400,  // 2000-02-29
+		951868800,  // 2000-03-01
+		1078012800, // 2004-02-29
+		1234567890,
+		4107542399, // 2100-02-28 23:59:59
+		4107542400, // 2100-03-01
+		1<<32 - 1,
+	} {
+		want := time.Unix(int64(ts), 0).UTC().Format("20060102150405")
+		if got := printTimestamp(ts); got != want {
+			t.Errorf("printTimestamp(%d) = %q, want %q", ts, got, want)
+		}
+	}
+	for ts := uint32(0); ts < 1<<32-1<<20; ts += 1<<20 + 12345 {
+		want := time.Unix(int64(ts), 0).UTC().Format("20060102150405")
+		if got := printTimestamp(ts); got != want {
+			t.Fatalf("printTimestamp(%d) = %q, want %q", ts, got, want)
+		}
+	}
+}
+
+func TestSIG0(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(bytes.NewReader(make([]byte, ed25519.SeedSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := SIGResource{
+		Algorithm:  15, // ED25519
+		Expiration: 1700000300,
+		Inception:  1700000000,
+		KeyTag:     12345,
+		SignerName: MustNewName("key.example."),
+	}
+	sign := func(data []byte) ([]byte, error) {
+		return ed25519.Sign(priv, data), nil
+	}
+	verify := func(sig *SIGResource, data []byte) error {
+		if !ed25519.Verify(pub, data, sig.Signature) {
+			return errors.New("bad signature")
+		}
+		return nil
+	}
+
+	b := NewBuilder(nil, Header{ID: 0xbeef, RecursionDesired: true})
+	if err := b.StartQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Question(Question{Name: MustNewName("www.example."), Type: TypeA, Class: ClassINET}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RFC 2931, section 3.1: the signed data is the SIG RDATA without
+	// the signature, followed by the message without the SIG(0).
+	want := []byte{
+		0, 0, // type covered
+		15,         // algorithm
+		0,          // labels
+		0, 0, 0, 0, // original TTL
+		0x65, 0x53, 0xf2, 0x2c, // expiration
+		0x65, 0x53, 0xf1, 0x00, // inception
+		0x30, 0x39, // key tag
+		3, 'k', 'e', 'y', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0, // signer name
+	}
+	want = append(want, msg...)
+	got, err := SIG0SignedData(&sig, nil, msg)
+	if err != nil {
+		t.Fatalf("SIG0SignedData() = %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("SIG0SignedData() = %#v, want %#v", got, want)
+	}
+
+	signed, err := AppendSIG0(msg, nil, sig, sign)
+	if err != nil {
+		t.Fatalf("AppendSIG0() = %v", err)
+	}
+	if err := VerifySIG0(signed, nil, verify); err != nil {
+		t.Errorf("VerifySIG0() = %v", err)
+	}
+	var m Message
+	if err := m.Unpack(signed); err != nil {
+		t.Fatalf("Unpack() = %v", err)
+	}
+	if len(m.Additionals) != 1 {
+		t.Fatalf("got %d additional records, want 1", len(m.Additionals))
+	}
+	wantHdr := ResourceHeader{Name: MustNewName("."), Type: TypeSIG, Class: ClassANY, Length: m.Additionals[0].Header.Length}
+	if m.Additionals[0].Header != wantHdr {
+		t.Errorf("SIG(0) header = %#v, want %#v", m.Additionals[0].Header, wantHdr)
+	}
+	unsigned, gotSig, err := SplitSIG0(signed)
+	if err != nil {
+		t.Fatalf("SplitSIG0() = %v", err)
+	}
+	if !bytes.Equal(unsigned, msg) {
+		t.Errorf("SplitSIG0() message = %#v, want %#v", unsigned, msg)
+	}
+	sig.Signature = gotSig.Signature
+	if !reflect.DeepEqual(gotSig, sig) {
+		t.Errorf("SplitSIG0() record = %#v, want %#v", gotSig, sig)
+	}
+
+	// Any change to the message invalidates the signature.
+	tampered := append([]byte(nil), signed...)
+	tampered[0] ^= 1
+	if err := VerifySIG0(tampered, nil, verify); err == nil {
+		t.Error("VerifySIG0() of tampered message succeeded")
+	}
+
+	// A response signature covers the query it answers.
+	b = NewBuilder(nil, Header{ID: 0xbeef, Response: true})
+	if err := b.StartQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Question(Question{Name: MustNewName("www.example."), Type: TypeA, Class: ClassINET}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.StartAdditionals(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AResource(ResourceHeader{Name: MustNewName("www.example."), Class: ClassINET}, AResource{[4]byte{192, 0, 2, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedResp, err := AppendSIG0(resp, signed, sig, sign)
+	if err != nil {
+		t.Fatalf("AppendSIG0() = %v", err)
+	}
+	if err := VerifySIG0(signedResp, signed, verify); err != nil {
+		t.Errorf("VerifySIG0() of response = %v", err)
+	}
+	if err := VerifySIG0(signedResp, nil, verify); err == nil {
+		t.Error("VerifySIG0() of response without query succeeded")
+	}
+	if unsigned, _, err := SplitSIG0(signedResp); err != nil || !bytes.Equal(unsigned, resp) {
+		t.Errorf("SplitSIG0() of response = %#v, %v; want %#v, nil", unsigned, err, resp)
+	}
+
+	if _, _, err := SplitSIG0(msg); err != errNoSIG0 {
+		t.Errorf("SplitSIG0() of unsigned message = %v, want %v", err, errNoSIG0)
+	}
+}
+
+func TestCSYNCResource(t *testing.T) {
+	// The example of RFC 7477, section 2.1: "66 3 A NS AAAA".
+	csync := CSYNCResource{
+		SOASerial: 66,
+		Flags:     CSYNCFlagImmediate | CSYNCFlagSOAMinimum,
+		Types:     []Type{TypeA, TypeNS, TypeAAAA},
+	}
+	wantRDATA := []byte{
+		0x00, 0x00, 0x00, 0x42, // SOA serial
+		0x00, 0x03, // flags
+		0x00, 0x04, 0x60, 0x00, 0x00, 0x08, // type bitmap
+	}
+	rdata, err := csync.pack(nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rdata, wantRDATA) {
+		t.Errorf("CSYNCResource.pack() = %#v, want %#v", rdata, wantRDATA)
+	}
+	if got, want := csync.String(), "66 3 A NS AAAA"; got != want {
+		t.Errorf("CSYNCResource.String() = %q, want %q", got, want)
+	}
+	if got, want := csync.GoString(), "dnsmessage.CSYNCResource{SOASerial: 66, Flags: 3, Types: []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeNS, dnsmessage.TypeAAAA}}"; got != want {
+		t.Errorf("CSYNCResource.GoString() = %q, want %q", got, want)
+	}
+
+	for _, tt := range []struct {
+		types, want []Type
+	}{
+		{nil, nil},
+		{[]Type{TypeA, TypeNS, TypeAAAA}, []Type{TypeA, TypeNS, TypeAAAA}},
+		// Types are sorted, deduplicated and spread over windows.
+		{[]Type{TypeAAAA, 1234, TypeA, TypeAAAA, 65535, TypeALL}, []Type{TypeA, TypeAAAA, TypeALL, 1234, 65535}},
+	} {
+		want := CSYNCResource{SOASerial: 1, Types: tt.want}
+		b := NewBuilder(nil, Header{Response: true})
+		if err := b.StartAnswers(); err != nil {
+			t.Fatal(err)
+		}
+		hdr := ResourceHeader{Name: MustNewName("example.com."), Class: ClassINET, TTL: 3600}
+		if err := b.CSYNCResource(hdr, CSYNCResource{SOASerial: 1, Types: tt.types}); err != nil {
+			t.Fatalf("Builder.CSYNCResource() = %v", err)
+		}
+		msg, err := b.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p Parser
+		if _, err := p.Start(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SkipAllQuestions(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.AnswerHeader(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := p.CSYNCResource()
+		if err != nil {
+			t.Fatalf("Parser.CSYNCResource() = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Parser.CSYNCResource() = %#v, want %#v", &got, &want)
+		}
+
+		var m Message
+		if err := m.Unpack(msg); err != nil {
+			t.Fatalf("Message.Unpack() = %v", err)
+		}
+		if got, ok := m.Answers[0].Body.(*CSYNCResource); !ok || !reflect.DeepEqual(*got, want) {
+			t.Errorf("Message.Unpack() body = %#v, want %#v", m.Answers[0].Body, &want)
+		}
+	}
+}
+
+func TestAPLResource(t *testing.T) {
+	// Based on the examples of RFC 3123, section 5.
+	apl := APLResource{Prefixes: []APLPrefix{
+		{Family: APLFamilyIPv4, Prefix: 21, AddressFamilyData: []byte{192, 168, 32, 0}},
+		{Family: APLFamilyIPv4, Prefix: 28, Negation: true, AddressFamilyData: []byte{192, 168, 38}},
+		{Family: APLFamilyIPv6, Prefix: 8, AddressFamilyData: []byte{0xff}},
+		{Family: APLFamilyIPv6, Prefix: 0, Negation: true},
+		{Family: 3, Prefix: 8, AddressFamilyData: []byte{0xab, 0xcd}},
+	}}
+	wantRDATA := []byte{
+		0x00, 0x01, 21, 0x03, 192, 168, 32, // trailing zero removed
+		0x00, 0x01, 28, 0x83, 192, 168, 38, // negated
+		0x00, 0x02, 8, 0x01, 0xff,
+		0x00, 0x02, 0, 0x80,
+		0x00, 0x03, 8, 0x02, 0xab, 0xcd,
+	}
+	rdata, err := apl.pack(nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rdata, wantRDATA) {
+		t.Errorf("APLResource.pack() = %#v, want %#v", rdata, wantRDATA)
+	}
+	if got, want := apl.String(), "1:192.168.32.0/21 !1:192.168.38.0/28 2:ff00::/8 !2:::/0 3:abcd/8"; got != want {
+		t.Errorf("APLResource.String() = %q, want %q", got, want)
+	}
+	if got, want := apl.Prefixes[1].GoString(), "dnsmessage.APLPrefix{Family: 1, Prefix: 28, Negation: true, AddressFamilyData: []byte{192, 168, 38}}"; got != want {
+		t.Errorf("APLPrefix.GoString() = %q, want %q", got, want)
+	}
+
+	want := apl
+	want.Prefixes = append([]APLPrefix(nil), apl.Prefixes...)
+	want.Prefixes[0].AddressFamilyData = []byte{192, 168, 32}
+	want.Prefixes[3].AddressFamilyData = []byte{}
+
+	b := NewBuilder(nil, Header{Response: true})
+	if err := b.StartAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	hdr := ResourceHeader{Name: MustNewName("example.com."), Class: ClassINET, TTL: 3600}
+	if err := b.APLResource(hdr, apl); err != nil {
+		t.Fatalf("Builder.APLResource() = %v", err)
+	}
+	if err := b.APLResource(hdr, APLResource{}); err != nil {
+		t.Fatalf("Builder.APLResource() = %v", err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Parser
+	if _, err := p.Start(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.APLResource()
+	if err != nil {
+		t.Fatalf("Parser.APLResource() = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parser.APLResource() = %#v, want %#v", &got, &want)
+	}
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := p.APLResource(); err != nil || len(got.Prefixes) != 0 {
+		t.Errorf("Parser.APLResource() = %#v, %v, want empty list", &got, err)
+	}
+
+	var m Message
+	if err := m.Unpack(msg); err != nil {
+		t.Fatalf("Message.Unpack() = %v", err)
+	}
+	if got, ok := m.Answers[0].Body.(*APLResource); !ok || !reflect.DeepEqual(*got, want) {
+		t.Errorf("Message.Unpack() body = %#v, want %#v", m.Answers[0].Body, &want)
+	}
+
+	long := APLResource{Prefixes: []APLPrefix{{Family: 3, AddressFamilyData: make([]byte, 128)}}}
+	long.Prefixes[0].AddressFamilyData[127] = 1
+	if _, err := long.pack(nil, nil, 0); err != errAPLDataTooLong {
+		t.Errorf("APLResource.pack() with 128 bytes of data = %v, want %v", err, errAPLDataTooLong)
+	}
+}
+
+func TestUnpackAPLResourceErrors(t *testing.T) {
+	for _, b := range [][]byte{
+		{0x00},                              // truncated family
+		{0x00, 0x01, 24},                    // truncated length
+		{0x00, 0x01, 24, 0x03, 192, 168},    // truncated data
+		{0x00, 0x01, 24, 0x02, 192, 168, 1}, // trailing byte
+	} {
+		if _, err := unpackAPLResource(b, 0, uint16(len(b))); err == nil {
+			t.Errorf("unpackAPLResource(%#v) succeeded, want error", b)
+		}
+	}
+}
+
+func TestHIPResource(t *testing.T) {
+	// Based on the example of RFC 8005, section 6, with a shorter key.
+	hip := HIPResource{
+		PublicKeyAlgorithm: 2,
+		HIT:                []byte{0x20, 0x01, 0x00, 0x10, 0x7b, 0x1a, 0x74, 0xdf, 0x36, 0x56, 0x39, 0xcc, 0x39, 0xf1, 0xd5, 0x78},
+		PublicKey:          []byte{0x03, 0x01, 0x00, 0x01, 0xb7, 0x71},
+		RendezvousServers:  []Name{MustNewName("rvs1.example.com."), MustNewName("rvs2.example.com.")},
+	}
+	if got, want := hip.String(), "2 200100107b1a74df365639cc39f1d578 AwEAAbdx rvs1.example.com. rvs2.example.com."; got != want {
+		t.Errorf("HIPResource.String() = %q, want %q", got, want)
+	}
+	if got, want := (&HIPResource{PublicKeyAlgorithm: 2, HIT: []byte{1}, RendezvousServers: []Name{MustNewName("rvs.")}}).GoString(),
+		`dnsmessage.HIPResource{PublicKeyAlgorithm: 2, HIT: []byte{1}, PublicKey: []byte{}, RendezvousServers: []dnsmessage.Name{dnsmessage.MustNewName("rvs.")}}`; got != want {
+		t.Errorf("HIPResource.GoString() = %q, want %q", got, want)
+	}
+
+	// The rendezvous servers share a suffix with the owner name, but
+	// are not compressed.
+	b := NewBuilder(nil, Header{Response: true})
+	b.EnableCompression()
+	if err := b.StartAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	hdr := ResourceHeader{Name: MustNewName("www.example.com."), Class: ClassINET, TTL: 3600}
+	if err := b.HIPResource(hdr, hip); err != nil {
+		t.Fatalf("Builder.HIPResource() = %v", err)
+	}
+	if err := b.HIPResource(hdr, HIPResource{PublicKeyAlgorithm: 3, HIT: []byte{1, 2}, PublicKey: []byte{3}}); err != nil {
+		t.Fatalf("Builder.HIPResource() = %v", err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdata, err := hip.pack(nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRDATA := append([]byte{16, 2, 0, 6}, hip.HIT...)
+	wantRDATA = append(wantRDATA, hip.PublicKey...)
+	wantRDATA = append(wantRDATA, "\x04rvs1\x07example\x03com\x00\x04rvs2\x07example\x03com\x00"...)
+	if !bytes.Equal(rdata, wantRDATA) {
+		t.Errorf("HIPResource.pack() = %#v, want %#v", rdata, wantRDATA)
+	}
+	if !bytes.Contains(msg, rdata) {
+		t.Errorf("packed message does not contain uncompressed RDATA %#v", rdata)
+	}
+
+	var p Parser
+	if _, err := p.Start(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.HIPResource()
+	if err != nil {
+		t.Fatalf("Parser.HIPResource() = %v", err)
+	}
+	if !reflect.DeepEqual(got, hip) {
+		t.Errorf("Parser.HIPResource() = %#v, want %#v", &got, &hip)
+	}
+
+	var m Message
+	if err := m.Unpack(msg); err != nil {
+		t.Fatalf("Message.Unpack() = %v", err)
+	}
+	want := HIPResource{PublicKeyAlgorithm: 3, HIT: []byte{1, 2}, PublicKey: []byte{3}}
+	if got, ok := m.Answers[1].Body.(*HIPResource); !ok || !reflect.DeepEqual(*got, want) {
+		t.Errorf("Message.Unpack() body = %#v, want %#v", m.Answers[1].Body, &want)
+	}
+
+	if _, err := (&HIPResource{HIT: make([]byte, 256)}).pack(nil, nil, 0); err != errHITTooLong {
+		t.Errorf("HIPResource.pack() with long HIT = %v, want %v", err, errHITTooLong)
+	}
+	if _, err := (&HIPResource{PublicKey: make([]byte, 65536)}).pack(nil, nil, 0); err != errHIPKeyTooLong {
+		t.Errorf("HIPResource.pack() with long key = %v, want %v", err, errHIPKeyTooLong)
+	}
+	for _, b := range [][]byte{
+		{2, 2},                // truncated
+		{2, 2, 0, 1, 1, 2},    // truncated key
+		{1, 2, 0, 1, 1, 2, 3}, // truncated name
+	} {
+		if _, err := unpackHIPResource(b, 0, uint16(len(b)), true); err == nil {
+			t.Errorf("unpackHIPResource(%#v) succeeded, want error", b)
+		}
+	}
+}
+
+func TestZONEMDResource(t *testing.T) {
+	sum := sha512.Sum384([]byte("example."))
+	zonemd := ZONEMDResource{
+		Serial:        2018031900,
+		Scheme:        ZONEMDSchemeSimple,
+		HashAlgorithm: ZONEMDHashSHA384,
+		Digest:        sum[:],
+	}
+	if got, want := zonemd.String(), "2018031900 1 1 "+fmt.Sprintf("%x", sum); got != want {
+		t.Errorf("ZONEMDResource.String() = %q, want %q", got, want)
+	}
+	if got, want := (&ZONEMDResource{Serial: 1, Scheme: 1, HashAlgorithm: 240, Digest: []byte{1, 2}}).GoString(),
+		"dnsmessage.ZONEMDResource{Serial: 1, Scheme: 1, HashAlgorithm: 240, Digest: []byte{1, 2}}"; got != want {
+		t.Errorf("ZONEMDResource.GoString() = %q, want %q", got, want)
+	}
+
+	b := NewBuilder(nil, Header{Response: true})
+	if err := b.StartAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	hdr := ResourceHeader{Name: MustNewName("example."), Class: ClassINET, TTL: 86400}
+	if err := b.ZONEMDResource(hdr, zonemd); err != nil {
+		t.Fatalf("Builder.ZONEMDResource() = %v", err)
+	}
+	private := ZONEMDResource{Serial: 1, Scheme: 240, HashAlgorithm: 241, Digest: make([]byte, 12)}
+	if err := b.ZONEMDResource(hdr, private); err != nil {
+		t.Fatalf("Builder.ZONEMDResource() = %v", err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p Parser
+	if _, err := p.Start(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.ZONEMDResource()
+	if err != nil {
+		t.Fatalf("Parser.ZONEMDResource() = %v", err)
+	}
+	if !reflect.DeepEqual(got, zonemd) {
+		t.Errorf("Parser.ZONEMDResource() = %#v, want %#v", &got, &zonemd)
+	}
+
+	var m Message
+	if err := m.Unpack(msg); err != nil {
+		t.Fatalf("Message.Unpack() = %v", err)
+	}
+	if got, ok := m.Answers[1].Body.(*ZONEMDResource); !ok || !reflect.DeepEqual(*got, private) {
+		t.Errorf("Message.Unpack() body = %#v, want %#v", m.Answers[1].Body, &private)
+	}
+
+	for _, r := range []ZONEMDResource{
+		{HashAlgorithm: ZONEMDHashSHA384, Digest: sum[:47]},
+		{HashAlgorithm: ZONEMDHashSHA512, Digest: sum[:]},
+		{HashAlgorithm: 241, Digest: make([]byte, 11)},
+	} {
+		if _, err := r.pack(nil, nil, 0); err != errZONEMDDigestLen {
+			t.Errorf("%#v.pack() = %v, want %v", &r, err, errZONEMDDigestLen)
+		}
+	}
+	for _, b := range [][]byte{
+		{0, 0, 0, 1, 1}, // truncated
+		append([]byte{0, 0, 0, 1, 1, 1}, sum[:47]...), // short SHA-384 digest
+	} {
+		if _, err := unpackZONEMDResource(b, 0, uint16(len(b))); err == nil {
+			t.Errorf("unpackZONEMDResource(%#v) succeeded, want error", b)
+		}
+	}
+}
+
+func TestWKSResource(t *testing.T) {
+	wks := WKSResource{
+		Address:  [4]byte{192, 0, 2, 1},
+		Protocol: 6, // TCP
+		// Ports 21, 23 and 25.
+		Bitmap: []byte{0, 0, 0b00000101, 0b01000000},
+	}
+	if got, want := wks.String(), "192.0.2.1 6 21 23 25"; got != want {
+		t.Errorf("WKSResource.String() = %q, want %q", got, want)
+	}
+	if got, want := wks.GoString(), "dnsmessage.WKSResource{Address: [4]byte{192, 0, 2, 1}, Protocol: 6, Bitmap: []byte{0, 0, 5, 64}}"; got != want {
+		t.Errorf("WKSResource.GoString() = %q, want %q", got, want)
+	}
+
+	b := NewBuilder(nil, Header{Response: true})
+	if err := b.StartAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	hdr := ResourceHeader{Name: MustNewName("example."), Class: ClassINET, TTL: 3600}
+	if err := b.WKSResource(hdr, wks); err != nil {
+		t.Fatalf("Builder.WKSResource() = %v", err)
+	}
+	empty := WKSResource{Address: [4]byte{192, 0, 2, 2}, Protocol: 17, Bitmap: []byte{}}
+	if err := b.WKSResource(hdr, empty); err != nil {
+		t.Fatalf("Builder.WKSResource() = %v", err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p Parser
+	if _, err := p.Start(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.WKSResource()
+	if err != nil {
+		t.Fatalf("Parser.WKSResource() = %v", err)
+	}
+	if !reflect.DeepEqual(got, wks) {
+		t.Errorf("Parser.WKSResource() = %#v, want %#v", &got, &wks)
+	}
+
+	var m Message
+	if err := m.Unpack(msg); err != nil {
+		t.Fatalf("Message.Unpack() = %v", err)
+	}
+	if got, ok := m.Answers[1].Body.(*WKSResource); !ok || !reflect.DeepEqual(*got, empty) {
+		t.Errorf("Message.Unpack() body = %#v, want %#v", m.Answers[1].Body, &empty)
+	}
+
+	for _, b := range [][]byte{
+		{192, 0, 2},    // truncated address
+		{192, 0, 2, 1}, // missing protocol
+	} {
+		if _, err := unpackWKSResource(b, 0, uint16(len(b))); err == nil {
+			t.Errorf("unpackWKSResource(%#v) succeeded, want error", b)
+		}
+	}
+}
+
+func TestRPAndAFSDBResources(t *testing.T) {
+	rp := RPResource{Mbox: MustNewName("admin.example."), Txt: MustNewName("info.example.")}
+	afsdb := AFSDBResource{Subtype: AFSDBSubtypeAFS, Hostname: MustNewName("afs.example.")}
+	if got, want := rp.String(), "admin.example. info.example."; got != want {
+		t.Errorf("RPResource.String() = %q, want %q", got, want)
+	}
+	if got, want := afsdb.GoString(), `dnsmessage.AFSDBResource{Subtype: 1, Hostname: dnsmessage.MustNewName("afs.example.")}`; got != want {
+		t.Errorf("AFSDBResource.GoString() = %q, want %q", got, want)
+	}
+
+	b := NewBuilder(nil, Header{Response: true})
+	b.EnableCompression()
+	if err := b.StartAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	hdr := ResourceHeader{Name: MustNewName("example."), Class: ClassINET, TTL: 3600}
+	if err := b.RPResource(hdr, rp); err != nil {
+		t.Fatalf("Builder.RPResource() = %v", err)
+	}
+	if err := b.AFSDBResource(hdr, afsdb); err != nil {
+		t.Fatalf("Builder.AFSDBResource() = %v", err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the second owner name may be compressed; the names in the
+	// RDATA must not be.
+	if got := bytes.Count(msg, []byte("\x07example\x00")); got != 4 {
+		t.Errorf("packed message has %d uncompressed copies of example., want 4", got)
+	}
+
+	var p Parser
+	if _, err := p.Start(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	gotRP, err := p.RPResource()
+	if err != nil {
+		t.Fatalf("Parser.RPResource() = %v", err)
+	}
+	if gotRP != rp {
+		t.Errorf("Parser.RPResource() = %#v, want %#v", &gotRP, &rp)
+	}
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	gotAFSDB, err := p.AFSDBResource()
+	if err != nil {
+		t.Fatalf("Parser.AFSDBResource() = %v", err)
+	}
+	if gotAFSDB != afsdb {
+		t.Errorf("Parser.AFSDBResource() = %#v, want %#v", &gotAFSDB, &afsdb)
+	}
+}
+
+func TestUnpackCompressedRPAndAFSDB(t *testing.T) {
+	// "example." at offset 0, followed by RDATA whose names point to it.
+	msg := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0}
+	rdata := len(msg)
+	msg = append(msg,
+		5, 'a', 'd', 'm', 'i', 'n', 0xC0, 0, // admin.example.
+		0xC0, 0, // example.
+	)
+	rp, err := unpackRPResource(msg, rdata, true)
+	if err != nil {
+		t.Fatalf("unpackRPResource() = %v", err)
+	}
+	if want := (RPResource{MustNewName("admin.example."), MustNewName("example.")}); rp != want {
+		t.Errorf("unpackRPResource() = %#v, want %#v", &rp, &want)
+	}
+
+	msg = append(msg[:rdata], 0, 2, 0xC0, 0)
+	afsdb, err := unpackAFSDBResource(msg, rdata, true)
+	if err != nil {
+		t.Fatalf("unpackAFSDBResource() = %v", err)
+	}
+	if want := (AFSDBResource{AFSDBSubtypeDCE, MustNewName("example.")}); afsdb != want {
+		t.Errorf("unpackAFSDBResource() = %#v, want %#v", &afsdb, &want)
+	}
+}
+
+func TestParserStrictCompression(t *testing.T) {
+	msg := []byte{
+		0, 0, 0x80, 0, 0, 1, 0, 3, 0, 0, 0, 0, // response with 1 question, 3 answers
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0, 0, 1, 0, 1, // example. A IN
+		// A record whose address looks like a pointer to "example.".
+		0xC0, 12, 0, 1, 0, 1, 0, 0, 0, 0, 0, 4, 0xC0, 12, 0, 1,
+		// MX record with a compressed exchange, allowed by RFC 1035.
+		0xC0, 12, 0, 15, 0, 1, 0, 0, 0, 0, 0, 4, 0, 10, 0xC0, 12,
+		// RP record with compressed names.
+		0xC0, 12, 0, 17, 0, 1, 0, 0, 0, 0, 0, 4, 0xC0, 12, 0xC0, 12,
+	}
+	for _, strict := range []bool{false, true} {
+		var p Parser
+		p.SetStrictCompression(strict)
+		if _, err := p.Start(msg); err != nil {
+			t.Fatalf("Parser.Start() = %v", err)
+		}
+		if err := p.SkipAllQuestions(); err != nil {
+			t.Fatalf("Parser.SkipAllQuestions() = %v", err)
+		}
+		answers, err := p.AllAnswers()
+		if strict {
+			if !errors.Is(err, ErrCompressedRData) {
+				t.Errorf("strict Parser.AllAnswers() = %v, want %v", err, ErrCompressedRData)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Parser.AllAnswers() = %v", err)
+		}
+		if want := (AResource{[4]byte{0xC0, 12, 0, 1}}); *answers[0].Body.(*AResource) != want {
+			t.Errorf("A record = %#v, want %#v", answers[0].Body, &want)
+		}
+		if want := (RPResource{MustNewName("example."), MustNewName("example.")}); *answers[2].Body.(*RPResource) != want {
+			t.Errorf("RP record = %#v, want %#v", answers[2].Body, &want)
+		}
+	}
+
+	// The typed methods are strict too, and the setting survives Start.
+	var p Parser
+	p.SetStrictCompression(true)
+	p.Start(msg)
+	p.Start(msg)
+	p.SkipAllQuestions()
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := p.AResource(); err != nil || a.A != [4]byte{0xC0, 12, 0, 1} {
+		t.Errorf("Parser.AResource() = %#v, %v", a, err)
+	}
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if mx, err := p.MXResource(); err != nil || mx.MX != MustNewName("example.") {
+		t.Errorf("Parser.MXResource() = %#v, %v", mx, err)
+	}
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.RPResource(); !errors.Is(err, ErrCompressedRData) {
+		t.Errorf("Parser.RPResource() = %v, want %v", err, ErrCompressedRData)
+	}
+}
+
+func TestIPSECKEYResource(t *testing.T) {
+	// Based on the examples of RFC 4025, section 3, with a shorter key.
+	key := []byte{0x01, 0x03, 0x51, 0x53, 0x79, 0x86}
+	for _, tt := range []struct {
+		r       IPSECKEYResource
+		gateway []byte // wire format of the gateway
+		str     string
+		goStr   string
+	}{
+		{
+			IPSECKEYResource{Precedence: 10, GatewayType: IPSECKEYGatewayNone, Algorithm: 2, PublicKey: key},
+			nil,
+			"10 0 2 . AQNRU3mG",
+			`dnsmessage.IPSECKEYResource{Precedence: 10, GatewayType: 0, Algorithm: 2, PublicKey: []byte{1, 3, 81, 83, 121, 134}}`,
+		},
+		{
+			IPSECKEYResource{Precedence: 10, GatewayType: IPSECKEYGatewayIPv4, Algorithm: 2, GatewayIPv4: [4]byte{192, 0, 2, 38}, PublicKey: key},
+			[]byte{192, 0, 2, 38},
+			"10 1 2 192.0.2.38 AQNRU3mG",
+			`dnsmessage.IPSECKEYResource{Precedence: 10, GatewayType: 1, Algorithm: 2, GatewayIPv4: [4]byte{192, 0, 2, 38}, PublicKey: []byte{1, 3, 81, 83, 121, 134}}`,
+		},
+		{
+			IPSECKEYResource{Precedence: 10, GatewayType: IPSECKEYGatewayIPv6, Algorithm: 2, GatewayIPv6: [16]byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0x80, 0x02, 14: 0x20, 15: 0x01}, PublicKey: key},
+			[]byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0x80, 0x02, 0, 0, 0, 0, 0, 0, 0x20, 0x01},
+			"10 2 2 2001:db8:0:8002::2001 AQNRU3mG",
+			`dnsmessage.IPSECKEYResource{Precedence: 10, GatewayType: 2, Algorithm: 2, GatewayIPv6: [16]byte{32, 1, 13, 184, 0, 0, 128, 2, 0, 0, 0, 0, 0, 0, 32, 1}, PublicKey: []byte{1, 3, 81, 83, 121, 134}}`,
+		},
+		{
+			IPSECKEYResource{Precedence: 10, GatewayType: IPSECKEYGatewayName, Algorithm: 2, GatewayName: MustNewName("gw.example.com."), PublicKey: key},
+			[]byte("\x02gw\x07example\x03com\x00"),
+			"10 3 2 gw.example.com. AQNRU3mG",
+			`dnsmessage.IPSECKEYResource{Precedence: 10, GatewayType: 3, Algorithm: 2, GatewayName: dnsmessage.MustNewName("gw.example.com."), PublicKey: []byte{1, 3, 81, 83, 121, 134}}`,
+		},
+		{
+			IPSECKEYResource{Precedence: 20, GatewayType: IPSECKEYGatewayIPv4, GatewayIPv4: [4]byte{192, 0, 2, 1}},
+			[]byte{192, 0, 2, 1},
+			"20 1 0 192.0.2.1",
+			`dnsmessage.IPSECKEYResource{Precedence: 20, GatewayType: 1, Algorithm: 0, GatewayIPv4: [4]byte{192, 0, 2, 1}, PublicKey: []byte{}}`,
+		},
+	} {
+		if got := tt.r.String(); got != tt.str {
+			t.Errorf("IPSECKEYResource.String() = %q, want %q", got, tt.str)
+		}
+		if got := tt.r.GoString(); got != tt.goStr {
+			t.Errorf("IPSECKEYResource.GoString() = %q, want %q", got, tt.goStr)
+		}
+		rdata, err := tt.r.pack(nil, nil, 0)
+		if err != nil {
+			t.Fatalf("%v: IPSECKEYResource.pack() = %v", tt.str, err)
+		}
+		wantRDATA := append([]byte{tt.r.Precedence, tt.r.GatewayType, tt.r.Algorithm}, tt.gateway...)
+		wantRDATA = append(wantRDATA, tt.r.PublicKey...)
+		if !bytes.Equal(rdata, wantRDATA) {
+			t.Errorf("%v: IPSECKEYResource.pack() = %#v, want %#v", tt.str, rdata, wantRDATA)
+		}
+
+		// The gateway name shares a suffix with the owner name, but
+		// is not compressed.
+		b := NewBuilder(nil, Header{Response: true})
+		b.EnableCompression()
+		if err := b.StartAnswers(); err != nil {
+			t.Fatal(err)
+		}
+		hdr := ResourceHeader{Name: MustNewName("host.example.com."), Class: ClassINET, TTL: 7200}
+		if err := b.IPSECKEYResource(hdr, tt.r); err != nil {
+			t.Fatalf("%v: Builder.IPSECKEYResource() = %v", tt.str, err)
+		}
+		msg, err := b.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(msg, rdata) {
+			t.Errorf("%v: packed message does not contain uncompressed RDATA %#v", tt.str, rdata)
+		}
+
+		var p Parser
+		if _, err := p.Start(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SkipAllQuestions(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.AnswerHeader(); err != nil {
+			t.Fatal(err)
+		}
+		want := tt.r
+		if want.PublicKey == nil {
+			want.PublicKey = []byte{}
+		}
+		got, err := p.IPSECKEYResource()
+		if err != nil {
+			t.Fatalf("%v: Parser.IPSECKEYResource() = %v", tt.str, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Parser.IPSECKEYResource() = %#v, want %#v", &got, &want)
+		}
+
+		var m Message
+		if err := m.Unpack(msg); err != nil {
+			t.Fatalf("%v: Message.Unpack() = %v", tt.str, err)
+		}
+		if got, ok := m.Answers[0].Body.(*IPSECKEYResource); !ok || !reflect.DeepEqual(*got, want) {
+			t.Errorf("Message.Unpack() body = %#v, want %#v", m.Answers[0].Body, &want)
+		}
+	}
+
+	if _, err := (&IPSECKEYResource{GatewayType: 4}).pack(nil, nil, 0); err != errIPSECKEYGateway {
+		t.Errorf("IPSECKEYResource.pack() with unknown gateway type = %v, want %v", err, errIPSECKEYGateway)
+	}
+	// "example." at offset 0, followed by RDATA.
+	prefix := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0}
+	for _, tt := range []struct {
+		rdata   []byte
+		wantErr error
+	}{
+		{[]byte{10, 4, 2, 1, 2, 3, 4}, errIPSECKEYGateway},
+		{[]byte{10, 1, 2, 192, 0, 2}, nil},              // truncated IPv4 address
+		{[]byte{10, 2, 2, 0x20, 0x01, 0x0d, 0xb8}, nil}, // truncated IPv6 address
+		{[]byte{10, 3, 2, 2, 'g', 'w'}, nil},            // truncated name
+		{[]byte{10, 3, 2, 2, 'g', 'w', 0xC0, 0}, ErrCompressedRData},
+		{[]byte{10, 0}, nil}, // truncated header
+	} {
+		msg := append(prefix[:len(prefix):len(prefix)], tt.rdata...)
+		_, err := unpackIPSECKEYResource(msg, len(prefix), uint16(len(tt.rdata)))
+		if err == nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("unpackIPSECKEYResource(%#v) = %v, want error %v", tt.rdata, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUnpackTypeBitmapErrors(t *testing.T) {
+	for _, b := range [][]byte{
+		{0x00},                               // truncated window header
+		{0x00, 0x00},                         // empty bitmap
+		{0x00, 0x21},                         // bitmap too long
+		{0x00, 0x02, 0x40},                   // truncated bitmap
+		{0x01, 0x01, 0x40, 0x00, 0x01, 0x40}, // windows out of order
+		{0x00, 0x01, 0x40, 0x00, 0x01, 0x40}, // repeated window
+	} {
+		if _, err := unpackTypeBitmap(b, 0, len(b)); err != errTypeBitmap {
+			t.Errorf("unpackTypeBitmap(%#v) = %v, want %v", b, err, errTypeBitmap)
+		}
+	}
+}
+
+func TestParserTrailingData(t *testing.T) {
+	b := NewBuilder(nil, Header{ID: 1, Response: true})
+	b.StartQuestions()
+	b.Question(Question{Name: MustNewName("example.com."), Type: TypeA, Class: ClassINET})
+	b.StartAdditionals()
+	b.AResource(ResourceHeader{Name: MustNewName("example.com."), Class: ClassINET}, AResource{[4]byte{192, 0, 2, 1}})
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatalf("Builder.Finish() = %v", err)
+	}
+	garbage := []byte{0xde, 0xad, 0xbe, 0xef}
+
+	for _, tt := range []struct {
+		name     string
+		msg      []byte
+		reject   bool
+		wantErr  error
+		trailing []byte
+	}{
+		{"lenient", msg, false, nil, nil},
+		{"lenient trailing", append(msg[:len(msg):len(msg)], garbage...), false, nil, garbage},
+		{"strict", msg, true, nil, nil},
+		{"strict trailing", append(msg[:len(msg):len(msg)], garbage...), true, ErrTrailingData, nil},
+	} {
+		for _, skip := range []bool{false, true} {
+			var p Parser
+			p.SetRejectTrailingData(tt.reject)
+			if _, err := p.Start(tt.msg); err != nil {
+				t.Fatalf("%s: Parser.Start() = %v", tt.name, err)
+			}
+			if err := p.SkipAllQuestions(); err != nil {
+				t.Fatalf("%s: Parser.SkipAllQuestions() = %v", tt.name, err)
+			}
+			if err := p.SkipAllAnswers(); err != nil {
+				t.Fatalf("%s: Parser.SkipAllAnswers() = %v", tt.name, err)
+			}
+			if err := p.SkipAllAuthorities(); err != nil {
+				t.Fatalf("%s: Parser.SkipAllAuthorities() = %v", tt.name, err)
+			}
+			if skip {
+				err = p.SkipAllAdditionals()
+			} else {
+				_, err = p.AllAdditionals()
+			}
+			if err != tt.wantErr {
+				t.Errorf("%s: parsing Additionals (skip %t) = %v, want %v", tt.name, skip, err, tt.wantErr)
+			}
+			if got := p.TrailingData(); !bytes.Equal(got, tt.trailing) {
+				t.Errorf("%s: Parser.TrailingData() = %x, want %x", tt.name, got, tt.trailing)
+			}
+		}
+	}
+
+	// The setting survives Start.
+	var p Parser
+	p.SetRejectTrailingData(true)
+	p.Start(msg)
+	p.Start(append(msg[:len(msg):len(msg)], garbage...))
+	p.SkipAllQuestions()
+	p.SkipAllAnswers()
+	p.SkipAllAuthorities()
+	if _, err := p.Additional(); err != nil {
+		t.Fatalf("Parser.Additional() = %v", err)
+	}
+	if _, err := p.Additional(); err != ErrTrailingData {
+		t.Errorf("Parser.Additional() after the last one = %v, want %v", err, ErrTrailingData)
+	}
+	if err := p.SkipAdditional(); err != ErrTrailingData {
+		t.Errorf("Parser.SkipAdditional() after the last one = %v, want %v", err, ErrTrailingData)
+	}
+}
+
+func TestOPTOptions(t *testing.T) {
+	opts := []Option{
+		{Code: 10, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}, // cookie
+		{Code: 8, Data: []byte{0, 1, 24, 0, 192, 0, 2}},  // client subnet
+		{Code: 12, Data: []byte{}},                       // padding
+	}
+	b := NewBuilder(nil, Header{})
+	if err := b.StartAdditionals(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.OPTResource(ResourceHeader{Name: MustNewName("."), Class: 4096}, OPTResource{Options: opts}); err != nil {
+		t.Fatal(err)
+	}
+	// A record following the OPT record, whose data must not be taken
+	// for options.
+	if err := b.AResource(ResourceHeader{Name: MustNewName("."), Class: ClassINET}, AResource{A: [4]byte{0, 10, 0, 4}}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parse := func(msg []byte) (got []Option, err error) {
+		var p Parser
+		if _, err := p.Start(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SkipAllQuestions(); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SkipAllAnswers(); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SkipAllAuthorities(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.AdditionalHeader(); err != nil {
+			t.Fatal(err)
+		}
+		it, err := p.OPTOptions()
+		if err != nil {
+			t.Fatalf("Parser.OPTOptions() = %v", err)
+		}
+		for {
+			o, ok := it.Next()
+			if !ok {
+				break
+			}
+			got = append(got, o)
+		}
+		if _, ok := it.Next(); ok {
+			t.Errorf("OptionIterator.Next() after the end = _, true, want false")
+		}
+		// The parser moved on to the following record.
+		if h, err := p.AdditionalHeader(); err != nil || h.Type != TypeA {
+			t.Errorf("Parser.AdditionalHeader() after OPTOptions = %v, %v, want type %v", h, err, TypeA)
+		}
+		return got, it.Err()
+	}
+
+	got, err := parse(msg)
+	if err != nil {
+		t.Fatalf("OptionIterator.Err() = %v", err)
+	}
+	if !reflect.DeepEqual(got, opts) {
+		t.Errorf("got options %#v, want %#v", got, opts)
+	}
+
+	// Make the last option overrun the OPT record into the A record.
+	i := bytes.Index(msg, []byte{0, 12, 0, 0})
+	if i < 0 {
+		t.Fatal("padding option not found in message")
+	}
+	bad := append([]byte(nil), msg...)
+	bad[i+3] = 4
+	got, err = parse(bad)
+	if err == nil {
+		t.Errorf("OptionIterator.Err() with an option beyond the record = nil, want error")
+	}
+	if !reflect.DeepEqual(got, opts[:2]) {
+		t.Errorf("got options %#v before the bad one, want %#v", got, opts[:2])
+	}
+}
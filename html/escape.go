@@ -183,6 +183,78 @@ func unescape(b []byte, attribute bool) []byte {
 	return b
 }
 
+// unescapeExtra is like unescape, but a named character reference that
+// is not an HTML5 entity is also looked up in extra, which maps entity
+// names, without the leading '&' and trailing ';', to their
+// replacements. A replacement may be longer than its reference, so
+// unlike unescape, unescapeExtra does not work in place unless extra
+// is empty.
+func unescapeExtra(b []byte, attribute bool, extra map[string]string) []byte {
+	if len(extra) == 0 || bytes.IndexByte(b, '&') < 0 {
+		return unescape(b, attribute)
+	}
+	out := make([]byte, 0, len(b))
+	var scratch []byte
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '&')
+		if i < 0 {
+			out = append(out, b...)
+			break
+		}
+		out = append(out, b[:i]...)
+		b = b[i:]
+
+		// Find the end of the reference's name, which starts after
+		// the '&' or, for numeric references, the "&#".
+		j := 1
+		if j < len(b) && b[j] == '#' {
+			j++
+		}
+		for j < len(b) && isEntityNameByte(b[j]) {
+			j++
+		}
+
+		// Try the HTML5 references first. unescapeEntity works in
+		// place, so give it a copy of the reference, including the
+		// ';' or the byte after the name that it may look at.
+		end := j + 1
+		if end > len(b) {
+			end = len(b)
+		}
+		scratch = append(scratch[:0], b[:end]...)
+		dst, src := unescapeEntity(scratch, 0, 0, attribute)
+		if !bytes.Equal(scratch[:dst], b[:src]) {
+			out = append(out, scratch[:dst]...)
+			b = b[src:]
+			continue
+		}
+
+		name := string(b[1:j])
+		semicolon := j < len(b) && b[j] == ';'
+		if r, ok := extra[name]; ok && name != "" && b[1] != '#' {
+			// As for HTML5 references, a reference in an attribute
+			// value without a ';' is left alone if followed by '='.
+			if semicolon || !attribute || j == len(b) || b[j] != '=' {
+				out = append(out, r...)
+				if semicolon {
+					j++
+				}
+				b = b[j:]
+				continue
+			}
+		}
+		out = append(out, b[:src]...)
+		b = b[src:]
+	}
+	return out
+}
+
+// isEntityNameByte reports whether c may appear in the name of a named
+// character reference.
+func isEntityNameByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
 // lower lower-cases the A-Z bytes in b in-place, so that "aBc" becomes "abc".
 func lower(b []byte) []byte {
 	for i, c := range b {
@@ -337,3 +409,20 @@ func UnescapeString(s string) string {
 	}
 	return s
 }
+
+// UnescapeStringWithEntities is like UnescapeString, but also unescapes
+// the named character references in extra, which maps entity names to
+// their replacements. Names are given without the leading '&' and
+// trailing ';', so {"foo": "bar"} unescapes both "&foo;" and "&foo" to
+// "bar". The HTML5 entities take precedence: extra is only consulted
+// for references that are not HTML5 entities.
+//
+// This is intended for legacy documents that use non-standard
+// entities. It diverges from the HTML5 specification, under which such
+// references are left as they are.
+func UnescapeStringWithEntities(s string, extra map[string]string) string {
+	if strings.IndexByte(s, '&') < 0 {
+		return s
+	}
+	return string(unescapeExtra([]byte(s), false, extra))
+}
@@ -75,6 +75,36 @@ func TestUnescape(t *testing.T) {
 	}
 }
 
+func TestUnescapeStringWithEntities(t *testing.T) {
+	extra := map[string]string{
+		"company": "Example Corp.",
+		"amp":     "not used",
+		"x":       "ex",
+	}
+	tests := []struct {
+		html, want string
+	}{
+		{"&company; &copy; 2001", "Example Corp. © 2001"},
+		{"&company &amp; co", "Example Corp. & co"},
+		{"&x;&x&#120;", "exexx"},
+		{"&unknown; &#;", "&unknown; &#;"},
+		{"no references", "no references"},
+		{"&", "&"},
+		{"&company", "Example Corp."},
+	}
+	for _, tt := range tests {
+		if got := UnescapeStringWithEntities(tt.html, extra); got != tt.want {
+			t.Errorf("UnescapeStringWithEntities(%q) = %q, want %q", tt.html, got, tt.want)
+		}
+	}
+	// Without extra entities, it is UnescapeString.
+	for _, tt := range unescapeTests {
+		if got := UnescapeStringWithEntities(tt.html, nil); got != tt.unescaped {
+			t.Errorf("UnescapeStringWithEntities(%q, nil) = %q, want %q", tt.html, got, tt.unescaped)
+		}
+	}
+}
+
 func TestUnescapeEscape(t *testing.T) {
 	ss := []string{
 		``,
@@ -2366,6 +2366,32 @@ func ParseOptionEnableScripting(enable bool) ParseOption {
 	}
 }
 
+// ParseOptionExtraEntities configures additional named character
+// references for the parser to unescape in text and attribute values,
+// as for UnescapeStringWithEntities. The HTML5 entities take
+// precedence over those in extra.
+//
+// This diverges from the HTML5 specification, under which such
+// references are left as they are, and is intended for legacy
+// documents that use non-standard entities.
+func ParseOptionExtraEntities(extra map[string]string) ParseOption {
+	return func(p *parser) {
+		p.tokenizer.SetExtraEntities(extra)
+	}
+}
+
+// ParseOptionKeepRawAttrVals configures whether the parser records the
+// source text of each attribute value in Attribute.RawVal, so that
+// callers can see values such as "a&amp;b" as written as well as
+// unescaped.
+//
+// By default, RawVal is left empty.
+func ParseOptionKeepRawAttrVals(keep bool) ParseOption {
+	return func(p *parser) {
+		p.tokenizer.keepRawAttrVals = keep
+	}
+}
+
 // ParseWithOptions is like Parse, with options.
 func ParseWithOptions(r io.Reader, opts ...ParseOption) (*Node, error) {
 	p := &parser{
@@ -2458,3 +2484,35 @@ func ParseFragmentWithOptions(r io.Reader, context *Node, opts ...ParseOption) (
 	}
 	return result, nil
 }
+
+// ParseFragmentInContext is like ParseFragmentWithOptions, but names the
+// context element by its tag name and namespace instead of requiring a
+// *Node. namespace is "" for HTML elements, or "svg" or "math" for
+// foreign elements, as in Node.Namespace. HTML tag names are
+// case-insensitive; foreign ones are used as given, such as
+// "foreignObject". The name need not be known to this package, so that
+// fragments can be parsed as the content of custom elements.
+//
+// As with ParseFragment, the context selects the insertion mode the
+// fragment is parsed in. For example, a "tr" context keeps "<td>" cells,
+// a "select" context keeps "<option>" elements and ignores most other
+// tags, and a "template" context accepts table rows and cells anywhere.
+func ParseFragmentInContext(r io.Reader, name, namespace string, opts ...ParseOption) ([]*Node, error) {
+	if name == "" {
+		return nil, errors.New("html: ParseFragmentInContext with empty context name")
+	}
+	switch namespace {
+	case "":
+		name = strings.ToLower(name)
+	case "svg", "math":
+	default:
+		return nil, fmt.Errorf("html: ParseFragmentInContext with unknown namespace %q", namespace)
+	}
+	context := &Node{
+		Type:      ElementNode,
+		DataAtom:  a.Lookup([]byte(name)),
+		Data:      name,
+		Namespace: namespace,
+	}
+	return ParseFragmentWithOptions(r, context, opts...)
+}
@@ -13,6 +13,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"sort"
 	"strings"
@@ -476,6 +477,117 @@ func TestParseFragmentForeignContentTemplates(t *testing.T) {
 	}
 }
 
+func TestParseFragmentInContext(t *testing.T) {
+	tests := []struct {
+		name, namespace, src string
+		want                 string
+	}{
+		{"td", "", "a<b>c</b><td>x", "a|<b>c</b>|x|"},
+		{"TD", "", "<table><tr><td>x", "<table><tbody><tr><td>x</td></tr></tbody></table>|"},
+		{"tr", "", "<td>a<th>b", "<td>a</td>|<th>b</th>|"},
+		{"table", "", "<tr><td>x", "<tbody><tr><td>x</td></tr></tbody>|"},
+		{"select", "", "<option>a<option>b<div>x</div><p>y", "<option>a</option>|<option>bxy</option>|"},
+		{"template", "", "<tr><td>a</td></tr><td>b", "<tr><td>a</td></tr>|<tr><td>b</td></tr>|"},
+		{"body", "", "<td>a", "a|"},
+		{"my-widget", "", "<p>a<slot></slot>", "<p>a<slot></slot></p>|"},
+		{"foreignObject", "svg", "<p>x", "<p>x</p>|"},
+	}
+	for _, tt := range tests {
+		nodes, err := ParseFragmentInContext(strings.NewReader(tt.src), tt.name, tt.namespace)
+		if err != nil {
+			t.Errorf("ParseFragmentInContext(%q, %q, %q) = %v", tt.src, tt.name, tt.namespace, err)
+			continue
+		}
+		var b strings.Builder
+		for _, n := range nodes {
+			if err := Render(&b, n); err != nil {
+				t.Fatal(err)
+			}
+			b.WriteString("|")
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("ParseFragmentInContext(%q, %q, %q) = %q, want %q", tt.src, tt.name, tt.namespace, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ name, namespace string }{
+		{"", ""},
+		{"div", "xhtml"},
+	} {
+		if _, err := ParseFragmentInContext(strings.NewReader("x"), tt.name, tt.namespace); err == nil {
+			t.Errorf("ParseFragmentInContext(%q, %q) succeeded, want error", tt.name, tt.namespace)
+		}
+	}
+}
+
+func TestParseAttrOrder(t *testing.T) {
+	const src = `<a z="1" href="/x?a=1&amp;b=2" title='a &lt; b' c=&quot;q&quot; data-n>x</a>`
+	want := []Attribute{
+		{Key: "z", Val: "1"},
+		{Key: "href", Val: "/x?a=1&b=2"},
+		{Key: "title", Val: "a < b"},
+		{Key: "c", Val: `"q"`},
+		{Key: "data-n", Val: ""},
+	}
+	nodes, err := ParseFragment(strings.NewReader(src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := nodes[0].FirstChild.NextSibling.FirstChild
+	if !reflect.DeepEqual(a.Attr, want) {
+		t.Errorf("Attr = %q\nwant %q", a.Attr, want)
+	}
+}
+
+func TestParseKeepRawAttrVals(t *testing.T) {
+	const src = `<a z="1" href="/x?a=1&amp;b=2" title='a &lt; b' c=&quot;q&quot; data-n>x</a>`
+	want := []Attribute{
+		{Key: "z", Val: "1", RawVal: "1"},
+		{Key: "href", Val: "/x?a=1&b=2", RawVal: "/x?a=1&amp;b=2"},
+		{Key: "title", Val: "a < b", RawVal: "a &lt; b"},
+		{Key: "c", Val: `"q"`, RawVal: "&quot;q&quot;"},
+		{Key: "data-n", Val: "", RawVal: ""},
+	}
+	nodes, err := ParseFragmentWithOptions(strings.NewReader(src), nil, ParseOptionKeepRawAttrVals(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := nodes[0].FirstChild.NextSibling.FirstChild
+	if !reflect.DeepEqual(a.Attr, want) {
+		t.Errorf("Attr = %q\nwant %q", a.Attr, want)
+	}
+}
+
+func TestParseExtraEntities(t *testing.T) {
+	const src = `<p title="&company;" data-x="&company=1">&company; &lt;3 &unknown;</p>`
+	extra := map[string]string{"company": "Example Corp."}
+	nodes, err := ParseFragmentWithOptions(strings.NewReader(src), nil, ParseOptionExtraEntities(extra))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := nodes[0].FirstChild.NextSibling.FirstChild
+	wantAttr := []Attribute{
+		{Key: "title", Val: "Example Corp."},
+		{Key: "data-x", Val: "&company=1"},
+	}
+	if !reflect.DeepEqual(p.Attr, wantAttr) {
+		t.Errorf("Attr = %q\nwant %q", p.Attr, wantAttr)
+	}
+	if got, want := p.FirstChild.Data, "Example Corp. <3 &unknown;"; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+
+	// Without the option, the references are left alone.
+	nodes, err = ParseFragment(strings.NewReader(src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = nodes[0].FirstChild.NextSibling.FirstChild
+	if got, want := p.FirstChild.Data, "&company; <3 &unknown;"; got != want {
+		t.Errorf("text without option = %q, want %q", got, want)
+	}
+}
+
 func BenchmarkParser(b *testing.B) {
 	buf, err := ioutil.ReadFile("testdata/go1.html")
 	if err != nil {
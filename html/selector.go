@@ -0,0 +1,369 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Selector matches element nodes against a subset of CSS selector
+// syntax. The supported syntax is:
+//
+//	E         an element of type E (case-insensitive), or * for any
+//	E#id      an element whose id attribute is "id"
+//	E.cls     an element whose class attribute contains the word "cls"
+//	E[a]      an element with an a attribute
+//	E[a="v"]  an element whose a attribute is exactly "v"
+//	E[a~="v"] an element whose a attribute contains the word "v"
+//	E[a|="v"] an element whose a attribute is "v" or begins with "v-"
+//	E[a^="v"] an element whose a attribute begins with "v"
+//	E[a$="v"] an element whose a attribute ends with "v"
+//	E[a*="v"] an element whose a attribute contains "v"
+//	E F       an F element descendant of an E element
+//	E > F     an F element child of an E element
+//
+// Attribute names are matched case-insensitively, following HTML, and
+// only match attributes without a namespace. Attribute values are
+// matched case-sensitively and may be quoted with single or double
+// quotes, or left unquoted if they are identifiers. Selectors such as
+// [role="button"] and [data-id] make it possible to find elements by
+// ARIA role or data attributes.
+//
+// Pseudo-classes, sibling combinators and selector lists are not
+// supported.
+type Selector struct {
+	// compounds holds the compound selectors from right to left, so
+	// that compounds[0] matches the subject element.
+	compounds []compoundSelector
+}
+
+type compoundSelector struct {
+	typ     string // lower-case element type, or "" for any
+	matches []attrSelector
+	// child reports whether the compound is joined to the next one
+	// (to its left in the source) by a child combinator rather than
+	// a descendant combinator.
+	child bool
+}
+
+type attrSelector struct {
+	key string // lower-case attribute name
+	op  byte   // 0 for presence, '=' for equality, or one of "~|^$*"
+	val string
+}
+
+// ParseSelector parses s, which must use the syntax described by
+// Selector.
+func ParseSelector(s string) (*Selector, error) {
+	p := selectorParser{s: s}
+	sel, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("html: invalid selector %q: %v", s, err)
+	}
+	return sel, nil
+}
+
+// MustParseSelector is like ParseSelector but panics if s cannot be
+// parsed.
+func MustParseSelector(s string) *Selector {
+	sel, err := ParseSelector(s)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+// Match reports whether n is an element matching s.
+func (s *Selector) Match(n *Node) bool {
+	return s.matchFrom(n, 0)
+}
+
+// MatchAll returns the descendants of n that match s, in document
+// order. n itself is not considered.
+func (s *Selector) MatchAll(n *Node) []*Node {
+	var found []*Node
+	var walk func(*Node)
+	walk = func(n *Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if s.Match(c) {
+				found = append(found, c)
+			}
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// MatchFirst returns the first descendant of n, in document order,
+// that matches s, or nil if there is none.
+func (s *Selector) MatchFirst(n *Node) *Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if s.Match(c) {
+			return c
+		}
+		if m := s.MatchFirst(c); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// matchFrom reports whether n matches s.compounds[i] and the
+// compounds to its left match n's ancestors.
+func (s *Selector) matchFrom(n *Node, i int) bool {
+	c := &s.compounds[i]
+	if !c.match(n) {
+		return false
+	}
+	if i+1 == len(s.compounds) {
+		return true
+	}
+	for p := n.Parent; p != nil; p = p.Parent {
+		if s.matchFrom(p, i+1) {
+			return true
+		}
+		if c.child {
+			break
+		}
+	}
+	return false
+}
+
+func (c *compoundSelector) match(n *Node) bool {
+	if n.Type != ElementNode {
+		return false
+	}
+	if c.typ != "" && !strings.EqualFold(n.Data, c.typ) {
+		return false
+	}
+	for i := range c.matches {
+		if !c.matches[i].match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *attrSelector) match(n *Node) bool {
+	for _, attr := range n.Attr {
+		if attr.Namespace != "" || !strings.EqualFold(attr.Key, a.key) {
+			continue
+		}
+		v := attr.Val
+		switch a.op {
+		case 0:
+			return true
+		case '=':
+			return v == a.val
+		case '~':
+			for _, w := range strings.FieldsFunc(v, isSelectorWhitespace) {
+				if w == a.val {
+					return true
+				}
+			}
+			return false
+		case '|':
+			return v == a.val || strings.HasPrefix(v, a.val+"-")
+		case '^':
+			return a.val != "" && strings.HasPrefix(v, a.val)
+		case '$':
+			return a.val != "" && strings.HasSuffix(v, a.val)
+		case '*':
+			return a.val != "" && strings.Contains(v, a.val)
+		}
+		return false
+	}
+	return false
+}
+
+func isSelectorWhitespace(r rune) bool {
+	return r < 0x80 && strings.IndexByte(whitespace, byte(r)) >= 0
+}
+
+type selectorParser struct {
+	s   string
+	pos int
+}
+
+func (p *selectorParser) parse() (*Selector, error) {
+	var compounds []compoundSelector
+	p.skipWhitespace()
+	for {
+		c, err := p.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+		compounds = append(compounds, c)
+		sawSpace := p.skipWhitespace()
+		if p.pos == len(p.s) {
+			break
+		}
+		child := false
+		if p.s[p.pos] == '>' {
+			child = true
+			p.pos++
+			p.skipWhitespace()
+		} else if !sawSpace {
+			return nil, fmt.Errorf("unexpected %q at offset %d", p.s[p.pos], p.pos)
+		}
+		compounds[len(compounds)-1].child = child
+	}
+	// Reverse, so that matching starts with the subject, and move
+	// each combinator to the compound on its right.
+	sel := &Selector{compounds: make([]compoundSelector, len(compounds))}
+	for i, c := range compounds {
+		j := len(compounds) - 1 - i
+		sel.compounds[j] = c
+		sel.compounds[j].child = false
+		if i > 0 {
+			sel.compounds[j].child = compounds[i-1].child
+		}
+	}
+	return sel, nil
+}
+
+func (p *selectorParser) parseCompound() (compoundSelector, error) {
+	var c compoundSelector
+	start := p.pos
+	if p.pos < len(p.s) && p.s[p.pos] == '*' {
+		p.pos++
+	} else if name := p.parseIdent(); name != "" {
+		c.typ = strings.ToLower(name)
+	}
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case '#':
+			p.pos++
+			id := p.parseIdent()
+			if id == "" {
+				return c, fmt.Errorf("missing id at offset %d", p.pos)
+			}
+			c.matches = append(c.matches, attrSelector{key: "id", op: '=', val: id})
+		case '.':
+			p.pos++
+			class := p.parseIdent()
+			if class == "" {
+				return c, fmt.Errorf("missing class at offset %d", p.pos)
+			}
+			c.matches = append(c.matches, attrSelector{key: "class", op: '~', val: class})
+		case '[':
+			p.pos++
+			a, err := p.parseAttr()
+			if err != nil {
+				return c, err
+			}
+			c.matches = append(c.matches, a)
+		default:
+			if p.pos == start {
+				return c, fmt.Errorf("unexpected %q at offset %d", p.s[p.pos], p.pos)
+			}
+			return c, nil
+		}
+	}
+	if p.pos == start {
+		return c, fmt.Errorf("missing selector at offset %d", p.pos)
+	}
+	return c, nil
+}
+
+// parseAttr parses an attribute selector, after its opening bracket.
+func (p *selectorParser) parseAttr() (attrSelector, error) {
+	var a attrSelector
+	p.skipWhitespace()
+	key := p.parseIdent()
+	if key == "" {
+		return a, fmt.Errorf("missing attribute name at offset %d", p.pos)
+	}
+	a.key = strings.ToLower(key)
+	p.skipWhitespace()
+	if p.pos == len(p.s) {
+		return a, fmt.Errorf("unterminated attribute selector")
+	}
+	switch c := p.s[p.pos]; c {
+	case ']':
+		p.pos++
+		return a, nil
+	case '=':
+		a.op = '='
+		p.pos++
+	case '~', '|', '^', '$', '*':
+		if p.pos+1 == len(p.s) || p.s[p.pos+1] != '=' {
+			return a, fmt.Errorf("expected '=' at offset %d", p.pos+1)
+		}
+		a.op = c
+		p.pos += 2
+	default:
+		return a, fmt.Errorf("unexpected %q at offset %d", c, p.pos)
+	}
+	p.skipWhitespace()
+	if p.pos < len(p.s) && (p.s[p.pos] == '"' || p.s[p.pos] == '\'') {
+		val, err := p.parseString()
+		if err != nil {
+			return a, err
+		}
+		a.val = val
+	} else if a.val = p.parseIdent(); a.val == "" {
+		return a, fmt.Errorf("missing attribute value at offset %d", p.pos)
+	}
+	p.skipWhitespace()
+	if p.pos == len(p.s) || p.s[p.pos] != ']' {
+		return a, fmt.Errorf("expected ']' at offset %d", p.pos)
+	}
+	p.pos++
+	return a, nil
+}
+
+// parseIdent parses a CSS identifier, without escapes, returning ""
+// if there is none.
+func (p *selectorParser) parseIdent() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c >= 0x80 ||
+			p.pos > start && ('0' <= c && c <= '9' || c == '-') ||
+			p.pos == start && c == '-' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.s[start:p.pos]
+}
+
+// parseString parses a quoted string, in which a backslash escapes
+// the following character.
+func (p *selectorParser) parseString() (string, error) {
+	quote := p.s[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch c {
+		case quote:
+			return b.String(), nil
+		case '\\':
+			if p.pos == len(p.s) {
+				return "", fmt.Errorf("unterminated string")
+			}
+			b.WriteByte(p.s[p.pos])
+			p.pos++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+// skipWhitespace skips whitespace, reporting whether there was any.
+func (p *selectorParser) skipWhitespace() bool {
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(whitespace, p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
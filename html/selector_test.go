@@ -0,0 +1,127 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"strings"
+	"testing"
+)
+
+const selectorTestHTML = `<body>
+<div id="main" class="page wide">
+  <button id="b1" class="btn btn-primary" data-id="7">One</button>
+  <div role="button" data-Track="x" lang="en-US" id="b2">Two</div>
+  <a id="b3" class="link" href="https://example.com/a.pdf">Three</a>
+  <ul><li id="l1"><span id="s1" class="BTN">Four</span></li></ul>
+</div>
+<p id="p1" role="Button" lang="en">Five</p>
+<svg><a id="svga" xlink:href="#x"></a></svg>
+</body>`
+
+func TestSelector(t *testing.T) {
+	doc, err := Parse(strings.NewReader(selectorTestHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		sel  string
+		want string // space-separated ids, in document order
+	}{
+		// Type, id and class selectors.
+		{`button`, "b1"},
+		{`BUTTON`, "b1"},
+		{`#b3`, "b3"},
+		{`.btn`, "b1"},
+		{`.btn.btn-primary`, "b1"},
+		{`div.page`, "main"},
+		{`*.link`, "b3"},
+
+		// Attribute presence; names are case-insensitive.
+		{`[data-id]`, "b1"},
+		{`[data-track]`, "b2"},
+		{`[DATA-ID]`, "b1"},
+		{`[role]`, "b2 p1"},
+		{`div[role]`, "b2"},
+
+		// Exact values are case-sensitive.
+		{`[role="button"]`, "b2"},
+		{`[role='Button']`, "p1"},
+		{`[role=button]`, "b2"},
+		{`[ role = "button" ]`, "b2"},
+		{`[data-id="7"]`, "b1"},
+
+		// Substring matchers.
+		{`[class*="btn"]`, "b1"},
+		{`[class^="btn "]`, "b1"},
+		{`[href$=".pdf"]`, "b3"},
+		{`[href^="https:"]`, "b3"},
+		{`[class~="wide"]`, "main"},
+		{`[class~="wid"]`, ""},
+		{`[lang|="en"]`, "b2 p1"},
+		{`[class*=""]`, ""},
+		{`[href*="\"x"]`, ""},
+
+		// Namespaced attributes do not match.
+		{`[href]`, "b3"},
+
+		// Combinators.
+		{`#main [role="button"]`, "b2"},
+		{`div > [data-id]`, "b1"},
+		{`div>span`, ""},
+		{`div span`, "s1"},
+		{`body > div > ul > li > span`, "s1"},
+		{`ul  li   span.BTN`, "s1"},
+		{`body [role]`, "b2 p1"},
+		{`body > [role]`, "p1"},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.sel)
+		if err != nil {
+			t.Errorf("ParseSelector(%q): %v", tt.sel, err)
+			continue
+		}
+		var ids []string
+		for _, n := range sel.MatchAll(doc) {
+			for _, a := range n.Attr {
+				if a.Key == "id" {
+					ids = append(ids, a.Val)
+				}
+			}
+		}
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("%s: matched %q, want %q", tt.sel, got, tt.want)
+		}
+		first := sel.MatchFirst(doc)
+		if (first == nil) != (tt.want == "") {
+			t.Errorf("%s: MatchFirst = %v, want match %v", tt.sel, first, tt.want != "")
+		}
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	for _, s := range []string{
+		``,
+		` `,
+		`div >`,
+		`> div`,
+		`#`,
+		`.`,
+		`[`,
+		`[]`,
+		`[a`,
+		`[a=]`,
+		`[a="b"`,
+		`[a="b]`,
+		`[a!="b"]`,
+		`[a~"b"]`,
+		`div:hover`,
+		`a, b`,
+		`a + b`,
+	} {
+		if _, err := ParseSelector(s); err == nil {
+			t.Errorf("ParseSelector(%q) succeeded, want error", s)
+		}
+	}
+}
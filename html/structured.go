@@ -0,0 +1,252 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"strings"
+
+	"golang.org/x/net/html/atom"
+)
+
+// JSONLD returns the contents of the JSON-LD script elements, those of
+// the form <script type="application/ld+json">, in the subtree rooted at
+// n, in document order. Each block is returned as raw JSON text with
+// surrounding whitespace removed; it is not checked to be valid JSON.
+// Empty blocks are skipped.
+func JSONLD(n *Node) []string {
+	var blocks []string
+	var walk func(*Node)
+	walk = func(n *Node) {
+		if n.Type == ElementNode && n.DataAtom == atom.Script && n.Namespace == "" {
+			if isJSONLDType(attrVal(n, "type")) {
+				if s := strings.Trim(textContent(n), whitespace); s != "" {
+					blocks = append(blocks, s)
+				}
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return blocks
+}
+
+// isJSONLDType reports whether the MIME type typ, which may have
+// parameters, is that of JSON-LD.
+func isJSONLDType(typ string) bool {
+	if i := strings.IndexByte(typ, ';'); i >= 0 {
+		typ = typ[:i]
+	}
+	return strings.EqualFold(strings.Trim(typ, whitespace), "application/ld+json")
+}
+
+// A MicrodataItem is an item described with the microdata attributes
+// itemscope, itemtype, itemid, itemprop and itemref.
+// https://html.spec.whatwg.org/multipage/microdata.html
+type MicrodataItem struct {
+	// Type holds the item types listed by the itemtype attribute.
+	Type []string
+	// ID is the global identifier given by the itemid attribute, if
+	// any.
+	ID string
+	// Properties maps the name of each property of the item to its
+	// values, in document order. An element whose itemprop attribute
+	// lists several names adds its value to each of them.
+	Properties map[string][]MicrodataValue
+}
+
+// A MicrodataValue is the value of a microdata property. If the
+// property is itself an item, Item is set; otherwise Text holds the
+// value.
+type MicrodataValue struct {
+	Text string
+	Item *MicrodataItem
+}
+
+// Microdata returns the top-level microdata items in the subtree rooted
+// at n, in document order. Top-level items are the elements with an
+// itemscope attribute and no itemprop attribute.
+//
+// Property values follow the HTML specification: the content attribute
+// of meta elements, the src, href or data attribute of the elements
+// that embed or link to resources, the value attribute of data and
+// meter elements, the datetime attribute of time elements that have
+// one, and the text content of other elements. URLs are returned as
+// written, without being resolved. Elements listed by an item's itemref
+// attribute are looked up by id among the ancestors and descendants of
+// n. A property whose value would be an item containing itself is
+// skipped.
+func Microdata(n *Node) []*MicrodataItem {
+	root := n
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	p := microdataParser{
+		ids:      make(map[string]*Node),
+		crawling: make(map[*Node]bool),
+	}
+	p.indexIDs(root)
+
+	var items []*MicrodataItem
+	var walk func(*Node)
+	walk = func(n *Node) {
+		if isMicrodataElement(n) && hasAttr(n, "itemscope") && !hasAttr(n, "itemprop") {
+			items = append(items, p.item(n))
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return items
+}
+
+type microdataParser struct {
+	ids      map[string]*Node // first element with each id
+	crawling map[*Node]bool   // items whose properties are being collected
+}
+
+func (p *microdataParser) indexIDs(n *Node) {
+	if n.Type == ElementNode {
+		if id := attrVal(n, "id"); id != "" {
+			if _, ok := p.ids[id]; !ok {
+				p.ids[id] = n
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.indexIDs(c)
+	}
+}
+
+// item returns the item whose itemscope attribute is on n.
+func (p *microdataParser) item(n *Node) *MicrodataItem {
+	it := &MicrodataItem{
+		ID:         attrVal(n, "itemid"),
+		Properties: make(map[string][]MicrodataValue),
+	}
+	if types := strings.FieldsFunc(attrVal(n, "itemtype"), isSelectorWhitespace); len(types) > 0 {
+		it.Type = types
+	}
+	p.crawling[n] = true
+	defer delete(p.crawling, n)
+
+	// Crawl the children of n and the elements it references, stopping
+	// at nested items, whose properties are their own.
+	seen := map[*Node]bool{n: true}
+	var crawl func(*Node)
+	crawl = func(e *Node) {
+		if seen[e] {
+			return
+		}
+		seen[e] = true
+		if !isMicrodataElement(e) {
+			return
+		}
+		if names, ok := attr(e, "itemprop"); ok {
+			if v, ok := p.value(e); ok {
+				for _, name := range strings.FieldsFunc(names, isSelectorWhitespace) {
+					it.Properties[name] = append(it.Properties[name], v)
+				}
+			}
+		}
+		if hasAttr(e, "itemscope") {
+			return
+		}
+		for c := e.FirstChild; c != nil; c = c.NextSibling {
+			crawl(c)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		crawl(c)
+	}
+	for _, id := range strings.FieldsFunc(attrVal(n, "itemref"), isSelectorWhitespace) {
+		if e := p.ids[id]; e != nil {
+			crawl(e)
+		}
+	}
+	return it
+}
+
+// value returns the value of the property whose itemprop attribute is
+// on n. It reports false if the value is an item that is already being
+// crawled, which would make the item contain itself.
+func (p *microdataParser) value(n *Node) (MicrodataValue, bool) {
+	if hasAttr(n, "itemscope") {
+		if p.crawling[n] {
+			return MicrodataValue{}, false
+		}
+		return MicrodataValue{Item: p.item(n)}, true
+	}
+	var text string
+	switch n.DataAtom {
+	case atom.Meta:
+		text = attrVal(n, "content")
+	case atom.Audio, atom.Embed, atom.Iframe, atom.Img, atom.Source, atom.Track, atom.Video:
+		text = attrVal(n, "src")
+	case atom.A, atom.Area, atom.Link:
+		text = attrVal(n, "href")
+	case atom.Object:
+		text = attrVal(n, "data")
+	case atom.Data, atom.Meter:
+		text = attrVal(n, "value")
+	case atom.Time:
+		if dt, ok := attr(n, "datetime"); ok {
+			text = dt
+		} else {
+			text = textContent(n)
+		}
+	default:
+		text = textContent(n)
+	}
+	return MicrodataValue{Text: text}, true
+}
+
+func isMicrodataElement(n *Node) bool {
+	return n.Type == ElementNode && n.Namespace == ""
+}
+
+// attr returns the value of n's attribute named key, which must be
+// lower case, and whether it is present.
+func attr(n *Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func attrVal(n *Node, key string) string {
+	v, _ := attr(n, key)
+	return v
+}
+
+func hasAttr(n *Node, key string) bool {
+	_, ok := attr(n, key)
+	return ok
+}
+
+// textContent returns the concatenated text of the text nodes in the
+// subtree rooted at n, as the DOM textContent attribute does.
+func textContent(n *Node) string {
+	if n.Type == TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	var walk func(*Node)
+	walk = func(n *Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == TextNode {
+				b.WriteString(c.Data)
+			}
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
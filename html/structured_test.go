@@ -0,0 +1,142 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const structuredDataPage = `<!DOCTYPE html>
+<html><head>
+<script type="application/ld+json">
+  {"@context": "https://schema.org", "@type": "Organization", "name": "Acme"}
+</script>
+<script type="text/javascript">var x = 1;</script>
+<script type="Application/LD+JSON; charset=utf-8">{"@type": "WebSite"}</script>
+<script type="application/ld+json">   </script>
+</head><body>
+<div itemscope itemtype="https://schema.org/Product" itemid="urn:sku:42" itemref="extra">
+  <h1 itemprop="name">Running <b>shoes</b></h1>
+  <img itemprop="image" src="/shoes.jpg" alt="">
+  <a itemprop="url sameAs" href="/p/42">link</a>
+  <div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+    <meta itemprop="priceCurrency" content="EUR">
+    <data itemprop="price" value="59.90">59,90 €</data>
+    <time itemprop="validFrom" datetime="2023-01-01">New Year</time>
+  </div>
+  <p itemprop="name">Runners</p>
+</div>
+<section itemscope><span itemprop="title">Untyped</span><time itemprop="when">today</time></section>
+<p id="extra" itemprop="color">red</p>
+</body></html>`
+
+func TestJSONLD(t *testing.T) {
+	doc, err := Parse(strings.NewReader(structuredDataPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`{"@context": "https://schema.org", "@type": "Organization", "name": "Acme"}`,
+		`{"@type": "WebSite"}`,
+	}
+	if got := JSONLD(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("JSONLD = %q, want %q", got, want)
+	}
+}
+
+func TestMicrodata(t *testing.T) {
+	doc, err := Parse(strings.NewReader(structuredDataPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := func(s string) MicrodataValue { return MicrodataValue{Text: s} }
+	want := []*MicrodataItem{
+		{
+			Type: []string{"https://schema.org/Product"},
+			ID:   "urn:sku:42",
+			Properties: map[string][]MicrodataValue{
+				"name":   {text("Running shoes"), text("Runners")},
+				"image":  {text("/shoes.jpg")},
+				"url":    {text("/p/42")},
+				"sameAs": {text("/p/42")},
+				"offers": {{Item: &MicrodataItem{
+					Type: []string{"https://schema.org/Offer"},
+					Properties: map[string][]MicrodataValue{
+						"priceCurrency": {text("EUR")},
+						"price":         {text("59.90")},
+						"validFrom":     {text("2023-01-01")},
+					},
+				}}},
+				"color": {text("red")},
+			},
+		},
+		{
+			Properties: map[string][]MicrodataValue{
+				"title": {text("Untyped")},
+				"when":  {text("today")},
+			},
+		},
+	}
+	got := Microdata(doc)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Microdata:\n got %s\nwant %s", dumpMicrodata(got), dumpMicrodata(want))
+	}
+}
+
+func TestMicrodataCycle(t *testing.T) {
+	// The nested item references an ancestor of itself, so that it
+	// would contain the outer item, which contains it.
+	doc, err := Parse(strings.NewReader(`<div id=outer itemscope><div itemprop=inner itemscope itemref=outer><span itemprop=x>1</span></div></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := Microdata(doc)
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	inner := items[0].Properties["inner"]
+	if len(inner) != 1 || inner[0].Item == nil {
+		t.Fatalf("inner = %v, want one item", inner)
+	}
+	if got := inner[0].Item.Properties["x"]; len(got) != 1 || got[0].Text != "1" {
+		t.Errorf("inner x = %v, want [1]", got)
+	}
+	if got := inner[0].Item.Properties["inner"]; len(got) != 0 {
+		t.Errorf("inner item contains itself: %v", got)
+	}
+}
+
+func dumpMicrodata(items []*MicrodataItem) string {
+	var b strings.Builder
+	var dump func(*MicrodataItem)
+	dump = func(it *MicrodataItem) {
+		b.WriteString("{")
+		b.WriteString(strings.Join(it.Type, " "))
+		if it.ID != "" {
+			b.WriteString(" #" + it.ID)
+		}
+		for name, vals := range it.Properties {
+			b.WriteString(" " + name + "=[")
+			for i, v := range vals {
+				if i > 0 {
+					b.WriteString(",")
+				}
+				if v.Item != nil {
+					dump(v.Item)
+				} else {
+					b.WriteString(`"` + v.Text + `"`)
+				}
+			}
+			b.WriteString("]")
+		}
+		b.WriteString("}")
+	}
+	for _, it := range items {
+		dump(it)
+	}
+	return b.String()
+}
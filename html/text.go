@@ -0,0 +1,158 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"strings"
+
+	"golang.org/x/net/html/atom"
+)
+
+// isBlockTextElement lists the HTML elements that JoinText treats as block
+// boundaries. It follows the elements whose default CSS display is block
+// (or a table or list layout) in the rendering section of the HTML
+// specification.
+// https://html.spec.whatwg.org/multipage/rendering.html#the-css-user-agent-style-sheet-and-presentational-hints
+var isBlockTextElement = map[atom.Atom]bool{
+	atom.Address:    true,
+	atom.Article:    true,
+	atom.Aside:      true,
+	atom.Blockquote: true,
+	atom.Body:       true,
+	atom.Br:         true,
+	atom.Caption:    true,
+	atom.Center:     true,
+	atom.Dd:         true,
+	atom.Details:    true,
+	atom.Dialog:     true,
+	atom.Dir:        true,
+	atom.Div:        true,
+	atom.Dl:         true,
+	atom.Dt:         true,
+	atom.Fieldset:   true,
+	atom.Figcaption: true,
+	atom.Figure:     true,
+	atom.Footer:     true,
+	atom.Form:       true,
+	atom.H1:         true,
+	atom.H2:         true,
+	atom.H3:         true,
+	atom.H4:         true,
+	atom.H5:         true,
+	atom.H6:         true,
+	atom.Header:     true,
+	atom.Hgroup:     true,
+	atom.Hr:         true,
+	atom.Legend:     true,
+	atom.Li:         true,
+	atom.Listing:    true,
+	atom.Main:       true,
+	atom.Menu:       true,
+	atom.Nav:        true,
+	atom.Ol:         true,
+	atom.Optgroup:   true,
+	atom.Option:     true,
+	atom.P:          true,
+	atom.Plaintext:  true,
+	atom.Pre:        true,
+	atom.Section:    true,
+	atom.Summary:    true,
+	atom.Table:      true,
+	atom.Tbody:      true,
+	atom.Td:         true,
+	atom.Tfoot:      true,
+	atom.Th:         true,
+	atom.Thead:      true,
+	atom.Tr:         true,
+	atom.Ul:         true,
+	atom.Xmp:        true,
+}
+
+// isHiddenTextElement lists the HTML elements whose content is never
+// rendered as text.
+var isHiddenTextElement = map[atom.Atom]bool{
+	atom.Head:     true,
+	atom.Noscript: true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Template: true,
+	atom.Title:    true,
+}
+
+// JoinText returns the text content of the subtree rooted at n.
+//
+// Runs of whitespace within and between text nodes are collapsed to a
+// single space, and leading and trailing whitespace is removed. Where
+// text is separated by the start or end of a block-level element, such
+// as div, p, li or br, blockSep is inserted instead of a space. At most
+// one blockSep separates two pieces of text, no matter how many block
+// boundaries lie between them, and none is added at the start or end.
+//
+// Comments and the contents of elements such as script, style and
+// template are ignored.
+func JoinText(n *Node, blockSep string) string {
+	j := textJoiner{sep: blockSep}
+	j.walk(n)
+	return j.b.String()
+}
+
+type textJoiner struct {
+	b     strings.Builder
+	sep   string
+	block bool // a block boundary was seen since the last word
+	space bool // whitespace was seen since the last word
+}
+
+func (j *textJoiner) walk(n *Node) {
+	switch n.Type {
+	case TextNode:
+		j.text(n.Data)
+		return
+	case ElementNode:
+		if n.Namespace == "" {
+			if isHiddenTextElement[n.DataAtom] {
+				return
+			}
+			if isBlockTextElement[n.DataAtom] {
+				j.block = true
+				defer func() { j.block = true }()
+			}
+		}
+	case DocumentNode:
+	default:
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		j.walk(c)
+	}
+}
+
+func (j *textJoiner) text(s string) {
+	for len(s) > 0 {
+		if i := strings.IndexAny(s, whitespace); i != 0 {
+			if i < 0 {
+				i = len(s)
+			}
+			j.word(s[:i])
+			s = s[i:]
+			continue
+		}
+		j.space = true
+		s = strings.TrimLeft(s, whitespace)
+	}
+}
+
+func (j *textJoiner) word(w string) {
+	if j.b.Len() > 0 {
+		if j.block {
+			j.b.WriteString(j.sep)
+		} else if j.space {
+			j.b.WriteByte(' ')
+		}
+	}
+	j.b.WriteString(w)
+	j.block = false
+	j.space = false
+}
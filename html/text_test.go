@@ -0,0 +1,65 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJoinText(t *testing.T) {
+	tests := []struct {
+		in, sep, want string
+	}{
+		{
+			in:   `<nav><ul><li><a href="/">Home</a></li><li><a href="/shoes">Shoes</a></li><li>Red  <b>running</b>  shoes</li></ul></nav>`,
+			sep:  " | ",
+			want: "Home | Shoes | Red running shoes",
+		},
+		{
+			// Nested and empty blocks produce a single separator.
+			in:   `<div>a<div><div></div><p>b</p></div></div><div></div>c`,
+			sep:  "/",
+			want: "a/b/c",
+		},
+		{
+			// Inline elements do not introduce separators or spaces.
+			in:   `<p>foo<span>bar</span> <em>baz</em>` + "\n\t" + `qux</p>`,
+			sep:  "|",
+			want: "foobar baz qux",
+		},
+		{
+			in:   `<p>line one<br>line two</p>`,
+			sep:  "\n",
+			want: "line one\nline two",
+		},
+		{
+			in:   `<title>t</title><p>  visible <script>hidden()</script><!-- c -->text  </p><style>p{}</style>`,
+			sep:  "|",
+			want: "visible text",
+		},
+	}
+	for _, tt := range tests {
+		doc, err := Parse(strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.in, err)
+		}
+		if got := JoinText(doc, tt.sep); got != tt.want {
+			t.Errorf("JoinText(%q, %q) = %q, want %q", tt.in, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestJoinTextSubtree(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<div>outside</div><div id=x><p>one</p><p>two</p></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// html > body > second div.
+	n := doc.FirstChild.LastChild.LastChild
+	if got, want := JoinText(n, ", "), "one, two"; got != want {
+		t.Errorf("JoinText = %q, want %q", got, want)
+	}
+}
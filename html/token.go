@@ -64,8 +64,14 @@ func (t TokenType) String() string {
 // unescaped (it looks like "a<b" rather than "a&lt;b").
 //
 // Namespace is only used by the parser, not the tokenizer.
+//
+// RawVal is the value as it appeared in the source, without its quotes
+// but before character references are unescaped, so that "a&lt;b" stays
+// "a&lt;b". It is only set by a parser configured with
+// ParseOptionKeepRawAttrVals, and is ignored when rendering.
 type Attribute struct {
 	Namespace, Key, Val string
+	RawVal              string
 }
 
 // A Token consists of a TokenType and some Data (tag name for start and end
@@ -169,6 +175,12 @@ type Tokenizer struct {
 	convertNUL bool
 	// allowCDATA is whether CDATA sections are allowed in the current context.
 	allowCDATA bool
+	// extraEntities holds the non-standard entities set by
+	// SetExtraEntities.
+	extraEntities map[string]string
+	// keepRawAttrVals is whether Token sets the RawVal of each Attribute.
+	// See ParseOptionKeepRawAttrVals.
+	keepRawAttrVals bool
 }
 
 // AllowCDATA sets whether or not the tokenizer recognizes <![CDATA[foo]]> as
@@ -189,6 +201,21 @@ func (z *Tokenizer) AllowCDATA(allowCDATA bool) {
 	z.allowCDATA = allowCDATA
 }
 
+// SetExtraEntities sets additional named character references that
+// Text, TagAttr and Token unescape, as for UnescapeStringWithEntities.
+// The HTML5 entities take precedence over those in extra. This
+// diverges from the HTML5 specification, and is intended for legacy
+// documents that use non-standard entities. The default is none.
+func (z *Tokenizer) SetExtraEntities(extra map[string]string) {
+	z.extraEntities = extra
+}
+
+// unescape unescapes b as the package-level unescape does, also
+// decoding the entities set by SetExtraEntities.
+func (z *Tokenizer) unescape(b []byte, attribute bool) []byte {
+	return unescapeExtra(b, attribute, z.extraEntities)
+}
+
 // NextIsNotRawText instructs the tokenizer that the next token should not be
 // considered as 'raw text'. Some elements, such as script and title elements,
 // normally require the next token after the opening tag to be 'raw text' that
@@ -1163,7 +1190,7 @@ func (z *Tokenizer) Text() []byte {
 			s = bytes.Replace(s, nul, replacement, -1)
 		}
 		if !z.textIsRaw {
-			s = unescape(s, false)
+			s = z.unescape(s, false)
 		}
 		return s
 	}
@@ -1197,12 +1224,35 @@ func (z *Tokenizer) TagAttr() (key, val []byte, moreAttr bool) {
 			z.nAttrReturned++
 			key = z.buf[x[0].start:x[0].end]
 			val = z.buf[x[1].start:x[1].end]
-			return lower(key), unescape(convertNewlines(val), true), z.nAttrReturned < len(z.attr)
+			return lower(key), z.unescape(convertNewlines(val), true), z.nAttrReturned < len(z.attr)
 		}
 	}
 	return nil, nil, false
 }
 
+// RawTagAttr is like TagAttr, but also returns the value of the attribute
+// as it appears in the source, without its quotes: in rawVal, character
+// references are not unescaped and newlines are not normalized, so that
+// `title="a&lt;b"` has the value "a<b" and the raw value "a&lt;b". Each
+// attribute is returned by either TagAttr or RawTagAttr, in source order.
+// The contents of the returned slices may change on the next call to Next.
+func (z *Tokenizer) RawTagAttr() (key, val, rawVal []byte, moreAttr bool) {
+	if z.nAttrReturned < len(z.attr) {
+		switch z.tt {
+		case StartTagToken, SelfClosingTagToken:
+			x := z.attr[z.nAttrReturned]
+			z.nAttrReturned++
+			key = z.buf[x[0].start:x[0].end]
+			rawVal = z.buf[x[1].start:x[1].end]
+			// Unescape a copy, since unescaping works in place.
+			val = append([]byte(nil), rawVal...)
+			val = z.unescape(convertNewlines(val), true)
+			return lower(key), val, rawVal, z.nAttrReturned < len(z.attr)
+		}
+	}
+	return nil, nil, nil, false
+}
+
 // Token returns the current Token. The result's Data and Attr values remain
 // valid after subsequent Next calls.
 func (z *Tokenizer) Token() Token {
@@ -1213,9 +1263,13 @@ func (z *Tokenizer) Token() Token {
 	case StartTagToken, SelfClosingTagToken, EndTagToken:
 		name, moreAttr := z.TagName()
 		for moreAttr {
-			var key, val []byte
-			key, val, moreAttr = z.TagAttr()
-			t.Attr = append(t.Attr, Attribute{"", atom.String(key), string(val)})
+			var key, val, raw []byte
+			if z.keepRawAttrVals {
+				key, val, raw, moreAttr = z.RawTagAttr()
+			} else {
+				key, val, moreAttr = z.TagAttr()
+			}
+			t.Attr = append(t.Attr, Attribute{Key: atom.String(key), Val: string(val), RawVal: string(raw)})
 		}
 		if a := atom.Lookup(name); a != 0 {
 			t.DataAtom, t.Data = a, a.String()
@@ -754,6 +754,28 @@ func TestConvertNewlines(t *testing.T) {
 	}
 }
 
+func TestRawTagAttr(t *testing.T) {
+	z := NewTokenizer(strings.NewReader("<p TITLE=\"x\r\ny\" class=a&amp;b id='&lt;' hidden>"))
+	if tt := z.Next(); tt != StartTagToken {
+		t.Fatalf("Next() = %v, want StartTagToken", tt)
+	}
+	want := [][3]string{
+		{"title", "x\ny", "x\r\ny"},
+		{"class", "a&b", "a&amp;b"},
+		{"id", "<", "&lt;"},
+		{"hidden", "", ""},
+	}
+	var got [][3]string
+	for more := true; more; {
+		var key, val, raw []byte
+		key, val, raw, more = z.RawTagAttr()
+		got = append(got, [3]string{string(key), string(val), string(raw)})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RawTagAttr returned %q, want %q", got, want)
+	}
+}
+
 func TestReaderEdgeCases(t *testing.T) {
 	const s = "<p>An io.Reader can return (0, nil) or (n, io.EOF).</p>"
 	testCases := []io.Reader{
@@ -0,0 +1,100 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import "time"
+
+// defaultMaxAutoTuneWindow is the default limit on windows grown by
+// the bandwidth-delay product estimator.
+const defaultMaxAutoTuneWindow = 16 << 20
+
+// bdpPingData is the payload of the PING frames sent to measure the
+// round-trip time of a connection. Its acknowledgement is told apart
+// from those of other PINGs by the payload.
+var bdpPingData = [8]byte{'b', 'd', 'p', 'p', 'i', 'n', 'g', 0}
+
+// A bdpEstimator estimates the bandwidth-delay product of a connection
+// to size its receive windows.
+//
+// When DATA arrives and no measurement is in progress, the estimator
+// asks for a PING to be sent and counts the bytes received until the
+// PING is acknowledged. That count is the amount of data the peer had
+// in flight during one round trip. If it fills most of the current
+// window, the window is what limits the peer, so the window is doubled
+// to the count, as long as the measured bandwidth is not lower than
+// it has been before (a lower bandwidth means the window is not what
+// limits the peer).
+type bdpEstimator struct {
+	window int32 // current window; only grows
+	max    int32 // limit on window
+
+	sentAt  time.Time     // when the outstanding PING was sent; zero if none
+	sample  int64         // bytes received since sentAt
+	rtt     time.Duration // smoothed round-trip time
+	samples int           // number of round trips measured
+	bwMax   float64       // highest bandwidth measured, in bytes/s
+}
+
+// newBDPEstimator returns an estimator whose window starts at window
+// and grows up to max.
+func newBDPEstimator(window, max int32) *bdpEstimator {
+	if max <= 0 {
+		max = defaultMaxAutoTuneWindow
+	}
+	return &bdpEstimator{window: window, max: max}
+}
+
+// received records that a DATA frame of n bytes was received at now.
+// It reports whether the caller should send a PING with bdpPingData.
+func (b *bdpEstimator) received(n uint32, now time.Time) (sendPing bool) {
+	if b.window >= b.max {
+		return false
+	}
+	if b.sentAt.IsZero() {
+		b.sentAt = now
+		b.sample = int64(n)
+		return true
+	}
+	b.sample += int64(n)
+	return false
+}
+
+// acked records that the PING was acknowledged at now. It returns the
+// number of bytes by which the window grew, or 0 if it did not.
+func (b *bdpEstimator) acked(now time.Time) (grow int32) {
+	if b.sentAt.IsZero() {
+		return 0
+	}
+	rtt := now.Sub(b.sentAt)
+	b.sentAt = time.Time{}
+	b.samples++
+	if b.samples <= 10 {
+		// Average the first samples evenly.
+		b.rtt += (rtt - b.rtt) / time.Duration(b.samples)
+	} else {
+		b.rtt += (rtt - b.rtt) / 8
+	}
+	if b.rtt <= 0 {
+		b.rtt = time.Microsecond
+	}
+	bw := float64(b.sample) / b.rtt.Seconds()
+	if bw < b.bwMax {
+		return 0
+	}
+	b.bwMax = bw
+	if b.sample*3 < int64(b.window)*2 {
+		return 0
+	}
+	window := 2 * b.sample
+	if window > int64(b.max) {
+		window = int64(b.max)
+	}
+	if window <= int64(b.window) {
+		return 0
+	}
+	grow = int32(window) - b.window
+	b.window = int32(window)
+	return grow
+}
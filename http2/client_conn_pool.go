@@ -49,6 +49,11 @@ type clientConnPool struct {
 	dialing      map[string]*dialCall     // currently in-flight dials
 	keys         map[*ClientConn][]string
 	addConnCalls map[string]*addConnCall // in-flight addConnIfNeeded calls
+
+	// connsChanged, if non-nil, is closed when a connection is added
+	// or removed, a dial fails, or a stream slot may have become free,
+	// to wake up requests waiting because of Transport.MaxConnsPerHost.
+	connsChanged chan struct{}
 }
 
 func (p *clientConnPool) GetClientConn(req *http.Request, addr string) (*ClientConn, error) {
@@ -91,6 +96,19 @@ func (p *clientConnPool) getClientConn(req *http.Request, addr string, dialOnMis
 			p.mu.Unlock()
 			return nil, ErrNoCachedConn
 		}
+		if p.atConnLimitLocked(addr) {
+			if p.connsChanged == nil {
+				p.connsChanged = make(chan struct{})
+			}
+			changed := p.connsChanged
+			p.mu.Unlock()
+			select {
+			case <-changed:
+				continue
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
 		traceGetConn(req, addr)
 		call := p.getStartDialLocked(req.Context(), addr)
 		p.mu.Unlock()
@@ -108,6 +126,33 @@ func (p *clientConnPool) getClientConn(req *http.Request, addr string, dialOnMis
 	}
 }
 
+// atConnLimitLocked reports whether addr has as many connections as
+// Transport.MaxConnsPerHost allows, counting the one being dialed, if
+// any. Connections that no longer take new requests, such as those
+// the peer is draining, are not counted: requests waiting for room
+// would otherwise wait for them to be closed, which only happens once
+// they are idle.
+//
+// p.mu must be held.
+func (p *clientConnPool) atConnLimitLocked(addr string) bool {
+	max := p.t.MaxConnsPerHost
+	if max <= 0 {
+		return false
+	}
+	n := 0
+	for _, cc := range p.conns[addr] {
+		cc.mu.Lock()
+		if !cc.retiredLocked() {
+			n++
+		}
+		cc.mu.Unlock()
+	}
+	if _, ok := p.dialing[addr]; ok {
+		n++
+	}
+	return n >= max
+}
+
 // dialCall is an in-flight Transport dial call to a host.
 type dialCall struct {
 	_ incomparable
@@ -144,6 +189,10 @@ func (c *dialCall) dial(ctx context.Context, addr string) {
 	delete(c.p.dialing, addr)
 	if c.err == nil {
 		c.p.addConnLocked(addr, c.res)
+	} else {
+		// Wake up requests waiting for this dial to leave room
+		// under Transport.MaxConnsPerHost.
+		c.p.connsChangedLocked()
 	}
 	c.p.mu.Unlock()
 
@@ -225,6 +274,18 @@ func (p *clientConnPool) addConnLocked(key string, cc *ClientConn) {
 	}
 	p.conns[key] = append(p.conns[key], cc)
 	p.keys[cc] = append(p.keys[cc], key)
+	p.connsChangedLocked()
+}
+
+// connsChangedLocked wakes up requests waiting for a connection
+// because of Transport.MaxConnsPerHost.
+//
+// p.mu must be held.
+func (p *clientConnPool) connsChangedLocked() {
+	if p.connsChanged != nil {
+		close(p.connsChanged)
+		p.connsChanged = nil
+	}
 }
 
 func (p *clientConnPool) MarkDead(cc *ClientConn) {
@@ -243,6 +304,7 @@ func (p *clientConnPool) MarkDead(cc *ClientConn) {
 		}
 	}
 	delete(p.keys, cc)
+	p.connsChangedLocked()
 }
 
 func (p *clientConnPool) closeIdleConnections() {
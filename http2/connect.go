@@ -0,0 +1,148 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DialConnect opens a tunnel to target through the HTTP/2 proxy at
+// proxyAddr ("host:port") using the CONNECT method, and returns the
+// tunnel as a net.Conn. The connection to the proxy is made, or
+// reused, as for an "https" request to proxyAddr.
+//
+// See ClientConn.DialConnect for the behavior of the returned conn.
+func (t *Transport) DialConnect(ctx context.Context, proxyAddr, target string) (net.Conn, error) {
+	return dialConnect(ctx, t.RoundTrip, proxyAddr, target, nil)
+}
+
+// DialConnect opens a tunnel to target ("host:port") through the
+// server, which must be a proxy supporting the CONNECT method, and
+// returns the tunnel as a net.Conn.
+//
+// The context governs only the opening of the tunnel. Once
+// DialConnect returns, the tunnel lasts until it is closed or the
+// stream is reset. Reads return the DATA frames the proxy sends, and
+// io.EOF once it ends the stream. Writes are sent as DATA frames,
+// subject to flow control. The returned conn has a CloseWrite method
+// that ends the stream in the client's direction while still allowing
+// reads, like (*net.TCPConn).CloseWrite. Close resets the stream if
+// the proxy has not already ended it.
+//
+// The conn's addresses are those of the connection to the proxy.
+// Deadlines are not supported: its SetDeadline, SetReadDeadline and
+// SetWriteDeadline methods return an error.
+//
+// If the proxy responds with a status other than 2xx, DialConnect
+// returns an error.
+func (cc *ClientConn) DialConnect(ctx context.Context, target string) (net.Conn, error) {
+	return dialConnect(ctx, cc.RoundTrip, cc.tconn.RemoteAddr().String(), target, cc.tconn)
+}
+
+// dialConnect sends a CONNECT request for target with roundTrip and
+// returns the tunnel. c is the connection to the proxy; if it is nil,
+// it is learned from the GotConn trace hook.
+func dialConnect(ctx context.Context, roundTrip func(*http.Request) (*http.Response, error), proxyAddr, target string, c net.Conn) (net.Conn, error) {
+	// The request's context is canceled when the tunnel is closed, so
+	// it must outlive ctx.
+	reqCtx, cancel := context.WithCancel(context.Background())
+	dialDone := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-dialDone:
+		}
+	}()
+
+	if c == nil {
+		reqCtx = httptrace.WithClientTrace(reqCtx, &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) { c = info.Conn },
+		})
+	}
+	pr, pw := io.Pipe()
+	req := (&http.Request{
+		Method:     "CONNECT",
+		URL:        &url.URL{Scheme: "https", Host: proxyAddr},
+		Host:       target,
+		Header:     make(http.Header),
+		Body:       pr,
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+	}).WithContext(reqCtx)
+	res, err := roundTrip(req)
+	close(dialDone)
+	if err == nil && ctx.Err() != nil {
+		res.Body.Close()
+		err = ctx.Err()
+	}
+	if err != nil {
+		cancel()
+		pw.Close()
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+		cancel()
+		pw.Close()
+		return nil, fmt.Errorf("http2: CONNECT to %s failed: %s", target, res.Status)
+	}
+	return &connectConn{
+		body:   res.Body,
+		pw:     pw,
+		cancel: cancel,
+		conn:   c,
+	}, nil
+}
+
+var errConnectDeadline = errors.New("http2: deadlines are not supported on CONNECT tunnels")
+
+// connectConn is a net.Conn carried by a CONNECT stream.
+type connectConn struct {
+	body   io.ReadCloser  // response body: DATA frames from the proxy
+	pw     *io.PipeWriter // request body: DATA frames to the proxy
+	cancel func()         // cancels the request
+	conn   net.Conn       // connection to the proxy
+
+	closeOnce sync.Once
+}
+
+func (c *connectConn) Read(p []byte) (int, error) {
+	return c.body.Read(p)
+}
+
+func (c *connectConn) Write(p []byte) (int, error) {
+	return c.pw.Write(p)
+}
+
+// CloseWrite ends the stream in the client's direction.
+func (c *connectConn) CloseWrite() error {
+	return c.pw.Close()
+}
+
+func (c *connectConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.pw.Close()
+		c.body.Close()
+		c.cancel()
+	})
+	return nil
+}
+
+func (c *connectConn) LocalAddr() net.Addr  { return c.conn.LocalAddr() }
+func (c *connectConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+func (c *connectConn) SetDeadline(t time.Time) error      { return errConnectDeadline }
+func (c *connectConn) SetReadDeadline(t time.Time) error  { return errConnectDeadline }
+func (c *connectConn) SetWriteDeadline(t time.Time) error { return errConnectDeadline }
@@ -68,6 +68,13 @@ func (e ConnectionError) Error() string { return fmt.Sprintf("connection error:
 
 // StreamError is an error that only affects one stream within an
 // HTTP/2 connection.
+//
+// When the peer resets a stream, Code is the error code of its
+// RST_STREAM frame. The Transport returns such an error, possibly
+// wrapped, from RoundTrip or from reads of the response body, so
+// callers can match on the code with errors.As, for example to back
+// off after ErrCodeEnhanceYourCalm. A Server handler can learn the
+// code a client reset its stream with from StreamResetError.
 type StreamError struct {
 	StreamID uint32
 	Code     ErrCode
@@ -6,6 +6,8 @@
 
 package http2
 
+import "time"
+
 // inflowMinRefresh is the minimum number of bytes we'll send for a
 // flow control window update.
 const inflowMinRefresh = 4 << 10
@@ -118,3 +120,28 @@ func (f *outflow) add(n int32) bool {
 	}
 	return false
 }
+
+// A FlowControlStall describes a period during which DATA for a
+// stream could not be sent because a flow-control window was
+// exhausted. It is reported to Transport.FlowControlStalled and
+// Server.FlowControlStalled for diagnosing window-size
+// misconfiguration.
+type FlowControlStall struct {
+	// StreamID is the stream whose DATA was blocked.
+	StreamID uint32
+
+	// Conn reports whether the connection-level window, rather than
+	// the stream's own window, was exhausted when the stall began.
+	Conn bool
+
+	// Duration is how long the stream waited for the peer to
+	// replenish the window.
+	Duration time.Duration
+}
+
+// connStalled reports whether a stall of f, which has no available
+// window, is due to the connection-level window rather than the
+// stream's own.
+func (f *outflow) connStalled() bool {
+	return f.n > 0 && f.conn != nil && f.conn.n <= 0
+}
@@ -37,6 +37,8 @@ const (
 	FrameGoAway       FrameType = 0x7
 	FrameWindowUpdate FrameType = 0x8
 	FrameContinuation FrameType = 0x9
+
+	FramePriorityUpdate FrameType = 0x10 // RFC 9218
 )
 
 var frameName = map[FrameType]string{
@@ -50,6 +52,8 @@ var frameName = map[FrameType]string{
 	FrameGoAway:       "GOAWAY",
 	FrameWindowUpdate: "WINDOW_UPDATE",
 	FrameContinuation: "CONTINUATION",
+
+	FramePriorityUpdate: "PRIORITY_UPDATE",
 }
 
 func (t FrameType) String() string {
@@ -135,6 +139,8 @@ var frameParsers = map[FrameType]frameParser{
 	FrameGoAway:       parseGoAwayFrame,
 	FrameWindowUpdate: parseWindowUpdateFrame,
 	FrameContinuation: parseContinuationFrame,
+
+	FramePriorityUpdate: parsePriorityUpdateFrame,
 }
 
 func typeFrameParser(t FrameType) frameParser {
@@ -279,12 +285,17 @@ type Framer struct {
 	maxReadSize uint32
 	headerBuf   [frameHeaderLen]byte
 
-	// TODO: let getReadBuf be configurable, and use a less memory-pinning
-	// allocator in server.go to minimize memory pinned for many idle conns.
-	// Will probably also need to make frame invalidation have a hook too.
 	getReadBuf func(size uint32) []byte
 	readBuf    []byte // cache for default getReadBuf
 
+	// poolReadBuf, if true, makes ReadFrame read payloads into
+	// buffers from readBufPools instead of readBuf. The buffer of a
+	// frame is returned to its pool on the next call to ReadFrame,
+	// when the frame becomes invalid, so that a Framer waiting for a
+	// frame holds no buffer. See Server.PoolReadBuffers.
+	poolReadBuf bool
+	pooledBuf   []byte // buffer of the last frame read, if pooled
+
 	maxWriteSize uint32 // zero means unlimited; TODO: implement
 
 	w    io.Writer
@@ -316,6 +327,13 @@ type Framer struct {
 	// If the limit is hit, MetaHeadersFrame.Truncated is set true.
 	MaxHeaderListSize uint32
 
+	// maxContinuationFrames and maxHeaderBlockSize, if positive,
+	// limit the number of CONTINUATION frames and the total length of
+	// the header block fragments of a header block read with
+	// ReadMetaHeaders. See Server.MaxHeaderContinuationFrames.
+	maxContinuationFrames int
+	maxHeaderBlockSize    int
+
 	// TODO: track which type of frame & with which flags was sent
 	// last. Then return an error (unless AllowIllegalWrites) if
 	// we're in the middle of a header block and a
@@ -329,6 +347,18 @@ type Framer struct {
 	debugReadLoggerf  func(string, ...interface{})
 	debugWriteLoggerf func(string, ...interface{})
 
+	// onFrame, if non-nil, is called with a copy of each frame
+	// read or written. See Server.OnFrame and Transport.OnFrame.
+	onFrame func(FrameDirection, Frame)
+
+	// headerStats, if non-nil, counts the sizes of the header blocks
+	// read. See HeaderStats.
+	headerStats *headerStats
+
+	// stats, if non-nil, counts the frames read and written. See
+	// Stats.
+	stats *connStats
+
 	frameCache *frameCache // nil if frames aren't reused (default)
 }
 
@@ -367,14 +397,67 @@ func (f *Framer) endWrite() error {
 	if f.logWrites {
 		f.logWrite()
 	}
+	if f.onFrame != nil {
+		f.reportFrame(FrameWritten, f.wbuf[:frameHeaderLen], f.wbuf[frameHeaderLen:])
+	}
 
 	n, err := f.w.Write(f.wbuf)
+	if f.stats != nil && n > 0 {
+		f.stats.wrote(FrameType(f.wbuf[3]), n)
+	}
 	if err == nil && n != len(f.wbuf) {
 		err = io.ErrShortWrite
 	}
 	return err
 }
 
+// A FrameDirection says whether a frame passed to an OnFrame
+// callback was read from or written to the connection.
+// See Server.OnFrame and Transport.OnFrame.
+type FrameDirection int
+
+const (
+	// FrameRead reports a frame read from the connection. The
+	// callback runs after the frame has been read and parsed, before
+	// it is processed.
+	FrameRead FrameDirection = iota
+
+	// FrameWritten reports a frame about to be written to the
+	// connection. The callback runs before the frame is written, so
+	// it is reported even if the write then fails.
+	FrameWritten
+)
+
+// String returns "read" or "wrote".
+func (d FrameDirection) String() string {
+	switch d {
+	case FrameRead:
+		return "read"
+	case FrameWritten:
+		return "wrote"
+	}
+	return fmt.Sprintf("FrameDirection(%d)", int(d))
+}
+
+// reportFrame passes the frame with the given encoded header and
+// payload to f.onFrame. The frame is parsed from a copy of the
+// payload, so the callback may retain it, and nothing it does to it
+// affects the frame being read or written. Frames that fail to parse,
+// such as those written with AllowIllegalWrites, are not reported.
+func (f *Framer) reportFrame(dir FrameDirection, header, payload []byte) {
+	fh, err := readFrameHeader(make([]byte, frameHeaderLen), bytes.NewReader(header))
+	if err != nil {
+		return
+	}
+	p := make([]byte, len(payload))
+	copy(p, payload)
+	fr, err := typeFrameParser(fh.Type)(nil, fh, func(string) {}, p)
+	if err != nil {
+		return
+	}
+	f.onFrame(dir, fr)
+}
+
 func (f *Framer) logWrite() {
 	if f.debugFramer == nil {
 		f.debugFramerBuf = new(bytes.Buffer)
@@ -426,6 +509,48 @@ func (fc *frameCache) getDataFrame() *DataFrame {
 	return &fc.dataFrame
 }
 
+// Frame payload buffers are taken from these pools by Framers with
+// pooled read buffers. Each frame is read into a buffer of the
+// smallest size class that fits it, and frames larger than the largest
+// class into a buffer allocated for them.
+var (
+	readBufSizeClasses = []int{
+		16 << 10,
+		64 << 10,
+		256 << 10,
+		1 << 20,
+	}
+	readBufPools = [...]sync.Pool{
+		{New: func() interface{} { return make([]byte, 16<<10) }},
+		{New: func() interface{} { return make([]byte, 64<<10) }},
+		{New: func() interface{} { return make([]byte, 256<<10) }},
+		{New: func() interface{} { return make([]byte, 1<<20) }},
+	}
+)
+
+// getReadBuf returns a buffer of length size for a frame payload.
+func getReadBuf(size uint32) []byte {
+	if size == 0 {
+		return nil
+	}
+	for i, n := range readBufSizeClasses {
+		if int(size) <= n {
+			return readBufPools[i].Get().([]byte)[:size]
+		}
+	}
+	return make([]byte, size)
+}
+
+// putReadBuf returns a buffer from getReadBuf to its pool.
+func putReadBuf(p []byte) {
+	for i, n := range readBufSizeClasses {
+		if cap(p) == n {
+			readBufPools[i].Put(p[:n])
+			return
+		}
+	}
+}
+
 // NewFramer returns a Framer that writes frames to w and reads them from r.
 func NewFramer(w io.Writer, r io.Reader) *Framer {
 	fr := &Framer{
@@ -495,6 +620,10 @@ func (fr *Framer) ReadFrame() (Frame, error) {
 	if fr.lastFrame != nil {
 		fr.lastFrame.invalidate()
 	}
+	if fr.pooledBuf != nil {
+		putReadBuf(fr.pooledBuf)
+		fr.pooledBuf = nil
+	}
 	fh, err := readFrameHeader(fr.headerBuf[:], fr.r)
 	if err != nil {
 		return nil, err
@@ -502,10 +631,19 @@ func (fr *Framer) ReadFrame() (Frame, error) {
 	if fh.Length > fr.maxReadSize {
 		return nil, ErrFrameTooLarge
 	}
-	payload := fr.getReadBuf(fh.Length)
+	var payload []byte
+	if fr.poolReadBuf {
+		payload = getReadBuf(fh.Length)
+		fr.pooledBuf = payload
+	} else {
+		payload = fr.getReadBuf(fh.Length)
+	}
 	if _, err := io.ReadFull(fr.r, payload); err != nil {
 		return nil, err
 	}
+	if fr.stats != nil {
+		fr.stats.read(fh.Type, fh.Length)
+	}
 	f, err := typeFrameParser(fh.Type)(fr.frameCache, fh, fr.countError, payload)
 	if err != nil {
 		if ce, ok := err.(connError); ok {
@@ -519,6 +657,9 @@ func (fr *Framer) ReadFrame() (Frame, error) {
 	if fr.logReads {
 		fr.debugReadLoggerf("http2: Framer %p: read %v", fr, summarizeFrame(f))
 	}
+	if fr.onFrame != nil {
+		fr.reportFrame(FrameRead, fr.headerBuf[:], payload)
+	}
 	if fh.Type == FrameHeaders && fr.ReadMetaHeaders != nil {
 		return fr.readMetaFrame(f.(*HeadersFrame))
 	}
@@ -1201,6 +1342,56 @@ func (f *Framer) WritePriority(streamID uint32, p PriorityParam) error {
 	return f.endWrite()
 }
 
+// A PriorityUpdateFrame changes the priority of a request in the
+// extensible prioritization scheme of RFC 9218.
+// See https://www.rfc-editor.org/rfc/rfc9218.html#section-7.1
+type PriorityUpdateFrame struct {
+	FrameHeader
+
+	// PrioritizedStreamID is the stream of the request.
+	PrioritizedStreamID uint32
+
+	// Priority is the new priority, in the format of the "priority"
+	// header field. See ParseStreamPriority.
+	Priority string
+}
+
+func parsePriorityUpdateFrame(_ *frameCache, fh FrameHeader, countError func(string), payload []byte) (Frame, error) {
+	if fh.StreamID != 0 {
+		countError("frame_priorityupdate_nonzero_stream")
+		return nil, connError{ErrCodeProtocol, "PRIORITY_UPDATE frame with non-zero stream ID"}
+	}
+	if len(payload) < 4 {
+		countError("frame_priorityupdate_bad_length")
+		return nil, connError{ErrCodeFrameSize, fmt.Sprintf("PRIORITY_UPDATE frame payload size was %d; want at least 4", len(payload))}
+	}
+	id := binary.BigEndian.Uint32(payload[:4]) & (1<<31 - 1)
+	if id == 0 {
+		countError("frame_priorityupdate_zero_prioritized_stream")
+		return nil, connError{ErrCodeProtocol, "PRIORITY_UPDATE frame for stream ID 0"}
+	}
+	return &PriorityUpdateFrame{
+		FrameHeader:         fh,
+		PrioritizedStreamID: id,
+		Priority:            string(payload[4:]),
+	}, nil
+}
+
+// WritePriorityUpdate writes a PRIORITY_UPDATE frame setting the
+// priority of the request on stream streamID.
+//
+// It will perform exactly one Write to the underlying Writer.
+// It is the caller's responsibility to not call other Write methods concurrently.
+func (f *Framer) WritePriorityUpdate(streamID uint32, priority string) error {
+	if !validStreamID(streamID) && !f.AllowIllegalWrites {
+		return errStreamID
+	}
+	f.startWrite(FramePriorityUpdate, 0, 0)
+	f.writeUint32(streamID)
+	f.writeBytes([]byte(priority))
+	return f.endWrite()
+}
+
 // A RSTStreamFrame allows for abnormal termination of a stream.
 // See https://httpwg.org/specs/rfc7540.html#rfc.section.6.4
 type RSTStreamFrame struct {
@@ -1487,7 +1678,7 @@ func (mh *MetaHeadersFrame) checkPseudos() error {
 	pf := mh.PseudoFields()
 	for i, hf := range pf {
 		switch hf.Name {
-		case ":method", ":path", ":scheme", ":authority":
+		case ":method", ":path", ":scheme", ":authority", ":protocol":
 			isRequest = true
 		case ":status":
 			isResponse = true
@@ -1495,7 +1686,7 @@ func (mh *MetaHeadersFrame) checkPseudos() error {
 			return pseudoHeaderError(hf.Name)
 		}
 		// Check for duplicates.
-		// This would be a bad algorithm, but N is 4.
+		// This would be a bad algorithm, but N is 5.
 		// And this doesn't allocate.
 		for _, hf2 := range pf[:i] {
 			if hf.Name == hf2.Name {
@@ -1536,7 +1727,9 @@ func (fr *Framer) readMetaFrame(hf *HeadersFrame) (*MetaHeadersFrame, error) {
 	hdec := fr.ReadMetaHeaders
 	hdec.SetEmitEnabled(true)
 	hdec.SetMaxStringLength(fr.maxHeaderStringLen())
+	var rawSize, encodedSize int
 	hdec.SetEmitFunc(func(hf hpack.HeaderField) {
+		rawSize += len(hf.Name) + len(hf.Value)
 		if VerboseLogs && fr.logReads {
 			fr.debugReadLoggerf("http2: decoded hpack field %+v", hf)
 		}
@@ -1575,8 +1768,16 @@ func (fr *Framer) readMetaFrame(hf *HeadersFrame) (*MetaHeadersFrame, error) {
 	defer hdec.SetEmitFunc(func(hf hpack.HeaderField) {})
 
 	var hc headersOrContinuation = hf
+	continuations := 0
 	for {
 		frag := hc.HeaderBlockFragment()
+		encodedSize += len(frag)
+		// Check the limits before decoding, which is where a flood of
+		// CONTINUATION frames costs the most.
+		if fr.maxHeaderBlockSize > 0 && encodedSize > fr.maxHeaderBlockSize {
+			fr.countError("headers_block_size")
+			return nil, ConnectionError(ErrCodeEnhanceYourCalm)
+		}
 		if _, err := hdec.Write(frag); err != nil {
 			return nil, ConnectionError(ErrCodeCompression)
 		}
@@ -1589,6 +1790,11 @@ func (fr *Framer) readMetaFrame(hf *HeadersFrame) (*MetaHeadersFrame, error) {
 		} else {
 			hc = f.(*ContinuationFrame) // guaranteed by checkFrameOrder
 		}
+		continuations++
+		if fr.maxContinuationFrames > 0 && continuations > fr.maxContinuationFrames {
+			fr.countError("headers_continuation_frames")
+			return nil, ConnectionError(ErrCodeEnhanceYourCalm)
+		}
 	}
 
 	mh.HeadersFrame.headerFragBuf = nil
@@ -1597,6 +1803,9 @@ func (fr *Framer) readMetaFrame(hf *HeadersFrame) (*MetaHeadersFrame, error) {
 	if err := hdec.Close(); err != nil {
 		return nil, ConnectionError(ErrCodeCompression)
 	}
+	if fr.headerStats != nil {
+		fr.headerStats.received(rawSize, encodedSize)
+	}
 	if invalid != nil {
 		fr.errDetail = invalid
 		if VerboseLogs {
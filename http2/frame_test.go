@@ -75,6 +75,36 @@ func TestWriteRST(t *testing.T) {
 	}
 }
 
+func TestFramerPoolReadBuf(t *testing.T) {
+	fr, _ := testFramer()
+	fr.poolReadBuf = true
+	fr.AllowIllegalWrites = true // DATA frames larger than the default maximum
+	fr.SetMaxReadFrameSize(maxFrameSize)
+	sizes := []int{0, 100, 16 << 10, 16<<10 + 1, 1 << 20, 1<<20 + 1}
+	for i, size := range sizes {
+		data := bytes.Repeat([]byte{byte('a' + i)}, size)
+		if err := fr.WriteData(1, false, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, size := range sizes {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := bytes.Repeat([]byte{byte('a' + i)}, size)
+		if got := f.(*DataFrame).Data(); !bytes.Equal(got, want) {
+			t.Errorf("frame %d: read %d bytes, want %d bytes of %q", i, len(got), size, want[:1])
+		}
+	}
+	if _, err := fr.ReadFrame(); err != io.EOF {
+		t.Errorf("ReadFrame at end = %v, want EOF", err)
+	}
+	if fr.pooledBuf != nil || fr.readBuf != nil {
+		t.Errorf("Framer holds a read buffer while waiting for a frame")
+	}
+}
+
 func TestWriteData(t *testing.T) {
 	fr, buf := testFramer()
 	var streamID uint32 = 1<<24 + 2<<16 + 3<<8 + 4
@@ -562,6 +592,50 @@ func TestWriteWindowUpdate(t *testing.T) {
 	}
 }
 
+func TestWritePriorityUpdate(t *testing.T) {
+	fr, buf := testFramer()
+	if err := fr.WritePriorityUpdate(5, "u=1, i"); err != nil {
+		t.Fatal(err)
+	}
+	const wantEnc = "\x00\x00\x0a\x10\x00\x00\x00\x00\x00\x00\x00\x00\x05u=1, i"
+	if buf.String() != wantEnc {
+		t.Errorf("encoded as %q; want %q", buf.Bytes(), wantEnc)
+	}
+	f, err := fr.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &PriorityUpdateFrame{
+		FrameHeader: FrameHeader{
+			valid:  true,
+			Type:   FramePriorityUpdate,
+			Length: 10,
+		},
+		PrioritizedStreamID: 5,
+		Priority:            "u=1, i",
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("parsed back %#v; want %#v", f, want)
+	}
+}
+
+func TestReadPriorityUpdateErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		enc  string
+	}{
+		{"non-zero stream", "\x00\x00\x04\x10\x00\x00\x00\x00\x01\x00\x00\x00\x05"},
+		{"short", "\x00\x00\x03\x10\x00\x00\x00\x00\x00\x00\x00\x05"},
+		{"zero prioritized stream", "\x00\x00\x04\x10\x00\x00\x00\x00\x00\x00\x00\x00\x00"},
+	} {
+		fr, buf := testFramer()
+		buf.WriteString(tt.enc)
+		if _, err := fr.ReadFrame(); err == nil {
+			t.Errorf("%s: ReadFrame succeeded, want error", tt.name)
+		}
+	}
+}
+
 func TestWritePing(t *testing.T)    { testWritePing(t, false) }
 func TestWritePingAck(t *testing.T) { testWritePing(t, true) }
 
@@ -0,0 +1,55 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import "sync/atomic"
+
+// HeaderStats reports how well HPACK compresses the headers of a
+// connection, for example to tune header table sizes. The raw size of
+// a header list is the total length of its field names and values;
+// its encoded size is the length of the HPACK header block carrying
+// it, without the framing of the HEADERS, PUSH_PROMISE and
+// CONTINUATION frames. All counts are cumulative since the connection
+// was established.
+type HeaderStats struct {
+	// SentRaw and SentEncoded are the raw and encoded sizes of the
+	// header lists sent to the peer.
+	SentRaw     int64
+	SentEncoded int64
+
+	// ReceivedRaw and ReceivedEncoded are the raw and encoded sizes
+	// of the header lists received from the peer.
+	ReceivedRaw     int64
+	ReceivedEncoded int64
+}
+
+// headerStats accumulates the HeaderStats of a connection. Its fields
+// are accessed atomically, so it may be read while headers are being
+// written and read.
+type headerStats struct {
+	sentRaw         int64
+	sentEncoded     int64
+	receivedRaw     int64
+	receivedEncoded int64
+}
+
+func (s *headerStats) sent(raw, encoded int) {
+	atomic.AddInt64(&s.sentRaw, int64(raw))
+	atomic.AddInt64(&s.sentEncoded, int64(encoded))
+}
+
+func (s *headerStats) received(raw, encoded int) {
+	atomic.AddInt64(&s.receivedRaw, int64(raw))
+	atomic.AddInt64(&s.receivedEncoded, int64(encoded))
+}
+
+func (s *headerStats) snapshot() HeaderStats {
+	return HeaderStats{
+		SentRaw:         atomic.LoadInt64(&s.sentRaw),
+		SentEncoded:     atomic.LoadInt64(&s.sentEncoded),
+		ReceivedRaw:     atomic.LoadInt64(&s.receivedRaw),
+		ReceivedEncoded: atomic.LoadInt64(&s.receivedEncoded),
+	}
+}
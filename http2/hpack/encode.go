@@ -26,8 +26,10 @@ type Encoder struct {
 	// tableSizeUpdate indicates whether "Header Table Size
 	// Update" is required.
 	tableSizeUpdate bool
-	w               io.Writer
-	buf             []byte
+	// noHuffman disables Huffman coding of string literals.
+	noHuffman bool
+	w         io.Writer
+	buf       []byte
 }
 
 // NewEncoder returns a new Encoder which performs HPACK encoding. An
@@ -69,9 +71,9 @@ func (e *Encoder) WriteField(f HeaderField) error {
 		}
 
 		if idx == 0 {
-			e.buf = appendNewName(e.buf, f, indexing)
+			e.buf = appendNewName(e.buf, f, indexing, !e.noHuffman)
 		} else {
-			e.buf = appendIndexedName(e.buf, f, idx, indexing)
+			e.buf = appendIndexedName(e.buf, f, idx, indexing, !e.noHuffman)
 		}
 	}
 	n, err := e.w.Write(e.buf)
@@ -136,6 +138,16 @@ func (e *Encoder) SetMaxDynamicTableSizeLimit(v uint32) {
 	}
 }
 
+// SetHuffmanEncoding sets whether the encoder may Huffman-code the
+// names and values of header fields. It is enabled by default, and
+// each string is then Huffman-coded when that makes it shorter.
+// Disabling it saves the CPU time spent coding, at the cost of larger
+// header blocks; strings are then always sent as raw literals, which
+// every decoder accepts.
+func (e *Encoder) SetHuffmanEncoding(enabled bool) {
+	e.noHuffman = !enabled
+}
+
 // shouldIndex reports whether f should be indexed.
 func (e *Encoder) shouldIndex(f HeaderField) bool {
 	return !f.Sensitive && f.Size() <= e.dynTab.maxSize
@@ -156,11 +168,12 @@ func appendIndexed(dst []byte, i uint64) []byte {
 //
 // If f.Sensitive is true, "Never Indexed" representation is used. If
 // f.Sensitive is false and indexing is true, "Incremental Indexing"
-// representation is used.
-func appendNewName(dst []byte, f HeaderField, indexing bool) []byte {
+// representation is used. Strings are Huffman-coded only if huffman
+// is true.
+func appendNewName(dst []byte, f HeaderField, indexing, huffman bool) []byte {
 	dst = append(dst, encodeTypeByte(indexing, f.Sensitive))
-	dst = appendHpackString(dst, f.Name)
-	return appendHpackString(dst, f.Value)
+	dst = appendHpackString(dst, f.Name, huffman)
+	return appendHpackString(dst, f.Value, huffman)
 }
 
 // appendIndexedName appends f and index i referring indexed name
@@ -169,8 +182,9 @@ func appendNewName(dst []byte, f HeaderField, indexing bool) []byte {
 //
 // If f.Sensitive is true, "Never Indexed" representation is used. If
 // f.Sensitive is false and indexing is true, "Incremental Indexing"
-// representation is used.
-func appendIndexedName(dst []byte, f HeaderField, i uint64, indexing bool) []byte {
+// representation is used. The value is Huffman-coded only if huffman
+// is true.
+func appendIndexedName(dst []byte, f HeaderField, i uint64, indexing, huffman bool) []byte {
 	first := len(dst)
 	var n byte
 	if indexing {
@@ -180,7 +194,7 @@ func appendIndexedName(dst []byte, f HeaderField, i uint64, indexing bool) []byt
 	}
 	dst = appendVarInt(dst, n, i)
 	dst[first] |= encodeTypeByte(indexing, f.Sensitive)
-	return appendHpackString(dst, f.Value)
+	return appendHpackString(dst, f.Value, huffman)
 }
 
 // appendTableSize appends v, as encoded in "Header Table Size Update"
@@ -213,9 +227,13 @@ func appendVarInt(dst []byte, n byte, i uint64) []byte {
 // appendHpackString appends s, as encoded in "String Literal"
 // representation, to dst and returns the extended buffer.
 //
-// s will be encoded in Huffman codes only when it produces strictly
-// shorter byte string.
-func appendHpackString(dst []byte, s string) []byte {
+// s will be encoded in Huffman codes only when huffman is true and it
+// produces strictly shorter byte string.
+func appendHpackString(dst []byte, s string, huffman bool) []byte {
+	if !huffman {
+		dst = appendVarInt(dst, 7, uint64(len(s)))
+		return append(dst, s...)
+	}
 	huffmanLength := HuffmanEncodeLength(s)
 	if huffmanLength < uint64(len(s)) {
 		first := len(dst)
@@ -170,7 +170,7 @@ func TestAppendHpackString(t *testing.T) {
 	}
 	for _, tt := range tests {
 		want := removeSpace(tt.wantHex)
-		buf := appendHpackString(nil, tt.s)
+		buf := appendHpackString(nil, tt.s, true)
 		if got := hex.EncodeToString(buf); want != got {
 			t.Errorf("appendHpackString(nil, %q) = %q; want %q", tt.s, got, want)
 		}
@@ -217,7 +217,7 @@ func TestAppendNewName(t *testing.T) {
 	}
 	for _, tt := range tests {
 		want := removeSpace(tt.wantHex)
-		buf := appendNewName(nil, tt.f, tt.indexing)
+		buf := appendNewName(nil, tt.f, tt.indexing, true)
 		if got := hex.EncodeToString(buf); want != got {
 			t.Errorf("appendNewName(nil, %+v, %v) = %q; want %q", tt.f, tt.indexing, got, want)
 		}
@@ -243,7 +243,7 @@ func TestAppendIndexedName(t *testing.T) {
 	}
 	for _, tt := range tests {
 		want := removeSpace(tt.wantHex)
-		buf := appendIndexedName(nil, tt.f, tt.i, tt.indexing)
+		buf := appendIndexedName(nil, tt.f, tt.i, tt.indexing, true)
 		if got := hex.EncodeToString(buf); want != got {
 			t.Errorf("appendIndexedName(nil, %+v, %v) = %q; want %q", tt.f, tt.indexing, got, want)
 		}
@@ -330,6 +330,43 @@ func TestEncoderSetMaxDynamicTableSizeLimit(t *testing.T) {
 	}
 }
 
+func TestEncoderSetHuffmanEncoding(t *testing.T) {
+	fields := []HeaderField{
+		pair(":authority", "www.example.com"),
+		pair("custom-key", "custom-value"),
+		pair("custom-key", "custom-value"),
+		{Name: "authorization", Value: "secret-token", Sensitive: true},
+	}
+	var huffBuf, rawBuf bytes.Buffer
+	huff := NewEncoder(&huffBuf)
+	raw := NewEncoder(&rawBuf)
+	raw.SetHuffmanEncoding(false)
+	for _, f := range fields {
+		huff.WriteField(f)
+		raw.WriteField(f)
+	}
+	for _, s := range []string{"www.example.com", "custom-key", "custom-value", "secret-token"} {
+		if !strings.Contains(rawBuf.String(), s) {
+			t.Errorf("encoding without Huffman coding does not contain %q as a literal: %x", s, rawBuf.Bytes())
+		}
+		if strings.Contains(huffBuf.String(), s) {
+			t.Errorf("encoding with Huffman coding contains %q as a literal: %x", s, huffBuf.Bytes())
+		}
+	}
+	if rawBuf.Len() <= huffBuf.Len() {
+		t.Errorf("encoding without Huffman coding is %d bytes; want more than the %d with it", rawBuf.Len(), huffBuf.Len())
+	}
+	for _, buf := range []*bytes.Buffer{&huffBuf, &rawBuf} {
+		got, err := NewDecoder(initialHeaderTableSize, nil).DecodeFull(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, fields) {
+			t.Errorf("decoded %+v; want %+v", got, fields)
+		}
+	}
+}
+
 func removeSpace(s string) string {
 	return strings.Replace(s, " ", "", -1)
 }
@@ -384,3 +421,31 @@ func BenchmarkEncoderSearchTable(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkEncoderHuffman(b *testing.B) {
+	// Header fields that change with each request, so that they are
+	// sent as literals rather than as dynamic table indexes.
+	fields := []HeaderField{
+		{Name: ":path", Value: "/api/v1/items/8f14e45fceea167a5a36dedd4bea2543?expand=true"},
+		{Name: "cookie", Value: "session=5d41402abc4b2a76b9719d911017c592; theme=dark"},
+		{Name: "x-request-id", Value: "3c59dc04-8b0e-4e05-9f7f-0a2b5e1d7c44"},
+		{Name: "user-agent", Value: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36"},
+	}
+	for _, huffman := range []bool{true, false} {
+		b.Run(fmt.Sprintf("huffman=%t", huffman), func(b *testing.B) {
+			var buf bytes.Buffer
+			e := NewEncoder(&buf)
+			e.SetMaxDynamicTableSizeLimit(0)
+			e.SetMaxDynamicTableSize(0)
+			e.SetHuffmanEncoding(huffman)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				for _, f := range fields {
+					e.WriteField(f)
+				}
+			}
+			b.ReportMetric(float64(buf.Len()), "wire-bytes/op")
+		})
+	}
+}
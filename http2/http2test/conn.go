@@ -0,0 +1,164 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2test
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// newConnPair returns the two ends of an in-memory connection.
+//
+// Unlike those of net.Pipe, writes are buffered and return without
+// waiting for the peer to read, as on a network connection. Both
+// HTTP/2 endpoints may write at the same time, for example to send
+// flow-control updates while the other sends data, which deadlocks on
+// a synchronous pipe.
+func newConnPair() (net.Conn, net.Conn) {
+	a := newPipeBuffer()
+	b := newPipeBuffer()
+	return &conn{r: a, w: b}, &conn{r: b, w: a}
+}
+
+// A conn is one end of an in-memory connection. It reads from r and
+// writes to w, which its peer writes to and reads from.
+type conn struct {
+	r, w *pipeBuffer
+}
+
+func (c *conn) Read(p []byte) (int, error)  { return c.r.read(p) }
+func (c *conn) Write(p []byte) (int, error) { return c.w.write(p) }
+
+// Close closes both directions: the peer reads EOF once it has read
+// what was written, and writes on either end fail.
+func (c *conn) Close() error {
+	c.r.closeRead()
+	c.w.closeWrite()
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr  { return pipeAddr{} }
+func (c *conn) RemoteAddr() net.Addr { return pipeAddr{} }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.r.setDeadline(t)
+	c.w.setDeadline(t)
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.r.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline only fails writes made after t, since writes never
+// block.
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.w.setDeadline(t)
+	return nil
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// A pipeBuffer holds the data written in one direction of a connection
+// until it is read.
+type pipeBuffer struct {
+	mu          sync.Mutex
+	cond        sync.Cond
+	buf         []byte
+	writeClosed bool // no more data will be written
+	readClosed  bool // no more data will be read
+	deadline    time.Time
+	timer       *time.Timer // wakes up readers at deadline
+}
+
+func newPipeBuffer() *pipeBuffer {
+	b := &pipeBuffer{}
+	b.cond.L = &b.mu
+	return b
+}
+
+func (b *pipeBuffer) read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		switch {
+		case b.readClosed:
+			return 0, net.ErrClosed
+		case b.expired():
+			return 0, os.ErrDeadlineExceeded
+		case len(b.buf) > 0:
+			n := copy(p, b.buf)
+			b.buf = b.buf[n:]
+			if len(b.buf) == 0 {
+				b.buf = nil
+			}
+			return n, nil
+		case b.writeClosed:
+			return 0, io.EOF
+		}
+		b.cond.Wait()
+	}
+}
+
+func (b *pipeBuffer) write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.writeClosed:
+		return 0, net.ErrClosed
+	case b.readClosed:
+		return 0, io.ErrClosedPipe
+	case b.expired():
+		return 0, os.ErrDeadlineExceeded
+	}
+	b.buf = append(b.buf, p...)
+	b.cond.Broadcast()
+	return len(p), nil
+}
+
+func (b *pipeBuffer) closeRead() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.readClosed = true
+	b.buf = nil
+	b.cond.Broadcast()
+}
+
+func (b *pipeBuffer) closeWrite() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writeClosed = true
+	b.cond.Broadcast()
+}
+
+func (b *pipeBuffer) setDeadline(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deadline = t
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if !t.IsZero() {
+		b.timer = time.AfterFunc(time.Until(t), func() {
+			b.mu.Lock()
+			b.cond.Broadcast()
+			b.mu.Unlock()
+		})
+	}
+	b.cond.Broadcast()
+}
+
+// expired reports whether the deadline has passed. b.mu must be held.
+func (b *pipeBuffer) expired() bool {
+	return !b.deadline.IsZero() && !time.Now().Before(b.deadline)
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package http2test provides utilities for testing HTTP/2 clients and
+// servers without sockets or TLS.
+package http2test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/http2"
+)
+
+// URL is the base URL of the server of a Pipe. Requests sent with the
+// Pipe's Client must use the "http" scheme; their host is not looked up
+// and is passed to the handler as is.
+const URL = "http://http2test.invalid"
+
+// A Pipe is an HTTP/2 server and client connected by in-memory
+// connections. Each connection the Transport dials is the client end of
+// a new in-memory pipe, whose server end is served by Server. The
+// connections speak HTTP/2 from the start, without TLS, as with
+// h2c with prior knowledge.
+type Pipe struct {
+	// Handler serves the requests received by Server.
+	Handler http.Handler
+
+	// Server serves the server end of each connection.
+	Server *http2.Server
+
+	// Transport dials the connections. Its DialContext and AllowHTTP
+	// fields are set by NewPipe.
+	Transport *http2.Transport
+
+	// Client sends requests through Transport.
+	Client *http.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup // serving goroutines
+
+	mu     sync.Mutex
+	conns  map[net.Conn]bool // server ends of the open connections
+	closed bool
+}
+
+// NewPipe returns a Pipe serving handler. If srv or tr is nil, a Server
+// or Transport with default settings is used. The Pipe should be closed
+// with Close when no longer needed.
+func NewPipe(handler http.Handler, srv *http2.Server, tr *http2.Transport) *Pipe {
+	if srv == nil {
+		srv = new(http2.Server)
+	}
+	if tr == nil {
+		tr = new(http2.Transport)
+	}
+	p := &Pipe{
+		Handler:   handler,
+		Server:    srv,
+		Transport: tr,
+		Client:    &http.Client{Transport: tr},
+		conns:     make(map[net.Conn]bool),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	tr.AllowHTTP = true
+	tr.DialContext = p.dial
+	return p
+}
+
+var errClosed = errors.New("http2test: Pipe closed")
+
+func (p *Pipe) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, server := newConnPair()
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errClosed
+	}
+	p.conns[server] = true
+	p.wg.Add(1)
+	p.mu.Unlock()
+	go func() {
+		defer p.wg.Done()
+		p.Server.ServeConn(server, &http2.ServeConnOpts{
+			Context: p.ctx,
+			Handler: p.Handler,
+		})
+		server.Close()
+		p.mu.Lock()
+		delete(p.conns, server)
+		p.mu.Unlock()
+	}()
+	return client, nil
+}
+
+// Close closes the connections and waits for the server to be done
+// with them. Requests in flight fail.
+func (p *Pipe) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	conns := make([]net.Conn, 0, len(p.conns))
+	for c := range p.conns {
+		conns = append(conns, c)
+	}
+	p.mu.Unlock()
+	p.Transport.CloseIdleConnections()
+	p.cancel()
+	for _, c := range conns {
+		c.Close()
+	}
+	p.wg.Wait()
+	return nil
+}
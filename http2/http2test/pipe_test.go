@@ -0,0 +1,177 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+func TestPipeRoundTrip(t *testing.T) {
+	p := NewPipe(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading request body: %v", err)
+		}
+		w.Header().Set("X-Proto", r.Proto)
+		w.Write([]byte(r.Method + " " + r.URL.Path + " " + string(body)))
+	}), nil, nil)
+	defer p.Close()
+
+	res, err := p.Client.Post(URL+"/echo", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(body), "POST /echo hello"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	if got := res.Header.Get("X-Proto"); got != "HTTP/2.0" {
+		t.Errorf("request proto = %q, want HTTP/2.0", got)
+	}
+}
+
+func TestPipeLargeBodies(t *testing.T) {
+	// Bodies larger than the flow-control windows need both endpoints
+	// to write concurrently.
+	const size = 4 << 20
+	p := NewPipe(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}), nil, nil)
+	defer p.Close()
+
+	want := bytes.Repeat([]byte("0123456789abcdef"), size/16)
+	res, err := p.Client.Post(URL, "application/octet-stream", bytes.NewReader(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	got, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("echoed %d bytes, want the %d bytes sent", len(got), len(want))
+	}
+}
+
+func TestPipeClose(t *testing.T) {
+	p := NewPipe(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), nil, nil)
+	res, err := p.Client.Get(URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	p.Close()
+	if _, err := p.Client.Get(URL); err == nil {
+		t.Errorf("request after Close succeeded")
+	}
+}
+
+// A latencyConn delays the data written to it by a fixed amount before
+// passing it on to the underlying connection, as a long link would.
+type latencyConn struct {
+	net.Conn
+	delay time.Duration
+	q     chan latencyPacket
+
+	mu     sync.Mutex
+	closed bool
+}
+
+type latencyPacket struct {
+	due  time.Time
+	data []byte
+}
+
+func newLatencyConn(c net.Conn, delay time.Duration) *latencyConn {
+	lc := &latencyConn{Conn: c, delay: delay, q: make(chan latencyPacket, 1024)}
+	go func() {
+		for p := range lc.q {
+			time.Sleep(time.Until(p.due))
+			lc.Conn.Write(p.data)
+		}
+	}()
+	return lc
+}
+
+func (c *latencyConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	c.q <- latencyPacket{time.Now().Add(c.delay), append([]byte(nil), p...)}
+	return len(p), nil
+}
+
+func (c *latencyConn) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.q)
+	}
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+func TestTransportMaxReceiveBufferPerConnectionLatency(t *testing.T) {
+	// The client's writes, and so its WINDOW_UPDATE frames, take a
+	// round trip to reach the server, which can then send at most one
+	// connection window of data per round trip.
+	const (
+		size  = 1 << 20
+		rtt   = 20 * time.Millisecond
+		small = 64 << 10
+	)
+	download := func(window int32) time.Duration {
+		p := NewPipe(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(make([]byte, size))
+		}), nil, &http2.Transport{MaxReceiveBufferPerConnection: window})
+		defer p.Close()
+		dial := p.Transport.DialContext
+		p.Transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			c, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return newLatencyConn(c, rtt), nil
+		}
+
+		start := time.Now()
+		res, err := p.Client.Get(URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if n, err := io.Copy(io.Discard, res.Body); err != nil || n != size {
+			t.Fatalf("read %v bytes, %v; want %v bytes", n, err, size)
+		}
+		return time.Since(start)
+	}
+
+	slow := download(small)
+	// Delays only add up, so this holds however loaded the machine.
+	if min := (size/small - 1) * rtt; slow < min {
+		t.Errorf("downloading %v bytes with a %v byte window took %v; want at least %v", size, small, slow, min)
+	}
+	fast := download(2 * size)
+	if fast >= slow {
+		t.Errorf("downloading %v bytes took %v with a %v byte window, and %v with a %v byte window; want the larger window to be faster", size, slow, small, fast, 2*size)
+	}
+}
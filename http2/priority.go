@@ -0,0 +1,127 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A StreamPriority holds the priority parameters of a stream in the
+// extensible prioritization scheme of RFC 9218, which replaces the
+// priority tree of RFC 7540. Clients send them in the "priority"
+// request header field, and may change them with PRIORITY_UPDATE
+// frames. A client using this package's Transport sets the header
+// field on each request, for example:
+//
+//	req.Header.Set("Priority", StreamPriority{Urgency: 1}.String())
+//
+// or attaches the priority to the request's context with
+// WithStreamPriority.
+type StreamPriority struct {
+	// Urgency, from 0 to 7, orders responses: those with a lower
+	// urgency are sent first.
+	Urgency uint8
+
+	// Incremental reports whether the client can use the response
+	// as it arrives, so that it may share the connection with other
+	// incremental responses of the same urgency. Other responses are
+	// best sent one at a time.
+	Incremental bool
+}
+
+// DefaultStreamPriority is the priority of a request that carries no
+// priority parameters.
+var DefaultStreamPriority = StreamPriority{Urgency: 3}
+
+// ParseStreamPriority parses the value of a "priority" header field,
+// or the priority field value of a PRIORITY_UPDATE frame: a
+// Structured Fields dictionary (RFC 8941) such as "u=1, i". Parameters
+// that are missing, unknown or invalid keep their default values, as
+// RFC 9218 requires, so ParseStreamPriority never fails.
+func ParseStreamPriority(v string) StreamPriority {
+	p := DefaultStreamPriority
+	for _, member := range strings.Split(v, ",") {
+		if i := strings.IndexByte(member, ';'); i >= 0 {
+			member = member[:i] // parameters are not used
+		}
+		member = strings.Trim(member, " \t")
+		key, val := member, ""
+		hasVal := false
+		if i := strings.IndexByte(member, '='); i >= 0 {
+			key, val, hasVal = member[:i], member[i+1:], true
+		}
+		switch key {
+		case "u":
+			if len(val) == 1 && val[0] >= '0' && val[0] <= '7' {
+				p.Urgency = val[0] - '0'
+			}
+		case "i":
+			switch {
+			case !hasVal, val == "?1":
+				p.Incremental = true
+			case val == "?0":
+				p.Incremental = false
+			}
+		}
+	}
+	return p
+}
+
+// String returns p as the value of a "priority" header field, leaving
+// out parameters that have their default value. The value for
+// DefaultStreamPriority is empty.
+func (p StreamPriority) String() string {
+	var s string
+	if p.Urgency != DefaultStreamPriority.Urgency {
+		s = "u=" + strconv.Itoa(int(p.Urgency))
+	}
+	if p.Incremental {
+		if s != "" {
+			s += ", "
+		}
+		s += "i"
+	}
+	return s
+}
+
+type streamPriorityKey struct{}
+
+// WithStreamPriority returns a copy of ctx carrying priority p for the
+// requests made with it. When the Transport sends such a request, it
+// adds a "priority" header field holding p, which signals the initial
+// priority of the request's stream (RFC 9218, Section 5) and which
+// intermediaries pass on to the origin server. Nothing is added to a
+// request that has a "priority" header field already, or for
+// DefaultStreamPriority.
+//
+// For example, to have a token refresh served ahead of other
+// requests:
+//
+//	ctx := http2.WithStreamPriority(ctx, http2.StreamPriority{Urgency: 0, Incremental: true})
+//	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, body)
+func WithStreamPriority(ctx context.Context, p StreamPriority) context.Context {
+	return context.WithValue(ctx, streamPriorityKey{}, p)
+}
+
+// requestStreamPriority returns the priority WithStreamPriority
+// attached to req, and whether the Transport should send it.
+func requestStreamPriority(req *http.Request) (StreamPriority, bool) {
+	p, ok := req.Context().Value(streamPriorityKey{}).(StreamPriority)
+	if !ok || p == DefaultStreamPriority {
+		return StreamPriority{}, false
+	}
+	for k := range req.Header {
+		if asciiEqualFold(k, "priority") {
+			return StreamPriority{}, false
+		}
+	}
+	if p.Urgency > 7 {
+		p.Urgency = 7
+	}
+	return p, true
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import "testing"
+
+func TestParseStreamPriority(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want StreamPriority
+	}{
+		{"", StreamPriority{Urgency: 3}},
+		{"u=1", StreamPriority{Urgency: 1}},
+		{"i", StreamPriority{Urgency: 3, Incremental: true}},
+		{"u=0, i", StreamPriority{Urgency: 0, Incremental: true}},
+		{"i=?1,u=7", StreamPriority{Urgency: 7, Incremental: true}},
+		{"i, i=?0", StreamPriority{Urgency: 3}},
+		{"u=5;foo=bar, x=1", StreamPriority{Urgency: 5}},
+		{"u=8", StreamPriority{Urgency: 3}},
+		{"u=-1, i=1", StreamPriority{Urgency: 3}},
+		{"u=2,u=4", StreamPriority{Urgency: 4}},
+	} {
+		if got := ParseStreamPriority(tt.in); got != tt.want {
+			t.Errorf("ParseStreamPriority(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStreamPriorityString(t *testing.T) {
+	for _, tt := range []struct {
+		p    StreamPriority
+		want string
+	}{
+		{DefaultStreamPriority, ""},
+		{StreamPriority{Urgency: 1}, "u=1"},
+		{StreamPriority{Urgency: 3, Incremental: true}, "i"},
+		{StreamPriority{Urgency: 0, Incremental: true}, "u=0, i"},
+	} {
+		if got := tt.p.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.p, got, tt.want)
+		}
+		if got := ParseStreamPriority(tt.p.String()); got != tt.p {
+			t.Errorf("ParseStreamPriority(%q) = %+v, want %+v", tt.p.String(), got, tt.p)
+		}
+	}
+}
@@ -45,6 +45,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/http/httpguts"
@@ -57,6 +58,10 @@ const (
 	handlerChunkWriteSize  = 4 << 10
 	defaultMaxStreams      = 250 // TODO: make this 100 as the GFE seems to?
 	maxQueuedControlFrames = 10000
+
+	defaultMaxSettingsPerFrame = 100
+
+	defaultMaxHeaderContinuationFrames = 100
 )
 
 var (
@@ -66,6 +71,10 @@ var (
 	errStreamClosed       = errors.New("http2: stream closed")
 )
 
+// ErrRequestBodyTooLarge is returned by reads of a request body that
+// exceeds Server.MaxRequestBodyBytes.
+var ErrRequestBodyTooLarge = errors.New("http2: request body too large")
+
 var responseWriterStatePool = sync.Pool{
 	New: func() interface{} {
 		rws := &responseWriterState{}
@@ -83,6 +92,14 @@ var (
 )
 
 // Server is an HTTP/2 server.
+//
+// If a handler returns without reading all of the request body, the
+// server ends the response and then resets the stream with a
+// RST_STREAM of NO_ERROR, asking the client to stop sending the body,
+// as allowed by RFC 9113, section 8.1. The body is not drained. The
+// connection-level flow control for unread body data, including data
+// that arrives after the reset, is returned to the client, so the
+// connection remains usable for other streams.
 type Server struct {
 	// MaxHandlers limits the number of http.Handler ServeHTTP goroutines
 	// which may run at a time over all connections.
@@ -111,12 +128,69 @@ type Server struct {
 	// the default value of 4096 is used.
 	MaxEncoderHeaderTableSize uint32
 
+	// DisableHuffmanEncoding, if true, sends the names and values of
+	// response headers as raw literals instead of Huffman-coding them.
+	// This saves CPU time at the cost of larger HEADERS frames; see
+	// hpack.Encoder.SetHuffmanEncoding.
+	DisableHuffmanEncoding bool
+
 	// MaxReadFrameSize optionally specifies the largest frame
 	// this server is willing to read. A valid value is between
 	// 16k and 16M, inclusive. If zero or otherwise invalid, a
 	// default value is used.
 	MaxReadFrameSize uint32
 
+	// ReadBufferSize, if positive, is the size of a buffer through
+	// which each connection is read, so that several small frames can
+	// be read at once. A larger buffer reduces the number of reads on
+	// busy connections, but is held by every connection, even idle
+	// ones. If zero, frames are read from the connection without
+	// buffering, which takes two reads per frame.
+	ReadBufferSize int
+
+	// PoolReadBuffers, if true, reads the payload of each frame into a
+	// buffer taken from a pool shared by all connections, which is
+	// returned to the pool once the frame has been handled. Otherwise,
+	// each connection reads frames into a buffer of its own, which
+	// grows to the largest frame received and is kept for the life of
+	// the connection. Pooling saves memory when there are many
+	// connections, most of them idle, as a connection waiting for a
+	// frame holds no buffer; it costs a pool round trip per frame,
+	// which busy connections with large frames may notice.
+	PoolReadBuffers bool
+
+	// MaxSettingsPerFrame optionally limits the number of settings
+	// a client may send in one SETTINGS frame. A SETTINGS frame
+	// with more settings than this, or with duplicate settings, is
+	// a connection error of type PROTOCOL_ERROR, reported to
+	// CountError as "conn_PROTOCOL_ERROR_settings_big_or_dups".
+	// A SETTINGS frame whose length is not a multiple of six bytes
+	// is always rejected by the Framer with a FRAME_SIZE_ERROR,
+	// reported as "frame_settings_mod_6". If zero, a default of 100
+	// is used.
+	MaxSettingsPerFrame int
+
+	// MaxHeaderContinuationFrames and MaxHeaderBlockSize limit the
+	// header blocks a client may send, to defend against floods of
+	// CONTINUATION frames that cost the server CPU time to decode
+	// even though the headers are then discarded (CVE-2024-27316).
+	// MaxHeaderContinuationFrames limits the number of CONTINUATION
+	// frames following a HEADERS frame, and MaxHeaderBlockSize the
+	// total length of the header block fragments of the HEADERS frame
+	// and its CONTINUATION frames, before HPACK decoding. A client that
+	// exceeds either limit has its connection closed with
+	// ENHANCE_YOUR_CALM, reported to CountError as
+	// "headers_continuation_frames" or "headers_block_size".
+	//
+	// If MaxHeaderContinuationFrames is zero, a default of 100 is
+	// used. If MaxHeaderBlockSize is zero, twice the limit on the
+	// size of the header list, which follows the http.Server's
+	// MaxHeaderBytes, is used. Header lists larger than that limit
+	// but within MaxHeaderBlockSize are still answered with status
+	// 431 without closing the connection.
+	MaxHeaderContinuationFrames int
+	MaxHeaderBlockSize          int
+
 	// PermitProhibitedCipherSuites, if true, permits the use of
 	// cipher suites prohibited by the HTTP/2 spec.
 	PermitProhibitedCipherSuites bool
@@ -126,11 +200,26 @@ type Server struct {
 	// activity for the purposes of IdleTimeout.
 	IdleTimeout time.Duration
 
+	// WriteByteTimeout is the timeout after which a connection is
+	// closed if no data can be written to it. The timeout begins when
+	// data is available to write, and is extended whenever any bytes
+	// are written, so it bounds how long a single write of a frame of
+	// any type may stall on a client that does not read, unlike
+	// IdleTimeout and the http.Server's WriteTimeout. If zero or
+	// negative, there is no timeout.
+	WriteByteTimeout time.Duration
+
 	// MaxUploadBufferPerConnection is the size of the initial flow
 	// control window for each connections. The HTTP/2 spec does not
 	// allow this to be smaller than 65535 or larger than 2^32-1.
 	// If the value is outside this range, a default value will be
 	// used instead.
+	//
+	// It bounds the request body data a connection buffers in total,
+	// while MaxUploadBufferPerStream bounds that of each stream. A
+	// client can upload at most one window per round trip, so uploads
+	// over a long, fast link need a window of at least its
+	// bandwidth-delay product.
 	MaxUploadBufferPerConnection int32
 
 	// MaxUploadBufferPerStream is the size of the initial flow control
@@ -139,8 +228,55 @@ type Server struct {
 	// maximum, a default value will be used instead.
 	MaxUploadBufferPerStream int32
 
+	// MaxRequestBodyBytes, if positive, limits the size of request
+	// bodies. Once the DATA frames of a request exceed it, the stream
+	// is reset with CANCEL, and reading the request body returns
+	// ErrRequestBodyTooLarge after any data received within the limit.
+	// If zero or negative, request bodies are not limited.
+	MaxRequestBodyBytes int64
+
+	// AutoTuneWindow, if true, grows the flow control windows of each
+	// connection to fit its bandwidth-delay product. While request
+	// bodies arrive, the server measures the round-trip time with
+	// PING frames and counts the bytes received during a round trip.
+	// When they fill most of a stream's window, the windows of the
+	// streams, and that of the connection if it is smaller, are
+	// enlarged with WINDOW_UPDATE frames. Windows start at
+	// MaxUploadBufferPerStream and MaxUploadBufferPerConnection and
+	// never shrink.
+	AutoTuneWindow bool
+
+	// MaxAutoTuneWindow limits the windows grown by AutoTuneWindow.
+	// If zero, 16MB is used.
+	MaxAutoTuneWindow int32
+
 	// NewWriteScheduler constructs a write scheduler for a connection.
 	// If nil, a default scheduler is chosen.
+	//
+	// The write scheduler decides which stream is written next when
+	// several have frames ready. The default is
+	// NewPriorityWriteScheduler(nil), which follows the priorities
+	// that clients send as described in RFC 7540, Section 5.3: a
+	// stream is only written when the streams it depends on have
+	// nothing to write, and siblings share the connection in
+	// proportion to their weights. This lets browsers fetch
+	// render-blocking resources first, but a large response can hold
+	// up every stream that depends on it, and the scheduler keeps a
+	// tree of streams per connection.
+	//
+	// NewRandomWriteScheduler ignores priorities: it writes control
+	// frames first and otherwise picks any stream with a frame ready,
+	// one frame at a time. It is cheaper, and interleaves large and
+	// small responses regardless of what the client asked for, which
+	// suits clients that send no or unhelpful priorities, such as
+	// API clients and proxies.
+	//
+	// NewExtensiblePriorityWriteScheduler follows the priorities of
+	// RFC 9218 instead, which current browsers send in the
+	// "priority" request header field. The server passes it the
+	// urgency and incremental parameters of each request, including
+	// changes sent in PRIORITY_UPDATE frames, and responses are sent
+	// in order of urgency.
 	NewWriteScheduler func() WriteScheduler
 
 	// CountError, if non-nil, is called on HTTP/2 server errors.
@@ -149,6 +285,79 @@ type Server struct {
 	// The errType consists of only ASCII word characters.
 	CountError func(errType string)
 
+	// Logger, if non-nil, receives the messages the server logs
+	// instead of the http.Server's ErrorLog or the standard
+	// logger. Each message has the client's address as its
+	// "remote_addr" value.
+	Logger Logger
+
+	// OnFrame, if non-nil, is called with each frame the server
+	// reads from or writes to a connection, for debugging and
+	// tracing. Frames read are reported after they are parsed and
+	// before they are processed; frames written are reported just
+	// before they are written. See FrameRead and FrameWritten.
+	// The frame is a copy: the callback may retain it, and
+	// modifying it has no effect on the connection. OnFrame is called
+	// synchronously from the connection's reading and writing
+	// goroutines, possibly concurrently, and must not block.
+	// When OnFrame is nil, frames are not copied.
+	OnFrame func(dir FrameDirection, f Frame)
+
+	// FlowControlStalled, if non-nil, is called each time a
+	// response body could not be sent for a while because the
+	// client's stream or connection flow-control window was
+	// exhausted, once the window reopens or the stream is closed,
+	// for example by the client resetting it.
+	// It is intended for diagnostics and is called from the
+	// connection's serve loop, so it must not block.
+	FlowControlStalled func(FlowControlStall)
+
+	// AcceptScheme, if non-nil, is called for each request whose
+	// :scheme pseudo-header is neither "http" nor "https", such as
+	// one used by a protocol layered on HTTP/2. If it returns true,
+	// the request is passed to the handler with URL.Scheme set to
+	// the scheme and TLS describing the connection, if it uses TLS.
+	// Otherwise, and for values that are not syntactically valid
+	// URI schemes, the stream is reset with PROTOCOL_ERROR.
+	//
+	// The :scheme is chosen by the client and says nothing about
+	// the transport the request arrived on. Handlers of accepted
+	// schemes must not infer from it that the connection is, or is
+	// not, secure, and should accept only the schemes they
+	// implement.
+	AcceptScheme func(scheme string) bool
+
+	// NewStreamRate, if positive, limits how many streams per
+	// second a client may open on a connection, independently of
+	// how many are open at once. It defends against clients that
+	// open streams and immediately reset them, as in the "Rapid
+	// Reset" attack (CVE-2023-44487).
+	//
+	// New streams are counted with a token bucket which refills at
+	// NewStreamRate tokens per second and holds up to NewStreamBurst
+	// tokens, or, if NewStreamBurst is zero, as many as the maximum
+	// number of concurrent streams per connection. The bucket starts
+	// full. A client that opens a stream when the bucket is empty
+	// has its connection closed with ENHANCE_YOUR_CALM.
+	NewStreamRate  float64
+	NewStreamBurst int
+
+	// EnableExtendedConnect, if true, makes the server advertise
+	// SETTINGS_ENABLE_CONNECT_PROTOCOL and accept the extended
+	// CONNECT requests of RFC 8441. By default, such requests are
+	// refused with a stream error.
+	//
+	// Once enabled, a client may send a CONNECT request with a
+	// :protocol pseudo-header to bootstrap another protocol, such
+	// as WebSockets, over a stream of the connection. Such a request
+	// reaches the handler with Method "CONNECT", its :path in URL
+	// and RequestURI, and the protocol in Header[":protocol"]. The
+	// handler accepts the request by responding with a 2xx status,
+	// after which the request Body and the ResponseWriter carry the
+	// tunneled protocol in each direction; Tunnel combines them, for
+	// this and for plain CONNECT requests.
+	EnableExtendedConnect bool
+
 	// Internal state. This is a pointer (rather than embedded directly)
 	// so that we don't embed a Mutex in this struct, which will make the
 	// struct non-copyable, which might break some callers.
@@ -183,6 +392,20 @@ func (s *Server) maxConcurrentStreams() uint32 {
 	return defaultMaxStreams
 }
 
+func (s *Server) maxSettingsPerFrame() int {
+	if v := s.MaxSettingsPerFrame; v > 0 {
+		return v
+	}
+	return defaultMaxSettingsPerFrame
+}
+
+func (s *Server) maxHeaderContinuationFrames() int {
+	if v := s.MaxHeaderContinuationFrames; v > 0 {
+		return v
+	}
+	return defaultMaxHeaderContinuationFrames
+}
+
 func (s *Server) maxDecoderHeaderTableSize() uint32 {
 	if v := s.MaxDecoderHeaderTableSize; v > 0 {
 		return v
@@ -401,6 +624,13 @@ func (o *ServeConnOpts) handler() http.Handler {
 func (s *Server) ServeConn(c net.Conn, opts *ServeConnOpts) {
 	baseCtx, cancel := serverConnBaseContext(c, opts)
 	defer cancel()
+	hstats := new(headerStats)
+	baseCtx = context.WithValue(baseCtx, headerStatsKey{}, hstats)
+	peerMaxFrameSize := new(int32)
+	*peerMaxFrameSize = initialMaxFrameSize
+	baseCtx = context.WithValue(baseCtx, peerMaxFrameSizeKey{}, peerMaxFrameSize)
+	stats := new(connStats)
+	baseCtx = context.WithValue(baseCtx, connStatsKey{}, stats)
 
 	sc := &serverConn{
 		srv:                         s,
@@ -408,7 +638,7 @@ func (s *Server) ServeConn(c net.Conn, opts *ServeConnOpts) {
 		conn:                        c,
 		baseCtx:                     baseCtx,
 		remoteAddrStr:               c.RemoteAddr().String(),
-		bw:                          newBufferedWriter(c),
+		bw:                          newBufferedWriter(c, s.WriteByteTimeout),
 		handler:                     opts.handler(),
 		streams:                     make(map[uint32]*stream),
 		readFrameCh:                 make(chan readFrameResult),
@@ -424,6 +654,9 @@ func (s *Server) ServeConn(c net.Conn, opts *ServeConnOpts) {
 		serveG:                      newGoroutineLock(),
 		pushEnabled:                 true,
 		sawClientPreface:            opts.SawClientPreface,
+		headerStats:                 hstats,
+		peerMaxFrameSize:            peerMaxFrameSize,
+		stats:                       stats,
 	}
 
 	s.state.registerConn(sc)
@@ -451,13 +684,28 @@ func (s *Server) ServeConn(c net.Conn, opts *ServeConnOpts) {
 	sc.inflow.init(initialWindowSize)
 	sc.hpackEncoder = hpack.NewEncoder(&sc.headerWriteBuf)
 	sc.hpackEncoder.SetMaxDynamicTableSizeLimit(s.maxEncoderHeaderTableSize())
+	sc.hpackEncoder.SetHuffmanEncoding(!s.DisableHuffmanEncoding)
 
-	fr := NewFramer(sc.bw, c)
+	var r io.Reader = c
+	if n := s.ReadBufferSize; n > 0 {
+		r = bufio.NewReaderSize(c, n)
+	}
+	fr := NewFramer(sc.bw, r)
+	fr.poolReadBuf = s.PoolReadBuffers
 	if s.CountError != nil {
 		fr.countError = s.CountError
 	}
+	if s.Logger != nil {
+		fr.debugReadLoggerf = sc.vlogf
+		fr.debugWriteLoggerf = sc.vlogf
+	}
+	fr.onFrame = s.OnFrame
+	fr.headerStats = sc.headerStats
+	fr.stats = sc.stats
 	fr.ReadMetaHeaders = hpack.NewDecoder(s.maxDecoderHeaderTableSize(), nil)
 	fr.MaxHeaderListSize = sc.maxHeaderListSize()
+	fr.maxContinuationFrames = s.maxHeaderContinuationFrames()
+	fr.maxHeaderBlockSize = sc.maxHeaderBlockSize()
 	fr.SetMaxReadFrameSize(s.maxReadFrameSize())
 	sc.framer = fr
 
@@ -565,6 +813,8 @@ type serverConn struct {
 	serveMsgCh       chan interface{}       // misc messages & code to send to / run on the serve loop
 	flow             outflow                // conn-wide (not stream-specific) outbound flow control
 	inflow           inflow                 // conn-wide inbound flow control
+	connRecvWindow   int32                  // size of the inflow window
+	bdp              *bdpEstimator          // nil unless Server.AutoTuneWindow
 	tlsState         *tls.ConnectionState   // shared by all handlers, like net/http
 	remoteAddrStr    string
 	writeSched       WriteScheduler
@@ -599,14 +849,62 @@ type serverConn struct {
 	shutdownTimer               *time.Timer // nil until used
 	idleTimer                   *time.Timer // nil if unused
 
+	// Token bucket for Server.NewStreamRate.
+	newStreamTokens     float64
+	newStreamTokensTime time.Time // when newStreamTokens was last refilled; zero before the first stream
+
+	// Priorities from PRIORITY_UPDATE frames for idle streams.
+	pendingPriorities map[uint32]StreamPriority
+
 	// Owned by the writeFrameAsync goroutine:
 	headerWriteBuf bytes.Buffer
 	hpackEncoder   *hpack.Encoder
 
+	headerStats      *headerStats // see ConnHeaderStats; safe for concurrent use
+	peerMaxFrameSize *int32       // atomic copy of maxFrameSize; see ConnPeerMaxFrameSize
+	stats            *connStats   // see ConnStats; safe for concurrent use
+
+	pushDisabled int32 // atomic; 1 once pushEnabled is false, for PushController
+
 	// Used by startGracefulShutdown.
 	shutdownOnce sync.Once
 }
 
+// allowNewStream reports whether the client may open another stream
+// under Server.NewStreamRate, and takes a token from the bucket if so.
+func (sc *serverConn) allowNewStream() bool {
+	rate := sc.srv.NewStreamRate
+	if rate <= 0 {
+		return true
+	}
+	burst := float64(sc.srv.NewStreamBurst)
+	if burst <= 0 {
+		burst = float64(sc.advMaxStreams)
+	}
+	now := time.Now()
+	if sc.newStreamTokensTime.IsZero() {
+		sc.newStreamTokens = burst
+	} else {
+		sc.newStreamTokens += now.Sub(sc.newStreamTokensTime).Seconds() * rate
+		if sc.newStreamTokens > burst {
+			sc.newStreamTokens = burst
+		}
+	}
+	sc.newStreamTokensTime = now
+	if sc.newStreamTokens < 1 {
+		return false
+	}
+	sc.newStreamTokens--
+	return true
+}
+
+func (sc *serverConn) maxHeaderBlockSize() int {
+	if v := sc.srv.MaxHeaderBlockSize; v > 0 {
+		return v
+	}
+	return 2 * int(sc.maxHeaderListSize())
+}
+
 func (sc *serverConn) maxHeaderListSize() uint32 {
 	n := sc.hs.MaxHeaderBytes
 	if n <= 0 {
@@ -639,19 +937,24 @@ type stream struct {
 	cw        closeWaiter // closed wait stream transitions to closed state
 	ctx       context.Context
 	cancelCtx func()
+	peerReset peerReset // set before ctx is canceled by a client's RST_STREAM
 
 	// owned by serverConn's serve loop:
 	bodyBytes        int64   // body bytes seen so far
 	declBodyBytes    int64   // or -1 if undeclared
 	flow             outflow // limits writing from Handler to client
 	inflow           inflow  // what the client is allowed to POST/etc to us
+	recvWindow       int32   // size of the inflow window
 	state            streamState
 	resetQueued      bool        // RST_STREAM queued for write; set by sc.resetStream
 	gotTrailerHeader bool        // HEADER frame for trailers was seen
+	halfClose        bool        // set by CloseWrite of a Tunnel before its END_STREAM is sent; keeps the stream readable
 	wroteHeaders     bool        // whether we wrote headers (not status 100)
 	readDeadline     *time.Timer // nil if unused
 	writeDeadline    *time.Timer // nil if unused
 	closeErr         error       // set before cw is closed
+	flowStall        FlowControlStall
+	flowStallStart   time.Time // zero unless blocked on flow control
 
 	trailer    http.Header // accumulated trailers
 	reqTrailer http.Header // handler's Request.Trailer
@@ -663,6 +966,7 @@ func (sc *serverConn) Flush() error     { return sc.bw.Flush() }
 func (sc *serverConn) HeaderEncoder() (*hpack.Encoder, *bytes.Buffer) {
 	return sc.hpackEncoder, &sc.headerWriteBuf
 }
+func (sc *serverConn) countSentHeaders(raw, encoded int) { sc.headerStats.sent(raw, encoded) }
 
 func (sc *serverConn) state(streamID uint32) (streamState, *stream) {
 	sc.serveG.check()
@@ -699,11 +1003,19 @@ func (sc *serverConn) setConnState(state http.ConnState) {
 
 func (sc *serverConn) vlogf(format string, args ...interface{}) {
 	if VerboseLogs {
-		sc.logf(format, args...)
+		sc.log(LogLevelDebug, format, args...)
 	}
 }
 
 func (sc *serverConn) logf(format string, args ...interface{}) {
+	sc.log(LogLevelError, format, args...)
+}
+
+func (sc *serverConn) log(level LogLevel, format string, args ...interface{}) {
+	if lg := sc.srv.Logger; lg != nil {
+		lg.Log(level, fmt.Sprintf(format, args...), "remote_addr", sc.remoteAddrStr)
+		return
+	}
 	if lg := sc.hs.ErrorLog; lg != nil {
 		lg.Printf(format, args...)
 	} else {
@@ -894,15 +1206,17 @@ func (sc *serverConn) serve() {
 		sc.vlogf("http2: server connection from %v on %p", sc.conn.RemoteAddr(), sc.hs)
 	}
 
-	sc.writeFrame(FrameWriteRequest{
-		write: writeSettings{
-			{SettingMaxFrameSize, sc.srv.maxReadFrameSize()},
-			{SettingMaxConcurrentStreams, sc.advMaxStreams},
-			{SettingMaxHeaderListSize, sc.maxHeaderListSize()},
-			{SettingHeaderTableSize, sc.srv.maxDecoderHeaderTableSize()},
-			{SettingInitialWindowSize, uint32(sc.srv.initialStreamRecvWindowSize())},
-		},
-	})
+	settings := writeSettings{
+		{SettingMaxFrameSize, sc.srv.maxReadFrameSize()},
+		{SettingMaxConcurrentStreams, sc.advMaxStreams},
+		{SettingMaxHeaderListSize, sc.maxHeaderListSize()},
+		{SettingHeaderTableSize, sc.srv.maxDecoderHeaderTableSize()},
+		{SettingInitialWindowSize, uint32(sc.srv.initialStreamRecvWindowSize())},
+	}
+	if sc.srv.EnableExtendedConnect {
+		settings = append(settings, Setting{SettingEnableConnectProtocol, 1})
+	}
+	sc.writeFrame(FrameWriteRequest{write: settings})
 	sc.unackedSettings++
 
 	// Each connection starts with initialWindowSize inflow tokens.
@@ -910,6 +1224,10 @@ func (sc *serverConn) serve() {
 	if diff := sc.srv.initialConnRecvWindowSize() - initialWindowSize; diff > 0 {
 		sc.sendWindowUpdate(nil, int(diff))
 	}
+	sc.connRecvWindow = sc.srv.initialConnRecvWindowSize()
+	if sc.srv.AutoTuneWindow {
+		sc.bdp = newBDPEstimator(sc.srv.initialStreamRecvWindowSize(), sc.srv.MaxAutoTuneWindow)
+	}
 
 	if err := sc.readPreface(); err != nil {
 		sc.condlogf(err, "http2: server: error reading preface from client %v: %v", sc.conn.RemoteAddr(), err)
@@ -1293,6 +1611,12 @@ func (sc *serverConn) wroteFrame(res frameWriteResult) {
 		}
 		switch st.state {
 		case stateOpen:
+			if st.halfClose {
+				// The handler of a tunnel closed only its side
+				// of the stream and goes on reading.
+				st.state = stateHalfClosedLocal
+				break
+			}
 			// Here we would go to stateHalfClosedLocal in
 			// theory, but since our handler is done and
 			// the net/http package provides no mechanism
@@ -1538,6 +1862,8 @@ func (sc *serverConn) processFrame(f Frame) error {
 		return sc.processResetStream(f)
 	case *PriorityFrame:
 		return sc.processPriority(f)
+	case *PriorityUpdateFrame:
+		return sc.processPriorityUpdate(f)
 	case *GoAwayFrame:
 		return sc.processGoAway(f)
 	case *PushPromiseFrame:
@@ -1555,6 +1881,9 @@ func (sc *serverConn) processPing(f *PingFrame) error {
 	if f.IsAck() {
 		// 6.7 PING: " An endpoint MUST NOT respond to PING frames
 		// containing this flag."
+		if sc.bdp != nil && f.Data == bdpPingData {
+			sc.processBDPPingAck()
+		}
 		return nil
 	}
 	if f.StreamID != 0 {
@@ -1614,12 +1943,97 @@ func (sc *serverConn) processResetStream(f *RSTStreamFrame) error {
 		return sc.countError("reset_idle_stream", ConnectionError(ErrCodeProtocol))
 	}
 	if st != nil {
+		serr := streamError(f.StreamID, f.ErrCode)
+		st.peerReset.set(serr)
 		st.cancelCtx()
-		sc.closeStream(st, streamError(f.StreamID, f.ErrCode))
+		sc.closeStream(st, serr)
 	}
 	return nil
 }
 
+// peerResetKey is the context key for a stream's *peerReset.
+type peerResetKey struct{}
+
+// A peerReset records the RST_STREAM frame a client sent for a stream.
+type peerReset struct {
+	mu  sync.Mutex
+	err StreamError
+	ok  bool
+}
+
+func (r *peerReset) set(err StreamError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err, r.ok = err, true
+}
+
+// StreamResetError reports whether the client reset the stream of the
+// request whose context is ctx with a RST_STREAM frame, and if so
+// returns a StreamError holding the frame's error code.
+//
+// A client's RST_STREAM cancels the request's context as soon as the
+// server reads the frame, so a handler can stop work on an abandoned
+// request right away, and call StreamResetError once the context is
+// done to learn why: for example, ErrCodeCancel when the client is no
+// longer interested in the response. The result is false if the context was canceled
+// for another reason, or if ctx is not the context of a request
+// served by this package.
+func StreamResetError(ctx context.Context) (StreamError, bool) {
+	r, _ := ctx.Value(peerResetKey{}).(*peerReset)
+	if r == nil {
+		return StreamError{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err, r.ok
+}
+
+type headerStatsKey struct{}
+
+// ConnHeaderStats returns the raw and HPACK-encoded sizes of the
+// headers sent and received so far on the HTTP/2 connection carrying
+// the request whose context is ctx. It reports false if ctx is not
+// the context of a request served by this package.
+func ConnHeaderStats(ctx context.Context) (HeaderStats, bool) {
+	s, _ := ctx.Value(headerStatsKey{}).(*headerStats)
+	if s == nil {
+		return HeaderStats{}, false
+	}
+	return s.snapshot(), true
+}
+
+type connStatsKey struct{}
+
+// ConnStats returns the counters of the traffic so far on the HTTP/2
+// connection carrying the request whose context is ctx. It reports
+// false if ctx is not the context of a request served by this
+// package.
+func ConnStats(ctx context.Context) (Stats, bool) {
+	s, _ := ctx.Value(connStatsKey{}).(*connStats)
+	if s == nil {
+		return Stats{}, false
+	}
+	return s.snapshot(), true
+}
+
+type peerMaxFrameSizeKey struct{}
+
+// ConnPeerMaxFrameSize returns the largest frame payload that the
+// client of the HTTP/2 connection carrying the request whose context
+// is ctx accepts, as advertised by its SETTINGS_MAX_FRAME_SIZE. The
+// server writes DATA frames of up to this size, as allowed by flow
+// control and by the size of the handler's writes. It is 16384, the
+// protocol default, until the client advertises another value.
+// ConnPeerMaxFrameSize reports false if ctx is not the context of a
+// request served by this package.
+func ConnPeerMaxFrameSize(ctx context.Context) (uint32, bool) {
+	p, _ := ctx.Value(peerMaxFrameSizeKey{}).(*int32)
+	if p == nil {
+		return 0, false
+	}
+	return uint32(atomic.LoadInt32(p)), true
+}
+
 func (sc *serverConn) closeStream(st *stream, err error) {
 	sc.serveG.check()
 	if st.state == stateIdle || st.state == stateClosed {
@@ -1664,6 +2078,8 @@ func (sc *serverConn) closeStream(st *stream, err error) {
 	st.closeErr = err
 	st.cw.Close() // signals Handler's CloseNotifier, unblocks writes, etc
 	sc.writeSched.CloseStream(st.id)
+	// Report a stall cut short by a reset or a closed connection.
+	st.endFlowStall()
 }
 
 func (sc *serverConn) processSettings(f *SettingsFrame) error {
@@ -1678,7 +2094,7 @@ func (sc *serverConn) processSettings(f *SettingsFrame) error {
 		}
 		return nil
 	}
-	if f.NumSettings() > 100 || f.HasDuplicates() {
+	if f.NumSettings() > sc.srv.maxSettingsPerFrame() || f.HasDuplicates() {
 		// This isn't actually in the spec, but hang up on
 		// suspiciously large settings frames or those with
 		// duplicate entries.
@@ -1706,13 +2122,14 @@ func (sc *serverConn) processSetting(s Setting) error {
 	case SettingHeaderTableSize:
 		sc.hpackEncoder.SetMaxDynamicTableSize(s.Val)
 	case SettingEnablePush:
-		sc.pushEnabled = s.Val != 0
+		sc.setPushEnabled(s.Val != 0)
 	case SettingMaxConcurrentStreams:
 		sc.clientMaxStreams = s.Val
 	case SettingInitialWindowSize:
 		return sc.processSettingInitialWindowSize(s.Val)
 	case SettingMaxFrameSize:
 		sc.maxFrameSize = int32(s.Val) // the maximum valid s.Val is < 2^31
+		atomic.StoreInt32(sc.peerMaxFrameSize, sc.maxFrameSize)
 	case SettingMaxHeaderListSize:
 		sc.peerMaxHeaderListSize = s.Val
 	default:
@@ -1777,12 +2194,13 @@ func (sc *serverConn) processData(f *DataFrame) error {
 	// "If a DATA frame is received whose stream is not in "open"
 	// or "half closed (local)" state, the recipient MUST respond
 	// with a stream error (Section 5.4.2) of type STREAM_CLOSED."
-	if st == nil || state != stateOpen || st.gotTrailerHeader || st.resetQueued {
+	readable := state == stateOpen || state == stateHalfClosedLocal && st.halfClose
+	if st == nil || !readable || st.gotTrailerHeader || st.resetQueued {
 		// This includes sending a RST_STREAM if the stream is
-		// in stateHalfClosedLocal (which currently means that
-		// the http.Handler returned, so it's done reading &
-		// done writing). Try to stop the client from sending
-		// more DATA.
+		// in stateHalfClosedLocal (which, unless a tunnel's
+		// CloseWrite was called, means that the http.Handler
+		// returned, so it's done reading & done writing). Try
+		// to stop the client from sending more DATA.
 
 		// But still enforce their connection-level flow control,
 		// and return any flow control bytes since we're not going
@@ -1815,11 +2233,26 @@ func (sc *serverConn) processData(f *DataFrame) error {
 		// DATA frame payload lengths that form the body.
 		return sc.countError("send_too_much", streamError(id, ErrCodeProtocol))
 	}
+	if max := sc.srv.MaxRequestBodyBytes; max > 0 && st.bodyBytes+int64(len(data)) > max {
+		if !sc.inflow.take(f.Length) {
+			return sc.countError("data_flow", streamError(id, ErrCodeFlowControl))
+		}
+		sc.sendWindowUpdate(nil, int(f.Length)) // conn-level
+
+		st.body.CloseWithError(ErrRequestBodyTooLarge)
+		return sc.countError("body_too_large", streamError(id, ErrCodeCancel))
+	}
 	if f.Length > 0 {
 		// Check whether the client has flow control quota.
 		if !takeInflows(&sc.inflow, &st.inflow, f.Length) {
 			return sc.countError("flow_on_data_length", streamError(id, ErrCodeFlowControl))
 		}
+		if sc.bdp != nil {
+			if sc.bdp.received(f.Length, time.Now()) {
+				sc.writeFrame(FrameWriteRequest{write: writePing{bdpPingData}})
+			}
+			sc.growRecvWindow(st)
+		}
 
 		if len(data) > 0 {
 			st.bodyBytes += int64(len(data))
@@ -1861,10 +2294,21 @@ func (sc *serverConn) processGoAway(f *GoAwayFrame) error {
 	sc.startGracefulShutdownInternal()
 	// http://tools.ietf.org/html/rfc7540#section-6.8
 	// We should not create any new streams, which means we should disable push.
-	sc.pushEnabled = false
+	sc.setPushEnabled(false)
 	return nil
 }
 
+// setPushEnabled records whether the client accepts pushed streams.
+func (sc *serverConn) setPushEnabled(v bool) {
+	sc.serveG.check()
+	sc.pushEnabled = v
+	var disabled int32
+	if !v {
+		disabled = 1
+	}
+	atomic.StoreInt32(&sc.pushDisabled, disabled)
+}
+
 // isPushed reports whether the stream is server-initiated.
 func (st *stream) isPushed() bool {
 	return st.id%2 == 0
@@ -1883,6 +2327,11 @@ func (st *stream) endStream() {
 		st.body.closeWithErrorAndCode(io.EOF, st.copyTrailersToHandlerRequest)
 		st.body.CloseWithError(io.EOF)
 	}
+	if st.state == stateHalfClosedLocal {
+		// A tunnel whose handler already ended its side.
+		sc.closeStream(st, errHandlerComplete)
+		return
+	}
 	st.state = stateHalfClosedRemote
 }
 
@@ -1915,6 +2364,27 @@ func (st *stream) onWriteTimeout() {
 	}})
 }
 
+// noteFlowStall records that st has DATA queued but no flow-control
+// window to send it in, if the Server wants to know.
+func (st *stream) noteFlowStall() {
+	if !st.flowStallStart.IsZero() || st.sc.srv == nil || st.sc.srv.FlowControlStalled == nil {
+		return
+	}
+	st.flowStallStart = time.Now()
+	st.flowStall = FlowControlStall{StreamID: st.id, Conn: st.flow.connStalled()}
+}
+
+// endFlowStall reports the stall recorded by noteFlowStall, if any,
+// now that st can send DATA again or has been closed.
+func (st *stream) endFlowStall() {
+	if st.flowStallStart.IsZero() {
+		return
+	}
+	st.flowStall.Duration = time.Since(st.flowStallStart)
+	st.flowStallStart = time.Time{}
+	st.sc.srv.FlowControlStalled(st.flowStall)
+}
+
 func (sc *serverConn) processHeaders(f *MetaHeadersFrame) error {
 	sc.serveG.check()
 	id := f.StreamID
@@ -1954,6 +2424,9 @@ func (sc *serverConn) processHeaders(f *MetaHeadersFrame) error {
 	if id <= sc.maxClientStreamID {
 		return sc.countError("stream_went_down", ConnectionError(ErrCodeProtocol))
 	}
+	if !sc.allowNewStream() {
+		return sc.countError("new_stream_rate", ConnectionError(ErrCodeEnhanceYourCalm))
+	}
 	sc.maxClientStreamID = id
 
 	if sc.idleTimer != nil {
@@ -1996,6 +2469,9 @@ func (sc *serverConn) processHeaders(f *MetaHeadersFrame) error {
 	if err != nil {
 		return err
 	}
+	if ps, ok := sc.writeSched.(StreamPriorityScheduler); ok {
+		ps.AdjustStreamPriority(st.id, sc.requestPriority(id, req.Header))
+	}
 	st.reqTrailer = req.Trailer
 	if st.reqTrailer != nil {
 		st.trailer = make(http.Header)
@@ -2098,24 +2574,73 @@ func (sc *serverConn) processPriority(f *PriorityFrame) error {
 	return nil
 }
 
+// processPriorityUpdate passes the priority of a PRIORITY_UPDATE frame
+// to the write scheduler, if it implements StreamPriorityScheduler.
+func (sc *serverConn) processPriorityUpdate(f *PriorityUpdateFrame) error {
+	sc.serveG.check()
+	ps, ok := sc.writeSched.(StreamPriorityScheduler)
+	if !ok {
+		return nil
+	}
+	id := f.PrioritizedStreamID
+	p := ParseStreamPriority(f.Priority)
+	switch state, _ := sc.state(id); state {
+	case stateIdle:
+		// RFC 9218, Section 7.1: a PRIORITY_UPDATE may arrive before
+		// the request. Remember its priority until then, for a
+		// limited number of streams.
+		if id%2 == 0 || len(sc.pendingPriorities) >= int(sc.advMaxStreams) {
+			return nil
+		}
+		if sc.pendingPriorities == nil {
+			sc.pendingPriorities = make(map[uint32]StreamPriority)
+		}
+		sc.pendingPriorities[id] = p
+	case stateClosed:
+	default:
+		ps.AdjustStreamPriority(id, p)
+	}
+	return nil
+}
+
+// requestPriority returns the priority of the request opening stream
+// id: that of a PRIORITY_UPDATE frame received before the request, if
+// any, or else that of the request's "priority" header fields.
+func (sc *serverConn) requestPriority(id uint32, header http.Header) StreamPriority {
+	sc.serveG.check()
+	p, ok := sc.pendingPriorities[id]
+	for pid := range sc.pendingPriorities {
+		if pid <= id {
+			// Streams below id are now closed.
+			delete(sc.pendingPriorities, pid)
+		}
+	}
+	if ok {
+		return p
+	}
+	return ParseStreamPriority(strings.Join(header.Values("Priority"), ","))
+}
+
 func (sc *serverConn) newStream(id, pusherID uint32, state streamState) *stream {
 	sc.serveG.check()
 	if id == 0 {
 		panic("internal error: cannot create stream with id 0")
 	}
 
+	sc.stats.openedStream()
 	ctx, cancelCtx := context.WithCancel(sc.baseCtx)
 	st := &stream{
 		sc:        sc,
 		id:        id,
 		state:     state,
-		ctx:       ctx,
 		cancelCtx: cancelCtx,
 	}
+	st.ctx = context.WithValue(ctx, peerResetKey{}, &st.peerReset)
 	st.cw.Init()
 	st.flow.conn = &sc.flow // link to conn-level counter
 	st.flow.add(sc.initialStreamSendWindowSize)
 	st.inflow.init(sc.srv.initialStreamRecvWindowSize())
+	st.recvWindow = sc.srv.initialStreamRecvWindowSize()
 	if sc.hs.WriteTimeout != 0 {
 		st.writeDeadline = time.AfterFunc(sc.hs.WriteTimeout, st.onWriteTimeout)
 	}
@@ -2142,14 +2667,21 @@ func (sc *serverConn) newWriterAndRequest(st *stream, f *MetaHeadersFrame) (*res
 		scheme:    f.PseudoValue("scheme"),
 		authority: f.PseudoValue("authority"),
 		path:      f.PseudoValue("path"),
+		protocol:  f.PseudoValue("protocol"),
 	}
 
 	isConnect := rp.method == "CONNECT"
-	if isConnect {
+	if rp.protocol != "" && (!isConnect || !sc.srv.EnableExtendedConnect) {
+		// RFC 8441, section 4: the :protocol pseudo-header is only
+		// valid in CONNECT requests, and only once the server has
+		// sent SETTINGS_ENABLE_CONNECT_PROTOCOL.
+		return nil, nil, sc.countError("bad_protocol", streamError(f.StreamID, ErrCodeProtocol))
+	}
+	if isConnect && rp.protocol == "" {
 		if rp.path != "" || rp.scheme != "" || rp.authority == "" {
 			return nil, nil, sc.countError("bad_connect", streamError(f.StreamID, ErrCodeProtocol))
 		}
-	} else if rp.method == "" || rp.path == "" || (rp.scheme != "https" && rp.scheme != "http") {
+	} else if rp.method == "" || rp.path == "" || !sc.acceptScheme(rp.scheme) {
 		// See 8.1.2.6 Malformed Requests and Responses:
 		//
 		// Malformed requests or responses that are detected
@@ -2170,6 +2702,9 @@ func (sc *serverConn) newWriterAndRequest(st *stream, f *MetaHeadersFrame) (*res
 	if rp.authority == "" {
 		rp.authority = rp.header.Get("Host")
 	}
+	if rp.protocol != "" {
+		rp.header[":protocol"] = []string{rp.protocol}
+	}
 
 	rw, req, err := sc.newWriterAndRequestNoBody(st, rp)
 	if err != nil {
@@ -2193,9 +2728,40 @@ func (sc *serverConn) newWriterAndRequest(st *stream, f *MetaHeadersFrame) (*res
 	return rw, req, nil
 }
 
+// acceptScheme reports whether the server handles requests with the
+// given :scheme.
+func (sc *serverConn) acceptScheme(scheme string) bool {
+	switch scheme {
+	case "http", "https":
+		return true
+	}
+	return sc.srv.AcceptScheme != nil && validURIScheme(scheme) && sc.srv.AcceptScheme(scheme)
+}
+
+// validURIScheme reports whether s is a URI scheme, as defined by
+// RFC 3986, section 3.1:
+//
+//	scheme = ALPHA *( ALPHA / DIGIT / "+" / "-" / "." )
+func validURIScheme(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 type requestParam struct {
 	method                  string
 	scheme, authority, path string
+	protocol                string // :protocol of an extended CONNECT request
 	header                  http.Header
 }
 
@@ -2237,7 +2803,7 @@ func (sc *serverConn) newWriterAndRequestNoBody(st *stream, rp requestParam) (*r
 
 	var url_ *url.URL
 	var requestURI string
-	if rp.method == "CONNECT" {
+	if rp.method == "CONNECT" && rp.protocol == "" {
 		url_ = &url.URL{Host: rp.authority}
 		requestURI = rp.authority // mimic HTTP/1 server behavior
 	} else {
@@ -2247,6 +2813,11 @@ func (sc *serverConn) newWriterAndRequestNoBody(st *stream, rp requestParam) (*r
 			return nil, nil, sc.countError("bad_path", streamError(st.id, ErrCodeProtocol))
 		}
 		requestURI = rp.path
+		if rp.scheme != "http" && rp.scheme != "https" {
+			// A scheme allowed by Server.AcceptScheme.
+			url_.Scheme = rp.scheme
+			tlsState = sc.tlsState
+		}
 	}
 
 	body := &requestBody{
@@ -2396,6 +2967,36 @@ func (sc *serverConn) noteBodyRead(st *stream, n int) {
 	}
 }
 
+// processBDPPingAck handles the acknowledgement of a PING sent to
+// estimate the bandwidth-delay product, growing the receive windows
+// if the estimate grew.
+func (sc *serverConn) processBDPPingAck() {
+	sc.serveG.check()
+	if sc.bdp.acked(time.Now()) == 0 {
+		return
+	}
+	for _, st := range sc.streams {
+		if st.state == stateOpen && !st.gotTrailerHeader && !st.resetQueued {
+			sc.growRecvWindow(st)
+		}
+	}
+}
+
+// growRecvWindow enlarges the receive windows of st and of the
+// connection to the window estimated by sc.bdp.
+func (sc *serverConn) growRecvWindow(st *stream) {
+	sc.serveG.check()
+	w := sc.bdp.window
+	if diff := w - sc.connRecvWindow; diff > 0 {
+		sc.connRecvWindow = w
+		sc.sendWindowUpdate(nil, int(diff))
+	}
+	if diff := w - st.recvWindow; diff > 0 {
+		st.recvWindow = w
+		sc.sendWindowUpdate(st, int(diff))
+	}
+}
+
 // st may be nil for conn-level
 func (sc *serverConn) sendWindowUpdate32(st *stream, n int32) {
 	sc.sendWindowUpdate(st, int(n))
@@ -2494,8 +3095,10 @@ type responseWriterState struct {
 	status        int         // status code passed to WriteHeader
 	wroteHeader   bool        // WriteHeader called (explicitly or implicitly). Not necessarily sent to user yet.
 	sentHeader    bool        // have we sent the header frame?
-	handlerDone   bool        // handler has finished
+	handlerDone   bool        // handler has finished or called FlushTrailers
+	ended         bool        // FlushTrailers ended the response
 	dirty         bool        // a Write failed; don't reuse this responseWriterState
+	noPush        bool        // DisablePush called
 
 	sentContentLen int64 // non-zero if handler set a Content-Length header
 	wroteBytes     int64
@@ -2760,15 +3363,26 @@ func (w *responseWriter) SetWriteDeadline(deadline time.Time) error {
 	return nil
 }
 
+// Flush implements http.Flusher. It is FlushError, ignoring the error.
 func (w *responseWriter) Flush() {
 	w.FlushError()
 }
 
+// FlushError sends the response header, if not yet sent, and any
+// buffered response body to the client without waiting for the
+// handler to return, as needed for server-sent events and other
+// streamed responses. Buffered data is sent as DATA frames as soon as
+// the client's flow-control window allows; FlushError blocks until
+// then. It returns an error if the stream or connection closed first.
+// It is used by http.ResponseController.
 func (w *responseWriter) FlushError() error {
 	rws := w.rws
 	if rws == nil {
 		panic("Header called after Handler finished")
 	}
+	if rws.ended {
+		return nil
+	}
 	var err error
 	if rws.bw.Buffered() > 0 {
 		err = rws.bw.Flush()
@@ -2916,6 +3530,9 @@ func (w *responseWriter) write(lenData int, dataB []byte, dataS string) (n int,
 	if rws == nil {
 		panic("Write called after Handler finished")
 	}
+	if rws.ended {
+		return 0, errResponseEnded
+	}
 	if !rws.wroteHeader {
 		w.WriteHeader(200)
 	}
@@ -2939,7 +3556,16 @@ func (w *responseWriter) handlerDone() {
 	rws := w.rws
 	dirty := rws.dirty
 	rws.handlerDone = true
-	w.Flush()
+	if !rws.ended {
+		w.Flush()
+	} else if rws.stream.halfClose {
+		// The handler of a tunnel returned after CloseWrite, so
+		// stop the client from sending more, as is done once a
+		// response ends before the request.
+		rws.dirty = true
+		dirty = true
+		rws.conn.resetStreamFromHandler(rws.stream, ErrCodeNo)
+	}
 	w.rws = nil
 	if !dirty {
 		// Only recycle the pool if all prior Write calls to
@@ -2952,12 +3578,359 @@ func (w *responseWriter) handlerDone() {
 	}
 }
 
+// A TrailerFlusher ends a response with its trailers before the
+// handler returns. The http.ResponseWriter passed to a Server's
+// Handlers implements it.
+//
+// HTTP/2 sends trailers in a single HEADERS frame that ends the
+// stream, after the last DATA frame, so trailers cannot be sent in
+// the middle of a response: per-message metadata of a streaming
+// response has to be carried in the body. What FlushTrailers offers
+// is choosing when that final frame is sent, so that the client sees
+// the complete response while the handler goes on, for example to
+// clean up or record the outcome.
+type TrailerFlusher interface {
+	// FlushTrailers sends the response header, if not yet sent, and
+	// any buffered body, followed by the trailers set so far, and
+	// ends the stream. Trailers are set as when the handler returns:
+	// in the Header map, either under names declared in the
+	// "Trailer" header or with the TrailerPrefix prefix.
+	//
+	// After FlushTrailers, the response is complete: Write fails,
+	// Flush does nothing, and changes to the Header map are ignored.
+	// As when the handler returns, the stream is closed, so any part
+	// of the request body not yet received can no longer be read.
+	// FlushTrailers returns an error if the stream or connection
+	// closed first, or if the response was already ended.
+	FlushTrailers() error
+}
+
+var _ TrailerFlusher = (*responseWriter)(nil)
+
+var (
+	errResponseEnded    = errors.New("http2: response already ended by FlushTrailers")
+	errNoTrailerFlusher = errors.New("http2: ResponseWriter does not support FlushTrailers")
+)
+
+// FlushTrailers ends the response written by w with its trailers, as
+// described by TrailerFlusher. If w does not implement TrailerFlusher,
+// it is unwrapped with its Unwrap() http.ResponseWriter method, if
+// any. If no TrailerFlusher is found, FlushTrailers returns an error.
+func FlushTrailers(w http.ResponseWriter) error {
+	for {
+		switch t := w.(type) {
+		case TrailerFlusher:
+			return t.FlushTrailers()
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return errNoTrailerFlusher
+		}
+	}
+}
+
+func (w *responseWriter) FlushTrailers() error {
+	rws := w.rws
+	if rws == nil {
+		panic("FlushTrailers called after Handler finished")
+	}
+	if rws.ended {
+		return errResponseEnded
+	}
+	rws.handlerDone = true
+	err := w.FlushError()
+	rws.ended = true
+	// Ending the stream closes it as if the handler had returned,
+	// which is no error here.
+	if se, ok := err.(StreamError); err == errHandlerComplete || ok && se.Code == ErrCodeNo {
+		err = nil
+	}
+	return err
+}
+
+// A Tunneler gives the handler of a CONNECT request the stream of the
+// request as a bidirectional byte stream, for building proxies. The
+// http.ResponseWriter passed to a Server's Handlers implements it.
+type Tunneler interface {
+	// Tunnel accepts the CONNECT request by sending the response
+	// header, with status 200 unless the handler already called
+	// WriteHeader with a 2xx status, and returns the tunnel.
+	//
+	// Reads return the DATA frames sent by the client, and io.EOF
+	// once it ends the stream. Writes are sent as DATA frames
+	// without buffering, subject to flow control. The tunnel has a
+	// CloseWrite method that ends the stream in the server's
+	// direction while still allowing reads, like
+	// (*net.TCPConn).CloseWrite. Close ends the stream in the
+	// server's direction, if not yet done, and stops reading: if the
+	// client has not ended its side, the stream is reset with
+	// NO_ERROR. Reads may be concurrent with writes, but the tunnel
+	// must not be used after the handler returns.
+	//
+	// Tunnel returns an error if the request is not a CONNECT
+	// request, if the response was already ended or has a non-2xx
+	// status, or if the response header cannot be sent.
+	Tunnel() (io.ReadWriteCloser, error)
+}
+
+var _ Tunneler = (*responseWriter)(nil)
+
+var (
+	errNotConnect  = errors.New("http2: Tunnel called for a request that is not CONNECT")
+	errNotAccepted = errors.New("http2: Tunnel called after a non-2xx response")
+	errNoTunneler  = errors.New("http2: ResponseWriter does not support Tunnel")
+)
+
+// Tunnel returns the tunnel of the CONNECT request whose response is
+// written by w, as described by Tunneler. If w does not implement
+// Tunneler, it is unwrapped with its Unwrap() http.ResponseWriter
+// method, if any. If no Tunneler is found, Tunnel returns an error.
+func Tunnel(w http.ResponseWriter) (io.ReadWriteCloser, error) {
+	for {
+		switch t := w.(type) {
+		case Tunneler:
+			return t.Tunnel()
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return nil, errNoTunneler
+		}
+	}
+}
+
+func (w *responseWriter) Tunnel() (io.ReadWriteCloser, error) {
+	rws := w.rws
+	if rws == nil {
+		panic("Tunnel called after Handler finished")
+	}
+	if rws.req.Method != "CONNECT" {
+		return nil, errNotConnect
+	}
+	if rws.ended {
+		return nil, errResponseEnded
+	}
+	if !rws.wroteHeader {
+		w.WriteHeader(200)
+	}
+	if rws.status < 200 || rws.status > 299 {
+		return nil, errNotAccepted
+	}
+	if err := w.FlushError(); err != nil {
+		return nil, err
+	}
+	return &serverTunnel{w: w, body: rws.req.Body}, nil
+}
+
+// serverTunnel is the tunnel of a CONNECT stream on the server.
+type serverTunnel struct {
+	w    *responseWriter
+	body io.ReadCloser
+}
+
+func (t *serverTunnel) Read(p []byte) (int, error) {
+	return t.body.Read(p)
+}
+
+func (t *serverTunnel) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, t.w.FlushError()
+}
+
+// CloseWrite ends the stream in the server's direction. The client's
+// DATA frames can still be read.
+func (t *serverTunnel) CloseWrite() error {
+	rws := t.w.rws
+	if rws == nil {
+		panic("CloseWrite called after Handler finished")
+	}
+	if rws.ended {
+		return errResponseEnded
+	}
+	rws.stream.halfClose = true
+	return t.w.FlushTrailers()
+}
+
+func (t *serverTunnel) Close() error {
+	rws := t.w.rws
+	if rws == nil {
+		panic("Close called after Handler finished")
+	}
+	t.body.Close()
+	if !rws.ended {
+		// Without halfClose, ending the response resets the stream
+		// if the client has not ended it.
+		return t.w.FlushTrailers()
+	}
+	if rws.stream.halfClose {
+		rws.dirty = true
+		if err := rws.conn.resetStreamFromHandler(rws.stream, ErrCodeNo); err != errStreamClosed {
+			return err
+		}
+	}
+	return nil
+}
+
+// A StreamResetter aborts the stream of a response with a chosen
+// error code. The http.ResponseWriter passed to a Server's Handlers
+// implements it.
+type StreamResetter interface {
+	// ResetStream aborts the stream by sending the client a
+	// RST_STREAM frame with the given code, for example
+	// ErrCodeEnhanceYourCalm to tell a client it is being rate
+	// limited. The client's RoundTrip, or its read of the response
+	// body if the headers were already sent, fails with a
+	// StreamError holding code.
+	//
+	// Any response data not yet written to the connection is
+	// discarded, the request's context is canceled, and later writes
+	// fail. ResetStream returns an error if the stream has already
+	// been reset or closed.
+	ResetStream(code ErrCode) error
+}
+
+var _ StreamResetter = (*responseWriter)(nil)
+
+var errNoStreamResetter = errors.New("http2: ResponseWriter does not support ResetStream")
+
+// ResetStream aborts the stream of the response written by w with the
+// given error code, as described by StreamResetter. If w does not
+// implement StreamResetter, it is unwrapped with its
+// Unwrap() http.ResponseWriter method, if any, as done by
+// http.ResponseController. If no StreamResetter is found,
+// ResetStream returns an error.
+func ResetStream(w http.ResponseWriter, code ErrCode) error {
+	for {
+		switch t := w.(type) {
+		case StreamResetter:
+			return t.ResetStream(code)
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return errNoStreamResetter
+		}
+	}
+}
+
+func (w *responseWriter) ResetStream(code ErrCode) error {
+	rws := w.rws
+	if rws == nil {
+		panic("ResetStream called after Handler finished")
+	}
+	// Writes already in flight may still reference rws.
+	rws.dirty = true
+	return rws.conn.resetStreamFromHandler(rws.stream, code)
+}
+
+// resetStreamFromHandler resets st with code on behalf of its handler,
+// once the serve loop has queued the RST_STREAM frame.
+func (sc *serverConn) resetStreamFromHandler(st *stream, code ErrCode) error {
+	sc.serveG.checkNotOn() // NOT
+	errc := make(chan error, 1)
+	sc.sendServeMsg(func(sc *serverConn) {
+		if st.state == stateClosed || st.resetQueued {
+			errc <- errStreamClosed
+			return
+		}
+		sc.resetStream(streamError(st.id, code))
+		st.cancelCtx()
+		errc <- nil
+	})
+	select {
+	case err := <-errc:
+		return err
+	case <-sc.doneServing:
+		return errClientDisconnected
+	}
+}
+
 // Push errors.
 var (
 	ErrRecursivePush    = errors.New("http2: recursive push not allowed")
 	ErrPushLimitReached = errors.New("http2: push would exceed peer's SETTINGS_MAX_CONCURRENT_STREAMS")
+	ErrPushDisabled     = errors.New("http2: push disabled for this request")
 )
 
+// A PushController controls server push for the request of a
+// response. The http.ResponseWriter passed to a Server's Handlers
+// implements it.
+//
+// Push is only possible while the client allows it. A client disables
+// push by sending SETTINGS_ENABLE_PUSH with a value of 0, which many
+// clients do in their first SETTINGS frame; the server also stops
+// pushing after receiving a GOAWAY frame. Push then fails with
+// http.ErrNotSupported. DisablePush adds a per-request switch on top
+// of that: it can turn push off for a request, but never on.
+type PushController interface {
+	// DisablePush turns off push for the request. Later calls to
+	// Push fail with ErrPushDisabled. Pushes already promised are
+	// not affected.
+	DisablePush()
+
+	// PushEnabled reports whether a call to Push could currently
+	// succeed, that is whether DisablePush has not been called, the
+	// response is not itself a pushed response, and the client has
+	// not disabled push. Handlers can use it to skip preparing
+	// pushes that would be rejected. Push may still fail if the
+	// client disables push after PushEnabled returns.
+	PushEnabled() bool
+}
+
+var _ PushController = (*responseWriter)(nil)
+
+// DisablePush turns off push for the request of the response written
+// by w, as described by PushController. If w does not implement
+// PushController, it is unwrapped with its Unwrap() http.ResponseWriter
+// method, if any. If no PushController is found, w cannot push and
+// DisablePush does nothing.
+func DisablePush(w http.ResponseWriter) {
+	if pc := findPushController(w); pc != nil {
+		pc.DisablePush()
+	}
+}
+
+// PushEnabled reports whether the response written by w can currently
+// push, as described by PushController. If w does not implement
+// PushController, it is unwrapped with its Unwrap() http.ResponseWriter
+// method, if any. If no PushController is found, PushEnabled returns
+// false.
+func PushEnabled(w http.ResponseWriter) bool {
+	pc := findPushController(w)
+	return pc != nil && pc.PushEnabled()
+}
+
+func findPushController(w http.ResponseWriter) PushController {
+	for {
+		switch t := w.(type) {
+		case PushController:
+			return t
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+func (w *responseWriter) DisablePush() {
+	rws := w.rws
+	if rws == nil {
+		panic("DisablePush called after Handler finished")
+	}
+	rws.noPush = true
+}
+
+func (w *responseWriter) PushEnabled() bool {
+	rws := w.rws
+	if rws == nil {
+		panic("PushEnabled called after Handler finished")
+	}
+	return !rws.noPush && !rws.stream.isPushed() &&
+		atomic.LoadInt32(&rws.conn.pushDisabled) == 0
+}
+
 var _ http.Pusher = (*responseWriter)(nil)
 
 func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
@@ -2970,6 +3943,9 @@ func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
 	if st.isPushed() {
 		return ErrRecursivePush
 	}
+	if w.rws.noPush {
+		return ErrPushDisabled
+	}
 
 	if opts == nil {
 		opts = new(http.PushOptions)
@@ -356,6 +356,35 @@ func TestServer_Push_RejectIfDisabled(t *testing.T) {
 		Setting{SettingEnablePush, 0})
 }
 
+func TestServer_Push_PushEnabledIfDisabled(t *testing.T) {
+	testServer_Push_RejectSingleRequest(t,
+		func(p http.Pusher, r *http.Request) error {
+			if PushEnabled(p.(http.ResponseWriter)) {
+				return errors.New("PushEnabled = true, want false after SETTINGS_ENABLE_PUSH=0")
+			}
+			return nil
+		},
+		Setting{SettingEnablePush, 0})
+}
+
+func TestServer_Push_RejectDisabledForRequest(t *testing.T) {
+	testServer_Push_RejectSingleRequest(t,
+		func(p http.Pusher, r *http.Request) error {
+			w := p.(http.ResponseWriter)
+			if !PushEnabled(w) {
+				return errors.New("PushEnabled = false before DisablePush, want true")
+			}
+			DisablePush(w)
+			if PushEnabled(w) {
+				return errors.New("PushEnabled = true after DisablePush, want false")
+			}
+			if got, want := p.Push("https://"+r.Host+"/pushed", nil), ErrPushDisabled; got != want {
+				return fmt.Errorf("Push()=%v, want %v", got, want)
+			}
+			return nil
+		})
+}
+
 func TestServer_Push_RejectWhenNoConcurrentStreams(t *testing.T) {
 	testServer_Push_RejectSingleRequest(t,
 		func(p http.Pusher, r *http.Request) error {
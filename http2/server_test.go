@@ -1073,6 +1073,253 @@ func TestServer_Request_Reject_Pseudo_scheme_invalid(t *testing.T) {
 	testRejectRequest(t, func(st *serverTester) { st.bodylessReq1(":scheme", "bogus") })
 }
 
+func TestServer_Request_AcceptScheme(t *testing.T) {
+	schemes := make(chan string, 10)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Scheme != "x-custom" {
+			t.Errorf("URL.Scheme = %q; want %q", r.URL.Scheme, "x-custom")
+		}
+		if r.TLS == nil {
+			t.Errorf("TLS = nil; want the connection's TLS state")
+		}
+		w.WriteHeader(204)
+	}, func(s *Server) {
+		s.AcceptScheme = func(scheme string) bool {
+			schemes <- scheme
+			return scheme == "x-custom"
+		}
+	})
+	defer st.Close()
+	st.greet()
+
+	st.bodylessReq1(":scheme", "x-custom")
+	hf := st.wantHeaders()
+	goth := st.decodeHeader(hf.HeaderBlockFragment())
+	if want := [][2]string{{":status", "204"}}; !reflect.DeepEqual(goth, want) {
+		t.Errorf("response headers = %q; want %q", goth, want)
+	}
+
+	// Schemes refused by AcceptScheme, or not valid URI schemes, are
+	// rejected as before.
+	for i, scheme := range []string{"x-other", "1bad", "x custom"} {
+		id := uint32(3 + 2*i)
+		st.writeHeaders(HeadersFrameParam{
+			StreamID:      id,
+			BlockFragment: st.encodeHeader(":scheme", scheme),
+			EndStream:     true,
+			EndHeaders:    true,
+		})
+		st.wantRSTStream(id, ErrCodeProtocol)
+	}
+	close(schemes)
+	var got []string
+	for s := range schemes {
+		got = append(got, s)
+	}
+	if want := []string{"x-custom", "x-other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AcceptScheme called with %q; want %q", got, want)
+	}
+}
+
+func TestServer_NewStreamRate(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}, func(s *Server) {
+		s.NewStreamRate = 1
+		s.NewStreamBurst = 3
+	})
+	defer st.Close()
+	st.greet()
+
+	// Open and immediately reset streams faster than the limit allows.
+	for i := 0; i < 4; i++ {
+		id := uint32(1 + 2*i)
+		st.writeHeaders(HeadersFrameParam{
+			StreamID:      id,
+			BlockFragment: st.encodeHeader(),
+			EndStream:     true,
+			EndHeaders:    true,
+		})
+		if err := st.fr.WriteRSTStream(id, ErrCodeCancel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for {
+		f, err := st.readFrame()
+		if err != nil {
+			t.Fatalf("reading frame: %v", err)
+		}
+		gf, ok := f.(*GoAwayFrame)
+		if !ok {
+			continue
+		}
+		if gf.ErrCode != ErrCodeEnhanceYourCalm {
+			t.Errorf("GOAWAY ErrCode = %v; want %v", gf.ErrCode, ErrCodeEnhanceYourCalm)
+		}
+		if gf.LastStreamID != 5 {
+			t.Errorf("GOAWAY LastStreamID = %v; want 5", gf.LastStreamID)
+		}
+		break
+	}
+	if f, err := st.readFrame(); err == nil {
+		t.Errorf("got frame %v after GOAWAY; want connection closed", f)
+	}
+}
+
+func TestServer_NewStreamRateUnderLimit(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}, func(s *Server) {
+		s.NewStreamRate = 1
+		s.MaxConcurrentStreams = 5
+	})
+	defer st.Close()
+	st.greet()
+
+	// The bucket starts with as many tokens as there may be
+	// concurrent streams.
+	for i := 0; i < 5; i++ {
+		id := uint32(1 + 2*i)
+		st.writeHeaders(HeadersFrameParam{
+			StreamID:      id,
+			BlockFragment: st.encodeHeader(),
+			EndStream:     true,
+			EndHeaders:    true,
+		})
+		hf := st.wantHeaders()
+		if hf.StreamID != id {
+			t.Fatalf("response for stream %v; want %v", hf.StreamID, id)
+		}
+	}
+}
+
+func TestServer_RejectSettingsBadLength(t *testing.T) {
+	testServerRejectsSettings(t, ErrCodeFrameSize, "frame_settings_mod_6", nil, func(st *serverTester) {
+		// Seven bytes is one setting and a byte of another.
+		if err := st.fr.WriteRawFrame(FrameSettings, 0, 0, make([]byte, 7)); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestServer_RejectSettingsTooMany(t *testing.T) {
+	testServerRejectsSettings(t, ErrCodeProtocol, "conn_PROTOCOL_ERROR_settings_big_or_dups", func(s *Server) {
+		s.MaxSettingsPerFrame = 10
+	}, func(st *serverTester) {
+		var settings []Setting
+		for i := 0; i < 11; i++ {
+			settings = append(settings, Setting{ID: SettingID(0x100 + i), Val: 1})
+		}
+		if err := st.fr.WriteSettings(settings...); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// testServerRejectsSettings tests that the server answers the SETTINGS
+// frame sent by writeSettings with a GOAWAY carrying wantCode, and
+// reports wantCount to Server.CountError.
+func testServerRejectsSettings(t *testing.T, wantCode ErrCode, wantCount string, configure func(*Server), writeSettings func(*serverTester)) {
+	var mu sync.Mutex
+	var counts []string
+	st := newServerTester(t, nil, func(s *Server) {
+		s.CountError = func(errType string) {
+			mu.Lock()
+			defer mu.Unlock()
+			counts = append(counts, errType)
+		}
+		if configure != nil {
+			configure(s)
+		}
+	})
+	defer st.Close()
+	st.greet()
+	writeSettings(st)
+	gf := st.wantGoAway()
+	if gf.ErrCode != wantCode {
+		t.Errorf("GOAWAY ErrCode = %v; want %v", gf.ErrCode, wantCode)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(counts) != 1 || counts[0] != wantCount {
+		t.Errorf("CountError calls = %q; want [%q]", counts, wantCount)
+	}
+}
+
+type recordingLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *recordingLogger) Log(level LogLevel, msg string, keysAndValues ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, fmt.Sprintf("%v %s %v", level, msg, keysAndValues))
+}
+
+func TestServer_Logger(t *testing.T) {
+	lg := &recordingLogger{}
+	st := newServerTester(t, nil, func(s *Server) {
+		s.Logger = lg
+	})
+	defer st.Close()
+	st.greet()
+
+	// A PING on a stream is a connection error.
+	if err := st.fr.WriteRawFrame(FramePing, 0, 1, make([]byte, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if gf := st.wantGoAway(); gf.ErrCode != ErrCodeProtocol {
+		t.Errorf("GOAWAY ErrCode = %v; want %v", gf.ErrCode, ErrCodeProtocol)
+	}
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	addr := st.cc.LocalAddr().String()
+	want := fmt.Sprintf("%v http2: server connection error from %v: connection error: PROTOCOL_ERROR [remote_addr %v]", LogLevelError, addr, addr)
+	if len(lg.logs) != 1 || lg.logs[0] != want {
+		t.Errorf("logged:\n%q\nwant:\n%q", lg.logs, want)
+	}
+}
+
+func TestServer_OnFrame(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		frames []string
+	)
+	st := newServerTester(t, nil, func(s *Server) {
+		s.OnFrame = func(dir FrameDirection, f Frame) {
+			mu.Lock()
+			defer mu.Unlock()
+			if pf, ok := f.(*PingFrame); ok {
+				frames = append(frames, fmt.Sprintf("%v %v ack=%v", dir, pf.Data, pf.IsAck()))
+				// The frame is a copy; this must not change the reply.
+				pf.Data = [8]byte{}
+			}
+		}
+	})
+	defer st.Close()
+	st.greet()
+
+	pingData := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	if err := st.fr.WritePing(false, pingData); err != nil {
+		t.Fatal(err)
+	}
+	if pf := st.wantPing(); pf.Data != pingData {
+		t.Errorf("response ping has data %v; want %v", pf.Data, pingData)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		"read [1 2 3 4 5 6 7 8] ack=false",
+		"wrote [1 2 3 4 5 6 7 8] ack=true",
+	}
+	if !reflect.DeepEqual(frames, want) {
+		t.Errorf("OnFrame calls:\n%q\nwant:\n%q", frames, want)
+	}
+}
+
 func TestServer_Request_Reject_Pseudo_Unknown(t *testing.T) {
 	testRejectRequest(t, func(st *serverTester) {
 		st.addLogFilter(`invalid pseudo-header ":unknown_thing"`)
@@ -1178,6 +1425,120 @@ func TestServer_Request_Connect_InvalidScheme(t *testing.T) {
 	})
 }
 
+func TestServer_Request_ExtendedConnect(t *testing.T) {
+	testServerRequest(t, func(st *serverTester) {
+		st.writeHeaders(HeadersFrameParam{
+			StreamID: 1,
+			BlockFragment: st.encodeHeaderRaw(
+				":method", "CONNECT",
+				":protocol", "websocket",
+				":scheme", "https",
+				":authority", "example.com",
+				":path", "/chat?room=1",
+			),
+			EndStream:  true,
+			EndHeaders: true,
+		})
+	}, func(r *http.Request) {
+		if g, w := r.Method, "CONNECT"; g != w {
+			t.Errorf("Method = %q; want %q", g, w)
+		}
+		if g, w := r.Header.Get(":protocol"), "websocket"; g != w {
+			t.Errorf("Header[:protocol] = %q; want %q", g, w)
+		}
+		if g, w := r.RequestURI, "/chat?room=1"; g != w {
+			t.Errorf("RequestURI = %q; want %q", g, w)
+		}
+		if g, w := r.URL.Path, "/chat"; g != w {
+			t.Errorf("URL.Path = %q; want %q", g, w)
+		}
+		if g, w := r.Host, "example.com"; g != w {
+			t.Errorf("Host = %q; want %q", g, w)
+		}
+	}, func(s *Server) {
+		s.EnableExtendedConnect = true
+	})
+}
+
+func TestServer_Request_ExtendedConnect_NotConnect(t *testing.T) {
+	testServerRejectsStream(t, ErrCodeProtocol, func(st *serverTester) {
+		st.writeHeaders(HeadersFrameParam{
+			StreamID:      1,
+			BlockFragment: st.encodeHeader(":protocol", "websocket"),
+			EndStream:     true,
+			EndHeaders:    true,
+		})
+	})
+}
+
+func TestServer_Request_ExtendedConnect_NotEnabled(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called for extended CONNECT request")
+	})
+	defer st.Close()
+	st.greetAndCheckSettings(func(s Setting) error {
+		if s.ID == SettingEnableConnectProtocol {
+			t.Errorf("server advertised %v", s)
+		}
+		return nil
+	})
+	st.writeHeaders(HeadersFrameParam{
+		StreamID: 1,
+		BlockFragment: st.encodeHeaderRaw(
+			":method", "CONNECT",
+			":protocol", "websocket",
+			":scheme", "https",
+			":authority", "example.com",
+			":path", "/chat",
+		),
+		EndStream:  true,
+		EndHeaders: true,
+	})
+	st.wantRSTStream(1, ErrCodeProtocol)
+}
+
+// countingWriteScheduler counts the frames pushed to a WriteScheduler.
+type countingWriteScheduler struct {
+	WriteScheduler
+	pushes *int32
+}
+
+func (ws countingWriteScheduler) Push(wr FrameWriteRequest) {
+	atomic.AddInt32(ws.pushes, 1)
+	ws.WriteScheduler.Push(wr)
+}
+
+func TestServer_NewWriteScheduler(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		new  func() WriteScheduler
+	}{
+		{"random", NewRandomWriteScheduler},
+		{"priority", func() WriteScheduler { return NewPriorityWriteScheduler(nil) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var pushes int32
+			st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "hello")
+			}, func(s *Server) {
+				s.NewWriteScheduler = func() WriteScheduler {
+					return countingWriteScheduler{tt.new(), &pushes}
+				}
+			})
+			defer st.Close()
+			st.greet()
+			st.bodylessReq1()
+			st.wantHeaders()
+			if df := st.wantData(); string(df.Data()) != "hello" {
+				t.Errorf("got DATA %q; want %q", df.Data(), "hello")
+			}
+			if atomic.LoadInt32(&pushes) == 0 {
+				t.Errorf("configured write scheduler was not used")
+			}
+		})
+	}
+}
+
 func TestServer_Ping(t *testing.T) {
 	st := newServerTester(t, nil)
 	defer st.Close()
@@ -1452,6 +1813,124 @@ func TestServer_RSTStream_Unblocks_Read(t *testing.T) {
 	)
 }
 
+func TestServer_StreamResetError(t *testing.T) {
+	if _, ok := StreamResetError(context.Background()); ok {
+		t.Errorf("StreamResetError(context.Background()) reported a reset")
+	}
+	inHandler := make(chan bool)
+	errc := make(chan error, 1)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := StreamResetError(r.Context()); ok {
+			t.Errorf("StreamResetError reported a reset before the client sent one")
+		}
+		inHandler <- true
+		<-r.Context().Done()
+		se, ok := StreamResetError(r.Context())
+		if !ok {
+			errc <- errors.New("StreamResetError reported no reset")
+			return
+		}
+		errc <- se
+	})
+	defer st.Close()
+
+	st.greet()
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: st.encodeHeader(":method", "POST"),
+		EndStream:     false,
+		EndHeaders:    true,
+	})
+	<-inHandler
+	if err := st.fr.WriteRSTStream(1, ErrCodeEnhanceYourCalm); err != nil {
+		t.Fatal(err)
+	}
+	want := StreamError{StreamID: 1, Code: ErrCodeEnhanceYourCalm}
+	if err := <-errc; err != want {
+		t.Errorf("StreamResetError = %v; want %v", err, want)
+	}
+}
+
+// unwrappingResponseWriter wraps a ResponseWriter as middleware does,
+// hiding its other methods.
+type unwrappingResponseWriter struct{ w http.ResponseWriter }
+
+func (w unwrappingResponseWriter) Header() http.Header         { return w.w.Header() }
+func (w unwrappingResponseWriter) Write(p []byte) (int, error) { return w.w.Write(p) }
+func (w unwrappingResponseWriter) WriteHeader(code int)        { w.w.WriteHeader(code) }
+func (w unwrappingResponseWriter) Unwrap() http.ResponseWriter { return w.w }
+
+func TestServer_Handler_ResetStream(t *testing.T) {
+	handlerErrc := make(chan error, 1)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		handlerErrc <- func() error {
+			if r.URL.Path == "/late" {
+				io.WriteString(w, "partial")
+				w.(http.Flusher).Flush()
+			}
+			if err := ResetStream(unwrappingResponseWriter{w}, ErrCodeEnhanceYourCalm); err != nil {
+				return fmt.Errorf("ResetStream: %v", err)
+			}
+			if err := w.(StreamResetter).ResetStream(ErrCodeInternal); err == nil {
+				return errors.New("second ResetStream succeeded; want error")
+			}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+				return errors.New("request context not canceled")
+			}
+			if _, err := io.WriteString(w, "more"); err == nil {
+				w.(http.Flusher).Flush()
+			}
+			return nil
+		}()
+	})
+	defer st.Close()
+	st.greet()
+
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: st.encodeHeader(":path", "/early"),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	st.wantRSTStream(1, ErrCodeEnhanceYourCalm)
+	if err := <-handlerErrc; err != nil {
+		t.Fatal(err)
+	}
+
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      3,
+		BlockFragment: st.encodeHeader(":path", "/late"),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	if hf := st.wantHeaders(); hf.StreamEnded() {
+		t.Fatalf("got %v; want HEADERS without END_STREAM", hf)
+	}
+	if df := st.wantData(); string(df.Data()) != "partial" || df.StreamEnded() {
+		t.Fatalf("got %v; want DATA %q without END_STREAM", df, "partial")
+	}
+	st.wantRSTStream(3, ErrCodeEnhanceYourCalm)
+	if err := <-handlerErrc; err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing else is sent on the reset streams.
+	if err := st.fr.WritePing(false, [8]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if pf := st.wantPing(); !pf.IsAck() {
+		t.Fatalf("got %v; want PING ack", pf)
+	}
+}
+
+func TestResetStreamUnsupported(t *testing.T) {
+	if err := ResetStream(httptest.NewRecorder(), ErrCodeCancel); err == nil {
+		t.Errorf("ResetStream of an httptest.ResponseRecorder succeeded; want error")
+	}
+}
+
 func TestServer_RSTStream_Unblocks_Header_Write(t *testing.T) {
 	// Run this test a bunch, because it doesn't always
 	// deadlock. But with a bunch, it did.
@@ -1758,7 +2237,7 @@ func testServerRejectsStream(t *testing.T, code ErrCode, writeReq func(*serverTe
 // testServerRequest sets up an idle HTTP/2 connection and lets you
 // write a single request with writeReq, and then verify that the
 // *http.Request is built correctly in checkReq.
-func testServerRequest(t *testing.T, writeReq func(*serverTester), checkReq func(*http.Request)) {
+func testServerRequest(t *testing.T, writeReq func(*serverTester), checkReq func(*http.Request), opts ...interface{}) {
 	gotReq := make(chan bool, 1)
 	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
 		if r.Body == nil {
@@ -1766,7 +2245,7 @@ func testServerRequest(t *testing.T, writeReq func(*serverTester), checkReq func
 		}
 		checkReq(r)
 		gotReq <- true
-	})
+	}, opts...)
 	defer st.Close()
 
 	st.greet()
@@ -2283,6 +2762,42 @@ func TestServer_Response_RST_Unblocks_LargeWrite(t *testing.T) {
 	})
 }
 
+func TestServer_Response_Flush(t *testing.T) {
+	flushed := make(chan struct{})
+	release := make(chan struct{})
+	testServerResponse(t, func(w http.ResponseWriter, r *http.Request) error {
+		io.WriteString(w, "event: one\n\n")
+		w.(http.Flusher).Flush()
+		close(flushed)
+		<-release
+		io.WriteString(w, "event: two\n\n")
+		return nil
+	}, func(st *serverTester) {
+		getSlash(st)
+		hf := st.wantHeaders()
+		if hf.StreamEnded() {
+			t.Fatal("unexpected END_STREAM flag")
+		}
+		<-flushed
+		// The flushed chunk arrives while the handler is blocked.
+		df := st.wantData()
+		if got, want := string(df.Data()), "event: one\n\n"; got != want {
+			t.Errorf("first DATA = %q; want %q", got, want)
+		}
+		if df.StreamEnded() {
+			t.Fatal("unexpected END_STREAM flag on flushed DATA")
+		}
+		close(release)
+		df = st.wantData()
+		if got, want := string(df.Data()), "event: two\n\n"; got != want {
+			t.Errorf("second DATA = %q; want %q", got, want)
+		}
+		if !df.StreamEnded() {
+			t.Error("want END_STREAM flag on final DATA")
+		}
+	})
+}
+
 func TestServer_Response_Empty_Data_Not_FlowControlled(t *testing.T) {
 	testServerResponse(t, func(w http.ResponseWriter, r *http.Request) error {
 		w.(http.Flusher).Flush()
@@ -2404,108 +2919,433 @@ func TestServer_HandlerWriteErrorOnDisconnect(t *testing.T) {
 		if hf.StreamEnded() {
 			t.Fatal("unexpected END_STREAM flag")
 		}
-		if !hf.HeadersEnded() {
-			t.Fatal("want END_HEADERS flag")
+		if !hf.HeadersEnded() {
+			t.Fatal("want END_HEADERS flag")
+		}
+		// Close the connection and wait for the handler to (hopefully) notice.
+		st.cc.Close()
+		_ = <-errc
+	})
+}
+
+func TestServer_Rejects_Too_Many_Streams(t *testing.T) {
+	const testPath = "/some/path"
+
+	inHandler := make(chan uint32)
+	leaveHandler := make(chan bool)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		id := w.(*responseWriter).rws.stream.id
+		inHandler <- id
+		if id == 1+(defaultMaxStreams+1)*2 && r.URL.Path != testPath {
+			t.Errorf("decoded final path as %q; want %q", r.URL.Path, testPath)
+		}
+		<-leaveHandler
+	})
+	defer st.Close()
+	st.greet()
+	nextStreamID := uint32(1)
+	streamID := func() uint32 {
+		defer func() { nextStreamID += 2 }()
+		return nextStreamID
+	}
+	sendReq := func(id uint32, headers ...string) {
+		st.writeHeaders(HeadersFrameParam{
+			StreamID:      id,
+			BlockFragment: st.encodeHeader(headers...),
+			EndStream:     true,
+			EndHeaders:    true,
+		})
+	}
+	for i := 0; i < defaultMaxStreams; i++ {
+		sendReq(streamID())
+		<-inHandler
+	}
+	defer func() {
+		for i := 0; i < defaultMaxStreams; i++ {
+			leaveHandler <- true
+		}
+	}()
+
+	// And this one should cross the limit:
+	// (It's also sent as a CONTINUATION, to verify we still track the decoder context,
+	// even if we're rejecting it)
+	rejectID := streamID()
+	headerBlock := st.encodeHeader(":path", testPath)
+	frag1, frag2 := headerBlock[:3], headerBlock[3:]
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      rejectID,
+		BlockFragment: frag1,
+		EndStream:     true,
+		EndHeaders:    false, // CONTINUATION coming
+	})
+	if err := st.fr.WriteContinuation(rejectID, true, frag2); err != nil {
+		t.Fatal(err)
+	}
+	st.wantRSTStream(rejectID, ErrCodeProtocol)
+
+	// But let a handler finish:
+	leaveHandler <- true
+	st.wantHeaders()
+
+	// And now another stream should be able to start:
+	goodID := streamID()
+	sendReq(goodID, ":path", testPath)
+	if got := <-inHandler; got != goodID {
+		t.Errorf("Got stream %d; want %d", got, goodID)
+	}
+}
+
+// So many response headers that the server needs to use CONTINUATION frames:
+func TestServer_Response_ManyHeaders_With_Continuation(t *testing.T) {
+	testServerResponse(t, func(w http.ResponseWriter, r *http.Request) error {
+		h := w.Header()
+		for i := 0; i < 5000; i++ {
+			h.Set(fmt.Sprintf("x-header-%d", i), fmt.Sprintf("x-value-%d", i))
+		}
+		return nil
+	}, func(st *serverTester) {
+		getSlash(st)
+		hf := st.wantHeaders()
+		if hf.HeadersEnded() {
+			t.Fatal("got unwanted END_HEADERS flag")
+		}
+		n := 0
+		for {
+			n++
+			cf := st.wantContinuation()
+			if cf.HeadersEnded() {
+				break
+			}
+		}
+		if n < 5 {
+			t.Errorf("Only got %d CONTINUATION frames; expected 5+ (currently 6)", n)
+		}
+	})
+}
+
+func TestServer_HandlerIgnoresLargeBody(t *testing.T) {
+	bodySent := make(chan struct{})
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ignore" {
+			// Return with the body data sent so far unread.
+			<-bodySent
+		}
+	})
+	defer st.Close()
+	st.greet()
+
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: st.encodeHeader(":method", "POST", ":path", "/ignore"),
+		EndStream:     false,
+		EndHeaders:    true,
+	})
+	// In all, more than the connection's flow control window.
+	const chunks = 48
+	chunk := make([]byte, 16<<10)
+	for i := 0; i < chunks; i++ {
+		st.writeData(1, false, chunk)
+	}
+	close(bodySent)
+	hf := st.wantHeaders()
+	if !hf.StreamEnded() {
+		t.Fatalf("want END_STREAM, got %v", hf)
+	}
+	st.wantRSTStream(1, ErrCodeNo)
+
+	// Data the client sent before seeing the RST_STREAM.
+	for i := 0; i < chunks; i++ {
+		st.writeData(1, false, chunk)
+	}
+
+	// The connection is still usable.
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      3,
+		BlockFragment: st.encodeHeader(":path", "/next"),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	for {
+		f, err := st.readFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch f := f.(type) {
+		case *RSTStreamFrame:
+			if f.StreamID != 1 {
+				t.Fatalf("got %v; want only RST_STREAM for stream 1", f)
+			}
+			continue
+		case *WindowUpdateFrame:
+			continue
+		case *HeadersFrame:
+			if f.StreamID != 3 {
+				t.Fatalf("got %v; want HEADERS for stream 3", f)
+			}
+		default:
+			t.Fatalf("unexpected frame %v", f)
+		}
+		break
+	}
+	st.wantFlowControlConsumed(0, 0)
+}
+
+// priorityRecorder is a StreamPriorityScheduler that reports the
+// priorities it is given.
+type priorityRecorder struct {
+	StreamPriorityScheduler
+	c chan string
+}
+
+func (r priorityRecorder) AdjustStreamPriority(streamID uint32, p StreamPriority) {
+	r.c <- fmt.Sprintf("%d: %q", streamID, p)
+	r.StreamPriorityScheduler.AdjustStreamPriority(streamID, p)
+}
+
+func TestServer_StreamPriority(t *testing.T) {
+	recorded := make(chan string, 10)
+	unblock := make(chan struct{})
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}, func(s *Server) {
+		s.NewWriteScheduler = func() WriteScheduler {
+			return priorityRecorder{NewExtensiblePriorityWriteScheduler(), recorded}
+		}
+	})
+	defer st.Close()
+	defer close(unblock)
+	st.greet()
+
+	want := func(w string) {
+		t.Helper()
+		select {
+		case got := <-recorded:
+			if got != w {
+				t.Errorf("AdjustStreamPriority(%s), want (%s)", got, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for AdjustStreamPriority(%s)", w)
+		}
+	}
+
+	// The priority header field of a request.
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: st.encodeHeader("priority", "u=1, i"),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	want(`1: "u=1, i"`)
+
+	// A PRIORITY_UPDATE for an open stream.
+	if err := st.fr.WritePriorityUpdate(1, "u=6"); err != nil {
+		t.Fatal(err)
+	}
+	want(`1: "u=6"`)
+
+	// A PRIORITY_UPDATE sent before the request wins over its header.
+	if err := st.fr.WritePriorityUpdate(3, "u=5"); err != nil {
+		t.Fatal(err)
+	}
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      3,
+		BlockFragment: st.encodeHeader("priority", "u=0"),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	want(`3: "u=5"`)
+
+	// No priority header field.
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      5,
+		BlockFragment: st.encodeHeader(),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	want(`5: ""`)
+}
+
+func TestServer_LargePeerMaxFrameSize(t *testing.T) {
+	const (
+		frameSize = 1 << 20
+		bodySize  = 256 << 10
+	)
+	gotFrameSize := make(chan uint32, 1)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		n, _ := ConnPeerMaxFrameSize(r.Context())
+		gotFrameSize <- n
+		w.Write(make([]byte, bodySize))
+	})
+	defer st.Close()
+	st.greet()
+
+	st.fr.SetMaxReadFrameSize(frameSize)
+	if err := st.fr.WriteSettings(
+		Setting{SettingMaxFrameSize, frameSize},
+		Setting{SettingInitialWindowSize, frameSize},
+	); err != nil {
+		t.Fatal(err)
+	}
+	st.wantSettingsAck()
+	if err := st.fr.WriteWindowUpdate(0, frameSize); err != nil {
+		t.Fatal(err)
+	}
+
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: st.encodeHeader(),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	if got := <-gotFrameSize; got != frameSize {
+		t.Errorf("ConnPeerMaxFrameSize = %v, want %v", got, frameSize)
+	}
+	st.wantHeaders()
+	df := st.wantData()
+	if got := len(df.Data()); got != bodySize {
+		t.Errorf("got DATA frame of %v bytes, want the whole %v byte body in one frame", got, bodySize)
+	}
+}
+
+func TestServer_WriteByteTimeout(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	errc := make(chan error, 1)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		// Write until the client, which never reads, stalls the
+		// connection.
+		buf := make([]byte, 1<<20)
+		for {
+			if _, err := w.Write(buf); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}, func(s *Server) {
+		s.WriteByteTimeout = timeout
+	})
+	defer st.Close()
+	st.greet()
+	// Let the server write as much as the connection accepts.
+	if err := st.fr.WriteSettings(Setting{SettingInitialWindowSize, 1 << 30}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.fr.WriteWindowUpdate(0, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: st.encodeHeader(),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	select {
+	case <-errc:
+	case <-time.After(10 * time.Second):
+		t.Fatal("handler's write did not fail")
+	}
+	// Once what the server wrote is read, the connection is closed.
+	st.cc.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		_, err := st.readFrame()
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			t.Fatal("connection not closed")
+		}
+		if err != nil {
+			break
 		}
-		// Close the connection and wait for the handler to (hopefully) notice.
-		st.cc.Close()
-		_ = <-errc
-	})
+	}
 }
 
-func TestServer_Rejects_Too_Many_Streams(t *testing.T) {
-	const testPath = "/some/path"
-
-	inHandler := make(chan uint32)
-	leaveHandler := make(chan bool)
+func TestServer_MaxRequestBodyBytes(t *testing.T) {
+	type result struct {
+		n   int
+		err error
+	}
+	resc := make(chan result, 1)
 	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
-		id := w.(*responseWriter).rws.stream.id
-		inHandler <- id
-		if id == 1+(defaultMaxStreams+1)*2 && r.URL.Path != testPath {
-			t.Errorf("decoded final path as %q; want %q", r.URL.Path, testPath)
-		}
-		<-leaveHandler
+		b, err := ioutil.ReadAll(r.Body)
+		resc <- result{len(b), err}
+	}, func(s *Server) {
+		s.MaxRequestBodyBytes = 2500
 	})
 	defer st.Close()
 	st.greet()
-	nextStreamID := uint32(1)
-	streamID := func() uint32 {
-		defer func() { nextStreamID += 2 }()
-		return nextStreamID
+
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: st.encodeHeader(":method", "POST"),
+		EndStream:     false,
+		EndHeaders:    true,
+	})
+	chunk := make([]byte, 1000)
+	for i := 0; i < 3; i++ {
+		st.writeData(1, false, chunk)
 	}
-	sendReq := func(id uint32, headers ...string) {
-		st.writeHeaders(HeadersFrameParam{
-			StreamID:      id,
-			BlockFragment: st.encodeHeader(headers...),
-			EndStream:     true,
-			EndHeaders:    true,
-		})
+	for {
+		f, err := st.readFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := f.(*WindowUpdateFrame); ok {
+			continue
+		}
+		rs, ok := f.(*RSTStreamFrame)
+		if !ok || rs.StreamID != 1 || rs.ErrCode != ErrCodeCancel {
+			t.Fatalf("got %v; want RST_STREAM for stream 1 with CANCEL", f)
+		}
+		break
 	}
-	for i := 0; i < defaultMaxStreams; i++ {
-		sendReq(streamID())
-		<-inHandler
+	res := <-resc
+	if res.n != 2000 || res.err != ErrRequestBodyTooLarge {
+		t.Errorf("handler read %d bytes, %v; want 2000 bytes, %v", res.n, res.err, ErrRequestBodyTooLarge)
 	}
-	defer func() {
-		for i := 0; i < defaultMaxStreams; i++ {
-			leaveHandler <- true
-		}
-	}()
+}
+
+func TestServer_AutoTuneWindow(t *testing.T) {
+	const window = 64 << 10
+	unblock := make(chan struct{})
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}, func(s *Server) {
+		s.MaxUploadBufferPerStream = window
+		s.AutoTuneWindow = true
+	})
+	defer st.Close()
+	defer close(unblock)
+	st.greet()
 
-	// And this one should cross the limit:
-	// (It's also sent as a CONTINUATION, to verify we still track the decoder context,
-	// even if we're rejecting it)
-	rejectID := streamID()
-	headerBlock := st.encodeHeader(":path", testPath)
-	frag1, frag2 := headerBlock[:3], headerBlock[3:]
 	st.writeHeaders(HeadersFrameParam{
-		StreamID:      rejectID,
-		BlockFragment: frag1,
-		EndStream:     true,
-		EndHeaders:    false, // CONTINUATION coming
+		StreamID:      1,
+		BlockFragment: st.encodeHeader(":method", "POST"),
+		EndStream:     false,
+		EndHeaders:    true,
 	})
-	if err := st.fr.WriteContinuation(rejectID, true, frag2); err != nil {
-		t.Fatal(err)
+	chunk := make([]byte, 16<<10)
+	st.writeData(1, false, chunk)
+	pf := st.wantPing()
+	if pf.IsAck() || pf.Data != bdpPingData {
+		t.Fatalf("got %v; want PING with data %q", pf, bdpPingData[:])
 	}
-	st.wantRSTStream(rejectID, ErrCodeProtocol)
-
-	// But let a handler finish:
-	leaveHandler <- true
-	st.wantHeaders()
 
-	// And now another stream should be able to start:
-	goodID := streamID()
-	sendReq(goodID, ":path", testPath)
-	if got := <-inHandler; got != goodID {
-		t.Errorf("Got stream %d; want %d", got, goodID)
+	// 48KB in one round trip fills most of the 64KB window, so the
+	// window doubles to 96KB. The connection window is already larger.
+	st.writeData(1, false, chunk)
+	st.writeData(1, false, chunk)
+	if err := st.fr.WritePing(true, pf.Data); err != nil {
+		t.Fatal(err)
 	}
-}
+	st.wantWindowUpdate(1, 32<<10)
 
-// So many response headers that the server needs to use CONTINUATION frames:
-func TestServer_Response_ManyHeaders_With_Continuation(t *testing.T) {
-	testServerResponse(t, func(w http.ResponseWriter, r *http.Request) error {
-		h := w.Header()
-		for i := 0; i < 5000; i++ {
-			h.Set(fmt.Sprintf("x-header-%d", i), fmt.Sprintf("x-value-%d", i))
-		}
-		return nil
-	}, func(st *serverTester) {
-		getSlash(st)
-		hf := st.wantHeaders()
-		if hf.HeadersEnded() {
-			t.Fatal("got unwanted END_HEADERS flag")
-		}
-		n := 0
-		for {
-			n++
-			cf := st.wantContinuation()
-			if cf.HeadersEnded() {
-				break
-			}
-		}
-		if n < 5 {
-			t.Errorf("Only got %d CONTINUATION frames; expected 5+ (currently 6)", n)
-		}
-	})
+	// Another round trip with too little data leaves the window alone.
+	st.writeData(1, false, chunk)
+	pf = st.wantPing()
+	if err := st.fr.WritePing(true, pf.Data); err != nil {
+		t.Fatal(err)
+	}
+	st.writeData(1, false, chunk)
+	if pf = st.wantPing(); pf.IsAck() {
+		t.Fatalf("got %v; want PING", pf)
+	}
 }
 
 // This previously crashed (reported by Mathieu Lonjaret as observed
@@ -2905,6 +3745,83 @@ func TestServerDoS_MaxHeaderListSize(t *testing.T) {
 	}
 }
 
+func TestServerDoS_ContinuationFlood(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		configure func(*Server)
+		frag      []byte
+		errType   string
+	}{{
+		name:      "frames",
+		configure: func(s *Server) {},
+		errType:   "headers_continuation_frames",
+	}, {
+		// Literal "a: b" fields, which do not change the HPACK table.
+		name:      "block size",
+		configure: func(s *Server) { s.MaxHeaderBlockSize = 1 << 10 },
+		frag:      bytes.Repeat([]byte{0x00, 0x01, 'a', 0x01, 'b'}, 20),
+		errType:   "headers_block_size",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				counted []string
+			)
+			st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("handler called")
+			}, func(s *Server) {
+				tt.configure(s)
+				s.CountError = func(errType string) {
+					mu.Lock()
+					defer mu.Unlock()
+					counted = append(counted, errType)
+				}
+			})
+			defer st.Close()
+			st.greet()
+
+			st.writeHeaders(HeadersFrameParam{
+				StreamID:      1,
+				BlockFragment: st.encodeHeader(),
+				EndStream:     true,
+				EndHeaders:    false,
+			})
+			// The server closes the connection while the flood is
+			// being written, so write from another goroutine and
+			// ignore the errors.
+			go func() {
+				for i := 0; i < 10000; i++ {
+					if err := st.fr.WriteContinuation(1, false, tt.frag); err != nil {
+						return
+					}
+				}
+			}()
+			for {
+				f, err := st.readFrame()
+				if err != nil {
+					t.Fatalf("reading frame: %v", err)
+				}
+				gf, ok := f.(*GoAwayFrame)
+				if !ok {
+					continue
+				}
+				if gf.ErrCode != ErrCodeEnhanceYourCalm {
+					t.Errorf("GOAWAY ErrCode = %v; want %v", gf.ErrCode, ErrCodeEnhanceYourCalm)
+				}
+				break
+			}
+			if f, err := st.readFrame(); err == nil {
+				t.Errorf("got frame %v after GOAWAY; want connection closed", f)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(counted) == 0 || counted[0] != tt.errType {
+				t.Errorf("CountError called with %q; want %q first", counted, tt.errType)
+			}
+		})
+	}
+}
+
 func TestServer_Response_Stream_With_Missing_Trailer(t *testing.T) {
 	testServerResponse(t, func(w http.ResponseWriter, r *http.Request) error {
 		w.Header().Set("Trailer", "test-trailer")
@@ -3150,6 +4067,132 @@ func testServerWritesTrailers(t *testing.T, withFlush bool) {
 	})
 }
 
+func TestServerFlushTrailers(t *testing.T) {
+	gotTrailers := make(chan struct{})
+	handlerReturned := make(chan struct{})
+	testServerResponse(t, func(w http.ResponseWriter, r *http.Request) error {
+		defer close(handlerReturned)
+		io.WriteString(w, "Hello")
+		w.(http.Flusher).Flush()
+		w.Header().Set(http.TrailerPrefix+"Foo", "bar")
+		if err := FlushTrailers(w); err != nil {
+			return fmt.Errorf("FlushTrailers = %v", err)
+		}
+		// The response is complete while the handler still runs.
+		<-gotTrailers
+		if _, err := io.WriteString(w, "more"); err == nil {
+			return errors.New("Write after FlushTrailers succeeded")
+		}
+		if err := FlushTrailers(w); err == nil {
+			return errors.New("second FlushTrailers succeeded")
+		}
+		w.Header().Set(http.TrailerPrefix+"Late", "ignored")
+		return nil
+	}, func(st *serverTester) {
+		getSlash(st)
+		hf := st.wantHeaders()
+		if hf.StreamEnded() {
+			t.Fatal("response HEADERS had END_STREAM")
+		}
+		df := st.wantData()
+		if string(df.Data()) != "Hello" || df.StreamEnded() {
+			t.Fatalf("DATA = %q, END_STREAM = %v; want Hello without END_STREAM", df.Data(), df.StreamEnded())
+		}
+		tf := st.wantHeaders()
+		if !tf.StreamEnded() {
+			t.Fatal("trailers HEADERS lacked END_STREAM")
+		}
+		close(gotTrailers)
+		goth := st.decodeHeader(tf.HeaderBlockFragment())
+		wanth := [][2]string{{"foo", "bar"}}
+		if !reflect.DeepEqual(goth, wanth) {
+			t.Errorf("trailers = %v; want %v", goth, wanth)
+		}
+		// Nothing more is sent for the stream once the handler returns.
+		<-handlerReturned
+		if err := st.fr.WritePing(false, [8]byte{1}); err != nil {
+			t.Fatal(err)
+		}
+		st.wantPing()
+	})
+}
+
+func TestServerTunnel(t *testing.T) {
+	halfDone := make(chan struct{})
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			if _, err := Tunnel(w); err == nil {
+				t.Errorf("Tunnel for %v request succeeded; want error", r.Method)
+			}
+			return
+		}
+		tun, err := Tunnel(w)
+		if err != nil {
+			t.Errorf("Tunnel = %v", err)
+			return
+		}
+		defer tun.Close()
+		if r.Host == "echo.example:443" {
+			io.Copy(tun, tun)
+			return
+		}
+		// Say hello and close the server's side first, then read
+		// what the client sends.
+		defer close(halfDone)
+		io.WriteString(tun, "hello")
+		if err := tun.(interface{ CloseWrite() error }).CloseWrite(); err != nil {
+			t.Errorf("CloseWrite = %v", err)
+		}
+		got, err := io.ReadAll(tun)
+		if err != nil || string(got) != "goodbye" {
+			t.Errorf("read %q, %v from tunnel after CloseWrite; want %q", got, err, "goodbye")
+		}
+	}, optOnlyServer)
+	defer st.Close()
+
+	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
+	defer tr.CloseIdleConnections()
+	proxyAddr := st.ts.Listener.Addr().String()
+
+	c, err := tr.DialConnect(context.Background(), proxyAddr, "echo.example:443")
+	if err != nil {
+		t.Fatalf("DialConnect = %v", err)
+	}
+	// More than the initial stream window, to exercise flow control.
+	want := bytes.Repeat([]byte("hello, tunnel "), 10000)
+	go func() {
+		c.Write(want)
+		c.(interface{ CloseWrite() error }).CloseWrite()
+	}()
+	got, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("reading tunnel: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("read %d bytes through tunnel; want %d echoed bytes", len(got), len(want))
+	}
+	c.Close()
+
+	c, err = tr.DialConnect(context.Background(), proxyAddr, "half.example:443")
+	if err != nil {
+		t.Fatalf("DialConnect = %v", err)
+	}
+	got, err = io.ReadAll(c)
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("read %q, %v from tunnel; want %q", got, err, "hello")
+	}
+	io.WriteString(c, "goodbye")
+	c.(interface{ CloseWrite() error }).CloseWrite()
+	<-halfDone
+	c.Close()
+
+	res, err := tr.RoundTrip(httptest.NewRequest("GET", st.ts.URL, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+}
+
 func TestServerWritesUndeclaredTrailers(t *testing.T) {
 	const trailer = "Trailer-Header"
 	const value = "hi1"
@@ -4732,3 +5775,86 @@ func TestServerWriteDoesNotRetainBufferAfterServerClose(t *testing.T) {
 	st.ts.Config.Close()
 	<-donec
 }
+
+func TestServer_FlowControlStalled(t *testing.T) {
+	const window = 10
+	const size = 30
+	const delay = 20 * time.Millisecond
+	stalls := make(chan FlowControlStall, 10)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		w.Write(bytes.Repeat([]byte("a"), size))
+	}, func(s *Server) {
+		s.FlowControlStalled = func(s FlowControlStall) { stalls <- s }
+	})
+	defer st.Close()
+	st.greet()
+
+	if err := st.fr.WriteSettings(Setting{SettingInitialWindowSize, window}); err != nil {
+		t.Fatal(err)
+	}
+	st.wantSettingsAck()
+	getSlash(st)
+	st.wantHeaders()
+	if df := st.wantData(); len(df.Data()) != window {
+		t.Fatalf("got DATA with %d bytes, want %d", len(df.Data()), window)
+	}
+	time.Sleep(delay)
+	if err := st.fr.WriteWindowUpdate(1, size-window); err != nil {
+		t.Fatal(err)
+	}
+	if df := st.wantData(); len(df.Data()) != size-window {
+		t.Fatalf("got DATA with %d bytes, want %d", len(df.Data()), size-window)
+	}
+
+	select {
+	case s := <-stalls:
+		if s.StreamID != 1 || s.Conn || s.Duration < delay {
+			t.Errorf("FlowControlStalled reported %+v; want stream 1 stalled on its own window for at least %v", s, delay)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("FlowControlStalled not called")
+	}
+	select {
+	case s := <-stalls:
+		t.Errorf("unexpected extra stall %+v", s)
+	default:
+	}
+}
+
+func TestServer_FlowControlStalledThenReset(t *testing.T) {
+	const window = 10
+	const delay = 20 * time.Millisecond
+	stalls := make(chan FlowControlStall, 10)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		w.Write(bytes.Repeat([]byte("a"), 3*window))
+	}, func(s *Server) {
+		s.FlowControlStalled = func(s FlowControlStall) { stalls <- s }
+	})
+	defer st.Close()
+	st.greet()
+
+	if err := st.fr.WriteSettings(Setting{SettingInitialWindowSize, window}); err != nil {
+		t.Fatal(err)
+	}
+	st.wantSettingsAck()
+	getSlash(st)
+	st.wantHeaders()
+	if df := st.wantData(); len(df.Data()) != window {
+		t.Fatalf("got DATA with %d bytes, want %d", len(df.Data()), window)
+	}
+	time.Sleep(delay)
+	if err := st.fr.WriteRSTStream(1, ErrCodeCancel); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case s := <-stalls:
+		if s.StreamID != 1 || s.Conn || s.Duration < delay {
+			t.Errorf("FlowControlStalled reported %+v; want stream 1 stalled on its own window for at least %v", s, delay)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("FlowControlStalled not called for a stream reset while stalled")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import "sync/atomic"
+
+// Stats holds counters of the traffic on a connection, for example to
+// export to a monitoring system. All counts are cumulative since the
+// connection was established.
+type Stats struct {
+	// BytesRead and BytesWritten are the total sizes of the frames
+	// read and written, including their 9-byte frame headers. They do
+	// not include the client connection preface.
+	BytesRead    int64
+	BytesWritten int64
+
+	// FramesRead and FramesWritten are the numbers of frames read and
+	// written, by frame type. Types with no frames are omitted.
+	FramesRead    map[FrameType]int64
+	FramesWritten map[FrameType]int64
+
+	// StreamsOpened is the number of streams opened on the
+	// connection: on a server, the streams opened by the client and
+	// those reserved by server push; on a client, the streams of its
+	// requests.
+	StreamsOpened int64
+
+	// GoAwaysSent and GoAwaysReceived are the numbers of GOAWAY
+	// frames sent and received.
+	GoAwaysSent     int64
+	GoAwaysReceived int64
+}
+
+// connStats accumulates the Stats of a connection. Its fields are
+// accessed atomically, so it may be read while frames are being read
+// and written.
+type connStats struct {
+	bytesRead     int64
+	bytesWritten  int64
+	streamsOpened int64
+
+	// Indexed by FrameType, so that frames of unknown types are
+	// counted too.
+	framesRead    [256]int64
+	framesWritten [256]int64
+}
+
+func (s *connStats) read(t FrameType, length uint32) {
+	atomic.AddInt64(&s.bytesRead, frameHeaderLen+int64(length))
+	atomic.AddInt64(&s.framesRead[t], 1)
+}
+
+func (s *connStats) wrote(t FrameType, n int) {
+	atomic.AddInt64(&s.bytesWritten, int64(n))
+	atomic.AddInt64(&s.framesWritten[t], 1)
+}
+
+func (s *connStats) openedStream() {
+	atomic.AddInt64(&s.streamsOpened, 1)
+}
+
+func (s *connStats) snapshot() Stats {
+	st := Stats{
+		BytesRead:     atomic.LoadInt64(&s.bytesRead),
+		BytesWritten:  atomic.LoadInt64(&s.bytesWritten),
+		FramesRead:    make(map[FrameType]int64),
+		FramesWritten: make(map[FrameType]int64),
+		StreamsOpened: atomic.LoadInt64(&s.streamsOpened),
+	}
+	for t := range s.framesRead {
+		if n := atomic.LoadInt64(&s.framesRead[t]); n != 0 {
+			st.FramesRead[FrameType(t)] = n
+		}
+		if n := atomic.LoadInt64(&s.framesWritten[t]); n != 0 {
+			st.FramesWritten[FrameType(t)] = n
+		}
+	}
+	st.GoAwaysSent = st.FramesWritten[FrameGoAway]
+	st.GoAwaysReceived = st.FramesRead[FrameGoAway]
+	return st
+}
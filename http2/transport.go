@@ -63,6 +63,14 @@ const (
 //
 // A Transport internally caches connections to servers. It is safe
 // for concurrent use by multiple goroutines.
+//
+// A CONNECT request whose Header[":protocol"] is set is sent as an
+// extended CONNECT request (RFC 8441), which bootstraps the named
+// protocol, such as "websocket", over a single stream. Unlike for a
+// plain CONNECT request, its :scheme and :path are taken from URL.
+// The Transport waits for the server's SETTINGS, and fails the
+// request with ErrExtendedConnectNotSupported if the server did not
+// enable SETTINGS_ENABLE_CONNECT_PROTOCOL.
 type Transport struct {
 	// DialTLSContext specifies an optional dial function with context for
 	// creating TLS connections for requests.
@@ -83,10 +91,38 @@ type Transport struct {
 	// If both are set, DialTLSContext takes priority.
 	DialTLS func(network, addr string, cfg *tls.Config) (net.Conn, error)
 
+	// DialContext, if non-nil, specifies the dial function for
+	// creating connections for requests, in place of DialTLSContext,
+	// DialTLS and tls.Dial. The returned net.Conn is used as is: the
+	// Transport does not perform a TLS handshake or check the
+	// negotiated protocol, and speaks HTTP/2 on it right away. This
+	// allows running HTTP/2 over any transport, such as a Unix socket,
+	// an in-memory pipe or an already established TLS connection.
+	// Combined with AllowHTTP, it provides h2c with prior knowledge
+	// for "http" requests.
+	//
+	// As with DialTLSContext, if the returned net.Conn has a
+	// ConnectionState method like tls.Conn, it is used to set
+	// http.Response.TLS.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
 	// TLSClientConfig specifies the TLS configuration to use with
 	// tls.Client. If nil, the default configuration is used.
 	TLSClientConfig *tls.Config
 
+	// GetTLSConfig, if non-nil, returns the TLS configuration to use
+	// for a new connection to host, the host of the request URL
+	// without its port, in place of TLSClientConfig. It allows
+	// connections to different hosts to use, for example, different
+	// client certificates or ServerName values. If it returns nil,
+	// TLSClientConfig is used.
+	//
+	// The returned configuration is not modified: as with
+	// TLSClientConfig, the Transport dials with a copy that offers
+	// the "h2" protocol through ALPN and whose ServerName defaults
+	// to host.
+	GetTLSConfig func(host string) *tls.Config
+
 	// ConnPool optionally specifies an alternate connection pool to use.
 	// If nil, the default is used.
 	ConnPool ClientConnPool
@@ -102,7 +138,8 @@ type Transport struct {
 	DisableCompression bool
 
 	// AllowHTTP, if true, permits HTTP/2 requests using the insecure,
-	// plain-text "http" scheme. Note that this does not enable h2c support.
+	// plain-text "http" scheme. Note that this does not enable h2c
+	// support by itself; see DialContext.
 	AllowHTTP bool
 
 	// MaxHeaderListSize is the http2 SETTINGS_MAX_HEADER_LIST_SIZE to
@@ -114,6 +151,15 @@ type Transport struct {
 	// to mean no limit.
 	MaxHeaderListSize uint32
 
+	// MaxRequestHeaderListSize, if non-zero, is the largest header
+	// list, and the largest trailer list, the Transport sends in a
+	// request, measured as for SETTINGS_MAX_HEADER_LIST_SIZE. The
+	// server's advertised SETTINGS_MAX_HEADER_LIST_SIZE is always
+	// honored, so the smaller of the two applies. A request whose
+	// headers are too large fails with a *HeaderListSizeError before
+	// they are sent.
+	MaxRequestHeaderListSize uint32
+
 	// MaxReadFrameSize is the http2 SETTINGS_MAX_FRAME_SIZE to send in the
 	// initial settings frame. It is the size in bytes of the largest frame
 	// payload that the sender is willing to receive. If 0, no setting is
@@ -123,11 +169,61 @@ type Transport struct {
 	// Values are bounded in the range 16k to 16M.
 	MaxReadFrameSize uint32
 
+	// ReadBufferSize is the size of the buffer through which each
+	// connection is read. A larger buffer reduces the number of reads
+	// on busy connections, but is held by every connection, even idle
+	// ones. If zero, a default (currently 4KB) is used.
+	ReadBufferSize int
+
+	// PoolReadBuffers, if true, reads the payload of each frame into a
+	// buffer taken from a pool shared by all connections, which is
+	// returned to the pool once the frame has been handled. Otherwise,
+	// each connection reads frames into a buffer of its own, which
+	// grows to the largest frame received and is kept for the life of
+	// the connection. Pooling saves memory when there are many
+	// connections, most of them idle, as a connection waiting for a
+	// frame holds no buffer; it costs a pool round trip per frame,
+	// which busy connections with large frames may notice.
+	PoolReadBuffers bool
+
+	// MaxReceiveBufferPerConnection is the size of the initial
+	// connection-level flow control window the Transport advertises,
+	// with a WINDOW_UPDATE frame on stream 0 sent after the preface.
+	// It bounds how much response body data the server may send on
+	// all of a connection's streams before it is read, and so the
+	// memory the connection's unread response bodies take; each
+	// stream is also limited to 4MB. As the server sends at most one
+	// window of data per round trip, a download over a 100ms round
+	// trip with a 1MB window is limited to about 10MB/s. See
+	// Server.MaxUploadBufferPerConnection for the other direction.
+	// The HTTP/2 spec does not allow a window smaller than 65535. If
+	// the value is smaller, a default of 1GB is used.
+	MaxReceiveBufferPerConnection int32
+
+	// AutoTuneWindow, if true, grows the flow control windows of each
+	// connection to fit its bandwidth-delay product. While response
+	// bodies arrive, the Transport measures the round-trip time with
+	// PING frames and counts the bytes received during a round trip.
+	// When they fill most of a stream's window, the windows of the
+	// streams, and that of the connection if it is smaller, are
+	// enlarged with WINDOW_UPDATE frames. Windows start at 4MB per
+	// stream and MaxReceiveBufferPerConnection per connection and
+	// never shrink.
+	AutoTuneWindow bool
+
+	// MaxAutoTuneWindow limits the windows grown by AutoTuneWindow.
+	// If zero, 16MB is used.
+	MaxAutoTuneWindow int32
+
 	// MaxDecoderHeaderTableSize optionally specifies the http2
 	// SETTINGS_HEADER_TABLE_SIZE to send in the initial settings frame. It
 	// informs the remote endpoint of the maximum size of the header compression
 	// table used to decode header blocks, in octets. If zero, the default value
 	// of 4096 is used.
+	//
+	// Together with MaxEncoderHeaderTableSize, it bounds the HPACK state
+	// kept for each connection: smaller tables use less memory at the cost
+	// of less compression of repeated headers.
 	MaxDecoderHeaderTableSize uint32
 
 	// MaxEncoderHeaderTableSize optionally specifies an upper limit for the
@@ -136,6 +232,12 @@ type Transport struct {
 	// the default value of 4096 is used.
 	MaxEncoderHeaderTableSize uint32
 
+	// DisableHuffmanEncoding, if true, sends the names and values of
+	// request headers as raw literals instead of Huffman-coding them.
+	// This saves CPU time at the cost of larger HEADERS frames; see
+	// hpack.Encoder.SetHuffmanEncoding.
+	DisableHuffmanEncoding bool
+
 	// StrictMaxConcurrentStreams controls whether the server's
 	// SETTINGS_MAX_CONCURRENT_STREAMS should be respected
 	// globally. If false, new TCP connections are created to the
@@ -146,6 +248,51 @@ type Transport struct {
 	// waiting for their turn.
 	StrictMaxConcurrentStreams bool
 
+	// MaxConcurrentStreams optionally limits the number of streams
+	// the Transport opens on each connection to less than the
+	// server's SETTINGS_MAX_CONCURRENT_STREAMS. Requests over the
+	// limit are handled as if the server had advertised it: they
+	// are sent on another connection or, if
+	// StrictMaxConcurrentStreams is set, wait for a stream on the
+	// connection to finish. If zero, only the server's limit
+	// applies.
+	MaxConcurrentStreams uint32
+
+	// MaxConnsPerHost optionally limits the number of connections
+	// the Transport keeps open to each host, including connections
+	// being dialed. When the limit is reached and no connection can
+	// take another stream, RoundTrip waits for a stream to finish or
+	// a connection to close, or for the request's context to be done.
+	// Zero means no limit.
+	//
+	// MaxConnsPerHost only applies to connections dialed by the
+	// Transport's default connection pool. It does not count
+	// connections used for a single request, such as for requests
+	// with "Connection: close", nor connections created by an
+	// http.Transport configured by ConfigureTransport, which has
+	// its own MaxConnsPerHost.
+	MaxConnsPerHost int
+
+	// MaxRetries is the maximum number of times RoundTrip retries a
+	// request the server did not process: a request whose stream was
+	// refused with REFUSED_STREAM, or whose stream was above the last
+	// stream ID of a GOAWAY frame. Such requests are safe to retry
+	// whatever their method. A request is only retried if its body is
+	// empty or can be re-sent using Request.GetBody. Retries after the
+	// first wait with exponential backoff.
+	//
+	// A connection that refused a stream remains in use, so the
+	// request is retried on it if it can still take new requests.
+	//
+	// If zero, 7 is used. If negative, requests are not retried.
+	//
+	// Requests that never reached the server because their connection
+	// became unusable before they were written to it, as when
+	// requests racing for a new connection find it closed or shut
+	// down with GOAWAY, are retried separately: right away, up to
+	// 10 times whatever MaxRetries, and without counting towards it.
+	MaxRetries int
+
 	// ReadIdleTimeout is the timeout after which a health check using ping
 	// frame will be carried out if no frame is received on the connection.
 	// Note that a ping response will is considered a received frame, so if
@@ -159,6 +306,15 @@ type Transport struct {
 	// Defaults to 15s.
 	PingTimeout time.Duration
 
+	// PingInterval, if nonzero, is the interval at which a health
+	// check ping is sent on each connection, regardless of whether
+	// frames are being received. Unlike ReadIdleTimeout, it detects
+	// connections which are half-open behind a middlebox that keeps
+	// no state but still delivers traffic in one direction.
+	// The connection is closed if a response to a ping is not
+	// received within PingTimeout.
+	PingInterval time.Duration
+
 	// WriteByteTimeout is the timeout after which the connection will be
 	// closed no data can be written to it. The timeout begins when data is
 	// available to write, and is extended whenever any bytes are written.
@@ -170,6 +326,71 @@ type Transport struct {
 	// The errType consists of only ASCII word characters.
 	CountError func(errType string)
 
+	// Logger, if non-nil, receives the messages the Transport logs
+	// instead of the standard logger.
+	Logger Logger
+
+	// OnFrame, if non-nil, is called with each frame the Transport
+	// reads from or writes to a connection, for debugging and
+	// tracing. Frames read are reported after they are parsed and
+	// before they are processed; frames written are reported just
+	// before they are written. See FrameRead and FrameWritten.
+	// The frame is a copy: the callback may retain it, and
+	// modifying it has no effect on the connection. OnFrame is called
+	// synchronously from the connection's goroutines, possibly
+	// concurrently, and must not block.
+	// When OnFrame is nil, frames are not copied.
+	OnFrame func(dir FrameDirection, f Frame)
+
+	// SettingsChanged, if non-nil, is called each time a ClientConn
+	// processes a SETTINGS frame from the server, after the new
+	// settings have taken effect. The state reports, among other
+	// things, whether the server has asked the connection to drain
+	// by setting SETTINGS_MAX_CONCURRENT_STREAMS to zero.
+	// It is called from the connection's read loop and must not block.
+	SettingsChanged func(cc *ClientConn, state ClientConnState)
+
+	// OnConnClose, if non-nil, is called once when a ClientConn
+	// closes, after it has been removed from the connection pool and
+	// its in-flight requests have failed. The err describes why the
+	// connection closed: for example, it reports that the connection
+	// was lost when a health check ping was not answered in time.
+	// It is called from the connection's read loop and must not block.
+	OnConnClose func(cc *ClientConn, err error)
+
+	// Got1xxResponse, if non-nil, is called for each informational
+	// (1xx) response that the server sends before the final response
+	// to req, such as a 103 Early Hints response (RFC 8297) whose Link
+	// headers let the caller start preloading resources. It is called
+	// before the Got1xxResponse hook of any httptrace.ClientTrace of
+	// the request, which is still called. If it returns an error, the
+	// request is aborted with that error.
+	// It is called from the connection's read loop and must not block.
+	Got1xxResponse func(req *http.Request, code int, header http.Header) error
+
+	// FlowControlStalled, if non-nil, is called each time a request
+	// body could not be sent for a while because the server's stream
+	// or connection flow-control window was exhausted, once the
+	// window reopens or the request ends.
+	// It is intended for diagnostics and must not block.
+	FlowControlStalled func(FlowControlStall)
+
+	// OnStreamSlotWait, if non-nil, is called when a request finds
+	// that its connection already has as many open streams as the
+	// server allows, and again when the request stops waiting for one
+	// of them to end, either to open its stream or because it failed.
+	// Requests wait this way mostly when StrictMaxConcurrentStreams
+	// is set; otherwise, the connection pool dials another connection
+	// instead. See StreamSlotWait.
+	// It is intended for diagnostics and must not block.
+	OnStreamSlotWait func(StreamSlotWait)
+
+	// OnRetry, if non-nil, is called when RoundTrip is about to
+	// retry a request, to tell whether and why requests are sent
+	// more than once. See RequestRetry.
+	// It must not block.
+	OnRetry func(RequestRetry)
+
 	// t1, if non-nil, is the standard library Transport using
 	// this transport. Its settings are used (but not its
 	// RoundTrip method, etc).
@@ -300,6 +521,7 @@ type ClientConn struct {
 	// readLoop goroutine fields:
 	readerDone chan struct{} // closed on error
 	readerErr  error         // set before readerDone is closed
+	closeErr   error         // guarded by mu; the error passed to closeForError, if any
 
 	idleTimeout time.Duration // or 0 for never
 	idleTimer   *time.Timer
@@ -320,6 +542,8 @@ type ClientConn struct {
 	nextStreamID    uint32
 	pendingRequests int                       // requests blocked and waiting to be sent because len(streams) == maxConcurrentStreams
 	pings           map[[8]byte]chan struct{} // in flight ping data to notification channel
+	connRecvWindow  int32                     // size of the inflow window
+	bdp             *bdpEstimator             // nil unless Transport.AutoTuneWindow
 	br              *bufio.Reader
 	lastActive      time.Time
 	lastIdle        time.Time // time last idle
@@ -329,6 +553,9 @@ type ClientConn struct {
 	peerMaxHeaderListSize  uint64
 	peerMaxHeaderTableSize uint32
 	initialWindowSize      uint32
+	extendedConnectAllowed bool          // SETTINGS_ENABLE_CONNECT_PROTOCOL is 1
+	seenSettingsChan       chan struct{} // closed once seenSettings is set, or the conn closes
+	noSettingsErr          error         // why the conn closed before SETTINGS arrived, if it did
 
 	// reqHeaderMu is a 1-element semaphore channel controlling access to sending new requests.
 	// Write to reqHeaderMu to lock it, read from it to unlock.
@@ -344,6 +571,9 @@ type ClientConn struct {
 	werr error        // first write error that has occurred
 	hbuf bytes.Buffer // HPACK encoder writes into this
 	henc *hpack.Encoder
+
+	headerStats *headerStats // see ClientConn.HeaderStats
+	stats       *connStats   // see ClientConn.Stats
 }
 
 // clientStream is the state for a single HTTP/2 stream. One of these
@@ -355,6 +585,8 @@ type clientStream struct {
 	ctx       context.Context
 	reqCancel <-chan struct{}
 
+	req *http.Request // for Transport.Got1xxResponse
+
 	trace         *httptrace.ClientTrace // or nil
 	ID            uint32
 	bufPipe       pipe // buffered pipe with the flow-controlled response payload
@@ -374,6 +606,7 @@ type clientStream struct {
 
 	flow        outflow // guarded by cc.mu
 	inflow      inflow  // guarded by cc.mu
+	recvWindow  int32   // size of the inflow window; guarded by cc.mu
 	bytesRemain int64   // -1 means unknown; owned by transportResponseBody.Read
 	readErr     error   // sticky read error; owned by transportResponseBody.Read
 
@@ -383,7 +616,9 @@ type clientStream struct {
 
 	// owned by writeRequest:
 	sentEndStream bool // sent an END_STREAM flag to the peer
-	sentHeaders   bool
+	sentHeaders   bool // set with cc.wmu held
+
+	resetSent bool // sent a RST_STREAM frame; guarded by cc.wmu
 
 	// owned by clientConnReadLoop:
 	firstByte    bool  // got the first response byte
@@ -550,6 +785,7 @@ func (t *Transport) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Res
 	}
 
 	addr := authorityAddr(req.URL.Scheme, req.URL.Host)
+	connRaces := 0
 	for retry := 0; ; retry++ {
 		cc, err := t.connPool().GetClientConn(req, addr)
 		if err != nil {
@@ -559,12 +795,27 @@ func (t *Transport) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Res
 		reused := !atomic.CompareAndSwapUint32(&cc.reused, 0, 1)
 		traceGotConn(req, cc, reused)
 		res, err := cc.RoundTrip(req)
-		if err != nil && retry <= 6 {
+		if err == errClientConnUnusable && connRaces < maxConnRaceRetries {
+			// The connection became unusable before the request
+			// was written to it, so the server never saw the
+			// request: retry it at once, on another connection,
+			// without counting it as a retry.
+			roundTripErr := err
+			if req, err = shouldRetryRequest(req, err); err == nil {
+				connRaces++
+				retry--
+				t.vlogf("RoundTrip retrying after connection race: %v", roundTripErr)
+				t.reportRetry(req, roundTripErr, true)
+				continue
+			}
+		}
+		if err != nil && retry < t.maxRetries() {
 			roundTripErr := err
 			if req, err = shouldRetryRequest(req, err); err == nil {
 				// After the first retry, do exponential backoff with 10% jitter.
 				if retry == 0 {
 					t.vlogf("RoundTrip retrying after failure: %v", roundTripErr)
+					t.reportRetry(req, roundTripErr, false)
 					continue
 				}
 				backoff := float64(uint(1) << (uint(retry) - 1))
@@ -574,6 +825,7 @@ func (t *Transport) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Res
 				select {
 				case <-timer.C:
 					t.vlogf("RoundTrip retrying after failure: %v", roundTripErr)
+					t.reportRetry(req, roundTripErr, false)
 					continue
 				case <-req.Context().Done():
 					timer.Stop()
@@ -589,6 +841,55 @@ func (t *Transport) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Res
 	}
 }
 
+// maxConnRaceRetries is the number of times RoundTrip retries a
+// request whose connection became unusable before the request was
+// sent on it. The limit only matters if the server keeps shutting
+// down new connections.
+const maxConnRaceRetries = 10
+
+// A RequestRetry describes a request that RoundTrip is about to retry.
+// It is reported to Transport.OnRetry.
+type RequestRetry struct {
+	// Request is the request to be sent again. It is a copy of the
+	// original request if its body was reset with GetBody.
+	Request *http.Request
+
+	// Err is the error of the previous attempt.
+	Err error
+
+	// ConnRace reports whether the previous attempt failed because
+	// its connection became unusable, for example by being closed or
+	// receiving a GOAWAY frame, before the request was written to
+	// it. This happens when requests race for a new connection. The
+	// server did not receive the request.
+	//
+	// Otherwise, the request was sent, and the server indicated that
+	// it did not process it: by refusing its stream, by sending a
+	// GOAWAY frame whose last stream ID is below the request's, or by
+	// resetting its stream with PROTOCOL_ERROR.
+	ConnRace bool
+}
+
+func (t *Transport) reportRetry(req *http.Request, err error, connRace bool) {
+	if t.OnRetry != nil {
+		t.OnRetry(RequestRetry{Request: req, Err: err, ConnRace: connRace})
+	}
+}
+
+// isRefusedStreamError reports whether err is a REFUSED_STREAM
+// received from the peer.
+func isRefusedStreamError(err error) bool {
+	se, ok := err.(StreamError)
+	return ok && se.Code == ErrCodeRefusedStream && se.Cause == errFromPeer
+}
+
+func (t *Transport) maxRetries() int {
+	if t.MaxRetries == 0 {
+		return 7
+	}
+	return t.MaxRetries
+}
+
 // CloseIdleConnections closes any connections which were previously
 // connected from previous requests but are now sitting idle.
 // It does not interrupt any connections currently in use.
@@ -604,6 +905,11 @@ var (
 	errClientConnGotGoAway = errors.New("http2: Transport received Server's graceful shutdown GOAWAY")
 )
 
+// ErrExtendedConnectNotSupported is returned by RoundTrip for an
+// extended CONNECT request when the server does not support the
+// extended CONNECT protocol of RFC 8441.
+var ErrExtendedConnectNotSupported = errors.New("http2: server does not support extended CONNECT")
+
 // shouldRetryRequest is called by RoundTrip when a request fails to get
 // response headers. It is always called with a non-nil error.
 // It returns either a request to retry (either the same request, or a
@@ -637,11 +943,14 @@ func shouldRetryRequest(req *http.Request, err error) (*http.Request, error) {
 		return req, nil
 	}
 
-	return nil, fmt.Errorf("http2: Transport: cannot retry err [%v] after Request.Body was written; define Request.GetBody to avoid this error", err)
+	return nil, fmt.Errorf("http2: Transport: cannot retry err [%w] after Request.Body was written; define Request.GetBody to avoid this error", err)
 }
 
 func canRetryError(err error) bool {
-	if err == errClientConnUnusable || err == errClientConnGotGoAway {
+	if err == errClientConnUnusable {
+		return true
+	}
+	if _, ok := err.(goAwayStreamError); ok {
 		return true
 	}
 	if se, ok := err.(StreamError); ok {
@@ -659,7 +968,12 @@ func (t *Transport) dialClientConn(ctx context.Context, addr string, singleUse b
 	if err != nil {
 		return nil, err
 	}
-	tconn, err := t.dialTLS(ctx, "tcp", addr, t.newTLSConfig(host))
+	var tconn net.Conn
+	if t.DialContext != nil {
+		tconn, err = t.DialContext(ctx, "tcp", addr)
+	} else {
+		tconn, err = t.dialTLS(ctx, "tcp", addr, t.newTLSConfig(host))
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -667,9 +981,15 @@ func (t *Transport) dialClientConn(ctx context.Context, addr string, singleUse b
 }
 
 func (t *Transport) newTLSConfig(host string) *tls.Config {
+	base := t.TLSClientConfig
+	if t.GetTLSConfig != nil {
+		if c := t.GetTLSConfig(host); c != nil {
+			base = c
+		}
+	}
 	cfg := new(tls.Config)
-	if t.TLSClientConfig != nil {
-		*cfg = *t.TLSClientConfig.Clone()
+	if base != nil {
+		*cfg = *base.Clone()
 	}
 	if !strSliceContains(cfg.NextProtos, NextProtoTLS) {
 		cfg.NextProtos = append([]string{NextProtoTLS}, cfg.NextProtos...)
@@ -714,6 +1034,13 @@ func (t *Transport) expectContinueTimeout() time.Duration {
 	return t.t1.ExpectContinueTimeout
 }
 
+func (t *Transport) initialConnRecvWindowSize() int32 {
+	if t.MaxReceiveBufferPerConnection >= initialWindowSize {
+		return t.MaxReceiveBufferPerConnection
+	}
+	return transportDefaultConnFlow + initialWindowSize
+}
+
 func (t *Transport) maxDecoderHeaderTableSize() uint32 {
 	if v := t.MaxDecoderHeaderTableSize; v > 0 {
 		return v
@@ -747,6 +1074,7 @@ func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, erro
 		wantSettingsAck:       true,
 		pings:                 make(map[[8]byte]chan struct{}),
 		reqHeaderMu:           make(chan struct{}, 1),
+		seenSettingsChan:      make(chan struct{}),
 	}
 	if d := t.idleConnTimeout(); d != 0 {
 		cc.idleTimeout = d
@@ -766,20 +1094,35 @@ func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, erro
 		timeout: t.WriteByteTimeout,
 		err:     &cc.werr,
 	})
-	cc.br = bufio.NewReader(c)
+	if t.ReadBufferSize > 0 {
+		cc.br = bufio.NewReaderSize(c, t.ReadBufferSize)
+	} else {
+		cc.br = bufio.NewReader(c)
+	}
 	cc.fr = NewFramer(cc.bw, cc.br)
+	cc.fr.poolReadBuf = t.PoolReadBuffers
 	if t.maxFrameReadSize() != 0 {
 		cc.fr.SetMaxReadFrameSize(t.maxFrameReadSize())
 	}
 	if t.CountError != nil {
 		cc.fr.countError = t.CountError
 	}
+	if t.Logger != nil {
+		cc.fr.debugReadLoggerf = t.vlogf
+		cc.fr.debugWriteLoggerf = t.vlogf
+	}
+	cc.fr.onFrame = t.OnFrame
+	cc.headerStats = new(headerStats)
+	cc.fr.headerStats = cc.headerStats
+	cc.stats = new(connStats)
+	cc.fr.stats = cc.stats
 	maxHeaderTableSize := t.maxDecoderHeaderTableSize()
 	cc.fr.ReadMetaHeaders = hpack.NewDecoder(maxHeaderTableSize, nil)
 	cc.fr.MaxHeaderListSize = t.maxHeaderListSize()
 
 	cc.henc = hpack.NewEncoder(&cc.hbuf)
 	cc.henc.SetMaxDynamicTableSizeLimit(t.maxEncoderHeaderTableSize())
+	cc.henc.SetHuffmanEncoding(!t.DisableHuffmanEncoding)
 	cc.peerMaxHeaderTableSize = initialHeaderTableSize
 
 	if t.AllowHTTP {
@@ -807,8 +1150,15 @@ func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, erro
 
 	cc.bw.Write(clientPreface)
 	cc.fr.WriteSettings(initialSettings...)
-	cc.fr.WriteWindowUpdate(0, transportDefaultConnFlow)
-	cc.inflow.init(transportDefaultConnFlow + initialWindowSize)
+	connFlow := t.initialConnRecvWindowSize()
+	if diff := connFlow - initialWindowSize; diff > 0 {
+		cc.fr.WriteWindowUpdate(0, uint32(diff))
+	}
+	cc.inflow.init(connFlow)
+	cc.connRecvWindow = connFlow
+	if t.AutoTuneWindow {
+		cc.bdp = newBDPEstimator(transportDefaultStreamFlow, t.MaxAutoTuneWindow)
+	}
 	cc.bw.Flush()
 	if cc.werr != nil {
 		cc.Close()
@@ -816,9 +1166,26 @@ func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, erro
 	}
 
 	go cc.readLoop()
+	if d := t.PingInterval; d != 0 {
+		go cc.pingLoop(d)
+	}
 	return cc, nil
 }
 
+// pingLoop runs a health check every d until the connection closes.
+func (cc *ClientConn) pingLoop(d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-cc.readerDone:
+			return
+		case <-t.C:
+			cc.healthCheck()
+		}
+	}
+}
+
 func (cc *ClientConn) healthCheck() {
 	pingTimeout := cc.t.pingTimeout()
 	// We don't need to periodically ping in the health check, because the readLoop of ClientConn will
@@ -838,8 +1205,9 @@ func (cc *ClientConn) healthCheck() {
 // SetDoNotReuse marks cc as not reusable for future HTTP requests.
 func (cc *ClientConn) SetDoNotReuse() {
 	cc.mu.Lock()
-	defer cc.mu.Unlock()
 	cc.doNotReuse = true
+	cc.mu.Unlock()
+	cc.noteConnsChanged()
 }
 
 func (cc *ClientConn) setGoAway(f *GoAwayFrame) {
@@ -857,9 +1225,14 @@ func (cc *ClientConn) setGoAway(f *GoAwayFrame) {
 		cc.goAway.ErrCode = old.ErrCode
 	}
 	last := f.LastStreamID
+	err := goAwayStreamError{GoAwayError{
+		LastStreamID: last,
+		ErrCode:      cc.goAway.ErrCode,
+		DebugData:    cc.goAwayDebug,
+	}}
 	for streamID, cs := range cc.streams {
 		if streamID > last {
-			cs.abortStreamLocked(errClientConnGotGoAway)
+			cs.abortStreamLocked(err)
 		}
 	}
 }
@@ -916,18 +1289,35 @@ type ClientConnState struct {
 	// frame has been received yet.
 	MaxConcurrentStreams uint32
 
+	// PeerMaxFrameSize is the largest frame payload the peer
+	// accepts, as advertised by its SETTINGS_MAX_FRAME_SIZE. DATA
+	// frames sent on the connection are at most this size. It is
+	// 16384, the protocol default, until the peer advertises
+	// another value.
+	PeerMaxFrameSize uint32
+
+	// Draining is whether the peer has set its
+	// SETTINGS_MAX_CONCURRENT_STREAMS to zero. A draining
+	// connection accepts no new requests, but streams already
+	// open on it run to completion. The connection becomes
+	// usable again if the peer later raises the limit.
+	Draining bool
+
 	// LastIdle, if non-zero, is when the connection last
 	// transitioned to idle state.
 	LastIdle time.Time
 }
 
-// State returns a snapshot of cc's state.
+// State returns a snapshot of cc's state. It is safe to call while
+// requests are in flight on cc, for example to choose the least loaded
+// of several connections.
 func (cc *ClientConn) State() ClientConnState {
 	cc.wmu.Lock()
 	maxConcurrent := cc.maxConcurrentStreams
 	if !cc.seenSettings {
 		maxConcurrent = 0
 	}
+	peerMaxFrameSize := cc.maxFrameSize
 	cc.wmu.Unlock()
 
 	cc.mu.Lock()
@@ -938,11 +1328,32 @@ func (cc *ClientConn) State() ClientConnState {
 		StreamsActive:        len(cc.streams),
 		StreamsReserved:      cc.streamsReserved,
 		StreamsPending:       cc.pendingRequests,
+		Draining:             cc.drainingLocked(),
 		LastIdle:             cc.lastIdle,
 		MaxConcurrentStreams: maxConcurrent,
+		PeerMaxFrameSize:     peerMaxFrameSize,
 	}
 }
 
+// HeaderStats returns the raw and HPACK-encoded sizes of the headers
+// sent and received on cc. It is safe to call while requests are in
+// flight on cc.
+func (cc *ClientConn) HeaderStats() HeaderStats {
+	if cc.headerStats == nil {
+		return HeaderStats{}
+	}
+	return cc.headerStats.snapshot()
+}
+
+// Stats returns the counters of the traffic so far on cc. It is safe
+// to call while requests are in flight on cc.
+func (cc *ClientConn) Stats() Stats {
+	if cc.stats == nil {
+		return Stats{}
+	}
+	return cc.stats.snapshot()
+}
+
 // clientConnIdleState describes the suitability of a client
 // connection to initiate a new RoundTrip request.
 type clientConnIdleState struct {
@@ -967,11 +1378,11 @@ func (cc *ClientConn) idleStateLocked() (st clientConnIdleState) {
 		// writing it.
 		maxConcurrentOkay = true
 	} else {
-		maxConcurrentOkay = int64(len(cc.streams)+cc.streamsReserved+1) <= int64(cc.maxConcurrentStreams)
+		maxConcurrentOkay = int64(len(cc.streams)+cc.streamsReserved+1) <= int64(cc.maxConcurrentStreamsLocked())
 	}
 
 	st.canTakeNewRequest = cc.goAway == nil && !cc.closed && !cc.closing && maxConcurrentOkay &&
-		!cc.doNotReuse &&
+		!cc.doNotReuse && !cc.drainingLocked() &&
 		int64(cc.nextStreamID)+2*int64(cc.pendingRequests) < math.MaxInt32 &&
 		!cc.tooIdleLocked()
 	return
@@ -982,6 +1393,33 @@ func (cc *ClientConn) canTakeNewRequestLocked() bool {
 	return st.canTakeNewRequest
 }
 
+// maxConcurrentStreamsLocked returns how many streams cc may have
+// open at once: the peer's limit, capped by the Transport's.
+func (cc *ClientConn) maxConcurrentStreamsLocked() uint32 {
+	n := cc.maxConcurrentStreams
+	if max := cc.t.MaxConcurrentStreams; max > 0 && max < n {
+		n = max
+	}
+	return n
+}
+
+// drainingLocked reports whether the peer has asked us to stop opening
+// new streams by setting SETTINGS_MAX_CONCURRENT_STREAMS to zero.
+// Unlike a GOAWAY, this applies even when StrictMaxConcurrentStreams
+// is set, so that callers dial a new connection rather than wait.
+func (cc *ClientConn) drainingLocked() bool {
+	return cc.seenSettings && cc.maxConcurrentStreams == 0
+}
+
+// retiredLocked reports whether cc has stopped taking new requests for
+// good, or at least until the peer changes its settings, although it
+// may still be finishing the ones it has. Such connections stay in the
+// pool until they are closed, but don't count toward
+// Transport.MaxConnsPerHost.
+func (cc *ClientConn) retiredLocked() bool {
+	return cc.goAway != nil || cc.closed || cc.closing || cc.doNotReuse || cc.drainingLocked()
+}
+
 // tooIdleLocked reports whether this connection has been been sitting idle
 // for too much wall time.
 func (cc *ClientConn) tooIdleLocked() bool {
@@ -1046,6 +1484,14 @@ func (cc *ClientConn) isDoNotReuseAndIdle() bool {
 var shutdownEnterWaitStateHook = func() {}
 
 // Shutdown gracefully closes the client connection, waiting for running streams to complete.
+//
+// Shutdown sends a GOAWAY frame to the server and stops cc from
+// taking new requests: RoundTrip on cc then fails with an error which
+// the Transport treats as retryable, sending the request on another
+// connection instead. Once the in-flight streams have completed,
+// Shutdown closes the connection. If ctx is done first, Shutdown
+// returns ctx.Err() and leaves the connection open to finish the
+// remaining streams; call Close to interrupt them.
 func (cc *ClientConn) Shutdown(ctx context.Context) error {
 	if err := cc.sendGoAway(); err != nil {
 		return err
@@ -1112,6 +1558,9 @@ func (cc *ClientConn) sendGoAway() error {
 func (cc *ClientConn) closeForError(err error) {
 	cc.mu.Lock()
 	cc.closed = true
+	if cc.closeErr == nil {
+		cc.closeErr = err
+	}
 	for _, cs := range cc.streams {
 		cs.abortStreamLocked(err)
 	}
@@ -1170,6 +1619,12 @@ func (cc *ClientConn) responseHeaderTimeout() time.Duration {
 	return 0
 }
 
+// isExtendedConnect reports whether req is an extended CONNECT request,
+// as defined by RFC 8441.
+func isExtendedConnect(req *http.Request) bool {
+	return req.Method == "CONNECT" && req.Header.Get(":protocol") != ""
+}
+
 // checkConnHeaders checks whether req has any invalid connection-level headers.
 // per RFC 7540 section 8.1.2.2: Connection-Specific Header Fields.
 // Certain headers are special-cased as okay but not transmitted later.
@@ -1201,8 +1656,9 @@ func actualContentLength(req *http.Request) int64 {
 
 func (cc *ClientConn) decrStreamReservations() {
 	cc.mu.Lock()
-	defer cc.mu.Unlock()
 	cc.decrStreamReservationsLocked()
+	cc.mu.Unlock()
+	cc.noteConnsChanged()
 }
 
 func (cc *ClientConn) decrStreamReservationsLocked() {
@@ -1211,12 +1667,24 @@ func (cc *ClientConn) decrStreamReservationsLocked() {
 	}
 }
 
+// RoundTrip sends req on the connection and returns its response.
+//
+// Canceling the request, by canceling its context or closing its
+// Cancel channel, resets the stream with RST_STREAM(CANCEL) as soon as
+// the cancellation is seen, so that the server can stop working on
+// the request. The RST_STREAM is written from another goroutine, so
+// that neither RoundTrip nor the cancellation waits for a blocked
+// write to the connection, a blocked Read of the request body, or a
+// blocked Read of the response body. No RST_STREAM is sent if the
+// request headers were not sent yet, or if the server has already
+// ended the stream.
 func (cc *ClientConn) RoundTrip(req *http.Request) (*http.Response, error) {
 	ctx := req.Context()
 	cs := &clientStream{
 		cc:                   cc,
 		ctx:                  ctx,
 		reqCancel:            req.Cancel,
+		req:                  req,
 		isHead:               req.Method == "HEAD",
 		reqBody:              req.Body,
 		reqBodyContentLength: actualContentLength(req),
@@ -1270,7 +1738,7 @@ func (cc *ClientConn) RoundTrip(req *http.Request) (*http.Response, error) {
 		cs.cc.mu.Lock()
 		defer cs.cc.mu.Unlock()
 		cs.abortStreamLocked(err)
-		if cs.ID != 0 {
+		if cs.ID != 0 && !isRefusedStreamError(err) {
 			// This request may have failed because of a problem with the connection,
 			// or for some unrelated reason. (For example, the user might have canceled
 			// the request without waiting for a response.) Mark the connection as
@@ -1282,6 +1750,9 @@ func (cc *ClientConn) RoundTrip(req *http.Request) (*http.Response, error) {
 			// timed out waiting for a stream slot when StrictMaxConcurrentStreams
 			// is set, for example, in which case retrying on a different connection
 			// will not help.
+			//
+			// A stream the server refused shows that the connection works; the
+			// request is retried on it.
 			cs.cc.doNotReuse = true
 		}
 		return err
@@ -1304,9 +1775,15 @@ func (cc *ClientConn) RoundTrip(req *http.Request) (*http.Response, error) {
 				return nil, cancelRequest(cs, cs.abortErr)
 			}
 		case <-ctx.Done():
-			return nil, cancelRequest(cs, ctx.Err())
+			err := cancelRequest(cs, ctx.Err())
+			// Don't wait on cc.wmu, which may be held by a write
+			// blocked on a peer that isn't reading.
+			go cs.resetCanceled()
+			return nil, err
 		case <-cs.reqCancel:
-			return nil, cancelRequest(cs, errRequestCanceled)
+			err := cancelRequest(cs, errRequestCanceled)
+			go cs.resetCanceled()
+			return nil, err
 		}
 	}
 }
@@ -1334,12 +1811,36 @@ func (cs *clientStream) writeRequest(req *http.Request) (err error) {
 		return err
 	}
 
+	// An extended CONNECT request may only be sent once the server
+	// has enabled it in its SETTINGS.
+	if isExtendedConnect(req) {
+		select {
+		case <-cc.seenSettingsChan:
+		case <-cs.reqCancel:
+			return errRequestCanceled
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		cc.mu.Lock()
+		seen, allowed, connErr := cc.seenSettings, cc.extendedConnectAllowed, cc.noSettingsErr
+		cc.mu.Unlock()
+		if !seen {
+			// The connection closed before the server said
+			// whether it supports extended CONNECT.
+			return connErr
+		}
+		if !allowed {
+			return ErrExtendedConnectNotSupported
+		}
+	}
+
 	// Acquire the new-request lock by writing to reqHeaderMu.
 	// This lock guards the critical section covering allocating a new stream ID
 	// (requires mu) and creating the stream (requires wmu).
 	if cc.reqHeaderMu == nil {
 		panic("RoundTrip on uninitialized ClientConn") // for tests
 	}
+	waitStart := time.Now()
 	select {
 	case cc.reqHeaderMu <- struct{}{}:
 	case <-cs.reqCancel:
@@ -1353,8 +1854,12 @@ func (cs *clientStream) writeRequest(req *http.Request) (err error) {
 		cc.idleTimer.Stop()
 	}
 	cc.decrStreamReservationsLocked()
-	if err := cc.awaitOpenSlotForStreamLocked(cs); err != nil {
+	waited, err := cc.awaitOpenSlotForStreamLocked(cs)
+	if err != nil {
 		cc.mu.Unlock()
+		if waited {
+			cc.reportStreamSlotWait(cs, waitStart, err)
+		}
 		<-cc.reqHeaderMu
 		return err
 	}
@@ -1363,6 +1868,9 @@ func (cs *clientStream) writeRequest(req *http.Request) (err error) {
 		cc.doNotReuse = true
 	}
 	cc.mu.Unlock()
+	if waited {
+		cc.reportStreamSlotWait(cs, waitStart, nil)
+	}
 
 	// TODO(bradfitz): this is a copy of the logic in net/http. Unify somewhere?
 	if !cc.t.disableCompression() &&
@@ -1429,7 +1937,10 @@ func (cs *clientStream) writeRequest(req *http.Request) (err error) {
 			}
 		}
 
-		if err = cs.writeRequestBody(req); err != nil {
+		stop := cs.resetOnCancel()
+		err = cs.writeRequestBody(req)
+		stop()
+		if err != nil {
 			if err != errStopReqBodyWrite {
 				traceWroteRequest(cs.trace, err)
 				return err
@@ -1464,13 +1975,80 @@ func (cs *clientStream) writeRequest(req *http.Request) (err error) {
 		case <-cs.abort:
 			return cs.abortErr
 		case <-ctx.Done():
+			cs.resetCanceled()
 			return ctx.Err()
 		case <-cs.reqCancel:
+			cs.resetCanceled()
 			return errRequestCanceled
 		}
 	}
 }
 
+// resetOnCancel resets the stream as soon as the request is canceled,
+// until stop is called. It covers the writing of the request body,
+// during which writeRequest may be blocked reading the body and so
+// cannot watch for cancellation itself.
+func (cs *clientStream) resetOnCancel() (stop func()) {
+	ctx := cs.ctx
+	if ctx.Done() == nil && cs.reqCancel == nil {
+		return func() {}
+	}
+	donec := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			cs.abortStream(ctx.Err())
+		case <-cs.reqCancel:
+			cs.abortStream(errRequestCanceled)
+		case <-donec:
+			return
+		}
+		cs.resetCanceled()
+	}()
+	return func() {
+		close(donec)
+		<-exited
+	}
+}
+
+// resetCanceled sends RST_STREAM(CANCEL) for a canceled request right
+// away, rather than when cleanupWriteRequest runs, which can be
+// delayed by a blocked read of the request body. It does nothing if
+// the headers were not sent yet or the peer already ended the stream.
+func (cs *clientStream) resetCanceled() {
+	select {
+	case <-cs.peerClosed:
+		return
+	default:
+	}
+	cc := cs.cc
+	cc.wmu.Lock()
+	defer cc.wmu.Unlock()
+	if cs.sentHeaders {
+		cs.writeResetLocked(ErrCodeCancel)
+	}
+}
+
+// writeResetLocked sends a RST_STREAM frame with code for cs, unless
+// one was already sent. cc.wmu must be held.
+func (cs *clientStream) writeResetLocked(code ErrCode) {
+	if cs.resetSent {
+		return
+	}
+	cs.resetSent = true
+	cs.cc.fr.WriteRSTStream(cs.ID, code)
+	cs.cc.bw.Flush()
+}
+
+// writeReset is like writeResetLocked, but acquires cc.wmu.
+func (cs *clientStream) writeReset(code ErrCode) {
+	cs.cc.wmu.Lock()
+	defer cs.cc.wmu.Unlock()
+	cs.writeResetLocked(code)
+}
+
 func (cs *clientStream) encodeAndWriteHeaders(req *http.Request) error {
 	cc := cs.cc
 	ctx := cs.ctx
@@ -1561,16 +2139,16 @@ func (cs *clientStream) cleanupWriteRequest(err error) {
 		if cs.sentHeaders {
 			if se, ok := err.(StreamError); ok {
 				if se.Cause != errFromPeer {
-					cc.writeStreamReset(cs.ID, se.Code, err)
+					cs.writeReset(se.Code)
 				}
 			} else {
-				cc.writeStreamReset(cs.ID, ErrCodeCancel, err)
+				cs.writeReset(ErrCodeCancel)
 			}
 		}
 		cs.bufPipe.CloseWithError(err) // no-op if already closed
 	} else {
 		if cs.sentHeaders && !cs.sentEndStream {
-			cc.writeStreamReset(cs.ID, ErrCodeNo, nil)
+			cs.writeReset(ErrCodeNo)
 		}
 		cs.bufPipe.CloseWithError(errRequestCanceled)
 	}
@@ -1588,29 +2166,79 @@ func (cs *clientStream) cleanupWriteRequest(err error) {
 	close(cs.donec)
 }
 
-// awaitOpenSlotForStreamLocked waits until len(streams) < maxConcurrentStreams.
+// A StreamSlotWait describes a request waiting for the number of
+// streams open on its connection to fall below the server's
+// SETTINGS_MAX_CONCURRENT_STREAMS. It is reported to
+// Transport.OnStreamSlotWait when the request starts waiting, and when
+// it stops.
+type StreamSlotWait struct {
+	// Request is the waiting request.
+	Request *http.Request
+
+	// Done is false when the request starts waiting, and true when it
+	// stops.
+	Done bool
+
+	// Duration is how long the request waited, from when it was ready
+	// to be sent on the connection, which includes waiting behind
+	// other requests for the connection. It is zero until Done.
+	Duration time.Duration
+
+	// Err, when Done, is the reason the request stopped waiting
+	// without opening its stream, such as the request being canceled
+	// or the connection becoming unusable. It is nil if the stream
+	// was opened.
+	Err error
+}
+
+// awaitOpenSlotForStreamLocked waits until len(streams) < maxConcurrentStreamsLocked().
+// It reports whether it had to wait, in which case it has called
+// Transport.OnStreamSlotWait for the start of the wait.
 // Must hold cc.mu.
-func (cc *ClientConn) awaitOpenSlotForStreamLocked(cs *clientStream) error {
+func (cc *ClientConn) awaitOpenSlotForStreamLocked(cs *clientStream) (waited bool, err error) {
 	for {
 		cc.lastActive = time.Now()
 		if cc.closed || !cc.canTakeNewRequestLocked() {
-			return errClientConnUnusable
+			return waited, errClientConnUnusable
 		}
 		cc.lastIdle = time.Time{}
-		if int64(len(cc.streams)) < int64(cc.maxConcurrentStreams) {
-			return nil
+		if int64(len(cc.streams)) < int64(cc.maxConcurrentStreamsLocked()) {
+			return waited, nil
 		}
+		if !waited && cc.t.OnStreamSlotWait != nil {
+			// Report the wait without holding cc.mu, and check
+			// again, as a slot may have opened meanwhile.
+			waited = true
+			cc.mu.Unlock()
+			cc.t.OnStreamSlotWait(StreamSlotWait{Request: cs.req})
+			cc.mu.Lock()
+			continue
+		}
+		waited = true
 		cc.pendingRequests++
 		cc.cond.Wait()
 		cc.pendingRequests--
 		select {
 		case <-cs.abort:
-			return cs.abortErr
+			return waited, cs.abortErr
 		default:
 		}
 	}
 }
 
+// reportStreamSlotWait reports the end of the wait of cs for a stream
+// slot, which started at start, to Transport.OnStreamSlotWait.
+func (cc *ClientConn) reportStreamSlotWait(cs *clientStream, start time.Time, err error) {
+	if fn := cc.t.OnStreamSlotWait; fn != nil {
+		fn(StreamSlotWait{
+			Request:  cs.req,
+			Done:     true,
+			Duration: time.Since(start),
+			Err:      err,
+		})
+	}
+}
+
 // requires cc.wmu be held
 func (cc *ClientConn) writeHeaders(streamID uint32, endStream bool, maxFrameSize int, hdrs []byte) error {
 	first := true // first frame written (HEADERS is first, then CONTINUATION)
@@ -1674,6 +2302,91 @@ func (cs *clientStream) frameScratchBufferLen(maxFrameSize int) int {
 
 var bufPool sync.Pool // of *[]byte
 
+type sendRateLimitKey struct{}
+
+// WithSendRateLimit returns a copy of ctx that, when used as the context
+// of a request sent by the Transport, limits the rate at which the
+// request body is sent to bytesPerSecond on average.
+//
+// The limit paces the emission of DATA frames using a token bucket
+// holding up to a tenth of a second's worth of data, independent of
+// HTTP/2 flow control. It applies to each request separately; other
+// requests on the same connection are unaffected. A bytesPerSecond
+// of zero or less removes any limit set by a parent context.
+func WithSendRateLimit(ctx context.Context, bytesPerSecond int64) context.Context {
+	return context.WithValue(ctx, sendRateLimitKey{}, bytesPerSecond)
+}
+
+// sendRateLimiter is a token bucket pacing the DATA frames of a
+// single request body.
+type sendRateLimiter struct {
+	rate   float64 // bytes per second
+	burst  int     // bucket capacity, in bytes
+	tokens float64
+	last   time.Time
+}
+
+// newSendRateLimiter returns a limiter for the rate set in ctx by
+// WithSendRateLimit, or nil if there is none. Its bucket is full at
+// time now.
+func newSendRateLimiter(ctx context.Context, now time.Time) *sendRateLimiter {
+	rate, _ := ctx.Value(sendRateLimitKey{}).(int64)
+	if rate <= 0 {
+		return nil
+	}
+	burst := rate / 10
+	if burst < 1 {
+		burst = 1
+	}
+	if burst > math.MaxInt32 {
+		burst = math.MaxInt32
+	}
+	return &sendRateLimiter{
+		rate:   float64(rate),
+		burst:  int(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// reserve takes n tokens from the bucket at time now, which may go into
+// debt, and returns how long to wait before sending n bytes.
+func (l *sendRateLimiter) reserve(now time.Time, n int) time.Duration {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// awaitSendRateLimit waits until n more bytes of the request body
+// may be sent under limiter, or the stream is aborted. It is called
+// before taking flow control tokens, so that an aborted wait doesn't
+// leak them.
+func (cs *clientStream) awaitSendRateLimit(limiter *sendRateLimiter, n int) error {
+	d := limiter.reserve(time.Now(), n)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-cs.abort:
+		return cs.abortErr
+	case <-cs.ctx.Done():
+		return cs.ctx.Err()
+	case <-cs.reqCancel:
+		return errRequestCanceled
+	}
+}
+
 func (cs *clientStream) writeRequestBody(req *http.Request) (err error) {
 	cc := cs.cc
 	body := cs.reqBody
@@ -1687,6 +2400,8 @@ func (cs *clientStream) writeRequestBody(req *http.Request) (err error) {
 	maxFrameSize := int(cc.maxFrameSize)
 	cc.mu.Unlock()
 
+	limiter := newSendRateLimiter(cs.ctx, time.Now())
+
 	// Scratch buffer for reading into & writing from.
 	scratchLen := cs.frameScratchBufferLen(maxFrameSize)
 	var buf []byte
@@ -1739,11 +2454,29 @@ func (cs *clientStream) writeRequestBody(req *http.Request) (err error) {
 		remain := buf[:n]
 		for len(remain) > 0 && err == nil {
 			var allowed int32
-			allowed, err = cs.awaitFlowControl(len(remain))
+			maxBytes := len(remain)
+			if limiter != nil {
+				if maxBytes > limiter.burst {
+					maxBytes = limiter.burst
+				}
+				if err = cs.awaitSendRateLimit(limiter, maxBytes); err != nil {
+					return err
+				}
+			}
+			allowed, err = cs.awaitFlowControl(maxBytes)
 			if err != nil {
 				return err
 			}
+			if limiter != nil {
+				// Give back what flow control didn't let us send.
+				limiter.tokens += float64(maxBytes - int(allowed))
+			}
 			cc.wmu.Lock()
+			if cs.resetSent {
+				// Canceled while waiting; see resetOnCancel.
+				cc.wmu.Unlock()
+				return errStopReqBodyWrite
+			}
 			data := remain[:allowed]
 			remain = remain[allowed:]
 			sentEnd = sawEOF && len(remain) == 0 && !hasTrailers
@@ -1784,6 +2517,9 @@ func (cs *clientStream) writeRequestBody(req *http.Request) (err error) {
 
 	cc.wmu.Lock()
 	defer cc.wmu.Unlock()
+	if cs.resetSent {
+		return errStopReqBodyWrite
+	}
 	var trls []byte
 	if len(trailer) > 0 {
 		trls, err = cc.encodeTrailers(trailer)
@@ -1812,6 +2548,17 @@ func (cs *clientStream) writeRequestBody(req *http.Request) (err error) {
 func (cs *clientStream) awaitFlowControl(maxBytes int) (taken int32, err error) {
 	cc := cs.cc
 	ctx := cs.ctx
+	var stall FlowControlStall
+	var stallStart time.Time
+	if fn := cc.t.FlowControlStalled; fn != nil {
+		// Deferred before the unlock below, so this runs without cc.mu held.
+		defer func() {
+			if !stallStart.IsZero() {
+				stall.Duration = time.Since(stallStart)
+				fn(stall)
+			}
+		}()
+	}
 	cc.mu.Lock()
 	defer cc.mu.Unlock()
 	for {
@@ -1842,6 +2589,10 @@ func (cs *clientStream) awaitFlowControl(maxBytes int) (taken int32, err error)
 			cs.flow.take(take)
 			return take, nil
 		}
+		if stallStart.IsZero() && cc.t.FlowControlStalled != nil {
+			stallStart = time.Now()
+			stall = FlowControlStall{StreamID: cs.ID, Conn: cs.flow.connStalled()}
+		}
 		cc.cond.Wait()
 	}
 }
@@ -1864,8 +2615,9 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 		return nil, err
 	}
 
+	extendedConnect := isExtendedConnect(req)
 	var path string
-	if req.Method != "CONNECT" {
+	if req.Method != "CONNECT" || extendedConnect {
 		path = req.URL.RequestURI()
 		if !validPseudoPath(path) {
 			orig := path
@@ -1884,7 +2636,7 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 	// potentially pollute our hpack state. (We want to be able to
 	// continue to reuse the hpack encoder for future requests)
 	for k, vv := range req.Header {
-		if !httpguts.ValidHeaderFieldName(k) {
+		if !httpguts.ValidHeaderFieldName(k) && !(k == ":protocol" && extendedConnect) {
 			return nil, fmt.Errorf("invalid HTTP header name %q", k)
 		}
 		for _, v := range vv {
@@ -1907,19 +2659,23 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 			m = http.MethodGet
 		}
 		f(":method", m)
-		if req.Method != "CONNECT" {
+		if req.Method != "CONNECT" || extendedConnect {
 			f(":path", path)
 			f(":scheme", req.URL.Scheme)
 		}
+		if extendedConnect {
+			f(":protocol", req.Header.Get(":protocol"))
+		}
 		if trailers != "" {
 			f("trailer", trailers)
 		}
 
 		var didUA bool
 		for k, vv := range req.Header {
-			if asciiEqualFold(k, "host") || asciiEqualFold(k, "content-length") {
+			if asciiEqualFold(k, "host") || asciiEqualFold(k, "content-length") || k == ":protocol" {
 				// Host is :authority, already sent.
 				// Content-Length is automatic, set below.
+				// :protocol is a pseudo-header, already sent.
 				continue
 			} else if asciiEqualFold(k, "connection") ||
 				asciiEqualFold(k, "proxy-connection") ||
@@ -1982,6 +2738,9 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 		if !didUA {
 			f("user-agent", defaultUserAgent)
 		}
+		if p, ok := requestStreamPriority(req); ok {
+			f("priority", p.String())
+		}
 	}
 
 	// Do a first pass over the headers counting bytes to ensure
@@ -1994,8 +2753,8 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 		hlSize += uint64(hf.Size())
 	})
 
-	if hlSize > cc.peerMaxHeaderListSize {
-		return nil, errRequestHeaderListSize
+	if err := cc.checkRequestHeaderListSize(hlSize); err != nil {
+		return nil, err
 	}
 
 	trace := httptrace.ContextClientTrace(req.Context())
@@ -2018,6 +2777,20 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 	return cc.hbuf.Bytes(), nil
 }
 
+// checkRequestHeaderListSize returns a *HeaderListSizeError if a request
+// header or trailer list of the given size may not be sent.
+func (cc *ClientConn) checkRequestHeaderListSize(size uint64) error {
+	if size > cc.peerMaxHeaderListSize {
+		return &HeaderListSizeError{Size: size, Limit: cc.peerMaxHeaderListSize, Peer: true}
+	}
+	if cc.t != nil && cc.t.MaxRequestHeaderListSize != 0 {
+		if limit := uint64(cc.t.MaxRequestHeaderListSize); size > limit {
+			return &HeaderListSizeError{Size: size, Limit: limit}
+		}
+	}
+	return nil
+}
+
 // shouldSendReqContentLength reports whether the http2.Transport should send
 // a "content-length" request header. This logic is basically a copy of the net/http
 // transferWriter.shouldSendContentLength.
@@ -2051,8 +2824,8 @@ func (cc *ClientConn) encodeTrailers(trailer http.Header) ([]byte, error) {
 			hlSize += uint64(hf.Size())
 		}
 	}
-	if hlSize > cc.peerMaxHeaderListSize {
-		return nil, errRequestHeaderListSize
+	if err := cc.checkRequestHeaderListSize(hlSize); err != nil {
+		return nil, err
 	}
 
 	for k, vv := range trailer {
@@ -2073,9 +2846,13 @@ func (cc *ClientConn) encodeTrailers(trailer http.Header) ([]byte, error) {
 
 func (cc *ClientConn) writeHeader(name, value string) {
 	if VerboseLogs {
-		log.Printf("http2: Transport encoding header %q = %q", name, value)
+		cc.vlogf("http2: Transport encoding header %q = %q", name, value)
 	}
+	n := cc.hbuf.Len()
 	cc.henc.WriteField(hpack.HeaderField{Name: name, Value: value})
+	if cc.headerStats != nil {
+		cc.headerStats.sent(len(name)+len(value), cc.hbuf.Len()-n)
+	}
 }
 
 type resAndError struct {
@@ -2089,8 +2866,12 @@ func (cc *ClientConn) addStreamLocked(cs *clientStream) {
 	cs.flow.add(int32(cc.initialWindowSize))
 	cs.flow.setConnFlow(&cc.flow)
 	cs.inflow.init(transportDefaultStreamFlow)
+	cs.recvWindow = transportDefaultStreamFlow
 	cs.ID = cc.nextStreamID
 	cc.nextStreamID += 2
+	if cc.stats != nil {
+		cc.stats.openedStream()
+	}
 	cc.streams[cs.ID] = cs
 	if cs.ID == 0 {
 		panic("assigned stream ID 0")
@@ -2123,6 +2904,23 @@ func (cc *ClientConn) forgetStreamID(id uint32) {
 	}
 
 	cc.mu.Unlock()
+	cc.noteConnsChanged()
+}
+
+// noteConnsChanged wakes up requests waiting in the connection pool
+// because their host has reached Transport.MaxConnsPerHost, after a
+// stream or stream reservation of cc has gone away, or cc may have
+// stopped taking new requests.
+// cc.mu must not be held.
+func (cc *ClientConn) noteConnsChanged() {
+	if cc.t == nil || cc.t.MaxConnsPerHost <= 0 {
+		return
+	}
+	if p, ok := cc.t.connPool().(*clientConnPool); ok {
+		p.mu.Lock()
+		p.connsChangedLocked()
+		p.mu.Unlock()
+	}
 }
 
 // clientConnReadLoop is the state owned by the clientConn's frame-reading readLoop.
@@ -2144,7 +2942,16 @@ func (cc *ClientConn) readLoop() {
 }
 
 // GoAwayError is returned by the Transport when the server closes the
-// TCP connection after sending a GOAWAY frame.
+// TCP connection after sending a GOAWAY frame. The server may have
+// processed the requests still in flight on the connection, up to
+// LastStreamID.
+//
+// A GoAwayError can also be found with errors.As in the error returned
+// for a request that the GOAWAY frame showed the server did not
+// process, because its stream ID was above LastStreamID. The Transport
+// retries such requests itself when it can, so callers only see this
+// error if the request body could not be replayed or the retries
+// failed; such a request is safe to send again.
 type GoAwayError struct {
 	LastStreamID uint32
 	ErrCode      ErrCode
@@ -2156,6 +2963,19 @@ func (e GoAwayError) Error() string {
 		e.LastStreamID, e.ErrCode, e.DebugData)
 }
 
+// goAwayStreamError is the error a stream is aborted with when a GOAWAY
+// frame shows that the server will not process it.
+type goAwayStreamError struct {
+	goAway GoAwayError
+}
+
+func (e goAwayStreamError) Error() string {
+	return fmt.Sprintf("%v; LastStreamID=%v, ErrCode=%v, debug=%q",
+		errClientConnGotGoAway, e.goAway.LastStreamID, e.goAway.ErrCode, e.goAway.DebugData)
+}
+
+func (e goAwayStreamError) Unwrap() error { return e.goAway }
+
 func isEOFOrNetReadError(err error) bool {
 	if err == io.EOF {
 		return true
@@ -2189,6 +3009,18 @@ func (rl *clientConnReadLoop) cleanup() {
 		err = io.ErrUnexpectedEOF
 	}
 	cc.closed = true
+	if !cc.seenSettings {
+		// Unblock extended CONNECT requests waiting for SETTINGS,
+		// failing them with the reason the connection closed.
+		cc.noSettingsErr = err
+		if cc.closeErr != nil {
+			cc.noSettingsErr = cc.closeErr
+		}
+		if cc.noSettingsErr == nil {
+			cc.noSettingsErr = errClientConnClosed
+		}
+		close(cc.seenSettingsChan)
+	}
 
 	for _, cs := range cc.streams {
 		select {
@@ -2200,7 +3032,15 @@ func (rl *clientConnReadLoop) cleanup() {
 		}
 	}
 	cc.cond.Broadcast()
+	closeErr := cc.closeErr
 	cc.mu.Unlock()
+
+	if f := cc.t.OnConnClose; f != nil {
+		if closeErr == nil {
+			closeErr = err
+		}
+		f(cc, closeErr)
+	}
 }
 
 // countReadFrameError calls Transport.CountError with a string
@@ -2283,6 +3123,8 @@ func (rl *clientConnReadLoop) run() error {
 			err = rl.processSettings(f)
 		case *PushPromiseFrame:
 			err = rl.processPushPromise(f)
+		case *PriorityUpdateFrame:
+			err = rl.processPriorityUpdate(f)
 		case *WindowUpdateFrame:
 			err = rl.processWindowUpdate(f)
 		case *PingFrame:
@@ -2423,6 +3265,11 @@ func (rl *clientConnReadLoop) handleResponse(cs *clientStream, f *MetaHeadersFra
 		if cs.num1xx > max1xxResponses {
 			return nil, errors.New("http2: too many 1xx informational responses")
 		}
+		if fn := cs.cc.t.Got1xxResponse; fn != nil {
+			if err := fn(cs.req, statusCode, header); err != nil {
+				return nil, err
+			}
+		}
 		if fn := cs.get1xxTraceFunc(); fn != nil {
 			if err := fn(statusCode, textproto.MIMEHeader(header)); err != nil {
 				return nil, err
@@ -2698,9 +3545,18 @@ func (rl *clientConnReadLoop) processData(f *DataFrame) error {
 		if !didReset {
 			sendStream = cs.inflow.add(refund)
 		}
+		var sendPing bool
+		if cc.bdp != nil {
+			sendPing = cc.bdp.received(f.Length, time.Now())
+			if !didReset {
+				growConn, growStream := cc.growRecvWindowLocked(cs)
+				sendConn += growConn
+				sendStream += growStream
+			}
+		}
 		cc.mu.Unlock()
 
-		if sendConn > 0 || sendStream > 0 {
+		if sendConn > 0 || sendStream > 0 || sendPing {
 			cc.wmu.Lock()
 			if sendConn > 0 {
 				cc.fr.WriteWindowUpdate(0, uint32(sendConn))
@@ -2708,6 +3564,9 @@ func (rl *clientConnReadLoop) processData(f *DataFrame) error {
 			if sendStream > 0 {
 				cc.fr.WriteWindowUpdate(cs.ID, uint32(sendStream))
 			}
+			if sendPing {
+				cc.fr.WritePing(false, bdpPingData)
+			}
 			cc.bw.Flush()
 			cc.wmu.Unlock()
 		}
@@ -2784,14 +3643,22 @@ func (rl *clientConnReadLoop) processSettings(f *SettingsFrame) error {
 	// Locking both mu and wmu here allows frame encoding to read settings with only wmu held.
 	// Acquiring wmu when f.IsAck() is unnecessary, but convenient and mostly harmless.
 	cc.wmu.Lock()
-	defer cc.wmu.Unlock()
-
-	if err := rl.processSettingsNoWrite(f); err != nil {
+	err := rl.processSettingsNoWrite(f)
+	if err == nil && !f.IsAck() {
+		cc.fr.WriteSettingsAck()
+		cc.bw.Flush()
+	}
+	cc.wmu.Unlock()
+	if err != nil {
 		return err
 	}
 	if !f.IsAck() {
-		cc.fr.WriteSettingsAck()
-		cc.bw.Flush()
+		// A new MAX_CONCURRENT_STREAMS may have freed stream slots,
+		// or made cc draining.
+		cc.noteConnsChanged()
+	}
+	if fn := cc.t.SettingsChanged; fn != nil && !f.IsAck() {
+		fn(cc, cc.State())
 	}
 	return nil
 }
@@ -2817,6 +3684,10 @@ func (rl *clientConnReadLoop) processSettingsNoWrite(f *SettingsFrame) error {
 		case SettingMaxConcurrentStreams:
 			cc.maxConcurrentStreams = s.Val
 			seenMaxConcurrentStreams = true
+			// Wake up requests waiting for a stream slot. If the
+			// peer set the limit to zero, they will find the
+			// connection draining and retry on a new one.
+			cc.cond.Broadcast()
 		case SettingMaxHeaderListSize:
 			cc.peerMaxHeaderListSize = uint64(s.Val)
 		case SettingInitialWindowSize:
@@ -2841,6 +3712,18 @@ func (rl *clientConnReadLoop) processSettingsNoWrite(f *SettingsFrame) error {
 		case SettingHeaderTableSize:
 			cc.henc.SetMaxDynamicTableSize(s.Val)
 			cc.peerMaxHeaderTableSize = s.Val
+		case SettingEnableConnectProtocol:
+			if err := s.Valid(); err != nil {
+				return err
+			}
+			// Requests decide whether extended CONNECT is
+			// supported from the server's first SETTINGS, so it
+			// may not change afterwards. RFC 8441, section 3
+			// forbids disabling it once enabled in any case.
+			if cc.seenSettings && (s.Val == 1) != cc.extendedConnectAllowed {
+				return ConnectionError(ErrCodeProtocol)
+			}
+			cc.extendedConnectAllowed = s.Val == 1
 		default:
 			cc.vlogf("Unhandled Setting: %v", s)
 		}
@@ -2859,6 +3742,7 @@ func (rl *clientConnReadLoop) processSettingsNoWrite(f *SettingsFrame) error {
 			cc.maxConcurrentStreams = defaultMaxConcurrentStreams
 		}
 		cc.seenSettings = true
+		close(cc.seenSettingsChan)
 	}
 
 	return nil
@@ -2893,6 +3777,9 @@ func (rl *clientConnReadLoop) processResetStream(f *RSTStreamFrame) error {
 	}
 	serr := streamError(cs.ID, f.ErrCode)
 	serr.Cause = errFromPeer
+	// REFUSED_STREAM only asks us to retry the request: a server
+	// briefly at its stream limit may refuse streams on an otherwise
+	// healthy connection, so keep using it.
 	if f.ErrCode == ErrCodeProtocol {
 		rl.cc.SetDoNotReuse()
 	}
@@ -2907,12 +3794,21 @@ func (rl *clientConnReadLoop) processResetStream(f *RSTStreamFrame) error {
 
 // Ping sends a PING frame to the server and waits for the ack.
 func (cc *ClientConn) Ping(ctx context.Context) error {
+	_, err := cc.PingRTT(ctx)
+	return err
+}
+
+// PingRTT sends a PING frame to the server and waits for the ack, like
+// Ping, and returns the round-trip time: the time from writing the PING
+// frame to receiving its ack. Each ping carries distinct random data,
+// so concurrent pings are timed independently.
+func (cc *ClientConn) PingRTT(ctx context.Context) (time.Duration, error) {
 	c := make(chan struct{})
 	// Generate a random payload
 	var p [8]byte
 	for {
 		if _, err := rand.Read(p[:]); err != nil {
-			return err
+			return 0, err
 		}
 		cc.mu.Lock()
 		// check for dup before insert
@@ -2923,33 +3819,53 @@ func (cc *ClientConn) Ping(ctx context.Context) error {
 		}
 		cc.mu.Unlock()
 	}
+	forget := func() {
+		cc.mu.Lock()
+		delete(cc.pings, p)
+		cc.mu.Unlock()
+	}
+	var sent time.Time // written before the send on errc
 	errc := make(chan error, 1)
 	go func() {
 		cc.wmu.Lock()
 		defer cc.wmu.Unlock()
-		if err := cc.fr.WritePing(false, p); err != nil {
-			errc <- err
-			return
-		}
-		if err := cc.bw.Flush(); err != nil {
-			errc <- err
-			return
+		sent = time.Now()
+		err := cc.fr.WritePing(false, p)
+		if err == nil {
+			err = cc.bw.Flush()
 		}
+		errc <- err
 	}()
-	select {
-	case <-c:
-		return nil
-	case err := <-errc:
-		return err
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-cc.readerDone:
-		// connection closed
-		return cc.readerErr
+	for {
+		select {
+		case <-c:
+			acked := time.Now()
+			if errc != nil {
+				// The ack can only follow a successful write.
+				<-errc
+			}
+			return acked.Sub(sent), nil
+		case err := <-errc:
+			if err != nil {
+				forget()
+				return 0, err
+			}
+			errc = nil
+		case <-ctx.Done():
+			forget()
+			return 0, ctx.Err()
+		case <-cc.readerDone:
+			// connection closed
+			return 0, cc.readerErr
+		}
 	}
 }
 
 func (rl *clientConnReadLoop) processPing(f *PingFrame) error {
+	if f.IsAck() && f.Data == bdpPingData && rl.cc.bdp != nil {
+		rl.processBDPPingAck()
+		return nil
+	}
 	if f.IsAck() {
 		cc := rl.cc
 		cc.mu.Lock()
@@ -2970,6 +3886,73 @@ func (rl *clientConnReadLoop) processPing(f *PingFrame) error {
 	return cc.bw.Flush()
 }
 
+// processBDPPingAck handles the acknowledgement of a PING sent to
+// estimate the bandwidth-delay product, growing the receive windows
+// if the estimate grew.
+func (rl *clientConnReadLoop) processBDPPingAck() {
+	cc := rl.cc
+	type windowUpdate struct {
+		streamID uint32
+		n        int32
+	}
+	var updates []windowUpdate
+	cc.mu.Lock()
+	if cc.bdp.acked(time.Now()) > 0 {
+		var connAdd int32
+		for _, cs := range cc.streams {
+			// The peer may send DATA only once it has sent the
+			// response headers, and no longer once it ended the
+			// stream.
+			if !cs.firstByte || cs.readClosed {
+				continue
+			}
+			growConn, growStream := cc.growRecvWindowLocked(cs)
+			connAdd += growConn
+			if growStream > 0 {
+				updates = append(updates, windowUpdate{cs.ID, growStream})
+			}
+		}
+		if connAdd > 0 {
+			updates = append(updates, windowUpdate{0, connAdd})
+		}
+	}
+	cc.mu.Unlock()
+
+	if len(updates) == 0 {
+		return
+	}
+	cc.wmu.Lock()
+	defer cc.wmu.Unlock()
+	for _, u := range updates {
+		cc.fr.WriteWindowUpdate(u.streamID, uint32(u.n))
+	}
+	cc.bw.Flush()
+}
+
+// growRecvWindowLocked enlarges the receive windows of cs and of the
+// connection to the window estimated by cc.bdp. It returns the
+// increments to send in WINDOW_UPDATE frames.
+// cc.mu must be held.
+func (cc *ClientConn) growRecvWindowLocked(cs *clientStream) (connAdd, streamAdd int32) {
+	w := cc.bdp.window
+	if diff := w - cc.connRecvWindow; diff > 0 {
+		cc.connRecvWindow = w
+		connAdd = cc.inflow.add(int(diff))
+	}
+	if diff := w - cs.recvWindow; diff > 0 {
+		cs.recvWindow = w
+		streamAdd = cs.inflow.add(int(diff))
+	}
+	return connAdd, streamAdd
+}
+
+func (rl *clientConnReadLoop) processPriorityUpdate(f *PriorityUpdateFrame) error {
+	// Only clients send PRIORITY_UPDATE. RFC 9218, Section 7.1:
+	// "A client that receives a PRIORITY_UPDATE frame MUST respond
+	// with a connection error of type PROTOCOL_ERROR."
+	return ConnectionError(ErrCodeProtocol)
+}
+
 func (rl *clientConnReadLoop) processPushPromise(f *PushPromiseFrame) error {
 	// We told the peer we don't want them.
 	// Spec says:
@@ -2981,22 +3964,38 @@ func (rl *clientConnReadLoop) processPushPromise(f *PushPromiseFrame) error {
 	return ConnectionError(ErrCodeProtocol)
 }
 
-func (cc *ClientConn) writeStreamReset(streamID uint32, code ErrCode, err error) {
-	// TODO: map err to more interesting error codes, once the
-	// HTTP community comes up with some. But currently for
-	// RST_STREAM there's no equivalent to GOAWAY frame's debug
-	// data, and the error codes are all pretty vague ("cancel").
-	cc.wmu.Lock()
-	cc.fr.WriteRSTStream(streamID, code)
-	cc.bw.Flush()
-	cc.wmu.Unlock()
-}
-
 var (
 	errResponseHeaderListSize = errors.New("http2: response header list larger than advertised limit")
-	errRequestHeaderListSize  = errors.New("http2: request header list larger than peer's advertised limit")
+	errRequestHeaderListSize  = errors.New("http2: request header list larger than limit")
 )
 
+// A HeaderListSizeError is returned by the Transport when a request's
+// header or trailer list is too large to send. Sizes are measured as
+// for SETTINGS_MAX_HEADER_LIST_SIZE: the sum of the lengths of each
+// field's name and value, plus 32 bytes per field.
+type HeaderListSizeError struct {
+	Size  uint64 // size of the header list
+	Limit uint64 // the limit it exceeds
+
+	// Peer reports whether Limit is the server's advertised
+	// SETTINGS_MAX_HEADER_LIST_SIZE, rather than the Transport's
+	// MaxRequestHeaderListSize.
+	Peer bool
+}
+
+func (e *HeaderListSizeError) Error() string {
+	if e.Peer {
+		return fmt.Sprintf("http2: request header list size %d larger than peer's advertised limit of %d", e.Size, e.Limit)
+	}
+	return fmt.Sprintf("http2: request header list size %d larger than MaxRequestHeaderListSize of %d", e.Size, e.Limit)
+}
+
+// Is reports whether target is the generic error for request header
+// lists that are too large.
+func (e *HeaderListSizeError) Is(target error) bool {
+	return target == errRequestHeaderListSize
+}
+
 func (cc *ClientConn) logf(format string, args ...interface{}) {
 	cc.t.logf(format, args...)
 }
@@ -3007,11 +4006,19 @@ func (cc *ClientConn) vlogf(format string, args ...interface{}) {
 
 func (t *Transport) vlogf(format string, args ...interface{}) {
 	if VerboseLogs {
-		t.logf(format, args...)
+		t.log(LogLevelDebug, format, args...)
 	}
 }
 
 func (t *Transport) logf(format string, args ...interface{}) {
+	t.log(LogLevelError, format, args...)
+}
+
+func (t *Transport) log(level LogLevel, format string, args ...interface{}) {
+	if lg := t.Logger; lg != nil {
+		lg.Log(level, fmt.Sprintf(format, args...))
+		return
+	}
 	log.Printf(format, args...)
 }
 
@@ -1189,6 +1189,217 @@ func TestTransportConnectRequest(t *testing.T) {
 	}
 }
 
+func TestTransportCancelResetsStream(t *testing.T) {
+	for _, afterResponse := range []bool{false, true} {
+		startedc := make(chan struct{})
+		resetc := make(chan error, 1)
+		st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+			close(startedc)
+			if afterResponse {
+				w.WriteHeader(200)
+				w.(http.Flusher).Flush()
+			}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+				resetc <- errors.New("request context not canceled")
+				return
+			}
+			if se, ok := StreamResetError(r.Context()); !ok || se.Code != ErrCodeCancel {
+				resetc <- fmt.Errorf("StreamResetError = %v, %v; want %v", se, ok, ErrCodeCancel)
+				return
+			}
+			resetc <- nil
+		}, optOnlyServer)
+
+		tr := &Transport{TLSClientConfig: tlsConfigInsecure}
+		ctx, cancel := context.WithCancel(context.Background())
+		// The request body blocks forever, so that the request is
+		// still being written when it is canceled.
+		pr, pw := io.Pipe()
+		req, _ := http.NewRequestWithContext(ctx, "POST", st.ts.URL, pr)
+		if afterResponse {
+			res, err := tr.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			cancel()
+		} else {
+			go func() {
+				<-startedc
+				cancel()
+			}()
+			if _, err := tr.RoundTrip(req); err != context.Canceled {
+				t.Errorf("RoundTrip = %v; want %v", err, context.Canceled)
+			}
+		}
+		if err := <-resetc; err != nil {
+			t.Errorf("afterResponse=%v: %v", afterResponse, err)
+		}
+		pw.Close()
+		tr.CloseIdleConnections()
+		st.Close()
+	}
+}
+
+// Canceling a request must not wait for a write to the connection
+// blocked on a peer that isn't reading.
+func TestTransportCancelDoesNotWaitForBlockedWrite(t *testing.T) {
+	s, c := net.Pipe() // unbuffered: writes block until the peer reads
+	defer s.Close()
+	defer c.Close()
+	tr := &Transport{
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return c, nil
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	headersc := make(chan uint32)
+	go func() {
+		buf := make([]byte, len(ClientPreface))
+		if _, err := io.ReadFull(s, buf); err != nil {
+			return
+		}
+		fr := NewFramer(s, s)
+		go func() {
+			fr.WriteSettings()
+			fr.WriteSettingsAck()
+		}()
+		// Read until the second request's headers, then stop
+		// reading, so that every later write by the client blocks.
+		for n := 0; n < 2; {
+			f, err := fr.ReadFrame()
+			if err != nil {
+				return
+			}
+			if hf, ok := f.(*HeadersFrame); ok {
+				headersc <- hf.StreamID
+				n++
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://dummy.tld/", nil)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := tr.RoundTrip(req)
+		errc <- err
+	}()
+	<-headersc
+
+	// The body of the second request fills the connection, holding
+	// its write lock.
+	body := bytes.NewReader(make([]byte, 1<<20))
+	req2, _ := http.NewRequest("POST", "https://dummy.tld/", body)
+	go tr.RoundTrip(req2)
+	<-headersc
+
+	cancel()
+	select {
+	case err := <-errc:
+		if err != context.Canceled {
+			t.Errorf("RoundTrip = %v; want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("RoundTrip did not return after the request was canceled")
+	}
+}
+
+func TestTransportPoolReadBuffers(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}, optOnlyServer, func(s *Server) {
+		s.ReadBufferSize = 1 << 10
+		s.PoolReadBuffers = true
+	})
+	defer st.Close()
+
+	tr := &Transport{
+		TLSClientConfig: tlsConfigInsecure,
+		ReadBufferSize:  1 << 10,
+		PoolReadBuffers: true,
+	}
+	defer tr.CloseIdleConnections()
+	for i := 0; i < 3; i++ {
+		want := bytes.Repeat([]byte{byte('a' + i)}, 1<<20)
+		req, _ := http.NewRequest("POST", st.ts.URL, bytes.NewReader(want))
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("request %d: echoed %d bytes, want %d bytes of %q", i, len(got), len(want), want[:1])
+		}
+	}
+}
+
+func TestTransportDialConnect(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			t.Errorf("Method = %q; want CONNECT", r.Method)
+		}
+		if r.Host != "example.com:443" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		// Echo the tunneled bytes back until the client closes its
+		// side of the stream.
+		buf := make([]byte, 1024)
+		for {
+			n, err := r.Body.Read(buf)
+			if n > 0 {
+				w.Write(buf[:n])
+				w.(http.Flusher).Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}, optOnlyServer)
+	defer st.Close()
+
+	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
+	defer tr.CloseIdleConnections()
+	proxyAddr := st.ts.Listener.Addr().String()
+
+	c, err := tr.DialConnect(context.Background(), proxyAddr, "example.com:443")
+	if err != nil {
+		t.Fatalf("DialConnect = %v", err)
+	}
+	defer c.Close()
+	if got := c.RemoteAddr().String(); got != proxyAddr {
+		t.Errorf("RemoteAddr = %v; want %v", got, proxyAddr)
+	}
+	// More than the initial stream window, to exercise flow control.
+	want := bytes.Repeat([]byte("hello, tunnel "), 10000)
+	go func() {
+		c.Write(want)
+		c.(interface{ CloseWrite() error }).CloseWrite()
+	}()
+	got, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("reading tunnel: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("read %d bytes through tunnel; want %d echoed bytes", len(got), len(want))
+	}
+
+	if _, err := tr.DialConnect(context.Background(), proxyAddr, "example.net:443"); err == nil {
+		t.Errorf("DialConnect with 403 response succeeded; want error")
+	}
+}
+
 type headerType int
 
 const (
@@ -1445,6 +1656,79 @@ code=114 header=map[Foo-Bar:[114]]
 
 }
 
+func TestTransportGot1xxResponse(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(200)
+	}, optOnlyServer)
+	defer st.Close()
+
+	var got []string
+	tr := &Transport{
+		TLSClientConfig: tlsConfigInsecure,
+		Got1xxResponse: func(req *http.Request, code int, header http.Header) error {
+			if req.URL.Path != "/early" {
+				t.Errorf("Got1xxResponse request path = %q; want /early", req.URL.Path)
+			}
+			got = append(got, fmt.Sprintf("transport code=%d link=%q", code, header.Get("Link")))
+			return nil
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	req, _ := http.NewRequest("GET", st.ts.URL+"/early", nil)
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			got = append(got, fmt.Sprintf("trace code=%d", code))
+			return nil
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Errorf("status code = %v; want 200", res.StatusCode)
+	}
+	want := []string{
+		`transport code=103 link="</style.css>; rel=preload; as=style"`,
+		`trace code=103`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got calls:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestTransportGot1xxResponseError(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(200)
+	}, optOnlyServer)
+	defer st.Close()
+
+	errAbort := errors.New("abort")
+	tr := &Transport{
+		TLSClientConfig: tlsConfigInsecure,
+		Got1xxResponse: func(req *http.Request, code int, header http.Header) error {
+			return errAbort
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	req, _ := http.NewRequest("GET", st.ts.URL, nil)
+	res, err := tr.RoundTrip(req)
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("RoundTrip succeeded; want error")
+	}
+	if !strings.Contains(err.Error(), errAbort.Error()) {
+		t.Errorf("RoundTrip error = %v; want %v", err, errAbort)
+	}
+}
+
 func TestTransportReceiveUndeclaredTrailer(t *testing.T) {
 	ct := newClientTester(t)
 	ct.client = func() error {
@@ -1777,7 +2061,7 @@ func TestTransportChecksRequestHeaderListSize(t *testing.T) {
 		res0.Body.Close()
 
 		res, err := tr.RoundTrip(req)
-		if err != wantErr {
+		if !errors.Is(err, wantErr) {
 			if res != nil {
 				res.Body.Close()
 			}
@@ -1899,6 +2183,45 @@ func TestTransportChecksRequestHeaderListSize(t *testing.T) {
 	checkRoundTrip(req, errRequestHeaderListSize, "Single large trailer")
 }
 
+func TestTransportMaxRequestHeaderListSize(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		if len(r.Header.Get("Big")) > 512 {
+			t.Errorf("handler got a request with a %v byte header", len(r.Header.Get("Big")))
+		}
+	}, optOnlyServer)
+	defer st.Close()
+
+	const limit = 1024
+	tr := &Transport{
+		TLSClientConfig:          tlsConfigInsecure,
+		MaxRequestHeaderListSize: limit,
+	}
+	defer tr.CloseIdleConnections()
+
+	req, _ := http.NewRequest("GET", st.ts.URL, nil)
+	req.Header.Set("Big", strings.Repeat("a", 512))
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip with headers under limit: %v", err)
+	}
+	res.Body.Close()
+
+	req, _ = http.NewRequest("GET", st.ts.URL, nil)
+	req.Header.Set("Big", strings.Repeat("a", limit))
+	res, err = tr.RoundTrip(req)
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("RoundTrip with headers over limit succeeded; want error")
+	}
+	var hle *HeaderListSizeError
+	if !errors.As(err, &hle) {
+		t.Fatalf("RoundTrip error = %v; want *HeaderListSizeError", err)
+	}
+	if hle.Limit != limit || hle.Peer || hle.Size <= limit {
+		t.Errorf("HeaderListSizeError = %+v; want Limit %v, Peer false, Size > %v", hle, limit, limit)
+	}
+}
+
 func TestTransportChecksResponseHeaderListSize(t *testing.T) {
 	ct := newClientTester(t)
 	ct.client = func() error {
@@ -2654,6 +2977,45 @@ func TestTransportNewTLSConfig(t *testing.T) {
 	}
 }
 
+func TestTransportGetTLSConfig(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server-Name", r.TLS.ServerName)
+	}, optOnlyServer)
+	defer st.Close()
+
+	perHost := &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         "backend.example",
+		NextProtos:         []string{"foo"},
+	}
+	var hosts []string
+	tr := &Transport{
+		// Fails certificate verification if GetTLSConfig is ignored.
+		TLSClientConfig: &tls.Config{},
+		GetTLSConfig: func(host string) *tls.Config {
+			hosts = append(hosts, host)
+			return perHost
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	req, _ := http.NewRequest("GET", st.ts.URL, nil)
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got, want := res.Header.Get("Server-Name"), "backend.example"; got != want {
+		t.Errorf("server saw ServerName %q; want %q", got, want)
+	}
+	if want := []string{"127.0.0.1"}; !reflect.DeepEqual(hosts, want) {
+		t.Errorf("GetTLSConfig called with %q; want %q", hosts, want)
+	}
+	if want := []string{"foo"}; !reflect.DeepEqual(perHost.NextProtos, want) {
+		t.Errorf("returned config's NextProtos changed to %q", perHost.NextProtos)
+	}
+}
+
 // The Google GFE responds to HEAD requests with a HEADERS frame
 // without END_STREAM, followed by a 0-length DATA frame with
 // END_STREAM. Make sure we don't get confused by that. (We did.)
@@ -2821,6 +3183,87 @@ func TestTransportHandlerBodyClose(t *testing.T) {
 	}
 }
 
+func TestSendRateLimiter(t *testing.T) {
+	ctx := WithSendRateLimit(context.Background(), 1000)
+	start := time.Unix(0, 0)
+	l := newSendRateLimiter(ctx, start)
+	if l.burst != 100 {
+		t.Fatalf("burst = %v; want 100", l.burst)
+	}
+	for _, step := range []struct {
+		at   time.Duration // since start
+		n    int
+		want time.Duration
+	}{
+		{0, 100, 0}, // the bucket starts full
+		{0, 100, 100 * time.Millisecond},
+		{100 * time.Millisecond, 50, 50 * time.Millisecond},
+		{150 * time.Millisecond, 0, 0},
+		// The bucket holds at most burst tokens.
+		{10 * time.Second, 100, 0},
+		{10 * time.Second, 1, time.Millisecond},
+	} {
+		if got := l.reserve(start.Add(step.at), step.n); got != step.want {
+			t.Errorf("at %v, reserve(%v) = %v; want %v", step.at, step.n, got, step.want)
+		}
+	}
+
+	for _, rate := range []int64{0, -1} {
+		if l := newSendRateLimiter(WithSendRateLimit(ctx, rate), start); l != nil {
+			t.Errorf("WithSendRateLimit(%v) set a limit", rate)
+		}
+	}
+}
+
+func TestTransportSendRateLimit(t *testing.T) {
+	const (
+		bodySize = 32 << 10
+		rate     = 80 << 10 // bytes per second
+		burst    = rate / 10
+	)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		n, err := io.Copy(io.Discard, r.Body)
+		if err != nil || n != bodySize {
+			t.Errorf("server read %v bytes, %v; want %v bytes", n, err, bodySize)
+		}
+	}, optOnlyServer)
+	defer st.Close()
+
+	var (
+		mu       sync.Mutex
+		maxFrame int // largest DATA frame sent
+	)
+	tr := &Transport{
+		TLSClientConfig: tlsConfigInsecure,
+		OnFrame: func(dir FrameDirection, f Frame) {
+			if df, ok := f.(*DataFrame); ok && dir == FrameWritten {
+				mu.Lock()
+				defer mu.Unlock()
+				if n := len(df.Data()); n > maxFrame {
+					maxFrame = n
+				}
+			}
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	// The body is sent in DATA frames no larger than the bucket.
+	req, err := http.NewRequestWithContext(WithSendRateLimit(context.Background(), rate), "PUT", st.ts.URL, bytes.NewReader(make([]byte, bodySize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if maxFrame == 0 || maxFrame > burst {
+		t.Errorf("largest DATA frame has %v bytes; want 1 to %v", maxFrame, burst)
+	}
+}
+
 // https://golang.org/issue/15930
 func TestTransportFlowControl(t *testing.T) {
 	const bufLen = 64 << 10
@@ -2877,23 +3320,174 @@ func TestTransportFlowControl(t *testing.T) {
 	}
 }
 
-// golang.org/issue/14627 -- if the server sends a GOAWAY frame, make
-// the Transport remember it and return it back to users (via
-// RoundTrip or request body reads) if needed (e.g. if the server
-// proceeds to close the TCP connection before the client gets its
-// response)
-func TestTransportUsesGoAwayDebugError_RoundTrip(t *testing.T) {
-	testTransportUsesGoAwayDebugError(t, false)
-}
-
-func TestTransportUsesGoAwayDebugError_Body(t *testing.T) {
-	testTransportUsesGoAwayDebugError(t, true)
+func TestTransportMaxReceiveBufferPerConnection(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		buf    int32
+		window int32
+	}{
+		{"default", 0, transportDefaultConnFlow + initialWindowSize},
+		{"too_small", initialWindowSize - 1, transportDefaultConnFlow + initialWindowSize},
+		{"spec_minimum", initialWindowSize, initialWindowSize},
+		{"256k", 256 << 10, 256 << 10},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			testTransportMaxReceiveBufferPerConnection(t, tt.buf, tt.window)
+		})
+	}
 }
 
-func testTransportUsesGoAwayDebugError(t *testing.T, failMidBody bool) {
-	ct := newClientTester(t)
-	clientDone := make(chan struct{})
-
+func testTransportMaxReceiveBufferPerConnection(t *testing.T, buf, window int32) {
+	const total = 1 << 20
+	var (
+		mu        sync.Mutex
+		increment int64 = -1 // first connection-level WINDOW_UPDATE
+	)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, total))
+	}, optOnlyServer, func(s *Server) {
+		s.OnFrame = func(dir FrameDirection, f Frame) {
+			mu.Lock()
+			defer mu.Unlock()
+			if wf, ok := f.(*WindowUpdateFrame); ok && dir == FrameRead && wf.StreamID == 0 && increment < 0 {
+				increment = int64(wf.Increment)
+			}
+		}
+	})
+	defer st.Close()
+
+	tr := &Transport{
+		TLSClientConfig:               tlsConfigInsecure,
+		MaxReceiveBufferPerConnection: buf,
+	}
+	defer tr.CloseIdleConnections()
+	req, _ := http.NewRequest("GET", st.ts.URL, nil)
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if err != nil || n != total {
+		t.Fatalf("read %v bytes, %v; want %v bytes", n, err, total)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := int64(window) - initialWindowSize
+	if want == 0 {
+		// No initial WINDOW_UPDATE; the first one is sent after
+		// reading response data.
+		if increment < 0 || increment > initialWindowSize {
+			t.Errorf("first connection WINDOW_UPDATE increment = %v; want at most %v", increment, initialWindowSize)
+		}
+		return
+	}
+	if increment != want {
+		t.Errorf("first connection WINDOW_UPDATE increment = %v; want %v", increment, want)
+	}
+}
+
+func TestTransportAutoTuneWindow(t *testing.T) {
+	ct := newClientTester(t)
+	ct.tr.AutoTuneWindow = true
+	ct.client = func() error {
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		_, err = io.Copy(io.Discard, res.Body)
+		return err
+	}
+	ct.server = func() error {
+		ct.greet()
+		var streamID uint32
+		for streamID == 0 {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				return err
+			}
+			if hf, ok := f.(*HeadersFrame); ok {
+				streamID = hf.StreamID
+			}
+		}
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+		ct.fr.WriteHeaders(HeadersFrameParam{
+			StreamID:      streamID,
+			EndHeaders:    true,
+			BlockFragment: buf.Bytes(),
+		})
+
+		// sent counts the DATA sent, and increments the stream's
+		// WINDOW_UPDATEs. Increments larger than the data sent can
+		// only come from a window that grew.
+		chunk := make([]byte, 16<<10)
+		var sent, increments int64
+		readFrame := func() (*PingFrame, error) {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				return nil, err
+			}
+			switch f := f.(type) {
+			case *WindowUpdateFrame:
+				if f.StreamID == streamID {
+					increments += int64(f.Increment)
+				}
+			case *PingFrame:
+				return f, nil
+			}
+			return nil, nil
+		}
+		ct.fr.WriteData(streamID, false, chunk)
+		sent += int64(len(chunk))
+		var pf *PingFrame
+		for pf == nil {
+			var err error
+			if pf, err = readFrame(); err != nil {
+				return err
+			}
+		}
+		if pf.IsAck() || pf.Data != bdpPingData {
+			return fmt.Errorf("got %v; want PING with data %q", pf, bdpPingData[:])
+		}
+
+		// Fill most of the 4MB stream window within the round trip.
+		for sent < 3<<20 {
+			ct.fr.WriteData(streamID, false, chunk)
+			sent += int64(len(chunk))
+		}
+		ct.fr.WritePing(true, pf.Data)
+		for increments <= sent {
+			if _, err := readFrame(); err != nil {
+				return err
+			}
+		}
+		return ct.fr.WriteData(streamID, true, nil)
+	}
+	ct.run()
+}
+
+// golang.org/issue/14627 -- if the server sends a GOAWAY frame, make
+// the Transport remember it and return it back to users (via
+// RoundTrip or request body reads) if needed (e.g. if the server
+// proceeds to close the TCP connection before the client gets its
+// response)
+func TestTransportUsesGoAwayDebugError_RoundTrip(t *testing.T) {
+	testTransportUsesGoAwayDebugError(t, false)
+}
+
+func TestTransportUsesGoAwayDebugError_Body(t *testing.T) {
+	testTransportUsesGoAwayDebugError(t, true)
+}
+
+func testTransportUsesGoAwayDebugError(t *testing.T, failMidBody bool) {
+	ct := newClientTester(t)
+	clientDone := make(chan struct{})
+
 	const goAwayErrCode = ErrCodeHTTP11Required // arbitrary
 	const goAwayDebugData = "some debug data"
 
@@ -2958,6 +3552,48 @@ func testTransportUsesGoAwayDebugError(t *testing.T, failMidBody bool) {
 	ct.run()
 }
 
+// A request that a GOAWAY frame shows was not processed, and that
+// can't be retried, fails with an error that unwraps to a GoAwayError.
+func TestTransportGoAwayUnprocessedRequestError(t *testing.T) {
+	ct := newClientTester(t)
+	ct.client = func() error {
+		// No GetBody, so the request can't be retried.
+		body := ioutil.NopCloser(strings.NewReader("body"))
+		req, _ := http.NewRequest("POST", "https://dummy.tld/", body)
+		res, err := ct.tr.RoundTrip(req)
+		if err == nil {
+			res.Body.Close()
+			return errors.New("RoundTrip succeeded; want error")
+		}
+		var ge GoAwayError
+		if !errors.As(err, &ge) {
+			return fmt.Errorf("RoundTrip error = %v; want a GoAwayError", err)
+		}
+		want := GoAwayError{
+			LastStreamID: 0,
+			ErrCode:      ErrCodeEnhanceYourCalm,
+			DebugData:    "slow down",
+		}
+		if ge != want {
+			t.Errorf("GoAwayError = %#v; want %#v", ge, want)
+		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet()
+		for {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				return nil
+			}
+			if _, ok := f.(*HeadersFrame); ok {
+				ct.fr.WriteGoAway(0, ErrCodeEnhanceYourCalm, []byte("slow down"))
+			}
+		}
+	}
+	ct.run()
+}
+
 func testTransportReturnsUnusedFlowControl(t *testing.T, oneDataFrame bool) {
 	ct := newClientTester(t)
 
@@ -3492,102 +4128,415 @@ func TestClientConnPing(t *testing.T) {
 	}
 }
 
-// Issue 16974: if the server sent a DATA frame after the user
-// canceled the Transport's Request, the Transport previously wrote to a
-// closed pipe, got an error, and ended up closing the whole TCP
-// connection.
-func TestTransportCancelDataResponseRace(t *testing.T) {
-	cancel := make(chan struct{})
-	clientGotResponse := make(chan bool, 1)
+func TestClientConnStatePeerMaxFrameSize(t *testing.T) {
+	const frameSize = 64 << 10
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {}, optOnlyServer, func(s *Server) {
+		s.MaxReadFrameSize = frameSize
+	})
+	defer st.Close()
+	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
+	defer tr.CloseIdleConnections()
+	cc, err := tr.dialClientConn(context.Background(), st.ts.Listener.Addr().String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The server's SETTINGS have arrived once a request completes.
+	req, _ := http.NewRequest("GET", st.ts.URL, nil)
+	res, err := cc.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := cc.State().PeerMaxFrameSize; got != frameSize {
+		t.Errorf("PeerMaxFrameSize = %v, want %v", got, frameSize)
+	}
+}
 
-	const msg = "Hello."
-	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
-		if strings.Contains(r.URL.Path, "/hello") {
-			time.Sleep(50 * time.Millisecond)
-			io.WriteString(w, msg)
-			return
+func TestClientConnPingRTT(t *testing.T) {
+	const (
+		concurrent = 3
+		delay      = 10 * time.Millisecond
+	)
+	ct := newClientTester(t)
+	ct.client = func() error {
+		cc, err := ct.tr.NewClientConn(ct.cc)
+		if err != nil {
+			return err
 		}
-		for i := 0; i < 50; i++ {
-			io.WriteString(w, "Some data.")
-			w.(http.Flusher).Flush()
-			if i == 2 {
-				<-clientGotResponse
-				close(cancel)
+		defer cc.Close()
+
+		// The server never acks the first ping.
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if _, err := cc.PingRTT(ctx); err != context.DeadlineExceeded {
+			return fmt.Errorf("PingRTT with unacked ping = %v, want %v", err, context.DeadlineExceeded)
+		}
+		cc.mu.Lock()
+		n := len(cc.pings)
+		cc.mu.Unlock()
+		if n != 0 {
+			return fmt.Errorf("%d pings outstanding after timeout, want 0", n)
+		}
+
+		errc := make(chan error, concurrent)
+		for i := 0; i < concurrent; i++ {
+			go func() {
+				rtt, err := cc.PingRTT(context.Background())
+				if err == nil && rtt < delay {
+					err = fmt.Errorf("PingRTT = %v, want at least %v", rtt, delay)
+				}
+				errc <- err
+			}()
+		}
+		for i := 0; i < concurrent; i++ {
+			if err := <-errc; err != nil {
+				return err
 			}
-			time.Sleep(10 * time.Millisecond)
 		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet()
+		pings := 0
+		for pings <= concurrent {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				return err
+			}
+			pf, ok := f.(*PingFrame)
+			if !ok || pf.IsAck() {
+				continue
+			}
+			pings++
+			if pings == 1 {
+				continue
+			}
+			time.Sleep(delay)
+			if err := ct.fr.WritePing(true, pf.Data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	ct.run()
+}
+
+func TestHeaderStats(t *testing.T) {
+	const requests = 20
+	value := strings.Repeat("a", 100)
+	var serverStats HeaderStats
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		if serverStats, ok = ConnHeaderStats(r.Context()); !ok {
+			t.Errorf("ConnHeaderStats reported false")
+		}
+		w.Header().Set("X-Response", value)
+		w.WriteHeader(200)
 	}, optOnlyServer)
 	defer st.Close()
-
 	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
 	defer tr.CloseIdleConnections()
-
-	c := &http.Client{Transport: tr}
-	req, _ := http.NewRequest("GET", st.ts.URL, nil)
-	req.Cancel = cancel
-	res, err := c.Do(req)
-	clientGotResponse <- true
+	cc, err := tr.dialClientConn(context.Background(), st.ts.Listener.Addr().String(), false)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if _, err = io.Copy(ioutil.Discard, res.Body); err == nil {
-		t.Fatal("unexpected success")
+	for i := 0; i < requests; i++ {
+		req, _ := http.NewRequest("GET", st.ts.URL, nil)
+		req.Header.Set("X-Request", value)
+		res, err := cc.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
 	}
 
-	res, err = c.Get(st.ts.URL + "/hello")
-	if err != nil {
-		t.Fatal(err)
+	// Once a header is in the dynamic table, each repetition is
+	// encoded in a few bytes.
+	check := func(side, dir string, raw, encoded int64) {
+		t.Helper()
+		if raw < requests*int64(len(value)) {
+			t.Errorf("%v %v raw = %v; want at least %v", side, dir, raw, requests*len(value))
+		}
+		if encoded <= 0 || encoded*5 > raw {
+			t.Errorf("%v %v encoded = %v; want under a fifth of raw %v", side, dir, encoded, raw)
+		}
 	}
-	slurp, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		t.Fatal(err)
+	cs := cc.HeaderStats()
+	check("client", "sent", cs.SentRaw, cs.SentEncoded)
+	check("client", "received", cs.ReceivedRaw, cs.ReceivedEncoded)
+	// The server's stats are taken by the last handler, before it
+	// sent its response.
+	if serverStats.ReceivedRaw != cs.SentRaw || serverStats.ReceivedEncoded != cs.SentEncoded {
+		t.Errorf("server received %+v; want client sent %+v", serverStats, cs)
 	}
-	if string(slurp) != msg {
-		t.Errorf("Got = %q; want %q", slurp, msg)
+	check("server", "sent", serverStats.SentRaw, serverStats.SentEncoded)
+
+	if _, ok := ConnHeaderStats(context.Background()); ok {
+		t.Errorf("ConnHeaderStats(context.Background()) reported true")
 	}
 }
 
-// Issue 21316: It should be safe to reuse an http.Request after the
-// request has completed.
-func TestTransportNoRaceOnRequestObjectAfterRequestComplete(t *testing.T) {
+func TestStats(t *testing.T) {
+	const requests = 3
+	var serverCtx context.Context
 	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(200)
-		io.WriteString(w, "body")
+		io.Copy(io.Discard, r.Body)
+		serverCtx = r.Context()
+		io.WriteString(w, "world")
 	}, optOnlyServer)
 	defer st.Close()
-
 	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
 	defer tr.CloseIdleConnections()
-
-	req, _ := http.NewRequest("GET", st.ts.URL, nil)
-	resp, err := tr.RoundTrip(req)
+	cc, err := tr.dialClientConn(context.Background(), st.ts.Listener.Addr().String(), false)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if _, err = io.Copy(ioutil.Discard, resp.Body); err != nil {
-		t.Fatalf("error reading response body: %v", err)
+	for i := 0; i < requests; i++ {
+		req, _ := http.NewRequest("POST", st.ts.URL, strings.NewReader("hello"))
+		res, err := cc.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
 	}
-	if err := resp.Body.Close(); err != nil {
-		t.Fatalf("error closing response body: %v", err)
+	if err := cc.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
 	}
 
-	// This access of req.Header should not race with code in the transport.
-	req.Header = http.Header{}
-}
+	cs := cc.Stats()
+	if cs.StreamsOpened != requests {
+		t.Errorf("client StreamsOpened = %v; want %v", cs.StreamsOpened, requests)
+	}
+	if got := cs.FramesWritten[FrameHeaders]; got != requests {
+		t.Errorf("client wrote %v HEADERS frames; want %v", got, requests)
+	}
+	if got := cs.FramesRead[FrameData]; got < requests {
+		t.Errorf("client read %v DATA frames; want at least %v", got, requests)
+	}
+	if cs.GoAwaysSent != 1 || cs.GoAwaysReceived != 0 {
+		t.Errorf("client GoAwaysSent, GoAwaysReceived = %v, %v; want 1, 0", cs.GoAwaysSent, cs.GoAwaysReceived)
+	}
 
-func TestTransportCloseAfterLostPing(t *testing.T) {
-	clientDone := make(chan struct{})
-	ct := newClientTester(t)
-	ct.tr.PingTimeout = 1 * time.Second
-	ct.tr.ReadIdleTimeout = 1 * time.Second
-	ct.client = func() error {
-		defer ct.cc.(*net.TCPConn).CloseWrite()
+	// The server has read all the client wrote once it reads the GOAWAY.
+	var ss Stats
+	if !waitCondition(5*time.Second, 10*time.Millisecond, func() bool {
+		var ok bool
+		if ss, ok = ConnStats(serverCtx); !ok {
+			t.Fatal("ConnStats reported false")
+		}
+		return ss.GoAwaysReceived == 1
+	}) {
+		t.Fatalf("server GoAwaysReceived = %v; want 1", ss.GoAwaysReceived)
+	}
+	if ss.StreamsOpened != requests {
+		t.Errorf("server StreamsOpened = %v; want %v", ss.StreamsOpened, requests)
+	}
+	if ss.BytesRead != cs.BytesWritten || !reflect.DeepEqual(ss.FramesRead, cs.FramesWritten) {
+		t.Errorf("server read %v bytes in frames %v; want the client's %v bytes in frames %v", ss.BytesRead, ss.FramesRead, cs.BytesWritten, cs.FramesWritten)
+	}
+	if ss.BytesWritten < cs.BytesRead {
+		t.Errorf("server wrote %v bytes; want at least the %v read by the client", ss.BytesWritten, cs.BytesRead)
+	}
+
+	if _, ok := ConnStats(context.Background()); ok {
+		t.Errorf("ConnStats(context.Background()) reported true")
+	}
+}
+
+func TestDisableHuffmanEncoding(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		t.Run(fmt.Sprint(disable), func(t *testing.T) {
+			testDisableHuffmanEncoding(t, disable)
+		})
+	}
+}
+
+func testDisableHuffmanEncoding(t *testing.T, disable bool) {
+	const (
+		reqValue = "request-header-value"
+		resValue = "response-header-value"
+	)
+	var (
+		mu                 sync.Mutex
+		reqBlock, resBlock []byte
+	)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Response", resValue)
+	}, optOnlyServer, func(s *Server) {
+		s.DisableHuffmanEncoding = disable
+		s.OnFrame = func(dir FrameDirection, f Frame) {
+			hf, ok := f.(*HeadersFrame)
+			if !ok {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if dir == FrameRead {
+				reqBlock = append(reqBlock, hf.HeaderBlockFragment()...)
+			} else {
+				resBlock = append(resBlock, hf.HeaderBlockFragment()...)
+			}
+		}
+	})
+	defer st.Close()
+	tr := &Transport{
+		TLSClientConfig:        tlsConfigInsecure,
+		DisableHuffmanEncoding: disable,
+	}
+	defer tr.CloseIdleConnections()
+	req, _ := http.NewRequest("GET", st.ts.URL, nil)
+	req.Header.Set("X-Request", reqValue)
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := res.Header.Get("X-Response"); got != resValue {
+		t.Errorf("X-Response = %q; want %q", got, resValue)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := bytes.Contains(reqBlock, []byte(reqValue)); got != disable {
+		t.Errorf("request header block contains literal %q: %v; want %v", reqValue, got, disable)
+	}
+	if got := bytes.Contains(resBlock, []byte(resValue)); got != disable {
+		t.Errorf("response header block contains literal %q: %v; want %v", resValue, got, disable)
+	}
+}
+
+// Issue 16974: if the server sent a DATA frame after the user
+// canceled the Transport's Request, the Transport previously wrote to a
+// closed pipe, got an error, and ended up closing the whole TCP
+// connection.
+func TestTransportCancelDataResponseRace(t *testing.T) {
+	cancel := make(chan struct{})
+	clientGotResponse := make(chan bool, 1)
+
+	const msg = "Hello."
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/hello") {
+			time.Sleep(50 * time.Millisecond)
+			io.WriteString(w, msg)
+			return
+		}
+		for i := 0; i < 50; i++ {
+			io.WriteString(w, "Some data.")
+			w.(http.Flusher).Flush()
+			if i == 2 {
+				<-clientGotResponse
+				close(cancel)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}, optOnlyServer)
+	defer st.Close()
+
+	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
+	defer tr.CloseIdleConnections()
+
+	c := &http.Client{Transport: tr}
+	req, _ := http.NewRequest("GET", st.ts.URL, nil)
+	req.Cancel = cancel
+	res, err := c.Do(req)
+	clientGotResponse <- true
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.Copy(ioutil.Discard, res.Body); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	res, err = c.Get(st.ts.URL + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slurp, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(slurp) != msg {
+		t.Errorf("Got = %q; want %q", slurp, msg)
+	}
+}
+
+// Issue 21316: It should be safe to reuse an http.Request after the
+// request has completed.
+func TestTransportNoRaceOnRequestObjectAfterRequestComplete(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		io.WriteString(w, "body")
+	}, optOnlyServer)
+	defer st.Close()
+
+	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
+	defer tr.CloseIdleConnections()
+
+	req, _ := http.NewRequest("GET", st.ts.URL, nil)
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.Copy(ioutil.Discard, resp.Body); err != nil {
+		t.Fatalf("error reading response body: %v", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		t.Fatalf("error closing response body: %v", err)
+	}
+
+	// This access of req.Header should not race with code in the transport.
+	req.Header = http.Header{}
+}
+
+func TestTransportCloseAfterLostPing(t *testing.T) {
+	clientDone := make(chan struct{})
+	ct := newClientTester(t)
+	ct.tr.PingTimeout = 1 * time.Second
+	ct.tr.ReadIdleTimeout = 1 * time.Second
+	ct.client = func() error {
+		defer ct.cc.(*net.TCPConn).CloseWrite()
+		defer close(clientDone)
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		_, err := ct.tr.RoundTrip(req)
+		if err == nil || !strings.Contains(err.Error(), "client connection lost") {
+			return fmt.Errorf("expected to get error about \"connection lost\", got %v", err)
+		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet()
+		<-clientDone
+		return nil
+	}
+	ct.run()
+}
+
+func TestTransportPingIntervalLostPing(t *testing.T) {
+	clientDone := make(chan struct{})
+	closeErrc := make(chan error, 1)
+	ct := newClientTester(t)
+	ct.tr.PingTimeout = 10 * time.Millisecond
+	ct.tr.PingInterval = 10 * time.Millisecond
+	ct.tr.OnConnClose = func(cc *ClientConn, err error) {
+		closeErrc <- err
+	}
+	ct.client = func() error {
+		defer ct.cc.(*net.TCPConn).CloseWrite()
 		defer close(clientDone)
 		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
 		_, err := ct.tr.RoundTrip(req)
 		if err == nil || !strings.Contains(err.Error(), "client connection lost") {
 			return fmt.Errorf("expected to get error about \"connection lost\", got %v", err)
 		}
+		select {
+		case err := <-closeErrc:
+			if err == nil || !strings.Contains(err.Error(), "client connection lost") {
+				return fmt.Errorf("OnConnClose called with %v; want error about \"connection lost\"", err)
+			}
+		case <-time.After(5 * time.Second):
+			return errors.New("timeout waiting for OnConnClose")
+		}
 		return nil
 	}
 	ct.server = func() error {
@@ -3598,6 +4547,63 @@ func TestTransportCloseAfterLostPing(t *testing.T) {
 	ct.run()
 }
 
+func TestTransportPingInterval(t *testing.T) {
+	const wantPings = 3
+	ct := newClientTester(t)
+	ct.tr.PingInterval = 10 * time.Millisecond
+	ct.client = func() error {
+		defer ct.cc.(*net.TCPConn).CloseWrite()
+		if runtime.GOOS == "plan9" {
+			// CloseWrite not supported on Plan 9; Issue 17906
+			defer ct.cc.(*net.TCPConn).Close()
+		}
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return fmt.Errorf("RoundTrip: %v", err)
+		}
+		defer res.Body.Close()
+		if _, err := ioutil.ReadAll(res.Body); err != nil {
+			return fmt.Errorf("reading body: %v", err)
+		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet()
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		var streamID uint32
+		pingCount := 0
+		for {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				return err
+			}
+			switch f := f.(type) {
+			case *HeadersFrame:
+				enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+				ct.fr.WriteHeaders(HeadersFrameParam{
+					StreamID:      f.StreamID,
+					EndHeaders:    true,
+					BlockFragment: buf.Bytes(),
+				})
+				streamID = f.StreamID
+			case *PingFrame:
+				// The client pings even though the stream is
+				// still open.
+				if err := ct.fr.WritePing(true, f.Data); err != nil {
+					return err
+				}
+				pingCount++
+				if pingCount == wantPings {
+					return ct.fr.WriteData(streamID, true, []byte("done"))
+				}
+			}
+		}
+	}
+	ct.run()
+}
+
 func TestTransportPingWriteBlocks(t *testing.T) {
 	st := newServerTester(t,
 		func(w http.ResponseWriter, r *http.Request) {},
@@ -3898,7 +4904,9 @@ func TestTransportRetryAfterRefusedStream(t *testing.T) {
 					t.Errorf("headers should have END_HEADERS be ended: %v", f)
 					return
 				}
-				if count == 1 {
+				// The client retries the refused stream
+				// on the same connection.
+				if count == 1 && f.StreamID == 1 {
 					ct.fr.WriteRSTStream(f.StreamID, ErrCodeRefusedStream)
 				} else {
 					enc.WriteField(hpack.HeaderField{Name: ":status", Value: "204"})
@@ -3977,45 +4985,182 @@ func TestTransportRetryHasLimit(t *testing.T) {
 	ct.run()
 }
 
-func TestTransportResponseDataBeforeHeaders(t *testing.T) {
-	// This test use not valid response format.
-	// Discarding logger output to not spam tests output.
-	log.SetOutput(ioutil.Discard)
-	defer log.SetOutput(os.Stderr)
-
-	ct := newClientTester(t)
-	ct.client = func() error {
-		defer ct.cc.(*net.TCPConn).CloseWrite()
-		if runtime.GOOS == "plan9" {
-			// CloseWrite not supported on Plan 9; Issue 17906
-			defer ct.cc.(*net.TCPConn).Close()
-		}
-		req := httptest.NewRequest("GET", "https://dummy.tld/", nil)
-		// First request is normal to ensure the check is per stream and not per connection.
-		_, err := ct.tr.RoundTrip(req)
+func TestTransportRetryRefusedStreamOnSameConn(t *testing.T) {
+	const reqBody = "some request body"
+	var (
+		mu       sync.Mutex
+		dials    int
+		requests int
+		got      string
+	)
+	clientDone := make(chan struct{})
+	client := func(tr *Transport) {
+		defer close(clientDone)
+		req, _ := http.NewRequest("POST", "https://dummy.tld/", strings.NewReader(reqBody))
+		resp, err := tr.RoundTrip(req)
 		if err != nil {
-			return fmt.Errorf("RoundTrip expected no error, got: %v", err)
-		}
-		// Second request returns a DATA frame with no HEADERS.
-		resp, err := ct.tr.RoundTrip(req)
-		if err == nil {
-			return fmt.Errorf("RoundTrip expected error, got response: %+v", resp)
+			t.Errorf("RoundTrip: %v", err)
+			return
 		}
-		if err, ok := err.(StreamError); !ok || err.Code != ErrCodeProtocol {
-			return fmt.Errorf("expected stream PROTOCOL_ERROR, got: %v", err)
+		resp.Body.Close()
+		if resp.StatusCode != 204 {
+			t.Errorf("Status = %v; want 204", resp.StatusCode)
 		}
-		return nil
 	}
-	ct.server = func() error {
+	server := func(count int, ct *clientTester) {
+		mu.Lock()
+		dials = count
+		mu.Unlock()
 		ct.greet()
+		var body []byte
+		refused := false
 		for {
 			f, err := ct.fr.ReadFrame()
-			if err == io.EOF {
-				return nil
-			} else if err != nil {
-				return err
-			}
-			switch f := f.(type) {
+			if err != nil {
+				select {
+				case <-clientDone:
+				default:
+					t.Error(err)
+				}
+				return
+			}
+			switch f := f.(type) {
+			case *HeadersFrame:
+				mu.Lock()
+				requests++
+				mu.Unlock()
+				if !refused {
+					refused = true
+					ct.fr.WriteRSTStream(f.StreamID, ErrCodeRefusedStream)
+				}
+			case *DataFrame:
+				if f.StreamID == 1 {
+					continue
+				}
+				body = append(body, f.Data()...)
+				if !f.StreamEnded() {
+					continue
+				}
+				mu.Lock()
+				got = string(body)
+				mu.Unlock()
+				var buf bytes.Buffer
+				enc := hpack.NewEncoder(&buf)
+				enc.WriteField(hpack.HeaderField{Name: ":status", Value: "204"})
+				ct.fr.WriteHeaders(HeadersFrameParam{
+					StreamID:      f.StreamID,
+					EndHeaders:    true,
+					EndStream:     true,
+					BlockFragment: buf.Bytes(),
+				})
+			}
+		}
+	}
+	testClientMultipleDials(t, client, server)
+	if dials != 1 {
+		t.Errorf("dialed %d times, want 1: a refused stream should not retire the connection", dials)
+	}
+	if requests != 2 {
+		t.Errorf("server got %d requests, want 2", requests)
+	}
+	if got != reqBody {
+		t.Errorf("retried request body = %q, want %q", got, reqBody)
+	}
+}
+
+func TestTransportMaxRetries(t *testing.T) {
+	retryBackoffHook = func(d time.Duration) *time.Timer {
+		return time.NewTimer(0) // fires immediately
+	}
+	defer func() {
+		retryBackoffHook = nil
+	}()
+	var (
+		mu       sync.Mutex
+		dials    int
+		requests int
+	)
+	clientDone := make(chan struct{})
+	client := func(tr *Transport) {
+		defer close(clientDone)
+		tr.MaxRetries = 2
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		_, err := tr.RoundTrip(req)
+		if se, ok := err.(StreamError); !ok || se.Code != ErrCodeRefusedStream {
+			t.Errorf("RoundTrip = %v, want REFUSED_STREAM error", err)
+		}
+	}
+	server := func(count int, ct *clientTester) {
+		mu.Lock()
+		dials = count
+		mu.Unlock()
+		ct.greet()
+		for {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				select {
+				case <-clientDone:
+				default:
+					t.Error(err)
+				}
+				return
+			}
+			if f, ok := f.(*HeadersFrame); ok {
+				mu.Lock()
+				requests++
+				mu.Unlock()
+				ct.fr.WriteRSTStream(f.StreamID, ErrCodeRefusedStream)
+			}
+		}
+	}
+	testClientMultipleDials(t, client, server)
+	if dials != 1 {
+		t.Errorf("dialed %d times, want 1", dials)
+	}
+	if requests != 3 {
+		t.Errorf("server got %d requests, want 3", requests)
+	}
+}
+
+func TestTransportResponseDataBeforeHeaders(t *testing.T) {
+	// This test use not valid response format.
+	// Discarding logger output to not spam tests output.
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ct := newClientTester(t)
+	ct.client = func() error {
+		defer ct.cc.(*net.TCPConn).CloseWrite()
+		if runtime.GOOS == "plan9" {
+			// CloseWrite not supported on Plan 9; Issue 17906
+			defer ct.cc.(*net.TCPConn).Close()
+		}
+		req := httptest.NewRequest("GET", "https://dummy.tld/", nil)
+		// First request is normal to ensure the check is per stream and not per connection.
+		_, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return fmt.Errorf("RoundTrip expected no error, got: %v", err)
+		}
+		// Second request returns a DATA frame with no HEADERS.
+		resp, err := ct.tr.RoundTrip(req)
+		if err == nil {
+			return fmt.Errorf("RoundTrip expected error, got response: %+v", resp)
+		}
+		if err, ok := err.(StreamError); !ok || err.Code != ErrCodeProtocol {
+			return fmt.Errorf("expected stream PROTOCOL_ERROR, got: %v", err)
+		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet()
+		for {
+			f, err := ct.fr.ReadFrame()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			switch f := f.(type) {
 			case *WindowUpdateFrame, *SettingsFrame, *RSTStreamFrame:
 			case *HeadersFrame:
 				switch f.StreamID {
@@ -4124,6 +5269,343 @@ func TestTransportRequestsLowServerLimit(t *testing.T) {
 	}
 }
 
+func TestTransportMaxConnsPerHost(t *testing.T) {
+	const maxConns = 2
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}, optOnlyServer, func(s *Server) {
+		// Match the limit the client assumes before it receives the
+		// server's SETTINGS, so that no stream is refused.
+		s.MaxConcurrentStreams = initialMaxConcurrentStreams
+	})
+	defer st.Close()
+
+	var (
+		connCountMu sync.Mutex
+		connCount   int // currently open connections
+		maxOpen     int
+	)
+	tr := &Transport{
+		TLSClientConfig: tlsConfigInsecure,
+		MaxConnsPerHost: maxConns,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			c, err := tls.Dial(network, addr, cfg)
+			if err != nil {
+				return nil, err
+			}
+			connCountMu.Lock()
+			defer connCountMu.Unlock()
+			connCount++
+			if connCount > maxOpen {
+				maxOpen = connCount
+			}
+			return &closeHookConn{Conn: c, onClose: func() {
+				connCountMu.Lock()
+				defer connCountMu.Unlock()
+				connCount--
+			}}, nil
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	const reqCount = 3 * maxConns * initialMaxConcurrentStreams
+	var wg sync.WaitGroup
+	errs := make(chan error, reqCount)
+	for i := 0; i < reqCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := http.NewRequest("GET", st.ts.URL, nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+			res, err := tr.RoundTrip(req)
+			if err != nil {
+				errs <- err
+				return
+			}
+			res.Body.Close()
+			if res.StatusCode != 200 {
+				errs <- fmt.Errorf("StatusCode = %v; want 200", res.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	connCountMu.Lock()
+	defer connCountMu.Unlock()
+	if maxOpen > maxConns {
+		t.Errorf("had %v connections open for %v requests, want at most %v", maxOpen, reqCount, maxConns)
+	}
+}
+
+func TestTransportMaxConnsPerHostCountsDials(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {}, optOnlyServer)
+	defer st.Close()
+
+	dialStarted := make(chan struct{})
+	failDial := make(chan struct{})
+	var (
+		dialsMu  sync.Mutex
+		dials    int
+		inFlight int
+		maxDials int // most dials in flight at once
+	)
+	tr := &Transport{
+		TLSClientConfig: tlsConfigInsecure,
+		MaxConnsPerHost: 1,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			dialsMu.Lock()
+			dials++
+			n := dials
+			inFlight++
+			if inFlight > maxDials {
+				maxDials = inFlight
+			}
+			dialsMu.Unlock()
+			defer func() {
+				dialsMu.Lock()
+				inFlight--
+				dialsMu.Unlock()
+			}()
+			if n == 1 {
+				close(dialStarted)
+				<-failDial
+				return nil, errors.New("first dial fails")
+			}
+			return tls.Dial(network, addr, cfg)
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	errc := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest("GET", st.ts.URL, nil)
+		_, err := tr.RoundTrip(req)
+		errc <- err
+	}()
+	<-dialStarted
+
+	// The dial in flight uses up the limit: a second request waits
+	// for it to complete instead of joining it.
+	resc := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest("GET", st.ts.URL, nil)
+		res, err := tr.RoundTrip(req)
+		if err == nil {
+			res.Body.Close()
+		}
+		resc <- err
+	}()
+	p := tr.connPool().(*clientConnPool)
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		p.mu.Lock()
+		waiting := p.connsChanged != nil
+		p.mu.Unlock()
+		if waiting {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			close(failDial)
+			t.Fatalf("second request did not wait for the dial in flight")
+		}
+	}
+
+	close(failDial)
+	if err := <-errc; err == nil {
+		t.Errorf("first request succeeded; want the dial error")
+	}
+	if err := <-resc; err != nil {
+		t.Errorf("second request: %v", err)
+	}
+	dialsMu.Lock()
+	defer dialsMu.Unlock()
+	if dials != 2 || maxDials != 1 {
+		t.Errorf("made %v dials, %v at most at once; want 2, 1 at once", dials, maxDials)
+	}
+}
+
+// A connection the server is draining, by setting
+// SETTINGS_MAX_CONCURRENT_STREAMS to zero, must not count toward
+// MaxConnsPerHost, or requests waiting for room would wait until it
+// is closed.
+func TestTransportMaxConnsPerHostIgnoresDrainingConn(t *testing.T) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+	gotFirst := make(chan struct{})
+	drain := make(chan struct{})
+	go func() {
+		for n := 0; ; n++ {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			go serveDrainTestConn(c, n == 0, gotFirst, drain)
+		}
+	}()
+
+	gotSettings := make(chan struct{})
+	var settingsOnce sync.Once
+	tr := &Transport{
+		MaxConnsPerHost: 1,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial("tcp", ln.Addr().String())
+		},
+		SettingsChanged: func(cc *ClientConn, state ClientConnState) {
+			settingsOnce.Do(func() { close(gotSettings) })
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	// The first request takes the only stream of the only
+	// connection allowed, and is never answered.
+	go func() {
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		tr.RoundTrip(req)
+	}()
+	<-gotFirst
+	<-gotSettings
+
+	resc := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		res, err := tr.RoundTrip(req)
+		if err == nil {
+			res.Body.Close()
+		}
+		resc <- err
+	}()
+	p := tr.connPool().(*clientConnPool)
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		p.mu.Lock()
+		waiting := p.connsChanged != nil
+		p.mu.Unlock()
+		if waiting {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("second request did not wait for room under MaxConnsPerHost")
+		}
+	}
+
+	close(drain)
+	select {
+	case err := <-resc:
+		if err != nil {
+			t.Errorf("second request: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("second request still waiting after the first connection started draining")
+	}
+}
+
+// serveDrainTestConn serves c for TestTransportMaxConnsPerHostIgnoresDrainingConn.
+// The first connection allows a single stream: it reports its first
+// request on gotFirst, never answers it, and starts draining when
+// drain is closed. Other connections answer each request with a 200.
+func serveDrainTestConn(c net.Conn, first bool, gotFirst, drain chan struct{}) {
+	buf := make([]byte, len(ClientPreface))
+	if _, err := io.ReadFull(c, buf); err != nil {
+		return
+	}
+	fr := NewFramer(c, c)
+	if first {
+		fr.WriteSettings(Setting{SettingMaxConcurrentStreams, 1})
+	} else {
+		fr.WriteSettings()
+	}
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			return
+		}
+		switch f := f.(type) {
+		case *SettingsFrame:
+			if !f.IsAck() {
+				fr.WriteSettingsAck()
+			}
+		case *HeadersFrame:
+			if first {
+				close(gotFirst)
+				<-drain
+				fr.WriteSettings(Setting{SettingMaxConcurrentStreams, 0})
+				continue
+			}
+			var hbuf bytes.Buffer
+			enc := hpack.NewEncoder(&hbuf)
+			enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+			fr.WriteHeaders(HeadersFrameParam{
+				StreamID:      f.StreamID,
+				EndHeaders:    true,
+				EndStream:     true,
+				BlockFragment: hbuf.Bytes(),
+			})
+		}
+	}
+}
+
+// closeHookConn is a net.Conn which calls onClose the first time it is
+// closed.
+type closeHookConn struct {
+	net.Conn
+	once    sync.Once
+	onClose func()
+}
+
+func (c *closeHookConn) Close() error {
+	c.once.Do(c.onClose)
+	return c.Conn.Close()
+}
+
+func TestTransportMaxConnsPerHostContextDone(t *testing.T) {
+	gotRequest := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		gotRequest <- struct{}{}
+		<-unblock
+	}, optOnlyServer, func(s *Server) {
+		s.MaxConcurrentStreams = 1
+	})
+	defer st.Close()
+	defer close(unblock)
+
+	var dials int32
+	tr := &Transport{
+		TLSClientConfig: tlsConfigInsecure,
+		MaxConnsPerHost: 1,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return tls.Dial(network, addr, cfg)
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	// Occupy the only stream of the only connection.
+	go func() {
+		req, _ := http.NewRequest("GET", st.ts.URL, nil)
+		if res, err := tr.RoundTrip(req); err == nil {
+			res.Body.Close()
+		}
+	}()
+	<-gotRequest
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", st.ts.URL, nil)
+	if _, err := tr.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RoundTrip = %v; want context.DeadlineExceeded", err)
+	}
+	if got := atomic.LoadInt32(&dials); got != 1 {
+		t.Errorf("dialed %v connections; want 1", got)
+	}
+}
+
 // tests Transport.StrictMaxConcurrentStreams
 func TestTransportRequestsStallAtServerLimit(t *testing.T) {
 	const maxConcurrent = 2
@@ -4243,65 +5725,357 @@ func TestTransportRequestsStallAtServerLimit(t *testing.T) {
 		var wg sync.WaitGroup
 		defer wg.Wait()
 
-		ct.greet(Setting{SettingMaxConcurrentStreams, maxConcurrent})
+		ct.greet(Setting{SettingMaxConcurrentStreams, maxConcurrent})
+
+		// Server write loop.
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		writeResp := make(chan uint32, maxConcurrent+1)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-unblockServer
+			for id := range writeResp {
+				buf.Reset()
+				enc.WriteField(hpack.HeaderField{Name: ":status", Value: "204"})
+				ct.fr.WriteHeaders(HeadersFrameParam{
+					StreamID:      id,
+					EndHeaders:    true,
+					EndStream:     true,
+					BlockFragment: buf.Bytes(),
+				})
+			}
+		}()
+
+		// Server read loop.
+		var nreq int
+		for {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				select {
+				case <-clientDone:
+					// If the client's done, it will have reported any errors on its side.
+					return nil
+				default:
+					return err
+				}
+			}
+			switch f := f.(type) {
+			case *WindowUpdateFrame:
+			case *SettingsFrame:
+				// Wait for the client SETTINGS ack until ending the greet.
+				close(greet)
+			case *HeadersFrame:
+				if !f.HeadersEnded() {
+					return fmt.Errorf("headers should have END_HEADERS be ended: %v", f)
+				}
+				gotRequest <- struct{}{}
+				nreq++
+				writeResp <- f.StreamID
+				if nreq == maxConcurrent+1 {
+					close(writeResp)
+				}
+			case *DataFrame:
+			default:
+				return fmt.Errorf("Unexpected client frame %v", f)
+			}
+		}
+	}
+
+	ct.run()
+}
+
+// Tests that a server setting SETTINGS_MAX_CONCURRENT_STREAMS to zero
+// mid-connection drains it: the stream already open runs to completion,
+// and new requests are sent on a new connection.
+func TestTransportMaxConcurrentStreamsZeroDrains(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%v", strict), func(t *testing.T) {
+			testTransportMaxConcurrentStreamsZeroDrains(t, strict)
+		})
+	}
+}
+
+func testTransportMaxConcurrentStreamsZeroDrains(t *testing.T, strict bool) {
+	finishFirst := make(chan struct{})
+	var serverWG sync.WaitGroup
+	defer serverWG.Wait()
+
+	// serve runs a minimal HTTP/2 server on the n'th dialed connection.
+	// On the first connection, it replies to the first request with
+	// headers only, sets MAX_CONCURRENT_STREAMS to zero, and finishes
+	// the response once finishFirst is closed.
+	serve := func(n int, sc net.Conn) {
+		defer serverWG.Done()
+		defer sc.Close()
+		if _, err := io.ReadFull(sc, make([]byte, len(ClientPreface))); err != nil {
+			t.Errorf("conn %v: reading client preface: %v", n, err)
+			return
+		}
+		fr := NewFramer(sc, sc)
+		fr.WriteSettings()
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		for {
+			f, err := fr.ReadFrame()
+			if err != nil {
+				return
+			}
+			hf, ok := f.(*HeadersFrame)
+			if !ok {
+				continue
+			}
+			buf.Reset()
+			enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+			enc.WriteField(hpack.HeaderField{Name: "x-conn", Value: strconv.Itoa(n)})
+			if n > 0 || hf.StreamID != 1 {
+				fr.WriteHeaders(HeadersFrameParam{
+					StreamID:      hf.StreamID,
+					EndHeaders:    true,
+					EndStream:     true,
+					BlockFragment: buf.Bytes(),
+				})
+				continue
+			}
+			fr.WriteHeaders(HeadersFrameParam{
+				StreamID:      hf.StreamID,
+				EndHeaders:    true,
+				BlockFragment: buf.Bytes(),
+			})
+			fr.WriteSettings(Setting{SettingMaxConcurrentStreams, 0})
+			<-finishFirst
+			fr.WriteData(hf.StreamID, true, []byte("done"))
+		}
+	}
+
+	var dialMu sync.Mutex
+	dials := 0
+	drained := make(chan ClientConnState, 1)
+	tr := &Transport{
+		TLSClientConfig:            tlsConfigInsecure,
+		StrictMaxConcurrentStreams: strict,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			ln := newLocalListener(t)
+			defer ln.Close()
+			cc, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				return nil, err
+			}
+			sc, err := ln.Accept()
+			if err != nil {
+				cc.Close()
+				return nil, err
+			}
+			dialMu.Lock()
+			n := dials
+			dials++
+			dialMu.Unlock()
+			serverWG.Add(1)
+			go serve(n, sc)
+			return cc, nil
+		},
+		SettingsChanged: func(cc *ClientConn, st ClientConnState) {
+			if st.Draining {
+				select {
+				case drained <- st:
+				default:
+				}
+			}
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	req, _ := http.NewRequest("GET", "https://dummy.tld/1", nil)
+	res1, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip 1: %v", err)
+	}
+	defer res1.Body.Close()
+	if got := res1.Header.Get("X-Conn"); got != "0" {
+		t.Errorf("request 1 served by conn %q, want 0", got)
+	}
+
+	st := <-drained
+	if st.StreamsActive != 1 || st.MaxConcurrentStreams != 0 {
+		t.Errorf("SettingsChanged state = %+v; want 1 active stream and MaxConcurrentStreams = 0", st)
+	}
+
+	req, _ = http.NewRequest("GET", "https://dummy.tld/2", nil)
+	res2, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip 2: %v", err)
+	}
+	res2.Body.Close()
+	if got := res2.Header.Get("X-Conn"); got != "1" {
+		t.Errorf("request 2 served by conn %q, want 1", got)
+	}
+
+	close(finishFirst)
+	body, err := io.ReadAll(res1.Body)
+	if err != nil || string(body) != "done" {
+		t.Errorf("request 1 body = %q, %v; want %q, nil", body, err, "done")
+	}
+
+	dialMu.Lock()
+	defer dialMu.Unlock()
+	if dials != 2 {
+		t.Errorf("dialed %v connections, want 2", dials)
+	}
+}
+
+func TestTransportMaxConcurrentStreams(t *testing.T) {
+	t.Run("strict", func(t *testing.T) { testTransportMaxConcurrentStreams(t, true) })
+	t.Run("not_strict", func(t *testing.T) { testTransportMaxConcurrentStreams(t, false) })
+}
+
+func testTransportMaxConcurrentStreams(t *testing.T, strict bool) {
+	const numReqs = 3
+	var (
+		mu        sync.Mutex
+		active    int
+		maxActive int
+		conns     = map[string]bool{}
+	)
+	arrived := make(chan struct{}, numReqs)
+	release := make(chan struct{})
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		conns[r.RemoteAddr] = true
+		mu.Unlock()
+		arrived <- struct{}{}
+		if !strict && r.URL.Path != "/first" {
+			// Hold every request until all have arrived, which
+			// is only possible on separate connections.
+			<-release
+		}
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}, optOnlyServer)
+	defer st.Close()
+
+	tr := &Transport{
+		TLSClientConfig:            tlsConfigInsecure,
+		MaxConcurrentStreams:       1,
+		StrictMaxConcurrentStreams: strict,
+	}
+	defer tr.CloseIdleConnections()
 
-		// Server write loop.
-		var buf bytes.Buffer
-		enc := hpack.NewEncoder(&buf)
-		writeResp := make(chan uint32, maxConcurrent+1)
+	// Establish one connection first, so that strict mode has only
+	// one connection to queue requests on.
+	req, _ := http.NewRequest("GET", st.ts.URL+"/first", nil)
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	<-arrived
 
+	var wg sync.WaitGroup
+	for i := 0; i < numReqs; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			<-unblockServer
-			for id := range writeResp {
-				buf.Reset()
-				enc.WriteField(hpack.HeaderField{Name: ":status", Value: "204"})
-				ct.fr.WriteHeaders(HeadersFrameParam{
-					StreamID:      id,
-					EndHeaders:    true,
-					EndStream:     true,
-					BlockFragment: buf.Bytes(),
-				})
+			req, _ := http.NewRequest("GET", st.ts.URL, nil)
+			res, err := tr.RoundTrip(req)
+			if err != nil {
+				t.Error(err)
+				return
 			}
+			res.Body.Close()
 		}()
+	}
+	for i := 0; i < numReqs; i++ {
+		<-arrived
+	}
+	close(release)
+	wg.Wait()
 
-		// Server read loop.
-		var nreq int
-		for {
-			f, err := ct.fr.ReadFrame()
-			if err != nil {
-				select {
-				case <-clientDone:
-					// If the client's done, it will have reported any errors on its side.
-					return nil
-				default:
-					return err
-				}
-			}
-			switch f := f.(type) {
-			case *WindowUpdateFrame:
-			case *SettingsFrame:
-				// Wait for the client SETTINGS ack until ending the greet.
-				close(greet)
-			case *HeadersFrame:
-				if !f.HeadersEnded() {
-					return fmt.Errorf("headers should have END_HEADERS be ended: %v", f)
-				}
-				gotRequest <- struct{}{}
-				nreq++
-				writeResp <- f.StreamID
-				if nreq == maxConcurrent+1 {
-					close(writeResp)
-				}
-			case *DataFrame:
-			default:
-				return fmt.Errorf("Unexpected client frame %v", f)
+	mu.Lock()
+	defer mu.Unlock()
+	wantConns := numReqs
+	if strict {
+		wantConns = 1
+	}
+	if strict && maxActive != 1 {
+		t.Errorf("server saw %v concurrent requests; want 1", maxActive)
+	}
+	if len(conns) != wantConns {
+		t.Errorf("requests used %v connections; want %v", len(conns), wantConns)
+	}
+}
+
+func TestClientConnStateStreamCounts(t *testing.T) {
+	unblock := make(chan struct{})
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}, optOnlyServer, func(s *Server) {
+		s.MaxConcurrentStreams = 10
+	})
+	defer st.Close()
+
+	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
+	defer tr.CloseIdleConnections()
+	tc, err := tls.Dial("tcp", st.ts.Listener.Addr().String(), tr.newTLSConfig(st.ts.Listener.Addr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, err := tr.NewClientConn(tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	waitState := func(desc string, f func(ClientConnState) bool) ClientConnState {
+		t.Helper()
+		var s ClientConnState
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+			if s = cc.State(); f(s) {
+				return s
 			}
 		}
+		t.Fatalf("timed out waiting for %v; state = %+v", desc, s)
+		return s
 	}
 
-	ct.run()
+	const reqs = 3
+	var wg sync.WaitGroup
+	for i := 0; i < reqs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", st.ts.URL, nil)
+			res, err := cc.RoundTrip(req)
+			if err != nil {
+				t.Errorf("RoundTrip: %v", err)
+				return
+			}
+			res.Body.Close()
+		}()
+	}
+	s := waitState("active streams", func(s ClientConnState) bool {
+		return s.StreamsActive == reqs && s.MaxConcurrentStreams != 0
+	})
+	if s.MaxConcurrentStreams != 10 {
+		t.Errorf("MaxConcurrentStreams = %v, want 10", s.MaxConcurrentStreams)
+	}
+	if !cc.ReserveNewRequest() {
+		t.Fatalf("ReserveNewRequest() = false, want true")
+	}
+	if s := cc.State(); s.StreamsReserved != 1 {
+		t.Errorf("StreamsReserved = %v, want 1", s.StreamsReserved)
+	}
+
+	close(unblock)
+	wg.Wait()
+	waitState("streams to finish", func(s ClientConnState) bool {
+		return s.StreamsActive == 0
+	})
 }
 
 func TestTransportMaxDecoderHeaderTableSize(t *testing.T) {
@@ -4448,6 +6222,49 @@ func TestTransportMaxEncoderHeaderTableSize(t *testing.T) {
 	ct.run()
 }
 
+func TestTransportSmallHeaderTableSizes(t *testing.T) {
+	const tableSize = 64
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Echo", r.Header.Get("Echo"))
+	}, optOnlyServer)
+	defer st.Close()
+
+	tr := &Transport{
+		TLSClientConfig:           tlsConfigInsecure,
+		MaxDecoderHeaderTableSize: tableSize,
+		MaxEncoderHeaderTableSize: tableSize,
+	}
+	defer tr.CloseIdleConnections()
+	cc, err := tr.dialClientConn(context.Background(), st.ts.Listener.Addr().String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	// Send headers both smaller and larger than the tables, several
+	// times, so that both ends must agree on which fields are indexed.
+	for i := 0; i < 3; i++ {
+		for _, v := range []string{"short", strings.Repeat("x", 2*tableSize)} {
+			req, _ := http.NewRequest("GET", st.ts.URL, nil)
+			req.Header.Set("Echo", v)
+			res, err := cc.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if got := res.Header.Get("Echo"); got != v {
+				t.Errorf("Echo = %q; want %q", got, v)
+			}
+		}
+	}
+	cc.wmu.Lock()
+	got := cc.henc.MaxDynamicTableSize()
+	cc.wmu.Unlock()
+	if got != tableSize {
+		t.Errorf("henc.MaxDynamicTableSize() = %d; want %d", got, tableSize)
+	}
+}
+
 func TestAuthorityAddr(t *testing.T) {
 	tests := []struct {
 		scheme, authority string
@@ -4941,6 +6758,178 @@ func TestClientConnShutdownCancel(t *testing.T) {
 	testClientConnClose(t, shutdownCancel)
 }
 
+func TestTransportExtendedConnect(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" || r.Header.Get(":protocol") != "websocket" || r.URL.Path != "/chat" {
+			t.Errorf("got %v %v with :protocol %q; want extended CONNECT for websocket to /chat", r.Method, r.URL, r.Header.Get(":protocol"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		// Echo the tunneled data.
+		buf := make([]byte, 64)
+		for {
+			n, err := r.Body.Read(buf)
+			if n > 0 {
+				w.Write(buf[:n])
+				w.(http.Flusher).Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}, optOnlyServer, func(s *Server) {
+		s.EnableExtendedConnect = true
+	})
+	defer st.Close()
+	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
+	defer tr.CloseIdleConnections()
+
+	pr, pw := io.Pipe()
+	req, _ := http.NewRequest("CONNECT", st.ts.URL+"/chat", pr)
+	req.Header.Set(":protocol", "websocket")
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("StatusCode = %v; want 200", res.StatusCode)
+	}
+	for _, msg := range []string{"hello", "world"} {
+		if _, err := io.WriteString(pw, msg); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(res.Body, buf); err != nil {
+			t.Fatalf("reading echo: %v", err)
+		}
+		if string(buf) != msg {
+			t.Errorf("echo = %q; want %q", buf, msg)
+		}
+	}
+	pw.Close()
+	if _, err := io.Copy(ioutil.Discard, res.Body); err != nil {
+		t.Errorf("reading end of tunnel: %v", err)
+	}
+}
+
+// If the connection fails before the server's SETTINGS arrive, an
+// extended CONNECT request fails with the connection's error, not
+// ErrExtendedConnectNotSupported.
+func TestTransportExtendedConnectConnClosedBeforeSettings(t *testing.T) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// Read the client's preface and SETTINGS, then hang up.
+			buf := make([]byte, len(ClientPreface))
+			io.ReadFull(c, buf)
+			NewFramer(nil, c).ReadFrame()
+			c.Close()
+		}
+	}()
+	tr := &Transport{
+		MaxRetries: -1,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial("tcp", ln.Addr().String())
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	req, _ := http.NewRequest("CONNECT", "https://dummy.tld/chat", nil)
+	req.Header.Set(":protocol", "websocket")
+	_, err := tr.RoundTrip(req)
+	if err == nil || err == ErrExtendedConnectNotSupported {
+		t.Errorf("RoundTrip = %v; want the connection's error", err)
+	}
+}
+
+func TestTransportExtendedConnectNotSupported(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called for extended CONNECT request")
+	}, optOnlyServer)
+	defer st.Close()
+	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
+	defer tr.CloseIdleConnections()
+
+	req, _ := http.NewRequest("CONNECT", st.ts.URL+"/chat", nil)
+	req.Header.Set(":protocol", "websocket")
+	if _, err := tr.RoundTrip(req); err != ErrExtendedConnectNotSupported {
+		t.Errorf("RoundTrip = %v; want %v", err, ErrExtendedConnectNotSupported)
+	}
+
+	// A header named :protocol is not sent on other requests.
+	req, _ = http.NewRequest("GET", st.ts.URL, nil)
+	req.Header.Set(":protocol", "websocket")
+	if _, err := tr.RoundTrip(req); err == nil {
+		t.Errorf("RoundTrip of GET with :protocol succeeded; want error")
+	}
+}
+
+func TestClientConnShutdownRefusesNewRequests(t *testing.T) {
+	release := make(chan struct{})
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+	}, optOnlyServer)
+	defer st.Close()
+	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
+	defer tr.CloseIdleConnections()
+	cc, err := tr.dialClientConn(context.Background(), st.ts.Listener.Addr().String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", st.ts.URL, nil)
+	res, err := cc.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	shutdownc := make(chan error, 1)
+	go func() {
+		shutdownc <- cc.Shutdown(context.Background())
+	}()
+	for !cc.State().Closing {
+		time.Sleep(time.Millisecond)
+	}
+
+	// New requests fail with an error the Transport retries on
+	// another connection.
+	req2, _ := http.NewRequest("GET", st.ts.URL, nil)
+	if _, err := cc.RoundTrip(req2); !canRetryError(err) {
+		t.Errorf("RoundTrip after Shutdown = %v; want retryable error", err)
+	}
+	select {
+	case err := <-shutdownc:
+		t.Fatalf("Shutdown returned %v with a request in flight", err)
+	default:
+	}
+
+	close(release)
+	if _, err := io.Copy(ioutil.Discard, res.Body); err != nil {
+		t.Errorf("reading in-flight response body: %v", err)
+	}
+	select {
+	case err := <-shutdownc:
+		if err != nil {
+			t.Errorf("Shutdown = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for Shutdown")
+	}
+	if st := cc.State(); !st.Closed {
+		t.Errorf("after Shutdown, State().Closed = false; want true")
+	}
+}
+
 // Issue 25009: use Request.GetBody if present, even if it seems like
 // we might not need it. Apparently something else can still read from
 // the original request body. Data race? In any case, rewinding
@@ -5408,7 +7397,65 @@ func TestTransportServerResetStreamAtHeaders(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	res.Body.Close()
+	res.Body.Close()
+}
+
+func TestTransportResetStreamErrorCode(t *testing.T) {
+	ct := newClientTester(t)
+	ct.client = func() error {
+		var se StreamError
+
+		// Reset while reading the response body.
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return fmt.Errorf("RoundTrip: %v", err)
+		}
+		_, err = ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if !errors.As(err, &se) || se.Code != ErrCodeInternal {
+			return fmt.Errorf("reading body: %v; want StreamError with code %v", err, ErrCodeInternal)
+		}
+
+		// Reset before the response headers.
+		req, _ = http.NewRequest("GET", "https://dummy.tld/", nil)
+		res, err = ct.tr.RoundTrip(req)
+		if err == nil {
+			res.Body.Close()
+			return errors.New("RoundTrip succeeded; want error")
+		}
+		if !errors.As(err, &se) || se.Code != ErrCodeEnhanceYourCalm {
+			return fmt.Errorf("RoundTrip error = %v; want StreamError with code %v", err, ErrCodeEnhanceYourCalm)
+		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet()
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		for {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				return err
+			}
+			hf, ok := f.(*HeadersFrame)
+			if !ok {
+				continue
+			}
+			if hf.StreamID != 1 {
+				return ct.fr.WriteRSTStream(hf.StreamID, ErrCodeEnhanceYourCalm)
+			}
+			enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+			ct.fr.WriteHeaders(HeadersFrameParam{
+				StreamID:      hf.StreamID,
+				EndHeaders:    true,
+				BlockFragment: buf.Bytes(),
+			})
+			ct.fr.WriteData(hf.StreamID, false, []byte("partial"))
+			ct.fr.WriteRSTStream(hf.StreamID, ErrCodeInternal)
+		}
+	}
+	ct.run()
 }
 
 type trackingReader struct {
@@ -6457,3 +8504,441 @@ func TestTransportReuseAfterError(t *testing.T) {
 	})
 	<-req1c
 }
+
+func TestTransportFlowControlStalled(t *testing.T) {
+	// The client assumes the default window of 65535 until it sees
+	// the server's SETTINGS, so use that.
+	const window = 65535
+	const bodySize = 4 * window
+	const delay = 20 * time.Millisecond
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		// Let the client exhaust the stream window before reading.
+		time.Sleep(delay)
+		io.Copy(io.Discard, r.Body)
+	}, optOnlyServer, func(s *Server) {
+		s.MaxUploadBufferPerStream = window
+	})
+	defer st.Close()
+
+	var (
+		mu     sync.Mutex
+		stalls []FlowControlStall
+	)
+	tr := &Transport{
+		TLSClientConfig: tlsConfigInsecure,
+		FlowControlStalled: func(s FlowControlStall) {
+			mu.Lock()
+			defer mu.Unlock()
+			stalls = append(stalls, s)
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	req, _ := http.NewRequest("POST", st.ts.URL, bytes.NewReader(make([]byte, bodySize)))
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(stalls) == 0 {
+		t.Fatal("FlowControlStalled not called")
+	}
+	var total time.Duration
+	for _, s := range stalls {
+		if s.StreamID != 1 || s.Conn {
+			t.Errorf("FlowControlStalled reported %+v; want stream 1 stalled on its own window", s)
+		}
+		total += s.Duration
+	}
+	if total < delay/2 {
+		t.Errorf("total stall duration %v, want at least %v", total, delay/2)
+	}
+}
+
+func TestTransportOnStreamSlotWait(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	release := make(chan struct{})
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			<-release
+		}
+	}, optOnlyServer, func(s *Server) {
+		s.MaxConcurrentStreams = 1
+	})
+	defer st.Close()
+
+	waits := make(chan StreamSlotWait, 2)
+	tr := &Transport{
+		TLSClientConfig:            tlsConfigInsecure,
+		StrictMaxConcurrentStreams: true,
+		OnStreamSlotWait:           func(w StreamSlotWait) { waits <- w },
+	}
+	defer tr.CloseIdleConnections()
+	cc, err := tr.dialClientConn(context.Background(), st.ts.Listener.Addr().String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !waitCondition(5*time.Second, time.Millisecond, func() bool {
+		return cc.State().MaxConcurrentStreams == 1
+	}) {
+		t.Fatal("server's SETTINGS not received")
+	}
+
+	// Saturate the connection.
+	blockDone := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest("GET", st.ts.URL+"/block", nil)
+		res, err := cc.RoundTrip(req)
+		if err == nil {
+			res.Body.Close()
+		}
+		blockDone <- err
+	}()
+	if !waitCondition(5*time.Second, time.Millisecond, func() bool {
+		return cc.State().StreamsActive == 1
+	}) {
+		t.Fatal("first request not sent")
+	}
+
+	req, _ := http.NewRequest("GET", st.ts.URL, nil)
+	go func() {
+		w := <-waits
+		if w.Request != req || w.Done {
+			t.Errorf("OnStreamSlotWait reported %+v; want the start of the wait of the second request", w)
+		}
+		time.Sleep(delay)
+		close(release)
+	}()
+	res, err := cc.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if err := <-blockDone; err != nil {
+		t.Fatal(err)
+	}
+	w := <-waits
+	if w.Request != req || !w.Done || w.Err != nil {
+		t.Errorf("OnStreamSlotWait reported %+v; want the end of a successful wait of the second request", w)
+	}
+	if w.Duration < delay {
+		t.Errorf("wait Duration = %v; want at least %v", w.Duration, delay)
+	}
+	select {
+	case w := <-waits:
+		t.Errorf("unexpected OnStreamSlotWait call %+v", w)
+	default:
+	}
+}
+
+func TestTransportDialContext(t *testing.T) {
+	srv := &Server{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	})
+	var dials []string
+	tr := &Transport{
+		AllowHTTP: true,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials = append(dials, network+" "+addr)
+			c, s := net.Pipe()
+			go srv.ServeConn(s, &ServeConnOpts{Handler: handler})
+			return c, nil
+		},
+		// Not used when DialContext is set.
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			t.Errorf("DialTLSContext called")
+			return nil, errors.New("unexpected dial")
+		},
+	}
+	defer tr.CloseIdleConnections()
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "HTTP/2.0" || res.TLS != nil {
+			t.Errorf("response body %q, TLS %v; want HTTP/2.0 without TLS", body, res.TLS)
+		}
+	}
+	if want := []string{"tcp example.com:80"}; !reflect.DeepEqual(dials, want) {
+		t.Errorf("dials = %q; want %q", dials, want)
+	}
+}
+
+func TestTransportRejectsPriorityUpdate(t *testing.T) {
+	ct := newClientTester(t)
+	ct.client = func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "https://dummy.tld/", nil)
+		_, err := ct.tr.RoundTrip(req)
+		if err != ConnectionError(ErrCodeProtocol) {
+			return fmt.Errorf("RoundTrip = %v, want %v", err, ConnectionError(ErrCodeProtocol))
+		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet()
+		hf, err := ct.firstHeaders()
+		if err != nil {
+			return err
+		}
+		if err := ct.fr.WritePriorityUpdate(hf.StreamID, "u=1"); err != nil {
+			return err
+		}
+		// The client closes the connection.
+		for {
+			if _, err := ct.readFrame(); err != nil {
+				return nil
+			}
+		}
+	}
+	ct.run()
+}
+
+func TestTransportStreamPriority(t *testing.T) {
+	ct := newClientTester(t)
+	ct.client = func() error {
+		ctx := WithStreamPriority(context.Background(), StreamPriority{Urgency: 0, Incremental: true})
+		for _, header := range []string{"", "u=5"} {
+			req, _ := http.NewRequestWithContext(ctx, "GET", "https://dummy.tld/", nil)
+			if header != "" {
+				req.Header.Set("Priority", header)
+			}
+			res, err := ct.tr.RoundTrip(req)
+			if err != nil {
+				return err
+			}
+			res.Body.Close()
+		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet()
+		dec := hpack.NewDecoder(initialHeaderTableSize, nil)
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		readFrame := func() (Frame, error) {
+			for {
+				f, err := ct.readNonSettingsFrame()
+				if _, ok := f.(*WindowUpdateFrame); !ok || err != nil {
+					return f, err
+				}
+			}
+		}
+		for _, want := range []string{
+			"u=0, i",
+			"u=5", // the request's own header field wins
+		} {
+			f, err := readFrame()
+			if err != nil {
+				return err
+			}
+			// The initial priority is only sent in the header
+			// field, without a PRIORITY_UPDATE frame.
+			hf, ok := f.(*HeadersFrame)
+			if !ok {
+				return fmt.Errorf("got %v, want HEADERS", summarizeFrame(f))
+			}
+			fields, err := dec.DecodeFull(hf.HeaderBlockFragment())
+			if err != nil {
+				return err
+			}
+			var got []string
+			for _, hf := range fields {
+				if hf.Name == "priority" {
+					got = append(got, hf.Value)
+				}
+			}
+			if len(got) != 1 || got[0] != want {
+				return fmt.Errorf("priority header fields = %q, want %q", got, want)
+			}
+			buf.Reset()
+			enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+			ct.fr.WriteHeaders(HeadersFrameParam{
+				StreamID:      hf.StreamID,
+				EndHeaders:    true,
+				EndStream:     true,
+				BlockFragment: buf.Bytes(),
+			})
+		}
+		return nil
+	}
+	ct.run()
+}
+
+// connRacePool hands out its connections in turn.
+type connRacePool struct {
+	mu    sync.Mutex
+	conns []*ClientConn
+}
+
+func (p *connRacePool) GetClientConn(req *http.Request, addr string) (*ClientConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.conns) == 0 {
+		return nil, errors.New("no more connections")
+	}
+	cc := p.conns[0]
+	p.conns = p.conns[1:]
+	return cc, nil
+}
+
+func (p *connRacePool) MarkDead(*ClientConn) {}
+
+func TestTransportRetryConnRace(t *testing.T) {
+	srv := &Server{}
+	var handled int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&handled, 1)
+	})
+	pool := &connRacePool{}
+	var retries []RequestRetry
+	tr := &Transport{
+		AllowHTTP:  true,
+		ConnPool:   pool,
+		MaxRetries: -1,
+		OnRetry: func(r RequestRetry) {
+			retries = append(retries, r)
+		},
+	}
+	for i := 0; i < 2; i++ {
+		c, s := net.Pipe()
+		go srv.ServeConn(s, &ServeConnOpts{Handler: handler})
+		cc, err := tr.NewClientConn(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cc.Close()
+		pool.conns = append(pool.conns, cc)
+	}
+	// The first connection becomes unusable between being handed to
+	// the request and the request being sent on it.
+	pool.conns[0].SetDoNotReuse()
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip with MaxRetries < 0: %v", err)
+	}
+	res.Body.Close()
+	if got := atomic.LoadInt32(&handled); got != 1 {
+		t.Errorf("request handled %d times, want 1", got)
+	}
+	if len(retries) != 1 || !retries[0].ConnRace || retries[0].Err != errClientConnUnusable {
+		t.Errorf("retries = %+v, want one connection race retry", retries)
+	}
+}
+
+func TestTransportConcurrentFirstRequests(t *testing.T) {
+	const n = 50
+	var mu sync.Mutex
+	handled := make(map[string]int)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("Request-Id")
+		mu.Lock()
+		handled[id]++
+		mu.Unlock()
+		io.WriteString(w, id)
+	}, optOnlyServer)
+	defer st.Close()
+
+	// The first connection is shut down as soon as it is established,
+	// before it could process any request, so that the requests racing
+	// to use it are retried on the connections dialed next.
+	var dials int32
+	tr := &Transport{
+		TLSClientConfig: tlsConfigInsecure,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			if atomic.AddInt32(&dials, 1) > 1 {
+				return tls.Dial(network, st.ts.Listener.Addr().String(), cfg)
+			}
+			c, s := net.Pipe()
+			go func() {
+				defer s.Close()
+				if _, err := io.ReadFull(s, make([]byte, len(ClientPreface))); err != nil {
+					return
+				}
+				fr := NewFramer(s, s)
+				readDone := make(chan struct{})
+				go func() {
+					defer close(readDone)
+					for {
+						if _, err := fr.ReadFrame(); err != nil {
+							return
+						}
+					}
+				}()
+				fr.WriteSettings()
+				fr.WriteGoAway(0, ErrCodeNo, nil)
+				<-readDone
+			}()
+			return c, nil
+		},
+	}
+	var retryMu sync.Mutex
+	var retries []RequestRetry
+	tr.OnRetry = func(r RequestRetry) {
+		retryMu.Lock()
+		defer retryMu.Unlock()
+		retries = append(retries, r)
+	}
+	defer tr.CloseIdleConnections()
+
+	var wg sync.WaitGroup
+	errc := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+			req.Header.Set("Request-Id", id)
+			res, err := tr.RoundTrip(req)
+			if err != nil {
+				errc <- fmt.Errorf("request %s: %v", id, err)
+				return
+			}
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil || string(body) != id {
+				errc <- fmt.Errorf("request %s: got body %q, %v", id, body, err)
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Error(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(handled) != n {
+		t.Errorf("%d distinct requests handled, want %d", len(handled), n)
+	}
+	for id, count := range handled {
+		if count != 1 {
+			t.Errorf("request %s handled %d times, want once", id, count)
+		}
+	}
+	retryMu.Lock()
+	defer retryMu.Unlock()
+	for _, r := range retries {
+		if r.ConnRace != (r.Err == errClientConnUnusable) {
+			t.Errorf("retry after %v reported with ConnRace = %v", r.Err, r.ConnRace)
+		}
+		if !canRetryError(r.Err) {
+			t.Errorf("retry after unretryable error %v", r.Err)
+		}
+	}
+}
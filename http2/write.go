@@ -42,6 +42,9 @@ type writeContext interface {
 	// HeaderEncoder returns an HPACK encoder that writes to the
 	// returned buffer.
 	HeaderEncoder() (*hpack.Encoder, *bytes.Buffer)
+	// countSentHeaders records the raw and encoded sizes of a header
+	// block written with the HeaderEncoder.
+	countSentHeaders(raw, encoded int)
 }
 
 // writeEndsStream reports whether w writes a frame that will transition
@@ -139,6 +142,14 @@ func (w writePingAck) writeFrame(ctx writeContext) error {
 
 func (w writePingAck) staysWithinBuffer(max int) bool { return frameHeaderLen+len(w.pf.Data) <= max }
 
+type writePing struct{ data [8]byte }
+
+func (w writePing) writeFrame(ctx writeContext) error {
+	return ctx.Framer().WritePing(false, w.data)
+}
+
+func (w writePing) staysWithinBuffer(max int) bool { return frameHeaderLen+len(w.data) <= max }
+
 type writeSettingsAck struct{}
 
 func (writeSettingsAck) writeFrame(ctx writeContext) error {
@@ -188,11 +199,13 @@ type writeResHeaders struct {
 	contentLength string
 }
 
-func encKV(enc *hpack.Encoder, k, v string) {
+// encKV encodes the header field k: v and returns its raw size.
+func encKV(enc *hpack.Encoder, k, v string) int {
 	if VerboseLogs {
 		log.Printf("http2: server encoding header %q = %q", k, v)
 	}
 	enc.WriteField(hpack.HeaderField{Name: k, Value: v})
+	return len(k) + len(v)
 }
 
 func (w *writeResHeaders) staysWithinBuffer(max int) bool {
@@ -210,26 +223,28 @@ func (w *writeResHeaders) writeFrame(ctx writeContext) error {
 	enc, buf := ctx.HeaderEncoder()
 	buf.Reset()
 
+	var raw int
 	if w.httpResCode != 0 {
-		encKV(enc, ":status", httpCodeString(w.httpResCode))
+		raw += encKV(enc, ":status", httpCodeString(w.httpResCode))
 	}
 
-	encodeHeaders(enc, w.h, w.trailers)
+	raw += encodeHeaders(enc, w.h, w.trailers)
 
 	if w.contentType != "" {
-		encKV(enc, "content-type", w.contentType)
+		raw += encKV(enc, "content-type", w.contentType)
 	}
 	if w.contentLength != "" {
-		encKV(enc, "content-length", w.contentLength)
+		raw += encKV(enc, "content-length", w.contentLength)
 	}
 	if w.date != "" {
-		encKV(enc, "date", w.date)
+		raw += encKV(enc, "date", w.date)
 	}
 
 	headerBlock := buf.Bytes()
 	if len(headerBlock) == 0 && w.trailers == nil {
 		panic("unexpected empty hpack")
 	}
+	ctx.countSentHeaders(raw, len(headerBlock))
 
 	return splitHeaderBlock(ctx, headerBlock, w.writeHeaderBlock)
 }
@@ -269,16 +284,17 @@ func (w *writePushPromise) writeFrame(ctx writeContext) error {
 	enc, buf := ctx.HeaderEncoder()
 	buf.Reset()
 
-	encKV(enc, ":method", w.method)
-	encKV(enc, ":scheme", w.url.Scheme)
-	encKV(enc, ":authority", w.url.Host)
-	encKV(enc, ":path", w.url.RequestURI())
-	encodeHeaders(enc, w.h, nil)
+	raw := encKV(enc, ":method", w.method)
+	raw += encKV(enc, ":scheme", w.url.Scheme)
+	raw += encKV(enc, ":authority", w.url.Host)
+	raw += encKV(enc, ":path", w.url.RequestURI())
+	raw += encodeHeaders(enc, w.h, nil)
 
 	headerBlock := buf.Bytes()
 	if len(headerBlock) == 0 {
 		panic("unexpected empty hpack")
 	}
+	ctx.countSentHeaders(raw, len(headerBlock))
 
 	return splitHeaderBlock(ctx, headerBlock, w.writeHeaderBlock)
 }
@@ -303,7 +319,8 @@ type write100ContinueHeadersFrame struct {
 func (w write100ContinueHeadersFrame) writeFrame(ctx writeContext) error {
 	enc, buf := ctx.HeaderEncoder()
 	buf.Reset()
-	encKV(enc, ":status", "100")
+	raw := encKV(enc, ":status", "100")
+	ctx.countSentHeaders(raw, buf.Len())
 	return ctx.Framer().WriteHeaders(HeadersFrameParam{
 		StreamID:      w.streamID,
 		BlockFragment: buf.Bytes(),
@@ -328,9 +345,10 @@ func (wu writeWindowUpdate) writeFrame(ctx writeContext) error {
 	return ctx.Framer().WriteWindowUpdate(wu.streamID, wu.n)
 }
 
-// encodeHeaders encodes an http.Header. If keys is not nil, then (k, h[k])
-// is encoded only if k is in keys.
-func encodeHeaders(enc *hpack.Encoder, h http.Header, keys []string) {
+// encodeHeaders encodes an http.Header and returns the raw size of
+// the fields encoded. If keys is not nil, then (k, h[k]) is encoded
+// only if k is in keys.
+func encodeHeaders(enc *hpack.Encoder, h http.Header, keys []string) (raw int) {
 	if keys == nil {
 		sorter := sorterPool.Get().(*sorter)
 		// Using defer here, since the returned keys from the
@@ -364,7 +382,8 @@ func encodeHeaders(enc *hpack.Encoder, h http.Header, keys []string) {
 			if isTE && v != "trailers" {
 				continue
 			}
-			encKV(enc, k, v)
+			raw += encKV(enc, k, v)
 		}
 	}
+	return raw
 }
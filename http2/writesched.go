@@ -121,8 +121,12 @@ func (wr FrameWriteRequest) Consume(n int32) (FrameWriteRequest, FrameWriteReque
 		allowed = wr.stream.sc.maxFrameSize
 	}
 	if allowed <= 0 {
+		if wr.stream.flow.available() <= 0 {
+			wr.stream.noteFlowStall()
+		}
 		return empty, empty, 0
 	}
+	wr.stream.endFlowStall()
 	if len(wd.p) > int(allowed) {
 		wr.stream.flow.take(allowed)
 		consumed := FrameWriteRequest{
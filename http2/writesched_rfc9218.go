@@ -0,0 +1,170 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import "math"
+
+// A StreamPriorityScheduler is a WriteScheduler that orders streams by
+// the extensible priorities of RFC 9218. When the write scheduler of a
+// Server implements it, the server passes it the priority of each
+// request, taken from the request's "priority" header field and from
+// the PRIORITY_UPDATE frames the client sends.
+type StreamPriorityScheduler interface {
+	WriteScheduler
+
+	// AdjustStreamPriority sets the priority of an open stream.
+	// Streams are opened with DefaultStreamPriority. It may be called
+	// on a stream that is not open, which has no effect.
+	AdjustStreamPriority(streamID uint32, priority StreamPriority)
+}
+
+// NewExtensiblePriorityWriteScheduler constructs a write scheduler
+// that follows the priorities of RFC 9218 and ignores those of RFC
+// 7540. Control frames are written first. Then streams with a lower
+// urgency are written before those with a higher one. Among streams of
+// the same urgency, non-incremental streams are written one at a time,
+// in order of stream ID, before incremental streams, which take turns
+// one frame at a time.
+func NewExtensiblePriorityWriteScheduler() StreamPriorityScheduler {
+	return &extensiblePriorityWriteScheduler{
+		streams: make(map[uint32]*extensiblePriorityStream),
+	}
+}
+
+type extensiblePriorityWriteScheduler struct {
+	// zero are frames not associated with an open stream.
+	zero writeQueue
+
+	// streams holds the open streams, keyed by stream ID.
+	streams map[uint32]*extensiblePriorityStream
+
+	// ready holds, for each urgency, the streams with queued frames
+	// in the order they are written: non-incremental streams by
+	// stream ID, then incremental streams in turn.
+	ready [8][]*extensiblePriorityStream
+}
+
+type extensiblePriorityStream struct {
+	id       uint32
+	priority StreamPriority
+	q        writeQueue
+	ready    bool // in ws.ready[priority.Urgency]
+}
+
+func (ws *extensiblePriorityWriteScheduler) OpenStream(streamID uint32, options OpenStreamOptions) {
+	if _, ok := ws.streams[streamID]; ok {
+		panic("stream already open")
+	}
+	ws.streams[streamID] = &extensiblePriorityStream{
+		id:       streamID,
+		priority: DefaultStreamPriority,
+	}
+}
+
+func (ws *extensiblePriorityWriteScheduler) CloseStream(streamID uint32) {
+	st, ok := ws.streams[streamID]
+	if !ok {
+		return
+	}
+	if st.ready {
+		ws.removeReady(st)
+	}
+	delete(ws.streams, streamID)
+}
+
+func (ws *extensiblePriorityWriteScheduler) AdjustStream(streamID uint32, priority PriorityParam) {
+	// no-op: RFC 7540 priorities are ignored
+}
+
+func (ws *extensiblePriorityWriteScheduler) AdjustStreamPriority(streamID uint32, priority StreamPriority) {
+	st, ok := ws.streams[streamID]
+	if !ok {
+		return
+	}
+	if priority.Urgency > 7 {
+		priority.Urgency = 7
+	}
+	if !st.ready {
+		st.priority = priority
+		return
+	}
+	ws.removeReady(st)
+	st.priority = priority
+	ws.addReady(st)
+}
+
+func (ws *extensiblePriorityWriteScheduler) Push(wr FrameWriteRequest) {
+	if wr.isControl() {
+		ws.zero.push(wr)
+		return
+	}
+	st, ok := ws.streams[wr.StreamID()]
+	if !ok {
+		// The stream is idle or closed, so wr is not a HEADERS or
+		// DATA frame.
+		ws.zero.push(wr)
+		return
+	}
+	st.q.push(wr)
+	if !st.ready {
+		ws.addReady(st)
+	}
+}
+
+func (ws *extensiblePriorityWriteScheduler) Pop() (FrameWriteRequest, bool) {
+	// Control and RST_STREAM frames first.
+	if !ws.zero.empty() {
+		return ws.zero.shift(), true
+	}
+	for _, ready := range ws.ready {
+		for _, st := range ready {
+			wr, ok := st.q.consume(math.MaxInt32)
+			if !ok {
+				// Blocked by flow control.
+				continue
+			}
+			if st.q.empty() {
+				ws.removeReady(st)
+			} else if st.priority.Incremental {
+				// Let the next incremental stream have a turn.
+				ws.removeReady(st)
+				ws.addReady(st)
+			}
+			return wr, true
+		}
+	}
+	return FrameWriteRequest{}, false
+}
+
+// addReady adds st to the streams with queued frames of its urgency.
+func (ws *extensiblePriorityWriteScheduler) addReady(st *extensiblePriorityStream) {
+	ready := ws.ready[st.priority.Urgency]
+	i := len(ready)
+	if !st.priority.Incremental {
+		i = 0
+		for i < len(ready) && !ready[i].priority.Incremental && ready[i].id < st.id {
+			i++
+		}
+	}
+	ready = append(ready, nil)
+	copy(ready[i+1:], ready[i:])
+	ready[i] = st
+	ws.ready[st.priority.Urgency] = ready
+	st.ready = true
+}
+
+// removeReady removes st from the streams with queued frames.
+func (ws *extensiblePriorityWriteScheduler) removeReady(st *extensiblePriorityStream) {
+	ready := ws.ready[st.priority.Urgency]
+	for i, s := range ready {
+		if s == st {
+			copy(ready[i:], ready[i+1:])
+			ready[len(ready)-1] = nil
+			ws.ready[st.priority.Urgency] = ready[:len(ready)-1]
+			break
+		}
+	}
+	st.ready = false
+}
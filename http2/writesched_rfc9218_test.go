@@ -0,0 +1,79 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func popAllStreamIDs(ws WriteScheduler) []uint32 {
+	var ids []uint32
+	for {
+		wr, ok := ws.Pop()
+		if !ok {
+			return ids
+		}
+		ids = append(ids, wr.StreamID())
+	}
+}
+
+func TestExtensiblePriorityScheduler(t *testing.T) {
+	ws := NewExtensiblePriorityWriteScheduler()
+	for _, id := range []uint32{1, 3, 5, 7, 9} {
+		ws.OpenStream(id, OpenStreamOptions{})
+	}
+	ws.AdjustStreamPriority(3, StreamPriority{Urgency: 1})
+	ws.AdjustStreamPriority(5, StreamPriority{Urgency: 3, Incremental: true})
+	ws.AdjustStreamPriority(7, StreamPriority{Urgency: 3, Incremental: true})
+	ws.AdjustStreamPriority(9, StreamPriority{Urgency: 6})
+	for _, id := range []uint32{9, 7, 5, 3, 1} {
+		ws.Push(makeWriteHeadersRequest(id))
+		ws.Push(makeWriteHeadersRequest(id))
+	}
+	ws.Push(makeWriteNonStreamRequest())
+
+	// Control frames first, then by urgency; within urgency 3, the
+	// non-incremental stream 1 before the incremental streams 5 and 7,
+	// which take turns.
+	want := []uint32{0, 3, 3, 1, 1, 7, 5, 7, 5, 9, 9}
+	if got := popAllStreamIDs(ws); !reflect.DeepEqual(got, want) {
+		t.Errorf("got stream order %v, want %v", got, want)
+	}
+}
+
+func TestExtensiblePrioritySchedulerNonIncrementalOrder(t *testing.T) {
+	ws := NewExtensiblePriorityWriteScheduler()
+	for _, id := range []uint32{1, 3, 5} {
+		ws.OpenStream(id, OpenStreamOptions{})
+	}
+	ws.AdjustStreamPriority(1, StreamPriority{Urgency: 3, Incremental: true})
+	for _, id := range []uint32{5, 1, 3} {
+		ws.Push(makeWriteHeadersRequest(id))
+		ws.Push(makeWriteHeadersRequest(id))
+	}
+	want := []uint32{3, 3, 5, 5, 1, 1}
+	if got := popAllStreamIDs(ws); !reflect.DeepEqual(got, want) {
+		t.Errorf("got stream order %v, want %v", got, want)
+	}
+}
+
+func TestExtensiblePrioritySchedulerAdjust(t *testing.T) {
+	ws := NewExtensiblePriorityWriteScheduler()
+	for _, id := range []uint32{1, 3, 5} {
+		ws.OpenStream(id, OpenStreamOptions{})
+		ws.Push(makeWriteHeadersRequest(id))
+	}
+	// Adjusting a stream with queued frames reorders it.
+	ws.AdjustStreamPriority(5, StreamPriority{Urgency: 0})
+	// Closing a stream discards its frames.
+	ws.CloseStream(1)
+	// Adjusting a stream that is not open does nothing.
+	ws.AdjustStreamPriority(7, StreamPriority{Urgency: 0})
+	want := []uint32{5, 3}
+	if got := popAllStreamIDs(ws); !reflect.DeepEqual(got, want) {
+		t.Errorf("got stream order %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultConnectUDPTemplate is the URI template path used by
+// ConnectUDPDialer when its Template field is empty. It is the
+// well-known location defined in RFC 9298, Section 3.
+const DefaultConnectUDPTemplate = "/.well-known/masque/udp/{target_host}/{target_port}/"
+
+// A ConnectUDPDialer proxies UDP traffic through an HTTP/1.1 proxy
+// using the connect-udp upgrade defined in RFC 9298. Each tunnel
+// carries datagrams between the caller and a single target address,
+// framed as HTTP Datagram capsules (RFC 9297).
+type ConnectUDPDialer struct {
+	// ProxyAddress is the host:port address of the proxy.
+	ProxyAddress string
+
+	// Template is the path of the URI template used to build the
+	// request, containing the {target_host} and {target_port}
+	// variables. If empty, DefaultConnectUDPTemplate is used.
+	Template string
+
+	// Auth, if non-nil, is sent to the proxy as Basic credentials in
+	// the Proxy-Authorization header.
+	Auth *Auth
+
+	// Forward is used to connect to the proxy. If nil, Direct is
+	// used. To reach a proxy over TLS, use a Forward dialer that
+	// returns TLS connections.
+	Forward Dialer
+}
+
+// ConnectUDP returns a ConnectUDPDialer that tunnels UDP through the
+// HTTP proxy at address, with optional credentials, connecting to
+// the proxy using forward.
+func ConnectUDP(address string, auth *Auth, forward Dialer) *ConnectUDPDialer {
+	return &ConnectUDPDialer{
+		ProxyAddress: address,
+		Auth:         auth,
+		Forward:      forward,
+	}
+}
+
+var (
+	noDeadline   = time.Time{}
+	aLongTimeAgo = time.Unix(1, 0)
+)
+
+// DialPacket asks the proxy to open a UDP tunnel to address, which
+// must be of the form host:port, and returns a net.PacketConn that
+// sends and receives datagrams through the tunnel.
+//
+// The network must be "udp", "udp4" or "udp6"; the proxy alone
+// decides which address family is used to reach the target.
+//
+// The context is only used while establishing the tunnel, not for
+// the lifetime of the returned PacketConn.
+func (d *ConnectUDPDialer) DialPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+	default:
+		return nil, &net.OpError{Op: "connect-udp", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, &net.OpError{Op: "connect-udp", Net: network, Err: err}
+	}
+	target := hostPortAddr{network: network, addr: address}
+	forward := d.Forward
+	if forward == nil {
+		forward = Direct
+	}
+	var c net.Conn
+	if f, ok := forward.(ContextDialer); ok {
+		c, err = f.DialContext(ctx, "tcp", d.ProxyAddress)
+	} else {
+		c, err = dialContext(ctx, forward, "tcp", d.ProxyAddress)
+	}
+	if err != nil {
+		return nil, &net.OpError{Op: "connect-udp", Net: network, Addr: target, Err: err}
+	}
+	br, err := d.connect(ctx, c, host, port)
+	if err != nil {
+		c.Close()
+		return nil, &net.OpError{Op: "connect-udp", Net: network, Addr: target, Err: err}
+	}
+	return &connectUDPConn{conn: c, br: br, target: target}, nil
+}
+
+// connect performs the connect-udp upgrade on c, which is connected
+// to the proxy. It returns a reader holding any capsule data that
+// arrived along with the response.
+func (d *ConnectUDPDialer) connect(ctx context.Context, c net.Conn, host, port string) (_ *bufio.Reader, ctxErr error) {
+	if deadline, ok := ctx.Deadline(); ok && !deadline.IsZero() {
+		c.SetDeadline(deadline)
+		defer c.SetDeadline(noDeadline)
+	}
+	if ctx != context.Background() {
+		errCh := make(chan error, 1)
+		done := make(chan struct{})
+		defer func() {
+			close(done)
+			if ctxErr == nil {
+				ctxErr = <-errCh
+			}
+		}()
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.SetDeadline(aLongTimeAgo)
+				errCh <- ctx.Err()
+			case <-done:
+				errCh <- nil
+			}
+		}()
+	}
+
+	template := d.Template
+	if template == "" {
+		template = DefaultConnectUDPTemplate
+	}
+	path := strings.NewReplacer(
+		"{target_host}", escapeTemplateValue(host),
+		"{target_port}", escapeTemplateValue(port),
+	).Replace(template)
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connect-udp template: %v", err)
+	}
+	u.Scheme = "http"
+	u.Host = d.ProxyAddress
+	req := &http.Request{
+		Method:     "GET",
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Connection":       {"Upgrade"},
+			"Upgrade":          {"connect-udp"},
+			"Capsule-Protocol": {"?1"},
+		},
+		Host: d.ProxyAddress,
+	}
+	if d.Auth != nil {
+		cred := base64.StdEncoding.EncodeToString([]byte(d.Auth.User + ":" + d.Auth.Password))
+		req.Header.Set("Proxy-Authorization", "Basic "+cred)
+	}
+	if ctxErr = req.Write(c); ctxErr != nil {
+		return nil, ctxErr
+	}
+	br := bufio.NewReader(c)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("proxy refused connect-udp: %s", res.Status)
+	}
+	if !strings.EqualFold(res.Header.Get("Upgrade"), "connect-udp") {
+		return nil, fmt.Errorf("proxy upgraded to unexpected protocol %q", res.Header.Get("Upgrade"))
+	}
+	return br, nil
+}
+
+// escapeTemplateValue percent-encodes s as a simple string expansion
+// of an RFC 6570 URI template, leaving only unreserved characters.
+// IPv6 literals thus have their colons encoded, as RFC 9298 requires.
+func escapeTemplateValue(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// A hostPortAddr is the unresolved address of a connect-udp target.
+type hostPortAddr struct {
+	network string
+	addr    string
+}
+
+func (a hostPortAddr) Network() string { return a.network }
+func (a hostPortAddr) String() string  { return a.addr }
+
+const (
+	capsuleTypeDatagram = 0x00
+
+	// maxDatagramCapsule bounds the length of a DATAGRAM capsule:
+	// a context ID followed by the largest possible UDP payload.
+	maxDatagramCapsule = 8 + 65535
+)
+
+var (
+	errConnectUDPWrongAddr = errors.New("connect-udp tunnel is bound to a single target address")
+	errCapsuleTooLarge     = errors.New("connect-udp DATAGRAM capsule too large")
+)
+
+// A connectUDPConn is a net.PacketConn carrying datagrams over an
+// established connect-udp tunnel.
+type connectUDPConn struct {
+	conn   net.Conn
+	target hostPortAddr
+
+	rmu  sync.Mutex // guards br and rbuf
+	br   *bufio.Reader
+	rbuf []byte
+
+	wmu  sync.Mutex // guards wbuf
+	wbuf []byte
+}
+
+// ReadFrom reads the next UDP payload sent by the target. As with a
+// UDP socket, a payload larger than p is truncated. Capsules other
+// than DATAGRAM, and datagrams with a nonzero context ID, are
+// silently skipped.
+func (c *connectUDPConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	for {
+		typ, err := readVarint(c.br)
+		if err != nil {
+			return 0, nil, err
+		}
+		length, err := readVarint(c.br)
+		if err != nil {
+			return 0, nil, noEOF(err)
+		}
+		if typ != capsuleTypeDatagram {
+			if _, err := io.CopyN(io.Discard, c.br, int64(length)); err != nil {
+				return 0, nil, noEOF(err)
+			}
+			continue
+		}
+		if length > maxDatagramCapsule {
+			return 0, nil, errCapsuleTooLarge
+		}
+		if cap(c.rbuf) < int(length) {
+			c.rbuf = make([]byte, length)
+		}
+		payload := c.rbuf[:length]
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return 0, nil, noEOF(err)
+		}
+		contextID, n := parseVarint(payload)
+		if n <= 0 || contextID != 0 {
+			continue
+		}
+		return copy(p, payload[n:]), c.target, nil
+	}
+}
+
+// WriteTo sends p to the target in a DATAGRAM capsule. addr must be
+// nil or name the tunnel's target.
+func (c *connectUDPConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if addr != nil && addr.String() != c.target.addr {
+		return 0, &net.OpError{Op: "write", Net: c.target.network, Addr: addr, Err: errConnectUDPWrongAddr}
+	}
+	if len(p) > maxDatagramCapsule-1 {
+		return 0, errCapsuleTooLarge
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	b := c.wbuf[:0]
+	b = appendVarint(b, capsuleTypeDatagram)
+	b = appendVarint(b, uint64(1+len(p)))
+	b = appendVarint(b, 0) // context ID
+	b = append(b, p...)
+	c.wbuf = b
+	if _, err := c.conn.Write(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *connectUDPConn) Close() error                       { return c.conn.Close() }
+func (c *connectUDPConn) LocalAddr() net.Addr                { return c.conn.LocalAddr() }
+func (c *connectUDPConn) SetDeadline(t time.Time) error      { return c.conn.SetDeadline(t) }
+func (c *connectUDPConn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *connectUDPConn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// appendVarint appends v to b as a QUIC variable-length integer
+// (RFC 9000, Section 16).
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, 0x40|byte(v>>8), byte(v))
+	case v < 1<<30:
+		return append(b, 0x80|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		return append(b, 0xc0|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+			byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
+
+// parseVarint parses a QUIC variable-length integer from the start
+// of b, returning its value and length. The length is zero if b is
+// too short.
+func parseVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, 0
+	}
+	v := uint64(b[0] & 0x3f)
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n
+}
+
+// readVarint reads a QUIC variable-length integer from r.
+func readVarint(r *bufio.Reader) (uint64, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	v := uint64(first & 0x3f)
+	for n := 1 << (first >> 6); n > 1; n-- {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, noEOF(err)
+		}
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// connectUDPServer is a minimal connect-udp proxy which, instead of
+// forwarding datagrams to the target, echoes them back to the client.
+type connectUDPServer struct {
+	ln    net.Listener
+	reqCh chan *http.Request
+	// status is the response status; zero means 101.
+	status int
+}
+
+func newConnectUDPServer(t *testing.T, status int) *connectUDPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &connectUDPServer{ln: ln, reqCh: make(chan *http.Request, 1), status: status}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *connectUDPServer) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+func (s *connectUDPServer) handle(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return
+	}
+	s.reqCh <- req
+	if s.status != 0 {
+		fmt.Fprintf(c, "HTTP/1.1 %d %s\r\nContent-Length: 0\r\n\r\n", s.status, http.StatusText(s.status))
+		return
+	}
+	// Send an unknown capsule along with the response, which the
+	// client must skip.
+	resp := []byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: connect-udp\r\nCapsule-Protocol: ?1\r\n\r\n")
+	resp = appendVarint(resp, 0x2a)
+	resp = appendVarint(resp, 3)
+	resp = append(resp, "xyz"...)
+	if _, err := c.Write(resp); err != nil {
+		return
+	}
+	for {
+		typ, err := readVarint(br)
+		if err != nil {
+			return
+		}
+		length, err := readVarint(br)
+		if err != nil {
+			return
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return
+		}
+		var b []byte
+		b = appendVarint(b, typ)
+		b = appendVarint(b, length)
+		b = append(b, payload...)
+		if _, err := c.Write(b); err != nil {
+			return
+		}
+	}
+}
+
+func TestConnectUDP(t *testing.T) {
+	s := newConnectUDPServer(t, 0)
+	d := ConnectUDP(s.ln.Addr().String(), &Auth{User: "user", Password: "pass"}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pc, err := d.DialPacket(ctx, "udp", "[2001:db8::1]:443")
+	if err != nil {
+		t.Fatalf("DialPacket: %v", err)
+	}
+	defer pc.Close()
+
+	req := <-s.reqCh
+	if got, want := req.URL.Path, "/.well-known/masque/udp/2001:db8::1/443/"; got != want {
+		t.Errorf("request path = %q, want %q", got, want)
+	}
+	if got, want := req.URL.RawPath, "/.well-known/masque/udp/2001%3Adb8%3A%3A1/443/"; got != want {
+		t.Errorf("request raw path = %q, want %q", got, want)
+	}
+	for k, want := range map[string]string{
+		"Connection":          "Upgrade",
+		"Upgrade":             "connect-udp",
+		"Capsule-Protocol":    "?1",
+		"Proxy-Authorization": "Basic dXNlcjpwYXNz",
+	} {
+		if got := req.Header.Get(k); got != want {
+			t.Errorf("request header %s = %q, want %q", k, got, want)
+		}
+	}
+
+	pc.SetDeadline(time.Now().Add(5 * time.Second))
+	for _, msg := range []string{"hello", "", strings.Repeat("x", 1000)} {
+		if _, err := pc.WriteTo([]byte(msg), nil); err != nil {
+			t.Fatalf("WriteTo: %v", err)
+		}
+		buf := make([]byte, 2048)
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("ReadFrom: %v", err)
+		}
+		if got := string(buf[:n]); got != msg {
+			t.Errorf("ReadFrom = %q, want %q", got, msg)
+		}
+		if got, want := addr.String(), "[2001:db8::1]:443"; got != want {
+			t.Errorf("ReadFrom address = %v, want %v", got, want)
+		}
+	}
+
+	// Short buffers truncate the datagram, as with UDP sockets.
+	if _, err := pc.WriteTo([]byte("truncated"), nil); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	buf := make([]byte, 5)
+	if n, _, err := pc.ReadFrom(buf); err != nil || string(buf[:n]) != "trunc" {
+		t.Errorf("ReadFrom = %q, %v; want %q, nil", buf[:n], err, "trunc")
+	}
+
+	other := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53}
+	if _, err := pc.WriteTo([]byte("x"), other); err == nil {
+		t.Errorf("WriteTo to a different address succeeded, want error")
+	}
+}
+
+func TestConnectUDPRefused(t *testing.T) {
+	s := newConnectUDPServer(t, http.StatusProxyAuthRequired)
+	d := ConnectUDP(s.ln.Addr().String(), nil, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := d.DialPacket(ctx, "udp", "example.com:53"); err == nil {
+		t.Fatalf("DialPacket succeeded, want error")
+	}
+	if _, err := d.DialPacket(ctx, "tcp", "example.com:53"); err == nil {
+		t.Fatalf("DialPacket with tcp network succeeded, want error")
+	}
+}
+
+func TestVarint(t *testing.T) {
+	for _, v := range []uint64{0, 37, 63, 64, 15293, 16383, 16384, 494878333, 1<<30 - 1, 1 << 30, 151288809941952652} {
+		b := appendVarint(nil, v)
+		got, n := parseVarint(b)
+		if got != v || n != len(b) {
+			t.Errorf("parseVarint(appendVarint(%d)) = %d, %d; want %d, %d", v, got, n, v, len(b))
+		}
+		got, err := readVarint(bufio.NewReader(bytes.NewReader(b)))
+		if err != nil || got != v {
+			t.Errorf("readVarint(appendVarint(%d)) = %d, %v", v, got, err)
+		}
+	}
+}
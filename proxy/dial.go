@@ -14,6 +14,29 @@ type ContextDialer interface {
 	DialContext(ctx context.Context, network, address string) (net.Conn, error)
 }
 
+// The ContextDialerFunc type is an adapter to allow the use of ordinary
+// functions as dialers. If f is a function with the appropriate signature,
+// ContextDialerFunc(f) is a ContextDialer that calls f.
+//
+// A ContextDialerFunc also implements Dialer, so it can be used as the
+// forward dialer of a proxy.
+type ContextDialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+var (
+	_ Dialer        = ContextDialerFunc(nil)
+	_ ContextDialer = ContextDialerFunc(nil)
+)
+
+// DialContext calls f(ctx, network, address).
+func (f ContextDialerFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
+// Dial calls f with a background context.
+func (f ContextDialerFunc) Dial(network, address string) (net.Conn, error) {
+	return f(context.Background(), network, address)
+}
+
 // Dial works like DialContext on net.Dialer but using a dialer returned by FromEnvironment.
 //
 // The passed ctx is only used for returning the Conn, not the lifetime of the Conn.
@@ -7,6 +7,7 @@ package proxy
 import (
 	"context"
 	"net"
+	"strings"
 )
 
 type direct struct{}
@@ -29,3 +30,54 @@ func (direct) DialContext(ctx context.Context, network, addr string) (net.Conn,
 	var d net.Dialer
 	return d.DialContext(ctx, network, addr)
 }
+
+// A DirectDialer makes network connections directly, as Direct does,
+// from a chosen local address. Used as the forward dialer of a proxy,
+// it controls where the connections to the proxy originate, for
+// example on multi-homed hosts whose routing or accounting depends on
+// the source address.
+type DirectDialer struct {
+	// LocalIP is the local IP address that connections are bound to
+	// before connecting. The local port is chosen by the system. If
+	// nil, the system chooses the local address, as with Direct. It
+	// is not used for Unix domain sockets.
+	LocalIP net.IP
+}
+
+var (
+	_ Dialer        = (*DirectDialer)(nil)
+	_ ContextDialer = (*DirectDialer)(nil)
+)
+
+// Dial connects to the address addr on the given network from d's
+// local address.
+func (d *DirectDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the address addr on the given network from
+// d's local address, using a net.Dialer.
+func (d *DirectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	nd := net.Dialer{LocalAddr: d.localAddr(network)}
+	return nd.DialContext(ctx, network, addr)
+}
+
+// localAddr returns LocalIP as an address of the given network, or nil
+// if there is none.
+func (d *DirectDialer) localAddr(network string) net.Addr {
+	if d.LocalIP == nil {
+		return nil
+	}
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return &net.TCPAddr{IP: d.LocalIP}
+	case "udp", "udp4", "udp6":
+		return &net.UDPAddr{IP: d.LocalIP}
+	}
+	if strings.HasPrefix(network, "ip") {
+		// "ip", "ip4" or "ip6", possibly followed by ":" and a
+		// protocol.
+		return &net.IPAddr{IP: d.LocalIP}
+	}
+	return nil
+}
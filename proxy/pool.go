@@ -0,0 +1,260 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// A PoolDialer keeps idle connections made through its Forward dialer,
+// typically a proxy, for reuse by later dials to the same address.
+// Connections are returned to the pool with Put, and are checked to be
+// alive before they are reused, so that tunnels broken while idle, for
+// example by a proxy that went away, are replaced by fresh dials
+// instead of failing on first use.
+//
+// A PoolDialer must not be copied after first use.
+type PoolDialer struct {
+	// Forward is the dialer through which connections are made. If
+	// nil, Direct is used.
+	Forward Dialer
+
+	// IdleTimeout is how long a connection may stay idle in the pool
+	// before it is closed. If zero, 90 seconds is used.
+	IdleTimeout time.Duration
+
+	// MaxIdle is the maximum number of idle connections kept, across
+	// all addresses. If zero, 10 is used. If negative, connections
+	// are never kept.
+	MaxIdle int
+
+	// Alive reports whether an idle connection can be reused. It is
+	// called before a connection is taken from the pool, and must not
+	// consume data from it. If nil, a connection is alive if reading
+	// from it briefly blocks: a connection that reached EOF, failed,
+	// or has unexpected data to read is not reused.
+	Alive func(net.Conn) bool
+
+	mu     sync.Mutex
+	idle   map[poolKey][]*poolConn // most recently used last
+	nidle  int
+	closed bool
+}
+
+var (
+	_ Dialer        = (*PoolDialer)(nil)
+	_ ContextDialer = (*PoolDialer)(nil)
+)
+
+type poolKey struct {
+	network, addr string
+}
+
+// A poolConn is a connection made by a PoolDialer.
+type poolConn struct {
+	net.Conn
+	d   *PoolDialer // the dialer that made the connection
+	key poolKey
+
+	// Guarded by the PoolDialer's mu.
+	idleTimer *time.Timer // non-nil while idle in the pool
+}
+
+// aliveCheckTimeout is how long the default liveness check waits for
+// an idle connection to become readable.
+const aliveCheckTimeout = time.Millisecond
+
+// Dial connects to the address addr on the given network, reusing an
+// idle connection if possible.
+func (d *PoolDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the address addr on the given network,
+// reusing the most recently used idle connection to it that is still
+// alive. Idle connections found dead are closed. If there is none,
+// a new connection is dialed through the Forward dialer.
+//
+// The returned connection should be given back with Put once it is no
+// longer in use and holds no unread data, or closed otherwise.
+func (d *PoolDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	key := poolKey{network, addr}
+	for {
+		pc := d.take(key)
+		if pc == nil {
+			break
+		}
+		if d.alive(pc.Conn) {
+			return pc, nil
+		}
+		pc.Conn.Close()
+	}
+	forward := d.Forward
+	if forward == nil {
+		forward = Direct
+	}
+	var (
+		c   net.Conn
+		err error
+	)
+	if x, ok := forward.(ContextDialer); ok {
+		c, err = x.DialContext(ctx, network, addr)
+	} else {
+		c, err = dialContext(ctx, forward, network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &poolConn{Conn: c, d: d, key: key}, nil
+}
+
+// Put returns c, a connection returned by DialContext or Dial, to the
+// pool, to be reused by a later dial to the same address. If the pool
+// is full or closed, or c was not made by d, c is closed instead.
+func (d *PoolDialer) Put(c net.Conn) {
+	pc, ok := c.(*poolConn)
+	if !ok || pc.d != d {
+		c.Close()
+		return
+	}
+	d.mu.Lock()
+	if pc.idleTimer != nil {
+		// Already in the pool.
+		d.mu.Unlock()
+		return
+	}
+	if d.closed || d.nidle >= d.maxIdle() {
+		d.mu.Unlock()
+		c.Close()
+		return
+	}
+	if d.idle == nil {
+		d.idle = make(map[poolKey][]*poolConn)
+	}
+	d.idle[pc.key] = append(d.idle[pc.key], pc)
+	d.nidle++
+	pc.idleTimer = time.AfterFunc(d.idleTimeout(), func() { d.expire(pc) })
+	d.mu.Unlock()
+}
+
+// CloseIdleConnections closes the idle connections in the pool.
+// Connections in use are not affected.
+func (d *PoolDialer) CloseIdleConnections() {
+	d.mu.Lock()
+	idle := d.idle
+	d.idle = nil
+	d.nidle = 0
+	for _, conns := range idle {
+		for _, pc := range conns {
+			pc.idleTimer.Stop()
+			pc.idleTimer = nil
+		}
+	}
+	d.mu.Unlock()
+	for _, conns := range idle {
+		for _, pc := range conns {
+			pc.Conn.Close()
+		}
+	}
+}
+
+// Close closes the idle connections in the pool, and the connections
+// given to Put from then on. Dials are still made after Close, but
+// their connections are no longer kept.
+func (d *PoolDialer) Close() error {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	d.CloseIdleConnections()
+	return nil
+}
+
+// take removes the most recently used idle connection for key from the
+// pool and returns it, or returns nil if there is none.
+func (d *PoolDialer) take(key poolKey) *poolConn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	conns := d.idle[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	pc := conns[len(conns)-1]
+	d.remove(pc)
+	return pc
+}
+
+// expire closes pc if it is still idle in the pool.
+func (d *PoolDialer) expire(pc *poolConn) {
+	d.mu.Lock()
+	idle := pc.idleTimer != nil
+	if idle {
+		d.remove(pc)
+	}
+	d.mu.Unlock()
+	if idle {
+		pc.Conn.Close()
+	}
+}
+
+// remove removes pc from the pool. d.mu must be held.
+func (d *PoolDialer) remove(pc *poolConn) {
+	conns := d.idle[pc.key]
+	for i, c := range conns {
+		if c == pc {
+			conns = append(conns[:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(conns) == 0 {
+		delete(d.idle, pc.key)
+	} else {
+		d.idle[pc.key] = conns
+	}
+	d.nidle--
+	pc.idleTimer.Stop()
+	pc.idleTimer = nil
+}
+
+func (d *PoolDialer) alive(c net.Conn) bool {
+	if d.Alive != nil {
+		return d.Alive(c)
+	}
+	return isIdleConnAlive(c)
+}
+
+// isIdleConnAlive reports whether reading from c blocks for
+// aliveCheckTimeout, as it does on a healthy idle connection.
+func isIdleConnAlive(c net.Conn) bool {
+	if err := c.SetReadDeadline(time.Now().Add(aliveCheckTimeout)); err != nil {
+		return false
+	}
+	var b [1]byte
+	_, err := c.Read(b[:])
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		// Data was read, so the connection is out of sync, or it
+		// reached EOF or failed.
+		return false
+	}
+	return c.SetReadDeadline(time.Time{}) == nil
+}
+
+func (d *PoolDialer) idleTimeout() time.Duration {
+	if d.IdleTimeout == 0 {
+		return 90 * time.Second
+	}
+	return d.IdleTimeout
+}
+
+func (d *PoolDialer) maxIdle() int {
+	if d.MaxIdle == 0 {
+		return 10
+	}
+	return d.MaxIdle
+}
@@ -0,0 +1,185 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipeDialer dials pipes, keeping the far end of each.
+type pipeDialer struct {
+	peers []net.Conn
+}
+
+func (d *pipeDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	c1, c2 := net.Pipe()
+	d.peers = append(d.peers, c2)
+	return c1, nil
+}
+
+func (d *pipeDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *pipeDialer) close() {
+	for _, c := range d.peers {
+		c.Close()
+	}
+}
+
+func TestPoolDialerReuse(t *testing.T) {
+	pd := &pipeDialer{}
+	defer pd.close()
+	d := &PoolDialer{Forward: pd}
+	defer d.Close()
+
+	c1, err := d.Dial("tcp", "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Put(c1)
+	c2, err := d.DialContext(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2 != c1 || len(pd.peers) != 1 {
+		t.Fatalf("idle connection not reused: dialed %d times", len(pd.peers))
+	}
+	// The liveness check leaves the connection usable.
+	go pd.peers[0].Write([]byte("x"))
+	var b [1]byte
+	if _, err := c2.Read(b[:]); err != nil || b[0] != 'x' {
+		t.Fatalf("Read on reused connection = %q, %v", b[:], err)
+	}
+	d.Put(c2)
+
+	// Connections are kept per address.
+	c3, err := d.Dial("tcp", "example.org:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3 == c1 || len(pd.peers) != 2 {
+		t.Fatalf("connection to another address reused: dialed %d times", len(pd.peers))
+	}
+	c3.Close()
+}
+
+func TestPoolDialerDiscardsDeadConns(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		kill func(peer net.Conn)
+	}{
+		{"closed", func(peer net.Conn) { peer.Close() }},
+		{"unexpected data", func(peer net.Conn) { peer.Write([]byte("garbage")) }},
+	} {
+		// Loopback TCP connections, unlike pipes, buffer the data
+		// written by the peer before it is read.
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dials := 0
+		d := &PoolDialer{Forward: ContextDialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials++
+			return Direct.DialContext(ctx, network, addr)
+		})}
+		c1, err := d.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Put(c1)
+		tt.kill(peer)
+		time.Sleep(10 * time.Millisecond) // let the kill reach c1
+		c2, err := d.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c2 == c1 || dials != 2 {
+			t.Errorf("%s: dead connection reused: dialed %d times", tt.name, dials)
+		}
+		if _, err := c1.Write([]byte("x")); err == nil {
+			t.Errorf("%s: dead connection not closed", tt.name)
+		}
+		c2.Close()
+		peer.Close()
+		ln.Close()
+	}
+}
+
+func TestPoolDialerIdleTimeout(t *testing.T) {
+	pd := &pipeDialer{}
+	defer pd.close()
+	d := &PoolDialer{Forward: pd, IdleTimeout: 10 * time.Millisecond}
+	defer d.Close()
+	c1, err := d.Dial("tcp", "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Put(c1)
+	time.Sleep(50 * time.Millisecond)
+	c2, err := d.Dial("tcp", "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2 == c1 || len(pd.peers) != 2 {
+		t.Fatalf("expired connection reused: dialed %d times", len(pd.peers))
+	}
+	if _, err := c1.Write([]byte("x")); err == nil {
+		t.Errorf("expired connection not closed")
+	}
+}
+
+func TestPoolDialerMaxIdle(t *testing.T) {
+	pd := &pipeDialer{}
+	defer pd.close()
+	d := &PoolDialer{Forward: pd, MaxIdle: 1}
+	c1, _ := d.Dial("tcp", "example.com:80")
+	c2, _ := d.Dial("tcp", "example.com:80")
+	d.Put(c1)
+	d.Put(c2)
+	if _, err := c2.Write([]byte("x")); err == nil {
+		t.Errorf("connection beyond MaxIdle not closed")
+	}
+	d.Close()
+	if _, err := c1.Write([]byte("x")); err == nil {
+		t.Errorf("idle connection not closed by Close")
+	}
+	c3, _ := d.Dial("tcp", "example.com:80")
+	d.Put(c3)
+	if _, err := c3.Write([]byte("x")); err == nil {
+		t.Errorf("connection put after Close not closed")
+	}
+}
+
+func TestPoolDialerPutForeignConn(t *testing.T) {
+	pd := &pipeDialer{}
+	defer pd.close()
+	d1 := &PoolDialer{Forward: pd}
+	defer d1.Close()
+	d2 := &PoolDialer{Forward: pd}
+	defer d2.Close()
+
+	c, err := d1.Dial("tcp", "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2.Put(c)
+	d2.mu.Lock()
+	nidle := d2.nidle
+	d2.mu.Unlock()
+	if nidle != 0 {
+		t.Fatalf("connection made by another PoolDialer kept in the pool")
+	}
+	if _, err := c.Write([]byte("x")); err == nil {
+		t.Errorf("connection made by another PoolDialer not closed by Put")
+	}
+}
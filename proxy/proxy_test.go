@@ -9,6 +9,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/url"
 	"os"
@@ -113,6 +114,138 @@ func TestSOCKS5(t *testing.T) {
 	c.Close()
 }
 
+// testLocalIP returns a loopback address other than the default
+// source address 127.0.0.1 if one can be bound to, as on Linux, so
+// that binding to it is observable, or else 127.0.0.1.
+func testLocalIP() net.IP {
+	ip := net.IPv4(127, 0, 0, 2)
+	if ln, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0")); err == nil {
+		ln.Close()
+		return ip
+	}
+	return net.IPv4(127, 0, 0, 1)
+}
+
+func TestDirectDialerLocalIP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ip := testLocalIP()
+	d := &DirectDialer{LocalIP: ip}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	peer, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	if got := peer.RemoteAddr().(*net.TCPAddr).IP; !got.Equal(ip) {
+		t.Errorf("connection originates from %v, want %v", got, ip)
+	}
+}
+
+func TestSOCKS5WithDirectDialer(t *testing.T) {
+	ss, err := sockstest.NewServer(sockstest.NoAuthRequired, sockstest.NoProxyRequired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	ip := testLocalIP()
+	proxy, err := SOCKS5("tcp", ss.Addr().String(), nil, &DirectDialer{LocalIP: ip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := proxy.Dial("tcp", ss.TargetAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// The connection to the proxy is bound to ip.
+	if got := c.LocalAddr().(*net.TCPAddr).IP; !got.Equal(ip) {
+		t.Errorf("connection to the proxy originates from %v, want %v", got, ip)
+	}
+}
+
+func TestSOCKS5BoundAddr(t *testing.T) {
+	bound := &socks.Addr{IP: net.ParseIP("192.0.2.7"), Port: 2121}
+	ss, err := sockstest.NewServer(sockstest.NoAuthRequired, func(rw io.ReadWriter, b []byte) error {
+		if _, err := sockstest.ParseCmdRequest(b); err != nil {
+			return err
+		}
+		b, err := sockstest.MarshalCmdReply(socks.Version5, socks.StatusSucceeded, bound)
+		if err != nil {
+			return err
+		}
+		_, err = rw.Write(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	proxy, err := SOCKS5("tcp", ss.Addr().String(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := proxy.(ContextDialer).DialContext(context.Background(), "tcp", ss.TargetAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	a, ok := BoundAddr(c)
+	if !ok {
+		t.Fatalf("BoundAddr() = %v, false; want %v, true", a, bound)
+	}
+	if a.String() != bound.String() {
+		t.Errorf("BoundAddr() = %v, want %v", a, bound)
+	}
+
+	raw, err := proxy.Dial("tcp", ss.TargetAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if a, ok := BoundAddr(raw); ok {
+		t.Errorf("BoundAddr() of raw connection = %v, true; want false", a)
+	}
+}
+
+func TestSOCKS5WithContextDialerFunc(t *testing.T) {
+	ss, err := sockstest.NewServer(sockstest.NoAuthRequired, sockstest.NoProxyRequired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	type key string
+	ctx := context.WithValue(context.Background(), key("foo"), "bar")
+	var dialed []string
+	forward := ContextDialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		if got := ctx.Value(key("foo")); got != "bar" {
+			t.Errorf("forward dialer context = %T %v, want %q", got, got, "bar")
+		}
+		dialed = append(dialed, address)
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	})
+	proxy, err := SOCKS5("tcp", ss.Addr().String(), nil, forward)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := proxy.(ContextDialer).DialContext(ctx, "tcp", ss.TargetAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if len(dialed) != 1 || dialed[0] != ss.Addr().String() {
+		t.Errorf("forward dialer dialed %q, want [%q]", dialed, ss.Addr().String())
+	}
+}
+
 type funcFailDialer func(context.Context) error
 
 func (f funcFailDialer) Dial(net, addr string) (net.Conn, error) {
@@ -0,0 +1,141 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"time"
+)
+
+// A RetryDialer retries failed dials through its Forward dialer,
+// waiting with exponential backoff between attempts. It is intended
+// for proxies that occasionally fail with transient errors, such as a
+// connection reset during the proxy handshake.
+type RetryDialer struct {
+	// Forward is the dialer whose dials are retried. If nil, Direct
+	// is used.
+	Forward Dialer
+
+	// MaxAttempts is the maximum number of dials made, including the
+	// first. If zero or negative, 3 is used.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the second attempt. Each
+	// following delay is twice the previous one. If zero, 100ms is
+	// used.
+	BaseDelay time.Duration
+
+	// Jitter is the fraction, between 0 and 1, by which each delay is
+	// randomly increased or decreased, to spread out the retries of
+	// many clients. For example, with a Jitter of 0.1, a 100ms delay
+	// becomes a random delay between 90ms and 110ms.
+	Jitter float64
+
+	// Retryable reports whether a dial that failed with err should be
+	// retried. If nil, IsTransientDialError is used.
+	Retryable func(err error) bool
+}
+
+var (
+	_ Dialer        = (*RetryDialer)(nil)
+	_ ContextDialer = (*RetryDialer)(nil)
+)
+
+// Dial connects to the address addr on the given network through the
+// Forward dialer, retrying as needed.
+func (d *RetryDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the address addr on the given network
+// through the Forward dialer, retrying as needed. If ctx is done
+// while waiting between attempts, DialContext returns ctx.Err().
+// Otherwise, if every attempt fails or an error is not retryable, it
+// returns the error of the last attempt.
+func (d *RetryDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	forward := d.Forward
+	if forward == nil {
+		forward = Direct
+	}
+	retryable := d.Retryable
+	if retryable == nil {
+		retryable = IsTransientDialError
+	}
+	delay := d.baseDelay()
+	for attempt := 1; ; attempt++ {
+		var (
+			c   net.Conn
+			err error
+		)
+		if x, ok := forward.(ContextDialer); ok {
+			c, err = x.DialContext(ctx, network, addr)
+		} else {
+			c, err = dialContext(ctx, forward, network, addr)
+		}
+		if err == nil || attempt >= d.maxAttempts() || ctx.Err() != nil || !retryable(err) {
+			return c, err
+		}
+		timer := time.NewTimer(d.jitter(delay))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+func (d *RetryDialer) maxAttempts() int {
+	if d.MaxAttempts <= 0 {
+		return 3
+	}
+	return d.MaxAttempts
+}
+
+func (d *RetryDialer) baseDelay() time.Duration {
+	if d.BaseDelay == 0 {
+		return 100 * time.Millisecond
+	}
+	return d.BaseDelay
+}
+
+// jitter returns delay randomly adjusted by up to d.Jitter of itself.
+func (d *RetryDialer) jitter(delay time.Duration) time.Duration {
+	if d.Jitter <= 0 {
+		return delay
+	}
+	j := d.Jitter
+	if j > 1 {
+		j = 1
+	}
+	return time.Duration(float64(delay) * (1 + j*(2*rand.Float64()-1)))
+}
+
+// IsTransientDialError reports whether err, returned by a failed dial,
+// is likely to be transient: a timeout, a system-level network error
+// such as a refused or reset connection, or the proxy closing the
+// connection in the middle of its handshake. Errors reported by a
+// proxy protocol, such as authentication failures, and context
+// cancellation are not transient.
+func IsTransientDialError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var se *os.SyscallError
+	if errors.As(err, &se) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
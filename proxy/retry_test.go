@@ -0,0 +1,122 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// errReset is the error of a proxy that resets the connection during
+// its handshake.
+var errReset = &net.OpError{Op: "socks connect", Net: "tcp", Err: io.EOF}
+
+// errAuth is the error of a proxy that rejects the credentials.
+var errAuth = &net.OpError{Op: "socks connect", Net: "tcp", Err: errors.New("username/password authentication failed")}
+
+// failingDialer fails with the errors in errs, in order, and then
+// succeeds.
+type failingDialer struct {
+	errs     []error
+	attempts int
+	times    []time.Time
+}
+
+func (d *failingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.attempts++
+	d.times = append(d.times, time.Now())
+	if len(d.errs) > 0 {
+		err := d.errs[0]
+		d.errs = d.errs[1:]
+		return nil, err
+	}
+	c1, c2 := net.Pipe()
+	c2.Close()
+	return c1, nil
+}
+
+func (d *failingDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func TestRetryDialer(t *testing.T) {
+	const base = 20 * time.Millisecond
+	fd := &failingDialer{errs: []error{errReset, errReset}}
+	d := &RetryDialer{Forward: fd, BaseDelay: base}
+	c, err := d.DialContext(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Fatalf("DialContext = %v", err)
+	}
+	c.Close()
+	if fd.attempts != 3 {
+		t.Fatalf("dialed %d times, want 3", fd.attempts)
+	}
+	for i, want := range []time.Duration{base, 2 * base} {
+		if got := fd.times[i+1].Sub(fd.times[i]); got < want {
+			t.Errorf("delay before attempt %d = %v, want at least %v", i+2, got, want)
+		}
+	}
+}
+
+func TestRetryDialerMaxAttempts(t *testing.T) {
+	fd := &failingDialer{errs: []error{errReset, errReset, errReset}}
+	d := &RetryDialer{Forward: fd, MaxAttempts: 2, BaseDelay: time.Millisecond, Jitter: 0.5}
+	if _, err := d.Dial("tcp", "example.com:80"); err != errReset {
+		t.Errorf("Dial = %v, want %v", err, errReset)
+	}
+	if fd.attempts != 2 {
+		t.Errorf("dialed %d times, want 2", fd.attempts)
+	}
+}
+
+func TestRetryDialerNotRetryable(t *testing.T) {
+	fd := &failingDialer{errs: []error{errAuth}}
+	d := &RetryDialer{Forward: fd, BaseDelay: time.Millisecond}
+	if _, err := d.DialContext(context.Background(), "tcp", "example.com:80"); err != errAuth {
+		t.Errorf("DialContext = %v, want %v", err, errAuth)
+	}
+	if fd.attempts != 1 {
+		t.Errorf("dialed %d times, want 1", fd.attempts)
+	}
+}
+
+func TestRetryDialerContextCanceled(t *testing.T) {
+	fd := &failingDialer{errs: []error{errReset}}
+	d := &RetryDialer{Forward: fd, BaseDelay: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := d.DialContext(ctx, "tcp", "example.com:80"); err != context.Canceled {
+		t.Errorf("DialContext = %v, want %v", err, context.Canceled)
+	}
+	if fd.attempts != 1 {
+		t.Errorf("dialed %d times, want 1", fd.attempts)
+	}
+}
+
+func TestIsTransientDialError(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{errReset, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errors.New("connection refused"))}, true},
+		{&net.OpError{Op: "socks connect", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", errors.New("connection reset by peer"))}}, true},
+		{&net.DNSError{Err: "timeout", IsTimeout: true}, true},
+		{io.ErrUnexpectedEOF, true},
+		{errAuth, false},
+		{&net.OpError{Op: "dial", Err: context.Canceled}, false},
+		{context.DeadlineExceeded, false},
+		{errors.New("proxy: unknown scheme: gopher"), false},
+	} {
+		if got := IsTransientDialError(tt.err); got != tt.want {
+			t.Errorf("IsTransientDialError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -40,3 +40,22 @@ func SOCKS5(network, address string, auth *Auth, forward Dialer) (Dialer, error)
 	}
 	return d, nil
 }
+
+// BoundAddr returns the address reported by a SOCKS5 proxy server in
+// its reply to the CONNECT command of c: the address the server bound
+// to connect to the target. Some protocols, such as FTP in active
+// mode, need to announce it to their peer.
+//
+// c must have been returned by the DialContext method of a Dialer
+// created by SOCKS5, or by the Dial function of this package called
+// with such a Dialer. Its Dial method returns the raw connection to
+// the proxy server, for which BoundAddr reports false, as it does for
+// connections not made through a SOCKS5 proxy.
+func BoundAddr(c net.Conn) (net.Addr, bool) {
+	sc, ok := c.(*socks.Conn)
+	if !ok {
+		return nil, false
+	}
+	a := sc.BoundAddr()
+	return a, a != nil
+}
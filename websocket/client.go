@@ -6,10 +6,12 @@ package websocket
 
 import (
 	"bufio"
+	"context"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 // DialError is an error that occurs while dialling a websocket server.
@@ -53,6 +55,12 @@ func NewClient(config *Config, rwc io.ReadWriteCloser) (ws *Conn, err error) {
 
 // Dial opens a new client connection to a WebSocket.
 func Dial(url_, protocol, origin string) (ws *Conn, err error) {
+	return DialContext(context.Background(), url_, protocol, origin)
+}
+
+// DialContext is like Dial, but gives up when ctx is done. See
+// Config.DialContext.
+func DialContext(ctx context.Context, url_, protocol, origin string) (ws *Conn, err error) {
 	config, err := NewConfig(url_, origin)
 	if err != nil {
 		return nil, err
@@ -60,7 +68,7 @@ func Dial(url_, protocol, origin string) (ws *Conn, err error) {
 	if protocol != "" {
 		config.Protocol = []string{protocol}
 	}
-	return DialConfig(config)
+	return config.DialContext(ctx)
 }
 
 var portMap = map[string]string{
@@ -79,6 +87,17 @@ func parseAuthority(location *url.URL) string {
 
 // DialConfig opens a new client connection to a WebSocket with a config.
 func DialConfig(config *Config) (ws *Conn, err error) {
+	return config.DialContext(context.Background())
+}
+
+// DialContext opens a new client connection to a WebSocket with config,
+// giving up when ctx is done. The context applies to the TCP connect,
+// the TLS handshake and the WebSocket handshake, whose reads and writes
+// are interrupted by moving the deadline of the connection into the
+// past; if the WebSocket handshake is interrupted, the Err of the
+// DialError returned is ctx.Err(). The context does not affect the
+// connection once established.
+func (config *Config) DialContext(ctx context.Context) (ws *Conn, err error) {
 	var client net.Conn
 	if config.Location == nil {
 		return nil, &DialError{config, ErrBadWebSocketLocation}
@@ -90,11 +109,11 @@ func DialConfig(config *Config) (ws *Conn, err error) {
 	if dialer == nil {
 		dialer = &net.Dialer{}
 	}
-	client, err = dialWithDialer(dialer, config)
+	client, err = dialWithDialer(ctx, dialer, config)
 	if err != nil {
 		goto Error
 	}
-	ws, err = NewClient(config, client)
+	ws, err = newClientContext(ctx, config, client)
 	if err != nil {
 		client.Close()
 		goto Error
@@ -104,3 +123,34 @@ func DialConfig(config *Config) (ws *Conn, err error) {
 Error:
 	return nil, &DialError{config, err}
 }
+
+// newClientContext runs NewClient on conn, interrupting the handshake
+// if ctx is done first.
+func newClientContext(ctx context.Context, config *Config, conn net.Conn) (*Conn, error) {
+	if ctx.Done() == nil {
+		return NewClient(config, conn)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(aLongTimeAgo)
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
+		}
+	}()
+	ws, err := NewClient(config, conn)
+	close(stop)
+	if <-interrupted {
+		if err != nil {
+			return nil, ctx.Err()
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	return ws, err
+}
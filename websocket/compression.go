@@ -0,0 +1,631 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+// This file implements the permessage-deflate extension.
+// https://www.rfc-editor.org/rfc/rfc7692
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// CompressionOptions configures the permessage-deflate extension of
+// RFC 7692, which compresses the payload of messages with DEFLATE.
+// When Config.Compression is set, a client offers the extension in its
+// opening handshake, and a server accepts such offers. Messages are
+// then compressed and decompressed transparently; see
+// Conn.DisableCompression to send some uncompressed.
+type CompressionOptions struct {
+	// Level is the compression level, as for compress/flate, from
+	// flate.HuffmanOnly to flate.BestCompression. If zero or invalid,
+	// flate.DefaultCompression is used.
+	Level int
+
+	// ClientNoContextTakeover and ServerNoContextTakeover ask that
+	// the client, respectively the server, compress each message on
+	// its own, without referring to the data of previous messages.
+	// This saves the memory the peer keeps between messages, at the
+	// cost of compression ratio. A client asks for them in its offer
+	// and a server imposes them in its response; an endpoint always
+	// honors the one for its own messages.
+	ClientNoContextTakeover bool
+	ServerNoContextTakeover bool
+
+	// ClientMaxWindowBits and ServerMaxWindowBits limit the size of
+	// the LZ77 window, as a base-2 logarithm from 8 to 15, used to
+	// compress the messages of the client, respectively the server.
+	// They are negotiated like the no context takeover options. If
+	// zero or invalid, 15 is used. As compress/flate cannot limit its
+	// window, messages compressed with a window below 15 bits only use
+	// Huffman coding. Messages are decompressed with any window.
+	ClientMaxWindowBits int
+	ServerMaxWindowBits int
+}
+
+const (
+	deflateExtension = "permessage-deflate"
+
+	maxWindowBits = 15
+	maxWindowSize = 1 << maxWindowBits
+)
+
+// deflateTail ends the payload of each compressed message, from which
+// it is removed. See RFC 7692, section 7.2.1.
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// windowBits returns the window size given by an option, which is 15
+// unless the option is valid.
+func windowBits(bits int) int {
+	if bits < 8 || bits > maxWindowBits {
+		return maxWindowBits
+	}
+	return bits
+}
+
+func parseWindowBits(v string) (int, bool) {
+	if len(v) == 0 || len(v) > 2 || v[0] == '0' {
+		return 0, false
+	}
+	bits, err := strconv.Atoi(v)
+	if err != nil || bits < 8 || bits > maxWindowBits {
+		return 0, false
+	}
+	return bits, true
+}
+
+// deflateParams are the negotiated parameters of the permessage-deflate
+// extension of a connection.
+type deflateParams struct {
+	serverNoContextTakeover bool
+	clientNoContextTakeover bool
+
+	// The window bits given in the server's response, or 0 if it has
+	// none.
+	serverMaxWindowBits int
+	clientMaxWindowBits int
+}
+
+// String returns p as the value of the Sec-WebSocket-Extensions header
+// field of a server's response.
+func (p *deflateParams) String() string {
+	s := deflateExtension
+	if p.serverNoContextTakeover {
+		s += "; server_no_context_takeover"
+	}
+	if p.clientNoContextTakeover {
+		s += "; client_no_context_takeover"
+	}
+	if p.serverMaxWindowBits != 0 {
+		s += "; server_max_window_bits=" + strconv.Itoa(p.serverMaxWindowBits)
+	}
+	if p.clientMaxWindowBits != 0 {
+		s += "; client_max_window_bits=" + strconv.Itoa(p.clientMaxWindowBits)
+	}
+	return s
+}
+
+// offer returns the value of the Sec-WebSocket-Extensions header field
+// of a client using o.
+func (o *CompressionOptions) offer() string {
+	s := deflateExtension
+	if o.ServerNoContextTakeover {
+		s += "; server_no_context_takeover"
+	}
+	if o.ClientNoContextTakeover {
+		s += "; client_no_context_takeover"
+	}
+	if bits := windowBits(o.ServerMaxWindowBits); bits < maxWindowBits {
+		s += "; server_max_window_bits=" + strconv.Itoa(bits)
+	}
+	// The client supports any window the server wants it to use.
+	if bits := windowBits(o.ClientMaxWindowBits); bits < maxWindowBits {
+		s += "; client_max_window_bits=" + strconv.Itoa(bits)
+	} else {
+		s += "; client_max_window_bits"
+	}
+	return s
+}
+
+// acceptOffer returns the parameters with which a server using o
+// accepts the first valid permessage-deflate offer in the values of the
+// Sec-WebSocket-Extensions header fields of a client's request, or nil
+// if there is none.
+func (o *CompressionOptions) acceptOffer(values []string) *deflateParams {
+	exts, ok := parseExtensions(values)
+	if !ok {
+		return nil
+	}
+	for _, ext := range exts {
+		if ext.name != deflateExtension {
+			continue
+		}
+		if p := o.accept(ext); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// accept returns the parameters with which a server using o accepts
+// offer, or nil if the offer is invalid.
+func (o *CompressionOptions) accept(offer extension) *deflateParams {
+	p := &deflateParams{
+		serverNoContextTakeover: o.ServerNoContextTakeover,
+		clientNoContextTakeover: o.ClientNoContextTakeover,
+	}
+	serverBits := windowBits(o.ServerMaxWindowBits)
+	clientBits := windowBits(o.ClientMaxWindowBits)
+	offeredServerBits, offeredClientBits := false, false
+	seen := make(map[string]bool)
+	for _, param := range offer.params {
+		if seen[param.name] {
+			return nil
+		}
+		seen[param.name] = true
+		switch param.name {
+		case "server_no_context_takeover":
+			if param.hasValue {
+				return nil
+			}
+			p.serverNoContextTakeover = true
+		case "client_no_context_takeover":
+			if param.hasValue {
+				return nil
+			}
+			p.clientNoContextTakeover = true
+		case "server_max_window_bits":
+			bits, ok := parseWindowBits(param.value)
+			if !ok {
+				return nil
+			}
+			if bits < serverBits {
+				serverBits = bits
+			}
+			offeredServerBits = true
+		case "client_max_window_bits":
+			if param.hasValue {
+				bits, ok := parseWindowBits(param.value)
+				if !ok {
+					return nil
+				}
+				if bits < clientBits {
+					clientBits = bits
+				}
+			}
+			offeredClientBits = true
+		default:
+			return nil
+		}
+	}
+	// The response must give server_max_window_bits if the offer
+	// does, and may only give client_max_window_bits if the offer
+	// does. The server limits its own window regardless.
+	if offeredServerBits {
+		p.serverMaxWindowBits = serverBits
+	}
+	if offeredClientBits && clientBits < maxWindowBits {
+		p.clientMaxWindowBits = clientBits
+	}
+	return p
+}
+
+// acceptResponse returns the parameters that a server accepted in the
+// values of the Sec-WebSocket-Extensions header fields of its response
+// to a client using o. It reports false if they do not accept the
+// offer of the client.
+func (o *CompressionOptions) acceptResponse(values []string) (*deflateParams, bool) {
+	exts, ok := parseExtensions(values)
+	if !ok || len(exts) != 1 || exts[0].name != deflateExtension {
+		return nil, false
+	}
+	p := &deflateParams{}
+	seen := make(map[string]bool)
+	for _, param := range exts[0].params {
+		if seen[param.name] {
+			return nil, false
+		}
+		seen[param.name] = true
+		switch param.name {
+		case "server_no_context_takeover":
+			if param.hasValue {
+				return nil, false
+			}
+			p.serverNoContextTakeover = true
+		case "client_no_context_takeover":
+			if param.hasValue {
+				return nil, false
+			}
+			p.clientNoContextTakeover = true
+		case "server_max_window_bits":
+			bits, ok := parseWindowBits(param.value)
+			if !ok || bits > windowBits(o.ServerMaxWindowBits) {
+				return nil, false
+			}
+			p.serverMaxWindowBits = bits
+		case "client_max_window_bits":
+			bits, ok := parseWindowBits(param.value)
+			if !ok {
+				return nil, false
+			}
+			p.clientMaxWindowBits = bits
+		default:
+			return nil, false
+		}
+	}
+	if o.ServerNoContextTakeover && !p.serverNoContextTakeover {
+		// A server must either honor this or decline the offer.
+		return nil, false
+	}
+	return p, true
+}
+
+// An extension is an item of the Sec-WebSocket-Extensions header field.
+type extension struct {
+	name   string
+	params []extensionParam
+}
+
+type extensionParam struct {
+	name, value string
+	hasValue    bool
+}
+
+// parseExtensions parses the values of Sec-WebSocket-Extensions header
+// fields, as defined in RFC 6455, section 9.1. It reports false if one
+// is malformed.
+func parseExtensions(values []string) ([]extension, bool) {
+	var exts []extension
+	for _, v := range values {
+		items, ok := splitQuoted(v, ',')
+		if !ok {
+			return nil, false
+		}
+		for _, item := range items {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+			parts, _ := splitQuoted(item, ';')
+			ext := extension{name: strings.TrimSpace(parts[0])}
+			if !httpguts.ValidHeaderFieldName(ext.name) {
+				return nil, false
+			}
+			for _, part := range parts[1:] {
+				var param extensionParam
+				param.name = part
+				if i := strings.IndexByte(part, '='); i >= 0 {
+					param.name, param.value, param.hasValue = part[:i], strings.TrimSpace(part[i+1:]), true
+				}
+				param.name = strings.TrimSpace(param.name)
+				if param.hasValue && strings.HasPrefix(param.value, `"`) {
+					if param.value, ok = unquote(param.value); !ok {
+						return nil, false
+					}
+				}
+				if !httpguts.ValidHeaderFieldName(param.name) ||
+					param.hasValue && !httpguts.ValidHeaderFieldName(param.value) {
+					return nil, false
+				}
+				ext.params = append(ext.params, param)
+			}
+			exts = append(exts, ext)
+		}
+	}
+	return exts, true
+}
+
+// splitQuoted splits s at each sep outside quoted strings. It reports
+// false if a quoted string is not terminated.
+func splitQuoted(s string, sep byte) ([]string, bool) {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:]), !quoted
+}
+
+// unquote returns the contents of the quoted string s.
+func unquote(s string) (string, bool) {
+	if len(s) < 2 || s[len(s)-1] != '"' {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		c := s[i]
+		if c == '\\' {
+			i++
+			if i == len(s)-1 {
+				return "", false
+			}
+			c = s[i]
+		} else if c == '"' {
+			return "", false
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), true
+}
+
+// useCompression makes ws compress the messages it writes and
+// decompress those it reads, with the negotiated parameters p.
+func (ws *Conn) useCompression(handler *hybiFrameHandler, p *deflateParams) {
+	var opts CompressionOptions
+	if ws.config.Compression != nil {
+		opts = *ws.config.Compression
+	}
+	ownNoTakeover, peerNoTakeover := p.clientNoContextTakeover, p.serverNoContextTakeover
+	ownBits, optBits := p.clientMaxWindowBits, opts.ClientMaxWindowBits
+	if ws.IsServerConn() {
+		ownNoTakeover, peerNoTakeover = p.serverNoContextTakeover, p.clientNoContextTakeover
+		ownBits, optBits = p.serverMaxWindowBits, opts.ServerMaxWindowBits
+	}
+	bits := windowBits(ownBits)
+	if b := windowBits(optBits); b < bits {
+		bits = b
+	}
+	ws.frameWriterFactory = &deflateFrameWriterFactory{
+		frameWriterFactory: ws.frameWriterFactory,
+		conn:               ws,
+		deflater:           newDeflater(opts.Level, !ownNoTakeover, bits),
+	}
+	handler.inflater = &inflater{takeover: !peerNoTakeover}
+}
+
+// A deflater compresses the messages written to a connection.
+type deflater struct {
+	w        *flate.Writer
+	buf      bytes.Buffer
+	takeover bool // whether messages may refer to previous ones
+}
+
+func newDeflater(level int, takeover bool, bits int) *deflater {
+	if level == 0 || level < flate.HuffmanOnly || level > flate.BestCompression {
+		level = flate.DefaultCompression
+	}
+	if bits < maxWindowBits {
+		// Only Huffman coding is sure to stay within the window.
+		level = flate.HuffmanOnly
+	}
+	d := &deflater{takeover: takeover}
+	d.w, _ = flate.NewWriter(&d.buf, level) // level is valid
+	return d
+}
+
+// compress returns the payload of a compressed message carrying msg.
+// It is only valid until the next call.
+func (d *deflater) compress(msg []byte) ([]byte, error) {
+	d.buf.Reset()
+	if !d.takeover {
+		d.w.Reset(&d.buf)
+	}
+	if _, err := d.w.Write(msg); err != nil {
+		return nil, err
+	}
+	if err := d.w.Flush(); err != nil {
+		return nil, err
+	}
+	p := bytes.TrimSuffix(d.buf.Bytes(), deflateTail)
+	if len(p) == 0 {
+		// An empty stored block; see RFC 7692, section 7.2.3.6.
+		p = []byte{0x00}
+	}
+	return p, nil
+}
+
+// A deflateFrameWriterFactory creates frame writers that compress the
+// messages they write, unless the connection has DisableCompression
+// set.
+type deflateFrameWriterFactory struct {
+	frameWriterFactory
+	conn     *Conn
+	deflater *deflater
+}
+
+func (f *deflateFrameWriterFactory) NewFrameWriter(payloadType byte) (frameWriter, error) {
+	w, err := f.frameWriterFactory.NewFrameWriter(payloadType)
+	if err != nil || f.conn.DisableCompression || (payloadType != TextFrame && payloadType != BinaryFrame) {
+		return w, err
+	}
+	frame, ok := w.(*hybiFrameWriter)
+	if !ok {
+		return w, nil
+	}
+	// RSV1 marks the first frame of a compressed message.
+	frame.header.Rsv[0] = true
+	return &deflateFrameWriter{frame: frame, deflater: f.deflater}, nil
+}
+
+// A deflateFrameWriter writes compressed messages.
+type deflateFrameWriter struct {
+	frame    *hybiFrameWriter
+	deflater *deflater
+}
+
+func (w *deflateFrameWriter) Write(msg []byte) (n int, err error) {
+	p, err := w.deflater.compress(msg)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.frame.Write(p); err != nil {
+		return 0, err
+	}
+	return len(msg), nil
+}
+
+func (w *deflateFrameWriter) Close() error { return w.frame.Close() }
+
+// An inflater decompresses the messages read from a connection.
+type inflater struct {
+	r        io.ReadCloser // reused from message to message
+	takeover bool          // whether the peer's messages may refer to previous ones
+	window   []byte        // the end of the previous messages, if takeover
+}
+
+// reset prepares i to decompress a message read from src.
+func (i *inflater) reset(src io.Reader) {
+	var dict []byte
+	if i.takeover {
+		dict = i.window
+	}
+	if i.r == nil {
+		i.r = flate.NewReaderDict(src, dict)
+		return
+	}
+	i.r.(flate.Resetter).Reset(src, dict)
+}
+
+// record adds p, decompressed data, to the window of previous messages.
+func (i *inflater) record(p []byte) {
+	if !i.takeover {
+		return
+	}
+	i.window = append(i.window, p...)
+	if len(i.window) > 2*maxWindowSize {
+		// Only keep what later messages may refer to, copying it down
+		// once in a while.
+		n := copy(i.window, i.window[len(i.window)-maxWindowSize:])
+		i.window = i.window[:n]
+	}
+}
+
+// A compressedPayload reads the payload of the frames of a compressed
+// message, followed by the tail removed from it, so that it reads as a
+// DEFLATE stream. Control frames in between are handled on the way.
+type compressedPayload struct {
+	handler *hybiFrameHandler
+	frame   *hybiFrameReader // nil after the last frame
+	tail    []byte
+	err     error // error reading the next frame, if any
+}
+
+func (p *compressedPayload) Read(b []byte) (int, error) {
+	for {
+		if p.frame == nil {
+			if len(p.tail) == 0 {
+				return 0, io.EOF
+			}
+			n := copy(b, p.tail)
+			p.tail = p.tail[n:]
+			return n, nil
+		}
+		n, err := p.frame.Read(b)
+		if err == io.EOF {
+			err = p.next()
+			p.err = err
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// done reports whether the whole message has been read.
+func (p *compressedPayload) done() bool {
+	return p.frame == nil && len(p.tail) == 0
+}
+
+// next moves on to the next frame of the message.
+func (p *compressedPayload) next() error {
+	if p.frame.header.Fin {
+		p.frame = nil
+		p.tail = deflateTail
+		return nil
+	}
+	conn := p.handler.conn
+	for {
+		frame, err := conn.frameReaderFactory.NewFrameReader()
+		if err != nil {
+			return err
+		}
+		if hf, ok := frame.(*hybiFrameReader); ok && (hf.header.OpCode == TextFrame || hf.header.OpCode == BinaryFrame) {
+			// A new message started before the end of this one.
+			p.handler.WriteClose(closeStatusProtocolError)
+			return ErrBadFrame
+		}
+		frame, err = p.handler.HandleFrame(frame)
+		if err != nil {
+			return err
+		}
+		if frame != nil {
+			p.frame = frame.(*hybiFrameReader)
+			return nil
+		}
+	}
+}
+
+// A compressedMessageReader reads the decompressed payload of a
+// compressed message, which may span several frames.
+type compressedMessageReader struct {
+	handler *hybiFrameHandler
+	first   *hybiFrameReader
+	payload *compressedPayload
+	eof     bool
+}
+
+func newCompressedMessageReader(handler *hybiFrameHandler, first *hybiFrameReader) *compressedMessageReader {
+	r := &compressedMessageReader{
+		handler: handler,
+		first:   first,
+		payload: &compressedPayload{handler: handler, frame: first},
+	}
+	handler.inflater.reset(r.payload)
+	return r
+}
+
+func (r *compressedMessageReader) Read(msg []byte) (n int, err error) {
+	if r.eof {
+		return 0, io.EOF
+	}
+	n, err = r.handler.inflater.r.Read(msg)
+	if err != nil && r.payload.err != nil {
+		// The connection failed, or was closed, within the message.
+		err = r.payload.err
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+	if err == io.ErrUnexpectedEOF && r.payload.done() {
+		// The message ends with an unfinished DEFLATE stream, as it
+		// normally does.
+		err = io.EOF
+	}
+	if err == io.EOF {
+		r.eof = true
+		// Skip what may follow a final DEFLATE block.
+		if _, err1 := io.Copy(ioutil.Discard, r.payload); err1 != nil {
+			err = err1
+		}
+	}
+	r.handler.inflater.record(msg[:n])
+	if r.first.header.OpCode == TextFrame && !r.handler.utf8.valid(msg[:n], err == io.EOF) {
+		r.handler.WriteClose(closeStatusBadMessageData)
+		return 0, ErrInvalidUTF8
+	}
+	return n, err
+}
+
+func (r *compressedMessageReader) PayloadType() byte { return r.first.PayloadType() }
+
+func (r *compressedMessageReader) HeaderReader() io.Reader { return nil }
+
+func (r *compressedMessageReader) TrailerReader() io.Reader { return nil }
+
+func (r *compressedMessageReader) Len() int { return r.first.Len() }
@@ -0,0 +1,443 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newCompressedConn returns a connection that reads wireData and writes
+// to the returned buffer, with the permessage-deflate extension
+// negotiated with parameters p.
+func newCompressedConn(t *testing.T, server bool, wireData []byte, p *deflateParams) (*Conn, *bytes.Buffer) {
+	config := newConfig(t, "/")
+	config.Compression = &CompressionOptions{}
+	config.deflate = p
+	var req *http.Request
+	if server {
+		req = new(http.Request)
+	}
+	out := new(bytes.Buffer)
+	br := bufio.NewReader(bytes.NewReader(wireData))
+	bw := bufio.NewWriter(out)
+	return newHybiConn(config, bufio.NewReadWriter(br, bw), nil, req), out
+}
+
+// The examples of RFC 7692, section 7.2.3, as sent by a server.
+var compressedReadTests = []struct {
+	name     string
+	wireData []byte
+	params   deflateParams
+	want     []string
+}{{
+	name:     "message",
+	wireData: []byte{0xc1, 0x07, 0xf2, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00},
+	want:     []string{"Hello"},
+}, {
+	name: "fragmented",
+	wireData: []byte{
+		0x41, 0x03, 0xf2, 0x48, 0xcd,
+		0x80, 0x04, 0xc9, 0xc9, 0x07, 0x00,
+	},
+	want: []string{"Hello"},
+}, {
+	name: "ping between fragments",
+	wireData: []byte{
+		0x41, 0x03, 0xf2, 0x48, 0xcd,
+		0x89, 0x00,
+		0x80, 0x04, 0xc9, 0xc9, 0x07, 0x00,
+	},
+	want: []string{"Hello"},
+}, {
+	name: "context takeover",
+	wireData: []byte{
+		0xc1, 0x07, 0xf2, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00,
+		0xc1, 0x05, 0xf2, 0x00, 0x11, 0x00, 0x00,
+	},
+	want: []string{"Hello", "Hello"},
+}, {
+	name: "no context takeover",
+	wireData: []byte{
+		0xc1, 0x07, 0xf2, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00,
+		0xc1, 0x07, 0xf2, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00,
+	},
+	params: deflateParams{serverNoContextTakeover: true},
+	want:   []string{"Hello", "Hello"},
+}, {
+	name:     "stored block",
+	wireData: []byte{0xc1, 0x0b, 0x00, 0x05, 0x00, 0xfa, 0xff, 0x48, 0x65, 0x6c, 0x6c, 0x6f, 0x00},
+	want:     []string{"Hello"},
+}, {
+	name:     "final block",
+	wireData: []byte{0xc1, 0x08, 0xf3, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00, 0x00},
+	want:     []string{"Hello"},
+}, {
+	name: "uncompressed message",
+	wireData: []byte{
+		0x81, 0x05, 'H', 'e', 'l', 'l', 'o',
+		0xc1, 0x07, 0xf2, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00,
+	},
+	want: []string{"Hello", "Hello"},
+}, {
+	name:     "empty message",
+	wireData: []byte{0xc1, 0x01, 0x00},
+	want:     []string{""},
+}}
+
+func TestCompressedRead(t *testing.T) {
+	for _, tt := range compressedReadTests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := tt.params
+			conn, _ := newCompressedConn(t, false, tt.wireData, &params)
+			for i, want := range tt.want {
+				var msg string
+				if err := Message.Receive(conn, &msg); err != nil {
+					t.Fatalf("message %d: %v", i, err)
+				}
+				if msg != want {
+					t.Errorf("message %d = %q, want %q", i, msg, want)
+				}
+			}
+			var msg string
+			if err := Message.Receive(conn, &msg); err != io.EOF {
+				t.Errorf("after the messages: got %q, %v; want EOF", msg, err)
+			}
+		})
+	}
+}
+
+func TestCompressedReadWithConnRead(t *testing.T) {
+	wireData := []byte{
+		0x41, 0x03, 0xf2, 0x48, 0xcd,
+		0x80, 0x04, 0xc9, 0xc9, 0x07, 0x00,
+		0xc1, 0x05, 0xf2, 0x00, 0x11, 0x00, 0x00,
+	}
+	conn, _ := newCompressedConn(t, false, wireData, &deflateParams{})
+	got, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "HelloHello" {
+		t.Errorf("read %q, want %q", got, "HelloHello")
+	}
+}
+
+func TestCompressedReadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		wireData []byte
+		want     error
+	}{{
+		name: "RSV1 on continuation frame",
+		wireData: []byte{
+			0x41, 0x03, 0xf2, 0x48, 0xcd,
+			0xc0, 0x04, 0xc9, 0xc9, 0x07, 0x00,
+		},
+		want: io.ErrUnexpectedEOF,
+	}, {
+		name: "new message before the end",
+		wireData: []byte{
+			0x41, 0x03, 0xf2, 0x48, 0xcd,
+			0xc1, 0x07, 0xf2, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00,
+		},
+		want: ErrBadFrame,
+	}, {
+		name:     "invalid UTF-8",
+		wireData: []byte{0xc1, 0x03, 0xfa, 0x0f, 0x00}, // "\xff"
+		want:     ErrInvalidUTF8,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, _ := newCompressedConn(t, false, tt.wireData, &deflateParams{})
+			var msg string
+			if err := Message.Receive(conn, &msg); err != tt.want {
+				t.Errorf("Receive = %q, %v; want error %v", msg, err, tt.want)
+			}
+		})
+	}
+}
+
+// readCompressedFrames returns the payloads of the compressed frames
+// that a server wrote to out.
+func readCompressedFrames(t *testing.T, out []byte) [][]byte {
+	var payloads [][]byte
+	r := hybiFrameReaderFactory{bufio.NewReader(bytes.NewReader(out))}
+	for {
+		frame, err := r.NewFrameReader()
+		if err == io.EOF {
+			return payloads
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		hf := frame.(*hybiFrameReader)
+		if !hf.header.Fin || !hf.header.Rsv[0] {
+			t.Fatalf("frame with FIN %v and RSV1 %v, want both set", hf.header.Fin, hf.header.Rsv[0])
+		}
+		p, err := ioutil.ReadAll(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payloads = append(payloads, p)
+	}
+}
+
+func TestCompressedWrite(t *testing.T) {
+	msgs := []string{"Hello", strings.Repeat("Hello, world! ", 100), "", "Hello"}
+	for _, noTakeover := range []bool{false, true} {
+		conn, out := newCompressedConn(t, true, nil, &deflateParams{serverNoContextTakeover: noTakeover})
+		for _, msg := range msgs {
+			if _, err := conn.Write([]byte(msg)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		payloads := readCompressedFrames(t, out.Bytes())
+		if len(payloads) != len(msgs) {
+			t.Fatalf("no context takeover %v: got %d frames, want %d", noTakeover, len(payloads), len(msgs))
+		}
+		// Decompress the messages with compress/flate, as a single
+		// stream with context takeover.
+		var stream []byte
+		for i, p := range payloads {
+			if i > 0 && noTakeover {
+				// Each message stands on its own.
+				if got, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(append(p, deflateTail...)))); err != io.ErrUnexpectedEOF || string(got) != msgs[i] {
+					t.Errorf("message %d alone decompresses to %q, %v; want %q", i, got, err, msgs[i])
+				}
+			}
+			stream = append(stream, p...)
+			stream = append(stream, deflateTail...)
+		}
+		got, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(stream)))
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("decompressing: %v", err)
+		}
+		if want := strings.Join(msgs, ""); string(got) != want {
+			t.Errorf("no context takeover %v: decompressed %q, want %q", noTakeover, got, want)
+		}
+	}
+}
+
+func TestCompressedWriteDisabled(t *testing.T) {
+	conn, out := newCompressedConn(t, true, nil, &deflateParams{})
+	conn.DisableCompression = true
+	conn.PayloadType = BinaryFrame
+	if _, err := conn.Write([]byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x82, 0x05, 'H', 'e', 'l', 'l', 'o'}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("wrote % x, want % x", out.Bytes(), want)
+	}
+}
+
+func TestCompressedReceiveLimited(t *testing.T) {
+	const limit = 1024
+	d := newDeflater(0, true, maxWindowBits)
+	var wireData []byte
+	for _, msg := range []string{strings.Repeat("x", 64<<10), "Hello"} {
+		p, err := d.compress([]byte(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		w := &hybiFrameWriter{writer: bufio.NewWriter(&buf), header: &hybiFrameHeader{Fin: true, Rsv: [3]bool{true}, OpCode: TextFrame}}
+		w.Write(p)
+		wireData = append(wireData, buf.Bytes()...)
+	}
+	conn, _ := newCompressedConn(t, false, wireData, &deflateParams{})
+	conn.MaxPayloadBytes = limit
+	var msg string
+	if err := Message.Receive(conn, &msg); err != ErrFrameTooLarge {
+		t.Fatalf("first message: got %v, want ErrFrameTooLarge", err)
+	}
+	if err := Message.Receive(conn, &msg); err != nil || msg != "Hello" {
+		t.Errorf("second message: got %q, %v; want %q", msg, err, "Hello")
+	}
+}
+
+func TestCompressionOffer(t *testing.T) {
+	tests := []struct {
+		opts CompressionOptions
+		want string
+	}{
+		{CompressionOptions{}, "permessage-deflate; client_max_window_bits"},
+		{
+			CompressionOptions{ServerNoContextTakeover: true, ClientNoContextTakeover: true, ServerMaxWindowBits: 10, ClientMaxWindowBits: 12},
+			"permessage-deflate; server_no_context_takeover; client_no_context_takeover; server_max_window_bits=10; client_max_window_bits=12",
+		},
+		{CompressionOptions{ServerMaxWindowBits: 16, ClientMaxWindowBits: 7}, "permessage-deflate; client_max_window_bits"},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.offer(); got != tt.want {
+			t.Errorf("%+v: offer %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestCompressionAcceptOffer(t *testing.T) {
+	tests := []struct {
+		opts   CompressionOptions
+		offers []string
+		want   string // "" if declined
+	}{
+		// Offers made by browsers.
+		{CompressionOptions{}, []string{"permessage-deflate; client_max_window_bits"}, "permessage-deflate"},
+		{CompressionOptions{}, []string{"permessage-deflate"}, "permessage-deflate"},
+		{CompressionOptions{ClientMaxWindowBits: 10}, []string{"permessage-deflate; client_max_window_bits"}, "permessage-deflate; client_max_window_bits=10"},
+		{CompressionOptions{ClientMaxWindowBits: 10}, []string{"permessage-deflate"}, "permessage-deflate"},
+		{
+			CompressionOptions{ServerNoContextTakeover: true},
+			[]string{"permessage-deflate; client_max_window_bits"},
+			"permessage-deflate; server_no_context_takeover",
+		},
+		{
+			CompressionOptions{ServerMaxWindowBits: 12},
+			[]string{"permessage-deflate; server_max_window_bits=10; client_no_context_takeover"},
+			"permessage-deflate; client_no_context_takeover; server_max_window_bits=10",
+		},
+		{
+			CompressionOptions{ServerMaxWindowBits: 9},
+			[]string{`permessage-deflate; server_max_window_bits="10"`},
+			"permessage-deflate; server_max_window_bits=9",
+		},
+		// The first acceptable offer is accepted.
+		{
+			CompressionOptions{},
+			[]string{"x-webkit-deflate-frame", "permessage-deflate; unknown, permessage-deflate; client_max_window_bits=9"},
+			"permessage-deflate; client_max_window_bits=9",
+		},
+		// Invalid offers are declined.
+		{CompressionOptions{}, []string{"permessage-deflate; server_max_window_bits"}, ""},
+		{CompressionOptions{}, []string{"permessage-deflate; server_max_window_bits=16"}, ""},
+		{CompressionOptions{}, []string{"permessage-deflate; server_max_window_bits=08"}, ""},
+		{CompressionOptions{}, []string{"permessage-deflate; client_max_window_bits=7"}, ""},
+		{CompressionOptions{}, []string{"permessage-deflate; server_no_context_takeover=1"}, ""},
+		{CompressionOptions{}, []string{"permessage-deflate; server_no_context_takeover; server_no_context_takeover"}, ""},
+		{CompressionOptions{}, []string{`permessage-deflate; server_max_window_bits="10`}, ""},
+		{CompressionOptions{}, []string{"x-webkit-deflate-frame"}, ""},
+		{CompressionOptions{}, nil, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if p := tt.opts.acceptOffer(tt.offers); p != nil {
+			got = p.String()
+		}
+		if got != tt.want {
+			t.Errorf("%+v accepting %q: got %q, want %q", tt.opts, tt.offers, got, tt.want)
+		}
+	}
+}
+
+func TestCompressionAcceptResponse(t *testing.T) {
+	tests := []struct {
+		opts     CompressionOptions
+		response []string
+		ok       bool
+	}{
+		{CompressionOptions{}, []string{"permessage-deflate"}, true},
+		{CompressionOptions{}, []string{"permessage-deflate; client_max_window_bits=10; client_no_context_takeover"}, true},
+		{CompressionOptions{}, []string{"permessage-deflate; server_max_window_bits=10; server_no_context_takeover"}, true},
+		{CompressionOptions{ServerMaxWindowBits: 10}, []string{"permessage-deflate; server_max_window_bits=12"}, false},
+		{CompressionOptions{ServerNoContextTakeover: true}, []string{"permessage-deflate"}, false},
+		{CompressionOptions{}, []string{"permessage-deflate; client_max_window_bits"}, false},
+		{CompressionOptions{}, []string{"permessage-deflate; unknown"}, false},
+		{CompressionOptions{}, []string{"permessage-deflate", "permessage-deflate"}, false},
+		{CompressionOptions{}, []string{"x-webkit-deflate-frame"}, false},
+	}
+	for _, tt := range tests {
+		if _, ok := tt.opts.acceptResponse(tt.response); ok != tt.ok {
+			t.Errorf("%+v accepting %q: got %v, want %v", tt.opts, tt.response, ok, tt.ok)
+		}
+	}
+}
+
+// countingConn counts the bytes read from a connection.
+type countingConn struct {
+	net.Conn
+	n int
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestCompressionEcho(t *testing.T) {
+	tests := []struct {
+		name   string
+		server *CompressionOptions
+		client *CompressionOptions
+	}{
+		{"default", &CompressionOptions{}, &CompressionOptions{}},
+		{"no context takeover", &CompressionOptions{}, &CompressionOptions{ServerNoContextTakeover: true, ClientNoContextTakeover: true}},
+		{"server window", &CompressionOptions{ServerMaxWindowBits: 9, Level: flate.BestSpeed}, &CompressionOptions{}},
+		{"client window", &CompressionOptions{ClientMaxWindowBits: 9}, &CompressionOptions{}},
+		{"uncompressed server", nil, &CompressionOptions{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(Server{
+				Config: Config{Compression: tt.server},
+				Handler: func(ws *Conn) {
+					var msg string
+					for Message.Receive(ws, &msg) == nil {
+						if Message.Send(ws, msg) != nil {
+							return
+						}
+					}
+				},
+			})
+			defer server.Close()
+
+			config, err := NewConfig("ws"+strings.TrimPrefix(server.URL, "http"), "http://localhost")
+			if err != nil {
+				t.Fatal(err)
+			}
+			config.Compression = tt.client
+			c, err := net.Dial("tcp", server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			counter := &countingConn{Conn: c}
+			ws, err := NewClient(config, counter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+			if (config.deflate != nil) != (tt.server != nil) {
+				t.Fatalf("negotiated %v, want %v", config.deflate, tt.server != nil)
+			}
+
+			msg := strings.Repeat("Hello, world! ", 1000)
+			for i := 0; i < 3; i++ {
+				counter.n = 0
+				if err := Message.Send(ws, msg); err != nil {
+					t.Fatal(err)
+				}
+				var got string
+				if err := Message.Receive(ws, &got); err != nil {
+					t.Fatal(err)
+				}
+				if got != msg {
+					t.Fatalf("echoed %d bytes, want the %d bytes sent", len(got), len(msg))
+				}
+				if compressed := counter.n < len(msg)/2; compressed != (tt.server != nil) {
+					t.Errorf("read %d bytes for a message of %d bytes", counter.n, len(msg))
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@
 package websocket
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log"
@@ -41,3 +42,50 @@ func TestDialConfigTLSWithDialer(t *testing.T) {
 		t.Fatalf("expected timeout error, got %#v", neterr)
 	}
 }
+
+func TestDialContextHandshakeTimeout(t *testing.T) {
+	// The server accepts connections but never answers the handshake.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := DialContext(ctx, fmt.Sprintf("ws://%s/echo", ln.Addr()), "", "http://localhost")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		dialerr, ok := err.(*DialError)
+		if !ok {
+			t.Fatalf("DialError expected, got %#v", err)
+		}
+		if dialerr.Err != context.DeadlineExceeded {
+			t.Fatalf("DialError.Err = %v, want %v", dialerr.Err, context.DeadlineExceeded)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("DialContext did not give up on the handshake")
+	}
+}
+
+func TestDialContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config, _ := NewConfig("ws://127.0.0.1:1/echo", "http://localhost")
+	if _, err := config.DialContext(ctx); err == nil {
+		t.Fatal("DialContext with canceled context succeeded")
+	}
+}
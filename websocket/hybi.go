@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"unicode/utf8"
 )
 
 const (
@@ -46,6 +47,7 @@ var (
 	ErrBadClosingStatus      = &ProtocolError{"bad closing status"}
 	ErrUnsupportedExtensions = &ProtocolError{"unsupported extensions"}
 	ErrNotImplemented        = &ProtocolError{"not implemented"}
+	ErrInvalidUTF8           = &ProtocolError{"invalid UTF-8 in text message"}
 
 	handshakeHeader = map[string]bool{
 		"Host":                   true,
@@ -77,6 +79,10 @@ type hybiFrameReader struct {
 	header hybiFrameHeader
 	pos    int64
 	length int
+
+	// textHandler is the handler of the connection if the frame is
+	// part of a text message, whose UTF-8 it validates.
+	textHandler *hybiFrameHandler
 }
 
 func (frame *hybiFrameReader) Read(msg []byte) (n int, err error) {
@@ -87,6 +93,14 @@ func (frame *hybiFrameReader) Read(msg []byte) (n int, err error) {
 			frame.pos++
 		}
 	}
+	if h := frame.textHandler; h != nil {
+		if !h.utf8.valid(msg[:n], err == io.EOF && frame.header.Fin) {
+			// RFC 6455, section 8.1: fail the connection on
+			// invalid UTF-8 in a text message.
+			h.WriteClose(closeStatusBadMessageData)
+			return 0, ErrInvalidUTF8
+		}
+	}
 	return n, err
 }
 
@@ -262,6 +276,67 @@ func (buf hybiFrameWriterFactory) NewFrameWriter(payloadType byte) (frame frameW
 type hybiFrameHandler struct {
 	conn        *Conn
 	payloadType byte
+	utf8        utf8Validator
+
+	// inflater is set if the permessage-deflate extension is in use.
+	inflater *inflater
+	// compressed reports whether the current message is compressed.
+	compressed bool
+}
+
+// A utf8Validator incrementally validates the UTF-8 of a text message
+// read in pieces, which may split a character.
+type utf8Validator struct {
+	partial  [utf8.UTFMax]byte // incomplete character at the end of the last piece
+	npartial int
+	failed   bool
+}
+
+// reset prepares v for a new message.
+func (v *utf8Validator) reset() {
+	v.npartial = 0
+}
+
+// valid reports whether p, the next piece of the message, continues
+// valid UTF-8. If final is set, p is the last piece and may not end in
+// an incomplete character. Once it reports false, valid always does.
+func (v *utf8Validator) valid(p []byte, final bool) bool {
+	if v.failed {
+		return false
+	}
+	for v.npartial > 0 && len(p) > 0 {
+		v.partial[v.npartial] = p[0]
+		v.npartial++
+		p = p[1:]
+		if utf8.FullRune(v.partial[:v.npartial]) {
+			if _, size := utf8.DecodeRune(v.partial[:v.npartial]); size != v.npartial {
+				v.failed = true
+				return false
+			}
+			v.npartial = 0
+		}
+	}
+	for i := 0; i < len(p); {
+		if p[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(p[i:])
+		if r == utf8.RuneError && size == 1 {
+			if utf8.FullRune(p[i:]) {
+				v.failed = true
+				return false
+			}
+			v.npartial = copy(v.partial[:], p[i:])
+			break
+		}
+		i += size
+	}
+	if final && v.npartial > 0 {
+		v.failed = true
+		return false
+	}
+	return true
 }
 
 func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, error) {
@@ -281,11 +356,23 @@ func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, er
 	if header := frame.HeaderReader(); header != nil {
 		io.Copy(ioutil.Discard, header)
 	}
+	hf := frame.(*hybiFrameReader)
+	if hf.header.Rsv[0] && handler.inflater != nil &&
+		hf.header.OpCode != TextFrame && hf.header.OpCode != BinaryFrame {
+		// RSV1 is only set on the first frame of a compressed message.
+		handler.WriteClose(closeStatusProtocolError)
+		return nil, io.EOF
+	}
 	switch frame.PayloadType() {
 	case ContinuationFrame:
-		frame.(*hybiFrameReader).header.OpCode = handler.payloadType
+		hf.header.OpCode = handler.payloadType
 	case TextFrame, BinaryFrame:
 		handler.payloadType = frame.PayloadType()
+		handler.utf8.reset()
+		handler.compressed = hf.header.Rsv[0] && handler.inflater != nil
+		if handler.compressed {
+			return newCompressedMessageReader(handler, hf), nil
+		}
 	case CloseFrame:
 		return nil, io.EOF
 	case PingFrame, PongFrame:
@@ -302,6 +389,9 @@ func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, er
 		}
 		return nil, nil
 	}
+	if frame.PayloadType() == TextFrame && !handler.compressed {
+		hf.textHandler = handler
+	}
 	return frame, nil
 }
 
@@ -344,7 +434,11 @@ func newHybiConn(config *Config, buf *bufio.ReadWriter, rwc io.ReadWriteCloser,
 			buf.Writer, request == nil},
 		PayloadType:        TextFrame,
 		defaultCloseStatus: closeStatusNormal}
-	ws.frameHandler = &hybiFrameHandler{conn: ws}
+	handler := &hybiFrameHandler{conn: ws}
+	ws.frameHandler = handler
+	if config.deflate != nil {
+		ws.useCompression(handler, config.deflate)
+	}
 	return ws
 }
 
@@ -426,7 +520,10 @@ func hybiClientHandshake(config *Config, br *bufio.Reader, bw *bufio.Writer) (er
 	if len(config.Protocol) > 0 {
 		bw.WriteString("Sec-WebSocket-Protocol: " + strings.Join(config.Protocol, ", ") + "\r\n")
 	}
-	// TODO(ukai): send Sec-WebSocket-Extensions.
+	config.deflate = nil
+	if config.Compression != nil {
+		bw.WriteString("Sec-WebSocket-Extensions: " + config.Compression.offer() + "\r\n")
+	}
 	err = config.Header.WriteSubset(bw, handshakeHeader)
 	if err != nil {
 		return err
@@ -455,8 +552,16 @@ func hybiClientHandshake(config *Config, br *bufio.Reader, bw *bufio.Writer) (er
 	if resp.Header.Get("Sec-WebSocket-Accept") != string(expectedAccept) {
 		return ErrChallengeResponse
 	}
-	if resp.Header.Get("Sec-WebSocket-Extensions") != "" {
-		return ErrUnsupportedExtensions
+	if config.Compression == nil {
+		if resp.Header.Get("Sec-WebSocket-Extensions") != "" {
+			return ErrUnsupportedExtensions
+		}
+	} else if exts := resp.Header.Values("Sec-WebSocket-Extensions"); len(exts) > 0 {
+		p, ok := config.Compression.acceptResponse(exts)
+		if !ok {
+			return ErrUnsupportedExtensions
+		}
+		config.deflate = p
 	}
 	offeredProtocol := resp.Header.Get("Sec-WebSocket-Protocol")
 	if offeredProtocol != "" {
@@ -527,6 +632,10 @@ func (c *hybiServerHandshaker) ReadHandshake(buf *bufio.Reader, req *http.Reques
 			c.Protocol = append(c.Protocol, strings.TrimSpace(protocols[i]))
 		}
 	}
+	c.deflate = nil
+	if c.Compression != nil {
+		c.deflate = c.Compression.acceptOffer(req.Header.Values("Sec-Websocket-Extensions"))
+	}
 	c.accept, err = getNonceAccept([]byte(key))
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -562,7 +671,9 @@ func (c *hybiServerHandshaker) AcceptHandshake(buf *bufio.Writer) (err error) {
 	if len(c.Protocol) > 0 {
 		buf.WriteString("Sec-WebSocket-Protocol: " + c.Protocol[0] + "\r\n")
 	}
-	// TODO(ukai): send Sec-WebSocket-Extensions.
+	if c.deflate != nil {
+		buf.WriteString("Sec-WebSocket-Extensions: " + c.deflate.String() + "\r\n")
+	}
 	if c.Header != nil {
 		err := c.Header.WriteSubset(buf, handshakeHeader)
 		if err != nil {
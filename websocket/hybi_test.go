@@ -558,6 +558,89 @@ func TestHybiClientReadWithMasking(t *testing.T) {
 	}
 }
 
+func TestHybiClientReadUTF8(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		wireData []byte
+		want     string // data read before the error, if any
+		wantErr  error
+	}{{
+		name: "split character",
+		wireData: []byte{
+			0x01, 0x02, 'a', 0xc3, // "aé", split in the middle of "é"
+			0x80, 0x01, 0xa9,
+		},
+		want: "a\xc3\xa9",
+	}, {
+		name: "invalid split sequence",
+		wireData: []byte{
+			0x01, 0x02, 'a', 0xe2,
+			0x80, 0x02, 0x82, 0x28, // 0xe2 0x82 0x28 is not UTF-8
+		},
+		want:    "a\xe2",
+		wantErr: ErrInvalidUTF8,
+	}, {
+		name: "truncated final character",
+		wireData: []byte{
+			0x01, 0x01, 'a',
+			0x80, 0x02, 0xe2, 0x82,
+		},
+		want:    "a\xe2\x82",
+		wantErr: ErrInvalidUTF8,
+	}, {
+		name:     "binary",
+		wireData: []byte{0x82, 0x02, 0xe2, 0x28},
+		want:     "\xe2\x28",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReader(bytes.NewBuffer(tt.wireData))
+			var out bytes.Buffer
+			bw := bufio.NewWriter(&out)
+			conn := newHybiConn(newConfig(t, "/"), bufio.NewReadWriter(br, bw), nil, nil)
+
+			var got []byte
+			var err error
+			msg := make([]byte, 512)
+			for {
+				var n int
+				n, err = conn.Read(msg)
+				got = append(got, msg[:n]...)
+				if err != nil {
+					break
+				}
+			}
+			if string(got) != tt.want {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+			if tt.wantErr == nil {
+				if err != io.EOF {
+					t.Errorf("Read error = %v, want %v", err, io.EOF)
+				}
+				if out.Len() != 0 {
+					t.Errorf("wrote %x, want nothing", out.Bytes())
+				}
+				return
+			}
+			if err != tt.wantErr {
+				t.Errorf("Read error = %v, want %v", err, tt.wantErr)
+			}
+			// The client must have sent a masked close frame with
+			// status 1007.
+			b := out.Bytes()
+			if len(b) != 8 || b[0] != 0x88 || b[1] != 0x82 {
+				t.Fatalf("wrote %x, want a masked close frame", b)
+			}
+			status := []byte{b[6] ^ b[2], b[7] ^ b[3]}
+			if got := int(status[0])<<8 | int(status[1]); got != closeStatusBadMessageData {
+				t.Errorf("close status = %d, want %d", got, closeStatusBadMessageData)
+			}
+			if _, err := conn.Read(msg); err != tt.wantErr {
+				t.Errorf("Read after failure = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 // Test the hybiServerHandshaker supports firefox implementation and
 // checks Connection request header include (but it's not necessary
 // equal to) "upgrade"
@@ -13,6 +13,7 @@ package websocket // import "golang.org/x/net/websocket"
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -100,6 +101,14 @@ type Config struct {
 	// Dialer used when opening websocket connections.
 	Dialer *net.Dialer
 
+	// Compression, if non-nil, enables the permessage-deflate
+	// extension: a client offers it and a server accepts it.
+	Compression *CompressionOptions
+
+	// deflate holds the parameters of the permessage-deflate extension
+	// negotiated during the handshake, if any.
+	deflate *deflateParams
+
 	handshakeData map[string]string
 }
 
@@ -180,7 +189,15 @@ type Conn struct {
 
 	// MaxPayloadBytes limits the size of frame payload received over Conn
 	// by Codec's Receive method. If zero, DefaultMaxPayloadBytes is used.
+	// For compressed messages, it limits the decompressed size.
 	MaxPayloadBytes int
+
+	// DisableCompression makes the messages written over Conn be sent
+	// uncompressed even if the permessage-deflate extension is in use,
+	// for example when they hold data that is already compressed. It may
+	// be changed between messages. Received messages are decompressed
+	// regardless.
+	DisableCompression bool
 }
 
 // Read implements the io.Reader interface:
@@ -188,6 +205,8 @@ type Conn struct {
 // if msg is not large enough for the frame data, it fills the msg and next Read
 // will read the rest of the frame data.
 // it reads Text frame or Binary frame.
+// if a text message is not valid UTF-8, it closes the connection with status
+// 1007 and returns ErrInvalidUTF8.
 func (ws *Conn) Read(msg []byte) (n int, err error) {
 	ws.rio.Lock()
 	defer ws.rio.Unlock()
@@ -362,13 +381,81 @@ again:
 		return ErrFrameTooLarge
 	}
 	payloadType := frame.PayloadType()
-	data, err := ioutil.ReadAll(frame)
+	var data []byte
+	if _, ok := frame.(*compressedMessageReader); ok {
+		data, err = ioutil.ReadAll(io.LimitReader(frame, int64(maxPayloadBytes)+1))
+		if err == nil && len(data) > maxPayloadBytes {
+			// Leave the rest of the message to be drained, as above.
+			ws.frameReader = frame
+			return ErrFrameTooLarge
+		}
+	} else {
+		data, err = ioutil.ReadAll(frame)
+	}
 	if err != nil {
 		return err
 	}
 	return cd.Unmarshal(data, payloadType, v)
 }
 
+// ReceiveContext is like Receive, but gives up when ctx is done, in
+// which case it returns ctx.Err(). It interrupts the pending read by
+// moving the read deadline of the underlying net.Conn into the past,
+// and clears the read deadline before returning. If ws does not use a
+// net.Conn and ctx can be done, ReceiveContext fails without reading.
+//
+// A canceled receive may have read part of a frame, so the connection
+// should then be closed; Close still works as usual.
+func (cd Codec) ReceiveContext(ctx context.Context, ws *Conn, v interface{}) error {
+	return ws.readContext(ctx, func() error { return cd.Receive(ws, v) })
+}
+
+// ReadMessageContext receives a single message from ws and returns its
+// payload, as Message.Receive into a []byte would, but gives up when ctx
+// is done. See Codec.ReceiveContext for the handling of cancellation.
+func (ws *Conn) ReadMessageContext(ctx context.Context) ([]byte, error) {
+	var msg []byte
+	err := Message.ReceiveContext(ctx, ws, &msg)
+	return msg, err
+}
+
+// aLongTimeAgo is a read deadline in the past, used to interrupt reads.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// readContext runs read, interrupting it if ctx is done first.
+func (ws *Conn) readContext(ctx context.Context, read func() error) error {
+	if ctx.Done() == nil {
+		return read()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	conn, ok := ws.rwc.(net.Conn)
+	if !ok {
+		return errSetDeadline
+	}
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(aLongTimeAgo)
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
+		}
+	}()
+	err := read()
+	close(stop)
+	if <-interrupted {
+		conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
 func marshal(v interface{}) (msg []byte, payloadType byte, err error) {
 	switch data := v.(type) {
 	case string:
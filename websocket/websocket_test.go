@@ -6,6 +6,7 @@ package websocket
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"fmt"
 	"io"
@@ -166,6 +167,31 @@ func TestEcho(t *testing.T) {
 	conn.Close()
 }
 
+func TestDialContext(t *testing.T) {
+	once.Do(startServer)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	conn, err := newConfig(t, "/echo").DialContext(ctx)
+	if err != nil {
+		t.Fatal("DialContext:", err)
+	}
+	defer conn.Close()
+	// The connection outlives the context used to dial it.
+	cancel()
+	msg := []byte("hello, world\n")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got := make([]byte, 512)
+	n, err := conn.Read(got)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if !bytes.Equal(msg, got[:n]) {
+		t.Errorf("Echo: expected %q got %q", msg, got[:n])
+	}
+}
+
 func TestAddr(t *testing.T) {
 	once.Do(startServer)
 
@@ -663,3 +689,40 @@ func TestCodec_ReceiveLimited(t *testing.T) {
 	}
 	<-handlerDone
 }
+
+func TestReadMessageContext(t *testing.T) {
+	once.Do(startServer)
+
+	client, err := net.Dial("tcp", serverAddr)
+	if err != nil {
+		t.Fatal("dialing", err)
+	}
+	conn, err := NewClient(newConfig(t, "/echo"), client)
+	if err != nil {
+		t.Fatalf("WebSocket handshake error: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := conn.ReadMessageContext(ctx); err != context.Canceled {
+		t.Fatalf("ReadMessageContext = %v, want %v", err, context.Canceled)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("ReadMessageContext returned after %v", d)
+	}
+
+	// Nothing was read, so the connection is still usable.
+	msg := []byte("hello, world")
+	if err := Message.Send(conn, msg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := conn.ReadMessageContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Errorf("ReadMessageContext = %q, want %q", got, msg)
+	}
+}